@@ -0,0 +1,280 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request, it's generated when the client sends none.
+// The responses echo it.
+const RequestIDHeader = "X-Request-ID"
+
+// AccessLogPolicy writes an access log line per request, apart from the application logs.
+// Zero values are replaced by the defaults.
+type AccessLogPolicy struct {
+	// Writer receives a JSON line per request, no access log is written when it's nil.
+	Writer io.Writer
+	// BodySampleRate is the probability of an error having its request & response bodies logged, within [0, 1].
+	// The bodies of the successful requests are never logged.
+	BodySampleRate float64
+	// MaxBodyBytes truncates the logged bodies.
+	MaxBodyBytes int
+	// Seed makes the sampling of the bodies reproducible.
+	Seed int64
+}
+
+func (p AccessLogPolicy) withDefaults() AccessLogPolicy {
+	if p.MaxBodyBytes <= 0 {
+		p.MaxBodyBytes = 1024
+	}
+
+	return p
+}
+
+// AccessLogEntry is a line of the access log.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	ClientIP   string    `json:"client_ip"`
+	RequestID  string    `json:"request_id"`
+	APIKey     string    `json:"api_key,omitempty"`
+	// Experiment & Variant are the assignment of the searches ranked by an experiment.
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+	// The bodies are only logged for the sampled errors, truncated.
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+}
+
+// accessLog writes the lines of the policy, one at a time.
+type accessLog struct {
+	policy AccessLogPolicy
+	quotas QuotaPolicy
+	clock  Clock
+
+	mu   sync.Mutex
+	enc  *json.Encoder
+	rand *rand.Rand
+}
+
+// sample draws whether the bodies of the request are kept, in case it fails.
+func (l *accessLog) sample() bool {
+	if l.policy.BodySampleRate <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rand.Float64() < l.policy.BodySampleRate
+}
+
+func (l *accessLog) write(entry AccessLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_ = l.enc.Encode(entry)
+}
+
+// withAccessLog logs every request to the writer of the policy, when it's set.
+func withAccessLog(se *SearchEngine, next http.Handler) http.Handler {
+	p := se.configuration.AccessLogPolicy
+	if p.Writer == nil {
+		return next
+	}
+
+	seed := uint64(p.Seed)
+	l := &accessLog{
+		policy: p,
+		quotas: se.configuration.QuotaPolicy,
+		clock:  se.clock,
+		enc:    json.NewEncoder(p.Writer),
+		rand:   rand.New(rand.NewPCG(seed, seed)),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := l.clock.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+		var reqBody *cappedBuffer
+		if l.sample() {
+			reqBody = &cappedBuffer{max: p.MaxBodyBytes}
+			rec.body = &cappedBuffer{max: p.MaxBodyBytes}
+			if r.Body != nil {
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.TeeReader(r.Body, reqBody), r.Body}
+			}
+		}
+
+		tags := &accessTags{}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessTagsKey{}, tags)))
+
+		entry := AccessLogEntry{
+			Time:       start,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      normalizedQuery(se.queryLabels, r.URL.RawQuery),
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMS: milliseconds(l.clock.Now().Sub(start)),
+			ClientIP:   clientIP(r),
+			RequestID:  id,
+			APIKey:     l.quotas.keyName(r.Header.Get(APIKeyHeader)),
+		}
+		tags.mu.Lock()
+		entry.Experiment, entry.Variant = tags.experiment.Experiment, tags.experiment.Variant
+		tags.mu.Unlock()
+		// the error bodies may echo the queries.
+		if reqBody != nil && rec.status >= http.StatusBadRequest && (se.queryLabels.mode == LogQueriesFull || !r.URL.Query().Has("q")) {
+			entry.RequestBody = reqBody.String()
+			entry.ResponseBody = rec.body.String()
+		}
+		l.write(entry)
+	})
+}
+
+// accessTags are what the handlers tell the access log about a request.
+type accessTags struct {
+	mu         sync.Mutex
+	experiment ExperimentAssignment
+}
+
+type accessTagsKey struct{}
+
+// tagExperiment tells the access log the assignment of the request, when it's logged.
+func tagExperiment(ctx context.Context, a ExperimentAssignment) {
+	if tags, ok := ctx.Value(accessTagsKey{}).(*accessTags); ok {
+		tags.mu.Lock()
+		tags.experiment = a
+		tags.mu.Unlock()
+	}
+}
+
+// accessRecorder records the status & the size of a response, its body too when it's sampled.
+type accessRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+	body        *cappedBuffer
+}
+
+func (r *accessRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	if r.body != nil {
+		_, _ = r.body.Write(b[:n])
+	}
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the response.
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// cappedBuffer keeps the first max bytes written to it, the rest is dropped.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(room, len(p))])
+	}
+
+	return len(p), nil
+}
+
+// normalizedQuery returns the query string with its parameters sorted & its queries labeled.
+// A malformed one is logged as it is when the queries are, left out otherwise.
+func normalizedQuery(labels queryLabeler, raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		if labels.mode == LogQueriesFull {
+			return raw
+		}
+		return ""
+	}
+
+	return labels.values(values).Encode()
+}
+
+// clientIP returns the address of the peer, the forwarding headers aren't trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// requestID returns the ID of the request, a new one is set on the response when it has none.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = w.Header().Get(RequestIDHeader)
+	}
+	if id == "" {
+		id = newRequestID()
+		w.Header().Set(RequestIDHeader, id)
+	}
+
+	return id
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	var b [8]byte
+	_, _ = cryptorand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+// keyName names the API key in the logs, by its configured name or a fingerprint.
+// The key itself is never logged.
+func (p QuotaPolicy) keyName(key string) string {
+	if key == "" {
+		return ""
+	}
+	if q, ok := p.Keys[key]; ok && q.Name != "" {
+		return q.Name
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,151 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+// syncBuffer is a buffer the access log & the test may use at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries decodes the access log lines written so far.
+func (b *syncBuffer) entries() []searchAPI.AccessLogEntry {
+	GinkgoHelper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []searchAPI.AccessLogEntry
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry searchAPI.AccessLogEntry
+		Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+		out = append(out, entry)
+	}
+	return out
+}
+
+var _ = Describe("Access log", func() {
+	var (
+		se  *httptest.Server
+		log *syncBuffer
+	)
+
+	newServer := func(p searchAPI.AccessLogPolicy) {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		log = &syncBuffer{}
+		p.Writer = log
+		cfg := searchAPI.Configuration{
+			AccessLogPolicy: p,
+			AdminPolicy:     searchAPI.AdminPolicy{Token: adminToken},
+			QuotaPolicy:     searchAPI.QuotaPolicy{Keys: map[string]searchAPI.Quota{"s3cret": {Name: "partner"}}},
+		}
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	}
+
+	send := func(method, path, key, id, body string) *http.Response {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if key != "" {
+			req.Header.Set(searchAPI.APIKeyHeader, key)
+		}
+		if id != "" {
+			req.Header.Set(searchAPI.RequestIDHeader, id)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	It("writes a JSON line per request with its fields", func() {
+		newServer(searchAPI.AccessLogPolicy{})
+		resp := send(http.MethodGet, "/search?q=lion&limit=1", "s3cret", "req-1", "")
+		Expect(resp.Header.Get(searchAPI.RequestIDHeader)).To(Equal("req-1"))
+		resp = send(http.MethodGet, "/search?q=", "unnamed", "", "")
+		generated := resp.Header.Get(searchAPI.RequestIDHeader)
+		Expect(generated).NotTo(BeEmpty())
+
+		entries := log.entries()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0]).To(MatchFields(IgnoreExtras, Fields{
+			"Time":      Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+			"Method":    Equal(http.MethodGet),
+			"Path":      Equal("/search"),
+			"Query":     Equal("limit=1&q=lion"),
+			"Status":    Equal(http.StatusOK),
+			"Bytes":     BeNumerically(">", 0),
+			"ClientIP":  Equal("127.0.0.1"),
+			"RequestID": Equal("req-1"),
+			"APIKey":    Equal("partner"),
+		}))
+		Expect(entries[1].Status).To(Equal(http.StatusBadRequest))
+		Expect(entries[1].RequestID).To(Equal(generated))
+		Expect(entries[1].APIKey).To(HavePrefix("sha256:"), "the key itself is never logged")
+		Expect(log.buf.String()).NotTo(ContainSubstring("s3cret"))
+	})
+
+	It("logs the truncated bodies of the sampled errors only", func() {
+		newServer(searchAPI.AccessLogPolicy{BodySampleRate: 1, MaxBodyBytes: 16})
+		send(http.MethodPut, "/admin/boosts", "", "", "not json at all, definitely not")
+		send(http.MethodPost, "/admin/import", "", "", ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"w.jpg"}},
+		}))
+
+		entries := log.entries()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Status).To(Equal(http.StatusBadRequest))
+		Expect(entries[0].RequestBody).To(Equal("not json at all,"))
+		Expect(entries[0].ResponseBody).To(HaveLen(16))
+		Expect(entries[1].Status).To(Equal(http.StatusOK))
+		Expect(entries[1].RequestBody).To(BeEmpty(), "never on 2xx")
+		Expect(entries[1].ResponseBody).To(BeEmpty(), "never on 2xx")
+	})
+
+	It("samples the bodies at the rate", func() {
+		newServer(searchAPI.AccessLogPolicy{BodySampleRate: 0.5, Seed: 7})
+		for range 200 {
+			send(http.MethodGet, "/nope", "", "", "")
+		}
+
+		sampled := 0
+		for _, e := range log.entries() {
+			if e.ResponseBody != "" {
+				sampled++
+			}
+		}
+		Expect(sampled).To(BeNumerically("~", 100, 30))
+	})
+
+	It("never logs the bodies without a sample rate", func() {
+		newServer(searchAPI.AccessLogPolicy{})
+		send(http.MethodGet, "/nope", "", "", "")
+		Expect(log.entries()[0].ResponseBody).To(BeEmpty())
+	})
+})
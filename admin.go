@@ -0,0 +1,114 @@
+package inkinspot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminPolicy controls the admin endpoints.
+// They are disabled unless a token is set.
+type AdminPolicy struct {
+	// Token is the bearer token the admin requests must carry.
+	Token string
+	// SettingsPath is the JSON file the runtime settings are persisted to.
+	// The settings are kept in memory only when it's empty.
+	SettingsPath string
+	// MaxStoreTimeout caps the store timeouts the admin searches override.
+	MaxStoreTimeout time.Duration
+}
+
+func (p AdminPolicy) withDefaults() AdminPolicy {
+	if p.MaxStoreTimeout <= 0 {
+		p.MaxStoreTimeout = 10 * time.Second
+	}
+
+	return p
+}
+
+// maxAdminBodyBytes caps the size of the admin request bodies.
+const maxAdminBodyBytes = 1 << 20
+
+// withAdminAuth rejects the requests without the admin bearer token.
+func withAdminAuth(p AdminPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized", "admin token required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerAdmin adds the admin endpoints to the mux when they are enabled.
+// The writes of the collections & their vectors are routed on the public routes of their reads.
+func registerAdmin(mux *http.ServeMux, se *SearchEngine, collection, vector *methodRoute) {
+	p := se.configuration.AdminPolicy
+	if p.Token == "" {
+		return
+	}
+
+	mux.Handle("/admin/boosts", withAdminAuth(p, methods(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, se.Settings())
+		case http.MethodPut:
+			var s Settings
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&s); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+				return
+			}
+
+			before := se.Settings().Boosts
+			if err := se.SetBoosts(s.Boosts); err != nil {
+				if errors.Is(err, ErrInvalidBoost) {
+					writeError(w, http.StatusBadRequest, "invalid_boost", err.Error())
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "internal_error", "saving the settings failed")
+				return
+			}
+			se.recordAudit(w, r, AuditBoosts, "", auditSummary(before), auditSummary(se.Settings().Boosts))
+
+			writeJSON(w, http.StatusOK, se.Settings())
+		}
+	}), http.MethodGet, http.MethodPut)))
+
+	mux.Handle("/admin/experiments", withAdminAuth(p, methods(handleExperiments(se), http.MethodGet, http.MethodPut)))
+	mux.Handle("/admin/experiments/metrics", withAdminAuth(p, methods(handleExperimentMetrics(se), http.MethodGet)))
+	mux.Handle("/admin/search", withAdminAuth(p, methods(handleSearch(se, true), http.MethodGet, http.MethodPost)))
+	mux.Handle("/admin/rank", withAdminAuth(p, methods(handleRank(se), http.MethodPost)))
+	mux.Handle("/admin/ranking/diff", withAdminAuth(p, methods(handleRankingDiff(se), http.MethodPost)))
+	mux.Handle("/admin/stats", withAdminAuth(p, methods(handleStats(se), http.MethodGet)))
+	mux.Handle("/admin/tattoos", withAdminAuth(p, methods(handleCatalog(se), http.MethodGet)))
+	mux.Handle("/admin/tattoos/{id}/vector", withAdminAuth(p, methods(handleVector(se, true), http.MethodGet)))
+	mux.Handle("/admin/tattoos/{id}/coverage", withAdminAuth(p, methods(handleCoverage(se), http.MethodGet)))
+	vector.handle(withAdminAuth(p, handleVectorPatch(se)), http.MethodPatch)
+	mux.Handle("/tattoos", methods(withAdminAuth(p, withIdempotency(se, withQuota(se, UsageIngest, handleCollectionCreate(se)))), http.MethodPost))
+	collection.handle(withAdminAuth(p, handleCollectionUpdate(se)), http.MethodPut)
+	collection.handle(withAdminAuth(p, handleCollectionDelete(se)), http.MethodDelete)
+	mux.Handle("/admin/export", withAdminAuth(p, methods(handleExport(se), http.MethodGet)))
+	mux.Handle("/admin/import", withAdminAuth(p, methods(withIdempotency(se, withQuota(se, UsageIngest, handleImport(se))), http.MethodPost)))
+	mux.Handle("/admin/chaos", withAdminAuth(p, methods(handleChaos(se), http.MethodGet)))
+	mux.Handle("/admin/load", withAdminAuth(p, methods(handleLoad(se), http.MethodGet)))
+	mux.Handle("/admin/store-errors", withAdminAuth(p, methods(handleStoreErrors(se), http.MethodGet)))
+	mux.Handle("/admin/zero-results", withAdminAuth(p, methods(handleZeroResults(se), http.MethodGet)))
+	mux.Handle("/admin/cache", withAdminAuth(p, methods(handleCachePurge(se), http.MethodDelete)))
+	mux.Handle("/admin/cache/stats", withAdminAuth(p, methods(handleCacheStats(se), http.MethodGet)))
+	mux.Handle("/admin/speculation", withAdminAuth(p, methods(handleSpeculation(se), http.MethodGet)))
+	mux.Handle("/admin/reindex", withAdminAuth(p, methods(handleReindex(se), http.MethodPost)))
+	mux.Handle("/admin/reindex/status", withAdminAuth(p, methods(handleReindexStatus(se), http.MethodGet)))
+	mux.Handle("/admin/jobs", withAdminAuth(p, methods(handleJobs(se), http.MethodGet)))
+	mux.Handle("/admin/usage", withAdminAuth(p, methods(handleUsage(se), http.MethodGet, http.MethodDelete)))
+	mux.Handle("/admin/jobs/{name}/run", withAdminAuth(p, methods(handleJobRun(se), http.MethodPost)))
+	mux.Handle("/admin/audit", withAdminAuth(p, methods(handleAudit(se), http.MethodGet)))
+	mux.Handle("/admin/consistency", withAdminAuth(p, methods(handleConsistency(se), http.MethodGet, http.MethodPost)))
+}
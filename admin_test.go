@@ -0,0 +1,158 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const adminToken = "s3cret"
+
+func doAdmin(se *httptest.Server, method, token string, body any) (int, []byte) {
+	GinkgoHelper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		Expect(err).NotTo(HaveOccurred())
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, se.URL+"/admin/boosts", r)
+	Expect(err).NotTo(HaveOccurred())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+
+	return resp.StatusCode, b
+}
+
+var _ = Describe("Label boosts admin", func() {
+	var (
+		se           *httptest.Server
+		settingsPath string
+	)
+
+	BeforeEach(func() {
+		settingsPath = filepath.Join(GinkgoT().TempDir(), "settings.json")
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken, SettingsPath: settingsPath}}
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+	})
+
+	It("rejects requests without the admin token", func() {
+		status, _ := doAdmin(se, http.MethodGet, "", nil)
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		status, _ = doAdmin(se, http.MethodPut, "wrong", searchAPI.Settings{Boosts: searchAPI.BoostTable{"neotrad": 2}})
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("returns the boosts it was updated with and persists them", func() {
+		boosts := searchAPI.BoostTable{"neotrad": 2, "fine line": 1.5}
+		status, _ := doAdmin(se, http.MethodPut, adminToken, searchAPI.Settings{Boosts: boosts})
+		Expect(status).To(Equal(http.StatusOK))
+
+		status, body := doAdmin(se, http.MethodGet, adminToken, nil)
+		Expect(status).To(Equal(http.StatusOK))
+		var got searchAPI.Settings
+		Expect(json.Unmarshal(body, &got)).To(Succeed())
+		Expect(got.Boosts).To(Equal(boosts))
+
+		b, err := os.ReadFile(settingsPath)
+		Expect(err).NotTo(HaveOccurred())
+		var saved searchAPI.Settings
+		Expect(json.Unmarshal(b, &saved)).To(Succeed())
+		Expect(saved.Boosts).To(Equal(boosts))
+	})
+
+	DescribeTable("invalid boosts are rejected",
+		func(boosts searchAPI.BoostTable) {
+			status, body := doAdmin(se, http.MethodPut, adminToken, searchAPI.Settings{Boosts: boosts})
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(string(body)).To(ContainSubstring("invalid_boost"))
+
+			_, err := os.Stat(settingsPath)
+			Expect(err).To(MatchError(os.ErrNotExist))
+		},
+		Entry("zero", searchAPI.BoostTable{"neotrad": 0}),
+		Entry("above the bound", searchAPI.BoostTable{"neotrad": 11}),
+		Entry("an empty label", searchAPI.BoostTable{"  ": 2}),
+		Entry("a label boosted twice", searchAPI.BoostTable{"Neotrad": 2, "neotrad": 3}),
+	)
+
+	It("ranks the boosted labels higher and explains it", func() {
+		res := doSearch(se, url.Values{"q": {"lion"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+
+		status, _ := doAdmin(se, http.MethodPut, adminToken, searchAPI.Settings{Boosts: searchAPI.BoostTable{"neotrad": 2}})
+		Expect(status).To(Equal(http.StatusOK))
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "explain": {"true"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"Y", "X"}))
+		Expect(res.JSON.Explain.Hits[0].Boost).To(Equal(2.0))
+		Expect(res.JSON.Explain.Hits[1].Boost).To(BeZero())
+	})
+
+	It("serves consistent searches during an update", func() {
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for range 20 {
+					res := doSearch(se, url.Values{"q": {"lion"}})
+					Expect(res.Status).To(Equal(http.StatusOK))
+					Expect(collectionIDs(res.JSON.ImageCollections)).To(Or(
+						Equal([]string{"X", "Y"}),
+						Equal([]string{"Y", "X"}),
+					))
+				}
+			}()
+		}
+
+		for _, boost := range []float64{2, 3, 0.5} {
+			status, _ := doAdmin(se, http.MethodPut, adminToken, searchAPI.Settings{Boosts: searchAPI.BoostTable{"neotrad": boost}})
+			Expect(status).To(Equal(http.StatusOK))
+		}
+		wg.Wait()
+	})
+})
+
+var _ = Describe("Label boosts with caching", func() {
+	It("doesn't serve results cached under other boosts", func() {
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute},
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"q": {"lion"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+
+		status, _ := doAdmin(se, http.MethodPut, adminToken, searchAPI.Settings{Boosts: searchAPI.BoostTable{"neotrad": 2}})
+		Expect(status).To(Equal(http.StatusOK))
+
+		res = doSearch(se, url.Values{"q": {"lion"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"Y", "X"}))
+	})
+})
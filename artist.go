@@ -0,0 +1,283 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Artist made the tattoos of the collections carrying their ID.
+// Handle is the unique name the users know them by.
+type Artist struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+}
+
+// ArtistStore resolves the artists of the collections.
+// GetArtistsByID skips the unknown IDs, GetArtistByHandle returns ErrArtistNotFound for an unknown handle.
+type ArtistStore interface {
+	GetArtistsByID(ctx context.Context, ids []string) ([]Artist, error)
+	GetArtistByHandle(ctx context.Context, handle string) (Artist, error)
+}
+
+// ArtistIndex is implemented by the image stores.
+// Which can list the IDs of the collections of an artist, ordered by ID.
+type ArtistIndex interface {
+	CollectionIDsByArtist(ctx context.Context, artistID string) ([]string, error)
+}
+
+// MemoryArtistStore keeps the artists in memory.
+// The handles are matched case-insensitively, with or without a leading @.
+type MemoryArtistStore struct {
+	mu       sync.RWMutex
+	byID     map[string]Artist
+	byHandle map[string]string
+}
+
+// NewMemoryArtistStore creates an empty in-memory artist store.
+func NewMemoryArtistStore() *MemoryArtistStore {
+	return &MemoryArtistStore{byID: make(map[string]Artist), byHandle: make(map[string]string)}
+}
+
+func normalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(handle, "@"))
+}
+
+// AddArtist stores the artist, replacing any with the same ID.
+func (s *MemoryArtistStore) AddArtist(ctx context.Context, a Artist) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.byID[a.ID]; ok {
+		delete(s.byHandle, normalizeHandle(old.Handle))
+	}
+	s.byID[a.ID] = a
+	s.byHandle[normalizeHandle(a.Handle)] = a.ID
+
+	return nil
+}
+
+// GetArtistsByID returns the known artists in the order of the IDs.
+// Unknown IDs are skipped, repeated IDs are returned once.
+func (s *MemoryArtistStore) GetArtistsByID(ctx context.Context, ids []string) ([]Artist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Artist, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if a, ok := s.byID[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, a)
+		}
+	}
+
+	return out, nil
+}
+
+// GetArtistByHandle returns the artist of the handle.
+func (s *MemoryArtistStore) GetArtistByHandle(ctx context.Context, handle string) (Artist, error) {
+	if err := ctx.Err(); err != nil {
+		return Artist{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byHandle[normalizeHandle(handle)]
+	if !ok {
+		return Artist{}, fmt.Errorf("%w: %s", ErrArtistNotFound, handle)
+	}
+
+	return s.byID[id], nil
+}
+
+// WithArtistStore sets the store of the artists, the responses name the artists of their collections.
+// Without one the collections only carry the artist IDs and searches can't filter by artist.
+func WithArtistStore(s ArtistStore) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.artists = s
+	}
+}
+
+// artistCollectionIDs returns the IDs of the collections of the artist, ordered by ID.
+func (e *SearchEngine) artistCollectionIDs(ctx context.Context, artistID string) ([]string, error) {
+	index, ok := storeAs[ArtistIndex](e.imageStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: image store can't list the collections of an artist", ErrArtistsUnsupported)
+	}
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	ids, err := index.CollectionIDsByArtist(isCtx, artistID)
+	if err != nil {
+		return nil, e.storeError(ImageStoreName, "artist", err)
+	}
+
+	return ids, nil
+}
+
+// filterArtist keeps the matches of the collections of the artist with the handle.
+func (e *SearchEngine) filterArtist(ctx context.Context, ranked []RankedVector, handle string) ([]RankedVector, error) {
+	if e.artists == nil {
+		return nil, fmt.Errorf("%w: no artist store", ErrArtistsUnsupported)
+	}
+	artist, err := e.artists.GetArtistByHandle(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := e.artistCollectionIDs(ctx, artist.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]RankedVector, 0, min(len(ranked), len(ids)))
+	for _, rv := range ranked {
+		if _, ok := slices.BinarySearch(ids, rv.ID); ok {
+			out = append(out, rv)
+		}
+	}
+
+	return out, nil
+}
+
+// Artists returns the artists of the collections by ID, in a single lookup.
+// It's best effort, nil without an artist store or when it fails.
+func (e *SearchEngine) Artists(ctx context.Context, cols []TattooImagesCollection) map[string]Artist {
+	if e.artists == nil {
+		return nil
+	}
+
+	var ids []string
+	for _, c := range cols {
+		if c.ArtistID != "" && !slices.Contains(ids, c.ArtistID) {
+			ids = append(ids, c.ArtistID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	artists, err := e.artists.GetArtistsByID(ctx, ids)
+	if err != nil {
+		slog.WarnContext(ctx, "resolving the artists failed", "error", err)
+		return nil
+	}
+	if len(artists) == 0 {
+		return nil
+	}
+
+	out := make(map[string]Artist, len(artists))
+	for _, a := range artists {
+		out[a.ID] = a
+	}
+
+	return out
+}
+
+// ArtistCollections returns a page of the visible collections of the artist, ordered by ID.
+// The page is counted by the IDs of the collections, hidden ones may leave it short.
+// It returns ErrArtistNotFound when the artist store doesn't know the artist.
+func (e *SearchEngine) ArtistCollections(ctx context.Context, artistID string, limit int, cursor string) (Response, error) {
+	if e.artists != nil {
+		known, err := e.artists.GetArtistsByID(ctx, []string{artistID})
+		if err != nil {
+			return Response{}, err
+		}
+		if len(known) == 0 {
+			return Response{}, fmt.Errorf("%w: %s", ErrArtistNotFound, artistID)
+		}
+	}
+
+	_, limit, err := e.configuration.PagePolicy.page(0, limit)
+	if err != nil {
+		return Response{}, err
+	}
+	fingerprint := searchFingerprint("artist|" + artistID)
+
+	ids, err := e.artistCollectionIDs(ctx, artistID)
+	if err != nil {
+		return Response{}, err
+	}
+	start := 0
+	if cursor != "" {
+		c, err := decodeCursor(e.configuration.CursorPolicy.Secret, cursor, fingerprint)
+		if err != nil {
+			return Response{}, err
+		}
+		start, _ = slices.BinarySearch(ids, c.ID)
+		if start < len(ids) && ids[start] == c.ID {
+			start++
+		}
+	}
+	page := ids[start:min(start+limit, len(ids))]
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	cols, err := foundOnly(e.getCollections(isCtx, page))
+	if err != nil {
+		return Response{}, e.storeError(ImageStoreName, "get", err)
+	}
+	now := e.clock.Now()
+	visible := make([]TattooImagesCollection, 0, len(cols))
+	for _, c := range cols {
+		if !c.Hidden && !c.expired(now) {
+			visible = append(visible, c)
+		}
+	}
+
+	resp := Response{
+		ImageCollections: visible,
+		Total:            len(ids),
+		HasMore:          start+len(page) < len(ids),
+		Artists:          e.Artists(ctx, visible),
+	}
+	if resp.HasMore && len(page) > 0 {
+		resp.NextCursor = encodeCursor(e.configuration.CursorPolicy.Secret, searchCursor{Search: fingerprint, ID: page[len(page)-1]})
+	}
+
+	return resp, nil
+}
+
+// handleArtistCollections serves a page of the collections of the artist of the ID in the path.
+func handleArtistCollections(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, limit, err := parsePage("", r.URL.Query().Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+			return
+		}
+
+		resp, err := se.ArtistCollections(r.Context(), r.PathValue("id"), limit, r.URL.Query().Get("cursor"))
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, resp)
+		case errors.Is(err, ErrArtistNotFound):
+			writeError(w, http.StatusNotFound, "artist_not_found", err.Error())
+		case errors.Is(err, ErrInvalidPage):
+			writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+		case errors.Is(err, ErrInvalidCursor):
+			writeError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+		case errors.Is(err, ErrArtistsUnsupported):
+			writeError(w, http.StatusNotImplemented, "artists_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "listing the collections of the artist failed")
+		}
+	})
+}
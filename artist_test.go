@@ -0,0 +1,137 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// countingArtistStore counts the lookups of the artists by ID.
+type countingArtistStore struct {
+	*searchAPI.MemoryArtistStore
+	lookups atomic.Int64
+}
+
+func (s *countingArtistStore) GetArtistsByID(ctx context.Context, ids []string) ([]searchAPI.Artist, error) {
+	s.lookups.Add(1)
+	return s.MemoryArtistStore.GetArtistsByID(ctx, ids)
+}
+
+// getArtistCollections requests a page of the collections of the artist.
+func getArtistCollections(se *httptest.Server, id string, params url.Values) HTTPResult {
+	GinkgoHelper()
+	resp, err := se.Client().Get(se.URL + "/artists/" + id + "/tattoos?" + params.Encode())
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	res := HTTPResult{Status: resp.StatusCode}
+	Expect(json.NewDecoder(resp.Body).Decode(&res.JSON)).To(Succeed())
+	return res
+}
+
+var _ = Describe("Artists", func() {
+	var (
+		is      *searchAPI.MemoryImageStore
+		vs      *searchAPI.MemoryVectorStore
+		artists *countingArtistStore
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		artists = &countingArtistStore{MemoryArtistStore: searchAPI.NewMemoryArtistStore()}
+		Expect(artists.AddArtist(context.Background(), searchAPI.Artist{ID: "a1", Name: "Ada Lee", Handle: "ada"})).To(Succeed())
+		Expect(artists.AddArtist(context.Background(), searchAPI.Artist{ID: "a2", Name: "Bo Park", Handle: "bo"})).To(Succeed())
+
+		// L0 to L5 are lions, the even ones by Ada & the odd ones by Bo.
+		for i := range 6 {
+			id := fmt.Sprintf("L%d", i)
+			artist := "a2"
+			if i%2 == 0 {
+				artist = "a1"
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}, ArtistID: artist})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": float64(100 - i)}})).To(Succeed())
+		}
+	})
+
+	newServer := func(opts ...searchAPI.SearchEngineOption) *httptest.Server {
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs, opts...)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("filters the search results by the artist's handle", func() {
+		se := newServer(searchAPI.WithArtistStore(artists))
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "artist": {"@Ada"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L0", "L2", "L4"}))
+		Expect(res.JSON.Total).To(Equal(3))
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "artist": {"bo"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L1", "L3"}))
+		Expect(res.JSON.HasMore).To(BeTrue())
+	})
+
+	It("names the artists of a response in a single lookup", func() {
+		se := newServer(searchAPI.WithArtistStore(artists))
+
+		res := doSearch(se, url.Values{"q": {"lion"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.ImageCollections).To(HaveLen(6))
+		Expect(res.JSON.Artists).To(Equal(map[string]searchAPI.Artist{
+			"a1": {ID: "a1", Name: "Ada Lee", Handle: "ada"},
+			"a2": {ID: "a2", Name: "Bo Park", Handle: "bo"},
+		}))
+		Expect(artists.lookups.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("answers 404 Not Found for an unknown artist", func() {
+		se := newServer(searchAPI.WithArtistStore(artists))
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "artist": {"nobody"}})
+		Expect(res.Status).To(Equal(http.StatusNotFound))
+		Expect(res.JSON.Error.Code).To(Equal("artist_not_found"))
+
+		res = getArtistCollections(se, "a9", nil)
+		Expect(res.Status).To(Equal(http.StatusNotFound))
+		Expect(res.JSON.Error.Code).To(Equal("artist_not_found"))
+	})
+
+	It("answers 501 Not Implemented to an artist filter without an artist store", func() {
+		se := newServer()
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "artist": {"ada"}})
+		Expect(res.Status).To(Equal(http.StatusNotImplemented))
+		Expect(res.JSON.Error.Code).To(Equal("artists_unsupported"))
+		Expect(doSearch(se, url.Values{"q": {"lion"}}).JSON.Artists).To(BeEmpty())
+	})
+
+	It("lists the collections of an artist by page", func() {
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L6", ArtistID: "a1", Hidden: true})).To(Succeed())
+		se := newServer(searchAPI.WithArtistStore(artists))
+
+		res := getArtistCollections(se, "a1", url.Values{"limit": {"2"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L0", "L2"}))
+		Expect(res.JSON.Artists).To(HaveKey("a1"))
+		Expect(res.JSON.NextCursor).NotTo(BeEmpty())
+
+		res = getArtistCollections(se, "a1", url.Values{"limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L4"}))
+		Expect(res.JSON.HasMore).To(BeFalse())
+
+		res = getArtistCollections(se, "a2", url.Values{"cursor": {"forged"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,227 @@
+package inkinspot
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audit actions, the mutations recorded in the audit log.
+const (
+	AuditImport           = "import"
+	AuditPatch            = "vector.patch"
+	AuditCollectionCreate = "collection.create"
+	AuditCollectionUpdate = "collection.update"
+	AuditCollectionDelete = "collection.delete"
+	AuditBoosts           = "boosts.set"
+	AuditExperiments      = "experiments.set"
+	AuditCachePurge       = "cache.purge"
+	AuditReindex          = "reindex"
+	AuditJobRun           = "job.run"
+	AuditUsageReset       = "usage.reset"
+	AuditConsistency      = "consistency.delete_orphans"
+	AuditWebhook          = "webhook.ingest"
+)
+
+// AuditEntry records who made a mutation, of what & when.
+// Before & After summarize the state the mutation changed, when it's worth it.
+type AuditEntry struct {
+	// Seq orders the entries of a log, it's set by the log.
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	// Namespace is the namespace of the API key of the actor, see Principal.
+	Namespace string `json:"namespace,omitempty"`
+	Action    string `json:"action"`
+	Target    string `json:"target,omitempty"`
+	RequestID string `json:"request_id"`
+	Before    string `json:"before,omitempty"`
+	After     string `json:"after,omitempty"`
+}
+
+// AuditLogger records the mutations of the engine.
+type AuditLogger interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+// AuditQuery selects the entries of an audit log, the latest Limit of the action when it's set.
+type AuditQuery struct {
+	Action string
+	Limit  int
+}
+
+// AuditReader is implemented by the audit loggers.
+// Which can list their entries, the latest first.
+type AuditReader interface {
+	AuditEntries(ctx context.Context, q AuditQuery) ([]AuditEntry, error)
+}
+
+// AuditPolicy controls the audit log of the engine.
+// Zero values are replaced by the defaults.
+type AuditPolicy struct {
+	// Size is the number of entries the in-memory log keeps, the oldest are dropped.
+	Size int
+}
+
+func (p AuditPolicy) withDefaults() AuditPolicy {
+	if p.Size <= 0 {
+		p.Size = 1000
+	}
+
+	return p
+}
+
+// AuditLog is a page of the audit log & the entries which couldn't be recorded.
+type AuditLog struct {
+	Entries  []AuditEntry `json:"entries"`
+	Failures int64        `json:"failures"`
+}
+
+// MemoryAuditLog keeps the latest entries in memory, in a ring buffer.
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	next    int
+	seq     uint64
+}
+
+// NewMemoryAuditLog creates an empty in-memory audit log of the size.
+func NewMemoryAuditLog(size int) *MemoryAuditLog {
+	return &MemoryAuditLog{entries: make([]AuditEntry, 0, max(size, 1))}
+}
+
+// Record appends the entry, dropping the oldest when the log is full.
+func (l *MemoryAuditLog) Record(ctx context.Context, entry AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	entry.Seq = l.seq
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+		return nil
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+
+	return nil
+}
+
+// AuditEntries returns the latest entries of the query, the latest first.
+func (l *MemoryAuditLog) AuditEntries(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]AuditEntry, 0, min(max(q.Limit, 0), len(l.entries)))
+	for i := range len(l.entries) {
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		// the newest entry is just before next.
+		entry := l.entries[(l.next-1-i+2*len(l.entries))%len(l.entries)]
+		if q.Action == "" || entry.Action == q.Action {
+			out = append(out, entry)
+		}
+	}
+
+	return out, nil
+}
+
+// WithAuditLogger sets the audit log of the mutations, in memory by default.
+func WithAuditLogger(l AuditLogger) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.audit = l
+	}
+}
+
+// recordAudit records the mutation of the request.
+// The actor is the API key of the principal of the request, by its name, else its webhook partner, "admin" without either.
+// An audit failure doesn't fail the request, it's logged & counted.
+func (e *SearchEngine) recordAudit(w http.ResponseWriter, r *http.Request, action, target, before, after string) {
+	principal, _ := PrincipalFromContext(r.Context())
+	actor := cmp.Or(principal.APIKeyName, principal.Partner, "admin")
+	id := requestID(w, r)
+
+	entry := AuditEntry{
+		Time:      e.clock.Now(),
+		Actor:     actor,
+		Namespace: principal.Namespace,
+		Action:    action,
+		Target:    target,
+		RequestID: id,
+		Before:    before,
+		After:     after,
+	}
+	// the mutation is done, the client leaving doesn't take its record with it.
+	if err := e.audit.Record(context.WithoutCancel(r.Context()), entry); err != nil {
+		e.auditFailures.Add(1)
+		slog.ErrorContext(r.Context(), "recording the audit entry failed", "action", action, "target", target, "request_id", id, "error", err)
+	}
+}
+
+// AuditLog returns the latest entries of the audit log of the query.
+// It returns ErrAuditUnsupported when the audit logger can't list them.
+func (e *SearchEngine) AuditLog(ctx context.Context, q AuditQuery) (AuditLog, error) {
+	reader, ok := e.audit.(AuditReader)
+	if !ok {
+		return AuditLog{}, ErrAuditUnsupported
+	}
+	if q.Limit <= 0 || q.Limit > e.configuration.AuditPolicy.Size {
+		q.Limit = e.configuration.AuditPolicy.Size
+	}
+
+	entries, err := reader.AuditEntries(ctx, q)
+	if err != nil {
+		return AuditLog{}, err
+	}
+
+	return AuditLog{Entries: entries, Failures: e.auditFailures.Load()}, nil
+}
+
+// auditSummary encodes the state for the audit log, compactly.
+func auditSummary(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// handleAudit lists the latest entries of the audit log, of the action when it's given.
+func handleAudit(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := AuditQuery{Action: r.URL.Query().Get("action")}
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			var err error
+			if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 1 {
+				writeError(w, http.StatusBadRequest, "invalid_page", "limit must be a positive integer")
+				return
+			}
+		}
+
+		log, err := se.AuditLog(r.Context(), q)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, log)
+		case errors.Is(err, ErrAuditUnsupported):
+			writeError(w, http.StatusNotImplemented, "audit_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "listing the audit log failed")
+		}
+	})
+}
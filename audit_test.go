@@ -0,0 +1,139 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+// failingAuditLog lists its entries but fails to record any.
+type failingAuditLog struct {
+	*searchAPI.MemoryAuditLog
+}
+
+func (failingAuditLog) Record(context.Context, searchAPI.AuditEntry) error {
+	return errors.New("audit disk full")
+}
+
+var _ = Describe("Audit log", func() {
+	newServer := func(opts ...searchAPI.SearchEngineOption) *httptest.Server {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"lion": 90}})).To(Succeed())
+
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			QuotaPolicy: searchAPI.QuotaPolicy{Keys: map[string]searchAPI.Quota{"k-ops": {Name: "ops"}}},
+		}
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, append(opts, searchAPI.WithClock(clock))...)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	// call makes an admin request as the ops key, with the request ID.
+	call := func(se *httptest.Server, method, path, requestID, body string, out any) int {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set(searchAPI.APIKeyHeader, "k-ops")
+		if requestID != "" {
+			req.Header.Set(searchAPI.RequestIDHeader, requestID)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		if out != nil {
+			Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+		}
+		return resp.StatusCode
+	}
+
+	It("records the mutations, the latest first", func() {
+		se := newServer()
+
+		Expect(call(se, http.MethodPut, "/admin/boosts", "r1", `{"boosts":{"lion":2}}`, nil)).To(Equal(http.StatusOK))
+		record := ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "T", URLs: []string{"t.jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: "T", Subject: searchAPI.LabelSet{"tiger": 80}},
+		})
+		Expect(call(se, http.MethodPost, "/admin/import", "r2", record, nil)).To(Equal(http.StatusOK))
+		Expect(call(se, http.MethodPost, "/admin/import?dry_run=true", "r3", record, nil)).To(Equal(http.StatusOK))
+		Expect(call(se, http.MethodPatch, "/tattoos/L/vector", "r4", `{"subject":{"cub":50}}`, nil)).To(Equal(http.StatusOK))
+		Expect(call(se, http.MethodPatch, "/tattoos/nope/vector", "r5", `{"subject":{"cub":50}}`, nil)).To(Equal(http.StatusNotFound))
+		Expect(call(se, http.MethodDelete, "/admin/cache?query=lion", "r6", "", nil)).To(Equal(http.StatusOK))
+
+		var log searchAPI.AuditLog
+		Expect(call(se, http.MethodGet, "/admin/audit", "", "", &log)).To(Equal(http.StatusOK))
+		Expect(log.Failures).To(BeZero())
+		Expect(log.Entries).To(HaveLen(4), "the dry run & the failed patch mutate nothing")
+
+		actions := make([]string, 0, len(log.Entries))
+		for _, e := range log.Entries {
+			Expect(e.Actor).To(Equal("ops"))
+			Expect(e.Time).To(Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+			actions = append(actions, e.Action+"/"+e.RequestID)
+		}
+		Expect(actions).To(Equal([]string{"cache.purge/r6", "vector.patch/r4", "import/r2", "boosts.set/r1"}))
+		Expect(log.Entries[0].Seq).To(BeNumerically(">", log.Entries[1].Seq))
+
+		Expect(log.Entries[0]).To(MatchFields(IgnoreExtras, Fields{"Target": Equal("lion"), "After": Equal("purged 0")}))
+		Expect(log.Entries[1]).To(MatchFields(IgnoreExtras, Fields{"Target": Equal("L"), "Before": Equal("version 1"), "After": Equal("version 2")}))
+		Expect(log.Entries[2].After).To(Equal("imported 1, skipped 0, failed 0"))
+		Expect(log.Entries[3]).To(MatchFields(IgnoreExtras, Fields{"Before": Equal("{}"), "After": Equal(`{"lion":2}`)}))
+	})
+
+	It("filters the entries by action & limits them", func() {
+		se := newServer()
+		for _, id := range []string{"r1", "r2", "r3"} {
+			Expect(call(se, http.MethodDelete, "/admin/cache", id, "", nil)).To(Equal(http.StatusOK))
+		}
+		Expect(call(se, http.MethodPut, "/admin/boosts", "r4", `{"boosts":{}}`, nil)).To(Equal(http.StatusOK))
+
+		var log searchAPI.AuditLog
+		Expect(call(se, http.MethodGet, "/admin/audit?action=cache.purge&limit=2", "", "", &log)).To(Equal(http.StatusOK))
+		Expect(log.Entries).To(HaveLen(2))
+		Expect(log.Entries[0].RequestID).To(Equal("r3"))
+		Expect(log.Entries[1].RequestID).To(Equal("r2"))
+
+		Expect(call(se, http.MethodGet, "/admin/audit?limit=0", "", "", nil)).To(Equal(http.StatusBadRequest))
+	})
+
+	It("keeps the latest entries of a full log", func() {
+		log := searchAPI.NewMemoryAuditLog(2)
+		for _, target := range []string{"a", "b", "c"} {
+			Expect(log.Record(context.Background(), searchAPI.AuditEntry{Action: searchAPI.AuditJobRun, Target: target})).To(Succeed())
+		}
+
+		entries, err := log.AuditEntries(context.Background(), searchAPI.AuditQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0]).To(MatchFields(IgnoreExtras, Fields{"Seq": BeEquivalentTo(3), "Target": Equal("c")}))
+		Expect(entries[1]).To(MatchFields(IgnoreExtras, Fields{"Seq": BeEquivalentTo(2), "Target": Equal("b")}))
+	})
+
+	It("doesn't fail the mutation when the audit fails but counts it", func() {
+		se := newServer(searchAPI.WithAuditLogger(failingAuditLog{searchAPI.NewMemoryAuditLog(10)}))
+
+		Expect(call(se, http.MethodDelete, "/admin/cache", "r1", "", nil)).To(Equal(http.StatusOK))
+
+		var log searchAPI.AuditLog
+		Expect(call(se, http.MethodGet, "/admin/audit", "", "", &log)).To(Equal(http.StatusOK))
+		Expect(log.Entries).To(BeEmpty())
+		Expect(log.Failures).To(BeEquivalentTo(1))
+	})
+})
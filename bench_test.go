@@ -0,0 +1,176 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+)
+
+// benchCatalog seeds in-memory stores with n collections of cycling labels.
+func benchCatalog(b *testing.B, n int) (*searchAPI.MemoryImageStore, *searchAPI.MemoryVectorStore) {
+	b.Helper()
+	styles := []string{"realistic", "neotrad", "blackwork", "watercolor", "traditional"}
+	subjects := []string{"lion", "tiger", "rose", "skull", "snake", "eagle", "wolf"}
+	areas := []string{"chest", "arm", "back", "leg"}
+
+	is := searchAPI.NewMemoryImageStore()
+	vs := searchAPI.NewMemoryVectorStore()
+	for i := range n {
+		id := fmt.Sprintf("t%04d", i)
+		c := searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}}
+		v := searchAPI.TattooImagesVector{
+			ID:      id,
+			Style:   searchAPI.LabelSet{styles[i%len(styles)]: float64(i%50 + 50)},
+			Subject: searchAPI.LabelSet{subjects[i%len(subjects)]: float64(i%70 + 30)},
+			Area:    searchAPI.LabelSet{areas[i%len(areas)]: float64(i%30 + 70)},
+		}
+		if err := is.AddCollection(context.Background(), c); err != nil {
+			b.Fatal(err)
+		}
+		if err := vs.AddVector(context.Background(), v); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return is, vs
+}
+
+// The benchmarks search a catalog of 1000 collections. On a laptop class CPU,
+// pooling & the ASCII fast path of the normalizer took them from
+//
+//	BenchmarkSearchEngine   11.9 ms/op  14955542 B/op  25612 allocs/op
+//	BenchmarkSearchHandler  13.4 ms/op  14966054 B/op  25920 allocs/op
+//
+// to
+//
+//	BenchmarkSearchEngine    1.5 ms/op    423258 B/op   2180 allocs/op
+//	BenchmarkSearchHandler   2.0 ms/op    431718 B/op   2485 allocs/op
+func BenchmarkSearchEngine(b *testing.B) {
+	is, vs := benchCatalog(b, 1000)
+	eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+	queries := []string{"Realistic lion on the chest"}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := eng.MultiSearch(ctx, queries, searchAPI.SearchOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchHandler(b *testing.B) {
+	is, vs := benchCatalog(b, 1000)
+	handler := searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs))
+	req := httptest.NewRequest(http.MethodGet, "/search?q=Realistic+lion+on+the+chest&limit=20", nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+// BenchmarkSearchHandlerCached serves a hot query from the response cache, it skips the encoding.
+// Caching the results alone takes 87 µs/op & 346 allocs/op, the responses 16 µs/op & 81 allocs/op.
+func BenchmarkSearchHandlerCached(b *testing.B) {
+	is, vs := benchCatalog(b, 1000)
+	cfg := searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Hour, CacheBodies: true}}
+	handler := searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs))
+	req := httptest.NewRequest(http.MethodGet, "/search?q=Realistic+lion+on+the+chest&limit=20", nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+// BenchmarkVectorStoreQuery compares the inverted index of the vector store with
+// a scan of the pre-analyzed labels of every vector, as the store matched before.
+// The index answers in 37 µs at 10k vectors & 0.45 ms at 100k, the scan in 1 ms & 11 ms.
+func BenchmarkVectorStoreQuery(b *testing.B) {
+	analyzer := searchAPI.DefaultConfiguration().LabelAnalyzer()
+	ctx := context.Background()
+	const query = "black and white lion on the upper arm"
+	// the catalog's labels are mostly other than the query's.
+	words := slices.Clone(labelWords)
+	for i := range 2000 {
+		words = append(words, fmt.Sprintf("motif%04d", i))
+	}
+
+	for _, n := range []int{10_000, 100_000} {
+		r := rand.New(rand.NewPCG(1, 2))
+		vs := searchAPI.NewMemoryVectorStore()
+		type scanned struct {
+			id     string
+			phrase [][]string
+			prox   []float64
+		}
+		var entries []scanned
+		for i := range n {
+			v := randomVector(r, fmt.Sprintf("v%06d", i), words)
+			if err := vs.AddVector(ctx, v); err != nil {
+				b.Fatal(err)
+			}
+			e := scanned{id: v.ID}
+			for _, ls := range []searchAPI.LabelSet{v.Style, v.Subject, v.Area} {
+				for label, proximity := range ls {
+					e.phrase = append(e.phrase, analyzer.Analyze(label))
+					e.prox = append(e.prox, proximity)
+				}
+			}
+			entries = append(entries, e)
+		}
+
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				stems := analyzer.Analyze(query)
+				scores := make(map[string]float64)
+				for _, e := range entries {
+					for i, phrase := range e.phrase {
+						for j := 0; len(phrase) > 0 && j+len(phrase) <= len(stems); j++ {
+							if slices.Equal(stems[j:j+len(phrase)], phrase) {
+								scores[e.id] += e.prox[i]
+								break
+							}
+						}
+					}
+				}
+				ids := make([]string, 0, len(scores))
+				for id := range scores {
+					ids = append(ids, id)
+				}
+				sort.Slice(ids, func(i, j int) bool {
+					if scores[ids[i]] != scores[ids[j]] {
+						return scores[ids[i]] > scores[ids[j]]
+					}
+					return ids[i] < ids[j]
+				})
+			}
+		})
+		b.Run(fmt.Sprintf("index/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := vs.GetIDsByQuery(ctx, query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
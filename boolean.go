@@ -0,0 +1,320 @@
+package inkinspot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuerySyntaxError reports a malformed boolean query.
+// Pos is the byte offset in the normalized query text.
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s at position %d", ErrMalformedQuery, e.Msg, e.Pos)
+}
+
+func (e *QuerySyntaxError) Is(target error) bool {
+	return target == ErrMalformedQuery
+}
+
+// isBooleanQuery reports whether the raw query uses the boolean syntax.
+// An upper case AND, OR or NOT, a parenthesis or a term negated with "-".
+// Within a boolean query the operators are matched case insensitively.
+func isBooleanQuery(raw string) bool {
+	if strings.ContainsAny(raw, "()") {
+		return true
+	}
+
+	for _, f := range strings.Fields(raw) {
+		switch {
+		case f == "AND", f == "OR", f == "NOT":
+			return true
+		case len(f) > 1 && f[0] == '-':
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryExpr is a node of a boolean query expression.
+type queryExpr interface {
+	// eval reports whether a candidate satisfies the expression.
+	// matched reports whether the candidate has a label matching the stems.
+	eval(matched func(stems []string) bool) bool
+	// replaceStem swaps a stem corrected by fuzzy matching.
+	replaceStem(old, new string)
+	String() string
+}
+
+// groupExpr is a run of plain words & phrases, matched like a plain query.
+type groupExpr struct {
+	stems []string
+}
+
+func (g *groupExpr) eval(matched func([]string) bool) bool {
+	return matched(g.stems)
+}
+
+func (g *groupExpr) replaceStem(old, new string) {
+	for i, s := range g.stems {
+		if s == old {
+			g.stems[i] = new
+		}
+	}
+}
+
+func (g *groupExpr) String() string {
+	return fmt.Sprintf("%q", strings.Join(g.stems, " "))
+}
+
+type andExpr []queryExpr
+
+func (a andExpr) eval(matched func([]string) bool) bool {
+	for _, e := range a {
+		if !e.eval(matched) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a andExpr) replaceStem(old, new string) {
+	for _, e := range a {
+		e.replaceStem(old, new)
+	}
+}
+
+func (a andExpr) String() string {
+	return joinExprs(a, " AND ")
+}
+
+type orExpr []queryExpr
+
+func (o orExpr) eval(matched func([]string) bool) bool {
+	for _, e := range o {
+		if e.eval(matched) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o orExpr) replaceStem(old, new string) {
+	for _, e := range o {
+		e.replaceStem(old, new)
+	}
+}
+
+func (o orExpr) String() string {
+	return joinExprs(o, " OR ")
+}
+
+type notExpr struct {
+	expr queryExpr
+}
+
+func (n notExpr) eval(matched func([]string) bool) bool {
+	return !n.expr.eval(matched)
+}
+
+func (n notExpr) replaceStem(old, new string) {
+	n.expr.replaceStem(old, new)
+}
+
+func (n notExpr) String() string {
+	return "NOT " + n.expr.String()
+}
+
+func joinExprs(exprs []queryExpr, op string) string {
+	parts := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		parts = append(parts, e.String())
+	}
+
+	return "(" + strings.Join(parts, op) + ")"
+}
+
+// booleanParser is a recursive descent parser of boolean queries.
+// Precedence from the loosest: OR, AND (also implied between operands), NOT.
+type booleanParser struct {
+	pq       *ParsedQuery
+	tokens   []queryToken
+	pos      int
+	end      int
+	analyzer Analyzer
+	synonyms map[string]string
+	negated  bool
+}
+
+// parseBooleanQuery parses a normalized boolean query.
+// The stems of the negated groups are left out of the scored stems.
+func parseBooleanQuery(text string, a Analyzer, synonyms map[string]string) (ParsedQuery, error) {
+	pq := ParsedQuery{Text: text, Lang: a.language().Tag}
+	p := &booleanParser{pq: &pq, tokens: splitNegations(tokenizeQuery(text)), end: len(text), analyzer: a, synonyms: synonyms}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return ParsedQuery{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return ParsedQuery{}, &QuerySyntaxError{Pos: p.tokens[p.pos].start, Msg: "unexpected " + p.tokens[p.pos].text}
+	}
+
+	pq.expr = expr
+	pq.Expr = expr.String()
+
+	return pq, nil
+}
+
+// splitNegations splits the "-" prefix of the words into a NOT operator.
+func splitNegations(tokens []queryToken) []queryToken {
+	out := make([]queryToken, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.kind == tokenWord && len(tok.text) > 1 && tok.text[0] == '-' {
+			out = append(out,
+				queryToken{kind: tokenWord, text: "not", start: tok.start, end: tok.start + 1},
+				queryToken{kind: tokenWord, text: tok.text[1:], start: tok.start + 1, end: tok.end})
+			continue
+		}
+		out = append(out, tok)
+	}
+
+	return out
+}
+
+func (p *booleanParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *booleanParser) position() int {
+	if tok, ok := p.peek(); ok {
+		return tok.start
+	}
+
+	return p.end
+}
+
+func isOperator(tok queryToken, op string) bool {
+	return tok.kind == tokenWord && tok.text == op
+}
+
+func (p *booleanParser) parseOr() (queryExpr, error) {
+	var exprs orExpr
+	for {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+
+		tok, ok := p.peek()
+		if !ok || !isOperator(tok, "or") {
+			break
+		}
+		p.pos++
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+
+	return exprs, nil
+}
+
+func (p *booleanParser) parseAnd() (queryExpr, error) {
+	var exprs andExpr
+	for {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokenClose || isOperator(tok, "or") {
+			break
+		}
+		if isOperator(tok, "and") {
+			p.pos++
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+
+	return exprs, nil
+}
+
+func (p *booleanParser) parseUnary() (queryExpr, error) {
+	tok, ok := p.peek()
+	if ok && isOperator(tok, "not") {
+		p.pos++
+		p.negated = !p.negated
+		e, err := p.parseUnary()
+		p.negated = !p.negated
+		if err != nil {
+			return nil, err
+		}
+
+		return notExpr{expr: e}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *booleanParser) parsePrimary() (queryExpr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, &QuerySyntaxError{Pos: p.end, Msg: "expected a term"}
+	}
+
+	switch {
+	case tok.kind == tokenOpen:
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != tokenClose {
+			return nil, &QuerySyntaxError{Pos: p.position(), Msg: "expected )"}
+		}
+		p.pos++
+
+		return e, nil
+	case tok.kind == tokenClose, isOperator(tok, "and"), isOperator(tok, "or"):
+		return nil, &QuerySyntaxError{Pos: tok.start, Msg: "expected a term, got " + tok.text}
+	}
+
+	// a group runs until the next operator or parenthesis.
+	start := p.pos
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if t.kind == tokenOpen || t.kind == tokenClose || isOperator(t, "and") || isOperator(t, "or") || isOperator(t, "not") {
+			break
+		}
+		p.pos++
+	}
+
+	var scratch ParsedQuery
+	stems := scratch.addTerms(p.tokens[start:p.pos], p.analyzer, p.synonyms)
+	if len(stems) == 0 {
+		return nil, &QuerySyntaxError{Pos: tok.start, Msg: "expected a term, got only stopwords"}
+	}
+
+	p.pq.Phrases = append(p.pq.Phrases, scratch.Phrases...)
+	if !p.negated {
+		p.pq.Terms = append(p.pq.Terms, scratch.Terms...)
+		p.pq.Stems = append(p.pq.Stems, scratch.Stems...)
+	}
+
+	return &groupExpr{stems: stems}, nil
+}
@@ -0,0 +1,102 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Boolean queries", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+	})
+
+	AfterEach(func() {
+		se.Close()
+	})
+
+	search := func(q string) HTTPResult {
+		GinkgoHelper()
+		return doSearch(se, url.Values{"q": {q}, "explain": {"true"}})
+	}
+
+	DescribeTable("parses the operators by precedence",
+		func(q, expected string) {
+			res := search(q)
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.Explain.Queries[0].Expr).To(Equal(expected))
+		},
+		Entry("AND binds tighter than OR", "lion OR tiger AND chest", `("lion" OR ("tiger" AND "chest"))`),
+		Entry("NOT binds tighter than AND", "NOT color AND lion", `(NOT "color" AND "lion")`),
+		Entry("parentheses override", "(lion OR tiger) AND chest", `(("lion" OR "tiger") AND "chest")`),
+		Entry("adjacency implies AND", "lion (chest OR arm)", `("lion" AND ("chest" OR "arm"))`),
+		Entry("dash prefix negates", "lion -color", `("lion" AND NOT "color")`),
+		Entry("operators are case insensitive", "lion and (chest or arm)", `("lion" AND ("chest" OR "arm"))`),
+		Entry("plain words form a group", "realistic lion AND chest", `("realistic lion" AND "chest")`),
+	)
+
+	It("evaluates the expression against the candidate labels", func() {
+		res := search("lion AND (chest OR arm) AND NOT color")
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X"}))
+	})
+
+	It("includes a candidate through an OR clause the AND query excludes", func() {
+		and := search("lion AND chest")
+		Expect(collectionIDs(and.JSON.ImageCollections)).To(Equal([]string{"X"}))
+
+		or := search("lion AND (chest OR arm)")
+		Expect(collectionIDs(or.JSON.ImageCollections)).To(ConsistOf("X", "Y"))
+	})
+
+	It("leaves the negated terms out of the scoring", func() {
+		res := search("lion -tiger")
+		Expect(res.JSON.Explain.Queries[0].Stems).To(Equal([]string{"lion"}))
+	})
+
+	It("keeps the plain query behavior for lower case stopwords", func() {
+		res := search("black and white lion")
+		Expect(res.JSON.Explain.Queries[0].Expr).To(BeEmpty())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+	})
+
+	DescribeTable("returns a 400 Bad Request with the position for malformed expressions",
+		func(q, message string) {
+			res := search(q)
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("malformed_query"))
+			Expect(res.JSON.Error.Message).To(ContainSubstring(message))
+		},
+		Entry("unclosed parenthesis", "lion AND (chest OR arm", "expected ) at position 22"),
+		Entry("dangling operator", "lion AND", "expected a term at position 8"),
+		Entry("leading closing parenthesis", ") lion", "expected a term, got ) at position 0"),
+		Entry("unbalanced closing parenthesis", "lion) chest", "unexpected ) at position 4"),
+		Entry("operator operand", "lion OR OR tiger", "expected a term, got or at position 8"),
+	)
+
+	DescribeTable("returns a 501 Not Implemented for a vector store without lookups",
+		func(q string) {
+			ids := []string{"X", "Y"}
+			is := inkinspottest.NewFakeImageStore(searchAPI.TattooImagesCollection{ID: "X"}, searchAPI.TattooImagesCollection{ID: "Y"})
+			listed := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, listedVectorStore{&ids})))
+			DeferCleanup(listed.Close)
+
+			res := doSearch(listed, url.Values{"q": {q}})
+			Expect(res.Status).To(Equal(http.StatusNotImplemented))
+			Expect(res.JSON.Error.Code).To(Equal("boolean_unsupported"))
+
+			By("serving the plain queries")
+			Expect(doSearch(listed, url.Values{"q": {"lion"}}).Status).To(Equal(http.StatusOK))
+		},
+		Entry("negated term", "lion -tiger"),
+		Entry("AND", "lion AND tiger"),
+	)
+})
@@ -0,0 +1,176 @@
+package inkinspot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// filterFacets are the facets the searches filter by, in the order they're looked up.
+var filterFacets = []string{FacetStyle, FacetSubject, FacetArea}
+
+// FacetFilters are the labels of the facets the hits must carry, by facet.
+// A hit carries a label of every filtered facet, matched by its stems as the queries are.
+type FacetFilters map[string][]string
+
+// LabelIndex is implemented by the vector stores which can list the vectors carrying labels of a facet.
+// The labels match by their stems, the IDs are ordered by the best proximity of their matching labels, ties by ID.
+// It returns ErrUnknownFacet for the facets other than FacetStyle, FacetSubject & FacetArea.
+type LabelIndex interface {
+	GetIDsByLabels(ctx context.Context, facet string, labels []string) ([]string, error)
+}
+
+// normalized returns the filters with their labels trimmed, deduplicated & sorted, nil when they filter nothing.
+func (f FacetFilters) normalized() (FacetFilters, error) {
+	var out FacetFilters
+	for facet, labels := range f {
+		if !slices.Contains(filterFacets, facet) {
+			return nil, fmt.Errorf("%w: unknown facet %q", ErrInvalidFilter, facet)
+		}
+
+		var kept []string
+		for _, label := range labels {
+			if label = strings.TrimSpace(label); label != "" && !slices.Contains(kept, label) {
+				kept = append(kept, label)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		slices.Sort(kept)
+		if out == nil {
+			out = make(FacetFilters, len(f))
+		}
+		out[facet] = kept
+	}
+
+	return out, nil
+}
+
+// key identifies the filters in the cache keys.
+func (f FacetFilters) key() string {
+	var b strings.Builder
+	for _, facet := range filterFacets {
+		if labels, ok := f[facet]; ok {
+			fmt.Fprintf(&b, "|%s=%q", facet, labels)
+		}
+	}
+
+	return b.String()
+}
+
+// parseFacetFilters reads the repeatable style, subject & area query parameters.
+func parseFacetFilters(params url.Values) FacetFilters {
+	var f FacetFilters
+	for _, facet := range filterFacets {
+		if labels := params[facet]; len(labels) > 0 {
+			if f == nil {
+				f = make(FacetFilters, len(filterFacets))
+			}
+			f[facet] = labels
+		}
+	}
+
+	return f
+}
+
+// filterIDs returns the IDs of the vectors passing the filters, in the order of the matches of the first filtered facet.
+func (e *SearchEngine) filterIDs(ctx context.Context, filters FacetFilters) ([]string, error) {
+	index, ok := storeAs[LabelIndex](e.vectorStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: no label index", ErrFiltersUnsupported)
+	}
+
+	liCtx, liCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer liCancel()
+
+	var ids []string
+	first := true
+	for _, facet := range filterFacets {
+		labels, ok := filters[facet]
+		if !ok {
+			continue
+		}
+		matched, err := index.GetIDsByLabels(liCtx, facet, labels)
+		if err != nil {
+			return nil, e.storeError(VectorStoreName, "labels", err)
+		}
+		if first {
+			ids, first = matched, false
+			continue
+		}
+
+		passed := make(map[string]bool, len(matched))
+		for _, id := range matched {
+			passed[id] = true
+		}
+		ids = slices.DeleteFunc(ids, func(id string) bool { return !passed[id] })
+	}
+
+	return ids, nil
+}
+
+// filterLabels keeps the ranked matches of a query passing the filters.
+func (e *SearchEngine) filterLabels(ctx context.Context, ranked []RankedVector, filters FacetFilters) ([]RankedVector, error) {
+	ids, err := e.filterIDs(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	passed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		passed[id] = true
+	}
+
+	return slices.DeleteFunc(ranked, func(rv RankedVector) bool { return !passed[rv.ID] }), nil
+}
+
+// browse ranks the vectors passing the filters, for the searches without a query.
+// They're scored by the proximities of their filtered labels & their freshness.
+// Vector stores without lookups keep the order of the label index.
+// It returns the ranked vectors by ID alongside.
+func (e *SearchEngine) browse(ctx context.Context, filters FacetFilters, ranking RankingPolicy, settings *runtimeSettings) ([]RankedVector, map[string]TattooImagesVector, error) {
+	ids, err := e.filterIDs(ctx, filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	lookup, ok := storeAs[VectorLookup](e.vectorStore)
+	if !ok || len(ids) == 0 {
+		return e.configuration.ScorePolicy.scoreMatches(ids), nil, nil
+	}
+
+	vlCtx, vlCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vlCancel()
+
+	vectors, err := lookup.GetVectorsByID(vlCtx, ids)
+	if err != nil {
+		return nil, nil, e.storeError(VectorStoreName, "lookup", err)
+	}
+
+	ranker := *e.ranker
+	ranker.Clock = pinnedClock{Clock: ranker.Clock, at: e.rankingTime(ctx)}
+	ranker.Policy = ranking
+	ranker.Boosts = settings.boosts
+	ranked := ranker.RankFilters(filters, vectors)
+
+	byID := make(map[string]TattooImagesVector, len(vectors))
+	for _, v := range vectors {
+		byID[v.ID] = v
+	}
+
+	return ranked, byID, nil
+}
+
+// filterTokens returns the label tokens of the filters, the cached searches they filter are purged by them.
+func (e *SearchEngine) filterTokens(filters FacetFilters) []string {
+	var tokens []string
+	for _, labels := range filters {
+		for _, label := range labels {
+			tokens = append(tokens, e.labelAnalyzer.Analyze(label)...)
+		}
+	}
+
+	return tokens
+}
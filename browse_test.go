@@ -0,0 +1,135 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Browsing by facet filters", func() {
+	var now = time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)
+
+	// chest pieces of lions & a rose, a back piece of a lion.
+	vectors := []searchAPI.TattooImagesVector{
+		{ID: "T1", Area: searchAPI.LabelSet{"chest": 0.9}, Subject: searchAPI.LabelSet{"lion": 0.8}, Style: searchAPI.LabelSet{"blackwork": 0.5}},
+		{ID: "T2", Area: searchAPI.LabelSet{"chest": 0.5}, Subject: searchAPI.LabelSet{"rose": 0.9}, Style: searchAPI.LabelSet{"traditional": 0.5}},
+		{ID: "T3", Area: searchAPI.LabelSet{"back": 0.9}, Subject: searchAPI.LabelSet{"lion": 0.7}},
+		{ID: "T4", Area: searchAPI.LabelSet{"chest": 0.7}, Subject: searchAPI.LabelSet{"lion": 0.6}},
+	}
+
+	initServer := func(cfg searchAPI.Configuration, extra ...searchAPI.TattooImagesVector) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range append(vectors, extra...) {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		clock := inkinspottest.NewFakeClock(now)
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("browses the filters of a search without a query by proximity", func() {
+		se := initServer(searchAPI.Configuration{})
+
+		res := doSearch(se, url.Values{"area": {"Chest"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T1", "T4", "T2"}))
+		Expect(res.JSON.Total).To(Equal(3))
+	})
+
+	It("paginates the browsed filters", func() {
+		se := initServer(searchAPI.Configuration{})
+
+		res := doSearch(se, url.Values{"area": {"chest"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T1", "T4"}))
+		Expect(res.JSON.HasMore).To(BeTrue())
+
+		res = doSearch(se, url.Values{"area": {"chest"}, "limit": {"2"}, "offset": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T2"}))
+		Expect(res.JSON.HasMore).To(BeFalse())
+	})
+
+	It("keeps the hits carrying a label of every filtered facet", func() {
+		se := initServer(searchAPI.Configuration{})
+
+		res := doSearch(se, url.Values{"area": {"chest", "back"}, "subject": {"lion"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T1", "T3", "T4"}), "by the summed proximities of the filtered labels")
+	})
+
+	It("boosts the fresh tattoos", func() {
+		fresh := searchAPI.TattooImagesVector{ID: "T5", Area: searchAPI.LabelSet{"chest": 0.5}, CreatedAt: now}
+		se := initServer(searchAPI.Configuration{FreshnessPolicy: searchAPI.FreshnessPolicy{Boost: 1}}, fresh)
+
+		res := doSearch(se, url.Values{"area": {"chest"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T5", "T1", "T4", "T2"}))
+	})
+
+	It("filters the matches of a query", func() {
+		se := initServer(searchAPI.Configuration{})
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "area": {"chest"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("T1", "T4"))
+		Expect(res.JSON.Total).To(Equal(2))
+	})
+
+	It("browses the filters of a POST search", func() {
+		se := initServer(searchAPI.Configuration{})
+
+		res := doPostSearch(se, "application/json", `{"filters": {"area": ["chest"], "subject": ["lion"]}}`)
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"T1", "T4"}))
+	})
+
+	DescribeTable("still rejects the searches of nothing",
+		func(params url.Values) {
+			se := initServer(searchAPI.Configuration{})
+
+			res := doSearch(se, params)
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("empty_query"))
+		},
+		Entry("no query & no filters", url.Values{}),
+		Entry("a blank filter", url.Values{"area": {" "}}),
+		Entry("an artist alone", url.Values{"artist": {"ink"}}),
+	)
+
+	It("rejects the filters alone when a query is required", func() {
+		se := initServer(searchAPI.Configuration{QueryPolicy: searchAPI.QueryPolicy{RequireQuery: true}})
+
+		res := doSearch(se, url.Values{"area": {"chest"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("empty_query"))
+	})
+
+	It("rejects the filters of a vector store without a label index", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"area": {"chest"}})
+		Expect(res.Status).To(Equal(http.StatusNotImplemented))
+		Expect(res.JSON.Error.Code).To(Equal("filters_unsupported"))
+	})
+
+	It("rejects the filters of an unknown facet", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+
+		_, err := eng.MultiSearch(context.Background(), nil, searchAPI.SearchOptions{Filters: searchAPI.FacetFilters{"color": {"red"}}})
+		Expect(err).To(MatchError(searchAPI.ErrInvalidFilter))
+	})
+})
@@ -0,0 +1,107 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// slowVectorStore advances the clock by the delay on every query.
+type slowVectorStore struct {
+	*inkinspottest.FakeVectorStore
+	clock *inkinspottest.FakeClock
+	delay time.Duration
+}
+
+func (s slowVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	s.clock.Advance(s.delay)
+	return s.FakeVectorStore.GetIDsByQuery(ctx, query)
+}
+
+// countingImageStore counts the fetches.
+type countingImageStore struct {
+	*inkinspottest.FakeImageStore
+	calls atomic.Int32
+}
+
+func (s *countingImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	s.calls.Add(1)
+	return s.FakeImageStore.GetTattoosByID(ctx, ids)
+}
+
+var _ = Describe("Store budgets", func() {
+	var is *countingImageStore
+
+	// initServer serves a 300ms search whose vector store query takes the delay.
+	initServer := func(delay time.Duration) *httptest.Server {
+		GinkgoHelper()
+		fakeIS, fakeVS := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is = &countingImageStore{FakeImageStore: fakeIS}
+		cfg := searchAPI.Configuration{TimeoutPolicy: searchAPI.TimeoutPolicy{
+			SearchTimeout:      300 * time.Millisecond,
+			VectorStoreTimeout: 290 * time.Millisecond,
+			ImageStoreTimeout:  200 * time.Millisecond,
+			ResponseReserve:    20 * time.Millisecond,
+			ImageStoreFloor:    10 * time.Millisecond,
+		}}
+		engine := searchAPI.NewSearchEngine(cfg, is, slowVectorStore{FakeVectorStore: fakeVS, clock: clock, delay: delay}, searchAPI.WithClock(clock))
+		se := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("gives the image store its timeout when the request has the time", func() {
+		se := initServer(50 * time.Millisecond)
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Meta.VectorStoreBudgetMS).To(BeNumerically("==", 290))
+		Expect(res.JSON.Meta.ImageStoreBudgetMS).To(BeNumerically("==", 200))
+	})
+
+	It("cuts the image store budget to the time left minus the reserve", func() {
+		se := initServer(150 * time.Millisecond)
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("X", "Y"))
+		Expect(res.JSON.Meta.ImageStoreBudgetMS).To(BeNumerically("==", 300-150-20))
+	})
+
+	It("fails fast when less than the floor is left", func() {
+		se := initServer(275 * time.Millisecond)
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusGatewayTimeout))
+		Expect(res.JSON.Error.Code).To(Equal("image_store_timeout"))
+		Expect(is.calls.Load()).To(BeZero(), "the image store was called without a budget")
+	})
+
+	It("fails the searches whose deadline leaves less than the floor", func() {
+		se := initServer(0)
+
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set(searchAPI.DeadlineHeader, "5")
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Error.Code).To(Equal("search_timeout"))
+		Expect(is.calls.Load()).To(BeZero())
+	})
+})
@@ -0,0 +1,274 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxExampleLabels caps the labels of an example which generate its candidates, the closest are kept.
+const maxExampleLabels = 32
+
+// maxExampleBodyBytes caps the size of the search by example bodies.
+const maxExampleBodyBytes = 64 << 10
+
+// Similarity rates how alike the label sets are, by the cosine of their proximities.
+// It's 1 for sets of the same labels in the same proportions, 0 when they share none.
+func (ls LabelSet) Similarity(other LabelSet) float64 {
+	var dot, norm, otherNorm float64
+	for label, p := range ls {
+		norm += p * p
+		dot += p * other[label]
+	}
+	for _, p := range other {
+		otherNorm += p * p
+	}
+	if dot <= 0 || norm == 0 || otherNorm == 0 {
+		return 0
+	}
+
+	return min(dot/(math.Sqrt(norm)*math.Sqrt(otherNorm)), 1)
+}
+
+// analyzedLabels keys the labels of the set by their joined stems, the closest label of a stem is kept.
+// The labels made of stopwords only are dropped.
+func analyzedLabels(ls LabelSet, a Analyzer) LabelSet {
+	out := make(LabelSet, len(ls))
+	for label, p := range ls {
+		stems := a.Analyze(label)
+		if len(stems) == 0 {
+			continue
+		}
+		key := strings.Join(stems, " ")
+		out[key] = max(out[key], p)
+	}
+
+	return out
+}
+
+// exampleQueries synthesizes a query of every label of the example, the closest labels first.
+func exampleQueries(facets []LabelSet) []ParsedQuery {
+	type label struct {
+		stem      string
+		proximity float64
+	}
+	var labels []label
+	seen := make(map[string]bool)
+	for _, ls := range facets {
+		for stem, p := range ls {
+			if !seen[stem] {
+				seen[stem] = true
+				labels = append(labels, label{stem, p})
+			}
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].proximity != labels[j].proximity {
+			return labels[i].proximity > labels[j].proximity
+		}
+		return labels[i].stem < labels[j].stem
+	})
+
+	out := make([]ParsedQuery, 0, min(len(labels), maxExampleLabels))
+	for _, l := range labels[:min(len(labels), maxExampleLabels)] {
+		out = append(out, ParsedQuery{Text: l.stem, Terms: []string{l.stem}, Stems: []string{l.stem}})
+	}
+
+	return out
+}
+
+// SearchByVector searches the collections alike the example vector, its ID is ignored.
+// The candidates match a label of the example, they're ranked by the similarity of their label sets.
+// The facets weigh as in the ranking policy, the score is their weighted mean.
+// The vector store needs lookups, cursors aren't supported.
+func (e *SearchEngine) SearchByVector(ctx context.Context, v TattooImagesVector, opts SearchOptions) (*SearchResult, error) {
+	start := e.clock.Now()
+
+	if err := validateLabels(v); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVector, err)
+	}
+	lookup, ok := storeAs[VectorLookup](e.vectorStore)
+	if !ok {
+		return nil, ErrLookupUnsupported
+	}
+	ranking, err := opts.Weights.apply(e.configuration.RankingPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMinScore(opts.MinScore); err != nil {
+		return nil, err
+	}
+	if opts.Near != nil {
+		if err := validateNear(*opts.Near, opts.RadiusKM); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Cursor != "" {
+		return nil, fmt.Errorf("%w: cursors aren't supported by example", ErrInvalidPage)
+	}
+	if opts.Offset, opts.Limit, err = e.configuration.PagePolicy.page(opts.Offset, opts.Limit); err != nil {
+		return nil, err
+	}
+
+	analyzer := e.ranker.Analyzer
+	example := []LabelSet{analyzedLabels(v.Style, analyzer), analyzedLabels(v.Subject, analyzer), analyzedLabels(v.Area, analyzer)}
+	queries := exampleQueries(example)
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("%w: no labels to match", ErrInvalidVector)
+	}
+
+	vectorStart := e.clock.Now()
+	matched, _, err := e.matchIDs(ctx, queries, 0)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(matched))
+	for _, m := range matched {
+		ids = append(ids, m.ID)
+	}
+
+	vlCtx, vlCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vlCancel()
+	candidates, err := lookup.GetVectorsByID(vlCtx, ids)
+	if err != nil {
+		return nil, e.storeError(VectorStoreName, "lookup", err)
+	}
+
+	weights := []float64{ranking.StyleWeight, ranking.SubjectWeight, ranking.AreaWeight}
+	total := weights[0] + weights[1] + weights[2]
+	vectors := make(map[string]TattooImagesVector, len(candidates))
+	ranked := make([]RankedVector, 0, len(candidates))
+	for _, c := range candidates {
+		vectors[c.ID] = c
+		labels := []LabelSet{analyzedLabels(c.Style, analyzer), analyzedLabels(c.Subject, analyzer), analyzedLabels(c.Area, analyzer)}
+		score := 0.0
+		for i, w := range weights {
+			score += w * example[i].Similarity(labels[i])
+		}
+		if total > 0 {
+			score /= total
+		}
+		if score > 0 {
+			ranked = append(ranked, RankedVector{ID: c.ID, Score: score})
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	e.configuration.ScorePolicy.normalize(ranked)
+	ranked = filterMinScore(ranked, opts.MinScore)
+	if opts.Artist != "" {
+		if ranked, err = e.filterArtist(ctx, ranked, opts.Artist); err != nil {
+			return nil, err
+		}
+	}
+	var distances map[string]float64
+	if opts.Near != nil {
+		if ranked, distances, err = e.filterNear(ctx, ranked, *opts.Near, opts.RadiusKM); err != nil {
+			return nil, err
+		}
+	}
+	if ranked, _, err = e.dropHidden(ctx, ranked); err != nil {
+		return nil, err
+	}
+	page := paginate(ranked, opts.Offset, opts.Limit)
+	vectorTook := e.clock.Now().Sub(vectorStart)
+
+	imageBudget, err := e.imageStoreBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	imageStart := e.clock.Now()
+	hits, _, _, err := e.fetchHits(ctx, page, len(page) == len(ranked), vectors, nil, imageBudget, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].DistanceKM = distances[hits[i].Collection.ID]
+	}
+
+	return &SearchResult{
+		Hits:    hits,
+		Total:   len(ranked),
+		HasMore: opts.Offset+len(page) < len(ranked),
+		Ranking: ranking,
+		Timings: SearchTimings{VectorStore: vectorTook, ImageStore: e.clock.Now().Sub(imageStart), Total: e.clock.Now().Sub(start)},
+	}, nil
+}
+
+// exampleBody is the example vector of a search by example.
+type exampleBody struct {
+	Style   LabelSet `json:"style"`
+	Subject LabelSet `json:"subject"`
+	Area    LabelSet `json:"area"`
+}
+
+// handleSearchByVector searches the collections alike the label sets of the body.
+// The page, weights & filters are the query parameters of a search.
+func handleSearchByVector(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		weights, err := parseWeightOverrides(params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_weight", err.Error())
+			return
+		}
+		offset, limit, err := parsePage(params.Get("offset"), params.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+			return
+		}
+		near, radiusKM, err := parseNear(params.Get("near"), params.Get("radius_km"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_location", err.Error())
+			return
+		}
+		opts := SearchOptions{Weights: weights, Offset: offset, Limit: limit, Artist: params.Get("artist"), Near: near, RadiusKM: radiusKM}
+		if raw := params.Get("min_score"); raw != "" {
+			if opts.MinScore, err = strconv.ParseFloat(raw, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_min_score", "min_score must be a number")
+				return
+			}
+		}
+
+		var body exampleBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExampleBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+
+		ctx, cancel := se.withTightTimeout(r.Context(), se.configuration.TimeoutPolicy.SearchTimeout)
+		defer cancel()
+
+		res, err := se.SearchByVector(ctx, TattooImagesVector{Style: body.Style, Subject: body.Subject, Area: body.Area}, opts)
+		if err != nil {
+			writeSearchError(w, err)
+			return
+		}
+
+		resp := Response{
+			ImageCollections: res.Collections(),
+			Total:            res.Total,
+			HasMore:          res.HasMore,
+		}
+		resp.Artists = se.Artists(ctx, resp.ImageCollections)
+		if opts.Near != nil {
+			resp.DistancesKM = res.Distances()
+		}
+		if params.Get("explain") == "true" {
+			resp.Explain = &Explain{Weights: res.Ranking, Hits: res.Rankings()}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,99 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doSearchByVector posts the example body to the search by example.
+func doSearchByVector(se *httptest.Server, query, body string) HTTPResult {
+	GinkgoHelper()
+	resp, err := se.Client().Post(se.URL+"/search/by-vector"+query, "application/json", strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	res := HTTPResult{Status: resp.StatusCode}
+	_ = json.NewDecoder(resp.Body).Decode(&res.JSON)
+	return res
+}
+
+var _ = Describe("Search by example", func() {
+	var (
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+	)
+
+	BeforeEach(func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		engine = searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	It("ranks the vector itself first & the closest next", func() {
+		x := inkinspottest.BigCats[0].Vector
+		res, err := engine.SearchByVector(context.Background(), x, searchAPI.SearchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collectionIDs(res.Collections())).To(Equal([]string{"X", "Z", "Y"}))
+		Expect(res.Hits[0].Score).To(BeNumerically("==", 1))
+		Expect(res.Total).To(Equal(3))
+	})
+
+	It("reuses the facet weights", func() {
+		zero := 0.0
+		x := inkinspottest.BigCats[0].Vector
+		res, err := engine.SearchByVector(context.Background(), x, searchAPI.SearchOptions{Weights: searchAPI.WeightOverrides{Style: &zero, Area: &zero}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collectionIDs(res.Collections())).To(Equal([]string{"X", "Y"}))
+	})
+
+	It("answers the ranked matches of the posted label sets", func() {
+		res := doSearchByVector(se, "?limit=2", `{"style": {"realistic": 100, "bw": 100}, "subject": {"lion": 100}, "area": {"chest": 100}}`)
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Z"}))
+		Expect(res.JSON.Total).To(Equal(3))
+		Expect(res.JSON.HasMore).To(BeTrue())
+	})
+
+	DescribeTable("rejects invalid examples",
+		func(body string, status int, code string) {
+			res := doSearchByVector(se, "", body)
+			Expect(res.Status).To(Equal(status))
+			Expect(res.JSON.Error.Code).To(Equal(code))
+		},
+		Entry("negative proximity", `{"subject": {"lion": -1}}`, http.StatusBadRequest, "invalid_vector"),
+		Entry("empty label", `{"style": {"": 10}}`, http.StatusBadRequest, "invalid_vector"),
+		Entry("no labels", `{}`, http.StatusBadRequest, "invalid_vector"),
+		Entry("unknown facet", `{"color": {"red": 10}}`, http.StatusBadRequest, "invalid_body"),
+	)
+
+	It("answers 405 to other methods", func() {
+		resp, err := se.Client().Get(se.URL + "/search/by-vector")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resp.Header.Get("Allow")).To(Equal("POST, OPTIONS"))
+	})
+})
+
+var _ = Describe("Label set similarity", func() {
+	DescribeTable("rates the label sets by the cosine of their proximities",
+		func(a, b searchAPI.LabelSet, similarity float64) {
+			Expect(a.Similarity(b)).To(BeNumerically("~", similarity, 1e-9))
+			Expect(b.Similarity(a)).To(BeNumerically("~", similarity, 1e-9))
+		},
+		Entry("same labels", searchAPI.LabelSet{"lion": 90, "tiger": 30}, searchAPI.LabelSet{"lion": 3, "tiger": 1}, 1.0),
+		Entry("disjoint labels", searchAPI.LabelSet{"lion": 90}, searchAPI.LabelSet{"tiger": 90}, 0.0),
+		Entry("one shared label of two", searchAPI.LabelSet{"bw": 100, "realistic": 100}, searchAPI.LabelSet{"bw": 100, "abstract": 100}, 0.5),
+		Entry("empty set", searchAPI.LabelSet{}, searchAPI.LabelSet{"lion": 90}, 0.0),
+	)
+})
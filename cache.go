@@ -0,0 +1,529 @@
+package inkinspot
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy controls the search result cache.
+// A zero TTL disables the cache.
+type CachePolicy struct {
+	TTL        time.Duration
+	MaxEntries int
+	// CacheBodies also caches the encoded search responses, hits skip the encoding.
+	CacheBodies bool
+	// MaxBytes caps the total size of the cached responses.
+	MaxBytes int
+	// RefreshAfter is the age past which a cached result is served stale while it's refreshed
+	// in the background, when it's below the TTL. Zero refreshes nothing before the TTL.
+	RefreshAfter time.Duration
+	// NegativeTTL is how long the searches without matches are cached, at most the TTL.
+	NegativeTTL time.Duration
+	// Invalidation is how the writes purge the cache, CacheInvalidateTargeted by default.
+	// Unknown modes flush the cache.
+	Invalidation string
+	// CollectionTTL is how long the image store collections are cached by ID, whatever the search.
+	// A zero CollectionTTL disables the collection cache.
+	CollectionTTL time.Duration
+	// MaxCollections caps the collections cached.
+	MaxCollections int
+}
+
+func (p CachePolicy) withDefaults() CachePolicy {
+	if p.MaxEntries <= 0 {
+		p.MaxEntries = 1024
+	}
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = 64 << 20
+	}
+	if p.NegativeTTL <= 0 {
+		p.NegativeTTL = 5 * time.Second
+	}
+	if p.MaxCollections <= 0 {
+		p.MaxCollections = 10000
+	}
+	if p.Invalidation == "" {
+		p.Invalidation = CacheInvalidateTargeted
+	}
+
+	return p
+}
+
+// resultCache is an LRU of search results & their encoded responses with a TTL.
+// A nil cache is valid and never hits.
+type resultCache struct {
+	ttl          time.Duration
+	negativeTTL  time.Duration
+	refreshAfter time.Duration
+	maxEntries   int
+	maxBytes     int
+	cacheBodies  bool
+	clock        Clock
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	// bytes is the total size of the cached bodies.
+	bytes int
+	// gen counts the purges, results computed before one aren't cached.
+	gen uint64
+	// hits & misses count the lookups, negativeHits the hits of searches without matches.
+	hits, misses, negativeHits uint64
+}
+
+// cacheEntry holds either a result or an encoded body.
+type cacheEntry struct {
+	key     string
+	result  *SearchResult
+	body    *cachedBody
+	added   time.Time
+	expires time.Time
+	// refreshing is set once the background refresh of the stale entry is claimed.
+	refreshing bool
+	// tokens are the label tokens the search matches, the writes of these labels purge it.
+	tokens []string
+}
+
+// size is the number of bytes the entry counts against the cap.
+func (e *cacheEntry) size() int {
+	if e.body == nil {
+		return 0
+	}
+
+	return len(e.body.head) + len(e.body.tail)
+}
+
+// until returns the first expiry of the collections of the entry, zero when none expires.
+func (e *cacheEntry) until() time.Time {
+	if e.body != nil {
+		return e.body.expires
+	}
+
+	return earliestExpiry(e.result.Collections())
+}
+
+// negative reports whether the entry is of a search without matches.
+func (e *cacheEntry) negative() bool {
+	if e.body != nil {
+		return e.body.empty
+	}
+
+	return e.result.Total == 0
+}
+
+// searches reports whether the entry is of a search with the normalized query.
+func (e *cacheEntry) searches(query string) bool {
+	if e.body != nil {
+		return slices.Contains(e.body.queries, query)
+	}
+
+	return slices.Contains(e.result.QueryTexts(), query)
+}
+
+// newResultCache creates the cache of the policy, nil when it's disabled.
+func newResultCache(p CachePolicy, clock Clock) *resultCache {
+	if p.TTL <= 0 {
+		return nil
+	}
+
+	return &resultCache{
+		ttl:          p.TTL,
+		negativeTTL:  min(p.NegativeTTL, p.TTL),
+		refreshAfter: p.RefreshAfter,
+		maxEntries:   p.MaxEntries,
+		maxBytes:     p.MaxBytes,
+		cacheBodies:  p.CacheBodies,
+		clock:        clock,
+		order:        list.New(),
+		entries:      make(map[string]*list.Element),
+	}
+}
+
+// cachedResult is a result served from the cache, it must not be modified.
+type cachedResult struct {
+	result *SearchResult
+	// stale results are past the refresh age, refresh is set on the one lookup claiming the refresh.
+	stale, refresh bool
+}
+
+// get returns the cached result of the key, stale ones included.
+func (c *resultCache) get(key string) (cachedResult, bool) {
+	entry, stale, ok := c.lookup(key, true)
+	if !ok {
+		return cachedResult{}, false
+	}
+
+	return cachedResult{result: entry.result, stale: stale, refresh: stale && c.claimRefresh(entry)}, true
+}
+
+// claimRefresh reports whether the caller is the first to claim the refresh of the entry.
+func (c *resultCache) claimRefresh(entry *cacheEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry.refreshing {
+		return false
+	}
+	entry.refreshing = true
+
+	return true
+}
+
+// put caches the result of the generation, evicting the least recently used beyond the caps.
+// The tokens are the labels the search matches.
+func (c *resultCache) put(key string, gen uint64, res *SearchResult, tokens []string) {
+	c.store(gen, &cacheEntry{key: key, result: res, tokens: tokens})
+}
+
+// getBody returns the cached response of the key, the stale ones miss.
+func (c *resultCache) getBody(key string) (*cachedBody, bool) {
+	entry, _, ok := c.lookup(bodyCacheKey(key), false)
+	if !ok {
+		return nil, false
+	}
+
+	return entry.body, true
+}
+
+// putBody caches the response of the generation, unless it's larger than the cap.
+func (c *resultCache) putBody(key string, gen uint64, body *cachedBody, tokens []string) {
+	c.store(gen, &cacheEntry{key: bodyCacheKey(key), body: body, tokens: tokens})
+}
+
+// bodiesEnabled reports whether the responses are cached.
+func (c *resultCache) bodiesEnabled() bool {
+	return c != nil && c.cacheBodies
+}
+
+// generation returns the current generation, to pass to the puts of what is computed next.
+func (c *resultCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// purge drops every result & response, the ones in flight won't be cached.
+func (c *resultCache) purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+	c.bytes = 0
+	c.gen++
+}
+
+// purgeQuery drops the results & responses of the searches with the normalized query.
+// The ones in flight won't be cached. It returns the number of entries dropped.
+func (c *resultCache) purgeQuery(query string) int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cacheEntry).searches(query) {
+			c.remove(el)
+			purged++
+		}
+		el = next
+	}
+	c.gen++
+
+	return purged
+}
+
+// purgeTokens drops the results & responses of the searches matching any of the tokens.
+// The ones in flight won't be cached.
+func (c *resultCache) purgeTokens(tokens map[string]bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if slices.ContainsFunc(el.Value.(*cacheEntry).tokens, func(t string) bool { return tokens[t] }) {
+			c.remove(el)
+		}
+		el = next
+	}
+	c.gen++
+}
+
+// CacheStats describes the content of the result cache & how often it hits.
+type CacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Entries int    `json:"entries"`
+	Bytes   int    `json:"bytes"`
+	Hits    uint64 `json:"hits"`
+	// NegativeHits are the hits of searches without matches, counted in Hits too.
+	NegativeHits uint64  `json:"negative_hits"`
+	Misses       uint64  `json:"misses"`
+	HitRatio     float64 `json:"hit_ratio"`
+	// OldestEntryAgeMS is the age of the oldest entry, expired ones included until they are dropped.
+	OldestEntryAgeMS float64 `json:"oldest_entry_age_ms"`
+	// Embeddings are the stats of the embedding cache of the adapters, when the engine is given one.
+	Embeddings *EmbeddingCacheStats `json:"embeddings,omitempty"`
+}
+
+func (c *resultCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{Enabled: true, Entries: c.order.Len(), Bytes: c.bytes, Hits: c.hits, NegativeHits: c.negativeHits, Misses: c.misses}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRatio = float64(c.hits) / float64(lookups)
+	}
+	now := c.clock.Now()
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		stats.OldestEntryAgeMS = max(stats.OldestEntryAgeMS, milliseconds(now.Sub(el.Value.(*cacheEntry).added)))
+	}
+
+	return stats
+}
+
+// lookup returns the entry of the key & whether it's stale, the stale ones miss unless allowed.
+func (c *resultCache) lookup(key string, allowStale bool) (*cacheEntry, bool, bool) {
+	if c == nil {
+		return nil, false, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	now := c.clock.Now()
+	if now.After(entry.expires) {
+		c.remove(el)
+		c.misses++
+		return nil, false, false
+	}
+	stale := c.refreshAfter > 0 && now.Sub(entry.added) >= c.refreshAfter
+	if stale && !allowStale {
+		c.misses++
+		return nil, false, false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	if entry.negative() {
+		c.negativeHits++
+	}
+
+	return entry, stale, true
+}
+
+func (c *resultCache) store(gen uint64, entry *cacheEntry) {
+	if c == nil || entry.size() > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	entry.added = c.clock.Now()
+	ttl := c.ttl
+	if entry.negative() {
+		ttl = c.negativeTTL
+	}
+	entry.expires = entry.added.Add(ttl)
+	// the entry can't outlive the collections it serves, which expire at their ExpiresAt already.
+	if until := entry.until(); !until.IsZero() && until.Before(entry.expires) {
+		entry.expires = until.Add(-time.Nanosecond)
+	}
+	if el, ok := c.entries[entry.key]; ok {
+		c.remove(el)
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	c.bytes += entry.size()
+	for c.order.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *resultCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.order.Remove(el)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size()
+}
+
+// bodyCacheKey keeps the responses apart from the results of the same key.
+func bodyCacheKey(key string) string {
+	return "body|" + key
+}
+
+// searchKey identifies a search by the queries & options which select its matches.
+func searchKey(queries []ParsedQuery, ranking RankingPolicy, opts SearchOptions) string {
+	var b strings.Builder
+	for _, q := range queries {
+		fmt.Fprintf(&b, "%q|%q|%q;", q.Lang, q.Text, q.Expr)
+	}
+	fmt.Fprintf(&b, "w=%g,%g,%g|min=%g", ranking.StyleWeight, ranking.SubjectWeight, ranking.AreaWeight, opts.MinScore)
+	if opts.Artist != "" {
+		fmt.Fprintf(&b, "|artist=%q", normalizeHandle(opts.Artist))
+	}
+	if opts.Near != nil {
+		fmt.Fprintf(&b, "|near=%g,%g,%g", opts.Near.Lat, opts.Near.Lng, opts.RadiusKM)
+	}
+	b.WriteString(opts.Filters.key())
+	b.WriteString(opts.Experiment.key())
+
+	return b.String()
+}
+
+// searchCacheKey identifies a search page by everything which shapes its result.
+func searchCacheKey(search string, settings *runtimeSettings, opts SearchOptions) string {
+	return fmt.Sprintf("%s|boosts=%s|page=%d,%d,%q", search, settings.key, opts.Offset, opts.Limit, opts.Cursor)
+}
+
+// cachedBody is an encoded search response, split around the value of its took_ms.
+type cachedBody struct {
+	head, tail []byte
+	etag       string
+	// queries are the normalized queries of the response.
+	queries []string
+	// ids are the collections of the response, in order.
+	ids []string
+	// empty responses are of searches without matches.
+	empty bool
+	// expires is the first expiry of the collections of the response, zero when none expires.
+	expires time.Time
+}
+
+// newCachedBody encodes the response for the cache. The ETag covers everything but took_ms.
+func newCachedBody(resp Response) (*cachedBody, error) {
+	resp.TookMS = 0
+	b, err := marshalCanonical(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// the keys are sorted, only total follows the top level took_ms.
+	at := bytes.LastIndex(b, []byte(`"took_ms":0`))
+	if at < 0 {
+		return nil, fmt.Errorf("canonical json: took_ms is missing from %s", b)
+	}
+	at += len(`"took_ms":`)
+
+	ids := make([]string, len(resp.ImageCollections))
+	for i, c := range resp.ImageCollections {
+		ids[i] = c.ID
+	}
+
+	sum := sha256.Sum256(b)
+	return &cachedBody{
+		head:    b[:at],
+		tail:    append(b[at+1:len(b):len(b)], '\n'),
+		etag:    `W/"` + hex.EncodeToString(sum[:12]) + `"`,
+		queries: resp.Queries,
+		ids:     ids,
+		empty:   resp.Total == 0,
+		expires: earliestExpiry(resp.ImageCollections),
+	}, nil
+}
+
+// notModified reports whether the If-None-Match header lists the ETag of the body.
+func (b *cachedBody) notModified(ifNoneMatch string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(b.etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CacheStats reports the content of the result cache & its hit ratio, with the embedding cache's stats when it has one.
+func (e *SearchEngine) CacheStats() CacheStats {
+	stats := e.cache.stats()
+	if e.embeddings != nil {
+		embeddings := e.embeddings.Stats()
+		stats.Embeddings = &embeddings
+	}
+
+	return stats
+}
+
+// PurgeCache drops the cached searches of the query, normalized by the default language,
+// or the whole cache when the query is empty. It returns the number of entries dropped.
+func (e *SearchEngine) PurgeCache(query string) int {
+	if query == "" {
+		n := e.cache.stats().Entries
+		e.cache.purge()
+		return n
+	}
+
+	return e.cache.purgeQuery(e.normalizeQuery(query))
+}
+
+// normalizeQuery normalizes the query by the rules of the default language.
+func (e *SearchEngine) normalizeQuery(query string) string {
+	policy := e.configuration.QueryPolicy
+	lang, err := lookupLanguage(policy.DefaultLanguage)
+	if err != nil {
+		return query
+	}
+
+	return policy.analyzer(lang).Normalizer.Normalize(query)
+}
+
+// CachePurge reports the entries dropped by a purge.
+type CachePurge struct {
+	Purged int `json:"purged"`
+}
+
+// handleCacheStats reports the content of the result cache.
+func handleCacheStats(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.CacheStats())
+	})
+}
+
+// handleCachePurge drops the cached searches of the query parameter, all of them without.
+func handleCachePurge(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		purged := se.PurgeCache(query)
+		se.recordAudit(w, r, AuditCachePurge, query, "", fmt.Sprintf("purged %d", purged))
+		writeJSON(w, http.StatusOK, CachePurge{Purged: purged})
+	})
+}
@@ -0,0 +1,445 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response caching", func() {
+	cachePolicy := searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true}
+
+	It("serves the cached responses unchanged", func() {
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		faulty := inkinspottest.NewFaultyStore(is)
+		cfg := searchAPI.Configuration{CachePolicy: cachePolicy}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, faulty, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+
+		for range 3 {
+			res := doQuery(se, "lion")
+			Expect(res.Status).To(Equal(http.StatusOK))
+			expectGolden("search_success", res.Body)
+		}
+		Expect(faulty.Calls()).To(Equal(1))
+	})
+
+	It("answers Not Modified to a matching If-None-Match", func() {
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{CachePolicy: cachePolicy})))
+		DeferCleanup(se.Close)
+
+		resp := doRequest(se, http.MethodGet, "lion", nil)
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		Expect(etag).To(HavePrefix(`W/"`))
+
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("If-None-Match", etag)
+		resp, err = se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+
+		other := doRequest(se, http.MethodGet, "tiger", nil)
+		other.Body.Close()
+		Expect(other.Header.Get("ETag")).NotTo(Equal(etag))
+	})
+
+	It("keeps the responses of other formats apart", func() {
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{CachePolicy: cachePolicy})))
+		DeferCleanup(se.Close)
+
+		Expect(doSearch(se, url.Values{"q": {"lion"}}).JSON.Explain).To(BeNil())
+		Expect(doSearch(se, url.Values{"q": {"lion"}, "explain": {"true"}}).JSON.Explain).NotTo(BeNil())
+		Expect(doSearch(se, url.Values{"q": {"lion"}, "group_by": {"style"}}).JSON.Groups).NotTo(BeEmpty())
+		Expect(doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}}).JSON.Meta.CacheHit).To(BeTrue())
+	})
+
+	It("drops the cached results & responses on imports", func() {
+		cfg := searchAPI.Configuration{CachePolicy: cachePolicy, AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+
+		status, summary := doImport(se, url.Values{"mode": {"overwrite"}}, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"lion_w.jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: "W", Subject: searchAPI.LabelSet{"lion": 100}},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Imported).To(Equal(1))
+
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(ContainElement("W"))
+		Expect(collectionIDs(doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}}).JSON.ImageCollections)).To(ContainElement("W"))
+	})
+})
+
+var _ = Describe("Cache admin", func() {
+	var (
+		se    *httptest.Server
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true},
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	// cacheAdmin calls the cache admin endpoint & decodes its answer into out.
+	cacheAdmin := func(method, path string, out any) int {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+		return resp.StatusCode
+	}
+
+	cacheHit := func(query string) bool {
+		GinkgoHelper()
+		return doSearch(se, url.Values{"q": {query}, "debug_meta": {"true"}}).JSON.Meta.CacheHit
+	}
+
+	It("reports the entries, size, hit ratio & oldest entry age", func() {
+		doQuery(se, "lion")
+		clock.Advance(10 * time.Second)
+		doQuery(se, "tiger")
+		doQuery(se, "lion")
+
+		var stats searchAPI.CacheStats
+		Expect(cacheAdmin(http.MethodGet, "/admin/cache/stats", &stats)).To(Equal(http.StatusOK))
+		Expect(stats.Enabled).To(BeTrue())
+		Expect(stats.Entries).To(Equal(4), "a result & a response of each query")
+		Expect(stats.Bytes).To(BeNumerically(">", 0))
+		Expect(stats.Hits).To(BeEquivalentTo(1))
+		Expect(stats.Misses).To(BeEquivalentTo(4))
+		Expect(stats.HitRatio).To(BeNumerically("~", 0.2))
+		Expect(stats.OldestEntryAgeMS).To(BeNumerically("==", 10000))
+	})
+
+	It("purges a single normalized query", func() {
+		Expect(cacheHit("lion")).To(BeFalse())
+		Expect(cacheHit("tiger")).To(BeFalse())
+		doQuery(se, "lion")
+
+		var purge searchAPI.CachePurge
+		Expect(cacheAdmin(http.MethodDelete, "/admin/cache?query=LION", &purge)).To(Equal(http.StatusOK))
+		Expect(purge.Purged).To(Equal(2))
+
+		Expect(cacheHit("lion")).To(BeFalse())
+		Expect(cacheHit("tiger")).To(BeTrue())
+	})
+
+	It("purges the whole cache without a query", func() {
+		doQuery(se, "lion")
+		doQuery(se, "tiger")
+
+		var purge searchAPI.CachePurge
+		Expect(cacheAdmin(http.MethodDelete, "/admin/cache", &purge)).To(Equal(http.StatusOK))
+		Expect(purge.Purged).To(Equal(4))
+		Expect(cacheHit("tiger")).To(BeFalse())
+	})
+
+	It("purges safely during the searches", func() {
+		var wg sync.WaitGroup
+		for _, q := range []string{"lion", "tiger"} {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for range 20 {
+					Expect(doQuery(se, q).Status).To(Equal(http.StatusOK))
+				}
+			}()
+		}
+		for range 20 {
+			var purge searchAPI.CachePurge
+			Expect(cacheAdmin(http.MethodDelete, "/admin/cache?query=lion", &purge)).To(Equal(http.StatusOK))
+		}
+		wg.Wait()
+	})
+
+	It("requires the admin token", func() {
+		resp, err := se.Client().Get(se.URL + "/admin/cache/stats")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
+
+// heldImageStore holds the lookups after the first until it's released.
+type heldImageStore struct {
+	searchAPI.ImageStore
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (s *heldImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	if s.calls.Add(1) > 1 {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return s.ImageStore.GetTattoosByID(ctx, ids)
+}
+
+func (s *heldImageStore) Calls() int {
+	return int(s.calls.Load())
+}
+
+var _ = Describe("Stale while revalidate", func() {
+	It("serves the stale result while a single background search refreshes it", func() {
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		held := &heldImageStore{ImageStore: is, release: make(chan struct{})}
+		cfg := searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, RefreshAfter: 30 * time.Second, CacheBodies: true}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, held, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+
+		cacheState := func() string {
+			GinkgoHelper()
+			res := doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+			return res.JSON.Meta.Cache
+		}
+
+		Expect(cacheState()).To(BeEmpty())
+		Expect(cacheState()).To(Equal("fresh"))
+		Expect(held.Calls()).To(Equal(1))
+
+		clock.Advance(30 * time.Second)
+		for range 3 {
+			Expect(cacheState()).To(Equal("stale"))
+			Expect(doQuery(se, "lion").Status).To(Equal(http.StatusOK))
+		}
+		Eventually(held.Calls).Should(Equal(2))
+
+		close(held.release)
+		Eventually(cacheState).Should(Equal("fresh"))
+		Consistently(held.Calls, 100*time.Millisecond).Should(Equal(2), "exactly one background refresh")
+
+		clock.Advance(time.Minute + time.Second)
+		Expect(cacheState()).To(BeEmpty(), "past the TTL the search is synchronous")
+		Expect(held.Calls()).To(Equal(3))
+	})
+})
+
+var _ = Describe("Negative caching", func() {
+	var (
+		se       *httptest.Server
+		eng      *searchAPI.SearchEngine
+		clock    *inkinspottest.FakeClock
+		counting *inkinspottest.FaultyStore
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		counting = inkinspottest.NewFaultyStore(vs)
+		cfg := searchAPI.Configuration{
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, NegativeTTL: 5 * time.Second, CacheBodies: true},
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+		}
+		eng = searchAPI.NewSearchEngine(cfg, is, counting, searchAPI.WithClock(clock))
+		se = httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+	})
+
+	It("serves the searches without matches from the cache", func() {
+		for range 3 {
+			res := doQuery(se, "unicorn")
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.ImageCollections).To(BeEmpty())
+		}
+		Expect(counting.Calls()).To(Equal(1))
+		Expect(eng.CacheStats().NegativeHits).To(BeEquivalentTo(2))
+	})
+
+	It("expires them sooner than the results with matches", func() {
+		doQuery(se, "unicorn")
+		doQuery(se, "lion")
+		calls := counting.Calls()
+
+		clock.Advance(6 * time.Second)
+		doQuery(se, "lion")
+		Expect(counting.Calls()).To(Equal(calls), "the matches are still cached")
+		doQuery(se, "unicorn")
+		Expect(counting.Calls()).To(Equal(calls + 1))
+	})
+
+	It("shows the ingested matches at once", func() {
+		Expect(doQuery(se, "unicorn").JSON.ImageCollections).To(BeEmpty())
+
+		status, _ := doImport(se, url.Values{"mode": {"overwrite"}}, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "U", URLs: []string{"unicorn_u.jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: "U", Subject: searchAPI.LabelSet{"unicorn": 100}},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+
+		Expect(collectionIDs(doQuery(se, "unicorn").JSON.ImageCollections)).To(Equal([]string{"U"}))
+	})
+})
+
+var _ = Describe("Cache invalidation", func() {
+	var se *httptest.Server
+
+	serve := func(invalidation string) {
+		cfg := searchAPI.Configuration{
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true, Invalidation: invalidation},
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+	}
+
+	importVector := func(id string, subject searchAPI.LabelSet) {
+		GinkgoHelper()
+		status, summary := doImport(se, url.Values{"mode": {"overwrite"}}, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: id, Subject: subject},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Imported).To(Equal(1))
+	}
+
+	cacheHit := func(query string) bool {
+		GinkgoHelper()
+		return doSearch(se, url.Values{"q": {query}, "debug_meta": {"true"}}).JSON.Meta.CacheHit
+	}
+
+	It("purges only the searches of the labels ingested", func() {
+		serve("")
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+		Expect(collectionIDs(doQuery(se, "tiger").JSON.ImageCollections)).To(Equal([]string{"Z"}))
+
+		importVector("W", searchAPI.LabelSet{"lion": 100})
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(ContainElement("W"))
+		Expect(cacheHit("tiger")).To(BeTrue(), "tiger shares no label with the write")
+	})
+
+	It("purges the searches of the labels an update replaces", func() {
+		serve(searchAPI.CacheInvalidateTargeted)
+		doQuery(se, "lion")
+		doQuery(se, "tiger")
+
+		importVector("X", searchAPI.LabelSet{"tiger": 100})
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(Equal([]string{"Y"}))
+		Expect(collectionIDs(doQuery(se, "tiger").JSON.ImageCollections)).To(ConsistOf("X", "Z"))
+	})
+
+	It("purges everything in the flush mode", func() {
+		serve(searchAPI.CacheInvalidateFlush)
+		doQuery(se, "lion")
+		doQuery(se, "tiger")
+
+		importVector("W", searchAPI.LabelSet{"lion": 100})
+		Expect(cacheHit("tiger")).To(BeFalse())
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(ContainElement("W"))
+	})
+})
+
+// recordingImageStore records the IDs of every lookup.
+type recordingImageStore struct {
+	*inkinspottest.FakeImageStore
+	mu      sync.Mutex
+	lookups [][]string
+}
+
+func (s *recordingImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	s.mu.Lock()
+	s.lookups = append(s.lookups, slices.Clone(ids))
+	s.mu.Unlock()
+
+	return s.FakeImageStore.GetTattoosByID(ctx, ids)
+}
+
+// last returns the IDs of the last lookup, sorted.
+func (s *recordingImageStore) last() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.lookups) == 0 {
+		return nil
+	}
+	return slices.Sorted(slices.Values(s.lookups[len(s.lookups)-1]))
+}
+
+var _ = Describe("Collection caching", func() {
+	var (
+		se       *httptest.Server
+		clock    *inkinspottest.FakeClock
+		recorder *recordingImageStore
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		recorder = &recordingImageStore{FakeImageStore: is}
+		cfg := searchAPI.Configuration{
+			CachePolicy: searchAPI.CachePolicy{CollectionTTL: time.Minute},
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, recorder, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	It("fetches only the IDs not cached by an earlier search", func() {
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+		Expect(recorder.last()).To(Equal([]string{"X", "Y"}))
+
+		Expect(collectionIDs(doQuery(se, "chest").JSON.ImageCollections)).To(ConsistOf("X", "Z"))
+		Expect(recorder.last()).To(Equal([]string{"Z"}))
+
+		lookups := len(recorder.lookups)
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(Equal([]string{"X", "Y"}), "in ranking order")
+		Expect(recorder.lookups).To(HaveLen(lookups), "every ID is cached")
+	})
+
+	It("fetches the collections again once written", func() {
+		doQuery(se, "lion")
+		status, _ := doImport(se, url.Values{"mode": {"overwrite"}}, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "X", URLs: []string{"lion_x_v2.jpg"}},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+
+		res := doQuery(se, "lion")
+		Expect(recorder.last()).To(Equal([]string{"X"}))
+		Expect(res.JSON.ImageCollections[0].URLs).To(Equal([]string{"lion_x_v2.jpg"}))
+	})
+
+	It("fetches the collections again once expired", func() {
+		doQuery(se, "lion")
+		clock.Advance(time.Minute + time.Second)
+		doQuery(se, "lion")
+		Expect(recorder.lookups).To(HaveLen(2))
+		Expect(recorder.last()).To(Equal([]string{"X", "Y"}))
+	})
+})
@@ -0,0 +1,263 @@
+package inkinspot
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// marshalCanonical encodes v as JSON in the canonical form of the API responses.
+// It follows the json tags, except that the object keys are sorted,
+// nil slices are [] & nil maps are {}. Nil pointers remain null.
+// The label sets are objects, see LabelSet.MarshalJSON.
+func marshalCanonical(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := (canonicalEncoder{}).encode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+var (
+	marshalerType     = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	labelSetType      = reflect.TypeFor[LabelSet]()
+)
+
+// canonicalEncoder writes the canonical JSON, its label sets in the compact form when compactLabels is set.
+type canonicalEncoder struct {
+	compactLabels bool
+}
+
+// encode appends the canonical JSON of the value to the buffer.
+func (e canonicalEncoder) encode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	t := v.Type()
+	// a nil label set is an empty one, as every nil map.
+	if t == labelSetType {
+		b, err := v.Interface().(LabelSet).appendJSON(buf.AvailableBuffer(), e.compactLabels)
+		buf.Write(b)
+		return err
+	}
+	if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface &&
+		(t.Implements(marshalerType) || t.Implements(textMarshalerType)) {
+		return e.encodeMarshaled(buf, v.Interface())
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return e.encode(buf, v.Elem())
+	case reflect.Struct:
+		return e.encodeStruct(buf, v)
+	case reflect.Map:
+		return e.encodeMap(buf, v)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return encodeScalar(buf, v.Interface())
+		}
+		if v.IsNil() {
+			buf.WriteString("[]")
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		buf.WriteByte('[')
+		for i := range v.Len() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := e.encode(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	default:
+		return encodeScalar(buf, v.Interface())
+	}
+}
+
+// encodeScalar appends the value as encoding/json does.
+func encodeScalar(buf *bytes.Buffer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+
+	return nil
+}
+
+// encodeMarshaled appends the canonical form of the JSON of a json or text marshaler.
+func (e canonicalEncoder) encodeMarshaled(buf *bytes.Buffer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return err
+	}
+
+	return e.encode(buf, reflect.ValueOf(generic))
+}
+
+func (e canonicalEncoder) encodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("canonical json: unsupported map key type %s", v.Type().Key())
+	}
+
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeScalar(buf, k.String()); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := e.encode(buf, v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func (e canonicalEncoder) encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	first := true
+	for _, f := range canonicalFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if err := encodeScalar(buf, f.name); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := e.encode(buf, fv); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+
+	return nil
+}
+
+// canonicalField is an encoded field of a struct.
+type canonicalField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// fieldCache holds the fields of the struct types by their type.
+var fieldCache sync.Map
+
+// canonicalFields returns the encoded fields of the struct type sorted by name.
+// The fields of embedded structs without a json name are promoted, like encoding/json does.
+func canonicalFields(t reflect.Type) []canonicalField {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]canonicalField)
+	}
+
+	var fields []canonicalField
+	seen := make(map[string]bool)
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			idx := append(slices.Clone(index), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				collect(ft, idx)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = sf.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fields = append(fields, canonicalField{name: name, index: idx, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+		}
+	}
+	collect(t, nil)
+
+	slices.SortFunc(fields, func(a, b canonicalField) int { return strings.Compare(a.name, b.name) })
+	fieldCache.Store(t, fields)
+
+	return fields
+}
+
+// fieldByIndex returns the nested field, false when it's behind a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// isEmptyValue reports whether the value is empty by the omitempty rule of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+
+	return false
+}
@@ -0,0 +1,204 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Catalog listing limits, of the collections per page.
+const (
+	defaultCatalogLimit = 50
+	maxCatalogLimit     = exportPageSize
+)
+
+// CatalogOptions filter & page the catalog listing.
+type CatalogOptions struct {
+	// ArtistID keeps the collections of the artist.
+	ArtistID string
+	// Hidden keeps the hidden collections when true, the served ones when false, both when nil.
+	Hidden *bool
+	// CreatedAfter keeps the collections with a vector created after it, when it's not zero.
+	CreatedAfter time.Time
+	// IncludeVectors inlines the vectors of the collections.
+	IncludeVectors bool
+	// Limit is the number of collections of a page, 50 when it's zero.
+	Limit int
+	// Cursor resumes after the page it was issued for.
+	Cursor string
+}
+
+// key identifies the filters, the cursors are only valid for the same ones.
+func (o CatalogOptions) key() string {
+	hidden := ""
+	if o.Hidden != nil {
+		hidden = strconv.FormatBool(*o.Hidden)
+	}
+
+	return fmt.Sprintf("catalog|%s|%s|%d", o.ArtistID, hidden, o.CreatedAfter.UnixNano())
+}
+
+// CatalogPage is a page of the catalog listing ordered by ID.
+type CatalogPage struct {
+	Records []ExportRecord `json:"records"`
+	// NextCursor resumes after the page, empty when there are no more.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Catalog lists the collections of the image store matching the filters, a page at a time.
+// The cursors hold the last ID, collections added while paging show up when they sort after it.
+func (e *SearchEngine) Catalog(ctx context.Context, opts CatalogOptions) (CatalogPage, error) {
+	lister, ok := storeAs[CollectionLister](e.imageStore)
+	if !ok {
+		return CatalogPage{}, ErrExportUnsupported
+	}
+	if opts.Limit < 0 || opts.Limit > maxCatalogLimit {
+		return CatalogPage{}, fmt.Errorf("%w: limit must be within [1, %d]", ErrInvalidCatalogFilter, maxCatalogLimit)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultCatalogLimit
+	}
+
+	fingerprint := searchFingerprint(opts.key())
+	var after searchCursor
+	if opts.Cursor != "" {
+		c, err := decodeCursor(e.configuration.CursorPolicy.Secret, opts.Cursor, fingerprint)
+		if err != nil {
+			return CatalogPage{}, err
+		}
+		after = c
+	}
+
+	var lookup VectorLookup
+	if opts.IncludeVectors || !opts.CreatedAfter.IsZero() {
+		lookup, _ = storeAs[VectorLookup](e.vectorStore)
+	}
+
+	out := CatalogPage{Records: []ExportRecord{}}
+	cursor, lastPage := after.Page, after.Page
+	for {
+		if err := ctx.Err(); err != nil {
+			return CatalogPage{}, err
+		}
+
+		page, next, err := e.listCollections(ctx, lister, cursor)
+		if err != nil {
+			return CatalogPage{}, err
+		}
+
+		vectors, err := e.lookupVectors(ctx, lookup, page)
+		if err != nil {
+			return CatalogPage{}, err
+		}
+
+		for _, c := range page {
+			if after.ID != "" && c.ID <= after.ID {
+				continue
+			}
+			rec, ok := opts.match(c, vectors)
+			if !ok {
+				continue
+			}
+
+			if len(out.Records) == opts.Limit {
+				last := out.Records[len(out.Records)-1].Collection.ID
+				out.NextCursor = encodeCursor(e.configuration.CursorPolicy.Secret, searchCursor{Search: fingerprint, ID: last, Page: lastPage})
+				return out, nil
+			}
+			out.Records = append(out.Records, rec)
+			lastPage = cursor
+		}
+
+		if next == "" {
+			return out, nil
+		}
+		cursor = next
+	}
+}
+
+// match returns the record of the collection when it passes the filters.
+func (o CatalogOptions) match(c TattooImagesCollection, vectors map[string]TattooImagesVector) (ExportRecord, bool) {
+	if o.ArtistID != "" && c.ArtistID != o.ArtistID {
+		return ExportRecord{}, false
+	}
+	if o.Hidden != nil && c.Hidden != *o.Hidden {
+		return ExportRecord{}, false
+	}
+
+	v, ok := vectors[c.ID]
+	if !o.CreatedAfter.IsZero() && (!ok || !v.CreatedAt.After(o.CreatedAfter)) {
+		return ExportRecord{}, false
+	}
+
+	rec := ExportRecord{Collection: c}
+	if ok && o.IncludeVectors {
+		rec.Vector = &v
+	}
+
+	return rec, true
+}
+
+// parseCatalogOptions reads the options of the query string.
+func parseCatalogOptions(r *http.Request) (CatalogOptions, error) {
+	q := r.URL.Query()
+	opts := CatalogOptions{ArtistID: q.Get("artist"), Cursor: q.Get("cursor")}
+
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return CatalogOptions{}, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidCatalogFilter)
+		}
+		opts.Limit = n
+	}
+	if raw := q.Get("hidden"); raw != "" {
+		hidden, err := strconv.ParseBool(raw)
+		if err != nil {
+			return CatalogOptions{}, fmt.Errorf("%w: hidden must be true or false", ErrInvalidCatalogFilter)
+		}
+		opts.Hidden = &hidden
+	}
+	if raw := q.Get("created_after"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return CatalogOptions{}, fmt.Errorf("%w: created_after must be an RFC 3339 timestamp", ErrInvalidCatalogFilter)
+		}
+		opts.CreatedAfter = t
+	}
+	switch include := q.Get("include"); include {
+	case "":
+	case "vector":
+		opts.IncludeVectors = true
+	default:
+		return CatalogOptions{}, fmt.Errorf("%w: unknown include %q", ErrInvalidCatalogFilter, include)
+	}
+
+	return opts, nil
+}
+
+// handleCatalog lists the raw catalog, hidden collections included.
+func handleCatalog(se *SearchEngine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseCatalogOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+			return
+		}
+
+		page, err := se.Catalog(r.Context(), opts)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, page)
+		case errors.Is(err, ErrInvalidCatalogFilter):
+			writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		case errors.Is(err, ErrInvalidCursor):
+			writeError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+		case errors.Is(err, ErrExportUnsupported):
+			writeError(w, http.StatusNotImplemented, "catalog_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "listing the catalog failed")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doCatalog returns a page of the catalog listing with the params.
+func doCatalog(se *httptest.Server, token string, params url.Values) (int, searchAPI.CatalogPage) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/tattoos?"+params.Encode(), nil)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var page searchAPI.CatalogPage
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&page)).To(Succeed())
+	}
+
+	return resp.StatusCode, page
+}
+
+// catalogIDs returns the IDs of the records of the page.
+func catalogIDs(page searchAPI.CatalogPage) []string {
+	ids := make([]string, 0, len(page.Records))
+	for _, rec := range page.Records {
+		ids = append(ids, rec.Collection.ID)
+	}
+
+	return ids
+}
+
+var _ = Describe("Catalog listing", func() {
+	var (
+		se     *httptest.Server
+		is     *searchAPI.MemoryImageStore
+		cutoff time.Time
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+
+		// t0 to t9, the even ones by Ada, every third hidden & the ones past t5 created after the cutoff.
+		cutoff = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := range 10 {
+			id := fmt.Sprintf("t%d", i)
+			artist := "Bo"
+			if i%2 == 0 {
+				artist = "Ada"
+			}
+			createdAt := cutoff.Add(-time.Hour)
+			if i > 5 {
+				createdAt = cutoff.Add(time.Hour)
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{
+				ID: id, URLs: []string{id + ".jpg"}, ArtistID: artist, Hidden: i%3 == 0,
+			})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{
+				ID: id, Subject: searchAPI.LabelSet{"lion": 1}, CreatedAt: createdAt,
+			})).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("requires the admin token", func() {
+		status, _ := doCatalog(se, "wrong", nil)
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("lists the whole catalog by ID, hidden collections included", func() {
+		status, page := doCatalog(se, adminToken, nil)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(catalogIDs(page)).To(Equal([]string{"t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9"}))
+		Expect(page.NextCursor).To(BeEmpty())
+		Expect(page.Records[0].Vector).To(BeNil())
+	})
+
+	It("filters by artist, hidden status & creation time", func() {
+		_, page := doCatalog(se, adminToken, url.Values{"artist": {"Ada"}})
+		Expect(catalogIDs(page)).To(Equal([]string{"t0", "t2", "t4", "t6", "t8"}))
+
+		_, page = doCatalog(se, adminToken, url.Values{"hidden": {"true"}})
+		Expect(catalogIDs(page)).To(Equal([]string{"t0", "t3", "t6", "t9"}))
+
+		_, page = doCatalog(se, adminToken, url.Values{"hidden": {"false"}, "artist": {"Bo"}})
+		Expect(catalogIDs(page)).To(Equal([]string{"t1", "t5", "t7"}))
+
+		_, page = doCatalog(se, adminToken, url.Values{"created_after": {cutoff.Format(time.RFC3339)}})
+		Expect(catalogIDs(page)).To(Equal([]string{"t6", "t7", "t8", "t9"}))
+		Expect(page.Records[0].Vector).To(BeNil())
+	})
+
+	It("inlines the vectors on include=vector", func() {
+		_, page := doCatalog(se, adminToken, url.Values{"include": {"vector"}, "limit": {"2"}})
+		Expect(page.Records).To(HaveLen(2))
+		Expect(page.Records[0].Vector).NotTo(BeNil())
+		Expect(page.Records[0].Vector.ID).To(Equal("t0"))
+		Expect(page.Records[0].Vector.Subject).To(HaveKey("lion"))
+	})
+
+	It("pages with cursors that stay stable while collections are added", func() {
+		params := url.Values{"artist": {"Ada"}, "limit": {"2"}}
+		_, first := doCatalog(se, adminToken, params)
+		Expect(catalogIDs(first)).To(Equal([]string{"t0", "t2"}))
+		Expect(first.NextCursor).NotTo(BeEmpty())
+
+		// one sorts before the cursor & is skipped, the other after & shows up.
+		for _, id := range []string{"t1a", "t3a"} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}, ArtistID: "Ada"})).To(Succeed())
+		}
+
+		var ids []string
+		cursor := first.NextCursor
+		for cursor != "" {
+			status, page := doCatalog(se, adminToken, url.Values{"artist": {"Ada"}, "limit": {"2"}, "cursor": {cursor}})
+			Expect(status).To(Equal(http.StatusOK))
+			ids = append(ids, catalogIDs(page)...)
+			cursor = page.NextCursor
+		}
+		Expect(ids).To(Equal([]string{"t3a", "t4", "t6", "t8"}))
+	})
+
+	It("rejects a cursor of other filters", func() {
+		_, page := doCatalog(se, adminToken, url.Values{"limit": {"2"}})
+		status, _ := doCatalog(se, adminToken, url.Values{"limit": {"2"}, "artist": {"Ada"}, "cursor": {page.NextCursor}})
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+
+	It("rejects invalid filters", func() {
+		for _, params := range []url.Values{
+			{"limit": {"0"}},
+			{"limit": {"501"}},
+			{"hidden": {"maybe"}},
+			{"created_after": {"yesterday"}},
+			{"include": {"urls"}},
+		} {
+			status, _ := doCatalog(se, adminToken, params)
+			Expect(status).To(Equal(http.StatusBadRequest), params.Encode())
+		}
+	})
+})
@@ -0,0 +1,292 @@
+package inkinspot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AllowChaosEnv must be set for a ChaosPolicy to be enabled.
+const AllowChaosEnv = "ALLOW_CHAOS"
+
+// ChaosPolicy injects latency & errors into the store calls, for resilience testing.
+// It's ignored unless AllowChaosEnv is set, to keep it out of production.
+type ChaosPolicy struct {
+	Enabled bool
+	// ErrorRate is the probability of a store call failing with ErrChaos, within [0, 1].
+	ErrorRate float64
+	// Every store call is delayed by a uniform random latency within [LatencyMin, LatencyMax].
+	LatencyMin time.Duration
+	LatencyMax time.Duration
+	// Seed makes the sequence of the faults reproducible.
+	Seed int64
+}
+
+// Validate checks the policy can be enabled.
+func (p ChaosPolicy) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if os.Getenv(AllowChaosEnv) == "" {
+		return fmt.Errorf("%w: %s is not set", ErrChaosNotAllowed, AllowChaosEnv)
+	}
+	if p.ErrorRate < 0 || p.ErrorRate > 1 {
+		return fmt.Errorf("%w: error rate must be within 0 and 1", ErrInvalidChaos)
+	}
+	if p.LatencyMin < 0 || p.LatencyMax < p.LatencyMin {
+		return fmt.Errorf("%w: latency must be a range of non-negative durations", ErrInvalidChaos)
+	}
+
+	return nil
+}
+
+// ChaosStatus is the chaos injected by the engine, as reported by the admin endpoint.
+type ChaosStatus struct {
+	Enabled      bool    `json:"enabled"`
+	ErrorRate    float64 `json:"error_rate"`
+	LatencyMinMS float64 `json:"latency_min_ms"`
+	LatencyMaxMS float64 `json:"latency_max_ms"`
+	Seed         int64   `json:"seed"`
+	// Refused is why the configured chaos isn't injected.
+	Refused string `json:"refused,omitempty"`
+}
+
+// Chaos returns the chaos the engine injects into its store calls.
+func (e *SearchEngine) Chaos() ChaosStatus {
+	if e.chaos == nil {
+		return ChaosStatus{Refused: e.chaosRefused}
+	}
+
+	p := e.chaos.policy
+	return ChaosStatus{
+		Enabled:      true,
+		ErrorRate:    p.ErrorRate,
+		LatencyMinMS: milliseconds(p.LatencyMin),
+		LatencyMaxMS: milliseconds(p.LatencyMax),
+		Seed:         p.Seed,
+	}
+}
+
+// enableChaos wraps the stores of the engine in the chaos of the policy, when it's allowed.
+func (e *SearchEngine) enableChaos(p ChaosPolicy) {
+	if !p.Enabled {
+		return
+	}
+	if err := p.Validate(); err != nil {
+		slog.Error("chaos refused", "error", err)
+		e.chaosRefused = err.Error()
+		return
+	}
+
+	seed := uint64(p.Seed)
+	e.chaos = &chaos{policy: p, clock: e.clock, rand: rand.New(rand.NewPCG(seed, seed))}
+	e.imageStore = chaosImageStore{e.imageStore, e.chaos}
+	e.vectorStore = chaosVectorStore{e.vectorStore, e.chaos}
+	slog.Warn("chaos enabled", "error_rate", p.ErrorRate, "latency_min", p.LatencyMin, "latency_max", p.LatencyMax, "seed", p.Seed)
+}
+
+// chaos draws the faults of the store calls.
+type chaos struct {
+	policy ChaosPolicy
+	clock  Clock
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// inject delays the call & fails it by the policy.
+// The delay ends early with the context's error.
+func (c *chaos) inject(ctx context.Context) error {
+	c.mu.Lock()
+	fail := c.rand.Float64() < c.policy.ErrorRate
+	delay := c.policy.LatencyMin
+	if spread := c.policy.LatencyMax - c.policy.LatencyMin; spread > 0 {
+		delay += time.Duration(c.rand.Int64N(int64(spread) + 1))
+	}
+	c.mu.Unlock()
+
+	if delay > 0 {
+		t := c.clock.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if fail {
+		return ErrChaos
+	}
+
+	return nil
+}
+
+// storeDecorator is implemented by the decorators of the stores, the chaos & the validation.
+// They implement optional store interfaces, but only the ones of the wrapped store apply.
+type storeDecorator interface {
+	unwrap() any
+}
+
+// storeAs returns the store as the optional store interface T, if it implements it.
+// A decorator implements T when the store it wraps does, the wrapped store is returned when the decorator doesn't.
+func storeAs[T any](store any) (T, bool) {
+	if d, ok := store.(storeDecorator); ok {
+		inner, ok := storeAs[T](d.unwrap())
+		if !ok {
+			return inner, false
+		}
+		if t, ok := store.(T); ok {
+			return t, true
+		}
+		return inner, true
+	}
+
+	t, ok := store.(T)
+	return t, ok
+}
+
+// wrapped returns the store a decorator wraps as T, the decorators are only called for the interfaces storeAs found.
+func wrapped[T any](store any) T {
+	t, _ := storeAs[T](store)
+	return t
+}
+
+// chaosImageStore injects the chaos into the calls of an image store.
+type chaosImageStore struct {
+	store ImageStore
+	chaos *chaos
+}
+
+func (s chaosImageStore) unwrap() any { return s.store }
+
+func (s chaosImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return s.store.GetTattoosByID(ctx, ids)
+}
+
+func (s chaosImageStore) SampleTattoos(ctx context.Context, n int, at time.Time) ([]TattooImagesCollection, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[TattooSampler](s.store).SampleTattoos(ctx, n, at)
+}
+
+func (s chaosImageStore) IterateCollections(ctx context.Context) (CollectionIterator, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[CollectionIterable](s.store).IterateCollections(ctx)
+}
+
+func (s chaosImageStore) ListCollections(ctx context.Context, cursor string, limit int) ([]TattooImagesCollection, string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, "", err
+	}
+	return wrapped[CollectionLister](s.store).ListCollections(ctx, cursor, limit)
+}
+
+func (s chaosImageStore) HiddenIDs(ctx context.Context, ids []string, at time.Time) ([]string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[HiddenFilter](s.store).HiddenIDs(ctx, ids, at)
+}
+
+func (s chaosImageStore) AddCollection(ctx context.Context, c TattooImagesCollection) error {
+	if err := s.chaos.inject(ctx); err != nil {
+		return err
+	}
+	return wrapped[CollectionWriter](s.store).AddCollection(ctx, c)
+}
+
+func (s chaosImageStore) WaitForVersion(ctx context.Context, token ConsistencyToken) error {
+	if err := s.chaos.inject(ctx); err != nil {
+		return err
+	}
+	return wrapped[VersionWaiter](s.store).WaitForVersion(ctx, token)
+}
+
+// chaosVectorStore injects the chaos into the calls of a vector store.
+type chaosVectorStore struct {
+	store VectorStore
+	chaos *chaos
+}
+
+func (s chaosVectorStore) unwrap() any { return s.store }
+
+func (s chaosVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return s.store.GetIDsByQuery(ctx, query)
+}
+
+func (s chaosVectorStore) GetVectorsByID(ctx context.Context, ids []string) ([]TattooImagesVector, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[VectorLookup](s.store).GetVectorsByID(ctx, ids)
+}
+
+func (s chaosVectorStore) CountIDsByQuery(ctx context.Context, query string) (int, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return 0, err
+	}
+	return wrapped[IDCounter](s.store).CountIDsByQuery(ctx, query)
+}
+
+func (s chaosVectorStore) GetIDsByQueryPage(ctx context.Context, query string, cursor string, limit int) ([]string, string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, "", err
+	}
+	return wrapped[VectorStorePager](s.store).GetIDsByQueryPage(ctx, query, cursor, limit)
+}
+
+func (s chaosVectorStore) GetIDsByLabels(ctx context.Context, facet string, labels []string) ([]string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[LabelIndex](s.store).GetIDsByLabels(ctx, facet, labels)
+}
+
+func (s chaosVectorStore) SuggestTerms(ctx context.Context, term string, maxDistance int) ([]TermSuggestion, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, err
+	}
+	return wrapped[TermSuggester](s.store).SuggestTerms(ctx, term, maxDistance)
+}
+
+func (s chaosVectorStore) AddVector(ctx context.Context, v TattooImagesVector) error {
+	if err := s.chaos.inject(ctx); err != nil {
+		return err
+	}
+	return wrapped[VectorWriter](s.store).AddVector(ctx, v)
+}
+
+func (s chaosVectorStore) ListVectorIDs(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+	if err := s.chaos.inject(ctx); err != nil {
+		return nil, "", err
+	}
+	return wrapped[VectorLister](s.store).ListVectorIDs(ctx, cursor, limit)
+}
+
+func (s chaosVectorStore) WaitForVersion(ctx context.Context, token ConsistencyToken) error {
+	if err := s.chaos.inject(ctx); err != nil {
+		return err
+	}
+	return wrapped[VersionWaiter](s.store).WaitForVersion(ctx, token)
+}
+
+// handleChaos reports the chaos injected by the engine.
+func handleChaos(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.Chaos())
+	})
+}
@@ -0,0 +1,129 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chaos mode", func() {
+	policy := searchAPI.ChaosPolicy{Enabled: true, ErrorRate: 0.25, Seed: 42}
+
+	newChaosEngine := func(p searchAPI.ChaosPolicy, opts ...searchAPI.SearchEngineOption) *searchAPI.SearchEngine {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		for _, tc := range inkinspottest.BigCats {
+			Expect(is.AddCollection(context.Background(), tc.Collection)).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{ChaosPolicy: p, AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		return searchAPI.NewSearchEngine(cfg, is, searchAPI.NewMemoryVectorStore(), opts...)
+	}
+
+	// outcomes returns whether each of n discover calls failed with ErrChaos.
+	outcomes := func(eng *searchAPI.SearchEngine, n int) []bool {
+		GinkgoHelper()
+		out := make([]bool, n)
+		for i := range out {
+			_, err := eng.Discover(context.Background(), 3)
+			if err != nil {
+				Expect(err).To(MatchError(searchAPI.ErrChaos))
+			}
+			out[i] = errors.Is(err, searchAPI.ErrChaos)
+		}
+		return out
+	}
+
+	When("ALLOW_CHAOS is set", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv(searchAPI.AllowChaosEnv, "1")
+		})
+
+		It("fails the store calls at about the error rate", func() {
+			const calls = 4000
+			failed := 0
+			for _, f := range outcomes(newChaosEngine(policy), calls) {
+				if f {
+					failed++
+				}
+			}
+
+			Expect(float64(failed) / calls).To(BeNumerically("~", policy.ErrorRate, 0.03))
+		})
+
+		It("fails the same calls given the same seed", func() {
+			Expect(outcomes(newChaosEngine(policy), 200)).To(Equal(outcomes(newChaosEngine(policy), 200)))
+		})
+
+		It("delays the store calls within the latency range", func() {
+			clock := inkinspottest.NewFakeClock(time.Now())
+			p := searchAPI.ChaosPolicy{Enabled: true, LatencyMin: 10 * time.Millisecond, LatencyMax: 20 * time.Millisecond}
+			eng := newChaosEngine(p, searchAPI.WithClock(clock))
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := eng.Discover(context.Background(), 3)
+				done <- err
+			}()
+
+			// the image store timeout & the chaos delay.
+			Eventually(clock.Waiters).Should(Equal(2))
+			clock.Advance(p.LatencyMin - time.Millisecond)
+			Consistently(done, 20*time.Millisecond).ShouldNot(Receive())
+
+			clock.Advance(p.LatencyMax - p.LatencyMin + time.Millisecond)
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("reports the chaos on the admin endpoint", func() {
+			srv := httptest.NewServer(searchAPI.NewHandler(newChaosEngine(searchAPI.ChaosPolicy{
+				Enabled:    true,
+				ErrorRate:  0.1,
+				LatencyMin: 5 * time.Millisecond,
+				LatencyMax: 50 * time.Millisecond,
+				Seed:       7,
+			})))
+			DeferCleanup(srv.Close)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/admin/chaos", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			resp, err := srv.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			var status searchAPI.ChaosStatus
+			Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+			Expect(status).To(Equal(searchAPI.ChaosStatus{Enabled: true, ErrorRate: 0.1, LatencyMinMS: 5, LatencyMaxMS: 50, Seed: 7}))
+		})
+
+		DescribeTable("rejects invalid policies",
+			func(p searchAPI.ChaosPolicy) {
+				Expect(p.Validate()).To(MatchError(searchAPI.ErrInvalidChaos))
+			},
+			Entry("negative error rate", searchAPI.ChaosPolicy{Enabled: true, ErrorRate: -0.1}),
+			Entry("error rate above 1", searchAPI.ChaosPolicy{Enabled: true, ErrorRate: 1.5}),
+			Entry("negative latency", searchAPI.ChaosPolicy{Enabled: true, LatencyMin: -time.Second}),
+			Entry("inverted latency range", searchAPI.ChaosPolicy{Enabled: true, LatencyMin: time.Second, LatencyMax: time.Millisecond}),
+		)
+	})
+
+	It("refuses to enable without ALLOW_CHAOS", func() {
+		GinkgoT().Setenv(searchAPI.AllowChaosEnv, "")
+		Expect(policy.Validate()).To(MatchError(searchAPI.ErrChaosNotAllowed))
+
+		eng := newChaosEngine(policy)
+		Expect(eng.Chaos().Enabled).To(BeFalse())
+		Expect(eng.Chaos().Refused).To(ContainSubstring(searchAPI.AllowChaosEnv))
+		Expect(outcomes(eng, 100)).NotTo(ContainElement(true))
+	})
+})
@@ -0,0 +1,36 @@
+package inkinspot
+
+import (
+	"context"
+	"time"
+
+	"github.com/DanyPops/inkinspot/timeoutx"
+)
+
+// Clock tells the time & runs the timers of the engine.
+// The engine uses the real clock unless it's given another with WithClock.
+type Clock = timeoutx.Clock
+
+// Timer is a single event of a Clock, as time.Timer is of the real clock.
+type Timer = timeoutx.Timer
+
+// SearchEngineOption configures a search engine.
+type SearchEngineOption func(*SearchEngine)
+
+// WithClock sets the clock of the timeouts, the timings & the freshness of the engine.
+func WithClock(c Clock) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.clock = c
+	}
+}
+
+// WithTightTimeout returns a child context that expires at the earlier of (now + d) and the parent's deadline.
+// It's timeoutx.WithTightTimeout on the real clock.
+func WithTightTimeout(parent context.Context, duration time.Duration) (context.Context, context.CancelFunc) {
+	return timeoutx.WithTightTimeout(parent, duration)
+}
+
+// withTightTimeout is WithTightTimeout on the clock of the engine.
+func (e *SearchEngine) withTightTimeout(parent context.Context, duration time.Duration, opts ...timeoutx.Option) (context.Context, context.CancelFunc) {
+	return timeoutx.WithTightTimeout(parent, duration, append(opts, timeoutx.WithClock(e.clock))...)
+}
@@ -0,0 +1,163 @@
+// Command inkinspot-bench replays a query log against the search engine & reports its performance.
+//
+// The searches are served in process from a catalog export, or by a running server with -url.
+// The JSON report is compared to a baseline report with -baseline, the command fails on a regression.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run replays the query log by the flags & writes the report to stdout, or the -out file.
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("inkinspot-bench", flag.ContinueOnError)
+	catalog := fs.String("catalog", "", "NDJSON export the in-process stores are loaded from")
+	queries := fs.String("queries", "", "query log to replay, access log lines or a query per line")
+	target := fs.String("url", "", "base URL of a running server to replay against, in process when empty")
+	qps := fs.Float64("qps", 0, "rate the queries are sent at, as fast as the workers go when 0")
+	workers := fs.Int("workers", 8, "queries in flight at once")
+	requests := fs.Int("requests", 0, "queries sent, cycling through the log, the log once when 0")
+	baseline := fs.String("baseline", "", "report of a previous run the metrics are compared to")
+	threshold := fs.Float64("threshold", 0.1, "growth of a metric over the baseline which fails the run, as a fraction")
+	out := fs.String("out", "-", "file the JSON report is written to, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *queries == "" {
+		return errors.New("-queries is required")
+	}
+
+	queryLog, err := loadQueryLog(*queries)
+	if err != nil {
+		return err
+	}
+
+	var t inkinspot.ReplayTarget
+	if *target != "" {
+		t = inkinspot.URLTarget(*target, nil)
+	} else {
+		if *catalog == "" {
+			return errors.New("-catalog is required in process")
+		}
+		engine, err := loadEngine(*catalog)
+		if err != nil {
+			return err
+		}
+		t = inkinspot.HandlerTarget(inkinspot.NewHandler(engine))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := inkinspot.Replay(ctx, t, queryLog, inkinspot.ReplayPolicy{QPS: *qps, Workers: *workers, Requests: *requests})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	if *baseline != "" {
+		base, err := loadReport(*baseline)
+		if err != nil {
+			return err
+		}
+		report.Regressions = inkinspot.CompareReplay(base, report, *threshold)
+	}
+
+	if err := writeReport(*out, stdout, report); err != nil {
+		return err
+	}
+	if n := len(report.Regressions); n > 0 {
+		return fmt.Errorf("%d metrics regressed over the baseline by more than %.0f%%", n, *threshold*100)
+	}
+
+	return nil
+}
+
+// loadQueryLog parses the query log file.
+func loadQueryLog(path string) ([]url.Values, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	queries, err := inkinspot.ParseQueryLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return queries, nil
+}
+
+// loadEngine imports the catalog export into in-memory stores, searched with the default configuration.
+func loadEngine(path string) (*inkinspot.SearchEngine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := inkinspot.DefaultConfiguration()
+	is := inkinspot.NewMemoryImageStore()
+	vs := inkinspot.NewMemoryVectorStore(inkinspot.WithLabelAnalyzer(cfg.LabelAnalyzer()))
+	engine := inkinspot.NewSearchEngine(cfg, is, vs)
+	summary, err := engine.Import(context.Background(), f, inkinspot.ImportOptions{Mode: inkinspot.ImportOverwrite})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if summary.Failed > 0 {
+		first := summary.Failures[0]
+		return nil, fmt.Errorf("%s: %d invalid records, line %d: %s", path, summary.Failed, first.Line, first.Reason)
+	}
+
+	return engine, nil
+}
+
+// loadReport reads the report of a previous run.
+func loadReport(path string) (inkinspot.ReplayReport, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return inkinspot.ReplayReport{}, err
+	}
+	var report inkinspot.ReplayReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		return inkinspot.ReplayReport{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return report, nil
+}
+
+// writeReport writes the report as indented JSON to the file, or stdout for -.
+func writeReport(path string, stdout io.Writer, report inkinspot.ReplayReport) error {
+	if path == "-" {
+		return encodeReport(stdout, report)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(encodeReport(f, report), f.Close())
+}
+
+func encodeReport(w io.Writer, report inkinspot.ReplayReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(report)
+}
@@ -0,0 +1,342 @@
+// Command inkinspot serves the tattoo search API over in-memory stores.
+//
+// Subcommands:
+//
+//	inkinspot restore   posts an NDJSON export to a running server
+//	inkinspot migrate   copies a catalog between stores
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			if err := runRestore(os.Args[2:], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "migrate":
+			if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	addr := flag.String("addr", ":8080", "address the HTTP server listens on")
+	settingsPath := flag.String("settings", "", "JSON file the runtime settings are loaded from & saved to")
+	snapshotPath := flag.String("snapshot", "", "file the stores are restored from on boot & saved to periodically")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "interval between the store snapshots")
+	tlsCert := flag.String("tls-cert", "", "certificate file to serve HTTPS with, reloaded on SIGHUP")
+	tlsKey := flag.String("tls-key", "", "key file of the HTTPS certificate, reloaded on SIGHUP")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA file the client certificates are verified against")
+	tlsRequireClient := flag.Bool("tls-require-client-cert", false, "turn away the clients without a verified certificate")
+	cacheTTL := flag.Duration("cache-ttl", 0, "how long the search results are cached, no cache when 0")
+	warmup := flag.String("warmup", "", "comma separated queries searched at startup to warm the cache")
+	benchmarkQueries := flag.String("benchmark-queries", "", "query log the ranking diffs are run on, access log lines or a query per line")
+	speculate := flag.Bool("speculate", false, "prefetch the collections a repeated search found last time alongside its vector query")
+	fallbackMaxAge := flag.Duration("fallback-max-age", 0, "how old the last good results served while the vector store fails may be, no fallback when 0")
+	accessLog := flag.String("access-log", "", "file the JSON access log is appended to, - for stdout, none when empty")
+	logQueries := flag.String("log-queries", "full", "how the queries are recorded in the logs: full, hashed or none")
+	maxConns := flag.Int("max-conns", 0, "connections open at once, no limit when 0")
+	maxInFlight := flag.Int("max-in-flight", 256, "requests served at once before the rest are shed, negative for no limit")
+	chaos := flag.Bool("chaos", false, "inject store latency & errors, requires ALLOW_CHAOS")
+	chaosErrorRate := flag.Float64("chaos-error-rate", 0, "probability of a store call failing in chaos mode")
+	chaosLatencyMin := flag.Duration("chaos-latency-min", 0, "least latency added to a store call in chaos mode")
+	chaosLatencyMax := flag.Duration("chaos-latency-max", 0, "most latency added to a store call in chaos mode")
+	chaosSeed := flag.Int64("chaos-seed", 0, "seed of the chaos mode faults")
+	seed := flag.Bool("seed", false, "write the embedded sample catalog to the stores on boot")
+	seedFile := flag.String("seed-file", "", "fixture catalog written to the stores on boot, an export as NDJSON or a JSON array")
+	canaryQuery := flag.String("canary-query", "", "query the startup self check searches, only the stores are pinged when empty")
+	canaryMinResults := flag.Int("canary-min-results", 1, "collections the canary query must find for the server to be ready")
+	webhookPartners := flag.String("webhook-partners", "", "JSON file of the webhook partners by name, their secrets & field mappings, no webhook when empty")
+	webhookReplayWindow := flag.Duration("webhook-replay-window", 5*time.Minute, "how far the timestamp of a webhook delivery may be from now")
+	compactLabels := flag.Bool("compact-labels", false, "offer the label sets as arrays of pairs to the clients accepting "+inkinspot.MediaTypeCompactJSON)
+	zeroResultThreshold := flag.Float64("zero-result-threshold", 0.5, "ratio of the searches without results an incident fires at")
+	zeroResultFor := flag.Duration("zero-result-for", 2*time.Minute, "how long the ratio of the searches without results must stay at the threshold to alert")
+	featureLog := flag.String("feature-log", "", "file the ranking features of the searches are appended to as JSON lines, none when empty")
+	popularityBoost := flag.Float64("popularity-boost", 0, "weight of the click-through rate of the collections in their scores, no popularity when 0")
+	alertWebhook := flag.String("alert-webhook", "", "URL the alerts are posted to, they are logged when empty")
+	skipSelfCheck := flag.Bool("skip-self-check", false, "be ready without the startup self check, for bootstrapping an empty catalog")
+	flag.Parse()
+
+	cfg := inkinspot.DefaultConfiguration()
+	cfg.AdminPolicy.Token = os.Getenv("INKINSPOT_ADMIN_TOKEN")
+	cfg.AdminPolicy.SettingsPath = *settingsPath
+	cfg.SnapshotPolicy = inkinspot.SnapshotPolicy{Path: *snapshotPath, Interval: *snapshotInterval}
+	cfg.CachePolicy.TTL = *cacheTTL
+	cfg.SpeculationPolicy.Enabled = *speculate
+	if *fallbackMaxAge > 0 {
+		cfg.FallbackPolicy = inkinspot.FallbackPolicy{Enabled: true, MaxAge: *fallbackMaxAge}
+	}
+	if *warmup != "" {
+		cfg.CacheWarmup.Queries = strings.Split(*warmup, ",")
+	}
+	if *benchmarkQueries != "" {
+		queries, err := loadBenchmarkQueries(*benchmarkQueries)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.RankingDiffPolicy.Queries = queries
+	}
+	switch *accessLog {
+	case "":
+	case "-":
+		cfg.AccessLogPolicy.Writer = os.Stdout
+	default:
+		f, err := os.OpenFile(*accessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		cfg.AccessLogPolicy.Writer = f
+	}
+	cfg.SelfCheckPolicy.Query = *canaryQuery
+	cfg.SelfCheckPolicy.MinResults = *canaryMinResults
+	cfg.SelfCheckPolicy.Skip = *skipSelfCheck
+	cfg.WebhookPolicy.ReplayWindow = *webhookReplayWindow
+	if *webhookPartners != "" {
+		partners, err := loadWebhookPartners(*webhookPartners)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.WebhookPolicy.Partners = partners
+	}
+	if err := cfg.WebhookPolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	cfg.PrivacyPolicy.LogQueries = *logQueries
+	cfg.PrivacyPolicy.QueryHashKey = os.Getenv("INKINSPOT_QUERY_HASH_KEY")
+	cfg.SheddingPolicy.MaxInFlightRequests = *maxInFlight
+	cfg.ServerPolicy.MaxConnections = *maxConns
+	cfg.ZeroResultPolicy.Threshold = *zeroResultThreshold
+	cfg.ZeroResultPolicy.For = *zeroResultFor
+	cfg.RankingPolicy.PopularityBoost = *popularityBoost
+	if err := cfg.ServerPolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	cfg.TLSPolicy = inkinspot.TLSPolicy{
+		CertFile:          *tlsCert,
+		KeyFile:           *tlsKey,
+		ClientCAFile:      *tlsClientCA,
+		RequireClientCert: *tlsRequireClient,
+	}
+	if err := cfg.TLSPolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	cfg.ChaosPolicy = inkinspot.ChaosPolicy{
+		Enabled:    *chaos,
+		ErrorRate:  *chaosErrorRate,
+		LatencyMin: *chaosLatencyMin,
+		LatencyMax: *chaosLatencyMax,
+		Seed:       *chaosSeed,
+	}
+	if err := cfg.ChaosPolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.ScorePolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	is := inkinspot.NewMemoryImageStore()
+	vs := inkinspot.NewMemoryVectorStore(inkinspot.WithLabelAnalyzer(cfg.LabelAnalyzer()))
+	if p := cfg.SnapshotPolicy; p.Path != "" {
+		if err := inkinspot.LoadSnapshot(p.Path, is, vs); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *seed || *seedFile != "" {
+		if err := seedStores(*seedFile, is, vs); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var opts []inkinspot.SearchEngineOption
+	if *compactLabels {
+		opts = append(opts, inkinspot.WithResponseEncoder(inkinspot.CompactJSONEncoder))
+	}
+	if *featureLog != "" {
+		f, err := os.OpenFile(*featureLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		opts = append(opts, inkinspot.WithFeatureLogger(inkinspot.NewNDJSONFeatureLogger(f)))
+	}
+	if *alertWebhook != "" {
+		opts = append(opts, inkinspot.WithAlertHook(inkinspot.NewWebhookAlertHook(*alertWebhook, nil)))
+	}
+	engine := inkinspot.NewSearchEngine(cfg, is, vs, opts...)
+	if err := engine.LoadSettings(); err != nil {
+		log.Fatal(err)
+	}
+	if p := cfg.SnapshotPolicy; p.Path != "" {
+		if err := engine.RegisterJob(inkinspot.SnapshotJob(p, is, vs)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := engine.RegisterJob(engine.ExpiryJob()); err != nil {
+		log.Fatal(err)
+	}
+	if err := engine.RegisterJob(engine.ConsistencyJob()); err != nil {
+		log.Fatal(err)
+	}
+	// a failed self check keeps /readyz at 503 & is retried by its job.
+	if err := engine.SelfCheck(context.Background()); err != nil {
+		log.Printf("not ready: %v", err)
+	}
+	if err := engine.RegisterJob(engine.SelfCheckJob()); err != nil {
+		log.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the stores are loaded, the warmup runs while the listener accepts traffic.
+	go engine.WarmCache(context.Background())
+	if n := cfg.ServerPolicy.MaxConnections; n > 0 {
+		ln = inkinspot.LimitListener(ln, n)
+	}
+
+	srv := inkinspot.NewServer(cfg, inkinspot.NewHandler(engine))
+	engine.StartJobs()
+	stopped := make(chan struct{})
+	go func() {
+		shutdownOnSignal(srv, engine)
+		close(stopped)
+	}()
+
+	if !cfg.TLSPolicy.Enabled() {
+		log.Printf("inkinspot listening on %s", *addr)
+		serve(srv.Serve(ln), stopped)
+		return
+	}
+
+	certs, err := inkinspot.ConfigureTLS(srv, cfg.TLSPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reloadOnHangup(certs)
+
+	log.Printf("inkinspot listening on %s over TLS", *addr)
+	serve(srv.ServeTLS(ln, "", ""), stopped)
+}
+
+// loadWebhookPartners reads the webhook partners of the JSON file, by name.
+func loadWebhookPartners(path string) (map[string]inkinspot.WebhookPartner, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var partners map[string]inkinspot.WebhookPartner
+	if err := json.Unmarshal(raw, &partners); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return partners, nil
+}
+
+// loadBenchmarkQueries reads the text of the searches of the query log file.
+func loadBenchmarkQueries(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	searches, err := inkinspot.ParseQueryLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	queries := make([]string, 0, len(searches))
+	for _, params := range searches {
+		if q := params.Get("q"); q != "" {
+			queries = append(queries, q)
+		}
+	}
+
+	return queries, nil
+}
+
+// seedStores writes the fixture catalog of the file to the stores, the embedded sample when there's none.
+func seedStores(path string, is inkinspot.CollectionWriter, vs inkinspot.VectorWriter) error {
+	catalog, name := inkinspot.SampleCatalog(), "the sample catalog"
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		catalog, name = f, path
+	}
+
+	n, err := inkinspot.LoadFixtures(context.Background(), catalog, is, vs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	log.Printf("seeded %d records from %s", n, name)
+
+	return nil
+}
+
+// shutdownGrace bounds the wait for the requests & the jobs on shutdown.
+const shutdownGrace = 10 * time.Second
+
+// serve exits on the error the server ended with, unless it was shut down.
+// Then it waits for the shutdown to end.
+func serve(err error, stopped <-chan struct{}) {
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
+}
+
+// shutdownOnSignal shuts the server down on SIGINT or SIGTERM, then stops the jobs & flushes the feature log.
+func shutdownOnSignal(srv *http.Server, engine *inkinspot.SearchEngine) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	grace, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := srv.Shutdown(grace); err != nil {
+		log.Printf("shutting the server down failed: %v", err)
+	}
+	if err := engine.StopJobs(grace); err != nil {
+		log.Printf("stopping the jobs failed: %v", err)
+	}
+	if err := engine.FlushFeatures(grace); err != nil {
+		log.Printf("flushing the feature log failed: %v", err)
+	}
+}
+
+// reloadOnHangup reloads the certificate on every SIGHUP, the connections stay open.
+func reloadOnHangup(certs *inkinspot.CertReloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := certs.Reload(); err != nil {
+			log.Printf("reloading the certificate failed: %v", err)
+			continue
+		}
+		log.Printf("certificate reloaded")
+	}
+}
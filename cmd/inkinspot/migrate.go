@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/migrate"
+)
+
+// storeOpeners open the store pairs of the migrate subcommand by the scheme of their location.
+// They return a save func which persists the stores once written.
+var storeOpeners = map[string]func(location string) (migrate.StorePair, func() error, error){
+	"ndjson": openNDJSONStores,
+}
+
+// openStores opens the store pair at a scheme:location address.
+func openStores(address string) (migrate.StorePair, func() error, error) {
+	scheme, location, _ := strings.Cut(address, ":")
+	open, ok := storeOpeners[scheme]
+	if !ok {
+		return migrate.StorePair{}, nil, fmt.Errorf("%w: unknown stores %q", inkinspot.ErrMigrationUnsupported, scheme)
+	}
+
+	return open(location)
+}
+
+// openNDJSONStores loads an export file into in-memory stores.
+// Saving them writes the stores back to the file as an export.
+func openNDJSONStores(path string) (migrate.StorePair, func() error, error) {
+	is := inkinspot.NewMemoryImageStore()
+	vs := inkinspot.NewMemoryVectorStore()
+	engine := inkinspot.NewSearchEngine(inkinspot.Configuration{}, is, vs)
+
+	if err := loadNDJSON(engine, path); err != nil {
+		return migrate.StorePair{}, nil, err
+	}
+
+	save := func() error {
+		f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		enc := json.NewEncoder(f)
+		err = engine.Export(context.Background(), time.Time{}, func(rec inkinspot.ExportRecord) error { return enc.Encode(rec) }, nil)
+		if err := errors.Join(err, f.Close()); err != nil {
+			return err
+		}
+
+		return os.Rename(f.Name(), path)
+	}
+
+	return migrate.StorePair{Images: is, Vectors: vs}, save, nil
+}
+
+// loadNDJSON imports an export file through the engine, a missing file is empty.
+func loadNDJSON(engine *inkinspot.SearchEngine, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	summary, err := engine.Import(context.Background(), f, inkinspot.ImportOptions{Mode: inkinspot.ImportOverwrite})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if summary.Failed > 0 {
+		first := summary.Failures[0]
+		return fmt.Errorf("%s: %d invalid records, line %d: %s", path, summary.Failed, first.Line, first.Reason)
+	}
+
+	return nil
+}
+
+// runMigrate copies the stores at -src into the stores at -dst.
+// Stores are addressed as scheme:location, e.g. ndjson:catalog.ndjson.
+func runMigrate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	src := fs.String("src", "", "stores to copy from, as scheme:location")
+	dst := fs.String("dst", "", "stores to copy to, as scheme:location")
+	batch := fs.Int("batch", 500, "records listed from the source at once")
+	concurrency := fs.Int("concurrency", 4, "records written at once")
+	verifySample := fs.Int("verify-sample", 0, "copied records read back from the destination")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	srcStores, _, err := openStores(*src)
+	if err != nil {
+		return err
+	}
+	dstStores, saveDst, err := openStores(*dst)
+	if err != nil {
+		return err
+	}
+
+	report, err := migrate.CopyAll(context.Background(), srcStores, dstStores, migrate.MigrateOptions{
+		BatchSize:    *batch,
+		Concurrency:  *concurrency,
+		VerifySample: *verifySample,
+	})
+	if err != nil {
+		return err
+	}
+	if err := saveDst(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if report.Failed > 0 || len(report.Mismatches) > 0 {
+		return fmt.Errorf("migration incomplete: %d failed, %d mismatched", report.Failed, len(report.Mismatches))
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/httpx"
+)
+
+// runRestore posts an NDJSON export to the import endpoint of a running server.
+// The admin token is read from INKINSPOT_ADMIN_TOKEN.
+func runRestore(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	server := fs.String("server", "http://localhost:8080", "base URL of the server to restore into")
+	file := fs.String("file", "-", "NDJSON export to restore, - reads stdin")
+	mode := fs.String("mode", inkinspot.ImportSkip, "what to do with the existing IDs, skip or overwrite")
+	dryRun := fs.Bool("dry-run", false, "validate the export without writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var body io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		body = f
+	}
+
+	params := url.Values{"mode": {*mode}, "dry_run": {strconv.FormatBool(*dryRun)}}
+	req, err := http.NewRequest(http.MethodPost, *server+"/admin/import?"+params.Encode(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("INKINSPOT_ADMIN_TOKEN"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	// the import answers once the whole export is written.
+	client := httpx.NewClient(httpx.ClientPolicy{Timeout: time.Hour, ResponseHeaderTimeout: time.Hour})
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(stdout, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("restore failed: %s", resp.Status)
+	}
+
+	return nil
+}
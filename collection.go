@@ -0,0 +1,376 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MissingIDsError is returned by the image stores alongside the collections they found.
+// It lists the requested IDs they have no collection for & matches ErrCollectionNotFound.
+type MissingIDsError struct {
+	IDs []string
+}
+
+func (e *MissingIDsError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCollectionNotFound, strings.Join(e.IDs, ", "))
+}
+
+func (e *MissingIDsError) Unwrap() error {
+	return ErrCollectionNotFound
+}
+
+// foundOnly drops the not found error of an image store lookup, the found collections are a partial result.
+func foundOnly(cols []TattooImagesCollection, err error) ([]TattooImagesCollection, error) {
+	if errors.Is(err, ErrCollectionNotFound) {
+		return cols, nil
+	}
+
+	return cols, err
+}
+
+// CollectionSwapper is implemented by the image stores which can write a collection at its version.
+type CollectionSwapper interface {
+	// SwapCollection replaces the collection of the same ID while it's still at the version, ErrVersionConflict otherwise.
+	SwapCollection(ctx context.Context, c TattooImagesCollection, version uint64) error
+	// DeleteCollectionAt removes the collection of the ID while it's still at the version, ErrVersionConflict otherwise.
+	DeleteCollectionAt(ctx context.Context, id string, version uint64) error
+}
+
+// Collection returns the visible collection of the ID.
+// It returns a MissingIDsError when the image store has none or it's hidden.
+// An expired collection is missing as well, unless the policy answers ErrCollectionExpired.
+func (e *SearchEngine) Collection(ctx context.Context, id string) (TattooImagesCollection, error) {
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	cols, err := foundOnly(e.getCollections(isCtx, []string{id}))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrImageStoreTimeout, err)
+		}
+		return TattooImagesCollection{}, e.storeError(ImageStoreName, "get", err)
+	}
+
+	for _, c := range cols {
+		if c.ID != id || c.Hidden {
+			continue
+		}
+		if c.expired(e.clock.Now()) {
+			if e.configuration.ExpiryPolicy.Lookup == ExpiredGone {
+				return TattooImagesCollection{}, fmt.Errorf("%w: %s", ErrCollectionExpired, id)
+			}
+			break
+		}
+		return c, nil
+	}
+
+	return TattooImagesCollection{}, &MissingIDsError{IDs: []string{id}}
+}
+
+// storedCollection returns the collection of the ID as it's stored, bypassing the cache.
+func (e *SearchEngine) storedCollection(ctx context.Context, id string) (TattooImagesCollection, error) {
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	cols, err := foundOnly(e.lookupCollections(isCtx, []string{id}))
+	if err != nil {
+		return TattooImagesCollection{}, e.storeError(ImageStoreName, "get", err)
+	}
+	for _, c := range cols {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+
+	return TattooImagesCollection{}, &MissingIDsError{IDs: []string{id}}
+}
+
+// CreateCollection writes the collection of the record & its vector, when it has one.
+// It returns ErrCollectionExists when the image store has a collection of the ID.
+func (e *SearchEngine) CreateCollection(ctx context.Context, rec ExportRecord) (TattooImagesCollection, error) {
+	cw, ok := storeAs[CollectionWriter](e.imageStore)
+	if !ok {
+		return TattooImagesCollection{}, ErrImportUnsupported
+	}
+	vw, ok := storeAs[VectorWriter](e.vectorStore)
+	if !ok && rec.Vector != nil {
+		return TattooImagesCollection{}, ErrImportUnsupported
+	}
+	if err := validateRecord(rec); err != nil {
+		return TattooImagesCollection{}, err
+	}
+	if rec.Collection.expired(e.clock.Now()) {
+		return TattooImagesCollection{}, fmt.Errorf("%w: expired at %s", ErrInvalidRecord, rec.Collection.ExpiresAt.Format(time.RFC3339))
+	}
+
+	id := rec.Collection.ID
+	if _, err := e.storedCollection(ctx, id); !errors.Is(err, ErrCollectionNotFound) {
+		if err == nil {
+			err = fmt.Errorf("%w: %s", ErrCollectionExists, id)
+		}
+		return TattooImagesCollection{}, err
+	}
+
+	inv := e.newCacheInvalidation()
+	if rec.Vector != nil {
+		inv.addVector(*rec.Vector)
+	}
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	err := cw.AddCollection(isCtx, rec.Collection)
+	e.collections.forget(id)
+	if err != nil {
+		return TattooImagesCollection{}, e.storeError(ImageStoreName, "add", err)
+	}
+	if rec.Vector != nil {
+		vsCtx, vsCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+		defer vsCancel()
+
+		if err := vw.AddVector(vsCtx, *rec.Vector); err != nil {
+			return TattooImagesCollection{}, e.storeError(VectorStoreName, "add", err)
+		}
+		e.percolate(rec.Collection, *rec.Vector)
+	}
+	e.invalidate(inv)
+
+	return e.storedCollection(ctx, id)
+}
+
+// UpdateCollection replaces the stored collection of the same ID.
+// A non-zero version must be the stored one's, the update returns ErrVersionConflict otherwise.
+// It returns ErrVersionConflict as well when the collection is written meanwhile.
+func (e *SearchEngine) UpdateCollection(ctx context.Context, c TattooImagesCollection, version uint64) (TattooImagesCollection, error) {
+	swapper, ok := storeAs[CollectionSwapper](e.imageStore)
+	if !ok {
+		return TattooImagesCollection{}, ErrSwapUnsupported
+	}
+	if err := validateRecord(ExportRecord{Collection: c}); err != nil {
+		return TattooImagesCollection{}, err
+	}
+
+	current, err := e.storedCollection(ctx, c.ID)
+	if err != nil {
+		return TattooImagesCollection{}, err
+	}
+	if version != 0 && current.Version != version {
+		return TattooImagesCollection{}, fmt.Errorf("%w: %s is at version %d", ErrVersionConflict, c.ID, current.Version)
+	}
+
+	inv := e.newCacheInvalidation()
+	e.addStored(ctx, inv, c.ID)
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	if err := swapper.SwapCollection(isCtx, c, current.Version); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			return TattooImagesCollection{}, err
+		}
+		return TattooImagesCollection{}, e.storeError(ImageStoreName, "swap", err)
+	}
+	e.collections.forget(c.ID)
+	e.invalidate(inv)
+	c.Version = current.Version + 1
+
+	return c, nil
+}
+
+// DeleteCollection removes the collection of the ID & its vector from the stores.
+// A non-zero version must be the stored one's, the delete returns ErrVersionConflict otherwise.
+// It returns the deleted collection.
+func (e *SearchEngine) DeleteCollection(ctx context.Context, id string, version uint64) (TattooImagesCollection, error) {
+	swapper, ok := storeAs[CollectionSwapper](e.imageStore)
+	if !ok {
+		return TattooImagesCollection{}, ErrSwapUnsupported
+	}
+
+	current, err := e.storedCollection(ctx, id)
+	if err != nil {
+		return TattooImagesCollection{}, err
+	}
+	if version != 0 && current.Version != version {
+		return TattooImagesCollection{}, fmt.Errorf("%w: %s is at version %d", ErrVersionConflict, id, current.Version)
+	}
+
+	inv := e.newCacheInvalidation()
+	e.addStored(ctx, inv, id)
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	if err := swapper.DeleteCollectionAt(isCtx, id, current.Version); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			return TattooImagesCollection{}, err
+		}
+		return TattooImagesCollection{}, e.storeError(ImageStoreName, "delete", err)
+	}
+	e.collections.forget(id)
+	// the collection is gone already, an orphan vector only costs a missing match.
+	if vectors, ok := storeAs[VectorDeleter](e.vectorStore); ok {
+		vsCtx, vsCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+		defer vsCancel()
+
+		if err := vectors.DeleteVector(vsCtx, id); err != nil {
+			slog.WarnContext(ctx, "deleting the vector of the collection failed", "id", id, "error", e.storeError(VectorStoreName, "delete", err))
+		}
+	}
+	e.invalidate(inv)
+
+	return current, nil
+}
+
+// etagMatches reports whether the If-None-Match header lists the entity tag, weakly compared.
+func etagMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectionWriteError answers the error of a collection write.
+func collectionWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRecord):
+		writeError(w, http.StatusBadRequest, "invalid_collection", err.Error())
+	case errors.Is(err, ErrCollectionNotFound):
+		writeError(w, http.StatusNotFound, "collection_not_found", err.Error())
+	case errors.Is(err, ErrCollectionExists):
+		writeError(w, http.StatusConflict, "collection_exists", err.Error())
+	case errors.Is(err, ErrVersionConflict):
+		writeError(w, http.StatusPreconditionFailed, "precondition_failed", err.Error())
+	case errors.Is(err, ErrSwapUnsupported):
+		writeError(w, http.StatusNotImplemented, "update_unsupported", err.Error())
+	case errors.Is(err, ErrImportUnsupported):
+		writeError(w, http.StatusNotImplemented, "import_unsupported", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "image_store_error", "image store write failed")
+	}
+}
+
+// handleCollectionCreate writes the collection of the record posted as the body, its vector too when it has one.
+func handleCollectionCreate(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec ExportRecord
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+		rec.Collection.URLsTruncated = false
+
+		created, err := se.CreateCollection(r.Context(), rec)
+		if err != nil {
+			collectionWriteError(w, err)
+			return
+		}
+		se.recordAudit(w, r, AuditCollectionCreate, created.ID, "", fmt.Sprintf("version %d", created.Version))
+		w.Header().Set("Location", "/tattoos/"+url.PathEscape(created.ID))
+		w.Header().Set("ETag", versionETag(created.Version))
+		se.setConsistencyToken(w)
+		writeJSON(w, http.StatusCreated, Response{ImageCollections: []TattooImagesCollection{created}, Total: 1})
+	})
+}
+
+// handleCollectionUpdate replaces the collection of the ID in the path, at the version of If-Match.
+func handleCollectionUpdate(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseIfMatch(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_version", "If-Match must be the ETag of the collection")
+			return
+		}
+
+		var c TattooImagesCollection
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+		id := r.PathValue("id")
+		if c.ID != "" && c.ID != id {
+			writeError(w, http.StatusBadRequest, "invalid_collection", fmt.Sprintf("ID %q differs from the path's", c.ID))
+			return
+		}
+		c.ID, c.URLsTruncated = id, false
+
+		updated, err := se.UpdateCollection(r.Context(), c, version)
+		if err != nil {
+			collectionWriteError(w, err)
+			return
+		}
+		se.recordAudit(w, r, AuditCollectionUpdate, id, fmt.Sprintf("version %d", updated.Version-1), fmt.Sprintf("version %d", updated.Version))
+		w.Header().Set("ETag", versionETag(updated.Version))
+		se.setConsistencyToken(w)
+		writeJSON(w, http.StatusOK, Response{ImageCollections: []TattooImagesCollection{updated}, Total: 1})
+	})
+}
+
+// handleCollectionDelete removes the collection of the ID in the path, at the version of If-Match.
+func handleCollectionDelete(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseIfMatch(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_version", "If-Match must be the ETag of the collection")
+			return
+		}
+
+		deleted, err := se.DeleteCollection(r.Context(), r.PathValue("id"), version)
+		if err != nil {
+			collectionWriteError(w, err)
+			return
+		}
+		se.recordAudit(w, r, AuditCollectionDelete, deleted.ID, fmt.Sprintf("version %d", deleted.Version), "")
+		se.setConsistencyToken(w)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleCollection serves the collection of the ID in the path.
+// It answers 304 Not Modified when If-None-Match has the ETag of its version.
+func handleCollection(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := se.Collection(r.Context(), r.PathValue("id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrCollectionNotFound):
+				writeError(w, http.StatusNotFound, "collection_not_found", err.Error())
+			case errors.Is(err, ErrCollectionExpired):
+				writeError(w, http.StatusGone, "collection_expired", err.Error())
+			case errors.Is(err, ErrImageStoreTimeout):
+				writeError(w, http.StatusGatewayTimeout, "image_store_timeout", "image store timed out")
+			default:
+				writeError(w, http.StatusInternalServerError, "image_store_error", "image store get failed")
+			}
+			return
+		}
+
+		if etag := versionETag(c.Version); etag != "" {
+			w.Header().Set("ETag", etag)
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		cols := []TattooImagesCollection{c}
+		writeJSON(w, http.StatusOK, Response{ImageCollections: cols, Total: 1, Artists: se.Artists(r.Context(), cols)})
+	})
+}
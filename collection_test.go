@@ -0,0 +1,188 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collection lookup", func() {
+	// getCollection requests the collection of the ID.
+	getCollection := func(se *httptest.Server, id string) HTTPResult {
+		GinkgoHelper()
+		resp, err := se.Client().Get(se.URL + "/tattoos/" + id)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		res := HTTPResult{Status: resp.StatusCode}
+		Expect(json.NewDecoder(resp.Body).Decode(&res.JSON)).To(Succeed())
+		return res
+	}
+
+	It("serves the collection of the ID", func() {
+		se := initSearchEngineHttpServer(inkinspottest.NewFakeStores(inkinspottest.BigCats...))
+		DeferCleanup(se.Close)
+
+		res := getCollection(se, "X")
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X"}))
+	})
+
+	It("answers 404 Not Found for an unknown or hidden ID", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "H", Hidden: true})).To(Succeed())
+		se := initSearchEngineHttpServer(is, vs)
+		DeferCleanup(se.Close)
+
+		for _, id := range []string{"nope", "H"} {
+			res := getCollection(se, id)
+			Expect(res.Status).To(Equal(http.StatusNotFound))
+			Expect(res.JSON.Error.Code).To(Equal("collection_not_found"))
+		}
+	})
+
+	It("answers 500 Internal Server Error when the image store fails", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		se := initSearchEngineHttpServer(inkinspottest.NewFaultyStore(is, inkinspottest.FailEvery(1)), vs)
+		DeferCleanup(se.Close)
+
+		res := getCollection(se, "X")
+		Expect(res.Status).To(Equal(http.StatusInternalServerError))
+		Expect(res.JSON.Error.Code).To(Equal("image_store_error"))
+	})
+
+	It("reports the missing IDs of a mixed batch alongside the found collections", func() {
+		is, _ := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cols, err := is.GetTattoosByID(context.Background(), []string{"X", "nope", "Z"})
+		Expect(collectionIDs(cols)).To(Equal([]string{"X", "Z"}))
+		Expect(err).To(MatchError(searchAPI.ErrCollectionNotFound))
+		Expect(err).To(Equal(&searchAPI.MissingIDsError{IDs: []string{"nope"}}))
+	})
+
+	It("searches with the collections found when the image store misses some", func() {
+		_, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		is, _ := inkinspottest.NewFakeStores(inkinspottest.BigCats[0])
+		se := initSearchEngineHttpServer(is, vs)
+		DeferCleanup(se.Close)
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{inkinspottest.BigCats[0].Collection.ID}))
+	})
+})
+
+var _ = Describe("Collection versions", func() {
+	var (
+		se *httptest.Server
+		vs *searchAPI.MemoryVectorStore
+	)
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"lion": 90}})).To(Succeed())
+
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	// request sends the request of the collection L with the header, as admin.
+	request := func(method, header, value, body string) *http.Response {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+"/tattoos/L", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		return resp
+	}
+
+	It("answers 304 Not Modified while the ETag is current", func() {
+		resp := request(http.MethodGet, "", "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		etag := resp.Header.Get("ETag")
+		Expect(etag).To(Equal(`"1"`))
+
+		resp = request(http.MethodGet, "If-None-Match", etag, "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+		Expect(resp.Header.Get("ETag")).To(Equal(etag))
+		Expect(request(http.MethodGet, "If-None-Match", `"7", W/"1"`, "").StatusCode).To(Equal(http.StatusNotModified))
+		Expect(request(http.MethodGet, "If-None-Match", `"7"`, "").StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("updates the collection at the version of If-Match", func() {
+		Expect(doQuery(se, "lion").JSON.ImageCollections[0].URLs).To(HaveLen(1))
+
+		resp := request(http.MethodPut, "If-Match", `"1"`, `{"URLs":["l.jpg","l2.jpg"]}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("ETag")).To(Equal(`"2"`))
+
+		resp = request(http.MethodGet, "If-None-Match", `"1"`, "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var res searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&res)).To(Succeed())
+		Expect(res.ImageCollections).To(Equal([]searchAPI.TattooImagesCollection{{ID: "L", URLs: []string{"l.jpg", "l2.jpg"}, Version: 2}}))
+		Expect(doQuery(se, "lion").JSON.ImageCollections[0].URLs).To(HaveLen(2), "the cached searches are invalidated")
+	})
+
+	It("answers 412 Precondition Failed to a stale If-Match", func() {
+		Expect(request(http.MethodPut, "If-Match", `"1"`, `{"URLs":["l2.jpg"]}`).StatusCode).To(Equal(http.StatusOK))
+
+		resp := request(http.MethodPut, "If-Match", `"1"`, `{"URLs":["l3.jpg"]}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+		Expect(request(http.MethodDelete, "If-Match", `"1"`, "").StatusCode).To(Equal(http.StatusPreconditionFailed))
+		Expect(request(http.MethodGet, "", "", "").StatusCode).To(Equal(http.StatusOK))
+
+		Expect(request(http.MethodPut, "If-Match", "one", `{"URLs":["l3.jpg"]}`).StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("creates the collection & its vector of the posted record", func() {
+		create := func(body string) *http.Response {
+			GinkgoHelper()
+			req, err := http.NewRequest(http.MethodPost, se.URL+"/tattoos", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(resp.Body.Close)
+			return resp
+		}
+
+		resp := create(`{"collection": {"ID": "T", "URLs": ["t.jpg"]}, "vector": {"ID": "T", "Subject": {"tiger": 90}}}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(resp.Header.Get("Location")).To(Equal("/tattoos/T"))
+		Expect(resp.Header.Get("ETag")).To(Equal(`"1"`))
+		Expect(collectionIDs(doQuery(se, "tiger").JSON.ImageCollections)).To(Equal([]string{"T"}))
+
+		resp = create(`{"collection": {"ID": "L", "URLs": ["l2.jpg"]}}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		var res searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&res)).To(Succeed())
+		Expect(res.Error.Code).To(Equal("collection_exists"))
+		Expect(create(`{"collection": {"URLs": ["x.jpg"]}}`).StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("deletes the collection & its vector at the version of If-Match", func() {
+		Expect(request(http.MethodDelete, "If-Match", `"1"`, "").StatusCode).To(Equal(http.StatusNoContent))
+
+		Expect(request(http.MethodGet, "", "", "").StatusCode).To(Equal(http.StatusNotFound))
+		Expect(request(http.MethodDelete, "", "", "").StatusCode).To(Equal(http.StatusNotFound))
+		vectors, err := vs.GetVectorsByID(context.Background(), []string{"L"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vectors).To(BeEmpty())
+	})
+})
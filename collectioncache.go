@@ -0,0 +1,155 @@
+package inkinspot
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// collectionCache is an LRU of the image store collections by ID with a TTL.
+// It sits in front of the image store, the searches sharing IDs fetch each once.
+// A nil cache is valid and never hits.
+type collectionCache struct {
+	ttl        time.Duration
+	maxEntries int
+	clock      Clock
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type collectionEntry struct {
+	collection TattooImagesCollection
+	expires    time.Time
+}
+
+// newCollectionCache creates the collection cache of the policy, nil when it's disabled.
+func newCollectionCache(p CachePolicy, clock Clock) *collectionCache {
+	if p.CollectionTTL <= 0 {
+		return nil
+	}
+
+	return &collectionCache{
+		ttl:        p.CollectionTTL,
+		maxEntries: p.MaxCollections,
+		clock:      clock,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached collections of the IDs & the IDs left to fetch, once each.
+func (c *collectionCache) get(ids []string) ([]TattooImagesCollection, []string) {
+	if c == nil {
+		return nil, ids
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	var (
+		cached  []TattooImagesCollection
+		missing []string
+	)
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		el, ok := c.entries[id]
+		if ok && now.After(el.Value.(*collectionEntry).expires) {
+			c.remove(el)
+			ok = false
+		}
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		c.order.MoveToFront(el)
+		cached = append(cached, el.Value.(*collectionEntry).collection)
+	}
+
+	return cached, missing
+}
+
+// put caches the collections, evicting the least recently used beyond the cap.
+func (c *collectionCache) put(cols []TattooImagesCollection) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.clock.Now().Add(c.ttl)
+	for _, col := range cols {
+		if el, ok := c.entries[col.ID]; ok {
+			c.remove(el)
+		}
+		c.entries[col.ID] = c.order.PushFront(&collectionEntry{collection: col, expires: expires})
+	}
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// forget drops the collection of the ID, once it's written.
+func (c *collectionCache) forget(id string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+}
+
+// purge drops every cached collection.
+func (c *collectionCache) purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+func (c *collectionCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*collectionEntry).collection.ID)
+}
+
+// getCollections returns the collections of the IDs, the cached ones without asking the image store.
+// The others are fetched in a single batch, the errors are the image store's.
+// The consistent searches fetch all of them, the fetched ones are cached still.
+func (e *SearchEngine) getCollections(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	if e.collections == nil {
+		return e.lookupCollections(ctx, ids)
+	}
+	if consistent(ctx) {
+		fetched, err := e.lookupCollections(ctx, ids)
+		e.collections.put(fetched)
+		return fetched, err
+	}
+
+	cached, missing := e.collections.get(ids)
+	if len(missing) == 0 {
+		return cached, nil
+	}
+
+	fetched, err := e.lookupCollections(ctx, missing)
+	e.collections.put(fetched)
+
+	return append(cached, fetched...), err
+}
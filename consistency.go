@@ -0,0 +1,121 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsistencyTokenHeader carries the consistency token of a write.
+// The writes set it on their responses, the searches sending it back reflect the write.
+const ConsistencyTokenHeader = "X-Consistency-Token"
+
+// consistencyTokenPrefix versions the encoding of the tokens.
+const consistencyTokenPrefix = "v1."
+
+// ConsistencyToken marks a write, by the engine clock in nanoseconds when it was done.
+// The versions the engine issues increase, a token covers the writes done before it.
+type ConsistencyToken struct {
+	Version int64
+}
+
+// String returns the opaque form of the token sent to the clients.
+func (t ConsistencyToken) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(consistencyTokenPrefix + strconv.FormatInt(t.Version, 10)))
+}
+
+// ParseConsistencyToken decodes a token returned by String.
+func ParseConsistencyToken(raw string) (ConsistencyToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return ConsistencyToken{}, fmt.Errorf("%w: malformed", ErrInvalidConsistency)
+	}
+	version, ok := strings.CutPrefix(string(b), consistencyTokenPrefix)
+	if !ok {
+		return ConsistencyToken{}, fmt.Errorf("%w: unknown version", ErrInvalidConsistency)
+	}
+	v, err := strconv.ParseInt(version, 10, 64)
+	if err != nil || v <= 0 {
+		return ConsistencyToken{}, fmt.Errorf("%w: malformed", ErrInvalidConsistency)
+	}
+
+	return ConsistencyToken{Version: v}, nil
+}
+
+// VersionWaiter is implemented by the stores which index their writes eventually.
+// WaitForVersion returns once the store reflects the writes done before the token, or the context is done.
+type VersionWaiter interface {
+	WaitForVersion(ctx context.Context, token ConsistencyToken) error
+}
+
+// ConsistencyToken returns the token of the writes done so far.
+func (e *SearchEngine) ConsistencyToken() ConsistencyToken {
+	for {
+		last := e.writeVersion.Load()
+		next := max(e.clock.Now().UnixNano(), last+1)
+		if e.writeVersion.CompareAndSwap(last, next) {
+			return ConsistencyToken{Version: next}
+		}
+	}
+}
+
+// setConsistencyToken sets the token of the writes of the request on its response.
+func (e *SearchEngine) setConsistencyToken(w http.ResponseWriter) {
+	w.Header().Set(ConsistencyTokenHeader, e.ConsistencyToken().String())
+}
+
+// waitForVersion waits for the stores which index eventually to reflect the token, within the context.
+// The others reflect their writes at once.
+func (e *SearchEngine) waitForVersion(ctx context.Context, token ConsistencyToken) error {
+	stores := []struct {
+		name  string
+		store any
+	}{{VectorStoreName, e.vectorStore}, {ImageStoreName, e.imageStore}}
+	for _, s := range stores {
+		waiter, ok := storeAs[VersionWaiter](s.store)
+		if !ok {
+			continue
+		}
+		if err := waiter.WaitForVersion(ctx, token); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%w: %s store: %w", ErrConsistencyTimeout, s.name, err)
+			}
+			return e.storeError(s.name, "wait", err)
+		}
+	}
+
+	return nil
+}
+
+type consistentKey struct{}
+
+// consistent reports whether the search of the context bypasses the collection cache.
+func consistent(ctx context.Context) bool {
+	return ctx.Value(consistentKey{}) != nil
+}
+
+// consistentSearch searches the plan once the stores reflect its consistency token.
+// It bypasses the caches & never serves the last known good result, its fresh result is cached.
+func (e *SearchEngine) consistentSearch(ctx context.Context, plan searchPlan, start time.Time) (*SearchResult, error) {
+	token, err := ParseConsistencyToken(plan.opts.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	gen := e.cache.generation()
+	if err := e.waitForVersion(ctx, token); err != nil {
+		return nil, err
+	}
+	res, err := e.runSearch(context.WithValue(ctx, consistentKey{}, true), plan, start)
+	if err != nil {
+		return nil, err
+	}
+	e.keep(plan.key, gen, res)
+
+	return res, nil
+}
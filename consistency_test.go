@@ -0,0 +1,184 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// laggingVectorStore indexes its writes once index is called, the memory store holds the indexed ones.
+type laggingVectorStore struct {
+	*searchAPI.MemoryVectorStore
+
+	mu      sync.Mutex
+	pending []searchAPI.TattooImagesVector
+}
+
+func (s *laggingVectorStore) AddVector(ctx context.Context, v searchAPI.TattooImagesVector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, v)
+	return nil
+}
+
+func (s *laggingVectorStore) index() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.pending {
+		Expect(s.MemoryVectorStore.AddVector(context.Background(), v)).To(Succeed())
+	}
+	s.pending = nil
+}
+
+// WaitForVersion waits for every write received so far to be indexed.
+func (s *laggingVectorStore) WaitForVersion(ctx context.Context, token searchAPI.ConsistencyToken) error {
+	for {
+		s.mu.Lock()
+		indexed := len(s.pending) == 0
+		s.mu.Unlock()
+		if indexed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// importToken imports the records & returns the consistency token of the response.
+func importToken(se *httptest.Server, body string) string {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/import", strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+	return resp.Header.Get(searchAPI.ConsistencyTokenHeader)
+}
+
+// doConsistentQuery searches the query with the headers set.
+func doConsistentQuery(se *httptest.Server, query string, headers map[string]string) HTTPResult {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+"/search?"+url.Values{"q": {query}}.Encode(), nil)
+	Expect(err).NotTo(HaveOccurred())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	res := HTTPResult{Status: resp.StatusCode}
+	res.Body, err = io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	_ = json.Unmarshal(res.Body, &res.JSON)
+
+	return res
+}
+
+var _ = Describe("Read-your-writes consistency", func() {
+	lion := func(id string) searchAPI.ExportRecord {
+		return searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": 0.9}},
+		}
+	}
+
+	var (
+		vs *laggingVectorStore
+		se *httptest.Server
+	)
+
+	BeforeEach(func() {
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, NegativeTTL: time.Minute, CacheBodies: true},
+		}
+		vs = &laggingVectorStore{MemoryVectorStore: searchAPI.NewMemoryVectorStore()}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, searchAPI.NewMemoryImageStore(), vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("returns a token from the writes", func() {
+		first := importToken(se, ndjson(lion("L1")))
+		second := importToken(se, ndjson(lion("L2")))
+		Expect(first).NotTo(BeEmpty())
+		Expect(second).NotTo(Equal(first))
+
+		a, err := searchAPI.ParseConsistencyToken(first)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := searchAPI.ParseConsistencyToken(second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Version).To(BeNumerically(">", a.Version))
+	})
+
+	It("waits for the store to index the write", func() {
+		token := importToken(se, ndjson(lion("L1")))
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(BeEmpty(), "the write isn't indexed yet")
+
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(20 * time.Millisecond)
+			vs.index()
+		}()
+		res := doConsistentQuery(se, "lion", map[string]string{searchAPI.ConsistencyTokenHeader: token})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L1"}))
+	})
+
+	It("bypasses the cached searches", func() {
+		token := importToken(se, ndjson(lion("L1")))
+		// the search cached before the index caught up misses the write.
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(BeEmpty())
+		vs.index()
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(BeEmpty())
+
+		res := doConsistentQuery(se, "lion", map[string]string{searchAPI.ConsistencyTokenHeader: token})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L1"}))
+	})
+
+	It("times out when the store never reflects the write", func() {
+		token := importToken(se, ndjson(lion("L1")))
+
+		res := doConsistentQuery(se, "lion", map[string]string{
+			searchAPI.ConsistencyTokenHeader: token,
+			searchAPI.DeadlineHeader:         "50",
+		})
+		Expect(res.Status).To(Equal(http.StatusGatewayTimeout))
+		Expect(res.JSON.Error.Code).To(Equal("consistency_timeout"))
+	})
+
+	It("rejects the malformed tokens", func() {
+		res := doConsistentQuery(se, "lion", map[string]string{searchAPI.ConsistencyTokenHeader: "not a token"})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_consistency_token"))
+	})
+
+	It("reads the writes of the in-memory stores at once", func() {
+		se := initEmptyAdminServer()
+		token := importToken(se, ndjson(lion("L1")))
+
+		res := doConsistentQuery(se, "lion", map[string]string{searchAPI.ConsistencyTokenHeader: token})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"L1"}))
+	})
+})
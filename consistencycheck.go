@@ -0,0 +1,329 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// consistencyBatchSize is the number of IDs the consistency checks look up at once.
+const consistencyBatchSize = 100
+
+// ConsistencyPolicy controls the checks of the drift between the vector store & the image store.
+// Zero values are replaced by the defaults.
+type ConsistencyPolicy struct {
+	// Interval is how often the consistency job checks the stores.
+	Interval time.Duration
+	// SampleSize caps the IDs of each store checked by a run, the sample is drawn uniformly.
+	SampleSize int
+	// DeleteOrphans makes the job delete the vectors the image store doesn't know.
+	DeleteOrphans bool
+	// MissingWindow & MissingThreshold warn when the searches match more IDs the image store doesn't know within the window.
+	MissingWindow    time.Duration
+	MissingThreshold int
+}
+
+func (p ConsistencyPolicy) withDefaults() ConsistencyPolicy {
+	if p.Interval <= 0 {
+		p.Interval = time.Hour
+	}
+	if p.SampleSize <= 0 {
+		p.SampleSize = 1000
+	}
+	if p.MissingWindow <= 0 {
+		p.MissingWindow = time.Minute
+	}
+	if p.MissingThreshold <= 0 {
+		p.MissingThreshold = 20
+	}
+
+	return p
+}
+
+// VectorLister is implemented by the vector stores.
+// Which can list the IDs of all their vectors in pages ordered by ID.
+// The cursor is empty for the first page, next is empty after the last.
+type VectorLister interface {
+	ListVectorIDs(ctx context.Context, cursor string, limit int) (ids []string, next string, err error)
+}
+
+// ConsistencyReport is the outcome of a check of the stores.
+// The orphan vectors are unknown to the image store, the orphan collections have no vector.
+type ConsistencyReport struct {
+	CheckedAt             time.Time `json:"checked_at"`
+	DurationMS            float64   `json:"duration_ms"`
+	VectorsChecked        int       `json:"vectors_checked"`
+	OrphanVectorCount     int       `json:"orphan_vector_count"`
+	OrphanVectors         []string  `json:"orphan_vectors"`
+	CollectionsChecked    int       `json:"collections_checked"`
+	OrphanCollectionCount int       `json:"orphan_collection_count"`
+	OrphanCollections     []string  `json:"orphan_collections"`
+	DeletedVectors        int       `json:"deleted_vectors"`
+	// SearchMissing counts the IDs matched by the searches the image store didn't know, since the start.
+	SearchMissing uint64 `json:"search_missing"`
+}
+
+// consistencyChecks keeps the last report & counts the IDs the searches miss.
+type consistencyChecks struct {
+	policy ConsistencyPolicy
+	clock  Clock
+
+	mu   sync.Mutex
+	last *ConsistencyReport
+	// missing counts the IDs missed since windowStart, warned once it's past the threshold.
+	windowStart time.Time
+	missing     int
+	warned      bool
+	total       uint64
+}
+
+func newConsistencyChecks(p ConsistencyPolicy, clock Clock) *consistencyChecks {
+	return &consistencyChecks{policy: p, clock: clock}
+}
+
+// recordMissing counts the IDs a search matched which the image store didn't know.
+// It warns once per window when they pass the threshold.
+func (c *consistencyChecks) recordMissing(ctx context.Context, n int) {
+	if n <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if now.Sub(c.windowStart) >= c.policy.MissingWindow {
+		c.windowStart, c.missing, c.warned = now, 0, false
+	}
+	c.missing += n
+	c.total += uint64(n)
+	if c.missing >= c.policy.MissingThreshold && !c.warned {
+		c.warned = true
+		slog.WarnContext(ctx, "the vector store matches IDs the image store doesn't know", "missing", c.missing, "window", c.policy.MissingWindow)
+	}
+}
+
+// sampleIDs draws up to n of the IDs the next function streams, uniformly.
+// next returns the IDs of a page & whether there are more.
+func sampleIDs(n int, next func() ([]string, bool, error)) ([]string, error) {
+	var sample []string
+	seen := 0
+	for more := true; more; {
+		ids, m, err := next()
+		if err != nil {
+			return nil, err
+		}
+		more = m
+		for _, id := range ids {
+			seen++
+			if len(sample) < n {
+				sample = append(sample, id)
+			} else if i := rand.IntN(seen); i < n {
+				sample[i] = id
+			}
+		}
+	}
+	slices.Sort(sample)
+
+	return sample, nil
+}
+
+// CheckConsistency samples the IDs of both stores & looks them up in the other one.
+// The orphan vectors are deleted when deleteOrphans is set, the caches of their labels are purged.
+// It returns ErrConsistencyUnsupported when the vector store can't list its IDs or the image store its collections.
+func (e *SearchEngine) CheckConsistency(ctx context.Context, deleteOrphans bool) (ConsistencyReport, error) {
+	start := e.clock.Now()
+	lister, ok := storeAs[VectorLister](e.vectorStore)
+	if !ok {
+		return ConsistencyReport{}, fmt.Errorf("%w: vector store can't list", ErrConsistencyUnsupported)
+	}
+	var deleter VectorDeleter
+	if deleteOrphans {
+		if deleter, ok = storeAs[VectorDeleter](e.vectorStore); !ok {
+			return ConsistencyReport{}, fmt.Errorf("%w: vector store can't delete", ErrPurgeUnsupported)
+		}
+	}
+	policy := e.configuration.ConsistencyPolicy
+
+	cursor := ""
+	vectorIDs, err := sampleIDs(policy.SampleSize, func() ([]string, bool, error) {
+		ids, next, err := lister.ListVectorIDs(ctx, cursor, consistencyBatchSize)
+		cursor = next
+		return ids, next != "", err
+	})
+	if err != nil {
+		return ConsistencyReport{}, e.storeError(VectorStoreName, "list", err)
+	}
+
+	it, err := e.iterateCollections(ctx)
+	if errors.Is(err, ErrExportUnsupported) {
+		return ConsistencyReport{}, fmt.Errorf("%w: image store can't list", ErrConsistencyUnsupported)
+	}
+	if err != nil {
+		return ConsistencyReport{}, err
+	}
+	defer it.Close()
+	collectionIDs, err := sampleIDs(policy.SampleSize, func() ([]string, bool, error) {
+		batch, err := NextBatch(ctx, it, consistencyBatchSize)
+		if errors.Is(err, ErrIteratorDone) {
+			return nil, false, nil
+		}
+		return collectionIDsOf(batch), true, err
+	})
+	if err != nil {
+		return ConsistencyReport{}, e.storeError(ImageStoreName, "list", err)
+	}
+
+	report := ConsistencyReport{VectorsChecked: len(vectorIDs), CollectionsChecked: len(collectionIDs), OrphanVectors: []string{}, OrphanCollections: []string{}}
+	for batch := range slices.Chunk(vectorIDs, consistencyBatchSize) {
+		cols, err := foundOnly(e.lookupCollections(ctx, batch))
+		if err != nil {
+			return ConsistencyReport{}, e.storeError(ImageStoreName, "get", err)
+		}
+		report.OrphanVectors = append(report.OrphanVectors, unfound(batch, collectionIDsOf(cols))...)
+	}
+	// without lookups, the collections can't be checked for vectors.
+	if lookup, ok := storeAs[VectorLookup](e.vectorStore); ok {
+		for batch := range slices.Chunk(collectionIDs, consistencyBatchSize) {
+			vectors, err := lookup.GetVectorsByID(ctx, batch)
+			if err != nil {
+				return ConsistencyReport{}, e.storeError(VectorStoreName, "lookup", err)
+			}
+			ids := make([]string, 0, len(vectors))
+			for _, v := range vectors {
+				ids = append(ids, v.ID)
+			}
+			report.OrphanCollections = append(report.OrphanCollections, unfound(batch, ids)...)
+		}
+	} else {
+		report.CollectionsChecked = 0
+	}
+	report.OrphanVectorCount, report.OrphanCollectionCount = len(report.OrphanVectors), len(report.OrphanCollections)
+
+	if deleter != nil && len(report.OrphanVectors) > 0 {
+		inv := e.newCacheInvalidation()
+		for _, id := range report.OrphanVectors {
+			e.addStored(ctx, inv, id)
+			if err := deleter.DeleteVector(ctx, id); err != nil {
+				e.invalidate(inv)
+				return ConsistencyReport{}, e.storeError(VectorStoreName, "delete", err)
+			}
+			report.DeletedVectors++
+		}
+		e.invalidate(inv)
+	}
+	if report.OrphanVectorCount > 0 || report.OrphanCollectionCount > 0 {
+		slog.WarnContext(ctx, "the stores drifted apart", "orphan_vectors", report.OrphanVectorCount, "orphan_collections", report.OrphanCollectionCount, "deleted_vectors", report.DeletedVectors)
+	}
+
+	checks := e.consistency
+	checks.mu.Lock()
+	defer checks.mu.Unlock()
+	report.CheckedAt = start
+	report.DurationMS = milliseconds(e.clock.Now().Sub(start))
+	report.SearchMissing = checks.total
+	checks.last = &report
+
+	return report, nil
+}
+
+// collectionIDsOf returns the IDs of the collections.
+func collectionIDsOf(cols []TattooImagesCollection) []string {
+	ids := make([]string, 0, len(cols))
+	for _, c := range cols {
+		ids = append(ids, c.ID)
+	}
+
+	return ids
+}
+
+// unfound returns the IDs missing from found, in their order.
+func unfound(ids, found []string) []string {
+	known := make(map[string]bool, len(found))
+	for _, id := range found {
+		known[id] = true
+	}
+	var out []string
+	for _, id := range ids {
+		if !known[id] {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
+
+// ConsistencyReport returns the report of the last check, false when the stores weren't checked yet.
+// Its SearchMissing is counted up to now.
+func (e *SearchEngine) ConsistencyReport() (ConsistencyReport, bool) {
+	checks := e.consistency
+	checks.mu.Lock()
+	defer checks.mu.Unlock()
+
+	if checks.last == nil {
+		return ConsistencyReport{}, false
+	}
+	report := *checks.last
+	report.SearchMissing = checks.total
+
+	return report, true
+}
+
+// ConsistencyJob checks the stores every interval of the policy, deleting the orphan vectors when it's set.
+func (e *SearchEngine) ConsistencyJob() Job {
+	return Job{
+		Name:     "consistency",
+		Interval: e.configuration.ConsistencyPolicy.Interval,
+		Run: func(ctx context.Context) error {
+			_, err := e.CheckConsistency(ctx, e.configuration.ConsistencyPolicy.DeleteOrphans)
+			return err
+		},
+	}
+}
+
+// handleConsistency reports the last check of the stores on GET, checks them now on POST.
+// The POSTs delete the orphan vectors with delete_orphans=true.
+func handleConsistency(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			report, ok := se.ConsistencyReport()
+			if !ok {
+				writeError(w, http.StatusNotFound, "consistency_unchecked", "the stores weren't checked yet")
+				return
+			}
+			writeJSON(w, http.StatusOK, report)
+		case http.MethodPost:
+			deleteOrphans := false
+			if raw := r.URL.Query().Get("delete_orphans"); raw != "" {
+				var err error
+				if deleteOrphans, err = strconv.ParseBool(raw); err != nil {
+					writeError(w, http.StatusBadRequest, "invalid_consistency_check", "delete_orphans must be a boolean")
+					return
+				}
+			}
+
+			report, err := se.CheckConsistency(r.Context(), deleteOrphans)
+			switch {
+			case err == nil:
+				if report.DeletedVectors > 0 {
+					se.recordAudit(w, r, AuditConsistency, "", "", fmt.Sprintf("deleted %d orphan vectors", report.DeletedVectors))
+				}
+				writeJSON(w, http.StatusOK, report)
+			case errors.Is(err, ErrConsistencyUnsupported):
+				writeError(w, http.StatusNotImplemented, "consistency_unsupported", err.Error())
+			case errors.Is(err, ErrPurgeUnsupported):
+				writeError(w, http.StatusNotImplemented, "purge_unsupported", err.Error())
+			default:
+				writeError(w, http.StatusInternalServerError, "internal_error", "consistency check failed")
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// checkConsistency requests the consistency endpoint, it decodes the report of a 200.
+func checkConsistency(se *httptest.Server, method, query string) (int, searchAPI.ConsistencyReport) {
+	GinkgoHelper()
+	req, err := http.NewRequest(method, se.URL+"/admin/consistency"+query, nil)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var report searchAPI.ConsistencyReport
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&report)).To(Succeed())
+	}
+
+	return resp.StatusCode, report
+}
+
+var _ = Describe("Consistency checks", func() {
+	var (
+		vs     *searchAPI.MemoryVectorStore
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+	)
+
+	// the image store doesn't know D & E, A has no vector.
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		for _, id := range []string{"A", "B", "C"} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+		for _, id := range []string{"B", "C", "D", "E"} {
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": 0.9}})).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{
+			AdminPolicy:       searchAPI.AdminPolicy{Token: adminToken},
+			ConsistencyPolicy: searchAPI.ConsistencyPolicy{MissingThreshold: 2, DeleteOrphans: true},
+		}
+		engine = searchAPI.NewSearchEngine(cfg, is, vs)
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	vectorIDs := func() []string {
+		GinkgoHelper()
+		ids, _, err := vs.ListVectorIDs(context.Background(), "", 100)
+		Expect(err).NotTo(HaveOccurred())
+		return ids
+	}
+
+	It("reports the orphans of both stores", func() {
+		status, _ := checkConsistency(se, http.MethodGet, "")
+		Expect(status).To(Equal(http.StatusNotFound), "nothing was checked yet")
+
+		status, report := checkConsistency(se, http.MethodPost, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(report.VectorsChecked).To(Equal(4))
+		Expect(report.OrphanVectorCount).To(Equal(2))
+		Expect(report.OrphanVectors).To(Equal([]string{"D", "E"}))
+		Expect(report.CollectionsChecked).To(Equal(3))
+		Expect(report.OrphanCollections).To(Equal([]string{"A"}))
+		Expect(report.DeletedVectors).To(BeZero())
+		Expect(vectorIDs()).To(Equal([]string{"B", "C", "D", "E"}))
+
+		status, last := checkConsistency(se, http.MethodGet, "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(last.OrphanVectors).To(Equal(report.OrphanVectors))
+	})
+
+	It("deletes the orphan vectors on request", func() {
+		status, report := checkConsistency(se, http.MethodPost, "?delete_orphans=true")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(report.DeletedVectors).To(Equal(2))
+		Expect(vectorIDs()).To(Equal([]string{"B", "C"}))
+
+		_, report = checkConsistency(se, http.MethodPost, "")
+		Expect(report.OrphanVectors).To(BeEmpty())
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(ConsistOf("B", "C"))
+	})
+
+	It("deletes the orphan vectors from the job by the policy", func() {
+		Expect(engine.ConsistencyJob().Run(context.Background())).To(Succeed())
+		Expect(vectorIDs()).To(Equal([]string{"B", "C"}))
+	})
+
+	It("warns when the searches miss IDs past the threshold", func() {
+		var (
+			mu   sync.Mutex
+			logs bytes.Buffer
+		)
+		prev := slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(lockedWriter{&mu, &logs}, nil)))
+		DeferCleanup(func() { slog.SetDefault(prev) })
+
+		Expect(collectionIDs(doQuery(se, "lion").JSON.ImageCollections)).To(ConsistOf("B", "C"))
+		mu.Lock()
+		Expect(logs.String()).To(ContainSubstring("the vector store matches IDs the image store doesn't know"))
+		mu.Unlock()
+
+		_, report := checkConsistency(se, http.MethodPost, "")
+		Expect(report.SearchMissing).To(BeEquivalentTo(2))
+	})
+
+	It("rejects a malformed delete_orphans", func() {
+		status, _ := checkConsistency(se, http.MethodPost, "?delete_orphans=maybe")
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+})
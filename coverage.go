@@ -0,0 +1,176 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CoveragePolicy bounds the reports of the queries which find a tattoo.
+// Zero values are replaced by the defaults.
+type CoveragePolicy struct {
+	// MaxQueries caps the queries synthesized for a report.
+	MaxQueries int
+	// Depth is how many hits of a query are looked at, the page policy caps it.
+	Depth int
+	// QueryTimeout bounds every query of a report.
+	QueryTimeout time.Duration
+}
+
+func (p CoveragePolicy) withDefaults() CoveragePolicy {
+	if p.MaxQueries <= 0 {
+		p.MaxQueries = 10
+	}
+	if p.Depth <= 0 {
+		p.Depth = 50
+	}
+	if p.QueryTimeout <= 0 {
+		p.QueryTimeout = 300 * time.Millisecond
+	}
+
+	return p
+}
+
+// QueryCoverage is where a synthesized query ranks the tattoo.
+// Rank is 1-based, 0 when the tattoo isn't within the depth of the report.
+// Error is why the query failed, the report goes on without it.
+type QueryCoverage struct {
+	Query  string   `json:"query"`
+	Facets []string `json:"facets"`
+	Rank   int      `json:"rank,omitempty"`
+	Score  float64  `json:"score,omitempty"`
+	Total  int      `json:"total"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// CoverageReport holds how the queries made of the labels of a tattoo rank it.
+type CoverageReport struct {
+	ID      string          `json:"id"`
+	Depth   int             `json:"depth"`
+	Queries []QueryCoverage `json:"queries"`
+}
+
+// coverageLabel is the top label of a facet.
+type coverageLabel struct {
+	facet string
+	label string
+}
+
+// labelQuery returns the query of the label, quoted when it's a phrase.
+func labelQuery(label string) string {
+	if strings.ContainsAny(label, " \t") {
+		return `"` + label + `"`
+	}
+
+	return label
+}
+
+// coverageQueries synthesizes the queries of the vector, at most max.
+// The top label of every facet alone first, then their pairs.
+func coverageQueries(v TattooImagesVector, max int) []QueryCoverage {
+	var top []coverageLabel
+	for _, f := range []struct {
+		name   string
+		labels LabelSet
+	}{
+		{FacetStyle, v.Style},
+		{FacetSubject, v.Subject},
+		{FacetArea, v.Area},
+	} {
+		best := ""
+		for _, label := range sortedLabels(f.labels) {
+			if best == "" || f.labels[label] > f.labels[best] {
+				best = label
+			}
+		}
+		if best != "" {
+			top = append(top, coverageLabel{f.name, best})
+		}
+	}
+
+	var out []QueryCoverage
+	seen := make(map[string]bool)
+	add := func(labels ...coverageLabel) {
+		q := QueryCoverage{}
+		texts := make([]string, 0, len(labels))
+		for _, l := range labels {
+			texts = append(texts, labelQuery(l.label))
+			q.Facets = append(q.Facets, l.facet)
+		}
+		q.Query = strings.Join(texts, " ")
+		if len(out) < max && !seen[q.Query] {
+			seen[q.Query] = true
+			out = append(out, q)
+		}
+	}
+	for _, l := range top {
+		add(l)
+	}
+	for i := range top {
+		for j := i + 1; j < len(top); j++ {
+			add(top[i], top[j])
+		}
+	}
+
+	return out
+}
+
+// Coverage reports where the queries made of the labels of the tattoo of the ID rank it.
+// Every query is bounded by the timeout of the coverage policy.
+// It returns ErrVectorNotFound when the tattoo has no vector, ErrLookupUnsupported when it can't be looked up.
+func (e *SearchEngine) Coverage(ctx context.Context, id string) (CoverageReport, error) {
+	v, err := e.Vector(ctx, id)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	policy := e.configuration.CoveragePolicy
+	report := CoverageReport{
+		ID:      id,
+		Depth:   min(policy.Depth, e.configuration.PagePolicy.MaxLimit),
+		Queries: coverageQueries(v, policy.MaxQueries),
+	}
+	for i := range report.Queries {
+		if err := ctx.Err(); err != nil {
+			return CoverageReport{}, err
+		}
+		q := &report.Queries[i]
+
+		qCtx, qCancel := e.withTightTimeout(ctx, policy.QueryTimeout)
+		res, err := e.MultiSearch(qCtx, []string{q.Query}, SearchOptions{Limit: report.Depth})
+		qCancel()
+		if err != nil {
+			q.Error = err.Error()
+			continue
+		}
+
+		q.Total = res.Total
+		for rank, h := range res.Hits {
+			if h.Collection.ID == id {
+				q.Rank, q.Score = rank+1, h.Score
+				break
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// handleCoverage reports where the queries made of the labels of the tattoo of the ID in the path rank it.
+func handleCoverage(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := se.Coverage(r.Context(), r.PathValue("id"))
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, report)
+		case errors.Is(err, ErrVectorNotFound):
+			writeError(w, http.StatusNotFound, "vector_not_found", err.Error())
+		case errors.Is(err, ErrLookupUnsupported):
+			writeError(w, http.StatusNotImplemented, "lookup_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "vector_store_error", "vector store lookup failed")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("Coverage reports", func() {
+	newServer := func(policy searchAPI.CoveragePolicy) *httptest.Server {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}, CoveragePolicy: policy}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	coverage := func(query string, facets []string, rank int) OmegaMatcher {
+		return MatchFields(IgnoreExtras, Fields{
+			"Query":  Equal(query),
+			"Facets": Equal(facets),
+			"Rank":   Equal(rank),
+		})
+	}
+
+	It("ranks the tattoo in the queries of its top labels & their pairs", func() {
+		se := newServer(searchAPI.CoveragePolicy{})
+
+		var report searchAPI.CoverageReport
+		Expect(getVector(se, "/admin/tattoos/Y/coverage", adminToken, &report)).To(Equal(http.StatusOK))
+		Expect(report.ID).To(Equal("Y"))
+		Expect(report.Depth).To(Equal(50))
+		Expect(report.Queries).To(HaveExactElements(
+			coverage("color", []string{"style"}, 1),
+			coverage("lion", []string{"subject"}, 2),
+			coverage("arm", []string{"area"}, 1),
+			coverage("color lion", []string{"style", "subject"}, 1),
+			coverage("color arm", []string{"style", "area"}, 1),
+			coverage("lion arm", []string{"subject", "area"}, 1),
+		))
+		Expect(report.Queries[1].Total).To(Equal(2))
+	})
+
+	It("reports the tattoos past the depth as unranked, within the query cap", func() {
+		se := newServer(searchAPI.CoveragePolicy{Depth: 1, MaxQueries: 3})
+
+		var report searchAPI.CoverageReport
+		Expect(getVector(se, "/admin/tattoos/Y/coverage", adminToken, &report)).To(Equal(http.StatusOK))
+		Expect(report.Depth).To(Equal(1))
+		Expect(report.Queries).To(HaveLen(3))
+		Expect(report.Queries[1]).To(coverage("lion", []string{"subject"}, 0))
+	})
+
+	It("answers 404 for a tattoo without a vector", func() {
+		se := newServer(searchAPI.CoveragePolicy{})
+
+		var res searchAPI.Response
+		Expect(getVector(se, "/admin/tattoos/NOPE/coverage", adminToken, &res)).To(Equal(http.StatusNotFound))
+		Expect(res.Error.Code).To(Equal("vector_not_found"))
+	})
+})
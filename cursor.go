@@ -0,0 +1,149 @@
+package inkinspot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CursorPolicy holds the key the pagination cursors are signed with.
+// A random key is generated when it's empty, cursors then don't survive restarts.
+type CursorPolicy struct {
+	Secret []byte
+}
+
+func (p CursorPolicy) withDefaults() CursorPolicy {
+	if len(p.Secret) == 0 {
+		p.Secret = make([]byte, 32)
+		_, _ = rand.Read(p.Secret)
+	}
+
+	return p
+}
+
+// searchCursor is the position after the last hit of a page.
+// Matches resume after it by descending raw score, then ascending ID.
+type searchCursor struct {
+	// Search is the fingerprint of the search the cursor belongs to.
+	Search   string  `json:"q"`
+	RawScore float64 `json:"s"`
+	ID       string  `json:"id"`
+	// At is the time the first page was ranked as of in Unix nanoseconds, the next pages rank as of it too.
+	At int64 `json:"t,omitempty"`
+	// Page is the store cursor of the page holding ID, for the catalog listings.
+	Page string `json:"p,omitempty"`
+}
+
+// encodeCursor returns the signed cursor as base64 payload & signature.
+func encodeCursor(key []byte, c searchCursor) string {
+	payload, _ := marshalCanonical(c)
+	enc := base64.RawURLEncoding
+
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(cursorMAC(key, payload))
+}
+
+// decodeCursor verifies the signature & the search of the cursor.
+func decodeCursor(key []byte, raw, search string) (searchCursor, error) {
+	enc := base64.RawURLEncoding
+
+	rawPayload, rawMAC, ok := strings.Cut(raw, ".")
+	if !ok {
+		return searchCursor{}, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	payload, err := enc.DecodeString(rawPayload)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	mac, err := enc.DecodeString(rawMAC)
+	if err != nil || !hmac.Equal(mac, cursorMAC(key, payload)) {
+		return searchCursor{}, fmt.Errorf("%w: bad signature", ErrInvalidCursor)
+	}
+
+	var c searchCursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return searchCursor{}, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	if c.Search != search {
+		return searchCursor{}, fmt.Errorf("%w: issued for another search", ErrInvalidCursor)
+	}
+
+	return c, nil
+}
+
+func cursorMAC(key, payload []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(payload)
+
+	return m.Sum(nil)
+}
+
+// searchFingerprint identifies the search a cursor pages through.
+func searchFingerprint(searchKey string) string {
+	sum := sha256.Sum256([]byte(searchKey))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// rankedFingerprint identifies the search ranked by the runtime settings,
+// its cursors don't resume once the boosts or the experiments changed its ranking.
+// The searches ranked by the popularity don't resume either once a feedback was counted or the counters decayed.
+func (e *SearchEngine) rankedFingerprint(searchKey string, settings *runtimeSettings, ranking RankingPolicy) string {
+	key := searchKey + "|boosts=" + settings.key
+	if ranking.PopularityBoost > 0 {
+		key += "|feedback=" + strconv.FormatUint(e.feedbackCounted.Load(), 10) + "," + feedbackDay(e.clock.Now()).Format(time.DateOnly)
+	}
+
+	return searchFingerprint(key)
+}
+
+type rankingTimeKey struct{}
+
+// withRankingTime ranks the search of the context as of the time, the freshness & the popularity with it.
+func withRankingTime(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, rankingTimeKey{}, at)
+}
+
+// rankingTime returns the time the search of the context ranks as of, now when it's not set.
+func (e *SearchEngine) rankingTime(ctx context.Context) time.Time {
+	if at, ok := ctx.Value(rankingTimeKey{}).(time.Time); ok {
+		return at
+	}
+
+	return e.clock.Now()
+}
+
+// pinnedClock tells the same time whenever it's asked, its timers are the clock's.
+type pinnedClock struct {
+	Clock
+	at time.Time
+}
+
+func (c pinnedClock) Now() time.Time {
+	return c.at
+}
+
+// after returns the index of the first ranked match past the cursor.
+// The positional matches of the stores without vectors are rated by their place in the store ranking,
+// which shifts as the catalog changes: they resume after the ID of the cursor while it's still matched.
+func (c searchCursor) after(ranked []RankedVector, positional bool) int {
+	if positional {
+		if i := slices.IndexFunc(ranked, func(rv RankedVector) bool { return rv.ID == c.ID }); i >= 0 {
+			return i + 1
+		}
+	}
+	for i, rv := range ranked {
+		if rv.RawScore < c.RawScore || (rv.RawScore == c.RawScore && rv.ID > c.ID) {
+			return i
+		}
+	}
+
+	return len(ranked)
+}
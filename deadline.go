@@ -0,0 +1,125 @@
+package inkinspot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/DanyPops/inkinspot/httpx"
+)
+
+// DeadlineHeader carries the milliseconds the caller has left for the request.
+// Outgoing store requests set it with DeadlineTransport, /search tightens its timeout by it.
+const DeadlineHeader = httpx.DeadlineHeader
+
+// RemainingBudget returns the time left until the context's deadline, never negative.
+// It returns false when the context has no deadline.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	return httpx.RemainingBudget(ctx)
+}
+
+// DeadlineTransport sets the DeadlineHeader of the requests whose context has a deadline.
+// The clients of httpx.NewClient use it, so the store knows how long it has to answer.
+type DeadlineTransport = httpx.DeadlineTransport
+
+// searchBudget returns the timeout of the request, the caller's DeadlineHeader when it's tighter than the limit.
+func searchBudget(r *http.Request, limit time.Duration) (time.Duration, error) {
+	raw := r.Header.Get(DeadlineHeader)
+	if raw == "" {
+		return limit, nil
+	}
+
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("%w: %s must be a non-negative number of milliseconds", ErrInvalidDeadline, DeadlineHeader)
+	}
+	if ms >= limit.Milliseconds() {
+		return limit, nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+type storeTimeoutsKey struct{}
+
+// withStoreTimeouts overrides the store timeouts of the calls made with the context, its zero timeouts aren't.
+func withStoreTimeouts(ctx context.Context, p TimeoutPolicy) context.Context {
+	return context.WithValue(ctx, storeTimeoutsKey{}, p)
+}
+
+// vectorStoreTimeout returns the vector store timeout of the context, the configured one unless it's overridden.
+func (e *SearchEngine) vectorStoreTimeout(ctx context.Context) time.Duration {
+	if p, ok := ctx.Value(storeTimeoutsKey{}).(TimeoutPolicy); ok && p.VectorStoreTimeout > 0 {
+		return p.VectorStoreTimeout
+	}
+
+	return e.configuration.TimeoutPolicy.VectorStoreTimeout
+}
+
+// imageStoreTimeout returns the image store timeout of the context, the configured one unless it's overridden.
+func (e *SearchEngine) imageStoreTimeout(ctx context.Context) time.Duration {
+	if p, ok := ctx.Value(storeTimeoutsKey{}).(TimeoutPolicy); ok && p.ImageStoreTimeout > 0 {
+		return p.ImageStoreTimeout
+	}
+
+	return e.configuration.TimeoutPolicy.ImageStoreTimeout
+}
+
+// parseStoreTimeouts parses the vector_timeout & image_timeout overrides of an admin search, nil without any.
+// They're durations, positive & at most the maximum.
+func parseStoreTimeouts(params url.Values, maximum time.Duration) (*TimeoutPolicy, error) {
+	var p TimeoutPolicy
+	for _, o := range []struct {
+		name string
+		to   *time.Duration
+	}{{"vector_timeout", &p.VectorStoreTimeout}, {"image_timeout", &p.ImageStoreTimeout}} {
+		raw := params.Get(o.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %s must be a positive duration", ErrInvalidTimeout, o.name)
+		}
+		if d > maximum {
+			return nil, fmt.Errorf("%w: %s is capped at %s", ErrInvalidTimeout, o.name, maximum)
+		}
+		*o.to = d
+	}
+	if p == (TimeoutPolicy{}) {
+		return nil, nil
+	}
+
+	return &p, nil
+}
+
+// vectorStoreBudget returns the timeout planned for the vector store calls, capped by the time left to the deadline of the context.
+func (e *SearchEngine) vectorStoreBudget(ctx context.Context) time.Duration {
+	budget := e.vectorStoreTimeout(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = max(min(budget, deadline.Sub(e.clock.Now())), 0)
+	}
+
+	return budget
+}
+
+// imageStoreBudget plans the timeout of the image store call from the time left to the deadline of the context.
+// The response reserve is kept from it, it fails with ErrImageStoreTimeout when less than the floor is left.
+func (e *SearchEngine) imageStoreBudget(ctx context.Context) (time.Duration, error) {
+	budget := e.imageStoreTimeout(ctx)
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return budget, nil
+	}
+
+	policy := e.configuration.TimeoutPolicy
+	left := deadline.Sub(e.clock.Now()) - policy.ResponseReserve
+	if left < policy.ImageStoreFloor {
+		return 0, fmt.Errorf("%w: %s left of the request, the floor is %s", ErrImageStoreTimeout, max(left, 0), policy.ImageStoreFloor)
+	}
+
+	return min(budget, left), nil
+}
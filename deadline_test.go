@@ -0,0 +1,154 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// httpImageStore is an image store adapter calling an image store service over HTTP.
+type httpImageStore struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"?"+url.Values{"id": ids}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var cols []searchAPI.TattooImagesCollection
+	return cols, json.NewDecoder(resp.Body).Decode(&cols)
+}
+
+var _ = Describe("Deadline budget", func() {
+	It("has no budget without a deadline", func() {
+		_, ok := searchAPI.RemainingBudget(context.Background())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("returns the time left until the deadline", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		budget, ok := searchAPI.RemainingBudget(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(budget).To(BeNumerically("~", time.Minute, time.Second))
+
+		expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		budget, ok = searchAPI.RemainingBudget(expired)
+		Expect(ok).To(BeTrue())
+		Expect(budget).To(BeZero())
+	})
+
+	Context("propagated through the stores", func() {
+		var (
+			search     *httptest.Server
+			downstream chan string
+		)
+
+		BeforeEach(func() {
+			downstream = make(chan string, 1)
+			is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+			images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downstream <- r.Header.Get(searchAPI.DeadlineHeader)
+				cols, err := is.GetTattoosByID(r.Context(), r.URL.Query()["id"])
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(cols)
+			}))
+			DeferCleanup(images.Close)
+
+			store := httpImageStore{url: images.URL, client: &http.Client{Transport: &searchAPI.DeadlineTransport{}}}
+			cfg := searchAPI.Configuration{TimeoutPolicy: searchAPI.TimeoutPolicy{
+				ImageStoreTimeout: 5 * time.Second,
+				SearchTimeout:     2 * time.Second,
+			}}
+			search = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, store, vs)))
+			DeferCleanup(search.Close)
+		})
+
+		// budgetOf returns the budget the image store got of the search with the inbound header.
+		budgetOf := func(header string) time.Duration {
+			GinkgoHelper()
+			req, err := http.NewRequest(http.MethodGet, search.URL+"/search?q=lion", nil)
+			Expect(err).NotTo(HaveOccurred())
+			if header != "" {
+				req.Header.Set(searchAPI.DeadlineHeader, header)
+			}
+			resp, err := search.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			var raw string
+			Expect(downstream).To(Receive(&raw))
+			ms, err := strconv.Atoi(raw)
+			Expect(err).NotTo(HaveOccurred())
+			return time.Duration(ms) * time.Millisecond
+		}
+
+		DescribeTable("passes on the tightest budget",
+			func(header string, limit time.Duration) {
+				budget := budgetOf(header)
+				Expect(budget).To(BeNumerically("<=", limit))
+				Expect(budget).To(BeNumerically(">", limit-time.Second/2))
+			},
+			Entry("the search timeout without a header", "", 2*time.Second),
+			Entry("the caller's tighter deadline", "800", 800*time.Millisecond),
+			Entry("the search timeout over a looser deadline", "60000", 2*time.Second),
+		)
+
+		It("sends the caller's context deadline with the transport", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, search.URL+"/search?q=lion", nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := (&http.Client{Transport: &searchAPI.DeadlineTransport{}}).Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(req.Header.Get(searchAPI.DeadlineHeader)).To(BeEmpty(), "the transport leaves the request as is")
+
+			var raw string
+			Expect(downstream).To(Receive(&raw))
+			Expect(strconv.Atoi(raw)).To(BeNumerically("<=", 1000))
+		})
+
+		DescribeTable("rejects invalid deadlines",
+			func(header string) {
+				req, err := http.NewRequest(http.MethodGet, search.URL+"/search?q=lion", nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set(searchAPI.DeadlineHeader, header)
+				resp, err := search.Client().Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+				var body searchAPI.Response
+				Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+				Expect(body.Error.Code).To(Equal("invalid_deadline"))
+				Expect(downstream).NotTo(Receive())
+			},
+			Entry("not a number", "soon"),
+			Entry("negative", "-5"),
+		)
+	})
+})
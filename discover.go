@@ -0,0 +1,131 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DiscoverPolicy holds the sample sizes of the discover endpoint.
+type DiscoverPolicy struct {
+	// DefaultLimit is the sample size when none is requested.
+	DefaultLimit int
+	// MaxLimit caps the requested sample size.
+	MaxLimit int
+}
+
+func (p DiscoverPolicy) withDefaults() DiscoverPolicy {
+	if p.DefaultLimit <= 0 {
+		p.DefaultLimit = 12
+	}
+	if p.MaxLimit <= 0 {
+		p.MaxLimit = 50
+	}
+
+	return p
+}
+
+// TattooSampler is implemented by the image stores.
+// Which can draw a uniform random sample of their visible collections, the ones expired at the time left out.
+type TattooSampler interface {
+	SampleTattoos(ctx context.Context, n int, at time.Time) ([]TattooImagesCollection, error)
+}
+
+type sampleSeedKey struct{}
+
+// WithSampleSeed makes the samples drawn with the context reproducible.
+func WithSampleSeed(ctx context.Context, seed uint64) context.Context {
+	return context.WithValue(ctx, sampleSeedKey{}, seed)
+}
+
+// sampleRand returns the random source of the sample, seeded by the context if set.
+func sampleRand(ctx context.Context) *rand.Rand {
+	if seed, ok := ctx.Value(sampleSeedKey{}).(uint64); ok {
+		return rand.New(rand.NewPCG(seed, seed))
+	}
+
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// Discover returns a random sample of up to n collections, capped by the policy.
+// A zero n is the default sample size.
+func (e *SearchEngine) Discover(ctx context.Context, n int) ([]TattooImagesCollection, error) {
+	sampler, ok := storeAs[TattooSampler](e.imageStore)
+	if !ok {
+		return nil, ErrDiscoverUnsupported
+	}
+
+	p := e.configuration.DiscoverPolicy
+	if n == 0 {
+		n = p.DefaultLimit
+	}
+	n = min(n, p.MaxLimit)
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	sample, err := sampler.SampleTattoos(isCtx, n, e.clock.Now())
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %w", ErrImageStoreTimeout, err)
+		}
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// parseDiscoverParams reads the limit & seed query parameters.
+func parseDiscoverParams(rawLimit, rawSeed string) (limit int, seed *uint64, err error) {
+	if rawLimit != "" {
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit < 1 {
+			return 0, nil, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidPage)
+		}
+	}
+	if rawSeed != "" {
+		s, err := strconv.ParseUint(rawSeed, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: seed must be an unsigned integer", ErrInvalidPage)
+		}
+		seed = &s
+	}
+
+	return limit, seed, nil
+}
+
+// handleDiscover serves a random sample of the collections, sized by the limit parameter.
+// The seed parameter makes the sample reproducible.
+func handleDiscover(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, seed, err := parseDiscoverParams(r.URL.Query().Get("limit"), r.URL.Query().Get("seed"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+			return
+		}
+
+		ctx, cancel := se.withTightTimeout(r.Context(), se.configuration.TimeoutPolicy.SearchTimeout)
+		defer cancel()
+		if seed != nil {
+			ctx = WithSampleSeed(ctx, *seed)
+		}
+
+		sample, err := se.Discover(ctx, limit)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrDiscoverUnsupported):
+				writeError(w, http.StatusNotImplemented, "discover_unsupported", err.Error())
+			case errors.Is(err, ErrImageStoreTimeout):
+				writeError(w, http.StatusGatewayTimeout, "image_store_timeout", "image store timed out")
+			default:
+				writeError(w, http.StatusInternalServerError, "internal_error", "discover failed")
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{ImageCollections: sample, Total: len(sample)})
+	})
+}
@@ -0,0 +1,173 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// deadlineSampler records the deadline its samples are drawn under.
+type deadlineSampler struct {
+	*searchAPI.MemoryImageStore
+	deadline time.Time
+}
+
+func (s *deadlineSampler) SampleTattoos(ctx context.Context, n int, at time.Time) ([]searchAPI.TattooImagesCollection, error) {
+	s.deadline, _ = ctx.Deadline()
+	return s.MemoryImageStore.SampleTattoos(ctx, n, at)
+}
+
+func doDiscover(se *httptest.Server, params url.Values) HTTPResult {
+	GinkgoHelper()
+	resp, err := se.Client().Get(se.URL + "/discover?" + params.Encode())
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	res := HTTPResult{Status: resp.StatusCode}
+	Expect(json.NewDecoder(resp.Body).Decode(&res.JSON)).To(Succeed())
+
+	return res
+}
+
+var _ = Describe("Discover", func() {
+	var (
+		se *httptest.Server
+		is *searchAPI.MemoryImageStore
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		for i := range 60 {
+			c := searchAPI.TattooImagesCollection{ID: fmt.Sprintf("c%02d", i), Hidden: i%10 == 0}
+			Expect(is.AddCollection(context.Background(), c)).To(Succeed())
+		}
+
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, searchAPI.NewMemoryVectorStore())
+		se = httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+	})
+
+	It("returns the default sample size of distinct visible collections", func() {
+		res := doDiscover(se, url.Values{})
+		Expect(res.Status).To(Equal(http.StatusOK))
+
+		ids := collectionIDs(res.JSON.ImageCollections)
+		Expect(ids).To(HaveLen(12))
+		Expect(ids).NotTo(ContainElements("c00", "c10", "c20", "c30", "c40", "c50"))
+
+		seen := map[string]bool{}
+		for _, id := range ids {
+			Expect(seen).NotTo(HaveKey(id))
+			seen[id] = true
+		}
+	})
+
+	It("caps the sample size", func() {
+		res := doDiscover(se, url.Values{"limit": {"1000"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.ImageCollections).To(HaveLen(50))
+	})
+
+	It("returns every visible collection when there are fewer than the limit", func() {
+		small := searchAPI.NewMemoryImageStore()
+		Expect(small.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "a"})).To(Succeed())
+		Expect(small.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "b", Hidden: true})).To(Succeed())
+
+		sample, err := small.SampleTattoos(context.Background(), 12, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(collectionIDs(sample)).To(Equal([]string{"a"}))
+	})
+
+	It("samples the live collections only", func() {
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		flash := searchAPI.NewMemoryImageStore()
+		expiresAt := clock.Now().Add(-time.Hour)
+		for i := range 40 {
+			c := searchAPI.TattooImagesCollection{ID: fmt.Sprintf("x%02d", i), ExpiresAt: &expiresAt}
+			Expect(flash.AddCollection(context.Background(), c)).To(Succeed())
+		}
+		for i := range 10 {
+			Expect(flash.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: fmt.Sprintf("k%02d", i)})).To(Succeed())
+		}
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, flash, searchAPI.NewMemoryVectorStore(), searchAPI.WithClock(clock))
+		srv := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(srv.Close)
+
+		res := doDiscover(srv, url.Values{"limit": {"10"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("k00", "k01", "k02", "k03", "k04", "k05", "k06", "k07", "k08", "k09"))
+	})
+
+	It("draws the same sample for the same seed", func() {
+		first := doDiscover(se, url.Values{"seed": {"42"}})
+		second := doDiscover(se, url.Values{"seed": {"42"}})
+		other := doDiscover(se, url.Values{"seed": {"7"}})
+
+		Expect(collectionIDs(first.JSON.ImageCollections)).To(Equal(collectionIDs(second.JSON.ImageCollections)))
+		Expect(collectionIDs(first.JSON.ImageCollections)).NotTo(Equal(collectionIDs(other.JSON.ImageCollections)))
+	})
+
+	It("draws every collection about as often", func() {
+		uniform := searchAPI.NewMemoryImageStore()
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			Expect(uniform.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+
+		const draws = 5000
+		counts := map[string]int{}
+		for range draws {
+			sample, err := uniform.SampleTattoos(context.Background(), 2, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			for _, c := range sample {
+				counts[c.ID]++
+			}
+		}
+
+		// every collection is expected in 2/5 of the draws.
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			Expect(counts[id]).To(BeNumerically("~", draws*2/5, draws/20), "collection %s", id)
+		}
+	})
+
+	DescribeTable("invalid parameters return a 400 Bad Request",
+		func(params url.Values) {
+			res := doDiscover(se, params)
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("invalid_page"))
+		},
+		Entry("zero limit", url.Values{"limit": {"0"}}),
+		Entry("non numeric limit", url.Values{"limit": {"some"}}),
+		Entry("negative seed", url.Values{"seed": {"-1"}}),
+	)
+
+	It("isn't supported by image stores which can't sample", func() {
+		is, vs := inkinspottest.NewFakeStores()
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+		srv := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(srv.Close)
+
+		Expect(doDiscover(srv, url.Values{}).Status).To(Equal(http.StatusNotImplemented))
+	})
+
+	It("draws the sample within the search timeout on the clock of the engine", func() {
+		clock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		sampler := &deadlineSampler{MemoryImageStore: is}
+		cfg := searchAPI.Configuration{TimeoutPolicy: searchAPI.TimeoutPolicy{SearchTimeout: time.Second, ImageStoreTimeout: 5 * time.Second}}
+		eng := searchAPI.NewSearchEngine(cfg, sampler, searchAPI.NewMemoryVectorStore(), searchAPI.WithClock(clock))
+		srv := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(srv.Close)
+
+		Expect(doDiscover(srv, url.Values{}).Status).To(Equal(http.StatusOK))
+		Expect(sampler.deadline).To(Equal(clock.Now().Add(time.Second)))
+	})
+})
@@ -0,0 +1,12 @@
+// Package inkinspot is the tattoo search engine & its HTTP API, embeddable in another service.
+//
+// A SearchEngine searches the collections of an ImageStore by the labels of a VectorStore,
+// NewHandler serves it over HTTP:
+//
+//	engine := inkinspot.NewSearchEngine(inkinspot.DefaultConfiguration(), images, vectors)
+//	mux.Handle("/tattoos-api/", http.StripPrefix("/tattoos-api", inkinspot.NewHandler(engine)))
+//
+// The memory stores & the decorators of the package are enough to start. The other backends implement
+// the store interfaces, the optional ones only add features, and are checked by the storetest package.
+// The command cmd/inkinspot serves the engine on its own.
+package inkinspot
@@ -0,0 +1,113 @@
+package inkinspot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MaxRankCandidates bounds the candidates of a dry run ranking.
+const MaxRankCandidates = 1000
+
+// RankResult is the outcome of a dry run ranking.
+// The hits are scored as the searches score them, Unmatched holds the candidates which didn't score.
+type RankResult struct {
+	Queries   []ParsedQuery  `json:"queries"`
+	Weights   RankingPolicy  `json:"weights"`
+	Hits      []RankedVector `json:"hits"`
+	Unmatched []string       `json:"unmatched"`
+}
+
+// IDs returns the IDs of the hits in rank order.
+func (r *RankResult) IDs() []string {
+	ids := make([]string, 0, len(r.Hits))
+	for _, h := range r.Hits {
+		ids = append(ids, h.ID)
+	}
+
+	return ids
+}
+
+// DryRank ranks the candidates against the query as a search would, without touching the stores.
+// Only the language & the weights of the options apply, the candidates must have unique IDs.
+func (e *SearchEngine) DryRank(query string, candidates []TattooImagesVector, opts SearchOptions) (*RankResult, error) {
+	queries, err := e.prepareQueries([]string{query}, opts)
+	if err != nil {
+		return nil, err
+	}
+	ranking, err := opts.Weights.apply(e.configuration.RankingPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > MaxRankCandidates {
+		return nil, fmt.Errorf("%w: got %d candidates, limit is %d", ErrInvalidVector, len(candidates), MaxRankCandidates)
+	}
+	seen := make(map[string]bool, len(candidates))
+	for i, c := range candidates {
+		if c.ID == "" {
+			return nil, fmt.Errorf("%w: candidate %d has no ID", ErrInvalidVector, i)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("%w: duplicate candidate %q", ErrInvalidVector, c.ID)
+		}
+		seen[c.ID] = true
+		if err := validateLabels(c); err != nil {
+			return nil, fmt.Errorf("%w: candidate %q: %w", ErrInvalidVector, c.ID, err)
+		}
+	}
+
+	ranked := e.scoreCandidates(queries, candidates, ranking, e.settings.Load(), e.clock.Now())
+	e.configuration.ScorePolicy.normalize(ranked)
+
+	scored := make(map[string]bool, len(ranked))
+	for _, rv := range ranked {
+		scored[rv.ID] = true
+	}
+	unmatched := []string{}
+	for _, c := range candidates {
+		if !scored[c.ID] {
+			unmatched = append(unmatched, c.ID)
+		}
+	}
+
+	return &RankResult{Queries: queries, Weights: ranking, Hits: ranked, Unmatched: unmatched}, nil
+}
+
+// rankWeights are the facet weight overrides of a dry run ranking.
+type rankWeights struct {
+	Style   *float64 `json:"style"`
+	Subject *float64 `json:"subject"`
+	Area    *float64 `json:"area"`
+}
+
+// rankBody is the request of a dry run ranking.
+type rankBody struct {
+	Query      string               `json:"query"`
+	Lang       string               `json:"lang"`
+	Candidates []TattooImagesVector `json:"candidates"`
+	Weights    *rankWeights         `json:"weights"`
+}
+
+// handleRank ranks the candidates of the body against its query, the stores aren't touched.
+func handleRank(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body rankBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+
+		opts := SearchOptions{Lang: body.Lang}
+		if body.Weights != nil {
+			opts.Weights = WeightOverrides{Style: body.Weights.Style, Subject: body.Weights.Subject, Area: body.Weights.Area}
+		}
+		res, err := se.DryRank(body.Query, body.Candidates, opts)
+		if err != nil {
+			writeSearchError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,126 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doRank posts the body to the dry run ranking, it decodes the result of a 200 or the error.
+func doRank(se *httptest.Server, body any) (int, searchAPI.RankResult, *searchAPI.APIError) {
+	GinkgoHelper()
+	b, err := json.Marshal(body)
+	Expect(err).NotTo(HaveOccurred())
+	req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/rank", bytes.NewReader(b))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var res searchAPI.RankResult
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&res)).To(Succeed())
+		return resp.StatusCode, res, nil
+	}
+	var failed searchAPI.Response
+	Expect(json.NewDecoder(resp.Body).Decode(&failed)).To(Succeed())
+
+	return resp.StatusCode, res, failed.Error
+}
+
+var _ = Describe("Dry run ranking", func() {
+	candidates := []searchAPI.TattooImagesVector{
+		{ID: "A", Style: searchAPI.LabelSet{"realism": 0.9}, Subject: searchAPI.LabelSet{"lion": 0.5}},
+		{ID: "B", Subject: searchAPI.LabelSet{"lion": 0.8, "crown": 0.4}, Area: searchAPI.LabelSet{"arm": 0.7}},
+		{ID: "C", Subject: searchAPI.LabelSet{"rose": 0.9}},
+		{ID: "D", Style: searchAPI.LabelSet{"lion": 0.3}, Area: searchAPI.LabelSet{"back": 0.6}},
+	}
+
+	// initServer stores the candidates, the dry runs must rank them as the searches do.
+	initServer := func(opts ...searchAPI.SearchEngineOption) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range candidates {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, opts...)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("ranks the candidates as the searches do", func() {
+		se := initServer()
+		search := doSearch(se, url.Values{"q": {"lion"}, "explain": {"true"}, "w_subject": {"3"}})
+		Expect(search.Status).To(Equal(http.StatusOK))
+
+		status, res, _ := doRank(se, map[string]any{"query": "lion", "candidates": candidates, "weights": map[string]float64{"subject": 3}})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.IDs()).To(Equal(collectionIDs(search.JSON.ImageCollections)))
+		Expect(res.Hits).To(Equal(search.JSON.Explain.Hits))
+		Expect(res.Weights).To(Equal(search.JSON.Explain.Weights))
+		Expect(res.Unmatched).To(Equal([]string{"C"}))
+		Expect(res.Hits[0].Matches).NotTo(BeEmpty())
+	})
+
+	It("ranks with the injected ranker", func() {
+		now := time.Now()
+		fresh := append([]searchAPI.TattooImagesVector{}, candidates...)
+		fresh[3].CreatedAt = now
+
+		se := initServer(searchAPI.WithRanker(searchAPI.Ranker{Freshness: searchAPI.FreshnessPolicy{Boost: 10}}))
+		status, res, _ := doRank(se, map[string]any{"query": "lion", "candidates": fresh})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res.IDs()[0]).To(Equal("D"))
+		Expect(res.Hits[0].Freshness).To(BeNumerically(">", 10))
+	})
+
+	It("rejects the invalid rankings", func() {
+		se := initServer()
+
+		status, _, apiErr := doRank(se, map[string]any{"query": "", "candidates": candidates})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("empty_query"))
+
+		status, _, apiErr = doRank(se, map[string]any{"query": "lion", "candidates": candidates, "weights": map[string]float64{"style": 11}})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("invalid_weight"))
+
+		status, _, apiErr = doRank(se, map[string]any{"query": "lion", "candidates": append(candidates, candidates[0])})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("invalid_vector"))
+
+		status, _, apiErr = doRank(se, map[string]any{"query": "lion", "shards": 2})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("invalid_body"))
+	})
+
+	It("needs the admin token & a POST", func() {
+		se := initServer()
+		resp, err := se.Client().Post(se.URL+"/admin/rank", "application/json", bytes.NewReader([]byte(`{"query":"lion"}`)))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/rank", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err = se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resp.Header.Get("Allow")).To(Equal("POST, OPTIONS"))
+	})
+})
@@ -0,0 +1,100 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// chunkedVectorStore matches the IDs of the query as a chunked backend does, the same ID many times.
+// It can't look the vectors up, the searches keep its ranking.
+type chunkedVectorStore struct {
+	matches map[string][]string
+}
+
+func (s chunkedVectorStore) GetIDsByQuery(_ context.Context, query string) ([]string, error) {
+	return s.matches[query], nil
+}
+
+// fetchRecorder records the IDs of every fetch of the image store.
+type fetchRecorder struct {
+	*searchAPI.MemoryImageStore
+	mu      sync.Mutex
+	fetched [][]string
+}
+
+func (s *fetchRecorder) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	s.mu.Lock()
+	s.fetched = append(s.fetched, slices.Clone(ids))
+	s.mu.Unlock()
+	return s.MemoryImageStore.GetTattoosByID(ctx, ids)
+}
+
+// ids returns every ID fetched, in the order of the fetches.
+func (s *fetchRecorder) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Concat(s.fetched...)
+}
+
+var _ = Describe("Duplicate matches", func() {
+	var is *fetchRecorder
+
+	search := func(policy searchAPI.ScorePolicy, matches map[string][]string, queries ...string) []string {
+		GinkgoHelper()
+		is = &fetchRecorder{MemoryImageStore: searchAPI.NewMemoryImageStore()}
+		for _, ids := range matches {
+			for _, id := range ids {
+				Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}})).To(Succeed())
+			}
+		}
+
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{ScorePolicy: policy}, is, chunkedVectorStore{matches})
+		res, err := engine.MultiSearch(context.Background(), queries, searchAPI.SearchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return collectionIDs(res.Collections())
+	}
+
+	It("fetches every ID once, ranked by its first match", func() {
+		hits := search(searchAPI.ScorePolicy{}, map[string][]string{"lion": {"A", "B", "A", "C", "B", "A", "D", "C", "D"}}, "lion")
+		Expect(hits).To(Equal([]string{"A", "B", "C", "D"}))
+		Expect(is.ids()).To(ConsistOf("A", "B", "C", "D"))
+	})
+
+	It("dedupes the matches of every query", func() {
+		hits := search(searchAPI.ScorePolicy{}, map[string][]string{
+			"lion":  {"A", "A", "B", "A"},
+			"tiger": {"C", "B", "C", "C"},
+		}, "lion", "tiger")
+		Expect(hits).To(ConsistOf("A", "B", "C"))
+		Expect(is.ids()).To(ConsistOf("A", "B", "C"))
+	})
+
+	It("adds up the scores of the matches by the policy", func() {
+		matches := map[string][]string{"lion": {"A", "B", "C", "B", "D", "B"}}
+		Expect(search(searchAPI.ScorePolicy{Duplicates: searchAPI.DuplicatesMax}, matches, "lion")).To(Equal([]string{"A", "B", "C", "D"}))
+
+		// B scores 5/6 + 3/6 + 1/6, more than the single first match of A.
+		Expect(search(searchAPI.ScorePolicy{Duplicates: searchAPI.DuplicatesSum}, matches, "lion")).To(Equal([]string{"B", "A", "C", "D"}))
+		Expect(is.ids()).To(ConsistOf("A", "B", "C", "D"))
+	})
+
+	It("dedupes large lists in order", func() {
+		var matched, want []string
+		for i := range 5000 {
+			id := fmt.Sprintf("T%04d", i)
+			want = append(want, id)
+			matched = append(matched, id, id, fmt.Sprintf("T%04d", i/2))
+		}
+
+		hits := search(searchAPI.ScorePolicy{}, map[string][]string{"lion": matched}, "lion")
+		Expect(hits).To(Equal(want[:len(hits)]))
+		Expect(is.ids()).To(HaveLen(len(hits)))
+	})
+})
@@ -0,0 +1,186 @@
+package inkinspot
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DanyPops/inkinspot/timeoutx"
+)
+
+// Embedder turns texts into vectors of its model, for the vector store adapters searching by embeddings.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// Model names the model of the vectors, it may change when the embedder is reconfigured.
+	Model() string
+}
+
+// EmbeddingCachePolicy shapes an EmbeddingCache.
+// Zero values are replaced by the defaults.
+type EmbeddingCachePolicy struct {
+	// MaxEntries caps the embeddings cached, the least recently used are evicted.
+	MaxEntries int
+	// TTL is how long an embedding is cached.
+	TTL time.Duration
+}
+
+func (p EmbeddingCachePolicy) withDefaults() EmbeddingCachePolicy {
+	if p.MaxEntries <= 0 {
+		p.MaxEntries = 10000
+	}
+	if p.TTL <= 0 {
+		p.TTL = time.Hour
+	}
+
+	return p
+}
+
+// EmbeddingCacheStats are the counters of an EmbeddingCache.
+type EmbeddingCacheStats struct {
+	Model   string `json:"model"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// EmbeddingCache is an Embedder caching the embeddings of another in an LRU with a TTL.
+// The texts are embedded normalized, lowercased with their spaces collapsed, & keyed by the model.
+// The embeddings of a model are dropped once the embedder reports another.
+// The adapters are handed the cache by the wiring, they don't cache themselves.
+type EmbeddingCache struct {
+	embedder   Embedder
+	ttl        time.Duration
+	maxEntries int
+	clock      Clock
+
+	mu      sync.Mutex
+	model   string
+	order   *list.List
+	entries map[embeddingKey]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type embeddingKey struct {
+	model, text string
+}
+
+type embeddingEntry struct {
+	key     embeddingKey
+	vector  []float32
+	expires time.Time
+}
+
+// NewEmbeddingCache caches the embeddings of the embedder by the policy, dated by the clock, the real one when nil.
+func NewEmbeddingCache(e Embedder, p EmbeddingCachePolicy, clock Clock) *EmbeddingCache {
+	p = p.withDefaults()
+	if clock == nil {
+		clock = timeoutx.RealClock{}
+	}
+
+	return &EmbeddingCache{
+		embedder:   e,
+		ttl:        p.TTL,
+		maxEntries: p.MaxEntries,
+		clock:      clock,
+		order:      list.New(),
+		entries:    make(map[embeddingKey]*list.Element),
+	}
+}
+
+// Model returns the model of the wrapped embedder.
+func (c *EmbeddingCache) Model() string {
+	return c.embedder.Model()
+}
+
+// Embed returns the cached embedding of the normalized text, it's embedded on a miss.
+// The failed embeddings aren't cached. The returned vector is the caller's.
+func (c *EmbeddingCache) Embed(ctx context.Context, text string) ([]float32, error) {
+	key := embeddingKey{model: c.embedder.Model(), text: normalizeEmbeddingText(text)}
+	if v, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return v, nil
+	}
+	c.misses.Add(1)
+
+	v, err := c.embedder.Embed(ctx, key.text)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, v)
+
+	return slices.Clone(v), nil
+}
+
+// get returns a copy of the cached embedding, the cache is dropped when the model changed.
+func (c *EmbeddingCache) get(key embeddingKey) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key.model != c.model {
+		c.order.Init()
+		clear(c.entries)
+		c.model = key.model
+	}
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*embeddingEntry)
+	if c.clock.Now().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+
+	return slices.Clone(entry.vector), true
+}
+
+// put caches the embedding, evicting the least recently used beyond the cap.
+// The embeddings of a model replaced meanwhile aren't cached.
+func (c *EmbeddingCache) put(key embeddingKey, v []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key.model != c.model {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&embeddingEntry{key: key, vector: slices.Clone(v), expires: c.clock.Now().Add(c.ttl)})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *EmbeddingCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*embeddingEntry).key)
+}
+
+// Stats returns the counters of the cache.
+func (c *EmbeddingCache) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return EmbeddingCacheStats{Model: c.model, Entries: c.order.Len(), Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// normalizeEmbeddingText lowercases the text & collapses its spaces.
+func normalizeEmbeddingText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// WithEmbeddingCache reports the stats of the embedding cache the adapters of the engine embed through,
+// alongside the stats of the result cache.
+func WithEmbeddingCache(c *EmbeddingCache) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.embeddings = c
+	}
+}
@@ -0,0 +1,134 @@
+package inkinspot_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// countingEmbedder embeds a text as its length, counting the calls by text.
+type countingEmbedder struct {
+	mu    sync.Mutex
+	model string
+	calls map[string]int
+	err   error
+}
+
+func (e *countingEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.calls[text]++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []float32{float32(len(text))}, nil
+}
+
+func (e *countingEmbedder) Model() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.model
+}
+
+func (e *countingEmbedder) setModel(model string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.model = model
+}
+
+var _ = Describe("Embedding cache", func() {
+	var (
+		clock    *inkinspottest.FakeClock
+		embedder *countingEmbedder
+		cache    *searchAPI.EmbeddingCache
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC))
+		embedder = &countingEmbedder{model: "v1", calls: map[string]int{}}
+		cache = searchAPI.NewEmbeddingCache(embedder, searchAPI.EmbeddingCachePolicy{MaxEntries: 2, TTL: time.Minute}, clock)
+	})
+
+	embed := func(text string) []float32 {
+		GinkgoHelper()
+		v, err := cache.Embed(context.Background(), text)
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	It("embeds the repeated queries once, by their normalized text", func() {
+		Expect(embed("Lion  Head")).To(Equal([]float32{9}))
+		Expect(embed("lion head")).To(Equal([]float32{9}))
+		Expect(embed(" LION head ")).To(Equal([]float32{9}))
+
+		Expect(embedder.calls).To(Equal(map[string]int{"lion head": 1}))
+		Expect(cache.Stats()).To(Equal(searchAPI.EmbeddingCacheStats{Model: "v1", Entries: 1, Hits: 2, Misses: 1}))
+	})
+
+	It("drops the embeddings of the previous model", func() {
+		embed("lion")
+		embedder.setModel("v2")
+		embed("lion")
+		embed("lion")
+		Expect(embedder.calls).To(Equal(map[string]int{"lion": 2}))
+
+		By("not keeping the embeddings of the model switched back to")
+		embedder.setModel("v1")
+		embed("lion")
+		Expect(embedder.calls).To(Equal(map[string]int{"lion": 3}))
+		Expect(cache.Stats()).To(Equal(searchAPI.EmbeddingCacheStats{Model: "v1", Entries: 1, Hits: 1, Misses: 3}))
+	})
+
+	It("embeds again past the TTL", func() {
+		embed("lion")
+		clock.Advance(time.Minute)
+		embed("lion")
+		clock.Advance(time.Second)
+		embed("lion")
+		Expect(embedder.calls).To(Equal(map[string]int{"lion": 2}))
+	})
+
+	It("evicts the least recently used beyond the cap", func() {
+		embed("lion")
+		embed("rose")
+		embed("lion")
+		embed("wolf")
+		embed("lion")
+		embed("rose")
+		Expect(embedder.calls).To(Equal(map[string]int{"lion": 1, "rose": 2, "wolf": 1}))
+	})
+
+	It("doesn't cache the failures", func() {
+		embedder.err = errors.New("quota exceeded")
+		_, err := cache.Embed(context.Background(), "lion")
+		Expect(err).To(MatchError("quota exceeded"))
+
+		embedder.err = nil
+		embed("lion")
+		embed("lion")
+		Expect(embedder.calls).To(Equal(map[string]int{"lion": 2}))
+	})
+
+	It("hands out copies of the cached embeddings", func() {
+		embed("lion")[0] = 42
+		Expect(embed("lion")).To(Equal([]float32{4}))
+	})
+
+	It("reports its stats with the result cache's", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs, searchAPI.WithEmbeddingCache(cache))
+		embed("lion")
+
+		Expect(engine.CacheStats().Embeddings).To(Equal(&searchAPI.EmbeddingCacheStats{Model: "v1", Entries: 1, Misses: 1}))
+	})
+})
@@ -0,0 +1,50 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// newCatalog returns the memory stores of a lion & a rose.
+func newCatalog() (*inkinspot.MemoryImageStore, *inkinspot.MemoryVectorStore) {
+	images, vectors := inkinspot.NewMemoryImageStore(), inkinspot.NewMemoryVectorStore()
+	for id, subject := range map[string]string{"lion-1": "lion", "rose-1": "rose"} {
+		_ = images.AddCollection(context.Background(), inkinspot.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}})
+		_ = vectors.AddVector(context.Background(), inkinspot.TattooImagesVector{ID: id, Subject: inkinspot.LabelSet{subject: 0.9}})
+	}
+
+	return images, vectors
+}
+
+// The engine searches without the HTTP API.
+func ExampleSearchEngine_Search() {
+	images, vectors := newCatalog()
+	engine := inkinspot.NewSearchEngine(inkinspot.DefaultConfiguration(), images, vectors)
+
+	collections, err := engine.Search(context.Background(), "lion")
+	for _, c := range collections {
+		fmt.Println(c.ID, c.URLs)
+	}
+	fmt.Println(err)
+	// Output:
+	// lion-1 [lion-1.jpg]
+	// <nil>
+}
+
+// The HTTP API is mounted under a prefix of the routes of the service.
+func ExampleNewHandler() {
+	images, vectors := newCatalog()
+	engine := inkinspot.NewSearchEngine(inkinspot.DefaultConfiguration(), images, vectors)
+
+	mux := http.NewServeMux()
+	mux.Handle("/tattoos-api/", http.StripPrefix("/tattoos-api", inkinspot.NewHandler(engine)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tattoos-api/tattoos/rose-1", nil))
+	fmt.Println(rec.Code, rec.Header().Get("Content-Type"))
+	// Output: 200 application/json
+}
@@ -0,0 +1,253 @@
+package inkinspot
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ClientIDHeader identifies the clients without an API key, they're assigned the experiments by it.
+const ClientIDHeader = "X-Client-ID"
+
+// Variants of an experiment a client is assigned.
+const (
+	VariantControl   = "control"
+	VariantTreatment = "treatment"
+)
+
+// ExperimentPolicy ranks the searches of a share of the clients by a variant of the ranking policy.
+// Every experiment draws its share of the clients apart, a client drawn by several is in the treatment of the first.
+type ExperimentPolicy struct {
+	Name string `json:"name"`
+	// Percent is the share of the clients in the treatment, within [0, 100], of the ones the earlier experiments left.
+	Percent int `json:"percent"`
+	// Variant replaces the configured ranking policy in the treatment, its zero weights are 1.
+	Variant RankingPolicy `json:"variant"`
+}
+
+// ExperimentAssignment is the experiment & the variant a client is assigned, zero when no experiment runs.
+// The clients out of every treatment are in the control of one of the experiments.
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+	// ranking is the variant's policy, nil in the control.
+	ranking *RankingPolicy
+}
+
+// key identifies the assignment in the cache keys.
+func (a ExperimentAssignment) key() string {
+	if a.Variant == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("|experiment=%q,%q", a.Experiment, a.Variant)
+}
+
+// ExperimentMetrics are the counters of the searches of a variant of an experiment.
+type ExperimentMetrics struct {
+	Experiment  string `json:"experiment"`
+	Variant     string `json:"variant"`
+	Searches    int64  `json:"searches"`
+	ZeroResults int64  `json:"zero_results"`
+	// Impressions & Clicks are the feedback on the hits of the searches.
+	Impressions int64 `json:"impressions"`
+	Clicks      int64 `json:"clicks"`
+}
+
+// compileExperiments validates the experiments & returns their key in the cache keys.
+func compileExperiments(exps []ExperimentPolicy) (string, error) {
+	var (
+		key   strings.Builder
+		total int
+		names = make(map[string]bool, len(exps))
+	)
+	for _, x := range exps {
+		if x.Name == "" {
+			return "", fmt.Errorf("%w: an experiment has no name", ErrInvalidExperiment)
+		}
+		if names[x.Name] {
+			return "", fmt.Errorf("%w: %q runs more than once", ErrInvalidExperiment, x.Name)
+		}
+		names[x.Name] = true
+		if x.Percent < 0 || x.Percent > 100 {
+			return "", fmt.Errorf("%w: %q percent must be within 0 and 100", ErrInvalidExperiment, x.Name)
+		}
+		if total += x.Percent; total > 100 {
+			return "", fmt.Errorf("%w: the experiments take more than 100 percent", ErrInvalidExperiment)
+		}
+		for _, w := range []float64{x.Variant.StyleWeight, x.Variant.SubjectWeight, x.Variant.AreaWeight} {
+			if math.IsNaN(w) || w < 0 || w > MaxFacetWeight {
+				return "", fmt.Errorf("%w: %q weights must be within 0 and %d", ErrInvalidExperiment, x.Name, MaxFacetWeight)
+			}
+		}
+		if p := x.Variant.PopularityBoost; math.IsNaN(p) || p < 0 {
+			return "", fmt.Errorf("%w: %q popularity boost must not be negative", ErrInvalidExperiment, x.Name)
+		}
+		v := x.Variant.withDefaults()
+		fmt.Fprintf(&key, "%q=%d:%g,%g,%g,%g;", x.Name, x.Percent, v.StyleWeight, v.SubjectWeight, v.AreaWeight, v.PopularityBoost)
+	}
+
+	return key.String(), nil
+}
+
+// experimentBucket returns the bucket of the client in [0, 100), by the hash of its ID salted by the experiment.
+func experimentBucket(experiment, clientID string) int {
+	h := fnv.New64a()
+	h.Write([]byte(experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(clientID))
+
+	return int(h.Sum64() % 100)
+}
+
+// assign returns the assignment of the client, in the treatment of the first experiment whose bucket of the client is within its share.
+// The clients of no treatment are spread over the controls of the experiments. A client without an ID isn't assigned.
+func (rs *runtimeSettings) assign(clientID string) ExperimentAssignment {
+	if clientID == "" || len(rs.Experiments) == 0 {
+		return ExperimentAssignment{}
+	}
+
+	for _, x := range rs.Experiments {
+		if experimentBucket(x.Name, clientID) < x.Percent {
+			ranking := x.Variant.withDefaults()
+			return ExperimentAssignment{Experiment: x.Name, Variant: VariantTreatment, ranking: &ranking}
+		}
+	}
+	control := rs.Experiments[experimentBucket("", clientID)%len(rs.Experiments)]
+
+	return ExperimentAssignment{Experiment: control.Name, Variant: VariantControl}
+}
+
+// AssignExperiment returns the assignment of the client, sticky while the experiments don't change.
+// The searches rank by it when it's in their options.
+func (e *SearchEngine) AssignExperiment(clientID string) ExperimentAssignment {
+	return e.settings.Load().assign(clientID)
+}
+
+// SetExperiments replaces the experiments of the settings.
+// It's persisted first when a settings path is configured, on failure nothing changes.
+func (e *SearchEngine) SetExperiments(exps []ExperimentPolicy) error {
+	return e.updateSettings(func(s *Settings) { s.Experiments = exps })
+}
+
+// clientID returns the identifier of the client assigned to the experiments: its API key, its client ID otherwise.
+func clientID(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	return r.Header.Get(ClientIDHeader)
+}
+
+// experimentCounters counts the searches & the feedback of the variants, by experiment.
+type experimentCounters struct {
+	mu       sync.Mutex
+	counters map[[2]string]*ExperimentMetrics
+}
+
+// count applies the change to the counters of the assignment, the unassigned searches aren't counted.
+func (c *experimentCounters) count(a ExperimentAssignment, change func(*ExperimentMetrics)) {
+	if a.Variant == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := [2]string{a.Experiment, a.Variant}
+	m, ok := c.counters[k]
+	if !ok {
+		m = &ExperimentMetrics{Experiment: a.Experiment, Variant: a.Variant}
+		c.counters[k] = m
+	}
+	change(m)
+}
+
+// recordExperiment counts a search of the assignment.
+func (e *SearchEngine) recordExperiment(a ExperimentAssignment, empty bool) {
+	e.experiments.count(a, func(m *ExperimentMetrics) {
+		m.Searches++
+		if empty {
+			m.ZeroResults++
+		}
+	})
+}
+
+// recordExperimentFeedback counts a feedback on a hit of a search of the assignment.
+func (e *SearchEngine) recordExperimentFeedback(a ExperimentAssignment, action string) {
+	e.experiments.count(a, func(m *ExperimentMetrics) {
+		switch action {
+		case FeedbackImpression:
+			m.Impressions++
+		case FeedbackClick:
+			m.Clicks++
+		}
+	})
+}
+
+// ExperimentMetrics returns the counters of the variants which served searches, by experiment & variant.
+func (e *SearchEngine) ExperimentMetrics() []ExperimentMetrics {
+	e.experiments.mu.Lock()
+	defer e.experiments.mu.Unlock()
+
+	out := make([]ExperimentMetrics, 0, len(e.experiments.counters))
+	for _, m := range e.experiments.counters {
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b ExperimentMetrics) int {
+		return cmp.Or(strings.Compare(a.Experiment, b.Experiment), strings.Compare(a.Variant, b.Variant))
+	})
+
+	return out
+}
+
+// experimentsBody is the body of the experiments admin route.
+type experimentsBody struct {
+	Experiments []ExperimentPolicy `json:"experiments"`
+}
+
+// handleExperiments lists & replaces the experiments of the settings.
+func handleExperiments(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var body experimentsBody
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+				return
+			}
+
+			before := se.Settings().Experiments
+			if err := se.SetExperiments(body.Experiments); err != nil {
+				if errors.Is(err, ErrInvalidExperiment) {
+					writeError(w, http.StatusBadRequest, "invalid_experiment", err.Error())
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "internal_error", "saving the settings failed")
+				return
+			}
+			se.recordAudit(w, r, AuditExperiments, "", auditSummary(before), auditSummary(se.Settings().Experiments))
+		}
+
+		exps := se.Settings().Experiments
+		if exps == nil {
+			exps = []ExperimentPolicy{}
+		}
+		writeJSON(w, http.StatusOK, experimentsBody{Experiments: exps})
+	})
+}
+
+// handleExperimentMetrics reports the counters of the variants.
+func handleExperimentMetrics(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.ExperimentMetrics())
+	})
+}
@@ -0,0 +1,266 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ranking experiments", func() {
+	var (
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+	)
+
+	// T1 is the lion of the subjects, T2 of the styles.
+	initServer := func(cfg searchAPI.Configuration) {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range []searchAPI.TattooImagesVector{
+			{ID: "T1", Subject: searchAPI.LabelSet{"lion": 0.9}},
+			{ID: "T2", Style: searchAPI.LabelSet{"lion": 0.5}},
+		} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		cfg.AdminPolicy.Token = adminToken
+		engine = searchAPI.NewSearchEngine(cfg, is, vs)
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	}
+
+	styleFirst := func(percent int) []searchAPI.ExperimentPolicy {
+		return []searchAPI.ExperimentPolicy{{Name: "style-first", Percent: percent, Variant: searchAPI.RankingPolicy{StyleWeight: 5}}}
+	}
+
+	// search returns the response of the search of lions by the client.
+	search := func(header, client string) searchAPI.Response {
+		GinkgoHelper()
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion&debug_meta=true", nil)
+		Expect(err).NotTo(HaveOccurred())
+		if client != "" {
+			req.Header.Set(header, client)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return body
+	}
+
+	admin := func(method, path, body string) *http.Response {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		return resp
+	}
+
+	It("assigns the share of the clients to the treatment", func() {
+		initServer(searchAPI.Configuration{})
+		Expect(engine.SetExperiments(styleFirst(10))).To(Succeed())
+
+		treated := 0
+		for i := range 2000 {
+			a := engine.AssignExperiment(fmt.Sprintf("client-%d", i))
+			if a.Variant == searchAPI.VariantTreatment {
+				Expect(a.Experiment).To(Equal("style-first"))
+				treated++
+			} else {
+				Expect(a).To(Equal(searchAPI.ExperimentAssignment{Experiment: "style-first", Variant: searchAPI.VariantControl}))
+			}
+		}
+		Expect(treated).To(BeNumerically("~", 200, 40))
+		Expect(engine.AssignExperiment("")).To(Equal(searchAPI.ExperimentAssignment{}), "the anonymous clients aren't assigned")
+	})
+
+	It("draws the treatments of the experiments apart", func() {
+		initServer(searchAPI.Configuration{})
+
+		treated := func(name string) map[string]bool {
+			GinkgoHelper()
+			Expect(engine.SetExperiments([]searchAPI.ExperimentPolicy{{Name: name, Percent: 20}})).To(Succeed())
+			out := map[string]bool{}
+			for i := range 2000 {
+				client := fmt.Sprintf("client-%d", i)
+				if engine.AssignExperiment(client).Variant == searchAPI.VariantTreatment {
+					out[client] = true
+				}
+			}
+			return out
+		}
+
+		first, second := treated("first"), treated("second")
+		both := 0
+		for client := range first {
+			if second[client] {
+				both++
+			}
+		}
+		// a fifth of the first treatment is expected in the second.
+		Expect(both).To(BeNumerically("~", len(first)/5, 30))
+
+		By("spreading the controls over the experiments")
+		Expect(engine.SetExperiments([]searchAPI.ExperimentPolicy{{Name: "first", Percent: 10}, {Name: "second", Percent: 10}})).To(Succeed())
+		controls := map[string]int{}
+		for i := range 2000 {
+			if a := engine.AssignExperiment(fmt.Sprintf("client-%d", i)); a.Variant == searchAPI.VariantControl {
+				controls[a.Experiment]++
+			}
+		}
+		Expect(controls["first"]).To(BeNumerically("~", controls["second"], 150))
+	})
+
+	It("ranks the treatment by the variant's policy", func() {
+		initServer(searchAPI.Configuration{})
+		Expect(engine.SetExperiments(styleFirst(100))).To(Succeed())
+
+		res := search(searchAPI.ClientIDHeader, "client-1")
+		Expect(collectionIDs(res.ImageCollections)).To(Equal([]string{"T2", "T1"}))
+		Expect(res.Meta.Experiment).To(Equal("style-first"))
+		Expect(res.Meta.Variant).To(Equal(searchAPI.VariantTreatment))
+
+		res = search(searchAPI.ClientIDHeader, "")
+		Expect(collectionIDs(res.ImageCollections)).To(Equal([]string{"T1", "T2"}))
+		Expect(res.Meta.Variant).To(BeEmpty())
+	})
+
+	It("keeps the variant of a client across its searches", func() {
+		initServer(searchAPI.Configuration{})
+		Expect(engine.SetExperiments(styleFirst(50))).To(Succeed())
+
+		variants := map[string]int{}
+		for i := range 20 {
+			for _, header := range []string{searchAPI.ClientIDHeader, searchAPI.APIKeyHeader} {
+				client := fmt.Sprintf("client-%d", i)
+				first := search(header, client).Meta.Variant
+				for range 3 {
+					Expect(search(header, client).Meta.Variant).To(Equal(first))
+				}
+				variants[first]++
+			}
+		}
+		Expect(variants).To(HaveKey(searchAPI.VariantTreatment))
+		Expect(variants).To(HaveKey(searchAPI.VariantControl))
+	})
+
+	It("caches the results of the variants apart", func() {
+		initServer(searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true}})
+		Expect(engine.SetExperiments(styleFirst(100))).To(Succeed())
+
+		for range 2 {
+			req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion", nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			var body searchAPI.Response
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			resp.Body.Close()
+			Expect(collectionIDs(body.ImageCollections)).To(Equal([]string{"T1", "T2"}))
+
+			req.Header.Set(searchAPI.ClientIDHeader, "client-1")
+			resp, err = se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			resp.Body.Close()
+			Expect(collectionIDs(body.ImageCollections)).To(Equal([]string{"T2", "T1"}))
+		}
+	})
+
+	It("counts the searches & the clicks of the variants", func() {
+		var log bytes.Buffer
+		initServer(searchAPI.Configuration{AccessLogPolicy: searchAPI.AccessLogPolicy{Writer: &log}})
+		Expect(engine.SetExperiments(styleFirst(50))).To(Succeed())
+
+		want := map[string]*searchAPI.ExperimentMetrics{
+			searchAPI.VariantControl:   {Experiment: "style-first", Variant: searchAPI.VariantControl},
+			searchAPI.VariantTreatment: {Experiment: "style-first", Variant: searchAPI.VariantTreatment},
+		}
+		for i := range 10 {
+			client := fmt.Sprintf("client-%d", i)
+			req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set(searchAPI.ClientIDHeader, client)
+			req.Header.Set(searchAPI.RequestIDHeader, client)
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+
+			variant := engine.AssignExperiment(client).Variant
+			want[variant].Searches++
+			if i%2 == 0 {
+				fb := fmt.Sprintf(`{"feedback_id": %q, "collection_id": "T1", "action": "click"}`, resp.Header.Get(searchAPI.FeedbackIDHeader))
+				resp, err := se.Client().Post(se.URL+"/feedback", "application/json", strings.NewReader(fb))
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+				want[variant].Clicks++
+			}
+		}
+
+		resp := admin(http.MethodGet, "/admin/experiments/metrics", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var metrics []searchAPI.ExperimentMetrics
+		Expect(json.NewDecoder(resp.Body).Decode(&metrics)).To(Succeed())
+		Expect(metrics).To(Equal([]searchAPI.ExperimentMetrics{*want[searchAPI.VariantControl], *want[searchAPI.VariantTreatment]}))
+
+		var entry searchAPI.AccessLogEntry
+		Expect(json.NewDecoder(&log).Decode(&entry)).To(Succeed())
+		Expect(entry.Path).To(Equal("/search"))
+		Expect(entry.RequestID).To(Equal("client-0"))
+		Expect(entry.Variant).To(Equal(engine.AssignExperiment("client-0").Variant))
+	})
+
+	It("replaces the experiments through the admin route", func() {
+		initServer(searchAPI.Configuration{})
+
+		resp := admin(http.MethodPut, "/admin/experiments", `{"experiments": [{"name": "style-first", "percent": 10, "variant": {"style_weight": 5}}]}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(engine.Settings().Experiments).To(Equal(styleFirst(10)))
+
+		By("keeping them when the boosts change")
+		Expect(engine.SetBoosts(searchAPI.BoostTable{"lion": 2})).To(Succeed())
+		Expect(engine.Settings().Experiments).To(Equal(styleFirst(10)))
+
+		resp = admin(http.MethodGet, "/admin/experiments", "")
+		var body map[string]any
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body["experiments"]).To(HaveLen(1))
+	})
+
+	DescribeTable("rejects the invalid experiments",
+		func(exps string) {
+			initServer(searchAPI.Configuration{})
+
+			resp := admin(http.MethodPut, "/admin/experiments", `{"experiments": `+exps+`}`)
+			var body searchAPI.Response
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(body.Error.Code).To(Equal("invalid_experiment"))
+			Expect(engine.Settings().Experiments).To(BeEmpty())
+		},
+		Entry("no name", `[{"percent": 10}]`),
+		Entry("a name twice", `[{"name": "a", "percent": 10}, {"name": "a", "percent": 10}]`),
+		Entry("a percent over 100", `[{"name": "a", "percent": 101}]`),
+		Entry("more than 100 percent in all", `[{"name": "a", "percent": 60}, {"name": "b", "percent": 50}]`),
+		Entry("a weight over the max", `[{"name": "a", "percent": 10, "variant": {"area_weight": 11}}]`),
+	)
+})
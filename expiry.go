@@ -0,0 +1,189 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Direct lookup answers for the expired collections, for ExpiryPolicy.Lookup.
+const (
+	// ExpiredHide answers as if the collection was unknown.
+	ExpiredHide = "hide"
+	// ExpiredGone answers ErrCollectionExpired, 410 Gone over HTTP.
+	ExpiredGone = "gone"
+)
+
+// ExpiryPolicy controls the collections past their ExpiresAt, they're never served.
+// Zero values are replaced by the defaults.
+type ExpiryPolicy struct {
+	// Lookup is how the direct lookups of an expired collection answer, ExpiredHide by default.
+	Lookup string
+	// PurgeInterval is how often the expiry job deletes the expired collections from the stores.
+	PurgeInterval time.Duration
+}
+
+func (p ExpiryPolicy) withDefaults() ExpiryPolicy {
+	if p.Lookup == "" {
+		p.Lookup = ExpiredHide
+	}
+	if p.PurgeInterval <= 0 {
+		p.PurgeInterval = time.Hour
+	}
+
+	return p
+}
+
+// CollectionDeleter is implemented by the image stores which can delete collections.
+type CollectionDeleter interface {
+	DeleteCollection(ctx context.Context, id string) error
+}
+
+// VectorDeleter is implemented by the vector stores which can delete vectors.
+type VectorDeleter interface {
+	DeleteVector(ctx context.Context, id string) error
+}
+
+// HiddenFilter is implemented by the image stores which can tell the unserved collections apart cheaply.
+// The searches then count & page their matches without them, instead of serving shorter pages.
+type HiddenFilter interface {
+	// HiddenIDs returns the IDs of the collections hidden or expired at the time, in the order of the IDs.
+	// The IDs the store has no collection for aren't hidden.
+	HiddenIDs(ctx context.Context, ids []string, at time.Time) ([]string, error)
+}
+
+// dropHidden drops the matches of the collections the image store doesn't serve, it returns how many it dropped.
+// The matches are left when the image store can't tell, the pages drop them.
+func (e *SearchEngine) dropHidden(ctx context.Context, ranked []RankedVector) ([]RankedVector, int, error) {
+	filter, ok := storeAs[HiddenFilter](e.imageStore)
+	if !ok || len(ranked) == 0 {
+		return ranked, 0, nil
+	}
+
+	ids := make([]string, len(ranked))
+	for i, rv := range ranked {
+		ids[i] = rv.ID
+	}
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	hidden, err := filter.HiddenIDs(isCtx, ids, e.clock.Now())
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrImageStoreTimeout, err)
+		}
+		return nil, 0, e.storeError(ImageStoreName, "get", err)
+	}
+	if len(hidden) == 0 {
+		return ranked, 0, nil
+	}
+
+	drop := make(map[string]bool, len(hidden))
+	for _, id := range hidden {
+		drop[id] = true
+	}
+	kept := slices.DeleteFunc(ranked, func(rv RankedVector) bool { return drop[rv.ID] })
+
+	return kept, len(ids) - len(kept), nil
+}
+
+// expired reports whether the collection is past its expiry at the time.
+func (c TattooImagesCollection) expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// earliestExpiry returns the first expiry of the collections, zero when none expires.
+func earliestExpiry(cols []TattooImagesCollection) time.Time {
+	var first time.Time
+	for _, c := range cols {
+		if c.ExpiresAt != nil && (first.IsZero() || c.ExpiresAt.Before(first)) {
+			first = *c.ExpiresAt
+		}
+	}
+
+	return first
+}
+
+// dropExpired returns the hits without the expired collections, the hits themselves when none is.
+func dropExpired(hits []SearchHit, now time.Time) []SearchHit {
+	out := hits
+	for i, h := range hits {
+		if !h.Collection.expired(now) {
+			if len(out) < len(hits) {
+				out = append(out, h)
+			}
+			continue
+		}
+		if len(out) == len(hits) {
+			out = append(make([]SearchHit, 0, len(hits)-1), hits[:i]...)
+		}
+	}
+
+	return out
+}
+
+// PurgeExpired deletes the expired collections & their vectors from the stores, then from the caches.
+// It returns the number of collections deleted.
+func (e *SearchEngine) PurgeExpired(ctx context.Context) (int, error) {
+	deleter, ok := storeAs[CollectionDeleter](e.imageStore)
+	if !ok {
+		return 0, fmt.Errorf("%w: image store can't delete", ErrPurgeUnsupported)
+	}
+	vectors, _ := storeAs[VectorDeleter](e.vectorStore)
+	it, err := e.iterateCollections(ctx)
+	if errors.Is(err, ErrExportUnsupported) {
+		return 0, fmt.Errorf("%w: image store can't list", ErrPurgeUnsupported)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := e.clock.Now()
+	var expired []string
+	err = ForEach(ctx, it, func(c TattooImagesCollection) error {
+		if c.expired(now) {
+			expired = append(expired, c.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	inv := e.newCacheInvalidation()
+	purged := 0
+	for _, id := range expired {
+		if vectors != nil {
+			e.addStored(ctx, inv, id)
+			if err := vectors.DeleteVector(ctx, id); err != nil {
+				return purged, e.storeError(VectorStoreName, "delete", err)
+			}
+		}
+		if err := deleter.DeleteCollection(ctx, id); err != nil {
+			return purged, e.storeError(ImageStoreName, "delete", err)
+		}
+		e.collections.forget(id)
+		purged++
+	}
+	if purged > 0 {
+		e.invalidate(inv)
+		slog.InfoContext(ctx, "purged the expired collections", "count", purged)
+	}
+
+	return purged, nil
+}
+
+// ExpiryJob purges the expired collections every interval of the policy.
+func (e *SearchEngine) ExpiryJob() Job {
+	return Job{
+		Name:     "expiry",
+		Interval: e.configuration.ExpiryPolicy.PurgeInterval,
+		Run: func(ctx context.Context) error {
+			_, err := e.PurgeExpired(ctx)
+			return err
+		},
+	}
+}
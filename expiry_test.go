@@ -0,0 +1,142 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collection expiry", func() {
+	var (
+		is    *searchAPI.MemoryImageStore
+		vs    *searchAPI.MemoryVectorStore
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+
+		// F is a flash sheet expiring in an hour, K is kept.
+		expiresAt := clock.Now().Add(time.Hour)
+		for _, c := range []searchAPI.TattooImagesCollection{
+			{ID: "F", URLs: []string{"f.jpg"}, ExpiresAt: &expiresAt},
+			{ID: "K", URLs: []string{"k.jpg"}},
+		} {
+			Expect(is.AddCollection(context.Background(), c)).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: c.ID, Subject: searchAPI.LabelSet{"rose": 100}})).To(Succeed())
+		}
+	})
+
+	newEngine := func(policy searchAPI.ExpiryPolicy) *searchAPI.SearchEngine {
+		cfg := searchAPI.Configuration{
+			CachePolicy:  searchAPI.CachePolicy{TTL: 24 * time.Hour, CacheBodies: true},
+			AdminPolicy:  searchAPI.AdminPolicy{Token: adminToken},
+			ExpiryPolicy: policy,
+		}
+		return searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))
+	}
+
+	newServer := func(e *searchAPI.SearchEngine) *httptest.Server {
+		se := httptest.NewServer(searchAPI.NewHandler(e))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	// getCollection requests the collection of the ID.
+	getCollection := func(se *httptest.Server, id string) HTTPResult {
+		GinkgoHelper()
+		resp, err := se.Client().Get(se.URL + "/tattoos/" + id)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		res := HTTPResult{Status: resp.StatusCode}
+		Expect(json.NewDecoder(resp.Body).Decode(&res.JSON)).To(Succeed())
+		return res
+	}
+
+	It("stops serving a collection once it expires, even from the cache", func() {
+		se := newServer(newEngine(searchAPI.ExpiryPolicy{}))
+
+		res := doSearch(se, url.Values{"q": {"rose"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("F", "K"))
+
+		clock.Advance(time.Hour)
+		res = doSearch(se, url.Values{"q": {"rose"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"K"}))
+	})
+
+	It("answers 404 Not Found to an expired lookup by default & 410 Gone when told so", func() {
+		se := newServer(newEngine(searchAPI.ExpiryPolicy{}))
+		Expect(getCollection(se, "F").Status).To(Equal(http.StatusOK))
+
+		clock.Advance(2 * time.Hour)
+		res := getCollection(se, "F")
+		Expect(res.Status).To(Equal(http.StatusNotFound))
+		Expect(res.JSON.Error.Code).To(Equal("collection_not_found"))
+
+		se = newServer(newEngine(searchAPI.ExpiryPolicy{Lookup: searchAPI.ExpiredGone}))
+		res = getCollection(se, "F")
+		Expect(res.Status).To(Equal(http.StatusGone))
+		Expect(res.JSON.Error.Code).To(Equal("collection_expired"))
+	})
+
+	It("purges the expired collections & their vectors from the stores", func() {
+		e := newEngine(searchAPI.ExpiryPolicy{})
+
+		n, err := e.PurgeExpired(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+
+		clock.Advance(time.Hour)
+		n, err = e.PurgeExpired(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+
+		_, err = is.GetTattoosByID(context.Background(), []string{"F", "K"})
+		Expect(err).To(Equal(&searchAPI.MissingIDsError{IDs: []string{"F"}}))
+		vectors, err := vs.GetVectorsByID(context.Background(), []string{"F"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vectors).To(BeEmpty())
+	})
+
+	It("runs the purge as the expiry job", func() {
+		job := newEngine(searchAPI.ExpiryPolicy{PurgeInterval: time.Minute}).ExpiryJob()
+		Expect(job.Name).To(Equal("expiry"))
+		Expect(job.Interval).To(Equal(time.Minute))
+
+		clock.Advance(time.Hour)
+		Expect(job.Run(context.Background())).To(Succeed())
+		_, err := is.GetTattoosByID(context.Background(), []string{"F"})
+		Expect(err).To(Equal(&searchAPI.MissingIDsError{IDs: []string{"F"}}))
+	})
+
+	It("rejects expired records on import unless allowed", func() {
+		se := newServer(newEngine(searchAPI.ExpiryPolicy{}))
+		past := clock.Now().Add(-time.Minute)
+		body := ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "P", URLs: []string{"p.jpg"}, ExpiresAt: &past},
+			Vector:     &searchAPI.TattooImagesVector{ID: "P", Subject: searchAPI.LabelSet{"rose": 100}},
+		})
+
+		status, summary := doImport(se, nil, body)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Failed).To(Equal(1))
+		Expect(summary.Failures[0].Reason).To(ContainSubstring("expired"))
+
+		status, summary = doImport(se, url.Values{"allow_expired": {"true"}}, body)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Failed).To(BeZero())
+	})
+})
@@ -0,0 +1,151 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// exportPageSize is the number of collections read from the stores at once.
+const exportPageSize = 500
+
+// CollectionLister is implemented by the image stores.
+// Which can list all their collections in pages ordered by ID.
+// The cursor is empty for the first page, next is empty after the last.
+type CollectionLister interface {
+	ListCollections(ctx context.Context, cursor string, limit int) (page []TattooImagesCollection, next string, err error)
+}
+
+// ExportRecord is a line of a catalog export.
+// Vector is nil when the vector store has none for the collection.
+type ExportRecord struct {
+	Collection TattooImagesCollection `json:"collection"`
+	Vector     *TattooImagesVector    `json:"vector,omitempty"`
+}
+
+// Export calls fn with every record of the catalog ordered by ID, a page at a time.
+// A non-zero since keeps the records with a vector created at or after it.
+// flush is called after every page, it may be nil.
+func (e *SearchEngine) Export(ctx context.Context, since time.Time, fn func(ExportRecord) error, flush func()) error {
+	it, err := e.iterateCollections(ctx)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	lookup, _ := storeAs[VectorLookup](e.vectorStore)
+
+	for {
+		page, err := NextBatch(ctx, it, exportPageSize)
+		if errors.Is(err, ErrIteratorDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		vectors, err := e.lookupVectors(ctx, lookup, page)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page {
+			rec := ExportRecord{Collection: c}
+			if v, ok := vectors[c.ID]; ok {
+				rec.Vector = &v
+			}
+			if !since.IsZero() && (rec.Vector == nil || rec.Vector.CreatedAt.Before(since)) {
+				continue
+			}
+
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		if flush != nil {
+			flush()
+		}
+	}
+}
+
+func (e *SearchEngine) listCollections(ctx context.Context, lister CollectionLister, cursor string) ([]TattooImagesCollection, string, error) {
+	lcCtx, lcCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer lcCancel()
+
+	return lister.ListCollections(lcCtx, cursor, exportPageSize)
+}
+
+// lookupVectors returns the vectors of the collections by ID, none without a lookup.
+func (e *SearchEngine) lookupVectors(ctx context.Context, lookup VectorLookup, page []TattooImagesCollection) (map[string]TattooImagesVector, error) {
+	if lookup == nil || len(page) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(page))
+	for _, c := range page {
+		ids = append(ids, c.ID)
+	}
+
+	vlCtx, vlCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vlCancel()
+
+	vectors, err := lookup.GetVectorsByID(vlCtx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]TattooImagesVector, len(vectors))
+	for _, v := range vectors {
+		byID[v.ID] = v
+	}
+
+	return byID, nil
+}
+
+// handleExport streams the catalog as NDJSON.
+// Errors after the first record can only end the stream early.
+func handleExport(se *SearchEngine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_since", "since must be an RFC 3339 timestamp")
+				return
+			}
+		}
+
+		started := false
+		enc := json.NewEncoder(w)
+		write := func(rec ExportRecord) error {
+			if !started {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			return enc.Encode(rec)
+		}
+		flush := func() {
+			if started {
+				_ = http.NewResponseController(w).Flush()
+			}
+		}
+
+		err := se.Export(r.Context(), since, write, flush)
+		switch {
+		case err == nil && !started:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		case err == nil, errors.Is(err, context.Canceled):
+		case started:
+			slog.ErrorContext(r.Context(), "export ended early", "error", err)
+		case errors.Is(err, ErrExportUnsupported):
+			writeError(w, http.StatusNotImplemented, "export_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("export failed: %v", err))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package inkinspot_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doExport returns the records of an export with the params.
+func doExport(se *httptest.Server, token string, params url.Values) (int, []searchAPI.ExportRecord) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/export?"+params.Encode(), nil)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+
+	var records []searchAPI.ExportRecord
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var rec searchAPI.ExportRecord
+		Expect(json.Unmarshal(scanner.Bytes(), &rec)).To(Succeed())
+		records = append(records, rec)
+	}
+	Expect(scanner.Err()).NotTo(HaveOccurred())
+
+	return resp.StatusCode, records
+}
+
+var _ = Describe("Catalog export", func() {
+	const entries = 3000
+	var (
+		se     *httptest.Server
+		cutoff time.Time
+	)
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+
+		// the odd entries are created after the cutoff.
+		cutoff = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := range entries {
+			id := fmt.Sprintf("t%04d", i)
+			createdAt := cutoff.Add(-time.Hour)
+			if i%2 == 1 {
+				createdAt = cutoff.Add(time.Duration(i) * time.Minute)
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{
+				ID:        id,
+				Subject:   searchAPI.LabelSet{"lion": float64(i % 100)},
+				CreatedAt: createdAt,
+			})).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("requires the admin token", func() {
+		status, _ := doExport(se, "wrong", nil)
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("streams every collection with its vector ordered by ID", func() {
+		status, records := doExport(se, adminToken, nil)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(entries))
+		Expect(sort.SliceIsSorted(records, func(i, j int) bool {
+			return records[i].Collection.ID < records[j].Collection.ID
+		})).To(BeTrue())
+
+		rec := records[42]
+		Expect(rec.Collection).To(Equal(searchAPI.TattooImagesCollection{ID: "t0042", URLs: []string{"t0042.jpg"}, Version: 1}))
+		Expect(rec.Vector).NotTo(BeNil())
+		Expect(rec.Vector.ID).To(Equal("t0042"))
+		Expect(rec.Vector.Subject).To(Equal(searchAPI.LabelSet{"lion": 42}))
+	})
+
+	It("exports the records created since a timestamp", func() {
+		status, records := doExport(se, adminToken, url.Values{"since": {cutoff.Format(time.RFC3339)}})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(records).To(HaveLen(entries / 2))
+		for _, rec := range records {
+			Expect(rec.Vector.CreatedAt).NotTo(BeTemporally("<", cutoff))
+		}
+	})
+
+	It("rejects a malformed since", func() {
+		status, _ := doExport(se, adminToken, url.Values{"since": {"yesterday"}})
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,129 @@
+package inkinspot
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// FallbackPolicy keeps the last known good result of the searches.
+// It's served, marked stale, while the vector store fails.
+// Zero values are replaced by the defaults.
+type FallbackPolicy struct {
+	Enabled bool
+	// MaxEntries caps the searches whose last good result is kept.
+	MaxEntries int
+	// MaxAge is the age past which a last good result isn't served anymore.
+	MaxAge time.Duration
+	// Unavailable answers the stale results with 503 Service Unavailable instead of 200 OK.
+	Unavailable bool
+}
+
+func (p FallbackPolicy) withDefaults() FallbackPolicy {
+	if p.MaxEntries <= 0 {
+		p.MaxEntries = 1024
+	}
+	if p.MaxAge <= 0 {
+		p.MaxAge = time.Hour
+	}
+
+	return p
+}
+
+// lastKnownGood is an LRU of the last successful result of the searches, by their cache key.
+// A nil lastKnownGood is valid and keeps nothing.
+type lastKnownGood struct {
+	maxEntries int
+	maxAge     time.Duration
+	clock      Clock
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lastKnownGoodEntry struct {
+	key    string
+	result *SearchResult
+	added  time.Time
+}
+
+// newLastKnownGood creates the store of the policy, nil when it's disabled.
+func newLastKnownGood(p FallbackPolicy, clock Clock) *lastKnownGood {
+	if !p.Enabled {
+		return nil
+	}
+
+	return &lastKnownGood{
+		maxEntries: p.MaxEntries,
+		maxAge:     p.MaxAge,
+		clock:      clock,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the last good result of the search & its age, none past the max age.
+func (l *lastKnownGood) get(key string) (*SearchResult, time.Duration, bool) {
+	if l == nil {
+		return nil, 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	entry := el.Value.(*lastKnownGoodEntry)
+	age := l.clock.Now().Sub(entry.added)
+	if age > l.maxAge {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return nil, 0, false
+	}
+	l.order.MoveToFront(el)
+
+	return entry.result, age, true
+}
+
+// put keeps the result of the search, evicting the least recently used beyond the cap.
+func (l *lastKnownGood) put(key string, res *SearchResult) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		l.order.Remove(el)
+	}
+	l.entries[key] = l.order.PushFront(&lastKnownGoodEntry{key: key, result: res, added: l.clock.Now()})
+	for l.order.Len() > l.maxEntries {
+		back := l.order.Back()
+		l.order.Remove(back)
+		delete(l.entries, back.Value.(*lastKnownGoodEntry).key)
+	}
+}
+
+// fallback returns the last good result of the search when it failed on the vector store.
+func (e *SearchEngine) fallback(key string, err error) (*SearchResult, bool) {
+	var storeErr *StoreError
+	if !errors.As(err, &storeErr) || storeErr.Store != VectorStoreName {
+		return nil, false
+	}
+
+	last, age, ok := e.lastGood.get(key)
+	if !ok {
+		return nil, false
+	}
+	res := *last
+	res.Hits = dropExpired(res.Hits, e.clock.Now())
+	res.Stale = true
+	res.StaleAge = age
+
+	return &res, true
+}
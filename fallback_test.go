@@ -0,0 +1,74 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Last known good fallback", func() {
+	var clock *inkinspottest.FakeClock
+
+	// newServer serves stores whose vector store fails after its first query.
+	newServer := func(p searchAPI.FallbackPolicy) *httptest.Server {
+		GinkgoHelper()
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		dying := inkinspottest.NewFaultyStore(vs, inkinspottest.FailAfter(1))
+		cfg := searchAPI.Configuration{FallbackPolicy: p}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, dying, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+
+		warm := doQuery(se, "lion")
+		Expect(warm.Status).To(Equal(http.StatusOK))
+		Expect(warm.JSON.Stale).To(BeFalse())
+		return se
+	}
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	It("serves the last good result marked stale while the vector store fails", func() {
+		se := newServer(searchAPI.FallbackPolicy{Enabled: true, MaxAge: time.Hour})
+		clock.Advance(10 * time.Minute)
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Stale).To(BeTrue())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+		Expect(res.JSON.Meta.StaleAgeMS).To(BeNumerically("==", (10 * time.Minute).Milliseconds()))
+
+		Expect(doQuery(se, "tiger").Status).To(Equal(http.StatusInternalServerError), "nothing to fall back on")
+	})
+
+	It("refuses the last good result past the max age", func() {
+		se := newServer(searchAPI.FallbackPolicy{Enabled: true, MaxAge: time.Hour})
+		clock.Advance(time.Hour + time.Second)
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusInternalServerError))
+		Expect(res.JSON.Error.Code).To(Equal("vector_store_error"))
+	})
+
+	It("answers the stale result with 503 when configured to", func() {
+		se := newServer(searchAPI.FallbackPolicy{Enabled: true, Unavailable: true})
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusServiceUnavailable))
+		Expect(res.JSON.Stale).To(BeTrue())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+	})
+
+	It("fails the searches when disabled", func() {
+		se := newServer(searchAPI.FallbackPolicy{})
+
+		Expect(doQuery(se, "lion").Status).To(Equal(http.StatusInternalServerError))
+	})
+})
@@ -0,0 +1,227 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FeatureRecordVersion is the version of the FeatureRecord schema, raised on its incompatible changes.
+const FeatureRecordVersion = 1
+
+// FeatureLogPolicy shapes the log of the ranking features.
+// Zero values are replaced by the defaults.
+type FeatureLogPolicy struct {
+	// QueueSize is the number of records waiting for the logger, the searches past it drop theirs.
+	QueueSize int
+}
+
+func (p FeatureLogPolicy) withDefaults() FeatureLogPolicy {
+	if p.QueueSize <= 0 {
+		p.QueueSize = 1024
+	}
+
+	return p
+}
+
+// FeatureRecord is the ranking features of the hits of a search, the training data of the ranking weights.
+type FeatureRecord struct {
+	// Version is the FeatureRecordVersion of the record.
+	Version   int       `json:"version"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	// Tokens are the stems of the queries, labeled as the logs label the queries. Empty when the filters were browsed.
+	Tokens []string `json:"tokens"`
+	// Experiment & Variant are the assignment the hits were ranked by, empty out of the experiments.
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+	// Weights are the facet weights the hits were ranked by.
+	Weights map[string]float64 `json:"weights"`
+	Hits    []HitFeatures      `json:"hits"`
+}
+
+// HitFeatures is the features of a hit of a search.
+type HitFeatures struct {
+	ID string `json:"id"`
+	// Rank is the position of the hit from the offset of the page, 1 first.
+	Rank int `json:"rank"`
+	// Similarities are the summed proximities of the matched labels, by facet.
+	Similarities map[string]float64 `json:"similarities"`
+	// Freshness, Boost & Popularity are the multipliers of the score, 1 when not applied.
+	Freshness  float64 `json:"freshness"`
+	Boost      float64 `json:"boost"`
+	Popularity float64 `json:"popularity"`
+	RawScore   float64 `json:"raw_score"`
+	Score      float64 `json:"score"`
+}
+
+// FeatureLogger records the ranking features of the searches.
+// It's called from a single goroutine, off the search path.
+type FeatureLogger interface {
+	Log(ctx context.Context, rec FeatureRecord)
+}
+
+// WithFeatureLogger logs the ranking features of every search to the logger, none are logged by default.
+// The searches answer without waiting for it, their records are dropped while its queue is full.
+func WithFeatureLogger(l FeatureLogger) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.featureLogger = l
+	}
+}
+
+// NDJSONFeatureLogger writes the records as JSON lines.
+type NDJSONFeatureLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewNDJSONFeatureLogger writes the records to w, a line each.
+func NewNDJSONFeatureLogger(w io.Writer) *NDJSONFeatureLogger {
+	return &NDJSONFeatureLogger{enc: json.NewEncoder(w)}
+}
+
+// Log writes the record, its failure is logged.
+func (l *NDJSONFeatureLogger) Log(ctx context.Context, rec FeatureRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.enc.Encode(rec); err != nil {
+		slog.WarnContext(ctx, "writing the feature record failed", "request_id", rec.RequestID, "error", err)
+	}
+}
+
+// featureQueue hands the records to the logger from a goroutine, started by the first record.
+type featureQueue struct {
+	logger  FeatureLogger
+	items   chan featureItem
+	start   sync.Once
+	dropped atomic.Int64
+}
+
+// featureItem is a queued record, or a flush closing flushed once the records queued before it are logged.
+type featureItem struct {
+	rec     FeatureRecord
+	flushed chan struct{}
+}
+
+func newFeatureQueue(p FeatureLogPolicy, l FeatureLogger) *featureQueue {
+	return &featureQueue{logger: l, items: make(chan featureItem, p.QueueSize)}
+}
+
+// push queues the record, it's dropped & counted when the queue is full.
+func (q *featureQueue) push(rec FeatureRecord) {
+	q.start.Do(func() { go q.run() })
+
+	select {
+	case q.items <- featureItem{rec: rec}:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// flush waits for the records queued so far to be logged until ctx ends.
+func (q *featureQueue) flush(ctx context.Context) error {
+	q.start.Do(func() { go q.run() })
+
+	flushed := make(chan struct{})
+	select {
+	case q.items <- featureItem{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *featureQueue) run() {
+	for item := range q.items {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		q.logger.Log(context.Background(), item.rec)
+	}
+}
+
+// logFeatures queues the features of the hits of the search, when a feature logger is set.
+// The page starts at the offset.
+func (e *SearchEngine) logFeatures(requestID string, res *SearchResult, offset int) {
+	if e.features == nil {
+		return
+	}
+
+	rec := FeatureRecord{
+		Version:    FeatureRecordVersion,
+		Time:       e.clock.Now(),
+		RequestID:  requestID,
+		Experiment: res.Experiment.Experiment,
+		Variant:    res.Experiment.Variant,
+		Tokens:     []string{},
+		Weights: map[string]float64{
+			FacetStyle:   res.Ranking.StyleWeight,
+			FacetSubject: res.Ranking.SubjectWeight,
+			FacetArea:    res.Ranking.AreaWeight,
+		},
+		Hits: make([]HitFeatures, 0, len(res.Hits)),
+	}
+	for _, q := range res.Queries {
+		for _, stem := range q.Stems {
+			if token, ok := e.queryLabels.label(stem); ok {
+				rec.Tokens = append(rec.Tokens, token)
+			}
+		}
+	}
+	for i, h := range res.Hits {
+		f := HitFeatures{
+			ID:           h.Collection.ID,
+			Rank:         offset + i + 1,
+			Similarities: map[string]float64{FacetStyle: 0, FacetSubject: 0, FacetArea: 0},
+			Freshness:    multiplier(h.Freshness),
+			Boost:        multiplier(h.Boost),
+			Popularity:   multiplier(h.Popularity),
+			RawScore:     h.RawScore,
+			Score:        h.Score,
+		}
+		for _, m := range h.Matches {
+			f.Similarities[m.Facet] += m.Proximity
+		}
+		rec.Hits = append(rec.Hits, f)
+	}
+
+	e.features.push(rec)
+}
+
+// multiplier returns the score multiplier, 1 when it's unset.
+func multiplier(m float64) float64 {
+	if m == 0 {
+		return 1
+	}
+
+	return m
+}
+
+// FlushFeatures waits for the queued feature records to be logged until ctx ends.
+func (e *SearchEngine) FlushFeatures(ctx context.Context) error {
+	if e.features == nil {
+		return nil
+	}
+
+	return e.features.flush(ctx)
+}
+
+// DroppedFeatures returns the number of feature records dropped while the queue was full.
+func (e *SearchEngine) DroppedFeatures() int64 {
+	if e.features == nil {
+		return 0
+	}
+
+	return e.features.dropped.Load()
+}
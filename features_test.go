@@ -0,0 +1,151 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// blockingFeatureLogger holds every record until it's released.
+type blockingFeatureLogger struct {
+	held    chan string
+	release chan struct{}
+	logged  chan searchAPI.FeatureRecord
+}
+
+func newBlockingFeatureLogger() blockingFeatureLogger {
+	return blockingFeatureLogger{held: make(chan string, 10), release: make(chan struct{}), logged: make(chan searchAPI.FeatureRecord, 10)}
+}
+
+func (l blockingFeatureLogger) Log(_ context.Context, rec searchAPI.FeatureRecord) {
+	l.held <- rec.RequestID
+	<-l.release
+	l.logged <- rec
+}
+
+var _ = Describe("Feature logging", func() {
+	var now = time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)
+
+	initEngine := func(cfg searchAPI.Configuration, l searchAPI.FeatureLogger) (*searchAPI.SearchEngine, *httptest.Server) {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range []searchAPI.TattooImagesVector{
+			{ID: "T1", Subject: searchAPI.LabelSet{"lion": 0.9}, Area: searchAPI.LabelSet{"chest": 0.5}},
+			{ID: "T2", Subject: searchAPI.LabelSet{"lion": 0.4}, Style: searchAPI.LabelSet{"blackwork": 0.8}},
+			{ID: "T3", Subject: searchAPI.LabelSet{"rose": 0.9}},
+		} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		clock := inkinspottest.NewFakeClock(now)
+		engine := searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock), searchAPI.WithFeatureLogger(l))
+		se := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+		return engine, se
+	}
+
+	search := func(se *httptest.Server, params url.Values, id string) {
+		GinkgoHelper()
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?"+params.Encode(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set(searchAPI.RequestIDHeader, id)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	}
+
+	It("writes the features of the hits of a search as a versioned JSON line", func() {
+		var out bytes.Buffer
+		engine, se := initEngine(searchAPI.Configuration{}, searchAPI.NewNDJSONFeatureLogger(&out))
+
+		search(se, url.Values{"q": {"Lions"}}, "req-1")
+		Expect(engine.FlushFeatures(context.Background())).To(Succeed())
+
+		var rec searchAPI.FeatureRecord
+		Expect(json.Unmarshal(out.Bytes(), &rec)).To(Succeed())
+		// the scores are normalized by the best.
+		raw, best := 0.4, 0.9
+		Expect(rec).To(Equal(searchAPI.FeatureRecord{
+			Version:   searchAPI.FeatureRecordVersion,
+			Time:      now,
+			RequestID: "req-1",
+			Tokens:    []string{"lion"},
+			Weights:   map[string]float64{"style": 1, "subject": 1, "area": 1},
+			Hits: []searchAPI.HitFeatures{
+				{
+					ID: "T1", Rank: 1, Similarities: map[string]float64{"style": 0, "subject": 0.9, "area": 0},
+					Freshness: 1, Boost: 1, Popularity: 1, RawScore: 0.9, Score: 1,
+				},
+				{
+					ID: "T2", Rank: 2, Similarities: map[string]float64{"style": 0, "subject": 0.4, "area": 0},
+					Freshness: 1, Boost: 1, Popularity: 1, RawScore: 0.4, Score: raw / best,
+				},
+			},
+		}))
+		Expect(bytes.Count(out.Bytes(), []byte("\n"))).To(Equal(1))
+	})
+
+	It("ranks the hits of a page from its offset & labels the tokens as the logs do", func() {
+		var out bytes.Buffer
+		cfg := searchAPI.Configuration{PrivacyPolicy: searchAPI.PrivacyPolicy{LogQueries: searchAPI.LogQueriesNone}}
+		engine, se := initEngine(cfg, searchAPI.NewNDJSONFeatureLogger(&out))
+
+		search(se, url.Values{"q": {"lion"}, "offset": {"1"}}, "req-2")
+		Expect(engine.FlushFeatures(context.Background())).To(Succeed())
+
+		var rec searchAPI.FeatureRecord
+		Expect(json.Unmarshal(out.Bytes(), &rec)).To(Succeed())
+		Expect(rec.Tokens).To(BeEmpty())
+		Expect(rec.Hits).To(HaveLen(1))
+		Expect(rec.Hits[0].ID).To(Equal("T2"))
+		Expect(rec.Hits[0].Rank).To(Equal(2))
+	})
+
+	It("answers the searches without waiting for the logger, dropping the records past the queue", func() {
+		l := newBlockingFeatureLogger()
+		engine, se := initEngine(searchAPI.Configuration{FeatureLogPolicy: searchAPI.FeatureLogPolicy{QueueSize: 2}}, l)
+
+		search(se, url.Values{"q": {"lion"}}, "a")
+		Eventually(l.held).Should(Receive(Equal("a")))
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			for _, id := range []string{"b", "c", "d", "e"} {
+				search(se, url.Values{"q": {"lion"}}, id)
+			}
+		}()
+		Eventually(done).Should(BeClosed(), "the searches don't wait for the blocked logger")
+		// the logger holds a, b & c are queued.
+		Expect(engine.DroppedFeatures()).To(BeEquivalentTo(2))
+
+		close(l.release)
+		Expect(engine.FlushFeatures(context.Background())).To(Succeed())
+		Expect(l.logged).To(HaveLen(3))
+		Expect((<-l.logged).RequestID).To(Equal("a"))
+	})
+
+	It("gives up the flush when its context ends", func() {
+		l := newBlockingFeatureLogger()
+		engine, se := initEngine(searchAPI.Configuration{}, l)
+		DeferCleanup(func() { close(l.release) })
+
+		search(se, url.Values{"q": {"lion"}}, "a")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(engine.FlushFeatures(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+})
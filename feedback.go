@@ -0,0 +1,354 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Feedback actions of the users on the hits of a search.
+const (
+	FeedbackImpression = "impression"
+	FeedbackClick      = "click"
+)
+
+// FeedbackIDHeader carries the ID of a search the feedback on its hits refers to.
+// The server draws it for every search, the IDs sent by the clients aren't trusted.
+const FeedbackIDHeader = "X-Feedback-ID"
+
+// popularityPrior is the impressions added to every collection's, the CTR of the few impressions stays low.
+const popularityPrior = 10
+
+// maxFeedbackBodyBytes bounds the body of a feedback.
+const maxFeedbackBodyBytes = 4 << 10
+
+// FeedbackPolicy shapes the collection of the feedback on the searches.
+// Zero values are replaced by the defaults.
+type FeedbackPolicy struct {
+	// RequestTTL is how long the feedback on a search is accepted after it was served.
+	RequestTTL time.Duration
+	// Decay is the share of the counters kept every day by the default feedback store, within (0, 1].
+	Decay float64
+}
+
+func (p FeedbackPolicy) withDefaults() FeedbackPolicy {
+	if p.RequestTTL <= 0 {
+		p.RequestTTL = 30 * time.Minute
+	}
+	if p.Decay <= 0 || p.Decay > 1 {
+		p.Decay = 0.5
+	}
+
+	return p
+}
+
+// Feedback is an action of a user on a hit of a served search, known by the FeedbackIDHeader of its response.
+type Feedback struct {
+	FeedbackID   string `json:"feedback_id"`
+	CollectionID string `json:"collection_id"`
+	Action       string `json:"action"`
+}
+
+// FeedbackCounts are the decayed impressions & clicks of a collection.
+type FeedbackCounts struct {
+	Impressions float64 `json:"impressions"`
+	Clicks      float64 `json:"clicks"`
+}
+
+// CTR returns the click-through rate, smoothed toward 0 while the impressions are few.
+func (c FeedbackCounts) CTR() float64 {
+	return min(1, c.Clicks/(c.Impressions+popularityPrior))
+}
+
+// FeedbackStore keeps the feedback counters of the collections, decayed daily.
+// The counters must be atomic, whatever the concurrency.
+type FeedbackStore interface {
+	// AddFeedback counts the action on the collection at the time.
+	AddFeedback(ctx context.Context, id, action string, at time.Time) error
+	// GetFeedback returns the counters of the collections at the time, the ones without feedback are left out.
+	GetFeedback(ctx context.Context, ids []string, at time.Time) (map[string]FeedbackCounts, error)
+}
+
+// WithFeedbackStore keeps the feedback counters in the store, instead of in memory.
+func WithFeedbackStore(s FeedbackStore) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.feedback = s
+	}
+}
+
+// MemoryFeedbackStore keeps the feedback counters in memory.
+// They're multiplied by the decay on every UTC day boundary.
+type MemoryFeedbackStore struct {
+	mu       sync.Mutex
+	decay    float64
+	counters map[string]*decayedCounts
+}
+
+// decayedCounts are counters as of the day they were last decayed.
+type decayedCounts struct {
+	FeedbackCounts
+	day time.Time
+}
+
+// NewMemoryFeedbackStore keeps the share decay of the counters every day, none decay outside (0, 1).
+func NewMemoryFeedbackStore(decay float64) *MemoryFeedbackStore {
+	if decay <= 0 || decay > 1 {
+		decay = 1
+	}
+
+	return &MemoryFeedbackStore{decay: decay, counters: make(map[string]*decayedCounts)}
+}
+
+// AddFeedback counts the action on the collection at the time.
+func (s *MemoryFeedbackStore) AddFeedback(_ context.Context, id, action string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[id]
+	if !ok {
+		c = &decayedCounts{day: feedbackDay(at)}
+		s.counters[id] = c
+	}
+	s.decayTo(c, at)
+	switch action {
+	case FeedbackImpression:
+		c.Impressions++
+	case FeedbackClick:
+		c.Clicks++
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidFeedback, action)
+	}
+
+	return nil
+}
+
+// GetFeedback returns the counters of the collections at the time, the ones without feedback are left out.
+func (s *MemoryFeedbackStore) GetFeedback(_ context.Context, ids []string, at time.Time) (map[string]FeedbackCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]FeedbackCounts, len(ids))
+	for _, id := range ids {
+		if c, ok := s.counters[id]; ok {
+			s.decayTo(c, at)
+			out[id] = c.FeedbackCounts
+		}
+	}
+
+	return out, nil
+}
+
+// decayTo decays the counters for the days passed until the time, the earlier times leave them.
+func (s *MemoryFeedbackStore) decayTo(c *decayedCounts, at time.Time) {
+	day := feedbackDay(at)
+	if !day.After(c.day) {
+		return
+	}
+
+	kept := math.Pow(s.decay, float64(day.Sub(c.day)/(24*time.Hour)))
+	c.Impressions *= kept
+	c.Clicks *= kept
+	c.day = day
+}
+
+// feedbackDay returns the UTC day of the time.
+func feedbackDay(at time.Time) time.Time {
+	return at.UTC().Truncate(24 * time.Hour)
+}
+
+// servedRequests are the hits of the recently served searches, by feedback ID.
+type servedRequests struct {
+	mu       sync.Mutex
+	requests map[string]*servedRequest
+	pruneAt  time.Time
+}
+
+// servedRequest is the hits of a search & the actions recorded on them, each counted once.
+type servedRequest struct {
+	expires    time.Time
+	actions    map[string][]string
+	experiment ExperimentAssignment
+}
+
+// serve records the hits of the request, the expired requests are forgotten.
+func (s *servedRequests) serve(id string, ids []string, a ExperimentAssignment, now time.Time, ttl time.Duration) {
+	if id == "" || len(ids) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !now.Before(s.pruneAt) {
+		for rid, req := range s.requests {
+			if !now.Before(req.expires) {
+				delete(s.requests, rid)
+			}
+		}
+		s.pruneAt = now.Add(ttl / 2)
+	}
+
+	req := &servedRequest{expires: now.Add(ttl), actions: make(map[string][]string, len(ids)), experiment: a}
+	for _, cid := range ids {
+		req.actions[cid] = nil
+	}
+	s.requests[id] = req
+}
+
+// accept records the action on the hit of the request, it returns false when it was already recorded.
+// It returns the assignment of the request, or ErrUnservedFeedback when it expired or didn't serve the collection.
+func (s *servedRequests) accept(f Feedback, now time.Time) (ExperimentAssignment, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.requests[f.FeedbackID]
+	if !ok || !now.Before(req.expires) {
+		return ExperimentAssignment{}, false, fmt.Errorf("%w: search %q wasn't served recently", ErrUnservedFeedback, f.FeedbackID)
+	}
+	actions, ok := req.actions[f.CollectionID]
+	if !ok {
+		return ExperimentAssignment{}, false, fmt.Errorf("%w: search %q didn't serve %q", ErrUnservedFeedback, f.FeedbackID, f.CollectionID)
+	}
+	if slices.Contains(actions, f.Action) {
+		return req.experiment, false, nil
+	}
+	req.actions[f.CollectionID] = append(actions, f.Action)
+
+	return req.experiment, true, nil
+}
+
+// forget lets the action on the hit of the request be recorded again, once it couldn't be counted.
+func (s *servedRequests) forget(f Feedback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req, ok := s.requests[f.FeedbackID]; ok {
+		req.actions[f.CollectionID] = slices.DeleteFunc(req.actions[f.CollectionID], func(a string) bool { return a == f.Action })
+	}
+}
+
+// serveFeedback accepts the feedback on the hits of a search for a while, counted for its assignment.
+// It returns the new feedback ID of the search, empty when it served no hit.
+func (e *SearchEngine) serveFeedback(ids []string, a ExperimentAssignment) string {
+	if len(ids) == 0 {
+		return ""
+	}
+
+	id := newRequestID()
+	e.served.serve(id, ids, a, e.clock.Now(), e.configuration.FeedbackPolicy.RequestTTL)
+
+	return id
+}
+
+// setFeedbackID sets the feedback ID of the search on the response, when it has one.
+func setFeedbackID(w http.ResponseWriter, id string) {
+	if id != "" {
+		w.Header().Set(FeedbackIDHeader, id)
+	}
+}
+
+// RecordFeedback counts the action on a hit of a recently served search.
+// The repeated actions on a hit of a search are counted once.
+// It returns ErrInvalidFeedback or ErrUnservedFeedback when it isn't counted.
+func (e *SearchEngine) RecordFeedback(ctx context.Context, f Feedback) error {
+	if f.FeedbackID == "" || f.CollectionID == "" {
+		return fmt.Errorf("%w: feedback_id & collection_id are required", ErrInvalidFeedback)
+	}
+	if f.Action != FeedbackImpression && f.Action != FeedbackClick {
+		return fmt.Errorf("%w: action must be %q or %q", ErrInvalidFeedback, FeedbackImpression, FeedbackClick)
+	}
+
+	now := e.clock.Now()
+	experiment, fresh, err := e.served.accept(f, now)
+	if err != nil || !fresh {
+		return err
+	}
+
+	if err := e.feedback.AddFeedback(ctx, f.CollectionID, f.Action, now); err != nil {
+		e.served.forget(f)
+		return err
+	}
+	e.feedbackCounted.Add(1)
+	e.recordExperimentFeedback(experiment, f.Action)
+
+	return nil
+}
+
+// Feedback returns the decayed feedback counters of the collections, the ones without feedback are left out.
+func (e *SearchEngine) Feedback(ctx context.Context, ids []string) (map[string]FeedbackCounts, error) {
+	return e.feedback.GetFeedback(ctx, ids, e.clock.Now())
+}
+
+// boostPopularity multiplies the scores of the ranked vectors by their popularity as of the ranking time, when the policy boosts it.
+// The ranking is left as it was when the feedback store fails.
+func (e *SearchEngine) boostPopularity(ctx context.Context, ranked []RankedVector, ranking RankingPolicy) []RankedVector {
+	if ranking.PopularityBoost <= 0 || len(ranked) == 0 {
+		return ranked
+	}
+
+	ids := make([]string, len(ranked))
+	for i, rv := range ranked {
+		ids[i] = rv.ID
+	}
+	counts, err := e.feedback.GetFeedback(ctx, ids, e.rankingTime(ctx))
+	if err != nil {
+		slog.WarnContext(ctx, "feedback store failed, the popularity isn't ranked", "error", err)
+		return ranked
+	}
+
+	boosted := false
+	for i := range ranked {
+		c, ok := counts[ranked[i].ID]
+		if !ok || ranked[i].Score <= 0 {
+			continue
+		}
+		if p := ranking.popularity(c); p != 1 {
+			ranked[i].Popularity = p
+			ranked[i].Score *= p
+			boosted = true
+		}
+	}
+	if boosted {
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if ranked[i].Score != ranked[j].Score {
+				return ranked[i].Score > ranked[j].Score
+			}
+			return ranked[i].ID < ranked[j].ID
+		})
+	}
+
+	return ranked
+}
+
+// handleFeedback counts a feedback on a hit of a search, from its JSON body.
+func handleFeedback(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var f Feedback
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFeedbackBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+
+		switch err := se.RecordFeedback(r.Context(), f); {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrInvalidFeedback):
+			writeError(w, http.StatusBadRequest, "invalid_feedback", err.Error())
+		case errors.Is(err, ErrUnservedFeedback):
+			writeError(w, http.StatusUnprocessableEntity, "unserved_feedback", err.Error())
+		default:
+			slog.ErrorContext(r.Context(), "recording the feedback failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "recording the feedback failed")
+		}
+	})
+}
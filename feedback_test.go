@@ -0,0 +1,224 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Search feedback", func() {
+	var (
+		now    = time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)
+		clock  *inkinspottest.FakeClock
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+	)
+
+	initServer := func(cfg searchAPI.Configuration) {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range []searchAPI.TattooImagesVector{
+			{ID: "T1", Subject: searchAPI.LabelSet{"lion": 0.9}},
+			{ID: "T2", Subject: searchAPI.LabelSet{"lion": 0.8}},
+			{ID: "T3", Subject: searchAPI.LabelSet{"rose": 0.9}},
+		} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		clock = inkinspottest.NewFakeClock(now)
+		engine = searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	}
+
+	// search returns the IDs of the hits of the query & the feedback ID of the search, sent with the request ID when given.
+	search := func(query, requestID string) ([]string, string) {
+		GinkgoHelper()
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q="+query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if requestID != "" {
+			req.Header.Set(searchAPI.RequestIDHeader, requestID)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return collectionIDs(body.ImageCollections), resp.Header.Get(searchAPI.FeedbackIDHeader)
+	}
+
+	feedback := func(feedbackID, collectionID, action string) HTTPResult {
+		GinkgoHelper()
+		body := fmt.Sprintf(`{"feedback_id": %q, "collection_id": %q, "action": %q}`, feedbackID, collectionID, action)
+		resp, err := se.Client().Post(se.URL+"/feedback", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		res := HTTPResult{Status: resp.StatusCode}
+		if resp.StatusCode != http.StatusNoContent {
+			Expect(json.NewDecoder(resp.Body).Decode(&res.JSON)).To(Succeed())
+		}
+		return res
+	}
+
+	It("ranks the clicked collections up & decays their counters daily", func() {
+		initServer(searchAPI.Configuration{RankingPolicy: searchAPI.RankingPolicy{PopularityBoost: 1}})
+
+		ids, _ := search("lion", "")
+		Expect(ids).To(Equal([]string{"T1", "T2"}))
+
+		for range 10 {
+			_, id := search("lion", "")
+			Expect(feedback(id, "T1", searchAPI.FeedbackImpression).Status).To(Equal(http.StatusNoContent))
+			Expect(feedback(id, "T2", searchAPI.FeedbackImpression).Status).To(Equal(http.StatusNoContent))
+			Expect(feedback(id, "T2", searchAPI.FeedbackClick).Status).To(Equal(http.StatusNoContent))
+		}
+		Expect(engine.Feedback(context.Background(), []string{"T1", "T2", "T3"})).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T1": {Impressions: 10},
+			"T2": {Impressions: 10, Clicks: 10},
+		}))
+		// T2's CTR of 10 / (10 + 10) is capped at a multiplier of 1.5: 0.8 × 1.5 > 0.9.
+		ids, _ = search("lion", "")
+		Expect(ids).To(Equal([]string{"T2", "T1"}))
+
+		By("halving the counters every day")
+		clock.Advance(24 * time.Hour)
+		Expect(engine.Feedback(context.Background(), []string{"T2"})).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T2": {Impressions: 5, Clicks: 5},
+		}))
+		// 0.8 × (1 + 5 / 15) > 0.9.
+		ids, _ = search("lion", "")
+		Expect(ids).To(Equal([]string{"T2", "T1"}))
+
+		clock.Advance(2 * 24 * time.Hour)
+		// 0.8 × (1 + 1.25 / 11.25) < 0.9.
+		ids, _ = search("lion", "")
+		Expect(ids).To(Equal([]string{"T1", "T2"}))
+	})
+
+	It("counts an action on a hit of a search once", func() {
+		initServer(searchAPI.Configuration{})
+
+		_, id := search("lion", "req-1")
+		for range 3 {
+			Expect(feedback(id, "T2", searchAPI.FeedbackClick).Status).To(Equal(http.StatusNoContent))
+		}
+		By("searching again with the same request ID")
+		_, again := search("lion", "req-1")
+		Expect(again).NotTo(Equal(id))
+		Expect(feedback(id, "T2", searchAPI.FeedbackClick).Status).To(Equal(http.StatusNoContent))
+		Expect(engine.Feedback(context.Background(), []string{"T2"})).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T2": {Clicks: 1},
+		}))
+	})
+
+	It("doesn't take the request ID of the client for a feedback ID", func() {
+		initServer(searchAPI.Configuration{})
+
+		search("lion", "req-1")
+		res := feedback("req-1", "T1", searchAPI.FeedbackClick)
+		Expect(res.Status).To(Equal(http.StatusUnprocessableEntity))
+		Expect(res.JSON.Error.Code).To(Equal("unserved_feedback"))
+	})
+
+	It("doesn't rank the popularity by default", func() {
+		initServer(searchAPI.Configuration{})
+
+		_, id := search("lion", "")
+		Expect(feedback(id, "T2", searchAPI.FeedbackClick).Status).To(Equal(http.StatusNoContent))
+		ids, _ := search("lion", "")
+		Expect(ids).To(Equal([]string{"T1", "T2"}))
+	})
+
+	It("accepts the feedback on the searches answered from the body cache", func() {
+		initServer(searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true}})
+
+		_, first := search("lion", "")
+		_, second := search("lion", "")
+		Expect(second).NotTo(Equal(first), "the cached bodies get their own feedback IDs")
+		Expect(feedback(second, "T1", searchAPI.FeedbackClick).Status).To(Equal(http.StatusNoContent))
+	})
+
+	It("gives the searches their feedback ID", func() {
+		initServer(searchAPI.Configuration{})
+
+		_, id := search("lion", "")
+		Expect(id).NotTo(BeEmpty())
+		Expect(feedback(id, "T1", searchAPI.FeedbackImpression).Status).To(Equal(http.StatusNoContent))
+	})
+
+	DescribeTable("rejects the feedback on the hits it didn't serve",
+		func(served bool, collectionID string, elapsed time.Duration) {
+			initServer(searchAPI.Configuration{})
+			_, id := search("lion", "")
+			clock.Advance(elapsed)
+			if !served {
+				id = "unknown"
+			}
+
+			res := feedback(id, collectionID, searchAPI.FeedbackClick)
+			Expect(res.Status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(res.JSON.Error.Code).To(Equal("unserved_feedback"))
+		},
+		Entry("an unknown search", false, "T1", time.Duration(0)),
+		Entry("a collection the search didn't find", true, "T3", time.Duration(0)),
+		Entry("an expired search", true, "T1", 30*time.Minute),
+	)
+
+	DescribeTable("rejects the invalid feedback",
+		func(body, code string) {
+			initServer(searchAPI.Configuration{})
+			search("lion", "req-1")
+
+			resp, err := se.Client().Post(se.URL+"/feedback", "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			var res searchAPI.Response
+			Expect(json.NewDecoder(resp.Body).Decode(&res)).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(res.Error.Code).To(Equal(code))
+		},
+		Entry("an unknown action", `{"feedback_id": "req-1", "collection_id": "T1", "action": "like"}`, "invalid_feedback"),
+		Entry("no collection", `{"feedback_id": "req-1", "action": "click"}`, "invalid_feedback"),
+		Entry("an unknown field", `{"feedback_id": "req-1", "collection_id": "T1", "action": "click", "dwell": 3}`, "invalid_body"),
+	)
+})
+
+var _ = Describe("Memory feedback store", func() {
+	It("decays the counters on every day boundary", func() {
+		s := searchAPI.NewMemoryFeedbackStore(0.5)
+		at := time.Date(2026, 10, 5, 23, 0, 0, 0, time.UTC)
+		Expect(s.AddFeedback(context.Background(), "T1", searchAPI.FeedbackClick, at)).To(Succeed())
+		Expect(s.AddFeedback(context.Background(), "T1", searchAPI.FeedbackImpression, at)).To(Succeed())
+
+		Expect(s.GetFeedback(context.Background(), []string{"T1"}, at.Add(59*time.Minute))).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T1": {Impressions: 1, Clicks: 1},
+		}))
+		Expect(s.GetFeedback(context.Background(), []string{"T1"}, at.Add(time.Hour))).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T1": {Impressions: 0.5, Clicks: 0.5},
+		}))
+		Expect(s.AddFeedback(context.Background(), "T1", searchAPI.FeedbackClick, at.Add(49*time.Hour))).To(Succeed())
+		Expect(s.GetFeedback(context.Background(), []string{"T1", "T2"}, at.Add(49*time.Hour))).To(Equal(map[string]searchAPI.FeedbackCounts{
+			"T1": {Impressions: 0.125, Clicks: 1.125},
+		}))
+	})
+
+	It("rejects the unknown actions", func() {
+		s := searchAPI.NewMemoryFeedbackStore(0.5)
+		Expect(s.AddFeedback(context.Background(), "T1", "like", time.Now())).To(MatchError(searchAPI.ErrInvalidFeedback))
+	})
+})
@@ -0,0 +1,105 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+//go:embed fixtures/catalog.ndjson
+var sampleCatalog []byte
+
+// SampleCatalog returns the small catalog embedded for the demos & the tests, as an NDJSON export.
+// It holds the big cats of the tests: X & Y are lions, Z is a tiger.
+func SampleCatalog() io.Reader {
+	return bytes.NewReader(sampleCatalog)
+}
+
+// LoadFixtures writes the records of a fixture catalog to the stores & returns how many were written.
+// The catalog is an export, as NDJSON or as a JSON array of its records.
+// It stops at the first invalid record, the error names its line.
+func LoadFixtures(ctx context.Context, r io.Reader, is CollectionWriter, vs VectorWriter) (int, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxFixtureBytes+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(b) > maxFixtureBytes {
+		return 0, fmt.Errorf("%w: catalog over %d bytes", ErrInvalidRecord, maxFixtureBytes)
+	}
+
+	written := 0
+	err = fixtureRecords(b, func(line int, raw []byte) error {
+		var rec ExportRecord
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			return fmt.Errorf("line %d: %w: %w", line, ErrInvalidRecord, err)
+		}
+		rec.Collection.URLsTruncated = false
+		if err := validateRecord(rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := is.AddCollection(ctx, rec.Collection); err != nil {
+			return fmt.Errorf("line %d: %s: %w", line, rec.Collection.ID, err)
+		}
+		if rec.Vector != nil {
+			if err := vs.AddVector(ctx, *rec.Vector); err != nil {
+				return fmt.Errorf("line %d: %s: %w", line, rec.Collection.ID, err)
+			}
+		}
+		written++
+		return nil
+	})
+
+	return written, err
+}
+
+// maxFixtureBytes caps the size of a fixture catalog, it's read at once.
+const maxFixtureBytes = 64 << 20
+
+// fixtureRecords calls fn with the raw records of the catalog & the line they start on.
+// A catalog starting with [ is a JSON array, otherwise a record per line.
+func fixtureRecords(b []byte, fn func(line int, raw []byte) error) error {
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	if !bytes.HasPrefix(trimmed, []byte("[")) {
+		for i, raw := range bytes.Split(b, []byte("\n")) {
+			if len(bytes.TrimSpace(raw)) == 0 {
+				continue
+			}
+			if err := fn(i+1, raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("line 1: %w: %w", ErrInvalidRecord, err)
+	}
+	for dec.More() {
+		// the offset is before the separators of the record.
+		start := int(dec.InputOffset())
+		for start < len(b) && bytes.IndexByte([]byte(" \t\r\n,"), b[start]) >= 0 {
+			start++
+		}
+		line := 1 + bytes.Count(b[:start], []byte("\n"))
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("line %d: %w: %w", line, ErrInvalidRecord, err)
+		}
+		if err := fn(line, raw); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("line %d: %w: %w", 1+bytes.Count(b[:dec.InputOffset()], []byte("\n")), ErrInvalidRecord, err)
+	}
+
+	return nil
+}
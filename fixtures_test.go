@@ -0,0 +1,86 @@
+package inkinspot_test
+
+import (
+	"context"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// initSampleStores creates in-memory stores loaded with the embedded sample catalog.
+func initSampleStores() (*searchAPI.MemoryImageStore, *searchAPI.MemoryVectorStore) {
+	GinkgoHelper()
+	is := searchAPI.NewMemoryImageStore()
+	vs := searchAPI.NewMemoryVectorStore()
+	_, err := searchAPI.LoadFixtures(context.Background(), searchAPI.SampleCatalog(), is, vs)
+	Expect(err).NotTo(HaveOccurred())
+
+	return is, vs
+}
+
+var _ = Describe("Fixture catalogs", func() {
+	var (
+		is *searchAPI.MemoryImageStore
+		vs *searchAPI.MemoryVectorStore
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+	})
+
+	load := func(catalog string) (int, error) {
+		return searchAPI.LoadFixtures(context.Background(), strings.NewReader(catalog), is, vs)
+	}
+
+	It("embeds the big cats in the sample catalog", func() {
+		n, err := searchAPI.LoadFixtures(context.Background(), searchAPI.SampleCatalog(), is, vs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeNumerically(">=", len(inkinspottest.BigCats)))
+
+		for _, f := range inkinspottest.BigCats {
+			cols, err := is.GetTattoosByID(context.Background(), []string{f.Collection.ID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cols).To(HaveLen(1))
+			Expect(cols[0].URLs).To(Equal(f.Collection.URLs))
+
+			vectors, err := vs.GetVectorsByID(context.Background(), []string{f.Vector.ID})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vectors).To(HaveLen(1))
+			Expect(vectors[0].Subject).To(Equal(f.Vector.Subject))
+			Expect(vectors[0].Style).To(Equal(f.Vector.Style))
+			Expect(vectors[0].Area).To(Equal(f.Vector.Area))
+		}
+	})
+
+	It("loads a JSON array of records", func() {
+		n, err := load(`[
+			{"collection": {"ID": "A", "URLs": ["a.jpg"]}, "vector": {"ID": "A", "Subject": {"lion": 1}}},
+			{"collection": {"ID": "B"}}
+		]`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+
+		cols, err := is.GetTattoosByID(context.Background(), []string{"A", "B"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cols).To(HaveLen(2))
+	})
+
+	DescribeTable("names the line of the invalid record",
+		func(catalog, line string, written int) {
+			n, err := load(catalog)
+			Expect(err).To(MatchError(searchAPI.ErrInvalidRecord))
+			Expect(err).To(MatchError(HavePrefix(line + ":")))
+			Expect(n).To(Equal(written))
+		},
+		Entry("malformed NDJSON", "{\"collection\": {\"ID\": \"A\"}}\n\n{\"collection\": ", "line 3", 1),
+		Entry("unknown field", "{\"collection\": {\"ID\": \"A\"}, \"vectors\": []}", "line 1", 0),
+		Entry("vector of another ID", "{\"collection\": {\"ID\": \"A\"}}\n{\"collection\": {\"ID\": \"B\"}, \"vector\": {\"ID\": \"C\"}}", "line 2", 1),
+		Entry("array record without an ID", "[\n  {\"collection\": {\"ID\": \"A\"}},\n  {\"collection\": {}}\n]", "line 3", 1),
+		Entry("negative proximity in an array", "[{\"collection\": {\"ID\": \"A\"}},\n\n{\"collection\": {\"ID\": \"B\"}, \"vector\": {\"ID\": \"B\", \"Style\": {\"bw\": -1}}}]", "line 3", 1),
+	)
+})
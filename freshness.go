@@ -0,0 +1,33 @@
+package inkinspot
+
+import (
+	"math"
+	"time"
+)
+
+// FreshnessPolicy boosts the score of the recently added tattoos.
+// The score is multiplied by 1 + Boost * exp(-age/HalfLife), a zero Boost disables it.
+type FreshnessPolicy struct {
+	Boost    float64
+	HalfLife time.Duration
+}
+
+func (p FreshnessPolicy) withDefaults() FreshnessPolicy {
+	if p.HalfLife <= 0 {
+		p.HalfLife = 30 * 24 * time.Hour
+	}
+
+	return p
+}
+
+// factor returns the score multiplier of a vector created at createdAt.
+// Vectors without a creation time aren't boosted, future ones count as created now.
+func (p FreshnessPolicy) factor(createdAt, now time.Time) float64 {
+	if p.Boost <= 0 || createdAt.IsZero() {
+		return 1
+	}
+
+	age := max(0, now.Sub(createdAt))
+
+	return 1 + p.Boost*math.Exp(-float64(age)/float64(p.HalfLife))
+}
@@ -0,0 +1,60 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Freshness boost", func() {
+	initServer := func(freshness searchAPI.FreshnessPolicy) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+
+		now := time.Now()
+		for _, v := range []searchAPI.TattooImagesVector{
+			{ID: "old", Subject: searchAPI.LabelSet{"lion": 100}, CreatedAt: now.Add(-365 * 24 * time.Hour)},
+			{ID: "new", Subject: searchAPI.LabelSet{"lion": 90}, CreatedAt: now.Add(-time.Hour)},
+		} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{FreshnessPolicy: freshness}, is, vs)
+		se := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+
+		return se
+	}
+
+	When("the boost is disabled", func() {
+		It("ranks by the label match only", func() {
+			se := initServer(searchAPI.FreshnessPolicy{})
+			res := doSearch(se, url.Values{"q": {"lion"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"old", "new"}))
+			Expect(res.JSON.Explain.Hits[0].Freshness).To(BeZero())
+		})
+	})
+
+	When("the boost is enabled", func() {
+		It("ranks a newer, slightly worse match above an older one", func() {
+			se := initServer(searchAPI.FreshnessPolicy{Boost: 0.5, HalfLife: 7 * 24 * time.Hour})
+			res := doSearch(se, url.Values{"q": {"lion"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"new", "old"}))
+
+			hit := res.JSON.Explain.Hits[0]
+			Expect(hit.Freshness).To(BeNumerically("~", 1.5, 0.01))
+			Expect(hit.RawScore).To(BeNumerically("~", 90*hit.Freshness, 0.001))
+		})
+	})
+})
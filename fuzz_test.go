@@ -0,0 +1,122 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"unicode/utf8"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+)
+
+// fuzzSeeds are the seed corpus of the query fuzz targets.
+var fuzzSeeds = []string{
+	"realistic black and white lion on chest",
+	"",
+	"   ",
+	"LION\tTIGER\nchest",
+	"\"black and white\" lion",
+	"\"unterminated phrase",
+	`"escaped \" quote"`,
+	"lion AND (tiger OR NOT chest)",
+	"((((",
+	"🦁 lion 🐯 tiger",
+	"👩‍🎤 flag 🏳️‍🌈",
+	"אריה על החזה",
+	"أسد على الصدر",
+	"‮evil‬ lion",
+	"Ｌｉｏｎ ﬁne ǅ",
+	"café naïve ﬀ Å Å",
+	"%00%ff%fe lion%20chest %zz",
+	"%E2%80%AE%F0%9F%A6%81",
+	"lion\x00chest",
+	"\xff\xfe\xfd",
+	"li\xc3on",
+	"ß ẞ ΣΑΣ ς",
+	"İstanbul ı",
+	"Ꭰ ꭰ",
+	"\U000100a8\u0301 \U000103d2\u0301",
+}
+
+func FuzzNormalizeQuery(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, n := range []searchAPI.Normalizer{{}, {KeepDiacritics: true}} {
+			once := n.Normalize(s)
+			if !utf8.ValidString(once) {
+				t.Fatalf("Normalize(%q) = %q is not valid UTF-8", s, once)
+			}
+			if twice := n.Normalize(once); twice != once {
+				t.Fatalf("Normalize isn't idempotent: %q -> %q -> %q", s, once, twice)
+			}
+		}
+	})
+}
+
+func FuzzParseQuery(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s, "")
+		f.Add(s, "he")
+	}
+
+	is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+	eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+
+	f.Fuzz(func(t *testing.T, q, lang string) {
+		res, err := eng.MultiSearch(context.Background(), []string{q}, searchAPI.SearchOptions{Lang: lang})
+		if err != nil {
+			return
+		}
+
+		for _, pq := range res.Queries {
+			strs := append([]string{pq.Text, pq.Lang, pq.Expr}, pq.Terms...)
+			strs = append(strs, pq.Stems...)
+			for _, s := range strs {
+				if !utf8.ValidString(s) {
+					t.Fatalf("parsing %q gave %q, which is not valid UTF-8", q, s)
+				}
+			}
+			for _, ph := range pq.Phrases {
+				if ph.Start < 0 || ph.Start > ph.End || ph.End > len(pq.Text) {
+					t.Fatalf("parsing %q gave the phrase %+v out of the text %q", q, ph, pq.Text)
+				}
+			}
+		}
+	})
+}
+
+func FuzzSearchHandler(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add("q=" + url.QueryEscape(s))
+		f.Add("q=" + s)
+	}
+	f.Add("q=lion&q=tiger&lang=he&group_by=style&offset=1&limit=2&min_score=0.1&w_style=2")
+	f.Add("q=lion&cursor=%%%&explain=true")
+
+	is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+	handler := searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs))
+
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.URL.RawQuery = rawQuery
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code >= http.StatusInternalServerError && rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("GET /search?%s returned %d: %s", rawQuery, rec.Code, rec.Body)
+		}
+		if !utf8.Valid(rec.Body.Bytes()) {
+			t.Fatalf("GET /search?%s returned a body which is not valid UTF-8", rawQuery)
+		}
+		if rec.Header().Get("Content-Type") == "application/json" && !json.Valid(rec.Body.Bytes()) {
+			t.Fatalf("GET /search?%s returned invalid JSON: %s", rawQuery, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package inkinspot
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FuzzyPolicy controls the typo tolerant matching of the query terms.
+// Terms unknown to the vocabulary fall back to the closest known term
+// within edit distance 1, or 2 for terms of 6 characters or more.
+type FuzzyPolicy struct {
+	Enabled bool
+	// MaxDistance caps the edit distance of a correction.
+	MaxDistance int
+	// Penalty is the score fraction lost per edit of a corrected match.
+	Penalty float64
+}
+
+func (p FuzzyPolicy) withDefaults() FuzzyPolicy {
+	if p.MaxDistance <= 0 {
+		p.MaxDistance = 2
+	}
+	if p.Penalty <= 0 {
+		p.Penalty = 0.25
+	}
+
+	return p
+}
+
+// maxDistance returns the edit distance allowed for the term.
+func (p FuzzyPolicy) maxDistance(term string) int {
+	n := utf8.RuneCountInString(term)
+	d := 1
+	switch {
+	case n < 3:
+		return 0
+	case n >= 6:
+		d = 2
+	}
+
+	return min(d, p.MaxDistance)
+}
+
+// factor returns the score multiplier of a match corrected by distance edits.
+func (p FuzzyPolicy) factor(distance int) float64 {
+	return max(0, 1-p.Penalty*float64(distance))
+}
+
+// TermSuggester is implemented by the vector stores.
+// Which can suggest the vocabulary terms close to a query term.
+type TermSuggester interface {
+	SuggestTerms(ctx context.Context, term string, maxDistance int) ([]TermSuggestion, error)
+}
+
+// TermSuggestion is a vocabulary term & its edit distance from the query term.
+type TermSuggestion struct {
+	Term     string
+	Distance int
+}
+
+// TermCorrection records a query stem replaced by a vocabulary term.
+type TermCorrection struct {
+	Stem       string `json:"stem"`
+	Correction string `json:"correction"`
+	Distance   int    `json:"distance"`
+}
+
+// correctQueries replaces the stems unknown to the vector store vocabulary.
+// With their closest suggestion, when fuzzy matching is on.
+func (e *SearchEngine) correctQueries(ctx context.Context, queries []ParsedQuery) ([]ParsedQuery, error) {
+	policy := e.configuration.FuzzyPolicy
+	suggester, ok := storeAs[TermSuggester](e.vectorStore)
+	if !policy.Enabled || !ok {
+		return queries, nil
+	}
+
+	scCtx, scCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer scCancel()
+
+	for i := range queries {
+		q := &queries[i]
+		for j, stem := range q.Stems {
+			// phrases are matched as a unit, never corrected.
+			d := policy.maxDistance(stem)
+			if d == 0 || strings.Contains(stem, " ") {
+				continue
+			}
+
+			suggestions, err := suggester.SuggestTerms(scCtx, stem, d)
+			if err != nil {
+				return nil, e.storeError(VectorStoreName, "suggest", err)
+			}
+			if len(suggestions) == 0 || suggestions[0].Distance == 0 {
+				continue
+			}
+
+			best := suggestions[0]
+			q.Stems[j] = best.Term
+			if q.expr != nil {
+				q.expr.replaceStem(stem, best.Term)
+			}
+			q.Corrections = append(q.Corrections, TermCorrection{Stem: stem, Correction: best.Term, Distance: best.Distance})
+		}
+	}
+
+	return queries, nil
+}
+
+// Vocabulary indexes terms in a BK-tree for edit distance lookups.
+// It isn't safe for concurrent use.
+type Vocabulary struct {
+	root   *bkNode
+	counts map[string]int
+}
+
+type bkNode struct {
+	term     string
+	children map[int]*bkNode
+}
+
+// NewVocabulary creates an empty vocabulary.
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{counts: make(map[string]int)}
+}
+
+// Add counts an occurrence of the term.
+func (v *Vocabulary) Add(term string) {
+	v.counts[term]++
+	if v.counts[term] > 1 {
+		return
+	}
+
+	if v.root == nil {
+		v.root = &bkNode{term: term}
+		return
+	}
+
+	node := v.root
+	for {
+		d := editDistance(term, node.term)
+		if d == 0 {
+			return
+		}
+
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{term: term}
+			return
+		}
+		node = child
+	}
+}
+
+// Remove discounts an occurrence of the term.
+// Terms without occurrences stay in the tree but are never suggested.
+func (v *Vocabulary) Remove(term string) {
+	if v.counts[term] <= 1 {
+		delete(v.counts, term)
+		return
+	}
+	v.counts[term]--
+}
+
+// Suggest returns the terms within maxDistance edits of term.
+// Ordered by distance, then by occurrences & lexically.
+func (v *Vocabulary) Suggest(term string, maxDistance int) []TermSuggestion {
+	var out []TermSuggestion
+	if v.root == nil {
+		return out
+	}
+
+	stack := []*bkNode{v.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := editDistance(term, node.term)
+		if d <= maxDistance && v.counts[node.term] > 0 {
+			out = append(out, TermSuggestion{Term: node.term, Distance: d})
+		}
+		// the triangle inequality bounds the subtrees worth visiting.
+		for cd, child := range node.children {
+			if cd >= d-maxDistance && cd <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Distance != out[j].Distance {
+			return out[i].Distance < out[j].Distance
+		}
+		if ci, cj := v.counts[out[i].Term], v.counts[out[j].Term]; ci != cj {
+			return ci > cj
+		}
+		return out[i].Term < out[j].Term
+	})
+
+	return out
+}
+
+// editDistance returns the Levenshtein distance between a & b in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,90 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fuzzy matching", func() {
+	initServer := func(fuzzy searchAPI.FuzzyPolicy) *httptest.Server {
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{FuzzyPolicy: fuzzy})))
+		DeferCleanup(se.Close)
+
+		return se
+	}
+
+	Context("Vocabulary", func() {
+		It("suggests the terms within the distance closest first", func() {
+			v := searchAPI.NewVocabulary()
+			for _, term := range []string{"realistic", "lion", "line", "linework", "chest", "chest"} {
+				v.Add(term)
+			}
+
+			Expect(v.Suggest("lion", 0)).To(Equal([]searchAPI.TermSuggestion{{Term: "lion", Distance: 0}}))
+			Expect(v.Suggest("lino", 2)).To(Equal([]searchAPI.TermSuggestion{
+				{Term: "line", Distance: 1},
+				{Term: "lion", Distance: 2},
+			}))
+			Expect(v.Suggest("relistic", 1)).To(Equal([]searchAPI.TermSuggestion{{Term: "realistic", Distance: 1}}))
+		})
+
+		It("stops suggesting removed terms", func() {
+			v := searchAPI.NewVocabulary()
+			v.Add("chest")
+			v.Add("chest")
+			v.Remove("chest")
+			Expect(v.Suggest("chst", 1)).To(HaveLen(1))
+
+			v.Remove("chest")
+			Expect(v.Suggest("chst", 1)).To(BeEmpty())
+		})
+	})
+
+	When("fuzzy matching is enabled", func() {
+		It("matches terms with a typo", func() {
+			se := initServer(searchAPI.FuzzyPolicy{Enabled: true})
+			res := doSearch(se, url.Values{"q": {"relistic lion"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+
+			Expect(res.JSON.Explain.Queries[0].Corrections).To(Equal([]searchAPI.TermCorrection{
+				{Stem: "relistic", Correction: "realistic", Distance: 1},
+			}))
+		})
+
+		It("ranks the corrected matches below the exact ones", func() {
+			se := initServer(searchAPI.FuzzyPolicy{Enabled: true, Penalty: 0.25})
+			res := doSearch(se, url.Values{"q": {"lion chst"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y", "Z"}))
+
+			hits := res.JSON.Explain.Hits
+			Expect(hits[0].RawScore).To(BeNumerically("==", 175))
+			Expect(hits[1].RawScore).To(BeNumerically("==", 100))
+			Expect(hits[2].RawScore).To(BeNumerically("==", 75))
+			Expect(hits[2].Matches[0].Distance).To(Equal(1))
+		})
+
+		It("doesn't correct short terms", func() {
+			se := initServer(searchAPI.FuzzyPolicy{Enabled: true})
+			res := doSearch(se, url.Values{"q": {"bx"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.ImageCollections).To(BeEmpty())
+		})
+	})
+
+	When("fuzzy matching is disabled", func() {
+		It("doesn't match terms with a typo", func() {
+			se := initServer(searchAPI.FuzzyPolicy{})
+			res := doSearch(se, url.Values{"q": {"relistic chst"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.ImageCollections).To(BeEmpty())
+		})
+	})
+})
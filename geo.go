@@ -0,0 +1,126 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKM is the mean radius of the Earth.
+const earthRadiusKM = 6371.0
+
+// maxRadiusKM is half the circumference of the Earth, a wider radius filters nothing.
+const maxRadiusKM = math.Pi * earthRadiusKM
+
+// Location is where a tattoo was made, by its WGS 84 coordinates in degrees.
+type Location struct {
+	Lat  float64
+	Lng  float64
+	City string `json:",omitempty"`
+}
+
+// validate checks the coordinates are on Earth.
+func (l Location) validate() error {
+	if math.IsNaN(l.Lat) || l.Lat < -90 || l.Lat > 90 {
+		return fmt.Errorf("%w: latitude %v must be within -90 and 90", ErrInvalidLocation, l.Lat)
+	}
+	if math.IsNaN(l.Lng) || l.Lng < -180 || l.Lng > 180 {
+		return fmt.Errorf("%w: longitude %v must be within -180 and 180", ErrInvalidLocation, l.Lng)
+	}
+
+	return nil
+}
+
+// distanceKM returns the great-circle distance to the other location by the haversine formula.
+func (l Location) distanceKM(other Location) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(other.Lat - l.Lat)
+	dLng := toRad(other.Lng - l.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(l.Lat))*math.Cos(toRad(other.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadiusKM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// parseNear reads the near & radius_km query parameters, nil when there's no near.
+func parseNear(rawNear, rawRadius string) (*Location, float64, error) {
+	if rawNear == "" {
+		if rawRadius != "" {
+			return nil, 0, fmt.Errorf("%w: radius_km requires near", ErrInvalidLocation)
+		}
+		return nil, 0, nil
+	}
+
+	rawLat, rawLng, ok := strings.Cut(rawNear, ",")
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: near must be lat,lng", ErrInvalidLocation)
+	}
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(rawLat), 64)
+	lng, errLng := strconv.ParseFloat(strings.TrimSpace(rawLng), 64)
+	if err := errors.Join(errLat, errLng); err != nil {
+		return nil, 0, fmt.Errorf("%w: near must be lat,lng", ErrInvalidLocation)
+	}
+	near := Location{Lat: lat, Lng: lng}
+
+	radius, err := strconv.ParseFloat(rawRadius, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: radius_km must be a number", ErrInvalidLocation)
+	}
+
+	return &near, radius, nil
+}
+
+// validateNear checks the center & the radius of a near filter.
+func validateNear(near Location, radiusKM float64) error {
+	if err := near.validate(); err != nil {
+		return err
+	}
+	if math.IsNaN(radiusKM) || radiusKM <= 0 || radiusKM > maxRadiusKM {
+		return fmt.Errorf("%w: radius_km must be within 0 and %.0f", ErrInvalidLocation, maxRadiusKM)
+	}
+
+	return nil
+}
+
+// filterNear keeps the matches whose collection is located within the radius of near.
+// The collections of every match are fetched, so any image store can be filtered.
+// It returns the distances of the kept matches by ID alongside.
+func (e *SearchEngine) filterNear(ctx context.Context, ranked []RankedVector, near Location, radiusKM float64) ([]RankedVector, map[string]float64, error) {
+	ids := make([]string, 0, len(ranked))
+	for _, rv := range ranked {
+		ids = append(ids, rv.ID)
+	}
+
+	isCtx, isCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+	defer isCancel()
+
+	cols, err := foundOnly(e.getCollections(isCtx, ids))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrImageStoreTimeout, err)
+		}
+		return nil, nil, e.storeError(ImageStoreName, "get", err)
+	}
+
+	distances := make(map[string]float64, len(cols))
+	for _, c := range cols {
+		if c.Location == nil {
+			continue
+		}
+		if d := near.distanceKM(*c.Location); d <= radiusKM {
+			distances[c.ID] = d
+		}
+	}
+
+	out := make([]RankedVector, 0, len(distances))
+	for _, rv := range ranked {
+		if _, ok := distances[rv.ID]; ok {
+			out = append(out, rv)
+		}
+	}
+
+	return out, distances, nil
+}
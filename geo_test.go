@@ -0,0 +1,92 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Location filter", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+
+		// Jerusalem is 53 km from Tel Aviv & Haifa 81 km, N has no location.
+		for _, c := range []searchAPI.TattooImagesCollection{
+			{ID: "TLV", URLs: []string{"tlv.jpg"}, Location: &searchAPI.Location{Lat: 32.08, Lng: 34.78, City: "Tel Aviv"}},
+			{ID: "JLM", URLs: []string{"jlm.jpg"}, Location: &searchAPI.Location{Lat: 31.77, Lng: 35.21, City: "Jerusalem"}},
+			{ID: "HFA", URLs: []string{"hfa.jpg"}, Location: &searchAPI.Location{Lat: 32.79, Lng: 34.99, City: "Haifa"}},
+			{ID: "N", URLs: []string{"n.jpg"}},
+		} {
+			Expect(is.AddCollection(context.Background(), c)).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: c.ID, Subject: searchAPI.LabelSet{"rose": 100}})).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("keeps the collections within the radius & reports their distance", func() {
+		res := doSearch(se, url.Values{"q": {"rose"}, "near": {"32.08,34.78"}, "radius_km": {"60"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("TLV", "JLM"))
+		Expect(res.JSON.Total).To(Equal(2))
+		Expect(res.JSON.DistancesKM).To(HaveLen(2))
+		Expect(res.JSON.DistancesKM["TLV"]).To(BeNumerically("~", 0, 0.001))
+		Expect(res.JSON.DistancesKM["JLM"]).To(BeNumerically("~", 53.25, 0.01))
+
+		res = doSearch(se, url.Values{"q": {"rose"}, "near": {"32.08,34.78"}, "radius_km": {"100"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("TLV", "JLM", "HFA"))
+		Expect(res.JSON.DistancesKM["HFA"]).To(BeNumerically("~", 81.37, 0.01))
+
+		res = doSearch(se, url.Values{"q": {"rose"}, "near": {"32.08,34.78"}, "radius_km": {"10"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"TLV"}))
+	})
+
+	It("leaves the distances out without a near filter", func() {
+		res := doSearch(se, url.Values{"q": {"rose"}})
+		Expect(res.JSON.ImageCollections).To(HaveLen(4))
+		Expect(res.JSON.DistancesKM).To(BeNil())
+	})
+
+	DescribeTable("rejects invalid coordinates & radiuses",
+		func(near, radius string) {
+			params := url.Values{"q": {"rose"}}
+			if near != "" {
+				params.Set("near", near)
+			}
+			if radius != "" {
+				params.Set("radius_km", radius)
+			}
+			res := doSearch(se, params)
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("invalid_location"))
+		},
+		Entry("latitude out of range", "91,34", "10"),
+		Entry("longitude out of range", "32,181", "10"),
+		Entry("malformed near", "32.08", "10"),
+		Entry("not a number", "north,34", "10"),
+		Entry("missing radius", "32.08,34.78", ""),
+		Entry("negative radius", "32.08,34.78", "-5"),
+		Entry("radius past the antipode", "32.08,34.78", "30000"),
+		Entry("radius without near", "", "10"),
+	)
+
+	It("rejects invalid locations on import", func() {
+		status, summary := doImport(se, nil, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "X", Location: &searchAPI.Location{Lat: 120, Lng: 0}},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Failed).To(Equal(1))
+		Expect(summary.Failures[0].Reason).To(ContainSubstring("latitude"))
+	})
+})
@@ -0,0 +1,89 @@
+package inkinspot_test
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var updateGoldens = flag.Bool("update", false, "rewrite the golden files of the response shape specs")
+
+// expectGolden compares the body with testdata/<name>.golden.json, which -update rewrites.
+func expectGolden(name string, body []byte) {
+	GinkgoHelper()
+	path := filepath.Join("testdata", name+".golden.json")
+	if *updateGoldens {
+		Expect(os.MkdirAll("testdata", 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, body, 0o644)).To(Succeed())
+	}
+
+	golden, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred(), "run the specs with -update to create %s", path)
+	Expect(string(body)).To(Equal(string(golden)), "%s differs, run the specs with -update if the change is intended", path)
+}
+
+var _ = Describe("Response shapes", func() {
+	var (
+		se    *httptest.Server
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{CursorPolicy: searchAPI.CursorPolicy{Secret: []byte("golden")}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	get := func(path string) (int, []byte) {
+		GinkgoHelper()
+		resp, err := se.Client().Get(se.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, body
+	}
+
+	DescribeTable("match their golden files",
+		func(name, path string, status int) {
+			code, body := get(path)
+			Expect(code).To(Equal(status))
+			expectGolden(name, body)
+		},
+		Entry("success", "search_success", "/search?q=lion", http.StatusOK),
+		Entry("success with explain & meta", "search_debug", "/search?q=black+lion&explain=true&debug_meta=true", http.StatusOK),
+		Entry("paginated", "search_paginated", "/search?q=lion&limit=1", http.StatusOK),
+		Entry("grouped", "search_grouped", "/search?q=chest&group_by=subject", http.StatusOK),
+		Entry("empty", "search_empty", "/search?q=dragon", http.StatusOK),
+		Entry("400 Bad Request", "search_bad_request", "/search?q=", http.StatusBadRequest),
+		Entry("400 Bad Request for a page", "search_bad_page", "/search?q=lion&limit=0", http.StatusBadRequest),
+		Entry("404 Not Found", "not_found", "/nowhere", http.StatusNotFound),
+	)
+
+	It("matches the golden file of a 504 Gateway Timeout", func() {
+		slowClock := inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		slow := inkinspottest.NewLatencyStore(is, time.Hour, inkinspottest.WithLatencyClock(slowClock))
+		srv := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, slow, vs, searchAPI.WithClock(slowClock))))
+		DeferCleanup(srv.Close)
+
+		timeout := searchAPI.DefaultConfiguration().TimeoutPolicy.ImageStoreTimeout
+		res := advanceDuring(slowClock, timeout, func() HTTPResult { return doQuery(srv, "lion") })
+		Expect(res.Status).To(Equal(http.StatusGatewayTimeout))
+		expectGolden("search_timeout", res.Body)
+	})
+})
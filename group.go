@@ -0,0 +1,94 @@
+package inkinspot
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// OtherGroup is the group of the hits without a label in the grouped facet.
+const OtherGroup = "other"
+
+// MaxGroupLimit caps the results returned per group.
+const MaxGroupLimit = 100
+
+// ResultGroup is a bucket of hits sharing their dominant label in a facet.
+// Count is the number of hits in the group, Results may be limited.
+type ResultGroup struct {
+	Label   string                   `json:"label"`
+	Count   int                      `json:"count"`
+	Results []TattooImagesCollection `json:"results"`
+}
+
+// Groups buckets the hits by their dominant label in the facet.
+// Groups are ordered by their best hit, the hits keep the rank order.
+// A positive limit caps the results per group.
+func (r *SearchResult) Groups(facet string, limit int) ([]ResultGroup, error) {
+	if facet != FacetStyle && facet != FacetSubject && facet != FacetArea {
+		return nil, fmt.Errorf("%w: can't group by %q", ErrInvalidGrouping, facet)
+	}
+
+	var groups []ResultGroup
+	index := make(map[string]int)
+	for _, h := range r.Hits {
+		label := dominantLabel(h.Vector.facet(facet))
+		if label == "" {
+			label = OtherGroup
+		}
+
+		at, ok := index[label]
+		if !ok {
+			at = len(groups)
+			index[label] = at
+			groups = append(groups, ResultGroup{Label: label, Results: []TattooImagesCollection{}})
+		}
+
+		g := &groups[at]
+		g.Count++
+		if limit <= 0 || len(g.Results) < limit {
+			g.Results = append(g.Results, h.Collection)
+		}
+	}
+
+	return groups, nil
+}
+
+// facet returns the label set of the named facet.
+func (v TattooImagesVector) facet(name string) LabelSet {
+	switch name {
+	case FacetStyle:
+		return v.Style
+	case FacetSubject:
+		return v.Subject
+	case FacetArea:
+		return v.Area
+	}
+
+	return nil
+}
+
+// dominantLabel returns the label of the highest proximity, ties lexically.
+// It's empty when the set has none.
+func dominantLabel(ls LabelSet) string {
+	best := ""
+	for _, label := range sortedLabels(ls) {
+		if best == "" || ls[label] > ls[best] {
+			best = label
+		}
+	}
+
+	return best
+}
+
+// parseGroupLimit reads the group_limit query parameter, 0 when absent.
+func parseGroupLimit(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > MaxGroupLimit {
+		return 0, fmt.Errorf("%w: group_limit must be within 1 and %d", ErrInvalidGrouping, MaxGroupLimit)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,92 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grouped results", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		cases := append(slices.Clone(inkinspottest.BigCats), inkinspottest.Fixture{
+			Collection: searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"lion_sketch.jpg"}},
+			Vector:     searchAPI.TattooImagesVector{ID: "W", Subject: searchAPI.LabelSet{"lion": 50}},
+		})
+		for _, tc := range cases {
+			Expect(is.AddCollection(context.Background(), tc.Collection)).To(Succeed())
+			Expect(vs.AddVector(context.Background(), tc.Vector)).To(Succeed())
+		}
+
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+		se = httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+	})
+
+	groupIDs := func(groups []searchAPI.ResultGroup) map[string][]string {
+		out := make(map[string][]string, len(groups))
+		for _, g := range groups {
+			out[g.Label] = collectionIDs(g.Results)
+		}
+		return out
+	}
+
+	It("doesn't group without group_by", func() {
+		res := doSearch(se, url.Values{"q": {"lion chest"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Groups).To(BeNil())
+	})
+
+	It("groups by the dominant label ordered by the best hit", func() {
+		res := doSearch(se, url.Values{"q": {"lion chest"}, "group_by": {"area"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+
+		labels := []string{}
+		for _, g := range res.JSON.Groups {
+			labels = append(labels, g.Label)
+		}
+		Expect(labels).To(Equal([]string{"chest", "arm", searchAPI.OtherGroup}))
+		Expect(groupIDs(res.JSON.Groups)).To(Equal(map[string][]string{
+			"chest":              {"X", "Z"},
+			"arm":                {"Y"},
+			searchAPI.OtherGroup: {"W"},
+		}))
+	})
+
+	It("limits the results per group but counts them all", func() {
+		res := doSearch(se, url.Values{"q": {"lion chest"}, "group_by": {"area"}, "group_limit": {"1"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Groups[0].Label).To(Equal("chest"))
+		Expect(res.JSON.Groups[0].Count).To(Equal(2))
+		Expect(collectionIDs(res.JSON.Groups[0].Results)).To(Equal([]string{"X"}))
+	})
+
+	It("puts the hits without a label in the facet in the other group", func() {
+		res := doSearch(se, url.Values{"q": {"lion"}, "group_by": {"style"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(groupIDs(res.JSON.Groups)).To(HaveKeyWithValue(searchAPI.OtherGroup, []string{"W"}))
+	})
+
+	DescribeTable("invalid grouping returns a 400 Bad Request",
+		func(params url.Values) {
+			params.Set("q", "lion")
+			res := doSearch(se, params)
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("invalid_grouping"))
+		},
+		Entry("unknown facet", url.Values{"group_by": {"color"}}),
+		Entry("zero limit", url.Values{"group_by": {"style"}, "group_limit": {"0"}}),
+		Entry("non numeric limit", url.Values{"group_by": {"style"}, "group_limit": {"all"}}),
+	)
+})
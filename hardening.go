@@ -0,0 +1,114 @@
+package inkinspot
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// HardeningPolicy holds the security headers & request limits.
+// Zero values are replaced by safe defaults.
+type HardeningPolicy struct {
+	// MaxURLLength is the maximum length in bytes of the request URI.
+	MaxURLLength int
+	// MaxQueryParams is the maximum number of query parameter values.
+	MaxQueryParams int
+	// ReferrerPolicy is the value of the Referrer-Policy header.
+	ReferrerPolicy string
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header.
+	// The header is only sent over TLS, a negative value disables it.
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains adds includeSubDomains to the HSTS header.
+	HSTSIncludeSubdomains bool
+}
+
+func (p HardeningPolicy) withDefaults() HardeningPolicy {
+	if p.MaxURLLength <= 0 {
+		p.MaxURLLength = 2048
+	}
+	if p.MaxQueryParams <= 0 {
+		p.MaxQueryParams = 32
+	}
+	if p.ReferrerPolicy == "" {
+		p.ReferrerPolicy = "no-referrer"
+	}
+	if p.HSTSMaxAge == 0 {
+		p.HSTSMaxAge = 365 * 24 * time.Hour
+	}
+
+	return p
+}
+
+// strictTransportSecurity renders the HSTS header value, empty when disabled.
+func (p HardeningPolicy) strictTransportSecurity() string {
+	if p.HSTSMaxAge < 0 {
+		return ""
+	}
+
+	v := fmt.Sprintf("max-age=%d", int64(p.HSTSMaxAge/time.Second))
+	if p.HSTSIncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+
+	return v
+}
+
+// withHardening sets the security headers on every response.
+// And rejects requests which exceed the policy limits.
+func withHardening(policy HardeningPolicy, next http.Handler) http.Handler {
+	hsts := policy.strictTransportSecurity()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", policy.ReferrerPolicy)
+		if r.TLS != nil && hsts != "" {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		if len(r.URL.RequestURI()) > policy.MaxURLLength {
+			writeError(w, http.StatusRequestURITooLong, "url_too_long",
+				fmt.Sprintf("request URL exceeds %d bytes", policy.MaxURLLength))
+			return
+		}
+
+		values, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "malformed_query", "query string is malformed")
+			return
+		}
+
+		count := 0
+		for _, vs := range values {
+			count += len(vs)
+		}
+		if count > policy.MaxQueryParams {
+			writeError(w, http.StatusBadRequest, "too_many_params",
+				fmt.Sprintf("query string exceeds %d parameters", policy.MaxQueryParams))
+			return
+		}
+
+		if !checkQueryText(w, values["q"]) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkQueryText rejects the queries holding control characters, it reports whether they passed.
+// The GETs are checked by the hardening, the POSTed bodies once decoded.
+func checkQueryText(w http.ResponseWriter, queries []string) bool {
+	for _, q := range queries {
+		if strings.IndexFunc(q, unicode.IsControl) >= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_query", "query contains control characters")
+			return false
+		}
+	}
+
+	return true
+}
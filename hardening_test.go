@@ -0,0 +1,89 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request hardening", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		se = initSearchEngineHttpServer(inkinspottest.NewFakeStores())
+	})
+
+	AfterEach(func() {
+		se.Close()
+	})
+
+	Context("Security headers", func() {
+		It("sets the hardening headers on every response", func() {
+			resp := doRequest(se, http.MethodGet, "lion", nil)
+			defer resp.Body.Close()
+
+			Expect(resp.Header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+			Expect(resp.Header.Get("X-Frame-Options")).To(Equal("DENY"))
+			Expect(resp.Header.Get("Referrer-Policy")).To(Equal("no-referrer"))
+		})
+
+		It("omits Strict-Transport-Security over plain HTTP", func() {
+			resp := doRequest(se, http.MethodGet, "lion", nil)
+			defer resp.Body.Close()
+
+			Expect(resp.Header.Get("Strict-Transport-Security")).To(BeEmpty())
+		})
+
+		It("sets the configured Strict-Transport-Security over TLS", func() {
+			cfg := searchAPI.Configuration{HardeningPolicy: searchAPI.HardeningPolicy{
+				HSTSMaxAge:            time.Hour,
+				HSTSIncludeSubdomains: true,
+			}}
+			is, vs := inkinspottest.NewFakeStores()
+			eng := searchAPI.NewSearchEngine(cfg, is, vs)
+			tlsSrv := httptest.NewTLSServer(searchAPI.NewHandler(eng))
+			defer tlsSrv.Close()
+
+			resp := doRequest(tlsSrv, http.MethodGet, "lion", nil)
+			defer resp.Body.Close()
+
+			Expect(resp.Header.Get("Strict-Transport-Security")).To(Equal("max-age=3600; includeSubDomains"))
+		})
+	})
+
+	Context("Request limits", func() {
+		It("returns a 414 URI Too Long for an over-long query string", func() {
+			res := doQuery(se, strings.Repeat("lion ", 1000))
+			Expect(res.Status).To(Equal(http.StatusRequestURITooLong))
+			Expect(res.JSON.Error).NotTo(BeNil())
+			Expect(res.JSON.Error.Code).To(Equal("url_too_long"))
+		})
+
+		It("returns a 400 Bad Request for too many query parameters", func() {
+			params := url.Values{"q": {"lion"}}
+			for _, k := range strings.Split("abcdefghijklmnopqrstuvwxyzABCDEFGHIJ", "") {
+				params.Set(k, "1")
+			}
+			resp, err := http.Get(se.URL + "/search?" + params.Encode())
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns a 400 Bad Request for a query containing a NUL byte", func() {
+			res := doQuery(se, "lion\x00chest")
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error).NotTo(BeNil())
+			Expect(res.JSON.Error.Code).To(Equal("invalid_query"))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+// Package httpx builds the outbound HTTP clients of the store adapters, bounded by timeouts & pools whatever the backend.
+// The clients pass the deadline of their requests on in a header & may count their requests by host.
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader carries the milliseconds the caller has left for the request.
+const DeadlineHeader = "X-Request-Deadline-Ms"
+
+// ClientPolicy bounds the outbound requests of a client.
+// Zero values are replaced by the defaults.
+type ClientPolicy struct {
+	// Timeout bounds a request, from the dial to the end of its body.
+	Timeout time.Duration
+	// DialTimeout bounds the connection to the host.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the handshake of the HTTPS connections.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the headers of the response once the request is written.
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// MaxIdleConns caps the idle connections to all the hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections to a host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections to a host, dialing, active or idle; no cap when 0.
+	MaxConnsPerHost int
+	// Proxy is the proxy of the requests, the one of the environment when nil.
+	Proxy *url.URL
+	// Metrics counts the requests by host, they aren't counted when nil.
+	Metrics *Metrics
+}
+
+func (p ClientPolicy) withDefaults() ClientPolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = 30 * time.Second
+	}
+	if p.DialTimeout <= 0 {
+		p.DialTimeout = 5 * time.Second
+	}
+	if p.TLSHandshakeTimeout <= 0 {
+		p.TLSHandshakeTimeout = 5 * time.Second
+	}
+	if p.ResponseHeaderTimeout <= 0 {
+		p.ResponseHeaderTimeout = 10 * time.Second
+	}
+	if p.IdleConnTimeout <= 0 {
+		p.IdleConnTimeout = 90 * time.Second
+	}
+	if p.MaxIdleConns <= 0 {
+		p.MaxIdleConns = 100
+	}
+	if p.MaxIdleConnsPerHost <= 0 {
+		p.MaxIdleConnsPerHost = 10
+	}
+
+	return p
+}
+
+// NewClient returns a client bounded by the policy.
+// Its requests carry the DeadlineHeader, the tighter of their context's deadline & the timeout of the policy,
+// and are counted in the metrics of the policy.
+func NewClient(p ClientPolicy) *http.Client {
+	p = p.withDefaults()
+
+	proxy := http.ProxyFromEnvironment
+	if p.Proxy != nil {
+		proxy = http.ProxyURL(p.Proxy)
+	}
+	dialer := &net.Dialer{Timeout: p.DialTimeout, KeepAlive: 30 * time.Second}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   p.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       p.IdleConnTimeout,
+		MaxIdleConns:          p.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+	}
+	if p.Metrics != nil {
+		transport = &metricsTransport{base: transport, metrics: p.Metrics}
+	}
+
+	return &http.Client{Timeout: p.Timeout, Transport: &DeadlineTransport{Base: transport}}
+}
+
+// RemainingBudget returns the time left until the context's deadline, never negative.
+// It returns false when the context has no deadline.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	return max(time.Until(deadline), 0), true
+}
+
+// DeadlineTransport sets the DeadlineHeader of the requests whose context has a deadline.
+// The HTTP store adapters use it so the store knows how long it has to answer.
+type DeadlineTransport struct {
+	// Base makes the requests, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+func (t *DeadlineTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if budget, ok := RemainingBudget(r.Context()); ok {
+		// a RoundTripper must not modify the request.
+		r = r.Clone(r.Context())
+		r.Header.Set(DeadlineHeader, strconv.FormatInt(budget.Milliseconds(), 10))
+	}
+
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,137 @@
+package httpx_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/DanyPops/inkinspot/httpx"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// backend serves the handler until the end of the spec.
+func backend(h http.HandlerFunc) *httptest.Server {
+	GinkgoHelper()
+	se := httptest.NewServer(h)
+	DeferCleanup(se.Close)
+	return se
+}
+
+// get requests the URL with the client, it returns the response with its body read.
+func get(ctx context.Context, client *http.Client, u string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	Expect(err).NotTo(HaveOccurred())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+
+	return resp, body, err
+}
+
+// isTimeout reports whether the error is a timeout of the network.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+var _ = Describe("NewClient", func() {
+	It("gives up on the headers the backend doesn't send", func() {
+		// the backends hold the requests until the client gives up.
+		se := backend(func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() })
+		client := httpx.NewClient(httpx.ClientPolicy{ResponseHeaderTimeout: 50 * time.Millisecond})
+
+		start := time.Now()
+		_, _, err := get(context.Background(), client, se.URL)
+		Expect(isTimeout(err)).To(BeTrue(), "got %v", err)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("bounds the whole request by the timeout", func() {
+		se := backend(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+		client := httpx.NewClient(httpx.ClientPolicy{Timeout: 100 * time.Millisecond})
+
+		start := time.Now()
+		_, _, err := get(context.Background(), client, se.URL)
+		Expect(isTimeout(err)).To(BeTrue(), "got %v", err)
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("passes the deadline of the context on", func() {
+		se := backend(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Header.Get(httpx.DeadlineHeader))
+		})
+		client := httpx.NewClient(httpx.ClientPolicy{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, body, err := get(ctx, client, se.URL)
+		Expect(err).NotTo(HaveOccurred())
+		budget, err := strconv.Atoi(string(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(budget).To(BeNumerically("~", 2000, 500))
+
+		_, body, err = get(context.Background(), client, se.URL)
+		Expect(err).NotTo(HaveOccurred())
+		budget, err = strconv.Atoi(string(body))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(budget).To(BeNumerically("~", 30_000, 500), "the timeout of the client bounds the requests without a deadline")
+	})
+
+	It("counts the requests by host & outcome", func() {
+		se := backend(func(w http.ResponseWriter, r *http.Request) {
+			status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+			w.WriteHeader(status)
+		})
+		gone := httptest.NewServer(http.NotFoundHandler())
+		gone.Close()
+
+		metrics := &httpx.Metrics{}
+		client := httpx.NewClient(httpx.ClientPolicy{Metrics: metrics})
+		for _, status := range []int{200, 204, 404, 503} {
+			_, _, err := get(context.Background(), client, se.URL+"?status="+strconv.Itoa(status))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, _, err := get(context.Background(), client, gone.URL)
+		Expect(err).To(HaveOccurred())
+
+		hosts := metrics.Hosts()
+		Expect(hosts).To(HaveLen(2))
+		byHost := map[string]httpx.HostStats{hosts[0].Host: hosts[0], hosts[1].Host: hosts[1]}
+
+		served := byHost[se.Listener.Addr().String()]
+		Expect(served.Requests).To(Equal(uint64(4)))
+		Expect(served.Outcomes).To(Equal(map[string]uint64{"2xx": 2, "4xx": 1, "5xx": 1}))
+		Expect(served.DurationMS).To(BeNumerically(">", 0))
+		Expect(byHost[gone.Listener.Addr().String()].Outcomes).To(Equal(map[string]uint64{httpx.OutcomeError: 1}))
+	})
+
+	It("goes through the proxy", func() {
+		proxied := make(chan string, 1)
+		proxy := backend(func(w http.ResponseWriter, r *http.Request) {
+			proxied <- r.URL.String()
+		})
+		proxyURL, err := url.Parse(proxy.URL)
+		Expect(err).NotTo(HaveOccurred())
+		client := httpx.NewClient(httpx.ClientPolicy{Proxy: proxyURL})
+
+		resp, _, err := get(context.Background(), client, "http://images.invalid/tattoos/L")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(proxied).To(Receive(Equal("http://images.invalid/tattoos/L")))
+	})
+})
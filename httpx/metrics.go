@@ -0,0 +1,81 @@
+package httpx
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OutcomeError is the outcome of the requests which got no response.
+const OutcomeError = "error"
+
+// Metrics counts the requests of the clients by host.
+// The zero value is ready to use, a Metrics may be shared by many clients.
+type Metrics struct {
+	mu    sync.Mutex
+	hosts map[string]*HostStats
+}
+
+// HostStats are the requests to a host, by outcome: the class of their status, "2xx" to "5xx", or OutcomeError.
+// The duration adds up the waits for the headers of the responses.
+type HostStats struct {
+	Host       string            `json:"host"`
+	Requests   uint64            `json:"requests"`
+	Outcomes   map[string]uint64 `json:"outcomes"`
+	DurationMS float64           `json:"duration_ms"`
+}
+
+// record counts a request to the host.
+func (m *Metrics) record(host, outcome string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.hosts == nil {
+		m.hosts = make(map[string]*HostStats)
+	}
+	stats, ok := m.hosts[host]
+	if !ok {
+		stats = &HostStats{Host: host, Outcomes: make(map[string]uint64)}
+		m.hosts[host] = stats
+	}
+	stats.Requests++
+	stats.Outcomes[outcome]++
+	stats.DurationMS += float64(d) / float64(time.Millisecond)
+}
+
+// Hosts returns the stats of the hosts requested so far, ordered by host.
+func (m *Metrics) Hosts() []HostStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]HostStats, 0, len(m.hosts))
+	for _, host := range slices.Sorted(maps.Keys(m.hosts)) {
+		stats := *m.hosts[host]
+		stats.Outcomes = maps.Clone(stats.Outcomes)
+		out = append(out, stats)
+	}
+
+	return out
+}
+
+// metricsTransport counts the requests of its base in the metrics.
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *Metrics
+}
+
+func (t *metricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(r)
+
+	outcome := OutcomeError
+	if err == nil {
+		outcome = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	t.metrics.record(r.URL.Host, outcome, time.Since(start))
+
+	return resp, err
+}
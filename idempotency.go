@@ -0,0 +1,268 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the key of a write, its retries with the same key are replayed.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyReplayedHeader marks the responses replayed from the outcome of an earlier request.
+const IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+// maxIdempotencyKeyBytes caps the size of the idempotency keys.
+const maxIdempotencyKeyBytes = 255
+
+// IdempotencyPolicy controls the replays of the writes carrying an idempotency key.
+// Zero values are replaced by the defaults.
+type IdempotencyPolicy struct {
+	// Window is how long the outcome of a write is replayed.
+	Window time.Duration
+}
+
+func (p IdempotencyPolicy) withDefaults() IdempotencyPolicy {
+	if p.Window <= 0 {
+		p.Window = 24 * time.Hour
+	}
+
+	return p
+}
+
+// IdempotentOutcome is the response of a write, replayed to its retries.
+// Fingerprint identifies the request, a retry with another one reuses the key.
+type IdempotentOutcome struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore keeps the outcomes of the writes by key.
+type IdempotencyStore interface {
+	// Begin claims the key at the time, it returns nil when it's claimed.
+	// The key must then be completed or abandoned.
+	// It returns the outcome of the key when it's completed & unexpired.
+	// It waits for the request holding the key to complete or abandon it.
+	Begin(ctx context.Context, key string, now time.Time) (*IdempotentOutcome, error)
+	// Complete stores the outcome of the claimed key until expires.
+	Complete(ctx context.Context, key string, outcome IdempotentOutcome, expires time.Time) error
+	// Abandon releases the claimed key without an outcome, the next request of the key claims it.
+	Abandon(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore keeps the outcomes in memory.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// idempotencyEntry is a claimed key, done is closed once it's completed or abandoned.
+type idempotencyEntry struct {
+	done    chan struct{}
+	outcome *IdempotentOutcome
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]*idempotencyEntry)}
+}
+
+// Begin claims the key, or returns its outcome.
+// The expired outcomes are swept meanwhile.
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key string, now time.Time) (*IdempotentOutcome, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		for k, e := range s.entries {
+			if e.outcome != nil && !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		entry, ok := s.entries[key]
+		if !ok {
+			s.entries[key] = &idempotencyEntry{done: make(chan struct{})}
+			s.mu.Unlock()
+			return nil, nil
+		}
+		if entry.outcome != nil {
+			s.mu.Unlock()
+			return entry.outcome, nil
+		}
+		s.mu.Unlock()
+
+		// the key is in flight, its outcome is taken or it's claimed again once it's done.
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Complete stores the outcome of the key & wakes the requests waiting for it.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, outcome IdempotentOutcome, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.outcome != nil {
+		return nil
+	}
+	entry.outcome = &outcome
+	entry.expires = expires
+	close(entry.done)
+
+	return nil
+}
+
+// Abandon releases the key & wakes the requests waiting for it.
+func (s *MemoryIdempotencyStore) Abandon(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.outcome != nil {
+		return nil
+	}
+	delete(s.entries, key)
+	close(entry.done)
+
+	return nil
+}
+
+// WithIdempotencyStore sets the store of the outcomes of the idempotent writes, in memory by default.
+func WithIdempotencyStore(s IdempotencyStore) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.idempotency = s
+	}
+}
+
+// idempotencyRecorder keeps the response of a write, to replay it.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// requestFingerprint identifies a request by its method, target & the hash of its body.
+func requestFingerprint(r *http.Request, body hash.Hash) string {
+	return r.Method + " " + r.URL.RequestURI() + " " + hex.EncodeToString(body.Sum(nil))
+}
+
+// withIdempotency replays the outcome of a write to its retries with the same Idempotency-Key.
+// The keys are scoped by API key. A retry of another request with the key answers 409 Conflict.
+// The outcomes of server errors aren't kept, their retries run again.
+func withIdempotency(se *SearchEngine, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idemKey := r.Header.Get(IdempotencyKeyHeader)
+		if idemKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idemKey) > maxIdempotencyKeyBytes {
+			writeError(w, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyBytes)+" bytes")
+			return
+		}
+		key := se.configuration.QuotaPolicy.keyName(r.Header.Get(APIKeyHeader)) + " " + idemKey
+
+		outcome, err := se.idempotency.Begin(r.Context(), key, se.clock.Now())
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return
+			}
+			slog.ErrorContext(r.Context(), "claiming the idempotency key failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "idempotency store failed")
+			return
+		}
+		if outcome != nil {
+			// the body of the retry is hashed as it's read, it's never kept.
+			sum := sha256.New()
+			if _, err := io.Copy(sum, r.Body); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+				return
+			}
+			if requestFingerprint(r, sum) != outcome.Fingerprint {
+				writeError(w, http.StatusConflict, "idempotency_key_reused", "the Idempotency-Key was used by another request")
+				return
+			}
+			if outcome.ContentType != "" {
+				w.Header().Set("Content-Type", outcome.ContentType)
+			}
+			w.Header().Set(IdempotencyReplayedHeader, "true")
+			w.WriteHeader(outcome.Status)
+			_, _ = w.Write(outcome.Body)
+			return
+		}
+
+		sum := sha256.New()
+		body := r.Body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, sum), body}
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			if !completed {
+				_ = se.idempotency.Abandon(context.WithoutCancel(r.Context()), key)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			return
+		}
+		// the fingerprint covers the whole body, even what the handler left unread.
+		if _, err := io.Copy(sum, body); err != nil {
+			return
+		}
+		outcome = &IdempotentOutcome{
+			Fingerprint: requestFingerprint(r, sum),
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		}
+		expires := se.clock.Now().Add(se.configuration.IdempotencyPolicy.Window)
+		if err := se.idempotency.Complete(context.WithoutCancel(r.Context()), key, *outcome, expires); err != nil {
+			slog.ErrorContext(r.Context(), "storing the idempotent outcome failed", "error", err)
+			return
+		}
+		completed = true
+	})
+}
@@ -0,0 +1,162 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Idempotency keys", func() {
+	var (
+		clock *inkinspottest.FakeClock
+		is    *gatedImageStore
+		se    *httptest.Server
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is = newGatedImageStore()
+		cfg := searchAPI.Configuration{
+			AdminPolicy:       searchAPI.AdminPolicy{Token: adminToken},
+			IdempotencyPolicy: searchAPI.IdempotencyPolicy{Window: time.Hour},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, searchAPI.NewMemoryVectorStore(), searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	// importWithKey imports the body with the idempotency key, as the API key.
+	importWithKey := func(apiKey, idemKey, body string) (int, http.Header, string) {
+		GinkgoHelper()
+		req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/import", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set(searchAPI.APIKeyHeader, apiKey)
+		req.Header.Set(searchAPI.IdempotencyKeyHeader, idemKey)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, resp.Header, string(b)
+	}
+
+	record := func(id string) string {
+		return ndjson(searchAPI.ExportRecord{Collection: searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}}})
+	}
+
+	// imports counts the audited imports, one per import run.
+	imports := func() int {
+		GinkgoHelper()
+		var log searchAPI.AuditLog
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/audit?action=import", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(json.NewDecoder(resp.Body).Decode(&log)).To(Succeed())
+		return len(log.Entries)
+	}
+
+	It("replays the outcome of a retry", func() {
+		close(is.gate)
+
+		status, header, body := importWithKey("k1", "retry-1", record("A"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(BeEmpty())
+
+		status, header, replayed := importWithKey("k1", "retry-1", record("A"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(Equal("true"))
+		Expect(header.Get("Content-Type")).To(HavePrefix("application/json"))
+		Expect(replayed).To(Equal(body))
+		Expect(imports()).To(Equal(1))
+
+		By("scoping the keys by API key")
+		_, header, _ = importWithKey("k2", "retry-1", record("A"))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(BeEmpty())
+		Expect(imports()).To(Equal(2))
+	})
+
+	It("holds a concurrent duplicate until the original completes", func() {
+		original := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+			_, _, body := importWithKey("k1", "dup", record("A"))
+			original <- body
+		}()
+		Eventually(is.Peak).Should(Equal(1))
+
+		duplicate := make(chan http.Header)
+		go func() {
+			defer GinkgoRecover()
+			_, header, _ := importWithKey("k1", "dup", record("A"))
+			duplicate <- header
+		}()
+		Consistently(duplicate, 100*time.Millisecond).ShouldNot(Receive())
+
+		close(is.gate)
+		Eventually(original).Should(Receive())
+		var header http.Header
+		Eventually(duplicate).Should(Receive(&header))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(Equal("true"))
+		Expect(is.Peak()).To(Equal(1))
+		Expect(imports()).To(Equal(1))
+	})
+
+	It("forgets the outcome after the window", func() {
+		close(is.gate)
+		importWithKey("k1", "late", record("A"))
+
+		clock.Advance(time.Hour)
+		_, header, _ := importWithKey("k1", "late", record("A"))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(BeEmpty())
+		Expect(imports()).To(Equal(2))
+	})
+
+	It("replays the creation of a collection", func() {
+		close(is.gate)
+		create := func(idemKey string) (int, http.Header) {
+			GinkgoHelper()
+			req, err := http.NewRequest(http.MethodPost, se.URL+"/tattoos", strings.NewReader(`{"collection": {"ID": "A", "URLs": ["a.jpg"]}}`))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			req.Header.Set(searchAPI.IdempotencyKeyHeader, idemKey)
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			return resp.StatusCode, resp.Header
+		}
+
+		status, _ := create("create-1")
+		Expect(status).To(Equal(http.StatusCreated))
+		status, header := create("create-1")
+		Expect(status).To(Equal(http.StatusCreated))
+		Expect(header.Get(searchAPI.IdempotencyReplayedHeader)).To(Equal("true"))
+
+		status, _ = create("create-2")
+		Expect(status).To(Equal(http.StatusConflict), "a retry without the key finds the collection")
+	})
+
+	It("answers 409 Conflict to a reuse of the key with another body", func() {
+		close(is.gate)
+		importWithKey("k1", "reused", record("A"))
+
+		status, _, body := importWithKey("k1", "reused", record("B"))
+		Expect(status).To(Equal(http.StatusConflict))
+		Expect(body).To(ContainSubstring("idempotency_key_reused"))
+		_, err := is.GetTattoosByID(context.Background(), []string{"B"})
+		Expect(err).To(HaveOccurred())
+	})
+})
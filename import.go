@@ -0,0 +1,311 @@
+package inkinspot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CollectionWriter is implemented by the image stores which accept collections.
+type CollectionWriter interface {
+	AddCollection(ctx context.Context, c TattooImagesCollection) error
+}
+
+// VectorWriter is implemented by the vector stores which accept vectors.
+type VectorWriter interface {
+	AddVector(ctx context.Context, v TattooImagesVector) error
+}
+
+// Import modes for the IDs already in the stores.
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+)
+
+const (
+	// maxImportLineBytes caps the size of an import record.
+	maxImportLineBytes = 1 << 20
+	// maxImportFailures caps the failures listed in an import summary.
+	maxImportFailures = 100
+)
+
+// ImportOptions tunes an import.
+// The zero value skips the existing IDs.
+type ImportOptions struct {
+	Mode string
+	// DryRun validates the records without writing them.
+	DryRun bool
+	// AllowExpired accepts the collections already past their expiry.
+	AllowExpired bool
+}
+
+// ImportSummary reports the outcome of an import.
+// Failures lists the first failed records in the order of their lines.
+type ImportSummary struct {
+	Imported int             `json:"imported"`
+	Skipped  int             `json:"skipped"`
+	Failed   int             `json:"failed"`
+	Failures []ImportFailure `json:"failures,omitempty"`
+	DryRun   bool            `json:"dry_run,omitempty"`
+}
+
+// ImportFailure is a record which wasn't imported & why.
+type ImportFailure struct {
+	Line   int    `json:"line"`
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// fail counts the failure, it's listed while it's among the first by line.
+// The records are written concurrently, they may fail out of order.
+func (s *ImportSummary) fail(line int, id string, err error) {
+	s.Failed++
+	f := ImportFailure{Line: line, ID: id, Reason: err.Error()}
+	if len(s.Failures) < maxImportFailures {
+		s.Failures = append(s.Failures, f)
+		return
+	}
+
+	last := 0
+	for i, listed := range s.Failures {
+		if listed.Line > s.Failures[last].Line {
+			last = i
+		}
+	}
+	if line < s.Failures[last].Line {
+		s.Failures[last] = f
+	}
+}
+
+// validateRecord checks the record can be written to the stores.
+func validateRecord(rec ExportRecord) error {
+	if rec.Collection.ID == "" {
+		return fmt.Errorf("%w: collection without an ID", ErrInvalidRecord)
+	}
+	if loc := rec.Collection.Location; loc != nil {
+		if err := loc.validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRecord, err)
+		}
+	}
+	if rec.Vector == nil {
+		return nil
+	}
+	if rec.Vector.ID != rec.Collection.ID {
+		return fmt.Errorf("%w: vector ID %q differs from the collection's", ErrInvalidRecord, rec.Vector.ID)
+	}
+	if err := validateLabels(*rec.Vector); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRecord, err)
+	}
+
+	return nil
+}
+
+// validateLabels checks the labels are named & their proximities are finite & not negative.
+func validateLabels(v TattooImagesVector) error {
+	for _, ls := range []LabelSet{v.Style, v.Subject, v.Area} {
+		for label, proximity := range ls {
+			if label == "" || math.IsNaN(proximity) || math.IsInf(proximity, 0) || proximity < 0 {
+				return fmt.Errorf("label %q with proximity %v", label, proximity)
+			}
+		}
+	}
+
+	return nil
+}
+
+// importJob is a record to write & its line in the import.
+type importJob struct {
+	line int
+	rec  ExportRecord
+}
+
+// Import restores the NDJSON records of an export into the stores.
+// Malformed & invalid records are reported in the summary, they don't stop the import.
+// It stops with ErrIngestBusy when the ingestion queue stays full, the records before are written.
+func (e *SearchEngine) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportSummary, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportSkip
+	}
+	if opts.Mode != ImportSkip && opts.Mode != ImportOverwrite {
+		return ImportSummary{}, fmt.Errorf("%w: unknown mode %q", ErrInvalidImport, opts.Mode)
+	}
+
+	cw, ok := storeAs[CollectionWriter](e.imageStore)
+	if !ok {
+		return ImportSummary{}, ErrImportUnsupported
+	}
+	vw, ok := storeAs[VectorWriter](e.vectorStore)
+	if !ok {
+		return ImportSummary{}, ErrImportUnsupported
+	}
+
+	var (
+		mu      sync.Mutex
+		summary = ImportSummary{DryRun: opts.DryRun}
+	)
+	report := func(line int, id string, skipped bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			summary.fail(line, id, err)
+		case skipped:
+			summary.Skipped++
+		default:
+			summary.Imported++
+		}
+	}
+
+	// the records are written by the pool which every import shares.
+	var wg sync.WaitGroup
+	inv := e.newCacheInvalidation()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	line := 0
+	var err error
+	for scanner.Scan() && ctx.Err() == nil {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec ExportRecord
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			report(line, "", false, fmt.Errorf("%w: %w", ErrInvalidRecord, err))
+			continue
+		}
+		rec.Collection.URLsTruncated = false
+		if err := validateRecord(rec); err != nil {
+			report(line, rec.Collection.ID, false, err)
+			continue
+		}
+		if rec.Collection.expired(e.clock.Now()) && !opts.AllowExpired {
+			report(line, rec.Collection.ID, false, fmt.Errorf("%w: expired at %s", ErrInvalidRecord, rec.Collection.ExpiresAt.Format(time.RFC3339)))
+			continue
+		}
+
+		wg.Add(1)
+		job := importJob{line: line, rec: rec}
+		err = e.ingest.submit(ctx, func() {
+			defer wg.Done()
+			skipped, err := e.importRecord(ctx, cw, vw, job.rec, opts, inv)
+			report(job.line, job.rec.Collection.ID, skipped, err)
+		})
+		if err != nil {
+			wg.Done()
+			break
+		}
+	}
+	wg.Wait()
+	slices.SortFunc(summary.Failures, func(a, b ImportFailure) int { return a.Line - b.Line })
+
+	// the cached results & responses of the labels written may miss the imported collections.
+	if summary.Imported > 0 && !opts.DryRun {
+		e.invalidate(inv)
+	}
+
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return summary, err
+}
+
+// importRecord writes the record unless it's skipped.
+// The labels it replaces & writes are added to the invalidation.
+func (e *SearchEngine) importRecord(ctx context.Context, cw CollectionWriter, vw VectorWriter, rec ExportRecord, opts ImportOptions, inv *cacheInvalidation) (bool, error) {
+	if opts.Mode == ImportSkip {
+		existing, err := foundOnly(e.lookupCollections(ctx, []string{rec.Collection.ID}))
+		if err != nil {
+			return false, err
+		}
+		if len(existing) > 0 {
+			return true, nil
+		}
+	}
+	if opts.DryRun {
+		return false, nil
+	}
+
+	e.addStored(ctx, inv, rec.Collection.ID)
+	if rec.Vector != nil {
+		inv.addVector(*rec.Vector)
+	}
+	err := cw.AddCollection(ctx, rec.Collection)
+	e.collections.forget(rec.Collection.ID)
+	if err != nil {
+		return false, err
+	}
+	if rec.Vector != nil {
+		if err := vw.AddVector(ctx, *rec.Vector); err != nil {
+			return false, err
+		}
+		e.percolate(rec.Collection, *rec.Vector)
+	}
+
+	return false, nil
+}
+
+// handleImport restores an NDJSON export posted as the body.
+func handleImport(se *SearchEngine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		opts := ImportOptions{Mode: params.Get("mode")}
+		if raw := params.Get("dry_run"); raw != "" {
+			var err error
+			if opts.DryRun, err = strconv.ParseBool(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_import", "dry_run must be a boolean")
+				return
+			}
+		}
+		if raw := params.Get("allow_expired"); raw != "" {
+			var err error
+			if opts.AllowExpired, err = strconv.ParseBool(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_import", "allow_expired must be a boolean")
+				return
+			}
+		}
+
+		summary, err := se.Import(r.Context(), r.Body, opts)
+		if err != nil {
+			writeImportError(w, se, err)
+			return
+		}
+		if !summary.DryRun {
+			se.recordAudit(w, r, AuditImport, "", "", fmt.Sprintf("imported %d, skipped %d, failed %d", summary.Imported, summary.Skipped, summary.Failed))
+			se.setConsistencyToken(w)
+		}
+		writeJSON(w, http.StatusOK, summary)
+	}
+}
+
+// writeImportError answers the error of an import.
+func writeImportError(w http.ResponseWriter, se *SearchEngine, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidImport):
+		writeError(w, http.StatusBadRequest, "invalid_import", err.Error())
+	case errors.Is(err, ErrIngestBusy):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(se.configuration.IngestPolicy.RetryAfter.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, "ingest_busy", "the ingestion queue is full, retry later")
+	case errors.Is(err, ErrImportUnsupported):
+		writeError(w, http.StatusNotImplemented, "import_unsupported", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("import failed: %v", err))
+	}
+}
@@ -0,0 +1,277 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+func doImport(se *httptest.Server, params url.Values, body string) (int, searchAPI.ImportSummary) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/import?"+params.Encode(), strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var summary searchAPI.ImportSummary
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&summary)).To(Succeed())
+	}
+
+	return resp.StatusCode, summary
+}
+
+// ndjson encodes the records one per line.
+func ndjson(records ...searchAPI.ExportRecord) string {
+	GinkgoHelper()
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, rec := range records {
+		Expect(enc.Encode(rec)).To(Succeed())
+	}
+
+	return b.String()
+}
+
+// initEmptyAdminServer serves empty in-memory stores with the admin endpoints.
+func initEmptyAdminServer() *httptest.Server {
+	GinkgoHelper()
+	cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+	eng := searchAPI.NewSearchEngine(cfg, searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore())
+	se := httptest.NewServer(searchAPI.NewHandler(eng))
+	DeferCleanup(se.Close)
+
+	return se
+}
+
+var _ = Describe("Catalog import", func() {
+	record := func(id string, lion float64) searchAPI.ExportRecord {
+		return searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}},
+			Vector: &searchAPI.TattooImagesVector{
+				ID:        id,
+				Subject:   searchAPI.LabelSet{"lion": lion},
+				CreatedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+			},
+		}
+	}
+
+	It("restores an export into wiped stores", func() {
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		src := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(src.Close)
+		_, exported := doExport(src, adminToken, nil)
+		Expect(exported).To(HaveLen(len(inkinspottest.BigCats)))
+
+		dst := initEmptyAdminServer()
+		status, summary := doImport(dst, nil, ndjson(exported...))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary).To(Equal(searchAPI.ImportSummary{Imported: len(inkinspottest.BigCats)}))
+
+		_, restored := doExport(dst, adminToken, nil)
+		Expect(restored).To(Equal(exported))
+
+		res := doSearch(dst, url.Values{"q": {"lion"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y"}))
+	})
+
+	It("skips or overwrites the existing IDs by the mode", func() {
+		se := initEmptyAdminServer()
+		_, summary := doImport(se, nil, ndjson(record("a", 10)))
+		Expect(summary.Imported).To(Equal(1))
+
+		_, summary = doImport(se, nil, ndjson(record("a", 20), record("b", 20)))
+		Expect(summary).To(Equal(searchAPI.ImportSummary{Imported: 1, Skipped: 1}))
+		_, records := doExport(se, adminToken, nil)
+		Expect(records[0].Vector.Subject).To(Equal(searchAPI.LabelSet{"lion": 10}))
+
+		_, summary = doImport(se, url.Values{"mode": {"overwrite"}}, ndjson(record("a", 20)))
+		Expect(summary).To(Equal(searchAPI.ImportSummary{Imported: 1}))
+		_, records = doExport(se, adminToken, nil)
+		Expect(records[0].Vector.Subject).To(Equal(searchAPI.LabelSet{"lion": 20}))
+	})
+
+	It("validates without writing on a dry run", func() {
+		se := initEmptyAdminServer()
+		status, summary := doImport(se, url.Values{"dry_run": {"true"}}, ndjson(record("a", 10), record("b", 10)))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary).To(Equal(searchAPI.ImportSummary{Imported: 2, DryRun: true}))
+
+		_, records := doExport(se, adminToken, nil)
+		Expect(records).To(BeEmpty())
+	})
+
+	It("reports the invalid records with their line and imports the rest", func() {
+		mismatched := record("c", 10)
+		mismatched.Vector.ID = "d"
+		negative := record("e", -1)
+		body := ndjson(record("a", 10)) + "{not json\n" + ndjson(mismatched, negative, record("b", 10))
+
+		se := initEmptyAdminServer()
+		status, summary := doImport(se, nil, body)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(summary.Imported).To(Equal(2))
+		Expect(summary.Failed).To(Equal(3))
+		Expect(summary.Failures).To(HaveLen(3))
+		Expect(summary.Failures[0].Line).To(Equal(2))
+		Expect(summary.Failures[1]).To(MatchFields(IgnoreExtras, Fields{"Line": Equal(3), "ID": Equal("c")}))
+		Expect(summary.Failures[2]).To(MatchFields(IgnoreExtras, Fields{"Line": Equal(4), "ID": Equal("e")}))
+	})
+
+	It("rejects an unknown mode", func() {
+		se := initEmptyAdminServer()
+		status, _ := doImport(se, url.Values{"mode": {"merge"}}, ndjson(record("a", 10)))
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+
+	It("writes into the stores through their writers", func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+
+		summary, err := eng.Import(context.Background(), strings.NewReader(ndjson(record("a", 10))), searchAPI.ImportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Imported).To(Equal(1))
+
+		vectors, err := vs.GetVectorsByID(context.Background(), []string{"a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vectors).To(HaveLen(1))
+	})
+})
+
+// gatedImageStore is a memory image store whose writes wait on the gate & track their concurrency.
+type gatedImageStore struct {
+	*searchAPI.MemoryImageStore
+	gate chan struct{}
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func newGatedImageStore() *gatedImageStore {
+	return &gatedImageStore{MemoryImageStore: searchAPI.NewMemoryImageStore(), gate: make(chan struct{})}
+}
+
+func (s *gatedImageStore) AddCollection(ctx context.Context, c searchAPI.TattooImagesCollection) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-s.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.MemoryImageStore.AddCollection(ctx, c)
+}
+
+func (s *gatedImageStore) Peak() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+var _ = Describe("Import backpressure", func() {
+	records := func(prefix string, n int) string {
+		var recs []searchAPI.ExportRecord
+		for i := range n {
+			recs = append(recs, searchAPI.ExportRecord{Collection: searchAPI.TattooImagesCollection{ID: fmt.Sprintf("%s%04d", prefix, i)}})
+		}
+		return ndjson(recs...)
+	}
+
+	It("shares the writers between the imports", func() {
+		is := newGatedImageStore()
+		cfg := searchAPI.Configuration{IngestPolicy: searchAPI.IngestPolicy{Concurrency: 3, QueueSize: 8}}
+		eng := searchAPI.NewSearchEngine(cfg, is, searchAPI.NewMemoryVectorStore())
+
+		var wg sync.WaitGroup
+		for _, prefix := range []string{"a", "b"} {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				summary, err := eng.Import(context.Background(), strings.NewReader(records(prefix, 500)), searchAPI.ImportOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(summary.Imported).To(Equal(500))
+			}()
+		}
+
+		Eventually(is.Peak).Should(Equal(3))
+		Consistently(is.Peak, 20*time.Millisecond).Should(Equal(3))
+		close(is.gate)
+		wg.Wait()
+		Expect(is.Peak()).To(Equal(3))
+	})
+
+	It("turns the import away with 503 once the queue stays full", func() {
+		clock := inkinspottest.NewFakeClock(time.Now())
+		is := newGatedImageStore()
+		policy := searchAPI.IngestPolicy{Concurrency: 1, QueueSize: 1, QueueTimeout: time.Second, RetryAfter: 30 * time.Second}
+		cfg := searchAPI.Configuration{IngestPolicy: policy, AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, searchAPI.NewMemoryVectorStore(), searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+
+		req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/import", strings.NewReader(records("a", 3)))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		done := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			done <- resp
+		}()
+
+		// the first record is written, the second queued & the third waits for room.
+		Eventually(clock.Waiters).Should(Equal(1))
+		clock.Advance(policy.QueueTimeout)
+		close(is.gate)
+
+		var resp *http.Response
+		Eventually(done).Should(Receive(&resp))
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("30"))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Error.Code).To(Equal("ingest_busy"))
+	})
+
+	It("lists the failures in the order of their lines", func() {
+		is, vs := inkinspottest.NewFakeStores()
+		faulty := inkinspottest.NewFaultyStore(is, inkinspottest.FailEvery(2))
+		eng := searchAPI.NewSearchEngine(searchAPI.Configuration{IngestPolicy: searchAPI.IngestPolicy{Concurrency: 8}}, faulty, vs)
+
+		summary, err := eng.Import(context.Background(), strings.NewReader(records("a", 300)), searchAPI.ImportOptions{Mode: searchAPI.ImportOverwrite})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Failed).To(Equal(150))
+		Expect(summary.Failures).To(HaveLen(100))
+		Expect(slices.IsSortedFunc(summary.Failures, func(a, b searchAPI.ImportFailure) int { return a.Line - b.Line })).To(BeTrue())
+	})
+})
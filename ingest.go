@@ -0,0 +1,88 @@
+package inkinspot
+
+import (
+	"context"
+	"time"
+)
+
+// IngestPolicy bounds the record writes of the imports.
+// The writes of every import of an engine share it.
+// Zero values are replaced by the defaults.
+type IngestPolicy struct {
+	// Concurrency is the number of records written at once.
+	Concurrency int
+	// QueueSize is the number of records waiting for a writer.
+	QueueSize int
+	// QueueTimeout is how long a record waits for room in a full queue.
+	QueueTimeout time.Duration
+	// RetryAfter is the delay suggested to the imports turned away.
+	RetryAfter time.Duration
+}
+
+func (p IngestPolicy) withDefaults() IngestPolicy {
+	if p.Concurrency <= 0 {
+		p.Concurrency = 4
+	}
+	if p.QueueSize <= 0 {
+		p.QueueSize = 256
+	}
+	if p.QueueTimeout <= 0 {
+		p.QueueTimeout = 5 * time.Second
+	}
+	if p.RetryAfter <= 0 {
+		p.RetryAfter = 10 * time.Second
+	}
+
+	return p
+}
+
+// ingestPool runs the record writes, at most Concurrency at once & QueueSize waiting.
+// A goroutine is only started for an admitted record, none outlive their write.
+type ingestPool struct {
+	clock   Clock
+	timeout time.Duration
+	// admitted holds a token for every running or waiting record.
+	admitted chan struct{}
+	// running holds a token for every running record.
+	running chan struct{}
+}
+
+func newIngestPool(p IngestPolicy, clock Clock) *ingestPool {
+	return &ingestPool{
+		clock:    clock,
+		timeout:  p.QueueTimeout,
+		admitted: make(chan struct{}, p.Concurrency+p.QueueSize),
+		running:  make(chan struct{}, p.Concurrency),
+	}
+}
+
+// submit queues the job, it waits up to the queue timeout while the queue is full.
+// It fails with ErrIngestBusy when the timeout passes, the job isn't run then.
+func (p *ingestPool) submit(ctx context.Context, job func()) error {
+	select {
+	case p.admitted <- struct{}{}:
+	default:
+		timer := p.clock.NewTimer(p.timeout)
+		defer timer.Stop()
+
+		select {
+		case p.admitted <- struct{}{}:
+		case <-timer.C():
+			return ErrIngestBusy
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		p.running <- struct{}{}
+		defer func() {
+			<-p.running
+			<-p.admitted
+		}()
+
+		job()
+	}()
+
+	return nil
+}
@@ -1,4 +1,4 @@
-package main_test
+package inkinspot_test
 
 import (
 	"testing"
@@ -0,0 +1,123 @@
+package inkinspottest
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// FakeClock is a clock which only moves when it's advanced.
+// Its timers fire as Advance passes their time, in the order of their times.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock creates a clock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer creates a timer firing once the clock is advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) inkinspot.Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+
+	return t
+}
+
+// After returns the channel of a new timer.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// Advance moves the clock by d, firing the timers it passes.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var fired, pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			fired = append(fired, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	slices.SortStableFunc(fired, func(a, b *fakeTimer) int { return a.at.Compare(b.at) })
+	for _, t := range fired {
+		select {
+		case t.c <- t.at:
+		default:
+		}
+	}
+}
+
+// Waiters returns the number of the timers which haven't fired nor been stopped.
+// Tests wait on it for the code under test to block on the clock before advancing it.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// fakeTimer is a timer of a FakeClock.
+type fakeTimer struct {
+	clock *FakeClock
+	c     chan time.Time
+	at    time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop removes the timer from the clock, it reports whether the timer was pending.
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	return t.remove()
+}
+
+// Reset sets the timer to fire once the clock is advanced by d.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	pending := t.remove()
+	t.at = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.mu.Unlock()
+
+	if d <= 0 {
+		t.clock.Advance(0)
+	}
+
+	return pending
+}
+
+// remove drops the timer from the clock, which must be locked.
+func (t *fakeTimer) remove() bool {
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
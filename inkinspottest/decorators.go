@@ -0,0 +1,209 @@
+package inkinspottest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// ErrInjected is returned by the calls a FaultyStore fails, unless it's given another error.
+var ErrInjected = errors.New("injected fault")
+
+// decorator forwards the store calls to the wrapped store once its hook lets them through.
+// It implements the image & vector store interfaces with their writers,
+// the calls the wrapped store doesn't implement fail with errors.ErrUnsupported.
+type decorator struct {
+	store any
+	hook  func(ctx context.Context) error
+}
+
+func unsupported(store any, method string) error {
+	return fmt.Errorf("%T has no %s: %w", store, method, errors.ErrUnsupported)
+}
+
+// GetTattoosByID forwards to the wrapped image store.
+func (d *decorator) GetTattoosByID(ctx context.Context, ids []string) ([]inkinspot.TattooImagesCollection, error) {
+	s, ok := d.store.(inkinspot.ImageStore)
+	if !ok {
+		return nil, unsupported(d.store, "GetTattoosByID")
+	}
+	if err := d.hook(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetTattoosByID(ctx, ids)
+}
+
+// AddCollection forwards to the wrapped collection writer.
+func (d *decorator) AddCollection(ctx context.Context, c inkinspot.TattooImagesCollection) error {
+	s, ok := d.store.(inkinspot.CollectionWriter)
+	if !ok {
+		return unsupported(d.store, "AddCollection")
+	}
+	if err := d.hook(ctx); err != nil {
+		return err
+	}
+
+	return s.AddCollection(ctx, c)
+}
+
+// GetIDsByQuery forwards to the wrapped vector store.
+func (d *decorator) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	s, ok := d.store.(inkinspot.VectorStore)
+	if !ok {
+		return nil, unsupported(d.store, "GetIDsByQuery")
+	}
+	if err := d.hook(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetIDsByQuery(ctx, query)
+}
+
+// AddVector forwards to the wrapped vector writer.
+func (d *decorator) AddVector(ctx context.Context, v inkinspot.TattooImagesVector) error {
+	s, ok := d.store.(inkinspot.VectorWriter)
+	if !ok {
+		return unsupported(d.store, "AddVector")
+	}
+	if err := d.hook(ctx); err != nil {
+		return err
+	}
+
+	return s.AddVector(ctx, v)
+}
+
+// FaultyStore wraps an image or a vector store & fails some of its calls.
+// Every call counts, whichever method it is.
+type FaultyStore struct {
+	decorator
+	every int64
+	after int64
+	err   error
+	calls atomic.Int64
+}
+
+// FaultyOption configures the failures of a FaultyStore.
+type FaultyOption func(*FaultyStore)
+
+// FailEvery fails every nth call.
+func FailEvery(n int) FaultyOption {
+	return func(s *FaultyStore) {
+		s.every = int64(n)
+	}
+}
+
+// FailAfter fails every call after the first n.
+func FailAfter(n int) FaultyOption {
+	return func(s *FaultyStore) {
+		s.after = int64(n)
+	}
+}
+
+// WithFault sets the error of the failed calls.
+func WithFault(err error) FaultyOption {
+	return func(s *FaultyStore) {
+		s.err = err
+	}
+}
+
+// NewFaultyStore wraps the store, without options no call fails.
+func NewFaultyStore(store any, opts ...FaultyOption) *FaultyStore {
+	s := &FaultyStore{err: ErrInjected}
+	s.decorator = decorator{store: store, hook: s.fault}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Calls returns the number of calls made to the store.
+func (s *FaultyStore) Calls() int {
+	return int(s.calls.Load())
+}
+
+// fault counts the call & returns the error of a failed one.
+func (s *FaultyStore) fault(ctx context.Context) error {
+	n := s.calls.Add(1)
+	if (s.every > 0 && n%s.every == 0) || (s.after > 0 && n > s.after) {
+		return s.err
+	}
+
+	return nil
+}
+
+// LatencyStore wraps an image or a vector store & delays each of its calls.
+// The delayed calls return the context's error once it ends.
+type LatencyStore struct {
+	decorator
+	delay  time.Duration
+	jitter time.Duration
+	clock  inkinspot.Clock
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// LatencyOption configures the delays of a LatencyStore.
+type LatencyOption func(*LatencyStore)
+
+// WithJitter adds a random delay of up to jitter to every call, drawn from the seed.
+func WithJitter(jitter time.Duration, seed uint64) LatencyOption {
+	return func(s *LatencyStore) {
+		s.jitter = jitter
+		s.rand = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// WithLatencyClock times the delays on the clock, the real clock by default.
+func WithLatencyClock(c inkinspot.Clock) LatencyOption {
+	return func(s *LatencyStore) {
+		s.clock = c
+	}
+}
+
+// NewLatencyStore wraps the store, delaying every call by delay.
+func NewLatencyStore(store any, delay time.Duration, opts ...LatencyOption) *LatencyStore {
+	s := &LatencyStore{delay: delay}
+	s.decorator = decorator{store: store, hook: s.wait}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// wait sleeps for the delay & the jitter, or until the context ends.
+func (s *LatencyStore) wait(ctx context.Context) error {
+	d := s.delay
+	if s.jitter > 0 {
+		s.mu.Lock()
+		d += time.Duration(s.rand.Int64N(int64(s.jitter) + 1))
+		s.mu.Unlock()
+	}
+
+	var fire <-chan time.Time
+	if s.clock != nil {
+		t := s.clock.NewTimer(d)
+		defer t.Stop()
+		fire = t.C()
+	} else {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		fire = t.C
+	}
+
+	select {
+	case <-fire:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
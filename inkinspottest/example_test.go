@@ -0,0 +1,45 @@
+package inkinspottest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+	"github.com/DanyPops/inkinspot/migrate"
+)
+
+// An image store slower than its timeout fails the search with ErrImageStoreTimeout.
+func ExampleLatencyStore() {
+	is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+	slow := inkinspottest.NewLatencyStore(is, time.Second)
+
+	cfg := inkinspot.Configuration{TimeoutPolicy: inkinspot.TimeoutPolicy{ImageStoreTimeout: 10 * time.Millisecond}}
+	engine := inkinspot.NewSearchEngine(cfg, slow, vs)
+
+	_, err := engine.MultiSearch(context.Background(), []string{"lion"}, inkinspot.SearchOptions{})
+	fmt.Println(errors.Is(err, inkinspot.ErrImageStoreTimeout))
+	// Output: true
+}
+
+// A migration retries the writes which fail now & then.
+func ExampleFaultyStore() {
+	src := migrate.StorePair{Images: inkinspot.NewMemoryImageStore(), Vectors: inkinspot.NewMemoryVectorStore()}
+	for _, f := range inkinspottest.BigCats {
+		_ = src.Images.(inkinspot.CollectionWriter).AddCollection(context.Background(), f.Collection)
+		_ = src.Vectors.(inkinspot.VectorWriter).AddVector(context.Background(), f.Vector)
+	}
+
+	images, vectors := inkinspottest.NewFakeStores()
+	flaky := inkinspottest.NewFaultyStore(images, inkinspottest.FailEvery(2))
+	dst := migrate.StorePair{Images: flaky, Vectors: vectors}
+
+	report, err := migrate.CopyAll(context.Background(), src, dst, migrate.MigrateOptions{Concurrency: 1, RetryBackoff: time.Millisecond})
+	fmt.Println(report.Copied, report.Failed, err)
+	fmt.Println(flaky.Calls())
+	// Output:
+	// 3 0 <nil>
+	// 5
+}
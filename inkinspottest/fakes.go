@@ -0,0 +1,223 @@
+// Package inkinspottest provides fake stores & fault injecting decorators for testing code built on inkinspot.
+package inkinspottest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// Fixture is a collection & the vector of the same ID.
+type Fixture struct {
+	Collection inkinspot.TattooImagesCollection
+	Vector     inkinspot.TattooImagesVector
+}
+
+// BigCats are two lions & a tiger.
+// X is a realistic black & white lion on the chest, Y a colored neotrad lion on the arm
+// & Z an abstract black & white tiger on the chest.
+var BigCats = []Fixture{
+	{
+		inkinspot.TattooImagesCollection{
+			ID:   "X",
+			URLs: []string{"lion_realistic_bw_chest.jpg"},
+		},
+		inkinspot.TattooImagesVector{
+			ID:      "X",
+			Style:   inkinspot.LabelSet{"realistic": 100, "bw": 100},
+			Subject: inkinspot.LabelSet{"lion": 100},
+			Area:    inkinspot.LabelSet{"chest": 100},
+		},
+	},
+	{
+		inkinspot.TattooImagesCollection{
+			ID:   "Y",
+			URLs: []string{"lion_neotrad_color_arm.jpg"},
+		},
+		inkinspot.TattooImagesVector{
+			ID:      "Y",
+			Style:   inkinspot.LabelSet{"neotrad": 100, "color": 100},
+			Subject: inkinspot.LabelSet{"lion": 100},
+			Area:    inkinspot.LabelSet{"arm": 100},
+		},
+	},
+	{
+		inkinspot.TattooImagesCollection{
+			ID:   "Z",
+			URLs: []string{"tiger_abstract_bw_chest.jpg"},
+		},
+		inkinspot.TattooImagesVector{
+			ID:      "Z",
+			Style:   inkinspot.LabelSet{"abstract": 100, "bw": 100},
+			Subject: inkinspot.LabelSet{"tiger": 100},
+			Area:    inkinspot.LabelSet{"chest": 100},
+		},
+	},
+}
+
+// NewFakeStores creates fake stores seeded with the fixtures.
+func NewFakeStores(fixtures ...Fixture) (*FakeImageStore, *FakeVectorStore) {
+	is := NewFakeImageStore()
+	vs := NewFakeVectorStore()
+	for _, f := range fixtures {
+		is.collections[f.Collection.ID] = f.Collection
+		vs.vectors[f.Vector.ID] = f.Vector
+	}
+
+	return is, vs
+}
+
+// FakeImageStore keeps the collections in a map.
+type FakeImageStore struct {
+	mu          sync.RWMutex
+	collections map[string]inkinspot.TattooImagesCollection
+}
+
+// NewFakeImageStore creates a fake image store seeded with the collections.
+func NewFakeImageStore(collections ...inkinspot.TattooImagesCollection) *FakeImageStore {
+	s := &FakeImageStore{collections: make(map[string]inkinspot.TattooImagesCollection)}
+	for _, c := range collections {
+		s.collections[c.ID] = c
+	}
+
+	return s
+}
+
+// GetTattoosByID returns the known collections in the order of the IDs.
+// Unknown IDs are reported by a MissingIDsError, repeated IDs are returned once.
+func (s *FakeImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]inkinspot.TattooImagesCollection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]inkinspot.TattooImagesCollection, 0, len(ids))
+	var missing []string
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if c, ok := s.collections[id]; ok {
+			out = append(out, c)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return out, &inkinspot.MissingIDsError{IDs: missing}
+	}
+
+	return out, nil
+}
+
+// AddCollection stores the collection, replacing any with the same ID.
+func (s *FakeImageStore) AddCollection(ctx context.Context, c inkinspot.TattooImagesCollection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections[c.ID] = c
+
+	return nil
+}
+
+// FakeVectorStore keeps the vectors in a map.
+// A query matches the vectors with a label word starting with one of its words.
+// Which holds for the stems of the default analyzer.
+type FakeVectorStore struct {
+	mu      sync.RWMutex
+	vectors map[string]inkinspot.TattooImagesVector
+}
+
+// NewFakeVectorStore creates a fake vector store seeded with the vectors.
+func NewFakeVectorStore(vectors ...inkinspot.TattooImagesVector) *FakeVectorStore {
+	s := &FakeVectorStore{vectors: make(map[string]inkinspot.TattooImagesVector)}
+	for _, v := range vectors {
+		s.vectors[v.ID] = v
+	}
+
+	return s
+}
+
+// GetIDsByQuery returns the IDs of the matched vectors in lexical order.
+func (s *FakeVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(strings.ToLower(query))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for id, v := range s.vectors {
+		if matchesVector(words, v) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// GetVectorsByID returns the known vectors in the order of the IDs.
+// Unknown IDs are skipped, repeated IDs are returned once.
+func (s *FakeVectorStore) GetVectorsByID(ctx context.Context, ids []string) ([]inkinspot.TattooImagesVector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]inkinspot.TattooImagesVector, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if v, ok := s.vectors[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, v)
+		}
+	}
+
+	return out, nil
+}
+
+// AddVector stores the vector, replacing any with the same ID.
+func (s *FakeVectorStore) AddVector(ctx context.Context, v inkinspot.TattooImagesVector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vectors[v.ID] = v
+
+	return nil
+}
+
+// matchesVector reports whether a label word of the vector starts with one of the words.
+func matchesVector(words []string, v inkinspot.TattooImagesVector) bool {
+	for _, ls := range []inkinspot.LabelSet{v.Style, v.Subject, v.Area} {
+		for label := range ls {
+			for _, lw := range strings.Fields(strings.ToLower(label)) {
+				for _, w := range words {
+					if strings.HasPrefix(lw, w) {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
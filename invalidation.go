@@ -0,0 +1,112 @@
+package inkinspot
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Cache invalidation modes, for CachePolicy.Invalidation.
+const (
+	// CacheInvalidateTargeted purges the cached searches sharing a token with the labels written.
+	CacheInvalidateTargeted = "targeted"
+	// CacheInvalidateFlush purges the whole cache on every write.
+	CacheInvalidateFlush = "flush"
+)
+
+// cacheInvalidation collects the label tokens of the vectors written, before & after the writes.
+// The cached searches of these tokens are purged once the writes are done.
+type cacheInvalidation struct {
+	analyzer Analyzer
+
+	mu     sync.Mutex
+	tokens map[string]bool
+	// all is set when the labels of a write are unknown, the whole cache is purged.
+	all bool
+}
+
+func (e *SearchEngine) newCacheInvalidation() *cacheInvalidation {
+	return &cacheInvalidation{
+		analyzer: e.labelAnalyzer,
+		tokens:   make(map[string]bool),
+		all:      e.configuration.CachePolicy.Invalidation != CacheInvalidateTargeted,
+	}
+}
+
+// addVector adds the tokens of the labels of the vector.
+func (inv *cacheInvalidation) addVector(v TattooImagesVector) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	for _, ls := range []LabelSet{v.Style, v.Subject, v.Area} {
+		for label := range ls {
+			for _, token := range inv.analyzer.Analyze(label) {
+				inv.tokens[token] = true
+			}
+		}
+	}
+}
+
+// addAll purges the whole cache, when the labels of a write are unknown.
+func (inv *cacheInvalidation) addAll() {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.all = true
+}
+
+// addStored adds the tokens of the vector stored under the ID, which is about to be replaced.
+func (e *SearchEngine) addStored(ctx context.Context, inv *cacheInvalidation, id string) {
+	inv.mu.Lock()
+	all := inv.all
+	inv.mu.Unlock()
+	if all {
+		return
+	}
+
+	lookup, ok := storeAs[VectorLookup](e.vectorStore)
+	if !ok {
+		inv.addAll()
+		return
+	}
+	vectors, err := lookup.GetVectorsByID(ctx, []string{id})
+	if err != nil {
+		inv.addAll()
+		return
+	}
+	for _, v := range vectors {
+		inv.addVector(v)
+	}
+}
+
+// invalidate purges the cached searches the writes affect.
+func (e *SearchEngine) invalidate(inv *cacheInvalidation) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if inv.all {
+		e.cache.purge()
+		return
+	}
+	if len(inv.tokens) > 0 {
+		e.cache.purgeTokens(inv.tokens)
+	}
+}
+
+// queryTokens returns the label tokens the queries match, the ones fuzzy matching replaced included.
+func (e *SearchEngine) queryTokens(queries []ParsedQuery) []string {
+	var tokens []string
+	for _, q := range queries {
+		tokens = append(tokens, e.labelAnalyzer.Analyze(strings.Join(q.Stems, " "))...)
+		for _, c := range q.Corrections {
+			tokens = append(tokens, e.labelAnalyzer.Analyze(c.Stem)...)
+		}
+	}
+
+	return tokens
+}
+
+// resultTokens returns the label tokens of the queries & the filters of the result.
+func (e *SearchEngine) resultTokens(res *SearchResult) []string {
+	return append(e.queryTokens(res.Queries), e.filterTokens(res.Filters)...)
+}
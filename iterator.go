@@ -0,0 +1,169 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+)
+
+// CollectionIterator streams the collections of an image store, ordered by ID.
+// Next returns ErrIteratorDone after the last collection, ErrIteratorClosed once it's closed.
+// The iterator must be closed, it may hold resources of the store until then.
+type CollectionIterator interface {
+	Next(ctx context.Context) (TattooImagesCollection, error)
+	Close() error
+}
+
+// CollectionIterable is implemented by the image stores.
+// Which can stream all their collections.
+type CollectionIterable interface {
+	IterateCollections(ctx context.Context) (CollectionIterator, error)
+}
+
+// listingIterator streams the pages of a CollectionLister.
+type listingIterator struct {
+	lister   CollectionLister
+	pageSize int
+	cursor   string
+	page     []TattooImagesCollection
+	last     bool
+	closed   bool
+}
+
+// NewListingIterator streams the collections of the lister, listing pageSize of them at once.
+// It holds nothing of the store between the pages.
+func NewListingIterator(lister CollectionLister, pageSize int) CollectionIterator {
+	return &listingIterator{lister: lister, pageSize: max(pageSize, 1)}
+}
+
+func (it *listingIterator) Next(ctx context.Context) (TattooImagesCollection, error) {
+	if it.closed {
+		return TattooImagesCollection{}, ErrIteratorClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return TattooImagesCollection{}, err
+	}
+
+	for len(it.page) == 0 {
+		if it.last {
+			return TattooImagesCollection{}, ErrIteratorDone
+		}
+		page, next, err := it.lister.ListCollections(ctx, it.cursor, it.pageSize)
+		if err != nil {
+			return TattooImagesCollection{}, err
+		}
+		it.page, it.cursor, it.last = page, next, next == ""
+	}
+
+	c := it.page[0]
+	it.page = it.page[1:]
+
+	return c, nil
+}
+
+func (it *listingIterator) Close() error {
+	it.closed = true
+	it.page = nil
+
+	return nil
+}
+
+// IterateStore streams the collections of the image store, by its iterator or its pages of pageSize.
+// It returns ErrExportUnsupported when the store can do neither.
+func IterateStore(ctx context.Context, store ImageStore, pageSize int) (CollectionIterator, error) {
+	if iterable, ok := storeAs[CollectionIterable](store); ok {
+		return iterable.IterateCollections(ctx)
+	}
+	if lister, ok := storeAs[CollectionLister](store); ok {
+		return NewListingIterator(lister, pageSize), nil
+	}
+
+	return nil, ErrExportUnsupported
+}
+
+// ForEach calls fn with every collection of the iterator & closes it.
+// The context is checked between the collections, fn stops the iteration by returning an error.
+func ForEach(ctx context.Context, it CollectionIterator, fn func(TattooImagesCollection) error) (err error) {
+	defer func() {
+		err = errors.Join(err, it.Close())
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c, err := it.Next(ctx)
+		if errors.Is(err, ErrIteratorDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+}
+
+// CollectAll returns every collection of the iterator & closes it.
+func CollectAll(ctx context.Context, it CollectionIterator) ([]TattooImagesCollection, error) {
+	var out []TattooImagesCollection
+	err := ForEach(ctx, it, func(c TattooImagesCollection) error {
+		out = append(out, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// NextBatch returns up to n collections of the iterator, fewer at its end.
+// It returns ErrIteratorDone once there are none left, the iterator isn't closed.
+func NextBatch(ctx context.Context, it CollectionIterator, n int) ([]TattooImagesCollection, error) {
+	var batch []TattooImagesCollection
+	for len(batch) < n {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c, err := it.Next(ctx)
+		if errors.Is(err, ErrIteratorDone) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, c)
+	}
+	if len(batch) == 0 {
+		return nil, ErrIteratorDone
+	}
+
+	return batch, nil
+}
+
+// iterateCollections streams the collections of the image store, every page listed within the image store timeout.
+func (e *SearchEngine) iterateCollections(ctx context.Context) (CollectionIterator, error) {
+	if iterable, ok := storeAs[CollectionIterable](e.imageStore); ok {
+		return iterable.IterateCollections(ctx)
+	}
+	lister, ok := storeAs[CollectionLister](e.imageStore)
+	if !ok {
+		return nil, ErrExportUnsupported
+	}
+
+	return NewListingIterator(timedLister{e, lister}, exportPageSize), nil
+}
+
+// timedLister bounds every page of the lister by the image store timeout.
+type timedLister struct {
+	e      *SearchEngine
+	lister CollectionLister
+}
+
+func (l timedLister) ListCollections(ctx context.Context, cursor string, limit int) ([]TattooImagesCollection, string, error) {
+	lcCtx, lcCancel := l.e.withTightTimeout(ctx, l.e.imageStoreTimeout(ctx))
+	defer lcCancel()
+
+	return l.lister.ListCollections(lcCtx, cursor, limit)
+}
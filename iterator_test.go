@@ -0,0 +1,89 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collection iterators", func() {
+	var is *searchAPI.MemoryImageStore
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		// more than a page of the memory store iterators.
+		for i := range 300 {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: fmt.Sprintf("c-%03d", i)})).To(Succeed())
+		}
+	})
+
+	iterate := func() searchAPI.CollectionIterator {
+		GinkgoHelper()
+		it, err := searchAPI.IterateStore(context.Background(), is, 10)
+		Expect(err).NotTo(HaveOccurred())
+		return it
+	}
+
+	It("streams every collection ordered by ID", func() {
+		all, err := searchAPI.CollectAll(context.Background(), iterate())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(300))
+		Expect(all[0].ID).To(Equal("c-000"))
+		Expect(all[299].ID).To(Equal("c-299"))
+	})
+
+	It("keeps returning ErrIteratorDone past the last collection", func() {
+		it := iterate()
+		DeferCleanup(it.Close)
+		batch, err := searchAPI.NextBatch(context.Background(), it, 1000)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(300))
+
+		_, err = it.Next(context.Background())
+		Expect(err).To(MatchError(searchAPI.ErrIteratorDone))
+		_, err = it.Next(context.Background())
+		Expect(err).To(MatchError(searchAPI.ErrIteratorDone))
+	})
+
+	It("stops at the cancellation between the collections", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		seen := 0
+		err := searchAPI.ForEach(ctx, iterate(), func(c searchAPI.TattooImagesCollection) error {
+			seen++
+			if seen == 3 {
+				cancel()
+			}
+			return nil
+		})
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(seen).To(Equal(3))
+	})
+
+	It("stops at the error of the callback", func() {
+		stop := fmt.Errorf("stop")
+		seen := 0
+		err := searchAPI.ForEach(context.Background(), iterate(), func(c searchAPI.TattooImagesCollection) error {
+			seen++
+			return stop
+		})
+		Expect(err).To(MatchError(stop))
+		Expect(seen).To(Equal(1))
+	})
+
+	It("refuses to be reused once it's closed", func() {
+		it := iterate()
+		_, err := searchAPI.CollectAll(context.Background(), it)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = it.Next(context.Background())
+		Expect(err).To(MatchError(searchAPI.ErrIteratorClosed))
+		_, err = searchAPI.CollectAll(context.Background(), it)
+		Expect(err).To(MatchError(searchAPI.ErrIteratorClosed))
+	})
+})
@@ -0,0 +1,248 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job is a chore run in the background every Interval, like snapshotting the stores.
+// A run never overlaps another run of the same job, its context ends when the jobs stop.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// JobStatus reports a job & its last run.
+type JobStatus struct {
+	Name           string    `json:"name"`
+	IntervalMS     float64   `json:"interval_ms"`
+	Running        bool      `json:"running"`
+	Runs           int       `json:"runs"`
+	Skipped        int       `json:"skipped"`
+	LastRun        time.Time `json:"last_run"`
+	LastDurationMS float64   `json:"last_duration_ms"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// jobRunner runs the registered jobs on their intervals, once started & until stopped.
+type jobRunner struct {
+	clock  Clock
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[string]*jobState
+	started bool
+	stopped bool
+}
+
+type jobState struct {
+	job    Job
+	status JobStatus
+}
+
+func newJobRunner(clock Clock) *jobRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &jobRunner{clock: clock, ctx: ctx, cancel: cancel, jobs: make(map[string]*jobState)}
+}
+
+// RegisterJob adds the job, it's scheduled at once when the jobs are started.
+// It returns ErrInvalidJob when the job has no name, run or interval, or its name is taken.
+func (e *SearchEngine) RegisterJob(j Job) error {
+	if strings.TrimSpace(j.Name) == "" || j.Run == nil || j.Interval <= 0 {
+		return fmt.Errorf("%w: a job needs a name, a run & a positive interval", ErrInvalidJob)
+	}
+
+	r := e.jobs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[j.Name]; ok {
+		return fmt.Errorf("%w: %q is already registered", ErrInvalidJob, j.Name)
+	}
+	js := &jobState{job: j, status: JobStatus{Name: j.Name, IntervalMS: milliseconds(j.Interval)}}
+	r.jobs[j.Name] = js
+	if r.started && !r.stopped {
+		r.schedule(js)
+	}
+
+	return nil
+}
+
+// StartJobs schedules the registered jobs, along with the server.
+func (e *SearchEngine) StartJobs() {
+	r := e.jobs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started || r.stopped {
+		return
+	}
+	r.started = true
+	for _, js := range r.jobs {
+		r.schedule(js)
+	}
+}
+
+// StopJobs ends the context of the running jobs & waits for them until ctx ends.
+// No job runs after it's called.
+func (e *SearchEngine) StopJobs(ctx context.Context) error {
+	r := e.jobs
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs still running: %w", ctx.Err())
+	}
+}
+
+// Jobs reports the registered jobs, by name.
+func (e *SearchEngine) Jobs() []JobStatus {
+	r := e.jobs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]JobStatus, 0, len(r.jobs))
+	for _, js := range r.jobs {
+		out = append(out, js.status)
+	}
+	slices.SortFunc(out, func(a, b JobStatus) int { return strings.Compare(a.Name, b.Name) })
+
+	return out
+}
+
+// TriggerJob runs the job now in the background, its schedule is left as is.
+// It returns ErrJobNotFound for an unknown job & ErrJobRunning when it's already running.
+func (e *SearchEngine) TriggerJob(name string) error {
+	r := e.jobs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	js, ok := r.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrJobNotFound, name)
+	}
+
+	return r.run(js)
+}
+
+// schedule runs the job every interval until the jobs stop, the runs still going are skipped.
+// The runner must be locked.
+func (r *jobRunner) schedule(js *jobState) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			t := r.clock.NewTimer(js.job.Interval)
+			select {
+			case <-r.ctx.Done():
+				t.Stop()
+				return
+			case <-t.C():
+			}
+
+			r.mu.Lock()
+			if err := r.run(js); errors.Is(err, ErrJobRunning) {
+				js.status.Skipped++
+			}
+			r.mu.Unlock()
+		}
+	}()
+}
+
+// run starts a run of the job unless it's running or the jobs stopped.
+// The runner must be locked.
+func (r *jobRunner) run(js *jobState) error {
+	if r.stopped {
+		return ErrJobsStopped
+	}
+	if js.status.Running {
+		return fmt.Errorf("%w: %q", ErrJobRunning, js.job.Name)
+	}
+	js.status.Running = true
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		start := r.clock.Now()
+		err := js.job.Run(r.ctx)
+		if err != nil {
+			slog.ErrorContext(r.ctx, "job failed", "job", js.job.Name, "error", err)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		js.status.Running = false
+		js.status.Runs++
+		js.status.LastRun = start
+		js.status.LastDurationMS = milliseconds(r.clock.Now().Sub(start))
+		js.status.LastError = ""
+		if err != nil {
+			js.status.LastError = err.Error()
+		}
+	}()
+
+	return nil
+}
+
+// SnapshotJob saves the stores to the path of the policy every interval.
+// A zero interval is the default of the policy.
+func SnapshotJob(p SnapshotPolicy, is *MemoryImageStore, vs *MemoryVectorStore) Job {
+	p = p.withDefaults()
+
+	return Job{
+		Name:     "snapshot",
+		Interval: p.Interval,
+		Run: func(ctx context.Context) error {
+			return SaveSnapshot(p.Path, is, vs)
+		},
+	}
+}
+
+// handleJobs reports the jobs.
+func handleJobs(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.Jobs())
+	})
+}
+
+// handleJobRun triggers the job of the name in the path.
+func handleJobRun(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := se.TriggerJob(r.PathValue("name"))
+		switch {
+		case err == nil:
+			se.recordAudit(w, r, AuditJobRun, r.PathValue("name"), "", "")
+			writeJSON(w, http.StatusAccepted, se.Jobs())
+		case errors.Is(err, ErrJobNotFound):
+			writeError(w, http.StatusNotFound, "job_not_found", err.Error())
+		case errors.Is(err, ErrJobRunning):
+			writeError(w, http.StatusConflict, "job_running", err.Error())
+		case errors.Is(err, ErrJobsStopped):
+			writeError(w, http.StatusServiceUnavailable, "jobs_stopped", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "triggering the job failed")
+		}
+	})
+}
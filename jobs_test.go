@@ -0,0 +1,186 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("Jobs", func() {
+	const interval = time.Minute
+
+	var (
+		clock  *inkinspottest.FakeClock
+		engine *searchAPI.SearchEngine
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		engine = searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))
+		DeferCleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			Expect(engine.StopJobs(ctx)).To(Succeed())
+		})
+	})
+
+	// tick advances the clock by the interval once the schedules wait on it.
+	tick := func(waiters int) {
+		GinkgoHelper()
+		Eventually(clock.Waiters).Should(Equal(waiters))
+		clock.Advance(interval)
+	}
+
+	status := func(name string) searchAPI.JobStatus {
+		for _, s := range engine.Jobs() {
+			if s.Name == name {
+				return s
+			}
+		}
+		return searchAPI.JobStatus{}
+	}
+
+	It("runs the jobs every interval once started", func() {
+		var runs atomic.Int32
+		failing := errors.New("disk full")
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "count", Interval: interval, Run: func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}})).To(Succeed())
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "fail", Interval: interval, Run: func(context.Context) error {
+			return failing
+		}})).To(Succeed())
+
+		Consistently(clock.Waiters).Should(BeZero(), "nothing is scheduled before the start")
+		engine.StartJobs()
+		tick(2)
+		Eventually(runs.Load).Should(BeEquivalentTo(1))
+		tick(2)
+		Eventually(runs.Load).Should(BeEquivalentTo(2))
+
+		Eventually(func() int { return status("fail").Runs }).Should(Equal(2))
+		Expect(status("fail").LastError).To(Equal("disk full"))
+		Expect(status("count")).To(MatchFields(IgnoreExtras, Fields{
+			"Runs":       Equal(2),
+			"LastRun":    Equal(clock.Now()),
+			"IntervalMS": Equal(float64(interval.Milliseconds())),
+			"LastError":  BeEmpty(),
+		}))
+	})
+
+	It("never overlaps the runs of a job", func() {
+		release := make(chan struct{})
+		var runs atomic.Int32
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "slow", Interval: interval, Run: func(context.Context) error {
+			runs.Add(1)
+			<-release
+			return nil
+		}})).To(Succeed())
+		engine.StartJobs()
+
+		tick(1)
+		Eventually(func() bool { return status("slow").Running }).Should(BeTrue())
+		Expect(engine.TriggerJob("slow")).To(MatchError(searchAPI.ErrJobRunning))
+		tick(1)
+		Eventually(func() int { return status("slow").Skipped }).Should(Equal(1))
+		Expect(runs.Load()).To(BeEquivalentTo(1))
+
+		close(release)
+		Eventually(func() int { return status("slow").Runs }).Should(Equal(1))
+		Expect(engine.TriggerJob("slow")).To(Succeed())
+		Eventually(func() int { return status("slow").Runs }).Should(Equal(2))
+	})
+
+	It("ends the runs' context on stop & waits for them", func() {
+		started := make(chan struct{})
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "wait", Interval: interval, Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}})).To(Succeed())
+		engine.StartJobs()
+		Expect(engine.TriggerJob("wait")).To(Succeed())
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(engine.StopJobs(ctx)).To(Succeed())
+		Expect(status("wait")).To(MatchFields(IgnoreExtras, Fields{"Running": BeFalse(), "LastError": Equal("context canceled")}))
+		Expect(clock.Waiters()).To(BeZero())
+		Expect(engine.TriggerJob("wait")).To(MatchError(searchAPI.ErrJobsStopped))
+	})
+
+	It("gives up on the runs ignoring the stop", func() {
+		release := make(chan struct{})
+		DeferCleanup(func() { close(release) })
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "stuck", Interval: interval, Run: func(context.Context) error {
+			<-release
+			return nil
+		}})).To(Succeed())
+		Expect(engine.TriggerJob("stuck")).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		Expect(engine.StopJobs(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("rejects the invalid jobs", func() {
+		run := func(context.Context) error { return nil }
+		Expect(engine.RegisterJob(searchAPI.Job{Interval: interval, Run: run})).To(MatchError(searchAPI.ErrInvalidJob))
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "a", Run: run})).To(MatchError(searchAPI.ErrInvalidJob))
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "a", Interval: interval})).To(MatchError(searchAPI.ErrInvalidJob))
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "a", Interval: interval, Run: run})).To(Succeed())
+		Expect(engine.RegisterJob(searchAPI.Job{Name: "a", Interval: interval, Run: run})).To(MatchError(searchAPI.ErrInvalidJob))
+	})
+
+	Describe("admin endpoints", func() {
+		var se *httptest.Server
+
+		BeforeEach(func() {
+			Expect(engine.RegisterJob(searchAPI.Job{Name: "noop", Interval: interval, Run: func(context.Context) error { return nil }})).To(Succeed())
+			se = httptest.NewServer(searchAPI.NewHandler(engine))
+			DeferCleanup(se.Close)
+		})
+
+		jobsAdmin := func(method, path string, out any) int {
+			GinkgoHelper()
+			req, err := http.NewRequest(method, se.URL+path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+			return resp.StatusCode
+		}
+
+		It("lists the jobs & triggers them", func() {
+			var jobs []searchAPI.JobStatus
+			Expect(jobsAdmin(http.MethodPost, "/admin/jobs/noop/run", &jobs)).To(Equal(http.StatusAccepted))
+			Eventually(func() int {
+				jobsAdmin(http.MethodGet, "/admin/jobs", &jobs)
+				return jobs[0].Runs
+			}).Should(Equal(1))
+			Expect(jobs).To(HaveLen(1))
+			Expect(jobs[0].Name).To(Equal("noop"))
+
+			var res searchAPI.Response
+			Expect(jobsAdmin(http.MethodPost, "/admin/jobs/nope/run", &res)).To(Equal(http.StatusNotFound))
+			Expect(res.Error.Code).To(Equal("job_not_found"))
+		})
+	})
+})
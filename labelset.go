@@ -0,0 +1,97 @@
+package inkinspot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// MarshalJSON encodes the label set as an object of the proximities by label, the labels sorted,
+// so equal sets encode to the same bytes. A nil set is null.
+func (ls LabelSet) MarshalJSON() ([]byte, error) {
+	if ls == nil {
+		return []byte("null"), nil
+	}
+
+	return ls.appendJSON(nil, false)
+}
+
+// MarshalCompactJSON encodes the label set as an array of [label, proximity] pairs, the labels sorted,
+// as [["lion",0.9],["tiger",0.8]]. It's the wire form of the bandwidth sensitive clients, see CompactJSONEncoder.
+func (ls LabelSet) MarshalCompactJSON() ([]byte, error) {
+	return ls.appendJSON(nil, true)
+}
+
+// UnmarshalJSON decodes either form of the label sets, the object or the array of pairs.
+func (ls *LabelSet) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*ls = nil
+		return nil
+	case len(b) == 0 || b[0] != '[':
+		var m map[string]float64
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		*ls = m
+		return nil
+	}
+
+	var pairs [][]json.RawMessage
+	if err := json.Unmarshal(b, &pairs); err != nil {
+		return err
+	}
+	out := make(LabelSet, len(pairs))
+	for i, pair := range pairs {
+		var (
+			label     string
+			proximity float64
+		)
+		if len(pair) != 2 || json.Unmarshal(pair[0], &label) != nil || json.Unmarshal(pair[1], &proximity) != nil {
+			return fmt.Errorf("label set pair %d isn't a [label, proximity] pair", i)
+		}
+		out[label] = proximity
+	}
+	*ls = out
+
+	return nil
+}
+
+// appendJSON appends the label set in either form, a nil set is empty.
+func (ls LabelSet) appendJSON(b []byte, compact bool) ([]byte, error) {
+	labels := make([]string, 0, len(ls))
+	for label := range ls {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+
+	open, sep, end := byte('{'), byte(':'), "}"
+	if compact {
+		open, sep, end = '[', ',', "]"
+	}
+	b = append(b, open)
+	for i, label := range labels {
+		k, err := json.Marshal(label)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(ls[label])
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %w", label, err)
+		}
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if compact {
+			b = append(b, '[')
+		}
+		b = append(append(append(b, k...), sep), v...)
+		if compact {
+			b = append(b, ']')
+		}
+	}
+
+	return append(b, end...), nil
+}
@@ -0,0 +1,120 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LabelSet JSON", func() {
+	ls := searchAPI.LabelSet{"tiger": 0.8, "lion": 1, "koi": 0.25, "<rose>": 0.5}
+
+	It("encodes the labels in sorted order, escaped as encoding/json does", func() {
+		b, err := json.Marshal(ls)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal(`{"\u003crose\u003e":0.5,"koi":0.25,"lion":1,"tiger":0.8}`))
+
+		b, err = ls.MarshalCompactJSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal(`[["\u003crose\u003e",0.5],["koi",0.25],["lion",1],["tiger",0.8]]`))
+	})
+
+	It("encodes to the same bytes across runs", func() {
+		large := make(searchAPI.LabelSet, 200)
+		for i := range 200 {
+			large[fmt.Sprintf("label-%d", i)] = float64(i) / 7
+		}
+		first, err := json.Marshal(large)
+		Expect(err).NotTo(HaveOccurred())
+		firstCompact, err := large.MarshalCompactJSON()
+		Expect(err).NotTo(HaveOccurred())
+
+		for range 50 {
+			// a copy has another iteration order.
+			again := make(searchAPI.LabelSet, len(large))
+			for label, proximity := range large {
+				again[label] = proximity
+			}
+			Expect(json.Marshal(again)).To(Equal(first))
+			Expect(again.MarshalCompactJSON()).To(Equal(firstCompact))
+		}
+	})
+
+	DescribeTable("round trips",
+		func(encode func(searchAPI.LabelSet) ([]byte, error)) {
+			b, err := encode(ls)
+			Expect(err).NotTo(HaveOccurred())
+			var decoded searchAPI.LabelSet
+			Expect(json.Unmarshal(b, &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(ls))
+		},
+		Entry("the object form", func(ls searchAPI.LabelSet) ([]byte, error) { return json.Marshal(ls) }),
+		Entry("the compact form", searchAPI.LabelSet.MarshalCompactJSON),
+	)
+
+	It("decodes the compact form within the vectors", func() {
+		var v searchAPI.TattooImagesVector
+		Expect(json.Unmarshal([]byte(`{"ID":"X","Style":[["blackwork",0.9]],"Subject":{"lion":1},"Area":null}`), &v)).To(Succeed())
+		Expect(v.Style).To(Equal(searchAPI.LabelSet{"blackwork": 0.9}))
+		Expect(v.Subject).To(Equal(searchAPI.LabelSet{"lion": 1}))
+		Expect(v.Area).To(BeNil())
+	})
+
+	DescribeTable("refuses the malformed pairs",
+		func(raw string) {
+			var decoded searchAPI.LabelSet
+			Expect(json.Unmarshal([]byte(raw), &decoded)).NotTo(Succeed())
+		},
+		Entry("a single value", `[["lion"]]`),
+		Entry("a third value", `[["lion",1,2]]`),
+		Entry("a numeric label", `[[1,1]]`),
+		Entry("a string proximity", `[["lion","high"]]`),
+		Entry("a bare label", `["lion"]`),
+	)
+
+	It("is null when nil", func() {
+		b, err := json.Marshal(searchAPI.TattooImagesVector{ID: "X"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"Style":null`))
+	})
+
+	It("is served compact to the clients of the compact encoder", func() {
+		is, vs := searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "X"})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "X", Style: searchAPI.LabelSet{"realism": 0.5, "blackwork": 0.9}})).To(Succeed())
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs, searchAPI.WithResponseEncoder(searchAPI.CompactJSONEncoder))
+		se := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+
+		get := func(accept string) (string, string) {
+			GinkgoHelper()
+			req, err := http.NewRequest(http.MethodGet, se.URL+"/tattoos/X/vector", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Accept", accept)
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			b, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.Header.Get("Content-Type"), string(b)
+		}
+
+		contentType, body := get(searchAPI.MediaTypeCompactJSON)
+		Expect(contentType).To(HavePrefix(searchAPI.MediaTypeCompactJSON))
+		Expect(body).To(ContainSubstring(`"Area":[],`))
+		Expect(body).To(ContainSubstring(`"Style":[["blackwork",0.9],["realism",0.5]]`))
+
+		_, body = get(searchAPI.MediaTypeJSON)
+		Expect(body).To(ContainSubstring(`"Area":{},`))
+		Expect(body).To(ContainSubstring(`"Style":{"blackwork":0.9,"realism":0.5}`))
+	})
+})
@@ -0,0 +1,162 @@
+package inkinspot
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Language holds the query processing rules of a language.
+type Language struct {
+	// Tag is the BCP 47 tag of the language.
+	Tag string
+	// Stopwords are dropped from the query terms.
+	Stopwords map[string]bool
+	// Rewrite applies the language normalization rules to a term, may be nil.
+	Rewrite func(term string) string
+	// Stem reduces a term to its stem, may be nil.
+	// It must be idempotent as stems are stemmed again by the stores.
+	Stem func(term string) string
+}
+
+// agnosticLanguage is used for the tags without a registered language.
+// It keeps every term as is.
+var agnosticLanguage = &Language{Tag: language.Und.String()}
+
+// languages holds the registered languages by their base tag.
+// To add a language register it here with its stopwords & rules.
+var languages = map[string]*Language{
+	"en": {
+		Tag: "en",
+		Stopwords: stopwords(
+			"a", "an", "and", "at", "for", "in", "of", "on", "or", "my", "the", "to", "with",
+		),
+		Stem: stemEnglish,
+	},
+	"he": {
+		Tag: "he",
+		Stopwords: stopwords(
+			"על", "של", "את", "עם", "או", "גם", "ב", "ל", "ה", "ו",
+		),
+		Rewrite: stripHebrewArticle,
+	},
+}
+
+func stopwords(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+
+	return m
+}
+
+// stripHebrewArticle drops the definite article prefix "ה" from a term.
+// Short terms are kept, their first letter is likely part of the word.
+func stripHebrewArticle(term string) string {
+	if utf8.RuneCountInString(term) >= 4 && strings.HasPrefix(term, "ה") {
+		return strings.TrimPrefix(term, "ה")
+	}
+
+	return term
+}
+
+// stemEnglish is a light suffix stripping stemmer.
+// It conflates plurals & possessives, leaving other inflections intact.
+func stemEnglish(term string) string {
+	for _, possessive := range []string{"'s", "’s", "'", "’"} {
+		if strings.HasSuffix(term, possessive) {
+			term = strings.TrimSuffix(term, possessive)
+			break
+		}
+	}
+
+	switch {
+	case len(term) > 4 && strings.HasSuffix(term, "sses"):
+		return strings.TrimSuffix(term, "es")
+	case len(term) > 4 && strings.HasSuffix(term, "ies"):
+		return strings.TrimSuffix(term, "ies") + "y"
+	case strings.HasSuffix(term, "ss"), strings.HasSuffix(term, "us"), strings.HasSuffix(term, "is"):
+		return term
+	case len(term) > 3 && strings.HasSuffix(term, "s"):
+		return strings.TrimSuffix(term, "s")
+	}
+
+	return term
+}
+
+// lookupLanguage resolves a BCP 47 tag to its registered language.
+// Valid tags without a registered language fall back to the agnostic rules.
+func lookupLanguage(tag string) (*Language, error) {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLanguage, tag)
+	}
+
+	base, _ := t.Base()
+	if l, ok := languages[base.String()]; ok {
+		return l, nil
+	}
+
+	return agnosticLanguage, nil
+}
+
+// Analyzer turns query & label text into the stems they are matched by.
+// Queries and labels must go through equal analyzers to agree.
+type Analyzer struct {
+	Normalizer Normalizer
+	// Language holds the stopwords & rules, nil applies the agnostic ones.
+	Language *Language
+	// StemExceptions are terms which are never stemmed.
+	StemExceptions map[string]bool
+}
+
+func (a Analyzer) language() *Language {
+	if a.Language == nil {
+		return agnosticLanguage
+	}
+
+	return a.Language
+}
+
+// terms splits normalized text into terms by the language stopwords & rules.
+func (a Analyzer) terms(normalized string) []string {
+	lang := a.language()
+
+	out := make([]string, 0, strings.Count(normalized, " ")+1)
+	for rest := normalized; rest != ""; {
+		var term string
+		term, rest, _ = strings.Cut(rest, " ")
+		if term == "" || lang.Stopwords[term] {
+			continue
+		}
+		if lang.Rewrite != nil {
+			term = lang.Rewrite(term)
+		}
+		out = append(out, term)
+	}
+
+	return out
+}
+
+// stem reduces the term to its stem unless it's an exception.
+func (a Analyzer) stem(term string) string {
+	lang := a.language()
+	if lang.Stem == nil || a.StemExceptions[term] {
+		return term
+	}
+
+	return lang.Stem(term)
+}
+
+// Analyze normalizes the text and returns the stems of its terms.
+func (a Analyzer) Analyze(text string) []string {
+	terms := a.terms(a.Normalizer.Normalize(text))
+	for i, t := range terms {
+		terms[i] = a.stem(t)
+	}
+
+	return terms
+}
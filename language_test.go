@@ -0,0 +1,169 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query language", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		ctx := context.Background()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, tc := range inkinspottest.BigCats {
+			Expect(is.AddCollection(ctx, tc.Collection)).To(Succeed())
+			Expect(vs.AddVector(ctx, tc.Vector)).To(Succeed())
+		}
+		Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: "H", URLs: []string{"arye_haze.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{
+			ID:      "H",
+			Subject: searchAPI.LabelSet{"אריה": 100},
+			Area:    searchAPI.LabelSet{"חזה": 100},
+		})).To(Succeed())
+
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+	})
+
+	AfterEach(func() {
+		se.Close()
+	})
+
+	explained := func(q, lang string) searchAPI.ParsedQuery {
+		GinkgoHelper()
+		params := url.Values{"q": {q}, "explain": {"true"}}
+		if lang != "" {
+			params.Set("lang", lang)
+		}
+		res := doSearch(se, params)
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Explain).NotTo(BeNil())
+		Expect(res.JSON.Explain.Queries).To(HaveLen(1))
+
+		return res.JSON.Explain.Queries[0]
+	}
+
+	It("defaults to the configured language", func() {
+		pq := explained("lion on the chest", "")
+		Expect(pq.Lang).To(Equal("en"))
+		Expect(pq.Terms).To(Equal([]string{"lion", "chest"}))
+	})
+
+	It("applies the Hebrew stopwords & rules for lang=he", func() {
+		pq := explained("אריה על החזה", "he")
+		Expect(pq.Lang).To(Equal("he"))
+		Expect(pq.Terms).To(Equal([]string{"אריה", "חזה"}))
+	})
+
+	It("keeps the Hebrew words intact under the English rules", func() {
+		pq := explained("אריה על החזה", "en")
+		Expect(pq.Terms).To(Equal([]string{"אריה", "על", "החזה"}))
+	})
+
+	It("keeps the English stopwords under the Hebrew rules", func() {
+		pq := explained("lion on the chest", "he-IL")
+		Expect(pq.Terms).To(Equal([]string{"lion", "on", "the", "chest"}))
+	})
+
+	It("falls back to the language agnostic rules for unsupported tags", func() {
+		pq := explained("lion on the chest", "fr")
+		Expect(pq.Lang).To(Equal("und"))
+		Expect(pq.Terms).To(Equal([]string{"lion", "on", "the", "chest"}))
+	})
+
+	It("matches the Hebrew labels with lang=he", func() {
+		res := doSearch(se, url.Values{"q": {"אריה על החזה"}, "lang": {"he"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("H"))
+	})
+
+	It("returns a 400 Bad Request for a malformed tag", func() {
+		res := doSearch(se, url.Values{"q": {"lion"}, "lang": {"not a tag!"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_language"))
+	})
+
+	It("returns a 400 Bad Request for a query of stopwords only", func() {
+		res := doSearch(se, url.Values{"q": {"on the"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = Describe("Stemming", func() {
+	var se *httptest.Server
+
+	initServer := func(cfg searchAPI.Configuration) {
+		ctx := context.Background()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore(searchAPI.WithLabelAnalyzer(cfg.LabelAnalyzer()))
+		for _, tc := range inkinspottest.BigCats {
+			Expect(is.AddCollection(ctx, tc.Collection)).To(Succeed())
+			Expect(vs.AddVector(ctx, tc.Vector)).To(Succeed())
+		}
+		Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: "R", URLs: []string{"roses.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "R", Subject: searchAPI.LabelSet{"Roses": 100}})).To(Succeed())
+
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	}
+
+	DescribeTable("reduces English terms to their stems idempotently",
+		func(in string, expected []string) {
+			a := searchAPI.DefaultConfiguration().LabelAnalyzer()
+			stems := a.Analyze(in)
+			Expect(stems).To(Equal(expected))
+			Expect(a.Analyze(strings.Join(stems, " "))).To(Equal(expected))
+		},
+		Entry("plural", "lions", []string{"lion"}),
+		Entry("possessive", "lion's", []string{"lion"}),
+		Entry("plural possessive", "lions'", []string{"lion"}),
+		Entry("-ies plural", "butterflies", []string{"butterfly"}),
+		Entry("-sses plural", "crosses", []string{"cross"}),
+		Entry("double s", "cross", []string{"cross"}),
+		Entry("short word", "bus", []string{"bus"}),
+	)
+
+	It("matches the singular label for a plural query", func() {
+		initServer(searchAPI.Configuration{})
+		res := doSearch(se, url.Values{"q": {"lions"}, "explain": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("X", "Y"))
+
+		match := res.JSON.Explain.Hits[0].Matches[0]
+		Expect(match.Label).To(Equal("lion"))
+		Expect(match.Stem).To(Equal("lion"))
+	})
+
+	It("matches a possessive query", func() {
+		initServer(searchAPI.Configuration{})
+		res := doSearch(se, url.Values{"q": {"lion's chest"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y", "Z"}))
+	})
+
+	It("matches a plural label and reports it unstemmed", func() {
+		initServer(searchAPI.Configuration{})
+		res := doSearch(se, url.Values{"q": {"rose"}, "explain": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"R"}))
+		Expect(res.JSON.Explain.Hits[0].Matches[0].Label).To(Equal("Roses"))
+	})
+
+	It("never stems the configured exceptions", func() {
+		initServer(searchAPI.Configuration{QueryPolicy: searchAPI.QueryPolicy{StemExceptions: []string{"Lions"}}})
+		res := doSearch(se, url.Values{"q": {"lions"}, "explain": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Explain.Queries[0].Stems).To(Equal([]string{"lions"}))
+		Expect(res.JSON.ImageCollections).To(BeEmpty())
+	})
+})
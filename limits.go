@@ -0,0 +1,170 @@
+package inkinspot
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+)
+
+// ResponseLimits bound the size of the search responses, for the CDN to cache them.
+// A zero MaxBodyBytes is replaced by the default of 10MB, a zero MaxURLsPerCollection keeps every URL.
+type ResponseLimits struct {
+	// MaxURLsPerCollection cuts the URL lists of the collections, marking them urls_truncated.
+	MaxURLsPerCollection int
+	// MaxBodyBytes bounds the encoded body, its trailing results are dropped to fit.
+	MaxBodyBytes int
+}
+
+func (l ResponseLimits) withDefaults() ResponseLimits {
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = 10 << 20
+	}
+
+	return l
+}
+
+// limitURLs cuts the URLs of the collections of the response, the collections are copied.
+func (l ResponseLimits) limitURLs(resp *Response) {
+	if l.MaxURLsPerCollection <= 0 {
+		return
+	}
+
+	resp.ImageCollections = l.limitCollectionURLs(resp.ImageCollections)
+	if resp.Groups != nil {
+		groups := slices.Clone(resp.Groups)
+		for i := range groups {
+			groups[i].Results = l.limitCollectionURLs(groups[i].Results)
+		}
+		resp.Groups = groups
+	}
+}
+
+func (l ResponseLimits) limitCollectionURLs(cols []TattooImagesCollection) []TattooImagesCollection {
+	if !slices.ContainsFunc(cols, func(c TattooImagesCollection) bool { return len(c.URLs) > l.MaxURLsPerCollection }) {
+		return cols
+	}
+
+	out := slices.Clone(cols)
+	for i := range out {
+		if len(out[i].URLs) > l.MaxURLsPerCollection {
+			out[i].URLs = out[i].URLs[:l.MaxURLsPerCollection:l.MaxURLsPerCollection]
+			out[i].URLsTruncated = true
+		}
+	}
+
+	return out
+}
+
+// encodeLimited encodes the response into the buffer within the byte limit.
+// The trailing collections are dropped as needed, the most that fit are kept by re-encoding.
+// It returns the response as encoded.
+func encodeLimited(buf *bytes.Buffer, resp Response, maxBytes int, enc ResponseEncoder) (Response, error) {
+	encode := func(r Response) error {
+		buf.Reset()
+		return enc.Encode(buf, r)
+	}
+	if err := encode(resp); err != nil || buf.Len() <= maxBytes {
+		return resp, err
+	}
+
+	// keep is the most collections known to fit, none may.
+	keep, over := 0, len(resp.ImageCollections)
+	for over-keep > 1 {
+		mid := (keep + over) / 2
+		if err := encode(dropResults(resp, mid)); err != nil {
+			return resp, err
+		}
+		if buf.Len() <= maxBytes {
+			keep = mid
+		} else {
+			over = mid
+		}
+	}
+
+	fitted := dropResults(resp, keep)
+	return fitted, encode(fitted)
+}
+
+// dropResults keeps the first collections of the response & what refers to them.
+func dropResults(resp Response, keep int) Response {
+	dropped := resp.ImageCollections[keep:]
+	if len(dropped) == 0 {
+		return resp
+	}
+
+	kept := make(map[string]bool, keep)
+	for _, c := range resp.ImageCollections[:keep] {
+		kept[c.ID] = true
+	}
+	resp.ImageCollections = resp.ImageCollections[:keep:keep]
+	resp.Truncated = true
+	resp.Dropped += len(dropped)
+	resp.HasMore = true
+
+	if resp.Groups != nil {
+		var groups []ResultGroup
+		for _, g := range resp.Groups {
+			g.Results = slices.DeleteFunc(slices.Clone(g.Results), func(c TattooImagesCollection) bool { return !kept[c.ID] })
+			if len(g.Results) > 0 {
+				groups = append(groups, g)
+			}
+		}
+		resp.Groups = groups
+	}
+	if resp.Artists != nil {
+		artists := make(map[string]Artist, len(resp.Artists))
+		for _, c := range resp.ImageCollections {
+			if a, ok := resp.Artists[c.ArtistID]; ok {
+				artists[c.ArtistID] = a
+			}
+		}
+		resp.Artists = artists
+	}
+	if resp.DistancesKM != nil {
+		distances := make(map[string]float64, keep)
+		for id, d := range resp.DistancesKM {
+			if kept[id] {
+				distances[id] = d
+			}
+		}
+		resp.DistancesKM = distances
+	}
+	if resp.Explain != nil {
+		explain := *resp.Explain
+		explain.Hits = slices.DeleteFunc(slices.Clone(explain.Hits), func(h RankedVector) bool { return !kept[h.ID] })
+		resp.Explain = &explain
+	}
+
+	return resp
+}
+
+// fitResponse limits the URLs of the response & drops the results which don't fit the body limit.
+func (e *SearchEngine) fitResponse(resp Response) (Response, error) {
+	limits := e.configuration.ResponseLimits
+	limits.limitURLs(&resp)
+
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	defer releaseBuffer(buf)
+
+	return encodeLimited(buf, resp, limits.MaxBodyBytes, jsonEncoder)
+}
+
+// writeLimited writes the search response within the response limits, encoded once in a pooled buffer by the negotiated encoder.
+func (e *SearchEngine) writeLimited(w http.ResponseWriter, status int, resp Response) {
+	limits := e.configuration.ResponseLimits
+	limits.limitURLs(&resp)
+
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	defer releaseBuffer(buf)
+
+	enc := responseEncoder(w)
+	if _, err := encodeLimited(buf, resp, limits.MaxBodyBytes, enc); err != nil {
+		writeJSON(w, status, resp)
+		return
+	}
+	if enc.canonical {
+		buf.WriteByte('\n')
+	}
+
+	writeBuffer(w, status, buf)
+}
@@ -0,0 +1,105 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response limits", func() {
+	var ranked []string
+
+	// initServer seeds 20 lions ranked by ID, every other one has 50 long URLs.
+	initServer := func(limits searchAPI.ResponseLimits) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		ranked = nil
+		for i := range 20 {
+			id := fmt.Sprintf("L%02d", i)
+			ranked = append(ranked, id)
+			urls := []string{id + ".jpg"}
+			if i%2 == 0 {
+				urls = nil
+				for j := range 50 {
+					urls = append(urls, fmt.Sprintf("https://cdn.example.com/%s/%s/%d.jpg", strings.Repeat("x", 40), id, j))
+				}
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: urls})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": 0.99 - float64(i)*0.01}})).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{ResponseLimits: limits, CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	lions := url.Values{"q": {"lion"}, "limit": {"20"}, "explain": {"true"}}
+
+	It("keeps the whole response within the defaults", func() {
+		se := initServer(searchAPI.ResponseLimits{})
+
+		res := doSearch(se, lions)
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Truncated).To(BeFalse())
+		Expect(res.JSON.ImageCollections[0].URLs).To(HaveLen(50))
+		Expect(res.JSON.ImageCollections[0].URLsTruncated).To(BeFalse())
+	})
+
+	It("truncates the long URL lists", func() {
+		se := initServer(searchAPI.ResponseLimits{MaxURLsPerCollection: 5})
+
+		for range 2 {
+			res := doSearch(se, lions)
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ranked))
+			for i, c := range res.JSON.ImageCollections {
+				if i%2 == 0 {
+					Expect(c.URLs).To(HaveLen(5))
+					Expect(c.URLsTruncated).To(BeTrue())
+				} else {
+					Expect(c.URLs).To(HaveLen(1))
+					Expect(c.URLsTruncated).To(BeFalse())
+				}
+			}
+			Expect(string(res.Body)).To(ContainSubstring(`"urls_truncated":true`))
+		}
+	})
+
+	It("drops the trailing results over the body limit", func() {
+		se := initServer(searchAPI.ResponseLimits{MaxBodyBytes: 20 << 10})
+		for range 2 {
+			res := doSearch(se, lions)
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(len(res.Body)).To(BeNumerically("<=", 20<<10))
+			Expect(res.JSON.Truncated).To(BeTrue())
+			Expect(res.JSON.HasMore).To(BeTrue())
+
+			kept := collectionIDs(res.JSON.ImageCollections)
+			Expect(kept).NotTo(BeEmpty())
+			Expect(kept).To(Equal(ranked[:len(kept)]), "the ranking order is kept")
+			Expect(res.JSON.Dropped).To(Equal(len(ranked) - len(kept)))
+			Expect(res.JSON.Explain.Hits).To(HaveLen(len(kept)))
+		}
+	})
+
+	It("truncates the URLs before dropping results", func() {
+		se := initServer(searchAPI.ResponseLimits{MaxURLsPerCollection: 2, MaxBodyBytes: 20 << 10})
+
+		res := doSearch(se, lions)
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Truncated).To(BeFalse())
+		Expect(res.JSON.Dropped).To(BeZero())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ranked))
+	})
+})
@@ -1,44 +1,229 @@
-package main
+package inkinspot
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/DanyPops/inkinspot/timeoutx"
 )
 
 var (
-	ErrImageStoreEmpty   = errors.New("image store empty")
-	ErrImageStoreTimeout = errors.New("image store timeout")
-	ErrSearchEmptyQuery  = errors.New("search empty query")
+	ErrImageStoreEmpty        = errors.New("image store empty")
+	ErrImageStoreTimeout      = errors.New("image store timeout")
+	ErrCollectionNotFound     = errors.New("collection not found")
+	ErrCollectionExists       = errors.New("collection exists")
+	ErrSearchEmptyQuery       = errors.New("search empty query")
+	ErrQueryTooLong           = errors.New("search query too long")
+	ErrTooManyQueries         = errors.New("search too many queries")
+	ErrInvalidLanguage        = errors.New("search invalid language tag")
+	ErrMalformedQuery         = errors.New("search malformed query")
+	ErrInvalidWeight          = errors.New("search invalid facet weight")
+	ErrInvalidBoost           = errors.New("invalid label boost")
+	ErrInvalidMinScore        = errors.New("search invalid min score")
+	ErrInvalidGrouping        = errors.New("search invalid grouping")
+	ErrInvalidPage            = errors.New("search invalid page")
+	ErrInvalidCursor          = errors.New("search invalid cursor")
+	ErrDiscoverUnsupported    = errors.New("image store can't sample")
+	ErrExportUnsupported      = errors.New("image store can't list")
+	ErrImportUnsupported      = errors.New("stores can't be written")
+	ErrInvalidImport          = errors.New("invalid import")
+	ErrInvalidRecord          = errors.New("invalid import record")
+	ErrIngestBusy             = errors.New("ingestion queue full")
+	ErrMigrationUnsupported   = errors.New("stores can't be migrated")
+	ErrCorruptSnapshot        = errors.New("corrupt snapshot")
+	ErrChaos                  = errors.New("chaos injected fault")
+	ErrChaosNotAllowed        = errors.New("chaos not allowed")
+	ErrInvalidChaos           = errors.New("invalid chaos policy")
+	ErrInvalidServer          = errors.New("invalid server policy")
+	ErrInvalidTLS             = errors.New("invalid tls policy")
+	ErrInvalidDeadline        = errors.New("invalid request deadline")
+	ErrReindexUnsupported     = errors.New("vector store can't be reindexed")
+	ErrReindexRunning         = errors.New("reindex already running")
+	ErrInvalidJob             = errors.New("invalid job")
+	ErrJobNotFound            = errors.New("job not found")
+	ErrJobRunning             = errors.New("job already running")
+	ErrJobsStopped            = errors.New("jobs stopped")
+	ErrQuotaExceeded          = errors.New("quota exceeded")
+	ErrInvalidWindow          = errors.New("invalid usage window")
+	ErrInvalidCatalogFilter   = errors.New("invalid catalog filter")
+	ErrLookupUnsupported      = errors.New("vector store can't look up")
+	ErrVectorNotFound         = errors.New("vector not found")
+	ErrPatchUnsupported       = errors.New("vector store can't be patched")
+	ErrInvalidPatch           = errors.New("invalid vector patch")
+	ErrVersionConflict        = errors.New("version conflict")
+	ErrInvalidVersion         = errors.New("invalid version")
+	ErrArtistNotFound         = errors.New("artist not found")
+	ErrArtistsUnsupported     = errors.New("stores can't resolve artists")
+	ErrInvalidLocation        = errors.New("invalid location")
+	ErrCollectionExpired      = errors.New("collection expired")
+	ErrPurgeUnsupported       = errors.New("stores can't be purged")
+	ErrAuditUnsupported       = errors.New("audit logger can't list")
+	ErrSwapUnsupported        = errors.New("image store can't swap collections")
+	ErrInvalidVector          = errors.New("search invalid vector")
+	ErrIteratorDone           = errors.New("iterator done")
+	ErrIteratorClosed         = errors.New("iterator closed")
+	ErrInvalidShards          = errors.New("invalid image store shards")
+	ErrInvalidConsistency     = errors.New("search invalid consistency token")
+	ErrConsistencyTimeout     = errors.New("search consistency timeout")
+	ErrConsistencyUnsupported = errors.New("stores can't be checked for consistency")
+	ErrInvalidTimeout         = errors.New("search invalid timeout")
+	ErrEmptyQueryLog          = errors.New("query log has no queries")
+	ErrStoreContract          = errors.New("store broke its contract")
+	ErrNoBenchmarkQueries     = errors.New("no benchmark queries")
+	ErrUnknownFacet           = errors.New("unknown facet")
+	ErrSelfCheckFailed        = errors.New("self check failed")
+	ErrInvalidWebhook         = errors.New("invalid webhook")
+	ErrInvalidSignature       = errors.New("invalid webhook signature")
+	ErrWebhookReplayed        = errors.New("webhook replayed")
+	ErrUnmappedFields         = errors.New("unmapped webhook fields")
+	ErrInvalidFilter          = errors.New("search invalid facet filter")
+	ErrFiltersUnsupported     = errors.New("vector store can't filter by labels")
+	ErrInvalidFeedback        = errors.New("invalid feedback")
+	ErrUnservedFeedback       = errors.New("feedback on an unserved hit")
+	ErrInvalidExperiment      = errors.New("invalid experiment")
+	ErrBooleanUnsupported     = errors.New("vector store can't evaluate boolean queries")
+	ErrInvalidScorePolicy     = errors.New("invalid score policy")
 )
 
-// WithTightTimeout returns a child context that expires at the earlier of (now + d) and the parent's deadline.
-func WithTightTimeout(parent context.Context, duration time.Duration) (context.Context, context.CancelFunc) {
-	if parentDeadline, ok := parent.Deadline(); ok {
-		internalDeadline := time.Now().Add(duration)
-		// if the parent deadline expires earlier use it instead.
-		if internalDeadline.After(parentDeadline) {
-			return context.WithCancel(parent)
-		}
-
-		return context.WithDeadline(parent, internalDeadline)
-	}
-
-	return context.WithTimeout(parent, duration)
-}
-
 // TimeoutPolicy holds all the timeout policies for the search engine components
 type TimeoutPolicy struct {
 	ImageStoreTimeout  time.Duration
 	VectorStoreTimeout time.Duration
+	// SearchTimeout bounds a /search request, a caller's deadline header may only tighten it.
+	SearchTimeout time.Duration
+	// SoftTimeout makes every search best effort, the hits fetched before the image store timeout are returned.
+	SoftTimeout bool
+	// ImageStoreChunkSize is the number of IDs fetched at once by the best effort searches.
+	ImageStoreChunkSize int
+	// ResponseReserve is the time of the request kept from the image store for the ranking & the encoding.
+	ResponseReserve time.Duration
+	// ImageStoreFloor is the least budget the image store is called with, the searches left with less fail at once.
+	ImageStoreFloor time.Duration
+	// SearchFloor is the least budget a /search runs with, the callers' deadlines leaving less fail at once.
+	SearchFloor time.Duration
 }
 
 // Configuration holds all the top-level policies for the search engine
 type Configuration struct {
-	TimeoutPolicy TimeoutPolicy
+	TimeoutPolicy       TimeoutPolicy
+	HardeningPolicy     HardeningPolicy
+	QueryPolicy         QueryPolicy
+	RankingPolicy       RankingPolicy
+	FuzzyPolicy         FuzzyPolicy
+	CachePolicy         CachePolicy
+	CacheWarmup         CacheWarmup
+	FreshnessPolicy     FreshnessPolicy
+	AdminPolicy         AdminPolicy
+	ScorePolicy         ScorePolicy
+	PagePolicy          PagePolicy
+	CursorPolicy        CursorPolicy
+	DiscoverPolicy      DiscoverPolicy
+	SnapshotPolicy      SnapshotPolicy
+	ChaosPolicy         ChaosPolicy
+	IngestPolicy        IngestPolicy
+	SheddingPolicy      SheddingPolicy
+	ServerPolicy        ServerPolicy
+	TLSPolicy           TLSPolicy
+	SpeculationPolicy   SpeculationPolicy
+	FallbackPolicy      FallbackPolicy
+	QuotaPolicy         QuotaPolicy
+	AccessLogPolicy     AccessLogPolicy
+	PrivacyPolicy       PrivacyPolicy
+	LocalePolicy        LocalePolicy
+	ExpiryPolicy        ExpiryPolicy
+	AuditPolicy         AuditPolicy
+	IdempotencyPolicy   IdempotencyPolicy
+	UpdatesPolicy       UpdatesPolicy
+	CoveragePolicy      CoveragePolicy
+	PercolationPolicy   PercolationPolicy
+	ConsistencyPolicy   ConsistencyPolicy
+	RankingDiffPolicy   RankingDiffPolicy
+	StatsPolicy         StatsPolicy
+	SelfCheckPolicy     SelfCheckPolicy
+	PublicStatsPolicy   PublicStatsPolicy
+	WebhookPolicy       WebhookPolicy
+	StoreContractPolicy StoreContractPolicy
+	ZeroResultPolicy    ZeroResultPolicy
+	FeatureLogPolicy    FeatureLogPolicy
+	FeedbackPolicy      FeedbackPolicy
+	ResponseLimits      ResponseLimits
+}
+
+// DefaultConfiguration returns a configuration with every policy set to its default.
+func DefaultConfiguration() Configuration {
+	return Configuration{}.withDefaults()
+}
+
+// withDefaults fills the zero valued policies with their defaults.
+func (c Configuration) withDefaults() Configuration {
+	if c.TimeoutPolicy.VectorStoreTimeout <= 0 {
+		c.TimeoutPolicy.VectorStoreTimeout = 100 * time.Millisecond
+	}
+	if c.TimeoutPolicy.ImageStoreTimeout <= 0 {
+		c.TimeoutPolicy.ImageStoreTimeout = 150 * time.Millisecond
+	}
+	if c.TimeoutPolicy.SearchTimeout <= 0 {
+		c.TimeoutPolicy.SearchTimeout = 300 * time.Millisecond
+	}
+	if c.TimeoutPolicy.ImageStoreChunkSize <= 0 {
+		c.TimeoutPolicy.ImageStoreChunkSize = 10
+	}
+	if c.TimeoutPolicy.ResponseReserve <= 0 {
+		c.TimeoutPolicy.ResponseReserve = 20 * time.Millisecond
+	}
+	if c.TimeoutPolicy.ImageStoreFloor <= 0 {
+		c.TimeoutPolicy.ImageStoreFloor = 10 * time.Millisecond
+	}
+	if c.TimeoutPolicy.SearchFloor <= 0 {
+		c.TimeoutPolicy.SearchFloor = 30 * time.Millisecond
+	}
+	c.AdminPolicy = c.AdminPolicy.withDefaults()
+	c.HardeningPolicy = c.HardeningPolicy.withDefaults()
+	c.QueryPolicy = c.QueryPolicy.withDefaults()
+	c.RankingPolicy = c.RankingPolicy.withDefaults()
+	c.FuzzyPolicy = c.FuzzyPolicy.withDefaults()
+	c.CachePolicy = c.CachePolicy.withDefaults()
+	c.CacheWarmup = c.CacheWarmup.withDefaults()
+	c.SpeculationPolicy = c.SpeculationPolicy.withDefaults()
+	c.FallbackPolicy = c.FallbackPolicy.withDefaults()
+	c.AccessLogPolicy = c.AccessLogPolicy.withDefaults()
+	c.PrivacyPolicy = c.PrivacyPolicy.withDefaults()
+	c.ExpiryPolicy = c.ExpiryPolicy.withDefaults()
+	c.AuditPolicy = c.AuditPolicy.withDefaults()
+	c.IdempotencyPolicy = c.IdempotencyPolicy.withDefaults()
+	c.UpdatesPolicy = c.UpdatesPolicy.withDefaults()
+	c.CoveragePolicy = c.CoveragePolicy.withDefaults()
+	c.PercolationPolicy = c.PercolationPolicy.withDefaults()
+	c.ConsistencyPolicy = c.ConsistencyPolicy.withDefaults()
+	c.RankingDiffPolicy = c.RankingDiffPolicy.withDefaults()
+	c.StatsPolicy = c.StatsPolicy.withDefaults()
+	c.SelfCheckPolicy = c.SelfCheckPolicy.withDefaults()
+	c.PublicStatsPolicy = c.PublicStatsPolicy.withDefaults()
+	c.WebhookPolicy = c.WebhookPolicy.withDefaults()
+	c.ZeroResultPolicy = c.ZeroResultPolicy.withDefaults()
+	c.FeatureLogPolicy = c.FeatureLogPolicy.withDefaults()
+	c.FeedbackPolicy = c.FeedbackPolicy.withDefaults()
+	c.FreshnessPolicy = c.FreshnessPolicy.withDefaults()
+	c.ScorePolicy = c.ScorePolicy.withDefaults()
+	c.PagePolicy = c.PagePolicy.withDefaults()
+	c.CursorPolicy = c.CursorPolicy.withDefaults()
+	c.DiscoverPolicy = c.DiscoverPolicy.withDefaults()
+	c.SnapshotPolicy = c.SnapshotPolicy.withDefaults()
+	c.IngestPolicy = c.IngestPolicy.withDefaults()
+	c.SheddingPolicy = c.SheddingPolicy.withDefaults()
+	c.ServerPolicy = c.ServerPolicy.withDefaults()
+	c.ResponseLimits = c.ResponseLimits.withDefaults()
+
+	return c
 }
 
 // LabelSet is a set of string & value pairs.
@@ -51,21 +236,37 @@ type LabelSet map[string]float64
 // The tattoo styles (black & white, realistic, etc).
 // The tattoo subjects (lion, sword, etc).
 // The tattoo anatomical area (arm, chest, etc)
+// CreatedAt is when the tattoo was added, zero when unknown.
+// Version changes on every write of the vector, it's set by the stores which track it.
 type TattooImagesVector struct {
-	ID      string
-	Style   LabelSet
-	Subject LabelSet
-	Area    LabelSet
+	ID        string
+	Style     LabelSet
+	Subject   LabelSet
+	Area      LabelSet
+	CreatedAt time.Time
+	Version   uint64 `json:",omitempty"`
 }
 
 // TattooImagesCollection URLs are links to the photos of the tattoo.
+// Hidden collections are kept but never served.
+// ArtistID is the artist of the tattoo & Location where it was made, empty when unknown.
+// Collections past their ExpiresAt aren't served anymore & get purged.
+// Version is bumped by the image stores on every write, zero when they keep none.
 type TattooImagesCollection struct {
-	ID   string
-	URLs []string
+	ID        string
+	URLs      []string
+	ArtistID  string     `json:",omitempty"`
+	Location  *Location  `json:",omitempty"`
+	ExpiresAt *time.Time `json:",omitempty"`
+	Hidden    bool       `json:",omitempty"`
+	Version   uint64     `json:",omitempty"`
+	// URLsTruncated marks the collections of a response whose URLs were cut by the response limits, it isn't stored.
+	URLsTruncated bool `json:"urls_truncated,omitempty"`
 }
 
 // ImageStore defines the contract.
 // Of the service which stores the tattoo images.
+// GetTattoosByID returns a MissingIDsError alongside the found collections when some IDs are unknown.
 type ImageStore interface {
 	GetTattoosByID(ctx context.Context, ids []string) ([]TattooImagesCollection, error)
 }
@@ -77,109 +278,580 @@ type VectorStore interface {
 	GetIDsByQuery(ctx context.Context, query string) ([]string, error)
 }
 
+// VectorLookup is implemented by the vector stores.
+// Which can return the stored vectors by their IDs.
+// The engine ranks the matches itself when it's available.
+type VectorLookup interface {
+	GetVectorsByID(ctx context.Context, ids []string) ([]TattooImagesVector, error)
+}
+
 // SearchEngine peforms searching for tattoos.
 type SearchEngine struct {
 	configuration Configuration
-	imageStore    ImageStore
-	vectorStore   VectorStore
+	labelAnalyzer Analyzer
+	queryLabels   queryLabeler
+	ranker        *Ranker
+	cache         *resultCache
+	collections   *collectionCache
+	speculation   *speculation
+	lastGood      *lastKnownGood
+	reindexing    *reindexJob
+	jobs          *jobRunner
+	ingest        *ingestPool
+	shedder       *loadShedder
+	usage         UsageStore
+	artists       ArtistStore
+	audit         AuditLogger
+	idempotency   IdempotencyStore
+	savedSearches SavedSearchSource
+	notifier      Notifier
+	alertHook     AlertHook
+	featureLogger FeatureLogger
+	feedback      FeedbackStore
+	embeddings    *EmbeddingCache
+	encoders      []ResponseEncoder
+	// trustStores leaves the results of the stores unvalidated.
+	trustStores bool
+	percolation *percolator
+	consistency *consistencyChecks
+	stats       *catalogStats
+	selfCheck   *selfCheck
+	queryCounts *queryCounts
+	webhooks    *webhookDeliveries
+	zeroResults *zeroResults
+	// features queues the records of the feature logger, nil without one.
+	features    *featureQueue
+	served      *servedRequests
+	experiments *experimentCounters
+	storeErrors storeErrorCounts
+	// auditFailures counts the audit entries which couldn't be recorded.
+	auditFailures atomic.Int64
+	// unrequestedCollections counts the collections the image store returned without being asked for.
+	unrequestedCollections atomic.Int64
+	// writeVersion is the version of the last consistency token issued.
+	writeVersion atomic.Int64
+	// feedbackCounted counts the feedback counted since the start, the cursors ranked by the popularity expire with it.
+	feedbackCounted atomic.Uint64
+	imageStore      ImageStore
+	vectorStore     VectorStore
+	clock           Clock
+	// chaos is injected into the store calls, nil unless enabled.
+	chaos        *chaos
+	chaosRefused string
+
+	settingsMu sync.Mutex
+	settings   atomic.Pointer[runtimeSettings]
 }
 
 // NewSearchEngine creates a new search engine instance.
-func NewSearchEngine(cfg Configuration, ts ImageStore, vs VectorStore) *SearchEngine {
-	return &SearchEngine{
+// Zero valued policies in the configuration are replaced by their defaults.
+func NewSearchEngine(cfg Configuration, ts ImageStore, vs VectorStore, opts ...SearchEngineOption) *SearchEngine {
+	cfg = cfg.withDefaults()
+	se := &SearchEngine{
 		configuration: cfg,
+		labelAnalyzer: cfg.LabelAnalyzer(),
 		imageStore:    ts,
 		vectorStore:   vs,
+		clock:         timeoutx.RealClock{},
+		usage:         NewMemoryUsageStore(),
+		audit:         NewMemoryAuditLog(cfg.AuditPolicy.Size),
+		idempotency:   NewMemoryIdempotencyStore(),
+		encoders:      defaultEncoders(),
+		alertHook:     LogAlertHook{},
+		feedback:      NewMemoryFeedbackStore(cfg.FeedbackPolicy.Decay),
+	}
+	for _, opt := range opts {
+		opt(se)
+	}
+	if !se.trustStores {
+		se.imageStore = NewValidatingImageStore(se.imageStore, ImageStoreName)
+		se.vectorStore = NewValidatingVectorStore(se.vectorStore, VectorStoreName)
+	}
+	se.enableChaos(cfg.ChaosPolicy)
+
+	se.queryLabels = newQueryLabeler(cfg.PrivacyPolicy, se.normalizeQuery)
+	if se.ranker == nil {
+		se.ranker = &Ranker{
+			Policy:    cfg.RankingPolicy,
+			Fuzzy:     cfg.FuzzyPolicy,
+			Freshness: cfg.FreshnessPolicy,
+			Analyzer:  se.labelAnalyzer,
+		}
+	}
+	if se.ranker.Clock == nil {
+		se.ranker.Clock = se.clock
 	}
+	se.cache = newResultCache(cfg.CachePolicy, se.clock)
+	se.collections = newCollectionCache(cfg.CachePolicy, se.clock)
+	se.speculation = newSpeculation(cfg.SpeculationPolicy)
+	se.lastGood = newLastKnownGood(cfg.FallbackPolicy, se.clock)
+	se.reindexing = &reindexJob{}
+	se.jobs = newJobRunner(se.clock)
+	se.ingest = newIngestPool(cfg.IngestPolicy, se.clock)
+	se.percolation = newPercolator(cfg.PercolationPolicy)
+	se.consistency = newConsistencyChecks(cfg.ConsistencyPolicy, se.clock)
+	se.shedder = &loadShedder{policy: cfg.SheddingPolicy}
+	se.stats = &catalogStats{}
+	se.selfCheck = newSelfCheck(cfg.SelfCheckPolicy)
+	se.queryCounts = &queryCounts{}
+	se.webhooks = &webhookDeliveries{seen: make(map[string]time.Time)}
+	se.zeroResults = &zeroResults{}
+	se.served = &servedRequests{requests: make(map[string]*servedRequest)}
+	se.experiments = &experimentCounters{counters: make(map[[2]string]*ExperimentMetrics)}
+	if se.featureLogger != nil {
+		se.features = newFeatureQueue(cfg.FeatureLogPolicy, se.featureLogger)
+	}
+	se.settings.Store(&runtimeSettings{})
+
+	return se
 }
 
 // Search returns a list of tattoo images by their query match rating.
 // And all the images which are related to it.
 func (e *SearchEngine) Search(ctx context.Context, query string) ([]TattooImagesCollection, error) {
-	query = normalizeQuery(query)
-	if query == "" {
-		return nil, ErrSearchEmptyQuery
-	}
-
-	vqCtx, vqCancel := WithTightTimeout(ctx, e.configuration.TimeoutPolicy.VectorStoreTimeout)
-	defer vqCancel()
-
-	ids, err := e.vectorStore.GetIDsByQuery(vqCtx, query)
+	res, err := e.MultiSearch(ctx, []string{query}, SearchOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	isCtx, isCancel := WithTightTimeout(ctx, e.configuration.TimeoutPolicy.ImageStoreTimeout)
-	defer isCancel()
-
-	imgs, err := e.imageStore.GetTattoosByID(isCtx, ids)
-	if err != nil {
-		return nil, err
-	}
-
-	return imgs, nil
+	return res.Collections(), nil
 }
 
-func normalizeQuery(s string) string {
-	return strings.ToLower(strings.TrimSpace(s))
+// APIError is the machine readable error body of a failed request.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields are the fields a partner's payload couldn't be mapped to, see MappingError.
+	Fields []UnmappedField `json:"fields,omitempty"`
 }
 
 type Response struct {
 	ImageCollections []TattooImagesCollection `json:"image_collections"`
+	Queries          []string                 `json:"queries,omitempty"`
+	Groups           []ResultGroup            `json:"groups,omitempty"`
+	Total            int                      `json:"total"`
+	HasMore          bool                     `json:"has_more"`
+	NextCursor       string                   `json:"next_cursor,omitempty"`
+	Artists          map[string]Artist        `json:"artists,omitempty"`
+	DistancesKM      map[string]float64       `json:"distances_km,omitempty"`
+	Stale            bool                     `json:"stale,omitempty"`
+	Partial          bool                     `json:"partial,omitempty"`
+	Timeout          bool                     `json:"timeout,omitempty"`
+	// Truncated is set when the trailing results were dropped to fit the body limit, Dropped counts them.
+	Truncated bool      `json:"truncated,omitempty"`
+	Dropped   int       `json:"dropped,omitempty"`
+	TookMS    float64   `json:"took_ms"`
+	Meta      *Meta     `json:"meta,omitempty"`
+	Explain   *Explain  `json:"explain,omitempty"`
+	Error     *APIError `json:"error,omitempty"`
+}
+
+// Meta describes what a search did & how long its stages took.
+// It is only included when requested with debug_meta=true or X-Debug: 1.
+type Meta struct {
+	Queries       []ParsedQuery `json:"queries"`
+	VectorStoreMS float64       `json:"vector_store_ms"`
+	ImageStoreMS  float64       `json:"image_store_ms"`
+	TotalMS       float64       `json:"total_ms"`
+	// VectorStoreBudgetMS & ImageStoreBudgetMS are the timeouts planned for the store calls.
+	VectorStoreBudgetMS float64 `json:"vector_store_budget_ms,omitempty"`
+	ImageStoreBudgetMS  float64 `json:"image_store_budget_ms,omitempty"`
+	CacheHit            bool    `json:"cache_hit"`
+	// Cache is "fresh" or "stale" when the result came from the cache.
+	Cache       string `json:"cache,omitempty"`
+	ResultCount int    `json:"result_count"`
+	// StaleAgeMS is the age of the last known good result served while the vector store fails.
+	StaleAgeMS float64 `json:"stale_age_ms,omitempty"`
+	// Experiment & Variant are the assignment the search was ranked by, empty out of the experiments.
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"`
+}
+
+// cacheState describes whether the result came fresh or stale from the cache, empty when it didn't.
+func cacheState(res *SearchResult) string {
+	switch {
+	case !res.CacheHit:
+		return ""
+	case res.CacheStale:
+		return "stale"
+	default:
+		return "fresh"
+	}
+}
+
+// milliseconds returns the duration in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Explain describes how the server interpreted & ranked a search.
+// It is only included when requested with explain=true.
+type Explain struct {
+	Queries []ParsedQuery  `json:"queries"`
+	Weights RankingPolicy  `json:"weights"`
+	Hits    []RankedVector `json:"hits"`
 }
 
+// responseBuffers pools the buffers the responses are encoded into.
+var responseBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBuffer is the capacity above which a response buffer isn't pooled again.
+const maxPooledBuffer = 1 << 20
+
+// writeJSON writes the payload in the canonical JSON of the responses, see marshalCanonical.
+// The payload is encoded by the encoder negotiated with the client.
 func writeJSON(w http.ResponseWriter, status int, payload any) {
-	w.Header().Set("Content-Type", "application/json")
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	defer releaseBuffer(buf)
+
+	enc := responseEncoder(w)
+	buf.Reset()
+	if err := enc.Encode(buf, payload); err != nil {
+		slog.Error("encoding the response failed", "error", err)
+		status = http.StatusInternalServerError
+		buf.Reset()
+		_ = enc.Encode(buf, Response{Error: &APIError{Code: "internal_error", Message: "encoding the response failed"}})
+	}
+	if enc.canonical {
+		buf.WriteByte('\n')
+	}
+
+	writeBuffer(w, status, buf)
+}
+
+// writeBody writes a cached search response with its took_ms, Not Modified when the client has it.
+func writeBody(w http.ResponseWriter, r *http.Request, body *cachedBody, tookMS float64) {
+	w.Header().Set("ETag", body.etag)
+	if body.notModified(r.Header.Get("If-None-Match")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	defer releaseBuffer(buf)
+
+	buf.Reset()
+	buf.Write(body.head)
+	_ = encodeScalar(buf, tookMS)
+	buf.Write(body.tail)
+
+	writeBuffer(w, http.StatusOK, buf)
+}
+
+// writeBuffer writes the encoded response, typed by the encoder negotiated with the client.
+// The write is bounded by the write budget of the response, see withWriteDeadline.
+func writeBuffer(w http.ResponseWriter, status int, buf *bytes.Buffer) {
+	w.Header().Set("Content-Type", responseEncoder(w).MediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
+	writeWithDeadline(w, buf)
 }
 
-func SearchReponseErrorHelper(w http.ResponseWriter, r Response, responseCode uint) {
-	w.Header().Set("Allow", http.MethodGet)
-	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	_ = json.NewEncoder(w).Encode(Response{ImageCollections: nil})
-	return
+// releaseBuffer returns the buffer to the pool, unless it grew too large to keep.
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		buf.Reset()
+		responseBuffers.Put(buf)
+	}
 }
 
-func NewHandler(se *SearchEngine) http.Handler {
-	mux := http.NewServeMux()
+// bodyCacheKey keys the response of the search request, empty when it isn't cached.
+// Responses with the metadata carry their timings and are never cached.
+// Nor are they when the features are logged, the cached responses carry no hits to log.
+func (e *SearchEngine) bodyCacheKey(r *http.Request, params url.Values, opts SearchOptions, groupLimit int) string {
+	if !e.cache.bodiesEnabled() || e.features != nil || opts.Consistency != "" || params.Get("debug_meta") == "true" || r.Header.Get("X-Debug") == "1" {
+		return ""
+	}
 
-	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
-		// search is GET method only
-		if r.Method != http.MethodGet {
-			w.Header().Set("Allow", http.MethodGet)
-			writeJSON(w, http.StatusMethodNotAllowed, Response{ImageCollections: nil})
+	plan, err := e.planSearch(params["q"], opts)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s|group_by=%t,%q,%d|explain=%t", plan.key, params.Has("group_by"), params.Get("group_by"), groupLimit, params.Get("explain") == "true")
+}
+
+// writeError writes an empty response carrying the error code & message.
+// The message is translated into the language the client accepts, when the catalog has it.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	if lw, ok := unwrapWriter[*localizedWriter](w); ok {
+		message = lw.localize(code, message)
+	}
+	writeJSON(w, status, Response{ImageCollections: nil, Error: &APIError{Code: code, Message: message}})
+}
+
+// writeSearchError answers the error of a search.
+func writeSearchError(w http.ResponseWriter, err error) {
+	var storeErr *StoreError
+	switch {
+	case errors.Is(err, ErrSearchEmptyQuery):
+		writeError(w, http.StatusBadRequest, "empty_query", "query must not be empty")
+	case errors.Is(err, ErrQueryTooLong):
+		writeError(w, http.StatusBadRequest, "query_too_long", err.Error())
+	case errors.Is(err, ErrTooManyQueries):
+		writeError(w, http.StatusBadRequest, "too_many_queries", err.Error())
+	case errors.Is(err, ErrInvalidLanguage):
+		writeError(w, http.StatusBadRequest, "invalid_language", err.Error())
+	case errors.Is(err, ErrMalformedQuery):
+		writeError(w, http.StatusBadRequest, "malformed_query", err.Error())
+	case errors.Is(err, ErrInvalidWeight):
+		writeError(w, http.StatusBadRequest, "invalid_weight", err.Error())
+	case errors.Is(err, ErrInvalidMinScore):
+		writeError(w, http.StatusBadRequest, "invalid_min_score", err.Error())
+	case errors.Is(err, ErrInvalidPage):
+		writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+	case errors.Is(err, ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+	case errors.Is(err, ErrInvalidLocation):
+		writeError(w, http.StatusBadRequest, "invalid_location", err.Error())
+	case errors.Is(err, ErrInvalidVector):
+		writeError(w, http.StatusBadRequest, "invalid_vector", err.Error())
+	case errors.Is(err, ErrLookupUnsupported):
+		writeError(w, http.StatusNotImplemented, "lookup_unsupported", err.Error())
+	case errors.Is(err, ErrInvalidConsistency):
+		writeError(w, http.StatusBadRequest, "invalid_consistency_token", err.Error())
+	case errors.Is(err, ErrConsistencyTimeout):
+		writeError(w, http.StatusGatewayTimeout, "consistency_timeout", "the stores didn't reflect the write in time")
+	case errors.Is(err, ErrArtistNotFound):
+		writeError(w, http.StatusNotFound, "artist_not_found", err.Error())
+	case errors.Is(err, ErrArtistsUnsupported):
+		writeError(w, http.StatusNotImplemented, "artists_unsupported", err.Error())
+	case errors.Is(err, ErrInvalidFilter):
+		writeError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+	case errors.Is(err, ErrFiltersUnsupported):
+		writeError(w, http.StatusNotImplemented, "filters_unsupported", err.Error())
+	case errors.Is(err, ErrBooleanUnsupported):
+		writeError(w, http.StatusNotImplemented, "boolean_unsupported", err.Error())
+	case errors.Is(err, ErrImageStoreTimeout):
+		writeError(w, http.StatusGatewayTimeout, "image_store_timeout", "image store timed out")
+	case errors.Is(err, ErrImageStoreEmpty):
+		writeError(w, http.StatusInternalServerError, "image_store_empty", "image store has no images for the matches")
+	case errors.As(err, &storeErr):
+		writeError(w, http.StatusInternalServerError, storeErr.code(), storeErr.Store+" store "+storeErr.Op+" failed")
+	default:
+		writeError(w, http.StatusInternalServerError, "internal_error", "search failed")
+	}
+}
+
+// handleSearch searches the q parameters, with the page, weights & filters of the query parameters.
+// The POSTs carry them in a JSON body instead.
+// The admin searches may override the store timeouts & always carry the debug meta, they're never cached.
+func handleSearch(se *SearchEngine, admin bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the POSTs carry the parameters in a JSON body.
+		params, ok := searchParams(w, r)
+		if !ok {
 			return
 		}
 
-		ctx := r.Context()
+		start := se.clock.Now()
+		limitBudget := se.configuration.TimeoutPolicy.SearchTimeout
+		var timeouts *TimeoutPolicy
+		if admin {
+			var err error
+			if timeouts, err = parseStoreTimeouts(params, se.configuration.AdminPolicy.MaxStoreTimeout); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_timeout", err.Error())
+				return
+			}
+			// the request lasts as long as the overridden store calls.
+			if timeouts != nil {
+				overridden := withStoreTimeouts(r.Context(), *timeouts)
+				limitBudget = max(limitBudget, se.vectorStoreTimeout(overridden)+se.imageStoreTimeout(overridden))
+			}
+		}
+		budget, err := searchBudget(r, limitBudget)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_deadline", err.Error())
+			return
+		}
 
-		var cancelCtx context.CancelFunc
-		ctx, cancelCtx = context.WithTimeout(ctx, 300*time.Millisecond)
+		ctx, cancelCtx := se.withTightTimeout(r.Context(), budget, timeoutx.WithMinimum(se.configuration.TimeoutPolicy.SearchFloor))
 		defer cancelCtx()
+		if errors.Is(context.Cause(ctx), timeoutx.ErrBelowMinimum) {
+			writeError(w, http.StatusGatewayTimeout, "search_timeout", "the deadline leaves no time for the search")
+			return
+		}
 
-		q := normalizeQuery(r.URL.Query().Get("q"))
+		weights, err := parseWeightOverrides(params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_weight", err.Error())
+			return
+		}
 
-		imgColl, err := se.Search(ctx, q)
+		groupLimit, err := parseGroupLimit(params.Get("group_limit"))
 		if err != nil {
-			switch {
-			case errors.Is(err, ErrSearchEmptyQuery):
-				writeJSON(w, http.StatusBadRequest, Response{ImageCollections: nil})
-				return
-			case errors.Is(err, ErrImageStoreTimeout):
-				writeJSON(w, http.StatusGatewayTimeout, Response{ImageCollections: nil})
+			writeError(w, http.StatusBadRequest, "invalid_grouping", err.Error())
+			return
+		}
+
+		offset, limit, err := parsePage(params.Get("offset"), params.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_page", err.Error())
+			return
+		}
+
+		near, radiusKM, err := parseNear(params.Get("near"), params.Get("radius_km"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_location", err.Error())
+			return
+		}
+
+		opts := SearchOptions{
+			Lang:     params.Get("lang"),
+			Weights:  weights,
+			Offset:   offset,
+			Limit:    limit,
+			Cursor:   params.Get("cursor"),
+			Artist:   params.Get("artist"),
+			Filters:  parseFacetFilters(params),
+			Near:     near,
+			RadiusKM: radiusKM,
+			// the token of a write makes the search wait for it & bypass the caches.
+			Consistency: r.Header.Get(ConsistencyTokenHeader),
+			Timeouts:    timeouts,
+		}
+		// the admins search out of the experiments.
+		if !admin {
+			opts.Experiment = se.AssignExperiment(clientID(r))
+			tagExperiment(r.Context(), opts.Experiment)
+		}
+		if raw := params.Get("min_score"); raw != "" {
+			if opts.MinScore, err = strconv.ParseFloat(raw, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_min_score", "min_score must be a number")
 				return
-			case errors.Is(err, ErrImageStoreEmpty):
-				writeJSON(w, http.StatusInternalServerError, Response{ImageCollections: nil})
+			}
+		}
+		if raw := params.Get("best_effort"); raw != "" {
+			if opts.BestEffort, err = strconv.ParseBool(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_best_effort", "best_effort must be a boolean")
 				return
-			default:
-				writeJSON(w, http.StatusInternalServerError, Response{ImageCollections: nil})
+			}
+		}
+
+		gen := se.cache.generation()
+		bodyKey := ""
+		// the cached bodies are canonical JSON.
+		if !admin && responseEncoder(w).canonical {
+			bodyKey = se.bodyCacheKey(r, params, opts, groupLimit)
+		}
+		if body, ok := se.cache.getBody(bodyKey); ok && bodyKey != "" {
+			se.recordQueries(params["q"])
+			se.recordSearch(body.empty)
+			se.recordExperiment(opts.Experiment, body.empty)
+			setFeedbackID(w, se.serveFeedback(body.ids, opts.Experiment))
+			writeBody(w, r, body, milliseconds(se.clock.Now().Sub(start)))
+			return
+		}
+
+		res, err := se.MultiSearch(ctx, params["q"], opts)
+		if err != nil {
+			writeSearchError(w, err)
+			return
+		}
+		se.recordQueries(params["q"])
+		se.recordSearch(res.Total == 0)
+		se.recordExperiment(opts.Experiment, res.Total == 0)
+		if !admin {
+			id := requestID(w, r)
+			se.logFeatures(id, res, opts.Offset)
+			setFeedbackID(w, se.serveFeedback(topIDs(res), opts.Experiment))
+		}
+
+		resp := Response{
+			ImageCollections: res.Collections(),
+			Queries:          res.QueryTexts(),
+			Total:            res.Total,
+			HasMore:          res.HasMore,
+			NextCursor:       res.NextCursor,
+			Stale:            res.Stale,
+			Partial:          res.Partial,
+			Timeout:          res.TimedOut,
+		}
+		resp.Artists = se.Artists(ctx, resp.ImageCollections)
+		if opts.Near != nil {
+			resp.DistancesKM = res.Distances()
+		}
+		if params.Has("group_by") {
+			if resp.Groups, err = res.Groups(params.Get("group_by"), groupLimit); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_grouping", err.Error())
 				return
 			}
 		}
+		if params.Get("explain") == "true" {
+			resp.Explain = &Explain{Queries: res.Queries, Weights: res.Ranking, Hits: res.Rankings()}
+		}
+		if admin || params.Get("debug_meta") == "true" || r.Header.Get("X-Debug") == "1" {
+			resp.Meta = &Meta{
+				Queries:             res.Queries,
+				VectorStoreMS:       milliseconds(res.Timings.VectorStore),
+				ImageStoreMS:        milliseconds(res.Timings.ImageStore),
+				TotalMS:             milliseconds(res.Timings.Total),
+				VectorStoreBudgetMS: milliseconds(res.Timings.VectorStoreBudget),
+				ImageStoreBudgetMS:  milliseconds(res.Timings.ImageStoreBudget),
+				CacheHit:            res.CacheHit,
+				Cache:               cacheState(res),
+				ResultCount:         len(res.Hits),
+				StaleAgeMS:          milliseconds(res.StaleAge),
+				Experiment:          res.Experiment.Experiment,
+				Variant:             res.Experiment.Variant,
+			}
+		}
+		resp.TookMS = milliseconds(se.clock.Now().Sub(start))
+
+		// the stale results are being refreshed or the vector store fails, their responses aren't cached.
+		if res.Stale {
+			status := http.StatusOK
+			if se.configuration.FallbackPolicy.Unavailable {
+				status = http.StatusServiceUnavailable
+			}
+			se.writeLimited(w, status, resp)
+			return
+		}
+		if bodyKey != "" && !res.CacheStale && !res.Partial {
+			if fitted, err := se.fitResponse(resp); err == nil {
+				if body, err := newCachedBody(fitted); err == nil {
+					se.cache.putBody(bodyKey, gen, body, se.resultTokens(res))
+					writeBody(w, r, body, fitted.TookMS)
+					return
+				}
+			}
+		}
+		se.writeLimited(w, http.StatusOK, resp)
+	})
+}
 
-		writeJSON(w, http.StatusOK, Response{ImageCollections: imgColl})
+// NewHandler serves the engine: the search, the collection & the admin routes, behind the middlewares of its policies.
+func NewHandler(se *SearchEngine) http.Handler {
+	mux := http.NewServeMux()
+
+	// the methods are checked first, the requests they reject aren't shed nor counted.
+	mux.Handle("/search", methods(withShedding(se.shedder, withQuota(se, UsageSearch, handleSearch(se, false))), http.MethodGet, http.MethodPost))
+
+	mux.Handle("/discover", methods(withShedding(se.shedder, handleDiscover(se)), http.MethodGet))
+
+	// the long polls wait most of their time, they aren't shed.
+	mux.Handle("/search/updates", methods(withQuota(se, UsageSearch, handleSearchUpdates(se)), http.MethodGet))
+	mux.Handle("/search/by-vector", methods(withShedding(se.shedder, withQuota(se, UsageSearch, handleSearchByVector(se))), http.MethodPost))
+	// the admin routes add their methods to the collection & vector routes.
+	collection := methods(withShedding(se.shedder, handleCollection(se)), http.MethodGet)
+	vector := methods(withShedding(se.shedder, handleVector(se, false)), http.MethodGet)
+	mux.Handle("/tattoos/{id}", collection)
+	mux.Handle("/tattoos/{id}/vector", vector)
+	mux.Handle("/artists/{id}/tattoos", methods(withShedding(se.shedder, handleArtistCollections(se)), http.MethodGet))
+
+	// the partners are authenticated by the signatures of their deliveries, not the admin token.
+	mux.Handle("/ingest/webhook", methods(handleWebhook(se), http.MethodPost))
+	mux.Handle("/feedback", methods(withShedding(se.shedder, handleFeedback(se)), http.MethodPost))
+	mux.Handle("/stats/public", methods(withShedding(se.shedder, handlePublicStats(se)), http.MethodGet))
+	// the probes aren't shed, a loaded server is still ready.
+	mux.Handle("/readyz", methods(handleReadiness(se), http.MethodGet))
+
+	// the unknown paths get the JSON error body of the API too.
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
 	})
 
-	return mux
+	registerAdmin(mux, se, collection, vector)
+
+	return withWriteDeadline(se, withPrincipal(se, withAccessLog(se, withLocale(newMessageCatalog(se.configuration.LocalePolicy), withNegotiation(se.encoders, withHardening(se.configuration.HardeningPolicy, mux))))))
 }
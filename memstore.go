@@ -0,0 +1,694 @@
+package inkinspot
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryImageStore keeps the tattoo image collections in memory.
+type MemoryImageStore struct {
+	mu          sync.RWMutex
+	collections map[string]TattooImagesCollection
+	// ids are the collection IDs in lexical order.
+	ids []string
+}
+
+// NewMemoryImageStore creates an empty in-memory image store.
+func NewMemoryImageStore() *MemoryImageStore {
+	return &MemoryImageStore{collections: make(map[string]TattooImagesCollection)}
+}
+
+// AddCollection stores the collection, replacing any with the same ID.
+// The stored collection is at the version after the replaced one's.
+func (s *MemoryImageStore) AddCollection(ctx context.Context, c TattooImagesCollection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, found := slices.BinarySearch(s.ids, c.ID); !found {
+		s.ids = slices.Insert(s.ids, i, c.ID)
+	}
+	c.Version = s.collections[c.ID].Version + 1
+	s.collections[c.ID] = c
+
+	return nil
+}
+
+// HiddenIDs returns the IDs of the collections hidden or expired at the time, in the order of the IDs.
+func (s *MemoryImageStore) HiddenIDs(ctx context.Context, ids []string, at time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hidden []string
+	for _, id := range ids {
+		if c, ok := s.collections[id]; ok && (c.Hidden || c.expired(at)) {
+			hidden = append(hidden, id)
+		}
+	}
+
+	return hidden, nil
+}
+
+// WaitForVersion returns at once, the writes are visible when they return.
+func (s *MemoryImageStore) WaitForVersion(ctx context.Context, token ConsistencyToken) error {
+	return ctx.Err()
+}
+
+// SwapCollection replaces the collection of the same ID while it's still at the version, ErrVersionConflict otherwise.
+func (s *MemoryImageStore) SwapCollection(ctx context.Context, c TattooImagesCollection, version uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.collections[c.ID]
+	if !ok || current.Version != version {
+		return fmt.Errorf("%w: %s is not at version %d", ErrVersionConflict, c.ID, version)
+	}
+	c.Version = version + 1
+	s.collections[c.ID] = c
+
+	return nil
+}
+
+// DeleteCollectionAt removes the collection of the ID while it's still at the version, ErrVersionConflict otherwise.
+func (s *MemoryImageStore) DeleteCollectionAt(ctx context.Context, id string, version uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.collections[id]
+	if !ok || current.Version != version {
+		return fmt.Errorf("%w: %s is not at version %d", ErrVersionConflict, id, version)
+	}
+	if i, found := slices.BinarySearch(s.ids, id); found {
+		s.ids = slices.Delete(s.ids, i, i+1)
+	}
+	delete(s.collections, id)
+
+	return nil
+}
+
+// DeleteCollection removes the collection of the ID, unknown IDs are ignored.
+func (s *MemoryImageStore) DeleteCollection(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, found := slices.BinarySearch(s.ids, id); found {
+		s.ids = slices.Delete(s.ids, i, i+1)
+	}
+	delete(s.collections, id)
+
+	return nil
+}
+
+// SampleTattoos returns a uniform random sample of up to n visible collections, unexpired at the time.
+// It's drawn by reservoir sampling, the sample is reproducible with WithSampleSeed.
+func (s *MemoryImageStore) SampleTattoos(ctx context.Context, n int, at time.Time) ([]TattooImagesCollection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r := sampleRand(ctx)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sample := make([]TattooImagesCollection, 0, n)
+	seen := 0
+	for _, id := range s.ids {
+		c := s.collections[id]
+		if c.Hidden || c.expired(at) {
+			continue
+		}
+
+		seen++
+		if len(sample) < n {
+			sample = append(sample, c)
+		} else if j := r.IntN(seen); j < n {
+			sample[j] = c
+		}
+	}
+
+	r.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+
+	return sample, nil
+}
+
+// GetTattoosByID returns the known collections in the order of the IDs.
+// Unknown IDs are reported by a MissingIDsError, repeated IDs are returned once.
+func (s *MemoryImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]TattooImagesCollection, 0, len(ids))
+	var missing []string
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if c, ok := s.collections[id]; ok {
+			out = append(out, c)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return out, &MissingIDsError{IDs: missing}
+	}
+
+	return out, nil
+}
+
+// ListCollections returns up to limit collections with an ID after the cursor.
+func (s *MemoryImageStore) ListCollections(ctx context.Context, cursor string, limit int) ([]TattooImagesCollection, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start, found := slices.BinarySearch(s.ids, cursor)
+	if found {
+		start++
+	}
+	end := min(start+limit, len(s.ids))
+
+	page := make([]TattooImagesCollection, 0, end-start)
+	for _, id := range s.ids[start:end] {
+		page = append(page, s.collections[id])
+	}
+
+	next := ""
+	if end < len(s.ids) && len(page) > 0 {
+		next = page[len(page)-1].ID
+	}
+
+	return page, next, nil
+}
+
+// memoryIteratorPageSize is the number of collections an iterator of the memory store copies at once.
+const memoryIteratorPageSize = 256
+
+// IterateCollections streams the collections ordered by ID, a page at a time.
+// The collections added meanwhile show up when they sort after the last page.
+func (s *MemoryImageStore) IterateCollections(ctx context.Context) (CollectionIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewListingIterator(s, memoryIteratorPageSize), nil
+}
+
+// CollectionIDsByArtist returns the IDs of the collections of the artist, ordered by ID.
+func (s *MemoryImageStore) CollectionIDsByArtist(ctx context.Context, artistID string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for _, id := range s.ids {
+		if s.collections[id].ArtistID == artistID {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Ping answers at once, the collections are in memory.
+func (s *MemoryImageStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Count returns the number of collections.
+func (s *MemoryImageStore) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.collections), nil
+}
+
+// MemoryVectorStore keeps the tattoo vectors in memory.
+// Queries are matched through an inverted index of the labels by their first stem.
+type MemoryVectorStore struct {
+	analyzer Analyzer
+
+	mu         sync.RWMutex
+	entries    map[string]memoryVector
+	vocabulary *Vocabulary
+	// postings are the labels of the vectors by their first stem, then by vector ID.
+	postings map[string]map[string][]analyzedLabel
+	// written are the IDs written while the index is rebuilt, nil otherwise.
+	written map[string]bool
+}
+
+// memoryVector is a stored vector & its analyzed labels.
+// The vector keeps the original labels for display.
+type memoryVector struct {
+	vector TattooImagesVector
+	labels []analyzedLabel
+}
+
+// analyzedLabel is a label of a facet reduced to the stems it's matched by.
+type analyzedLabel struct {
+	facet     string
+	stems     []string
+	proximity float64
+}
+
+// MemoryVectorStoreOption configures a MemoryVectorStore.
+type MemoryVectorStoreOption func(*MemoryVectorStore)
+
+// WithLabelAnalyzer sets the analyzer applied to the labels at ingest.
+// It must match the engine's so queries & labels agree.
+func WithLabelAnalyzer(a Analyzer) MemoryVectorStoreOption {
+	return func(s *MemoryVectorStore) {
+		s.analyzer = a
+	}
+}
+
+// NewMemoryVectorStore creates an empty in-memory vector store.
+// Labels are analyzed by the default configuration unless set otherwise.
+func NewMemoryVectorStore(opts ...MemoryVectorStoreOption) *MemoryVectorStore {
+	s := &MemoryVectorStore{
+		analyzer:   DefaultConfiguration().LabelAnalyzer(),
+		entries:    make(map[string]memoryVector),
+		vocabulary: NewVocabulary(),
+		postings:   make(map[string]map[string][]analyzedLabel),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// AddVector stores the vector, replacing any with the same ID.
+// The stored vector is at the version after the replaced one's.
+func (s *MemoryVectorStore) AddVector(ctx context.Context, v TattooImagesVector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entry := s.analyze(v)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.vector.Version = s.entries[v.ID].vector.Version + 1
+	s.remove(v.ID)
+	s.insert(entry)
+	s.touch(v.ID)
+
+	return nil
+}
+
+// WaitForVersion returns at once, the writes are visible when they return.
+func (s *MemoryVectorStore) WaitForVersion(ctx context.Context, token ConsistencyToken) error {
+	return ctx.Err()
+}
+
+// SwapVector replaces the vector of the same ID while it's still at the version, ErrVersionConflict otherwise.
+func (s *MemoryVectorStore) SwapVector(ctx context.Context, v TattooImagesVector, version uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entry := s.analyze(v)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.entries[v.ID]
+	if !ok || current.vector.Version != version {
+		return fmt.Errorf("%w: %s is not at version %d", ErrVersionConflict, v.ID, version)
+	}
+	entry.vector.Version = version + 1
+	s.remove(v.ID)
+	s.insert(entry)
+	s.touch(v.ID)
+
+	return nil
+}
+
+// analyze reduces the labels of the vector to their stems.
+func (s *MemoryVectorStore) analyze(v TattooImagesVector) memoryVector {
+	entry := memoryVector{vector: v}
+	for _, facet := range []string{FacetStyle, FacetSubject, FacetArea} {
+		for label, proximity := range v.facet(facet) {
+			entry.labels = append(entry.labels, analyzedLabel{
+				facet:     facet,
+				stems:     s.analyzer.Analyze(label),
+				proximity: proximity,
+			})
+		}
+	}
+
+	return entry
+}
+
+// insert adds the entry to the entries, the vocabulary & the postings, its ID must be free.
+func (s *MemoryVectorStore) insert(entry memoryVector) {
+	id := entry.vector.ID
+	for _, label := range entry.labels {
+		for _, stem := range label.stems {
+			s.vocabulary.Add(stem)
+		}
+		if len(label.stems) > 0 {
+			byID := s.postings[label.stems[0]]
+			if byID == nil {
+				byID = make(map[string][]analyzedLabel)
+				s.postings[label.stems[0]] = byID
+			}
+			byID[id] = append(byID[id], label)
+		}
+	}
+	s.entries[id] = entry
+}
+
+// DeleteVector removes the vector of the ID, unknown IDs are ignored.
+func (s *MemoryVectorStore) DeleteVector(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+	s.touch(id)
+
+	return nil
+}
+
+// remove drops the vector of the ID from the entries, the vocabulary & the postings.
+func (s *MemoryVectorStore) remove(id string) {
+	old, ok := s.entries[id]
+	if !ok {
+		return
+	}
+
+	for _, label := range old.labels {
+		for _, stem := range label.stems {
+			s.vocabulary.Remove(stem)
+		}
+		if len(label.stems) > 0 {
+			byID := s.postings[label.stems[0]]
+			delete(byID, id)
+			if len(byID) == 0 {
+				delete(s.postings, label.stems[0])
+			}
+		}
+	}
+	delete(s.entries, id)
+}
+
+// SuggestTerms returns the label stems within maxDistance edits of the term.
+func (s *MemoryVectorStore) SuggestTerms(ctx context.Context, term string, maxDistance int) ([]TermSuggestion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.vocabulary.Suggest(term, maxDistance), nil
+}
+
+// GetIDsByQuery returns the IDs of the vectors with a label in the query.
+// Ordered by the summed proximity of the matched labels, ties by ID.
+// Only the labels starting with a stem of the query are looked at.
+func (s *MemoryVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stems := s.analyzer.Analyze(query)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// every label has a single first stem, each is matched once.
+	scores := make(map[string]float64)
+	seen := make(map[string]bool, len(stems))
+	for _, stem := range stems {
+		if seen[stem] {
+			continue
+		}
+		seen[stem] = true
+
+		for id, labels := range s.postings[stem] {
+			for _, label := range labels {
+				if containsPhrase(stems, label.stems) {
+					scores[id] += label.proximity
+				}
+			}
+		}
+	}
+
+	type scored struct {
+		id    string
+		score float64
+	}
+	matches := make([]scored, 0, len(scores))
+	for id, score := range scores {
+		if score > 0 {
+			matches = append(matches, scored{id, score})
+		}
+	}
+	slices.SortFunc(matches, func(a, b scored) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.id, b.id)
+	})
+
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.id
+	}
+
+	return ids, nil
+}
+
+// GetIDsByLabels returns the IDs of the vectors with a label of the facet stemming as one of the labels.
+// Ordered by the best proximity of their matching labels, ties by ID.
+func (s *MemoryVectorStore) GetIDsByLabels(ctx context.Context, facet string, labels []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if facet != FacetStyle && facet != FacetSubject && facet != FacetArea {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFacet, facet)
+	}
+
+	wanted := make([][]string, 0, len(labels))
+	for _, label := range labels {
+		if stems := s.analyzer.Analyze(label); len(stems) > 0 {
+			wanted = append(wanted, stems)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := make(map[string]float64)
+	for _, stems := range wanted {
+		for id, labels := range s.postings[stems[0]] {
+			for _, label := range labels {
+				if label.facet != facet || !slices.Equal(label.stems, stems) {
+					continue
+				}
+				if p, ok := best[id]; !ok || label.proximity > p {
+					best[id] = label.proximity
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(best))
+	for id := range best {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		if c := cmp.Compare(best[b], best[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	return ids, nil
+}
+
+// GetIDsByQueryPage returns a page of the IDs of GetIDsByQuery.
+// The cursor is the position the page starts at.
+func (s *MemoryVectorStore) GetIDsByQueryPage(ctx context.Context, query string, cursor string, limit int) ([]string, string, error) {
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid limit %d", limit)
+	}
+
+	ids, err := s.GetIDsByQuery(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+	if start >= len(ids) {
+		return nil, "", nil
+	}
+	end := min(start+limit, len(ids))
+	if end == len(ids) {
+		return ids[start:end], "", nil
+	}
+
+	return ids[start:end], strconv.Itoa(end), nil
+}
+
+// GetVectorsByID returns the known vectors in the order of the IDs.
+// Unknown IDs are skipped, repeated IDs are returned once.
+func (s *MemoryVectorStore) GetVectorsByID(ctx context.Context, ids []string) ([]TattooImagesVector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]TattooImagesVector, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if entry, ok := s.entries[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, entry.vector)
+		}
+	}
+
+	return out, nil
+}
+
+// ListVectorIDs returns a page of the vector IDs ordered by ID, after the cursor ID.
+func (s *MemoryVectorStore) ListVectorIDs(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	ids := sortedIDs(s.entries)
+	s.mu.RUnlock()
+
+	start, found := slices.BinarySearch(ids, cursor)
+	if found {
+		start++
+	}
+	end := min(start+max(limit, 1), len(ids))
+	page := ids[start:end]
+
+	next := ""
+	if end < len(ids) && len(page) > 0 {
+		next = page[len(page)-1]
+	}
+
+	return page, next, nil
+}
+
+// Ping answers at once, the vectors are in memory.
+func (s *MemoryVectorStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Count returns the number of vectors.
+func (s *MemoryVectorStore) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.entries), nil
+}
+
+// LabelHistogram counts the vectors of every label of the facet, by their original labels.
+func (s *MemoryVectorStore) LabelHistogram(ctx context.Context, facet string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if facet != FacetStyle && facet != FacetSubject && facet != FacetArea {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFacet, facet)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	histogram := make(map[string]int)
+	for _, entry := range s.entries {
+		for label := range entry.vector.facet(facet) {
+			histogram[label]++
+		}
+	}
+
+	return histogram, nil
+}
+
+// containsPhrase reports whether the phrase appears as consecutive tokens.
+func containsPhrase(tokens, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		match := true
+		for j := range phrase {
+			if tokens[i+j] != phrase[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
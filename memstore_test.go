@@ -0,0 +1,113 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// scanIDsByQuery ranks the vectors by scanning every label, as the vector store did before its index.
+func scanIDsByQuery(analyzer searchAPI.Analyzer, vectors map[string]searchAPI.TattooImagesVector, query string) []string {
+	stems := analyzer.Analyze(query)
+	scores := make(map[string]float64)
+	for id, v := range vectors {
+		for _, ls := range []searchAPI.LabelSet{v.Style, v.Subject, v.Area} {
+			for label, proximity := range ls {
+				phrase := analyzer.Analyze(label)
+				for i := 0; len(phrase) > 0 && i+len(phrase) <= len(stems); i++ {
+					if slices.Equal(stems[i:i+len(phrase)], phrase) {
+						scores[id] += proximity
+						break
+					}
+				}
+			}
+		}
+	}
+
+	ids := []string{}
+	for id, score := range scores {
+		if score > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// labelWords are the labels & query words of the generated vectors.
+var labelWords = []string{
+	"lion", "tiger", "rose", "skull", "black and white", "sacred heart", "heart",
+	"realistic", "neo traditional", "traditional", "chest", "upper arm", "arm", "back",
+}
+
+// randomVector generates a vector of the ID with up to two labels of the words a facet.
+func randomVector(r *rand.Rand, id string, words []string) searchAPI.TattooImagesVector {
+	labels := func() searchAPI.LabelSet {
+		ls := searchAPI.LabelSet{}
+		for range r.IntN(3) {
+			ls[words[r.IntN(len(words))]] = float64(r.IntN(100))
+		}
+		return ls
+	}
+
+	return searchAPI.TattooImagesVector{ID: id, Style: labels(), Subject: labels(), Area: labels()}
+}
+
+var _ = Describe("MemoryVectorStore", func() {
+	analyzer := searchAPI.DefaultConfiguration().LabelAnalyzer()
+
+	It("ranks the matches like a scan of every label", func() {
+		ctx := context.Background()
+		r := rand.New(rand.NewPCG(1, 2))
+		vs := searchAPI.NewMemoryVectorStore()
+		vectors := make(map[string]searchAPI.TattooImagesVector)
+
+		for i := range 3000 {
+			id := fmt.Sprintf("v%d", r.IntN(1000))
+			switch {
+			case i%7 == 0:
+				Expect(vs.DeleteVector(ctx, id)).To(Succeed())
+				delete(vectors, id)
+			default:
+				v := randomVector(r, id, labelWords)
+				Expect(vs.AddVector(ctx, v)).To(Succeed())
+				vectors[id] = v
+			}
+		}
+
+		queries := []string{"lion", "black and white lion on the upper arm", "sacred heart heart", "traditional rose", "white", "dragon", "lion lion chest"}
+		for range 50 {
+			queries = append(queries, labelWords[r.IntN(len(labelWords))]+" "+labelWords[r.IntN(len(labelWords))])
+		}
+		for _, q := range queries {
+			ids, err := vs.GetIDsByQuery(ctx, q)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ids).To(Equal(scanIDsByQuery(analyzer, vectors, q)), "query %q", q)
+		}
+	})
+
+	It("forgets the deleted vectors", func() {
+		ctx := context.Background()
+		vs := searchAPI.NewMemoryVectorStore()
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "X", Subject: searchAPI.LabelSet{"lion": 90}})).To(Succeed())
+		Expect(vs.DeleteVector(ctx, "X")).To(Succeed())
+		Expect(vs.DeleteVector(ctx, "unknown")).To(Succeed())
+
+		Expect(vs.GetIDsByQuery(ctx, "lion")).To(BeEmpty())
+		Expect(vs.GetVectorsByID(ctx, []string{"X"})).To(BeEmpty())
+		Expect(vs.SuggestTerms(ctx, "lion", 1)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,134 @@
+package inkinspot
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// messageFiles are the error message catalogs, a JSON object of the messages by error code per language.
+// To translate the messages into another language add its file here.
+//
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// LocalePolicy translates the error messages into the language the client accepts.
+// The error codes stay the same whatever the language, English is the fallback.
+type LocalePolicy struct {
+	// Messages override & extend the embedded catalogs, by language tag then error code.
+	Messages map[string]map[string]string
+}
+
+// messageCatalog holds the error messages by language & code.
+type messageCatalog struct {
+	// tags are the languages of the catalog, English first as the fallback.
+	tags     []string
+	matcher  language.Matcher
+	messages map[string]map[string]string
+}
+
+// newMessageCatalog loads the embedded catalogs & applies the overrides of the policy.
+func newMessageCatalog(p LocalePolicy) *messageCatalog {
+	c := &messageCatalog{messages: map[string]map[string]string{"en": {}}}
+
+	files, _ := messageFiles.ReadDir("messages")
+	for _, f := range files {
+		b, err := messageFiles.ReadFile(path.Join("messages", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic("messages/" + f.Name() + ": " + err.Error())
+		}
+		c.add(strings.TrimSuffix(f.Name(), ".json"), messages)
+	}
+	for tag, messages := range p.Messages {
+		c.add(tag, messages)
+	}
+
+	tags := []language.Tag{language.English}
+	c.tags = []string{"en"}
+	for tag := range c.messages {
+		if tag != "en" {
+			c.tags = append(c.tags, tag)
+		}
+	}
+	slices.Sort(c.tags[1:])
+	for _, tag := range c.tags[1:] {
+		tags = append(tags, language.Make(tag))
+	}
+	c.matcher = language.NewMatcher(tags)
+
+	return c
+}
+
+// add merges the messages of the language, overriding the ones of the same code.
+func (c *messageCatalog) add(tag string, messages map[string]string) {
+	base, _ := language.Make(tag).Base()
+	m := c.messages[base.String()]
+	if m == nil {
+		m = make(map[string]string, len(messages))
+		c.messages[base.String()] = m
+	}
+	for code, msg := range messages {
+		m[code] = msg
+	}
+}
+
+// language returns the catalog language best matching the Accept-Language header, by its q-values.
+// It's English when none matches.
+func (c *messageCatalog) language(accept string) string {
+	_, i := language.MatchStrings(c.matcher, accept)
+
+	return c.tags[i]
+}
+
+// message returns the message of the code in the language, the English message given otherwise.
+func (c *messageCatalog) message(lang, code, english string) string {
+	if msg, ok := c.messages[lang][code]; ok {
+		return msg
+	}
+
+	return english
+}
+
+// localizedWriter carries the language of the client to the error responses.
+type localizedWriter struct {
+	http.ResponseWriter
+	lang    string
+	catalog *messageCatalog
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the response.
+func (w *localizedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// localize returns the message of the code in the language of the client.
+func (w *localizedWriter) localize(code, english string) string {
+	msg := w.catalog.message(w.lang, code, english)
+	if msg != english {
+		w.Header().Set("Content-Language", w.lang)
+	}
+
+	return msg
+}
+
+// withLocale translates the error messages into the language of the Accept-Language header.
+func withLocale(catalog *messageCatalog, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept-Language")
+		if accept == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&localizedWriter{ResponseWriter: w, lang: catalog.language(accept), catalog: catalog}, r)
+	})
+}
@@ -0,0 +1,76 @@
+package inkinspot_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Localized error messages", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{LocalePolicy: searchAPI.LocalePolicy{Messages: map[string]map[string]string{
+			"ru": {"empty_query": "Введите запрос"},
+			"fr": {"empty_query": "La requête est vide"},
+		}}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	// emptyQuery searches nothing with the Accept-Language header, it returns the error & the Content-Language.
+	emptyQuery := func(accept string) (searchAPI.APIError, string) {
+		GinkgoHelper()
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=", nil)
+		Expect(err).NotTo(HaveOccurred())
+		if accept != "" {
+			req.Header.Set("Accept-Language", accept)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return *body.Error, resp.Header.Get("Content-Language")
+	}
+
+	DescribeTable("selects the language by the Accept-Language q-values",
+		func(accept, message, contentLanguage string) {
+			apiErr, lang := emptyQuery(accept)
+			Expect(apiErr.Code).To(Equal("empty_query"), "the code is the same in every language")
+			Expect(apiErr.Message).To(Equal(message))
+			Expect(lang).To(Equal(contentLanguage))
+		},
+		Entry("no header", "", "query must not be empty", ""),
+		Entry("hebrew", "he", "השאילתה לא יכולה להיות ריקה", "he"),
+		Entry("a regional tag", "he-IL,en;q=0.5", "השאילתה לא יכולה להיות ריקה", "he"),
+		Entry("the highest q-value", "en;q=0.3,he;q=0.8", "השאילתה לא יכולה להיות ריקה", "he"),
+		Entry("an unsupported language falls back to English", "de", "query must not be empty", ""),
+		Entry("a malformed header falls back to English", ";;q=x", "query must not be empty", ""),
+		Entry("an overridden message", "ru-RU", "Введите запрос", "ru"),
+		Entry("a language added by the overrides", "fr-CA", "La requête est vide", "fr"),
+	)
+
+	It("keeps the English message of the codes a catalog lacks", func() {
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/nope", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Accept-Language", "fr")
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Error.Code).To(Equal("not_found"))
+		Expect(body.Error.Message).To(Equal("no such endpoint"))
+	})
+})
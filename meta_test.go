@@ -0,0 +1,92 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response metadata", func() {
+	const delay = 30 * time.Millisecond
+	var (
+		se    *httptest.Server
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, tc := range inkinspottest.BigCats {
+			Expect(is.AddCollection(context.Background(), tc.Collection)).To(Succeed())
+			Expect(vs.AddVector(context.Background(), tc.Vector)).To(Succeed())
+		}
+
+		cfg := searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Minute}}
+		clock = inkinspottest.NewFakeClock(time.Now())
+		slow := inkinspottest.NewLatencyStore(is, delay, inkinspottest.WithLatencyClock(clock))
+		eng := searchAPI.NewSearchEngine(cfg, slow, vs, searchAPI.WithClock(clock))
+		se = httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+	})
+
+	search := func(params url.Values) HTTPResult {
+		GinkgoHelper()
+		return advanceDuring(clock, delay, func() HTTPResult { return doSearch(se, params) })
+	}
+
+	It("always includes the time taken", func() {
+		res := search(url.Values{"q": {"lion"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.TookMS).To(BeNumerically("==", delay.Milliseconds()))
+		Expect(res.JSON.Meta).To(BeNil())
+	})
+
+	It("includes the stage timings with debug_meta", func() {
+		res := search(url.Values{"q": {"Lions"}, "debug_meta": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+
+		meta := res.JSON.Meta
+		Expect(meta).NotTo(BeNil())
+		Expect(meta.Queries[0].Text).To(Equal("lions"))
+		Expect(meta.Queries[0].Stems).To(Equal([]string{"lion"}))
+		Expect(meta.ResultCount).To(Equal(2))
+		Expect(meta.CacheHit).To(BeFalse())
+		Expect(meta.ImageStoreMS).To(BeNumerically("==", delay.Milliseconds()))
+		Expect(meta.VectorStoreMS).To(BeZero())
+		Expect(meta.TotalMS).To(BeNumerically("==", delay.Milliseconds()))
+		Expect(res.JSON.TookMS).To(Equal(meta.TotalMS))
+	})
+
+	It("includes the metadata with the X-Debug header", func() {
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/search?q=lion", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("X-Debug", "1")
+		resp := advanceDuring(clock, delay, func() *http.Response {
+			resp, err := se.Client().Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			return resp
+		})
+		defer resp.Body.Close()
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Meta).NotTo(BeNil())
+	})
+
+	It("reports cache hits without store timings", func() {
+		search(url.Values{"q": {"lion"}})
+		res := doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}})
+		Expect(res.JSON.Meta.CacheHit).To(BeTrue())
+		Expect(res.JSON.Meta.ImageStoreMS).To(BeZero())
+		Expect(res.JSON.Meta.TotalMS).To(BeZero())
+	})
+})
@@ -0,0 +1,72 @@
+package inkinspot
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// methodRoute serves the handlers of a route by the method of the request.
+// It answers OPTIONS with the Allow header & the other methods with a 405 carrying it.
+type methodRoute struct {
+	handlers map[string]http.Handler
+	allowed  []string
+}
+
+// methods routes the methods to the handler, a GET handler serves HEAD too.
+func methods(h http.Handler, allowed ...string) *methodRoute {
+	return (&methodRoute{handlers: map[string]http.Handler{}}).handle(h, allowed...)
+}
+
+// handle routes more methods of the route to the handler.
+func (m *methodRoute) handle(h http.Handler, allowed ...string) *methodRoute {
+	for _, method := range allowed {
+		if _, ok := m.handlers[method]; !ok {
+			m.allowed = append(m.allowed, method)
+		}
+		m.handlers[method] = h
+	}
+
+	return m
+}
+
+// allow returns the Allow header of the route, HEAD follows GET & OPTIONS comes last.
+func (m *methodRoute) allow() []string {
+	out := make([]string, 0, len(m.allowed)+2)
+	for _, method := range m.allowed {
+		if method == http.MethodHead || method == http.MethodOptions {
+			continue
+		}
+		out = append(out, method)
+		if method == http.MethodGet {
+			out = append(out, http.MethodHead)
+		}
+	}
+	if slices.Contains(m.allowed, http.MethodHead) && !slices.Contains(out, http.MethodHead) {
+		out = append(out, http.MethodHead)
+	}
+
+	return append(out, http.MethodOptions)
+}
+
+func (m *methodRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m.handlers[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	allow := m.allow()
+	switch h, ok := m.handlers[http.MethodGet]; {
+	case r.Method == http.MethodHead && ok:
+		// the server drops the body of the HEAD requests, the GET handler answers as for a GET.
+		get := r.Clone(r.Context())
+		get.Method = http.MethodGet
+		h.ServeHTTP(w, get)
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use "+strings.Join(allow[:len(allow)-1], ", "))
+	}
+}
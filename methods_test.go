@@ -0,0 +1,128 @@
+package inkinspot_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route methods", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		engine := initSeededSearchEngine(searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}})
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	do := func(method, path string) (*http.Response, []byte) {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if strings.HasPrefix(path, "/admin/") {
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp, body
+	}
+
+	// every route of the API & its Allow header.
+	routes := map[string]string{
+		"/search":                     "GET, HEAD, POST, OPTIONS",
+		"/discover":                   "GET, HEAD, OPTIONS",
+		"/search/updates":             "GET, HEAD, OPTIONS",
+		"/search/by-vector":           "POST, OPTIONS",
+		"/tattoos":                    "POST, OPTIONS",
+		"/tattoos/X":                  "GET, HEAD, PUT, DELETE, OPTIONS",
+		"/tattoos/X/vector":           "GET, HEAD, PATCH, OPTIONS",
+		"/artists/a/tattoos":          "GET, HEAD, OPTIONS",
+		"/readyz":                     "GET, HEAD, OPTIONS",
+		"/ingest/webhook":             "POST, OPTIONS",
+		"/feedback":                   "POST, OPTIONS",
+		"/stats/public":               "GET, HEAD, OPTIONS",
+		"/admin/boosts":               "GET, HEAD, PUT, OPTIONS",
+		"/admin/experiments":          "GET, HEAD, PUT, OPTIONS",
+		"/admin/experiments/metrics":  "GET, HEAD, OPTIONS",
+		"/admin/search":               "GET, HEAD, POST, OPTIONS",
+		"/admin/rank":                 "POST, OPTIONS",
+		"/admin/ranking/diff":         "POST, OPTIONS",
+		"/admin/stats":                "GET, HEAD, OPTIONS",
+		"/admin/tattoos":              "GET, HEAD, OPTIONS",
+		"/admin/tattoos/X/vector":     "GET, HEAD, OPTIONS",
+		"/admin/tattoos/X/coverage":   "GET, HEAD, OPTIONS",
+		"/admin/export":               "GET, HEAD, OPTIONS",
+		"/admin/import":               "POST, OPTIONS",
+		"/admin/chaos":                "GET, HEAD, OPTIONS",
+		"/admin/load":                 "GET, HEAD, OPTIONS",
+		"/admin/store-errors":         "GET, HEAD, OPTIONS",
+		"/admin/zero-results":         "GET, HEAD, OPTIONS",
+		"/admin/cache":                "DELETE, OPTIONS",
+		"/admin/cache/stats":          "GET, HEAD, OPTIONS",
+		"/admin/speculation":          "GET, HEAD, OPTIONS",
+		"/admin/reindex":              "POST, OPTIONS",
+		"/admin/reindex/status":       "GET, HEAD, OPTIONS",
+		"/admin/jobs":                 "GET, HEAD, OPTIONS",
+		"/admin/usage":                "GET, HEAD, DELETE, OPTIONS",
+		"/admin/jobs/consistency/run": "POST, OPTIONS",
+		"/admin/audit":                "GET, HEAD, OPTIONS",
+		"/admin/consistency":          "GET, HEAD, POST, OPTIONS",
+	}
+
+	It("lists the methods of every route on OPTIONS", func() {
+		for path, allow := range routes {
+			resp, body := do(http.MethodOptions, path)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent), path)
+			Expect(resp.Header.Get("Allow")).To(Equal(allow), path)
+			Expect(body).To(BeEmpty(), path)
+		}
+	})
+
+	It("answers 405 with the Allow header on every route", func() {
+		for path, allow := range routes {
+			for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+				if strings.Contains(allow, method) {
+					continue
+				}
+				resp, body := do(method, path)
+				Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed), "%s %s", method, path)
+				Expect(resp.Header.Get("Allow")).To(Equal(allow), "%s %s", method, path)
+
+				var res searchAPI.Response
+				Expect(json.Unmarshal(body, &res)).To(Succeed(), "%s %s", method, path)
+				Expect(res.Error.Code).To(Equal("method_not_allowed"), "%s %s", method, path)
+			}
+		}
+	})
+
+	It("serves HEAD as GET without the body", func() {
+		get, getBody := do(http.MethodGet, "/search?q=lion")
+		head, headBody := do(http.MethodHead, "/search?q=lion")
+		Expect(head.StatusCode).To(Equal(get.StatusCode))
+		Expect(head.Header.Get("Content-Type")).To(Equal(get.Header.Get("Content-Type")))
+		Expect(getBody).NotTo(BeEmpty())
+		Expect(headBody).To(BeEmpty())
+	})
+
+	It("leaves the writes of the collections out without the admin token", func() {
+		public := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+		DeferCleanup(public.Close)
+
+		req, err := http.NewRequest(http.MethodOptions, public.URL+"/tattoos/X", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := public.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.Header.Get("Allow")).To(Equal("GET, HEAD, OPTIONS"))
+	})
+})
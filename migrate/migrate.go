@@ -0,0 +1,258 @@
+// Package migrate copies a catalog between store pairs, batch by batch with retries,
+// & verifies a sample of the copied records by reading them back.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// StorePair is an image store & the vector store of the same catalog.
+type StorePair struct {
+	Images  inkinspot.ImageStore
+	Vectors inkinspot.VectorStore
+}
+
+// MigrateOptions tunes a migration.
+// Zero values are replaced by the defaults.
+type MigrateOptions struct {
+	// BatchSize is the number of records listed from the source at once.
+	BatchSize int
+	// Concurrency is the number of records written at once.
+	Concurrency int
+	// Retries is the number of times a failed write is retried, a negative value disables them.
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled on every retry.
+	RetryBackoff time.Duration
+	// VerifySample is the number of copied records re-read from the destination.
+	VerifySample int
+}
+
+func (o MigrateOptions) withDefaults() MigrateOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	} else if o.Retries == 0 {
+		o.Retries = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 50 * time.Millisecond
+	}
+
+	return o
+}
+
+// MigrationReport is the outcome of a migration.
+type MigrationReport struct {
+	Copied   int                `json:"copied"`
+	Failed   int                `json:"failed"`
+	Failures []MigrationFailure `json:"failures,omitempty"`
+	// Verified is the number of sampled records read back equal.
+	Verified   int      `json:"verified"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// MigrationFailure is a record which couldn't be copied & why.
+type MigrationFailure struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// CopyAll copies every record of the source stores into the destination stores.
+// The source is iterated in batches, failed writes are retried before being reported.
+// It only fails when the source can't be read, the failed records are in the report.
+func CopyAll(ctx context.Context, src, dst StorePair, opts MigrateOptions) (MigrationReport, error) {
+	opts = opts.withDefaults()
+
+	lookup, ok := src.Vectors.(inkinspot.VectorLookup)
+	if !ok {
+		return MigrationReport{}, fmt.Errorf("%w: source vector store has no lookups", inkinspot.ErrMigrationUnsupported)
+	}
+	cw, ok := dst.Images.(inkinspot.CollectionWriter)
+	if !ok {
+		return MigrationReport{}, fmt.Errorf("%w: destination image store can't be written", inkinspot.ErrMigrationUnsupported)
+	}
+	vw, ok := dst.Vectors.(inkinspot.VectorWriter)
+	if !ok {
+		return MigrationReport{}, fmt.Errorf("%w: destination vector store can't be written", inkinspot.ErrMigrationUnsupported)
+	}
+
+	it, err := inkinspot.IterateStore(ctx, src.Images, opts.BatchSize)
+	if errors.Is(err, inkinspot.ErrExportUnsupported) {
+		return MigrationReport{}, fmt.Errorf("%w: source image store can't list", inkinspot.ErrMigrationUnsupported)
+	}
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	defer it.Close()
+
+	var (
+		report MigrationReport
+		sample = newRecordSample(opts.VerifySample)
+	)
+
+	for {
+		page, err := inkinspot.NextBatch(ctx, it, opts.BatchSize)
+		if errors.Is(err, inkinspot.ErrIteratorDone) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		records, err := pageRecords(ctx, lookup, page)
+		if err != nil {
+			return report, err
+		}
+
+		for i, err := range copyBatch(ctx, cw, vw, records, opts) {
+			if err != nil {
+				report.Failed++
+				report.Failures = append(report.Failures, MigrationFailure{ID: records[i].Collection.ID, Reason: err.Error()})
+				continue
+			}
+			report.Copied++
+			sample.add(records[i])
+		}
+	}
+
+	for _, rec := range sample.records {
+		if err := verifyRecord(ctx, dst, rec); err != nil {
+			report.Mismatches = append(report.Mismatches, fmt.Sprintf("%s: %v", rec.Collection.ID, err))
+			continue
+		}
+		report.Verified++
+	}
+
+	return report, nil
+}
+
+// pageRecords pairs the collections of a page with their vectors.
+func pageRecords(ctx context.Context, lookup inkinspot.VectorLookup, page []inkinspot.TattooImagesCollection) ([]inkinspot.ExportRecord, error) {
+	ids := make([]string, 0, len(page))
+	for _, c := range page {
+		ids = append(ids, c.ID)
+	}
+
+	vectors, err := lookup.GetVectorsByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]inkinspot.TattooImagesVector, len(vectors))
+	for _, v := range vectors {
+		byID[v.ID] = v
+	}
+
+	records := make([]inkinspot.ExportRecord, 0, len(page))
+	for _, c := range page {
+		rec := inkinspot.ExportRecord{Collection: c}
+		if v, ok := byID[c.ID]; ok {
+			rec.Vector = &v
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// copyBatch writes the records concurrently, it returns their errors by index.
+func copyBatch(ctx context.Context, cw inkinspot.CollectionWriter, vw inkinspot.VectorWriter, records []inkinspot.ExportRecord, opts MigrateOptions) []error {
+	errs := make([]error, len(records))
+	sem := make(chan struct{}, opts.Concurrency)
+
+	var wg sync.WaitGroup
+	for i, rec := range records {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = withRetries(ctx, opts, func() error {
+				if err := cw.AddCollection(ctx, rec.Collection); err != nil {
+					return err
+				}
+				if rec.Vector != nil {
+					return vw.AddVector(ctx, *rec.Vector)
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// withRetries calls fn until it succeeds, the retries run out or the context ends.
+func withRetries(ctx context.Context, opts MigrateOptions, fn func() error) error {
+	backoff := opts.RetryBackoff
+
+	err := fn()
+	for retry := 0; err != nil && retry < opts.Retries; retry++ {
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = fn()
+	}
+
+	return err
+}
+
+// verifyRecord reads the record back from the stores & compares it.
+func verifyRecord(ctx context.Context, stores StorePair, rec inkinspot.ExportRecord) error {
+	collections, err := stores.Images.GetTattoosByID(ctx, []string{rec.Collection.ID})
+	if err != nil && !errors.Is(err, inkinspot.ErrCollectionNotFound) {
+		return err
+	}
+	if len(collections) != 1 || !reflect.DeepEqual(collections[0], rec.Collection) {
+		return errors.New("collection differs")
+	}
+
+	lookup, ok := stores.Vectors.(inkinspot.VectorLookup)
+	if !ok || rec.Vector == nil {
+		return nil
+	}
+	vectors, err := lookup.GetVectorsByID(ctx, []string{rec.Collection.ID})
+	if err != nil {
+		return err
+	}
+	if len(vectors) != 1 || !reflect.DeepEqual(vectors[0], *rec.Vector) {
+		return errors.New("vector differs")
+	}
+
+	return nil
+}
+
+// recordSample is a uniform reservoir sample of the copied records.
+type recordSample struct {
+	size    int
+	seen    int
+	records []inkinspot.ExportRecord
+}
+
+func newRecordSample(size int) *recordSample {
+	return &recordSample{size: size}
+}
+
+func (s *recordSample) add(rec inkinspot.ExportRecord) {
+	s.seen++
+	if len(s.records) < s.size {
+		s.records = append(s.records, rec)
+	} else if j := rand.IntN(s.seen); j < s.size {
+		s.records[j] = rec
+	}
+}
@@ -0,0 +1,95 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+	"github.com/DanyPops/inkinspot/migrate"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// lossyImageStore drops the URLs of the collections it stores.
+type lossyImageStore struct {
+	*searchAPI.MemoryImageStore
+}
+
+func (s lossyImageStore) AddCollection(ctx context.Context, c searchAPI.TattooImagesCollection) error {
+	c.URLs = nil
+	return s.MemoryImageStore.AddCollection(ctx, c)
+}
+
+var _ = Describe("Store migration", func() {
+	const entries = 50
+	var src migrate.StorePair
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for i := range entries {
+			id := fmt.Sprintf("m%02d", i)
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": float64(i)}})).To(Succeed())
+		}
+		src = migrate.StorePair{Images: is, Vectors: vs}
+	})
+
+	opts := migrate.MigrateOptions{BatchSize: 7, Concurrency: 3, RetryBackoff: time.Millisecond, VerifySample: 10}
+
+	It("copies every record between in-memory stores", func() {
+		dstImages := searchAPI.NewMemoryImageStore()
+		dstVectors := searchAPI.NewMemoryVectorStore()
+
+		report, err := migrate.CopyAll(context.Background(), src, migrate.StorePair{Images: dstImages, Vectors: dstVectors}, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(migrate.MigrationReport{Copied: entries, Verified: 10}))
+
+		vectors, err := dstVectors.GetVectorsByID(context.Background(), []string{"m00", "m49"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vectors).To(HaveLen(2))
+		Expect(vectors[1].Subject).To(Equal(searchAPI.LabelSet{"lion": 49}))
+	})
+
+	It("retries the failed writes", func() {
+		dstImages := inkinspottest.NewFaultyStore(searchAPI.NewMemoryImageStore(), inkinspottest.FailEvery(3))
+		dst := migrate.StorePair{Images: dstImages, Vectors: searchAPI.NewMemoryVectorStore()}
+
+		report, err := migrate.CopyAll(context.Background(), src, dst, migrate.MigrateOptions{Concurrency: 1, RetryBackoff: time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report).To(Equal(migrate.MigrationReport{Copied: entries}))
+		Expect(dstImages.Calls()).To(BeNumerically(">", entries))
+	})
+
+	It("reports the writes which keep failing", func() {
+		dstImages := inkinspottest.NewFaultyStore(searchAPI.NewMemoryImageStore(), inkinspottest.FailAfter(entries-2), inkinspottest.WithFault(errors.New("disk on fire")))
+		dst := migrate.StorePair{Images: dstImages, Vectors: searchAPI.NewMemoryVectorStore()}
+
+		report, err := migrate.CopyAll(context.Background(), src, dst, migrate.MigrateOptions{Concurrency: 1, Retries: 1, RetryBackoff: time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Copied).To(Equal(entries - 2))
+		Expect(report.Failures).To(Equal([]migrate.MigrationFailure{
+			{ID: "m48", Reason: "disk on fire"},
+			{ID: "m49", Reason: "disk on fire"},
+		}))
+	})
+
+	It("reports the records which read back differently", func() {
+		dst := migrate.StorePair{Images: lossyImageStore{searchAPI.NewMemoryImageStore()}, Vectors: searchAPI.NewMemoryVectorStore()}
+
+		report, err := migrate.CopyAll(context.Background(), src, dst, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Copied).To(Equal(entries))
+		Expect(report.Verified).To(BeZero())
+		Expect(report.Mismatches).To(HaveLen(10))
+	})
+
+	It("refuses stores which can't be listed or written", func() {
+		_, err := migrate.CopyAll(context.Background(), migrate.StorePair{Images: inkinspottest.NewFakeImageStore(), Vectors: inkinspottest.NewFakeVectorStore()}, src, opts)
+		Expect(err).To(MatchError(searchAPI.ErrMigrationUnsupported))
+	})
+})
@@ -0,0 +1,61 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func collectionIDs(ics []searchAPI.TattooImagesCollection) []string {
+	ids := make([]string, 0, len(ics))
+	for _, ic := range ics {
+		ids = append(ids, ic.ID)
+	}
+
+	return ids
+}
+
+var _ = Describe("Multi-value queries", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+	})
+
+	AfterEach(func() {
+		se.Close()
+	})
+
+	When("several q values are sent", func() {
+		It("returns the union of their results", func() {
+			res := doSearch(se, url.Values{"q": {"realistic", "tiger"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("X", "Z"))
+		})
+
+		It("returns a collection matched by several queries once", func() {
+			res := doSearch(se, url.Values{"q": {"lion", "chest"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf("X", "Y", "Z"))
+		})
+
+		It("echoes the interpreted queries without duplicates", func() {
+			res := doSearch(se, url.Values{"q": {" LION ", "lion", "tiger"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.Queries).To(Equal([]string{"lion", "tiger"}))
+		})
+	})
+
+	When("more q values than the cap are sent", func() {
+		It("returns a 400 Bad Request", func() {
+			res := doSearch(se, url.Values{"q": {"a", "b", "c", "d", "e", "f"}})
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("too_many_queries"))
+		})
+	})
+})
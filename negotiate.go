@@ -0,0 +1,250 @@
+package inkinspot
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Media types of the built in response encoders.
+const (
+	MediaTypeJSON   = "application/json"
+	MediaTypeNDJSON = "application/x-ndjson"
+	// MediaTypeCompactJSON is the JSON with the label sets as arrays of pairs, see CompactJSONEncoder.
+	MediaTypeCompactJSON = "application/vnd.inkinspot.compact+json"
+)
+
+// ResponseEncoder encodes the response payloads in its media type.
+// The encoders are negotiated by the Accept header of the requests, errors included.
+type ResponseEncoder struct {
+	MediaType string
+	Encode    func(buf *bytes.Buffer, payload any) error
+	// canonical encoders write the canonical JSON, the cached search bodies are served to their clients.
+	canonical bool
+}
+
+// encodeCanonicalPayload appends the canonical JSON of the payload, see marshalCanonical.
+func encodeCanonicalPayload(buf *bytes.Buffer, payload any) error {
+	return canonicalEncoder{}.encode(buf, reflect.ValueOf(payload))
+}
+
+// EncodeCompactJSON appends the canonical JSON of the payload with its label sets as arrays of [label, proximity] pairs,
+// see LabelSet.MarshalCompactJSON.
+func EncodeCompactJSON(buf *bytes.Buffer, payload any) error {
+	return canonicalEncoder{compactLabels: true}.encode(buf, reflect.ValueOf(payload))
+}
+
+// CompactJSONEncoder is the opt-in encoder of the bandwidth sensitive clients, registered with WithResponseEncoder.
+var CompactJSONEncoder = ResponseEncoder{MediaType: MediaTypeCompactJSON, Encode: EncodeCompactJSON}
+
+// jsonEncoder is the encoder of the clients which accept anything.
+var jsonEncoder = ResponseEncoder{MediaType: MediaTypeJSON, Encode: encodeCanonicalPayload, canonical: true}
+
+// defaultEncoders are the encoders of every engine, in order of preference.
+// An NDJSON response is a single line of canonical JSON, the streams write a line per record.
+func defaultEncoders() []ResponseEncoder {
+	return []ResponseEncoder{
+		jsonEncoder,
+		{MediaType: MediaTypeNDJSON, Encode: encodeCanonicalPayload, canonical: true},
+	}
+}
+
+// WithResponseEncoder registers an encoder the clients may negotiate, replacing the one of its media type.
+// The encoders registered last are preferred last.
+func WithResponseEncoder(enc ResponseEncoder) SearchEngineOption {
+	return func(e *SearchEngine) {
+		enc.MediaType = strings.ToLower(enc.MediaType)
+		enc.canonical = false
+		if i := slices.IndexFunc(e.encoders, func(r ResponseEncoder) bool { return r.MediaType == enc.MediaType }); i >= 0 {
+			e.encoders[i] = enc
+			return
+		}
+		e.encoders = append(e.encoders, enc)
+	}
+}
+
+// mediaRange is a range of the Accept header & its quality.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept returns the media ranges of the Accept header, the malformed ones are skipped.
+func parseAccept(header string) []mediaRange {
+	var out []mediaRange
+	for _, raw := range strings.Split(header, ",") {
+		params := strings.Split(raw, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			r.q = q
+		}
+		out = append(out, r)
+	}
+
+	return out
+}
+
+// quality returns the quality the ranges give the media type, by the most specific range matching it.
+// It also returns how specific that range is, -1 when none matches.
+func quality(ranges []mediaRange, mediaType string) (float64, int) {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q, specificity
+}
+
+// negotiate returns the encoder the Accept header prefers, by quality then specificity then registration.
+// A missing header accepts the first encoder, false when the header accepts none.
+func negotiate(encoders []ResponseEncoder, accept string) (ResponseEncoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ, bestSpecificity := -1, 0.0, -1
+	for i, enc := range encoders {
+		q, specificity := quality(ranges, enc.MediaType)
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = i, q, specificity
+		}
+	}
+	if best < 0 {
+		return ResponseEncoder{}, false
+	}
+
+	return encoders[best], true
+}
+
+// acceptsUTF8 reports whether the Accept-Charset header accepts UTF-8, the only charset of the responses.
+func acceptsUTF8(header string) bool {
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+
+	q, specificity := 0.0, -1
+	for _, raw := range strings.Split(header, ",") {
+		params := strings.Split(raw, ";")
+		charset := strings.ToLower(strings.TrimSpace(params[0]))
+		s := -1
+		switch charset {
+		case "utf-8":
+			s = 1
+		case "*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		q, specificity = 1, s
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.TrimSpace(name) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				} else {
+					q = 0
+				}
+			}
+		}
+	}
+
+	return q > 0
+}
+
+// negotiatedWriter carries the encoder negotiated with the client to the responses.
+type negotiatedWriter struct {
+	http.ResponseWriter
+	encoder ResponseEncoder
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the response.
+func (w *negotiatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// unwrapWriter returns the writer of the type among the writers w wraps, w included.
+func unwrapWriter[T http.ResponseWriter](w http.ResponseWriter) (T, bool) {
+	for {
+		if found, ok := w.(T); ok {
+			return found, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// responseEncoder returns the encoder negotiated for the response, JSON outside of the negotiation.
+func responseEncoder(w http.ResponseWriter) ResponseEncoder {
+	if nw, ok := unwrapWriter[*negotiatedWriter](w); ok {
+		return nw.encoder
+	}
+
+	return jsonEncoder
+}
+
+// notAcceptable is the body of the requests which accept none of the encoders.
+type notAcceptable struct {
+	Error     *APIError `json:"error"`
+	Supported []string  `json:"supported"`
+}
+
+// withNegotiation encodes the responses in the media type the Accept header prefers.
+// The requests accepting none of the encoders, or not UTF-8, are answered 406 in JSON with the supported media types.
+func withNegotiation(encoders []ResponseEncoder, next http.Handler) http.Handler {
+	supported := make([]string, 0, len(encoders))
+	for _, enc := range encoders {
+		supported = append(supported, enc.MediaType)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		enc, ok := negotiate(encoders, r.Header.Get("Accept"))
+		if !ok || !acceptsUTF8(r.Header.Get("Accept-Charset")) {
+			message := "none of the supported media types is acceptable"
+			if lw, ok := unwrapWriter[*localizedWriter](w); ok {
+				message = lw.localize("not_acceptable", message)
+			}
+			writeJSON(w, http.StatusNotAcceptable, notAcceptable{Error: &APIError{Code: "not_acceptable", Message: message}, Supported: supported})
+			return
+		}
+
+		next.ServeHTTP(&negotiatedWriter{ResponseWriter: w, encoder: enc}, r)
+	})
+}
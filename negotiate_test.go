@@ -0,0 +1,144 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// negotiated is a response to a request with negotiation headers.
+type negotiated struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// doNegotiate requests the path with the headers.
+func doNegotiate(se *httptest.Server, path string, headers map[string]string) negotiated {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+path, nil)
+	Expect(err).NotTo(HaveOccurred())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	return negotiated{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: b}
+}
+
+var _ = Describe("Content negotiation", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+		DeferCleanup(se.Close)
+	})
+
+	DescribeTable("picks the encoder by the Accept header",
+		func(accept, mediaType string) {
+			res := doNegotiate(se, "/search?q=lion", map[string]string{"Accept": accept})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.ContentType).To(Equal(mediaType))
+
+			var resp searchAPI.Response
+			Expect(json.Unmarshal(res.Body, &resp)).To(Succeed())
+			Expect(collectionIDs(resp.ImageCollections)).NotTo(BeEmpty())
+		},
+		Entry("no header", "", searchAPI.MediaTypeJSON),
+		Entry("a wildcard", "*/*", searchAPI.MediaTypeJSON),
+		Entry("a subtype wildcard", "application/*", searchAPI.MediaTypeJSON),
+		Entry("NDJSON", "application/x-ndjson", searchAPI.MediaTypeNDJSON),
+		Entry("the higher quality", "application/json;q=0.5, application/x-ndjson;q=0.9", searchAPI.MediaTypeNDJSON),
+		Entry("the more specific range", "*/*;q=0.8, application/x-ndjson;q=0.8", searchAPI.MediaTypeNDJSON),
+		Entry("JSON excluded", "application/json;q=0, */*", searchAPI.MediaTypeNDJSON),
+	)
+
+	It("answers 406 with the supported media types", func() {
+		for _, headers := range []map[string]string{
+			{"Accept": "text/html"},
+			{"Accept": "application/json;q=0"},
+			{"Accept-Charset": "iso-8859-1"},
+		} {
+			res := doNegotiate(se, "/search?q=lion", headers)
+			Expect(res.Status).To(Equal(http.StatusNotAcceptable), "%v", headers)
+			Expect(res.ContentType).To(Equal(searchAPI.MediaTypeJSON))
+
+			var body struct {
+				Error     searchAPI.APIError `json:"error"`
+				Supported []string           `json:"supported"`
+			}
+			Expect(json.Unmarshal(res.Body, &body)).To(Succeed())
+			Expect(body.Error.Code).To(Equal("not_acceptable"))
+			Expect(body.Supported).To(Equal([]string{searchAPI.MediaTypeJSON, searchAPI.MediaTypeNDJSON}))
+		}
+	})
+
+	It("accepts UTF-8", func() {
+		res := doNegotiate(se, "/search?q=lion", map[string]string{"Accept-Charset": "iso-8859-1;q=0.9, utf-8"})
+		Expect(res.Status).To(Equal(http.StatusOK))
+	})
+
+	It("encodes the errors in the negotiated media type", func() {
+		res := doNegotiate(se, "/search", map[string]string{"Accept": "application/x-ndjson"})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.ContentType).To(Equal(searchAPI.MediaTypeNDJSON))
+		Expect(bytes.Count(res.Body, []byte("\n"))).To(Equal(1), "an NDJSON error is a single line")
+
+		var resp searchAPI.Response
+		Expect(json.Unmarshal(res.Body, &resp)).To(Succeed())
+		Expect(resp.Error).NotTo(BeNil())
+
+		res = doNegotiate(se, "/nowhere", map[string]string{"Accept": "application/x-ndjson"})
+		Expect(res.Status).To(Equal(http.StatusNotFound))
+		Expect(res.ContentType).To(Equal(searchAPI.MediaTypeNDJSON))
+	})
+
+	It("serves the cached bodies in the negotiated media type", func() {
+		cached := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{CacheBodies: true}})))
+		DeferCleanup(cached.Close)
+
+		first := doNegotiate(cached, "/search?q=lion", nil)
+		second := doNegotiate(cached, "/search?q=lion", map[string]string{"Accept": "application/x-ndjson"})
+		Expect(second.ContentType).To(Equal(searchAPI.MediaTypeNDJSON))
+		Expect(first.ContentType).To(Equal(searchAPI.MediaTypeJSON))
+	})
+
+	It("uses the registered encoders", func() {
+		text := searchAPI.ResponseEncoder{
+			MediaType: "text/plain",
+			Encode: func(buf *bytes.Buffer, payload any) error {
+				if resp, ok := payload.(searchAPI.Response); ok && resp.Error == nil {
+					buf.WriteString(strings.Join(collectionIDs(resp.ImageCollections), " "))
+					return nil
+				}
+				buf.WriteString("error")
+				return nil
+			},
+		}
+		is, vs := initSampleStores()
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs, searchAPI.WithResponseEncoder(text))
+		plain := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(plain.Close)
+
+		res := doNegotiate(plain, "/search?q=lion", map[string]string{"Accept": "text/plain"})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.ContentType).To(Equal("text/plain"))
+		Expect(strings.Fields(string(res.Body))).To(ContainElements("X", "Y"))
+
+		res = doNegotiate(plain, "/search", map[string]string{"Accept": "text/plain"})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(string(res.Body)).To(Equal("error"))
+	})
+})
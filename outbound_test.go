@@ -0,0 +1,67 @@
+package inkinspot_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// outboundClients returns the places of the sources which make their own HTTP clients instead of httpx.NewClient:
+// the default client & transport of net/http and the http.Client literals.
+func outboundClients(root string) []string {
+	GinkgoHelper()
+	var found []string
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "httpx" || d.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			var sel *ast.SelectorExpr
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if n.Sel.Name == "DefaultClient" || n.Sel.Name == "DefaultTransport" {
+					sel = n
+				}
+			case *ast.CompositeLit:
+				if s, ok := n.Type.(*ast.SelectorExpr); ok && s.Sel.Name == "Client" {
+					sel = s
+				}
+			}
+			if sel == nil {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "http" {
+				found = append(found, fset.Position(n.Pos()).String())
+			}
+			return true
+		})
+		return nil
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	return found
+}
+
+var _ = Describe("Outbound clients", func() {
+	It("are all made by httpx", func() {
+		Expect(outboundClients(".")).To(BeEmpty(), "use httpx.NewClient, the defaults of net/http have no timeouts")
+	})
+})
@@ -0,0 +1,160 @@
+package inkinspot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PagePolicy holds the limits of the search pagination.
+type PagePolicy struct {
+	// DefaultLimit is the page size when none is requested, every match is served when it's 0.
+	DefaultLimit int
+	// MaxLimit caps the requested page size.
+	MaxLimit int
+	// MaxOffset caps how deep the pages go.
+	MaxOffset int
+	// StorePageSize is the number of IDs asked of a VectorStorePager at once.
+	StorePageSize int
+	// Overshoot multiplies the matches fetched from a VectorStorePager past the end of the page.
+	// The reranking & the filters may drop or reorder some of them.
+	Overshoot float64
+}
+
+func (p PagePolicy) withDefaults() PagePolicy {
+	if p.MaxLimit <= 0 {
+		p.MaxLimit = 100
+	}
+	if p.MaxOffset <= 0 {
+		p.MaxOffset = 10000
+	}
+	if p.StorePageSize <= 0 {
+		p.StorePageSize = 100
+	}
+	if p.Overshoot < 1 {
+		p.Overshoot = 2
+	}
+
+	return p
+}
+
+// page resolves the requested page into its offset & limit, a 0 limit holds every match past the offset.
+func (p PagePolicy) page(offset, limit int) (int, int, error) {
+	if limit == 0 {
+		limit = p.DefaultLimit
+	}
+	if limit < 0 || limit > p.MaxLimit {
+		return 0, 0, fmt.Errorf("%w: limit must be within 1 and %d", ErrInvalidPage, p.MaxLimit)
+	}
+	if offset < 0 || offset > p.MaxOffset {
+		return 0, 0, fmt.Errorf("%w: offset must be within 0 and %d", ErrInvalidPage, p.MaxOffset)
+	}
+
+	return offset, limit, nil
+}
+
+// VectorStorePager is implemented by the vector stores.
+// Which can list the matches of a query a page at a time, in the order of GetIDsByQuery.
+// The cursor resumes after the page it was returned with, empty for the first page.
+// The next cursor is empty after the last page.
+type VectorStorePager interface {
+	GetIDsByQueryPage(ctx context.Context, query string, cursor string, limit int) (ids []string, next string, err error)
+}
+
+// storeWant returns how many matches of the query are fetched for the page, 0 for all of them.
+// The store is only cut short when the engine serves its matches in its order & the store counts the rest.
+// The reranked matches may promote any of them, the pages resumed by a cursor need every match up to it.
+func (e *SearchEngine) storeWant(plan searchPlan) int {
+	if plan.cursor != nil || plan.opts.Limit == 0 || !e.keepsStoreOrder(plan) || !storeCountable(plan.queries, plan.opts) {
+		return 0
+	}
+	if _, ok := storeAs[IDCounter](e.vectorStore); !ok {
+		return 0
+	}
+
+	return int(math.Ceil(float64(plan.opts.Offset+plan.opts.Limit) * e.configuration.PagePolicy.Overshoot))
+}
+
+// keepsStoreOrder reports whether the matches of the plan are served in the order of the vector store.
+// Nothing reranks them: no vector lookup, weights, boosts, experiment or popularity.
+func (e *SearchEngine) keepsStoreOrder(plan searchPlan) bool {
+	if _, ok := storeAs[VectorLookup](e.vectorStore); ok {
+		return false
+	}
+
+	return plan.opts.Weights == (WeightOverrides{}) && len(plan.settings.boosts) == 0 &&
+		plan.opts.Experiment.Variant == "" && plan.ranking.PopularityBoost <= 0
+}
+
+// storeCountable reports whether the store count of the queries is the total of the search, nothing filters its matches.
+func storeCountable(queries []ParsedQuery, opts SearchOptions) bool {
+	return len(queries) == 1 && opts.MinScore <= 0 && opts.Artist == "" && opts.Near == nil && len(opts.Filters) == 0
+}
+
+// IDCounter is implemented by the vector stores.
+// Which can count the matches of a query without listing them.
+// Stores capping GetIDsByQuery report the uncapped total through it.
+type IDCounter interface {
+	CountIDsByQuery(ctx context.Context, query string) (int, error)
+}
+
+// countMatches returns the total of the matches the page is taken from.
+// The store count is only used when the engine doesn't rerank or filter its matches,
+// or when the matches were cut short by the pages of the store, which only happens when it counts them.
+// The hidden matches dropped are taken off the store count, the ones past the matches listed can't be.
+// Otherwise it's the number of ranked matches.
+func (e *SearchEngine) countMatches(ctx context.Context, queries []ParsedQuery, ranked []RankedVector, opts SearchOptions, truncated bool, hidden int) (int, error) {
+	counter, ok := storeAs[IDCounter](e.vectorStore)
+	if _, reranked := storeAs[VectorLookup](e.vectorStore); !ok || (reranked && !truncated) || !storeCountable(queries, opts) {
+		return len(ranked), nil
+	}
+
+	vcCtx, vcCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vcCancel()
+
+	n, err := counter.CountIDsByQuery(vcCtx, strings.Join(queries[0].Stems, " "))
+	if err != nil {
+		return 0, e.storeError(VectorStoreName, "count", err)
+	}
+
+	return max(n-hidden, len(ranked)), nil
+}
+
+// paginate returns the ranked matches of the page, the ones past the offset for a 0 limit.
+func paginate(ranked []RankedVector, offset, limit int) []RankedVector {
+	if offset >= len(ranked) {
+		return nil
+	}
+	if limit == 0 {
+		return ranked[offset:]
+	}
+
+	return ranked[offset:min(offset+limit, len(ranked))]
+}
+
+// parsePage reads the offset & limit query parameters, 0 when absent.
+func parsePage(rawOffset, rawLimit string) (int, int, error) {
+	var offset, limit int
+	for _, p := range []struct {
+		name   string
+		raw    string
+		target *int
+	}{
+		{"offset", rawOffset, &offset},
+		{"limit", rawLimit, &limit},
+	} {
+		if p.raw == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(p.raw)
+		if err != nil || (p.name == "limit" && n < 1) {
+			return 0, 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidPage, p.name)
+		}
+		*p.target = n
+	}
+
+	return offset, limit, nil
+}
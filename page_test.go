@@ -0,0 +1,439 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// pagedIDs are ranked in order by their descending lion proximity.
+var pagedIDs = []string{"A", "B", "C", "D", "E"}
+
+// initPagedServer serves the paged IDs, except the ones missing from the image store.
+func initPagedServer(missing ...string) *httptest.Server {
+	GinkgoHelper()
+	is := searchAPI.NewMemoryImageStore()
+	vs := searchAPI.NewMemoryVectorStore()
+	for i, id := range pagedIDs {
+		v := searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": float64(50 - i*10)}}
+		Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		if !slices.Contains(missing, id) {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+	}
+
+	se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+	DeferCleanup(se.Close)
+
+	return se
+}
+
+// countingVectorStore caps the listed IDs but counts them all.
+type countingVectorStore struct {
+	ids []string
+	cap int
+}
+
+func (vs countingVectorStore) GetIDsByQuery(ctx context.Context, q string) ([]string, error) {
+	return vs.ids[:vs.cap], nil
+}
+
+func (vs countingVectorStore) CountIDsByQuery(ctx context.Context, q string) (int, error) {
+	return len(vs.ids), nil
+}
+
+// unpagedVectorStore hides the store pages of the memory store.
+type unpagedVectorStore struct {
+	*searchAPI.MemoryVectorStore
+}
+
+func (vs unpagedVectorStore) GetIDsByQueryPage() {}
+
+// pageCountingVectorStore lists & counts the matches of the memory store without its vectors,
+// counting the store pages it's asked for.
+type pageCountingVectorStore struct {
+	vs    *searchAPI.MemoryVectorStore
+	pages *atomic.Int64
+}
+
+func (s pageCountingVectorStore) GetIDsByQuery(ctx context.Context, q string) ([]string, error) {
+	return s.vs.GetIDsByQuery(ctx, q)
+}
+
+func (s pageCountingVectorStore) GetIDsByQueryPage(ctx context.Context, q, cursor string, limit int) ([]string, string, error) {
+	s.pages.Add(1)
+	return s.vs.GetIDsByQueryPage(ctx, q, cursor, limit)
+}
+
+func (s pageCountingVectorStore) CountIDsByQuery(ctx context.Context, q string) (int, error) {
+	ids, err := s.vs.GetIDsByQuery(ctx, q)
+	return len(ids), err
+}
+
+// listedVectorStore matches its listed IDs for every query, without their vectors.
+type listedVectorStore struct {
+	ids *[]string
+}
+
+func (vs listedVectorStore) GetIDsByQuery(ctx context.Context, q string) ([]string, error) {
+	return slices.Clone(*vs.ids), nil
+}
+
+var _ = Describe("Pagination", func() {
+	DescribeTable("total & has_more",
+		func(offset, limit string, ids []string, hasMore bool) {
+			se := initPagedServer()
+			res := doSearch(se, url.Values{"q": {"lion"}, "offset": {offset}, "limit": {limit}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ids))
+			Expect(res.JSON.Total).To(Equal(5))
+			Expect(res.JSON.HasMore).To(Equal(hasMore))
+		},
+		Entry("first page", "0", "2", []string{"A", "B"}, true),
+		Entry("page ending before the last match", "2", "2", []string{"C", "D"}, true),
+		Entry("page ending at the last match", "3", "2", []string{"D", "E"}, false),
+		Entry("page past the last match", "4", "2", []string{"E"}, false),
+		Entry("whole results in one page", "0", "5", []string{"A", "B", "C", "D", "E"}, false),
+		Entry("offset at the total", "5", "2", []string{}, false),
+	)
+
+	It("pages by the ranked matches when the image store misses collections", func() {
+		se := initPagedServer("B")
+		res := doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"A"}))
+		Expect(res.JSON.Total).To(Equal(5))
+		Expect(res.JSON.HasMore).To(BeTrue())
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "offset": {"2"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"C", "D"}))
+	})
+
+	It("serves an empty page when the image store misses its collections", func() {
+		se := initPagedServer("B")
+		res := doSearch(se, url.Values{"q": {"lion"}, "offset": {"1"}, "limit": {"1"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.ImageCollections).To(BeEmpty())
+		Expect(res.JSON.Total).To(Equal(5))
+		Expect(res.JSON.HasMore).To(BeTrue())
+	})
+
+	It("counts & pages the matches without the hidden collections", func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for i, id := range []string{"A", "B", "C"} {
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": float64(50 - i*10)}})).To(Succeed())
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, Hidden: id == "B"})).To(Succeed())
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "limit": {"1"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"A"}))
+		Expect(res.JSON.Total).To(Equal(2))
+		Expect(res.JSON.HasMore).To(BeTrue())
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "offset": {"1"}, "limit": {"1"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"C"}))
+		Expect(res.JSON.Total).To(Equal(2))
+		Expect(res.JSON.HasMore).To(BeFalse())
+	})
+
+	It("serves every match when no limit is requested", func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for i := range 150 {
+			id := fmt.Sprintf("c%03d", i)
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": 1}})).To(Succeed())
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"q": {"lion"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.ImageCollections).To(HaveLen(150))
+		Expect(res.JSON.Total).To(Equal(150))
+		Expect(res.JSON.HasMore).To(BeFalse())
+	})
+
+	It("takes the total from a vector store which can count", func() {
+		is := inkinspottest.NewFakeImageStore(searchAPI.TattooImagesCollection{ID: "a"}, searchAPI.TattooImagesCollection{ID: "b"})
+		vs := countingVectorStore{ids: []string{"a", "b", "c", "d"}, cap: 2}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Total).To(Equal(4))
+		Expect(res.JSON.HasMore).To(BeTrue())
+	})
+
+	DescribeTable("invalid pages return a 400 Bad Request",
+		func(offset, limit string) {
+			se := initPagedServer()
+			res := doSearch(se, url.Values{"q": {"lion"}, "offset": {offset}, "limit": {limit}})
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("invalid_page"))
+		},
+		Entry("zero limit", "0", "0"),
+		Entry("limit above the cap", "0", "101"),
+		Entry("negative offset", "-1", "2"),
+		Entry("non numeric limit", "0", "all"),
+	)
+})
+
+var _ = Describe("Store pages", func() {
+	var (
+		paged, unpaged *httptest.Server
+		pages          *atomic.Int64
+	)
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for i, id := range pagedIDs {
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": float64(50 - i*10)}})).To(Succeed())
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+		cfg := searchAPI.Configuration{PagePolicy: searchAPI.PagePolicy{StorePageSize: 1, Overshoot: 1}}
+		pages = &atomic.Int64{}
+		paged = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, pageCountingVectorStore{vs, pages})))
+		DeferCleanup(paged.Close)
+		unpaged = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, unpagedVectorStore{vs})))
+		DeferCleanup(unpaged.Close)
+	})
+
+	DescribeTable("serve the pages of the unpaged store",
+		func(offset, limit string) {
+			params := url.Values{"q": {"lion"}, "offset": {offset}, "limit": {limit}}
+			want := doSearch(unpaged, params)
+			got := doSearch(paged, params)
+			Expect(got.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(got.JSON.ImageCollections)).To(Equal(collectionIDs(want.JSON.ImageCollections)))
+			Expect(got.JSON.Total).To(Equal(want.JSON.Total))
+			Expect(got.JSON.HasMore).To(Equal(want.JSON.HasMore))
+		},
+		Entry("first page", "0", "2"),
+		Entry("middle page", "2", "2"),
+		Entry("last page", "3", "2"),
+	)
+
+	It("stops listing the store once the page is filled", func() {
+		res := doSearch(paged, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"A", "B"}))
+		Expect(res.JSON.HasMore).To(BeTrue())
+		Expect(pages.Load()).To(Equal(int64(2)))
+	})
+
+	It("lists the whole matches when the weights rerank them", func() {
+		doSearch(paged, url.Values{"q": {"lion"}, "limit": {"2"}, "w_area": {"2"}})
+		Expect(pages.Load()).To(BeZero())
+	})
+
+	It("lists the whole matches for a cursor", func() {
+		res := doSearch(paged, url.Values{"q": {"lion"}, "limit": {"2"}})
+		pages.Store(0)
+
+		res = doSearch(paged, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"C", "D"}))
+		Expect(pages.Load()).To(BeZero())
+	})
+})
+
+var _ = Describe("Store pages of a reranking store", func() {
+	It("serves the pages of the unpaged store when the weights promote a later match", func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		vectors := []searchAPI.TattooImagesVector{{ID: "Z", Area: searchAPI.LabelSet{"lion": 1}}}
+		for i := range 300 {
+			vectors = append(vectors, searchAPI.TattooImagesVector{ID: fmt.Sprintf("s%03d", i), Subject: searchAPI.LabelSet{"lion": 1}})
+		}
+		for _, v := range vectors {
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+		}
+		cfg := searchAPI.Configuration{PagePolicy: searchAPI.PagePolicy{StorePageSize: 1, Overshoot: 1}}
+		paged := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(paged.Close)
+		unpaged := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, unpagedVectorStore{vs})))
+		DeferCleanup(unpaged.Close)
+
+		params := url.Values{"q": {"lion"}, "limit": {"2"}, "w_subject": {"0.01"}, "w_area": {"1"}}
+		want := doSearch(unpaged, params)
+		Expect(collectionIDs(want.JSON.ImageCollections)).To(Equal([]string{"Z", "s000"}))
+		Expect(want.JSON.Total).To(Equal(301))
+
+		got := doSearch(paged, params)
+		Expect(got.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(got.JSON.ImageCollections)).To(Equal(collectionIDs(want.JSON.ImageCollections)))
+		Expect(got.JSON.Total).To(Equal(want.JSON.Total))
+		Expect(got.JSON.HasMore).To(Equal(want.JSON.HasMore))
+	})
+})
+
+var _ = Describe("Cursor pagination", func() {
+	var (
+		se *httptest.Server
+		is *searchAPI.MemoryImageStore
+		vs *searchAPI.MemoryVectorStore
+	)
+
+	add := func(id string, proximity float64) {
+		GinkgoHelper()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": proximity}})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		// C & D tie, they are ordered by ID.
+		add("A", 50)
+		add("B", 40)
+		add("D", 30)
+		add("C", 30)
+		add("E", 10)
+
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("resumes after the cursor position when the catalog changes", func() {
+		res := doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"A", "B"}))
+		Expect(res.JSON.NextCursor).NotTo(BeEmpty())
+
+		// AA ranks before the cursor & BB after it.
+		add("AA", 100)
+		add("BB", 35)
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"BB", "C"}))
+		Expect(res.JSON.HasMore).To(BeTrue())
+
+		res = doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"D", "E"}))
+		Expect(res.JSON.HasMore).To(BeFalse())
+		Expect(res.JSON.NextCursor).To(BeEmpty())
+	})
+
+	It("resumes after the cursor ID in a store without vectors when the catalog changes", func() {
+		ids := []string{"A", "B", "C", "D"}
+		for _, id := range append(ids, "X") {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+		listed := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, listedVectorStore{&ids})))
+		DeferCleanup(listed.Close)
+
+		res := doSearch(listed, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"A", "B"}))
+
+		ids = append([]string{"X"}, ids...)
+		res = doSearch(listed, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"C", "D"}))
+		Expect(res.JSON.HasMore).To(BeFalse())
+	})
+
+	It("rejects the cursors once the boosts changed", func() {
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs)
+		boosted := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(boosted.Close)
+
+		res := doSearch(boosted, url.Values{"q": {"lion"}, "limit": {"2"}})
+		Expect(res.JSON.NextCursor).NotTo(BeEmpty())
+
+		Expect(engine.SetBoosts(searchAPI.BoostTable{"lion": 2})).To(Succeed())
+		res = doSearch(boosted, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {res.JSON.NextCursor}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_cursor"))
+	})
+
+	It("ranks the following pages as of the first one", func() {
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := inkinspottest.NewFakeClock(now)
+		// F outranks A while it is fresh & falls behind C & D a day later.
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "F"})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "F", Subject: searchAPI.LabelSet{"lion": 20}, CreatedAt: now})).To(Succeed())
+		cfg := searchAPI.Configuration{FreshnessPolicy: searchAPI.FreshnessPolicy{Boost: 2, HalfLife: time.Hour}}
+		fresh := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(fresh.Close)
+
+		var ids []string
+		params := url.Values{"q": {"lion"}, "limit": {"2"}}
+		for {
+			res := doSearch(fresh, params)
+			Expect(res.Status).To(Equal(http.StatusOK))
+			ids = append(ids, collectionIDs(res.JSON.ImageCollections)...)
+			if res.JSON.NextCursor == "" {
+				break
+			}
+			clock.Advance(24 * time.Hour)
+			params.Set("cursor", res.JSON.NextCursor)
+		}
+		Expect(ids).To(Equal([]string{"F", "A", "B", "C", "D", "E"}))
+	})
+
+	It("rejects the popularity cursors once new feedback arrived", func() {
+		cfg := searchAPI.Configuration{RankingPolicy: searchAPI.RankingPolicy{PopularityBoost: 1}}
+		popular := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(popular.Close)
+
+		resp, err := popular.Client().Get(popular.URL + "/search?q=lion&limit=2")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		var page searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&page)).To(Succeed())
+		Expect(page.NextCursor).NotTo(BeEmpty())
+
+		body := fmt.Sprintf(`{"feedback_id": %q, "collection_id": "A", "action": "click"}`, resp.Header.Get(searchAPI.FeedbackIDHeader))
+		fb, err := popular.Client().Post(popular.URL+"/feedback", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		fb.Body.Close()
+		Expect(fb.StatusCode).To(Equal(http.StatusNoContent))
+
+		res := doSearch(popular, url.Values{"q": {"lion"}, "limit": {"2"}, "cursor": {page.NextCursor}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_cursor"))
+	})
+
+	DescribeTable("invalid cursors return a 400 Bad Request",
+		func(params func(cursor string) url.Values, code string) {
+			res := doSearch(se, url.Values{"q": {"lion"}, "limit": {"2"}})
+			Expect(res.JSON.NextCursor).NotTo(BeEmpty())
+
+			res = doSearch(se, params(res.JSON.NextCursor))
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal(code))
+		},
+		Entry("from another query", func(cursor string) url.Values {
+			return url.Values{"q": {"lion tiger"}, "cursor": {cursor}}
+		}, "invalid_cursor"),
+		Entry("with a forged signature", func(cursor string) url.Values {
+			payload, _, _ := strings.Cut(cursor, ".")
+			return url.Values{"q": {"lion"}, "cursor": {payload + ".AAAA"}}
+		}, "invalid_cursor"),
+		Entry("malformed", func(cursor string) url.Values {
+			return url.Values{"q": {"lion"}, "cursor": {"garbage"}}
+		}, "invalid_cursor"),
+		Entry("combined with an offset", func(cursor string) url.Values {
+			return url.Values{"q": {"lion"}, "offset": {"2"}, "cursor": {cursor}}
+		}, "invalid_page"),
+	)
+})
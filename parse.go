@@ -0,0 +1,173 @@
+package inkinspot
+
+import (
+	"strings"
+)
+
+// ParsedQuery is a query after normalization & the language rules.
+type ParsedQuery struct {
+	// Text is the normalized query text.
+	Text string `json:"text"`
+	// Lang is the tag of the language rules applied, "und" when none.
+	Lang string `json:"lang"`
+	// Terms are the query tokens left after the stopwords, rules & synonyms.
+	// A quoted phrase is a single term.
+	Terms []string `json:"terms"`
+	// Stems are the stems of the terms which are matched against the labels.
+	// A phrase stem holds the stems of its words separated by spaces.
+	Stems []string `json:"stems"`
+	// Phrases are the quoted segments of the text.
+	Phrases []QueryPhrase `json:"phrases,omitempty"`
+	// Corrections are the stems replaced by fuzzy matching.
+	Corrections []TermCorrection `json:"corrections,omitempty"`
+	// Expr is the boolean expression of the query, empty for plain queries.
+	Expr string `json:"expr,omitempty"`
+
+	expr queryExpr
+}
+
+// QueryPhrase is a quoted segment, Start & End are its byte offsets in the text.
+type QueryPhrase struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// correctionDistance returns the largest edit distance among the stems.
+func (q ParsedQuery) correctionDistance(stems []string) int {
+	d := 0
+	for _, c := range q.Corrections {
+		for _, s := range stems {
+			if s == c.Correction {
+				d = max(d, c.Distance)
+			}
+		}
+	}
+
+	return d
+}
+
+// matchesLabel reports whether the query stems match the label stems.
+// Either as consecutive word stems or as a phrase unit equal to the label.
+func matchesLabel(queryStems, labelStems []string) bool {
+	joined := strings.Join(labelStems, " ")
+	for _, s := range queryStems {
+		if s == joined {
+			return true
+		}
+	}
+
+	return containsPhrase(queryStems, labelStems)
+}
+
+// parseQuery splits a normalized query into terms & stems by the analyzer.
+// Synonyms replace whole words or whole phrases, before they are stemmed.
+// Boolean queries are parsed into an expression, see parseBooleanQuery.
+func parseQuery(text string, a Analyzer, synonyms map[string]string, boolean bool) (ParsedQuery, error) {
+	if boolean {
+		return parseBooleanQuery(text, a, synonyms)
+	}
+
+	pq := ParsedQuery{Text: text, Lang: a.language().Tag}
+	pq.addTerms(tokenizeQuery(text), a, synonyms)
+
+	return pq, nil
+}
+
+// addTerms appends the terms & stems of the word & phrase tokens.
+// It returns the stems which were added.
+func (pq *ParsedQuery) addTerms(tokens []queryToken, a Analyzer, synonyms map[string]string) []string {
+	var added []string
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokenWord:
+			for _, term := range a.terms(tok.text) {
+				if syn, ok := synonyms[term]; ok {
+					term = syn
+				}
+				stem := strings.Join(a.Analyze(term), " ")
+				pq.Terms = append(pq.Terms, term)
+				pq.Stems = append(pq.Stems, stem)
+				added = append(added, stem)
+			}
+		case tokenPhrase:
+			phrase := strings.Join(strings.Fields(tok.text), " ")
+			if phrase == "" {
+				continue
+			}
+			pq.Phrases = append(pq.Phrases, QueryPhrase{Text: phrase, Start: tok.start, End: tok.end})
+
+			term := phrase
+			if syn, ok := synonyms[phrase]; ok {
+				term = syn
+			}
+			if stems := a.Analyze(term); len(stems) > 0 {
+				stem := strings.Join(stems, " ")
+				pq.Terms = append(pq.Terms, term)
+				pq.Stems = append(pq.Stems, stem)
+				added = append(added, stem)
+			}
+		}
+	}
+
+	return added
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+)
+
+// queryToken is a whitespace separated word, a quoted phrase or a parenthesis.
+// Start & End are the byte offsets of its text in the query.
+type queryToken struct {
+	kind       tokenKind
+	text       string
+	start, end int
+}
+
+// tokenizeQuery splits the query into words, double quoted phrases & parentheses.
+// Inside a phrase \" is a literal quote, an unterminated phrase runs to the end.
+func tokenizeQuery(s string) []queryToken {
+	var out []queryToken
+
+	i := 0
+	for i < len(s) {
+		switch {
+		case s[i] == ' ':
+			i++
+		case s[i] == '(':
+			out = append(out, queryToken{kind: tokenOpen, text: "(", start: i, end: i + 1})
+			i++
+		case s[i] == ')':
+			out = append(out, queryToken{kind: tokenClose, text: ")", start: i, end: i + 1})
+			i++
+		case s[i] == '"':
+			start := i + 1
+			var b strings.Builder
+			j := start
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' && j+1 < len(s) && s[j+1] == '"' {
+					j++
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			out = append(out, queryToken{kind: tokenPhrase, text: b.String(), start: start, end: j})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(` "()`, rune(s[j])) {
+				j++
+			}
+			out = append(out, queryToken{kind: tokenWord, text: s[i:j], start: i, end: j})
+			i = j
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,95 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query parsing", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		cfg := searchAPI.Configuration{QueryPolicy: searchAPI.QueryPolicy{
+			Synonyms: map[string]string{"black and white": "bw"},
+		}}
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+	})
+
+	AfterEach(func() {
+		se.Close()
+	})
+
+	explain := func(q string) HTTPResult {
+		GinkgoHelper()
+		res := doSearch(se, url.Values{"q": {q}, "explain": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+
+		return res
+	}
+
+	Context("Quoted phrases", func() {
+		It("maps a quoted phrase through the synonyms as a unit", func() {
+			pq := explain(`"black and white" lion`).JSON.Explain.Queries[0]
+			Expect(pq.Terms).To(Equal([]string{"bw", "lion"}))
+			Expect(pq.Phrases).To(Equal([]searchAPI.QueryPhrase{{Text: "black and white", Start: 1, End: 16}}))
+		})
+
+		It("maps the quoted phrase through the default synonyms", func() {
+			defaults := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+			DeferCleanup(defaults.Close)
+
+			res := doSearch(defaults, url.Values{"q": {`"black and white" lion`}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.Explain.Queries[0].Terms).To(Equal([]string{"bw", "lion"}))
+			Expect(collectionIDs(res.JSON.ImageCollections)[0]).To(Equal("X"))
+		})
+
+		It("matches the words of an unquoted phrase independently", func() {
+			pq := explain(`black and white lion`).JSON.Explain.Queries[0]
+			Expect(pq.Terms).To(Equal([]string{"black", "white", "lion"}))
+			Expect(pq.Phrases).To(BeEmpty())
+		})
+
+		It("scores the quoted synonym above the unquoted words", func() {
+			quoted := explain(`"black and white" lion`).JSON
+			Expect(collectionIDs(quoted.ImageCollections)).To(HaveExactElements("X", Or(Equal("Y"), Equal("Z")), Or(Equal("Y"), Equal("Z"))))
+			Expect(quoted.Explain.Hits[0].RawScore).To(BeNumerically("==", 200))
+
+			unquoted := explain(`black and white lion`).JSON
+			Expect(collectionIDs(unquoted.ImageCollections)).To(Equal([]string{"X", "Y"}))
+			Expect(unquoted.Explain.Hits[0].RawScore).To(BeNumerically("==", 100))
+		})
+
+		It("doesn't match the words of a phrase against separate labels", func() {
+			res := explain(`"lion chest"`)
+			Expect(res.JSON.ImageCollections).To(BeEmpty())
+
+			res = explain(`lion chest`)
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y", "Z"}))
+		})
+
+		It("runs an unterminated phrase to the end of the query", func() {
+			pq := explain(`lion "black and white`).JSON.Explain.Queries[0]
+			Expect(pq.Terms).To(Equal([]string{"lion", "bw"}))
+			Expect(pq.Phrases).To(Equal([]searchAPI.QueryPhrase{{Text: "black and white", Start: 6, End: 21}}))
+		})
+
+		It("keeps escaped quotes inside a phrase", func() {
+			pq := explain(`"12\" needle" lion`).JSON.Explain.Queries[0]
+			Expect(pq.Phrases[0].Text).To(Equal(`12" needle`))
+			Expect(pq.Terms).To(Equal([]string{`12" needle`, "lion"}))
+		})
+
+		It("ignores empty phrases", func() {
+			pq := explain(`"" lion`).JSON.Explain.Queries[0]
+			Expect(pq.Terms).To(Equal([]string{"lion"}))
+			Expect(pq.Phrases).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,166 @@
+package inkinspot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// VectorSwapper is implemented by the vector stores.
+// Which can replace a vector only while it's still at a version, the new one is at the next version.
+// SwapVector returns ErrVersionConflict when the stored vector is at another version or gone.
+type VectorSwapper interface {
+	SwapVector(ctx context.Context, v TattooImagesVector, version uint64) error
+}
+
+// VectorPatch edits the labels of a vector by facet.
+// A nil proximity removes the label, others add or replace it.
+type VectorPatch struct {
+	Style   map[string]*float64 `json:"style"`
+	Subject map[string]*float64 `json:"subject"`
+	Area    map[string]*float64 `json:"area"`
+}
+
+// apply returns the vector with the edits, the label sets of the vector aren't modified.
+func (p VectorPatch) apply(v TattooImagesVector) TattooImagesVector {
+	edit := func(ls LabelSet, edits map[string]*float64) LabelSet {
+		if len(edits) == 0 {
+			return ls
+		}
+		out := maps.Clone(ls)
+		if out == nil {
+			out = make(LabelSet, len(edits))
+		}
+		for label, proximity := range edits {
+			if proximity == nil {
+				delete(out, label)
+				continue
+			}
+			out[label] = *proximity
+		}
+		return out
+	}
+
+	v.Style = edit(v.Style, p.Style)
+	v.Subject = edit(v.Subject, p.Subject)
+	v.Area = edit(v.Area, p.Area)
+
+	return v
+}
+
+// PatchVector edits the labels of the stored vector of the ID, by read-modify-write.
+// A non-zero version must be the stored one's, the patch returns ErrVersionConflict otherwise.
+// It returns ErrVersionConflict as well when the vector is written meanwhile.
+func (e *SearchEngine) PatchVector(ctx context.Context, id string, patch VectorPatch, version uint64) (TattooImagesVector, error) {
+	swapper, ok := storeAs[VectorSwapper](e.vectorStore)
+	if !ok {
+		return TattooImagesVector{}, ErrPatchUnsupported
+	}
+
+	current, err := e.Vector(ctx, id)
+	if errors.Is(err, ErrLookupUnsupported) {
+		return TattooImagesVector{}, ErrPatchUnsupported
+	}
+	if err != nil {
+		return TattooImagesVector{}, err
+	}
+	if version != 0 && current.Version != version {
+		return TattooImagesVector{}, fmt.Errorf("%w: %s is at version %d", ErrVersionConflict, id, current.Version)
+	}
+
+	patched := patch.apply(current)
+	if err := validateLabels(patched); err != nil {
+		return TattooImagesVector{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+
+	inv := e.newCacheInvalidation()
+	inv.addVector(current)
+	inv.addVector(patched)
+
+	vsCtx, vsCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vsCancel()
+
+	if err := swapper.SwapVector(vsCtx, patched, current.Version); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			return TattooImagesVector{}, err
+		}
+		return TattooImagesVector{}, e.storeError(VectorStoreName, "swap", err)
+	}
+	e.invalidate(inv)
+	patched.Version = current.Version + 1
+
+	return patched, nil
+}
+
+// vectorETag returns the entity tag of the version of a vector, none when it's unversioned.
+func vectorETag(v TattooImagesVector) string {
+	return versionETag(v.Version)
+}
+
+// versionETag returns the entity tag of a version, none for the zero version.
+func versionETag(version uint64) string {
+	if version == 0 {
+		return ""
+	}
+
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// parseIfMatch reads the version of the If-Match header, zero without one or for any version.
+func parseIfMatch(r *http.Request) (uint64, error) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" || raw == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(raw, `"`), 10, 64)
+	if err != nil || version == 0 {
+		return 0, fmt.Errorf("%w: If-Match %q", ErrInvalidVersion, raw)
+	}
+
+	return version, nil
+}
+
+// handleVectorPatch edits the labels of the vector of the ID in the path.
+// The If-Match header holds the version the edits apply to.
+func handleVectorPatch(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseIfMatch(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_version", "If-Match must be the ETag of the vector")
+			return
+		}
+
+		var patch VectorPatch
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+
+		v, err := se.PatchVector(r.Context(), r.PathValue("id"), patch, version)
+		switch {
+		case err == nil:
+			se.recordAudit(w, r, AuditPatch, v.ID, fmt.Sprintf("version %d", v.Version-1), fmt.Sprintf("version %d", v.Version))
+			w.Header().Set("ETag", vectorETag(v))
+			se.setConsistencyToken(w)
+			writeJSON(w, http.StatusOK, v)
+		case errors.Is(err, ErrInvalidPatch):
+			writeError(w, http.StatusBadRequest, "invalid_patch", err.Error())
+		case errors.Is(err, ErrVectorNotFound):
+			writeError(w, http.StatusNotFound, "vector_not_found", err.Error())
+		case errors.Is(err, ErrVersionConflict):
+			writeError(w, http.StatusConflict, "version_conflict", err.Error())
+		case errors.Is(err, ErrPatchUnsupported):
+			writeError(w, http.StatusNotImplemented, "patch_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "vector_store_error", "vector store swap failed")
+		}
+	})
+}
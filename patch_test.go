@@ -0,0 +1,129 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doPatch patches the vector of the ID, with the If-Match header when etag isn't empty.
+func doPatch(se *httptest.Server, id, etag, body string) (int, string, searchAPI.TattooImagesVector) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodPatch, se.URL+"/tattoos/"+id+"/vector", strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var v searchAPI.TattooImagesVector
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&v)).To(Succeed())
+	}
+
+	return resp.StatusCode, resp.Header.Get("ETag"), v
+}
+
+var _ = Describe("Vector patches", func() {
+	var (
+		se *httptest.Server
+		vs *searchAPI.MemoryVectorStore
+	)
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{
+			ID:      "L",
+			Style:   searchAPI.LabelSet{"bw": 90, "realistic": 40},
+			Subject: searchAPI.LabelSet{"lion": 100},
+		})).To(Succeed())
+
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("adds, removes & changes labels", func() {
+		status, etag, v := doPatch(se, "L", `"1"`, `{"style": {"bw": null, "fineline": 80, "realistic": 60}}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(etag).To(Equal(`"2"`))
+		Expect(v.Style).To(Equal(searchAPI.LabelSet{"fineline": 80, "realistic": 60}))
+		Expect(v.Subject).To(Equal(searchAPI.LabelSet{"lion": 100}))
+		Expect(v.Version).To(BeEquivalentTo(2))
+
+		stored, err := vs.GetVectorsByID(context.Background(), []string{"L"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].Style).To(Equal(v.Style))
+		Expect(stored[0].Version).To(Equal(v.Version))
+	})
+
+	It("updates the index & the cached searches", func() {
+		Expect(collectionIDs(doSearch(se, url.Values{"q": {"bw"}}).JSON.ImageCollections)).To(Equal([]string{"L"}))
+		Expect(doSearch(se, url.Values{"q": {"fineline"}}).JSON.ImageCollections).To(BeEmpty())
+
+		status, _, _ := doPatch(se, "L", "", `{"style": {"bw": null, "fineline": 80}}`)
+		Expect(status).To(Equal(http.StatusOK))
+
+		Expect(doSearch(se, url.Values{"q": {"bw"}}).JSON.ImageCollections).To(BeEmpty())
+		Expect(collectionIDs(doSearch(se, url.Values{"q": {"fineline"}}).JSON.ImageCollections)).To(Equal([]string{"L"}))
+	})
+
+	It("answers 409 Conflict for a stale version", func() {
+		status, _, _ := doPatch(se, "L", `"1"`, `{"subject": {"tiger": 50}}`)
+		Expect(status).To(Equal(http.StatusOK))
+
+		status, _, _ = doPatch(se, "L", `"1"`, `{"subject": {"lion": null}}`)
+		Expect(status).To(Equal(http.StatusConflict))
+	})
+
+	It("lets a single one of concurrent patches of a version through", func() {
+		const patches = 8
+		statuses := make(chan int, patches)
+		var wg sync.WaitGroup
+		for range patches {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				status, _, _ := doPatch(se, "L", `"1"`, `{"area": {"arm": 10}}`)
+				statuses <- status
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		counts := map[int]int{}
+		for status := range statuses {
+			counts[status]++
+		}
+		Expect(counts).To(Equal(map[int]int{http.StatusOK: 1, http.StatusConflict: patches - 1}))
+	})
+
+	It("rejects invalid proximities & unknown IDs", func() {
+		status, _, _ := doPatch(se, "L", "", `{"style": {"bw": -1}}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _, _ = doPatch(se, "L", "", `{"colour": {"red": 1}}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _, _ = doPatch(se, "nope", "", `{"style": {"bw": 1}}`)
+		Expect(status).To(Equal(http.StatusNotFound))
+	})
+})
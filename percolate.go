@@ -0,0 +1,225 @@
+package inkinspot
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SavedSearch is a query whose owner is notified of the new tattoos it matches.
+// A tattoo matches when it scores above Threshold, by the raw score of the ranker.
+type SavedSearch struct {
+	ID        string  `json:"id"`
+	Owner     string  `json:"owner"`
+	Query     string  `json:"query"`
+	Lang      string  `json:"lang,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// SavedSearchSource lists the saved searches the ingested tattoos are matched against.
+type SavedSearchSource interface {
+	SavedSearches(ctx context.Context) ([]SavedSearch, error)
+}
+
+// Notification tells the owner of a saved search about a new tattoo it matches.
+type Notification struct {
+	Search     SavedSearch            `json:"search"`
+	Collection TattooImagesCollection `json:"collection"`
+	Score      float64                `json:"score"`
+	Time       time.Time              `json:"time"`
+}
+
+// Notifier delivers the notifications of the saved searches.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// PercolationPolicy bounds the matching of the ingested tattoos against the saved searches.
+// Zero values are replaced by the defaults.
+type PercolationPolicy struct {
+	// QueueSize is the number of ingested tattoos waiting to be matched, the ones past it are dropped.
+	QueueSize int
+	// NotifyTimeout bounds the delivery of a notification.
+	NotifyTimeout time.Duration
+}
+
+func (p PercolationPolicy) withDefaults() PercolationPolicy {
+	if p.QueueSize <= 0 {
+		p.QueueSize = 256
+	}
+	if p.NotifyTimeout <= 0 {
+		p.NotifyTimeout = 5 * time.Second
+	}
+
+	return p
+}
+
+// MemorySavedSearches keeps the saved searches in memory.
+type MemorySavedSearches struct {
+	mu       sync.RWMutex
+	searches map[string]SavedSearch
+}
+
+// NewMemorySavedSearches creates an in-memory source of the saved searches.
+func NewMemorySavedSearches(searches ...SavedSearch) *MemorySavedSearches {
+	s := &MemorySavedSearches{searches: make(map[string]SavedSearch, len(searches))}
+	for _, ss := range searches {
+		s.searches[ss.ID] = ss
+	}
+
+	return s
+}
+
+// Save adds or replaces the saved search of the ID.
+func (s *MemorySavedSearches) Save(ss SavedSearch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.searches[ss.ID] = ss
+}
+
+// Delete removes the saved search of the ID.
+func (s *MemorySavedSearches) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.searches, id)
+}
+
+// SavedSearches returns the saved searches ordered by ID.
+func (s *MemorySavedSearches) SavedSearches(ctx context.Context) ([]SavedSearch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]SavedSearch, 0, len(s.searches))
+	for _, ss := range s.searches {
+		out = append(out, ss)
+	}
+	slices.SortFunc(out, func(a, b SavedSearch) int { return strings.Compare(a.ID, b.ID) })
+
+	return out, nil
+}
+
+// WithSavedSearches sets the saved searches the ingested tattoos are matched against, none by default.
+func WithSavedSearches(s SavedSearchSource) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.savedSearches = s
+	}
+}
+
+// WithNotifier sets the delivery of the notifications of the saved searches, none by default.
+func WithNotifier(n Notifier) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.notifier = n
+	}
+}
+
+// percolator matches the ingested tattoos against the saved searches off the ingest path.
+// A goroutine is only started for an admitted tattoo, at most QueueSize at once.
+type percolator struct {
+	admitted chan struct{}
+	dropped  atomic.Int64
+
+	mu sync.Mutex
+	// parsed holds the parsed queries of the saved searches by ID, an edited search is parsed again.
+	parsed map[string]parsedSearch
+}
+
+// parsedSearch is the parsed queries of the query & language of a saved search.
+type parsedSearch struct {
+	query   string
+	lang    string
+	queries []ParsedQuery
+}
+
+func newPercolator(p PercolationPolicy) *percolator {
+	return &percolator{admitted: make(chan struct{}, p.QueueSize), parsed: make(map[string]parsedSearch)}
+}
+
+// percolate matches the ingested tattoo against the saved searches in the background.
+// The tattoo is dropped when the queue is full, the ingest never waits for it.
+func (e *SearchEngine) percolate(c TattooImagesCollection, v TattooImagesVector) {
+	if e.savedSearches == nil || e.notifier == nil || c.Hidden {
+		return
+	}
+
+	select {
+	case e.percolation.admitted <- struct{}{}:
+	default:
+		e.percolation.dropped.Add(1)
+		slog.Warn("percolation queue full, dropping the tattoo", "id", c.ID)
+		return
+	}
+
+	go func() {
+		defer func() { <-e.percolation.admitted }()
+
+		ctx := context.Background()
+		matches, err := e.matchSavedSearches(ctx, c, v)
+		if err != nil {
+			slog.WarnContext(ctx, "listing the saved searches failed", "id", c.ID, "error", err)
+			return
+		}
+		for _, n := range matches {
+			nCtx, nCancel := context.WithTimeout(ctx, e.configuration.PercolationPolicy.NotifyTimeout)
+			if err := e.notifier.Notify(nCtx, n); err != nil {
+				slog.WarnContext(ctx, "notifying the saved search failed", "search", n.Search.ID, "id", c.ID, "error", err)
+			}
+			nCancel()
+		}
+	}()
+}
+
+// matchSavedSearches returns the notifications of the saved searches the tattoo scores above the threshold of.
+// The tattoo is ranked against every saved query, the queries are parsed once.
+func (e *SearchEngine) matchSavedSearches(ctx context.Context, c TattooImagesCollection, v TattooImagesVector) ([]Notification, error) {
+	searches, err := e.savedSearches.SavedSearches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ranker := *e.ranker
+	ranker.Boosts = e.settings.Load().boosts
+	candidates := []TattooImagesVector{v}
+	now := e.clock.Now()
+
+	var out []Notification
+	for _, ss := range searches {
+		queries, ok := e.percolation.queries(e, ss)
+		if !ok {
+			continue
+		}
+		ranked := ranker.Rank(queries, candidates)
+		if score := ranked[0].Score; score > 0 && score > ss.Threshold {
+			out = append(out, Notification{Search: ss, Collection: c, Score: score, Time: now})
+		}
+	}
+
+	return out, nil
+}
+
+// queries returns the parsed queries of the saved search, false when it has none to match.
+func (p *percolator) queries(e *SearchEngine, ss SavedSearch) ([]ParsedQuery, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	parsed, ok := p.parsed[ss.ID]
+	if !ok || parsed.query != ss.Query || parsed.lang != ss.Lang {
+		queries, err := e.prepareQueries([]string{ss.Query}, SearchOptions{Lang: ss.Lang})
+		if err != nil {
+			slog.Warn("parsing the saved search failed", "search", ss.ID, "error", err)
+		}
+		parsed = parsedSearch{query: ss.Query, lang: ss.Lang, queries: queries}
+		p.parsed[ss.ID] = parsed
+	}
+
+	return parsed.queries, len(parsed.queries) > 0
+}
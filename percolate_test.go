@@ -0,0 +1,84 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// recordingNotifier keeps the notifications it's given.
+type recordingNotifier struct {
+	mu    sync.Mutex
+	notes []searchAPI.Notification
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, note searchAPI.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notes = append(n.notes, note)
+	return nil
+}
+
+func (n *recordingNotifier) Notifications() []searchAPI.Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]searchAPI.Notification(nil), n.notes...)
+}
+
+var _ = Describe("Saved search percolation", func() {
+	var (
+		notifier *recordingNotifier
+		se       *httptest.Server
+	)
+
+	BeforeEach(func() {
+		notifier = &recordingNotifier{}
+		saved := searchAPI.NewMemorySavedSearches(
+			searchAPI.SavedSearch{ID: "lions", Owner: "studio-a", Query: "lion"},
+			searchAPI.SavedSearch{ID: "dragons", Owner: "studio-b", Query: "dragon", Threshold: 50},
+		)
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		engine := searchAPI.NewSearchEngine(cfg, searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore(),
+			searchAPI.WithSavedSearches(saved), searchAPI.WithNotifier(notifier))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	ingest := func(id string, subject searchAPI.LabelSet) {
+		GinkgoHelper()
+		status, _ := doImport(se, nil, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: id, Subject: subject},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+	}
+
+	It("notifies the owners of the saved searches an ingested tattoo matches", func() {
+		ingest("LION", searchAPI.LabelSet{"lion": 90})
+		ingest("ROSE", searchAPI.LabelSet{"rose": 90})
+
+		Eventually(notifier.Notifications).Should(HaveLen(1))
+		Consistently(notifier.Notifications, 50*time.Millisecond).Should(HaveLen(1))
+		note := notifier.Notifications()[0]
+		Expect(note.Search.ID).To(Equal("lions"))
+		Expect(note.Search.Owner).To(Equal("studio-a"))
+		Expect(note.Collection.ID).To(Equal("LION"))
+		Expect(note.Score).To(BeNumerically("==", 90))
+	})
+
+	It("leaves out the matches at or below the threshold", func() {
+		ingest("FAINT", searchAPI.LabelSet{"dragon": 50})
+		ingest("BOLD", searchAPI.LabelSet{"dragon": 80})
+
+		Eventually(notifier.Notifications).Should(HaveLen(1))
+		Consistently(notifier.Notifications, 50*time.Millisecond).Should(HaveLen(1))
+		Expect(notifier.Notifications()[0].Collection.ID).To(Equal("BOLD"))
+	})
+})
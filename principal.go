@@ -0,0 +1,56 @@
+package inkinspot
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Principal is who a request is made by, for the stores which scope their records by tenant.
+// The zero value is the anonymous principal, of the requests without an API key nor the admin token.
+type Principal struct {
+	// APIKeyName is the name of the API key of the request, see keyName of QuotaPolicy; the key itself is never kept.
+	APIKeyName string `json:"api_key_name,omitempty"`
+	// Namespace is the namespace of the API key, empty for the keys without one.
+	Namespace string `json:"namespace,omitempty"`
+	// Admin is set when the request carries the admin token.
+	Admin bool `json:"admin,omitempty"`
+	// Partner is the name of the webhook partner whose signed delivery the request is, see WebhookPolicy.
+	Partner string `json:"partner,omitempty"`
+}
+
+// Anonymous reports whether the principal is unknown.
+func (p Principal) Anonymous() bool {
+	return p == Principal{}
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns the context carrying the principal.
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the context.
+// It's the anonymous principal & false when the context carries none, as in the background work of the engine.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// withPrincipal sets the principal of the request from its API key & admin token, before any route.
+// A wrong token or an unknown key isn't refused here, only left out of the principal.
+func withPrincipal(se *SearchEngine, next http.Handler) http.Handler {
+	quotas, admin := se.configuration.QuotaPolicy, se.configuration.AdminPolicy.Token
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Principal
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			p.APIKeyName, p.Namespace = quotas.keyName(key), quotas.quota(key).Namespace
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		p.Admin = ok && admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+
+		next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+	})
+}
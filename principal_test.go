@@ -0,0 +1,141 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// principalRecorder records the principals the stores are called with, as a tenant scoped store reads them.
+type principalRecorder struct {
+	mu         sync.Mutex
+	principals []string
+}
+
+func (r *principalRecorder) record(ctx context.Context, store string) {
+	p, ok := searchAPI.PrincipalFromContext(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := store + " " + p.APIKeyName + "/" + p.Namespace
+	switch {
+	case !ok:
+		seen = store + " none"
+	case p.Admin:
+		seen += "/admin"
+	}
+	r.principals = append(r.principals, seen)
+}
+
+func (r *principalRecorder) seen() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.principals
+}
+
+type principalImageStore struct {
+	*searchAPI.MemoryImageStore
+	recorder *principalRecorder
+}
+
+func (s principalImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	s.recorder.record(ctx, "images")
+	return s.MemoryImageStore.GetTattoosByID(ctx, ids)
+}
+
+type principalVectorStore struct {
+	*searchAPI.MemoryVectorStore
+	recorder *principalRecorder
+}
+
+func (s principalVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	s.recorder.record(ctx, "vectors")
+	return s.MemoryVectorStore.GetIDsByQuery(ctx, query)
+}
+
+func (s principalVectorStore) GetIDsByQueryPage(ctx context.Context, query, cursor string, limit int) ([]string, string, error) {
+	s.recorder.record(ctx, "vectors")
+	return s.MemoryVectorStore.GetIDsByQueryPage(ctx, query, cursor, limit)
+}
+
+var _ = Describe("Principals", func() {
+	var (
+		recorder *principalRecorder
+		audit    *searchAPI.MemoryAuditLog
+		se       *httptest.Server
+	)
+
+	BeforeEach(func() {
+		recorder = &principalRecorder{}
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"lion": 0.9}})).To(Succeed())
+
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			QuotaPolicy: searchAPI.QuotaPolicy{Keys: map[string]searchAPI.Quota{"k-ink": {Name: "ink", Namespace: "studio-a"}}},
+		}
+		audit = searchAPI.NewMemoryAuditLog(10)
+		engine := searchAPI.NewSearchEngine(cfg, principalImageStore{is, recorder}, principalVectorStore{vs, recorder}, searchAPI.WithAuditLogger(audit))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	request := func(method, path, key, token, body string) int {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if key != "" {
+			req.Header.Set(searchAPI.APIKeyHeader, key)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	It("passes the principal of the API key down to the stores", func() {
+		Expect(request(http.MethodGet, "/search?q=lion", "k-ink", "", "")).To(Equal(http.StatusOK))
+		Expect(recorder.seen()).To(Equal([]string{"vectors ink/studio-a", "images ink/studio-a"}))
+	})
+
+	It("marks the admin requests", func() {
+		Expect(request(http.MethodGet, "/tattoos/L", "k-ink", adminToken, "")).To(Equal(http.StatusOK))
+		Expect(recorder.seen()).To(Equal([]string{"images ink/studio-a/admin"}))
+	})
+
+	It("leaves the requests without credentials anonymous", func() {
+		Expect(request(http.MethodGet, "/search?q=lion", "", "wrong", "")).To(Equal(http.StatusOK))
+		Expect(recorder.seen()).To(Equal([]string{"vectors /", "images /"}))
+
+		p, ok := searchAPI.PrincipalFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+		Expect(p.Anonymous()).To(BeTrue())
+	})
+
+	It("names the unknown keys without a namespace", func() {
+		Expect(request(http.MethodGet, "/search?q=lion", "k-other", "", "")).To(Equal(http.StatusOK))
+		Expect(recorder.seen()).To(ConsistOf(HavePrefix("vectors sha256:"), HavePrefix("images sha256:")))
+		Expect(recorder.seen()).To(HaveEach(HaveSuffix("/")))
+	})
+
+	It("audits the mutations with the principal", func() {
+		Expect(request(http.MethodPut, "/admin/boosts", "k-ink", adminToken, `{"boosts":{"lion":2}}`)).To(Equal(http.StatusOK))
+
+		entries, err := audit.AuditEntries(context.Background(), searchAPI.AuditQuery{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Actor).To(Equal("ink"))
+		Expect(entries[0].Namespace).To(Equal("studio-a"))
+	})
+})
@@ -0,0 +1,100 @@
+package inkinspot
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+)
+
+// Query logging modes, for PrivacyPolicy.LogQueries.
+const (
+	// LogQueriesFull records the queries as they were sent.
+	LogQueriesFull = "full"
+	// LogQueriesHashed records an HMAC of the normalized queries instead.
+	LogQueriesHashed = "hashed"
+	// LogQueriesNone leaves the queries out.
+	LogQueriesNone = "none"
+)
+
+// PrivacyPolicy controls how the queries are recorded in the logs & the metrics.
+// Zero values are replaced by the defaults.
+type PrivacyPolicy struct {
+	// LogQueries is LogQueriesFull by default, unknown modes leave the queries out.
+	LogQueries string
+	// QueryHashKey is the HMAC key of the hashed queries.
+	// A random key is drawn when it's empty, the hashes only match within a process then.
+	QueryHashKey string
+}
+
+func (p PrivacyPolicy) withDefaults() PrivacyPolicy {
+	if p.LogQueries == "" {
+		p.LogQueries = LogQueriesFull
+	}
+
+	return p
+}
+
+// queryLabeler records the queries by the privacy policy.
+// Every log site goes through it, so the queries can't leak past the policy.
+type queryLabeler struct {
+	mode      string
+	key       []byte
+	normalize func(string) string
+}
+
+func newQueryLabeler(p PrivacyPolicy, normalize func(string) string) queryLabeler {
+	key := []byte(p.QueryHashKey)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = cryptorand.Read(key)
+	}
+
+	return queryLabeler{mode: p.LogQueries, key: key, normalize: normalize}
+}
+
+// label returns what's recorded of the query, false when nothing is.
+func (l queryLabeler) label(q string) (string, bool) {
+	switch l.mode {
+	case LogQueriesFull:
+		return q, true
+	case LogQueriesHashed:
+		mac := hmac.New(sha256.New, l.key)
+		mac.Write([]byte(l.normalize(q)))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8]), true
+	default:
+		return "", false
+	}
+}
+
+// attr returns the log attribute of the query, an empty one the handlers drop when nothing is recorded.
+func (l queryLabeler) attr(key, q string) slog.Attr {
+	label, ok := l.label(q)
+	if !ok {
+		return slog.Attr{}
+	}
+
+	return slog.String(key, label)
+}
+
+// values labels the q parameters of the query string, they're dropped when nothing is recorded.
+func (l queryLabeler) values(values url.Values) url.Values {
+	if l.mode == LogQueriesFull || !values.Has("q") {
+		return values
+	}
+
+	out := make(url.Values, len(values))
+	for k, vs := range values {
+		out[k] = vs
+	}
+	delete(out, "q")
+	for _, q := range values["q"] {
+		if label, ok := l.label(q); ok {
+			out.Add("q", label)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,118 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query privacy", func() {
+	const query = "lion covering scar on my left wrist"
+
+	var (
+		mu      sync.Mutex
+		appLogs bytes.Buffer
+	)
+
+	// captureLogs sends the application logs to appLogs, until the spec ends.
+	BeforeEach(func() {
+		appLogs.Reset()
+		prev := slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(lockedWriter{&mu, &appLogs}, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		DeferCleanup(func() { slog.SetDefault(prev) })
+	})
+
+	// run searches & warms the cache with the query, it returns the application & the access logs.
+	run := func(p searchAPI.PrivacyPolicy) (string, string) {
+		GinkgoHelper()
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		access := &syncBuffer{}
+		cfg := searchAPI.Configuration{
+			PrivacyPolicy:   p,
+			AccessLogPolicy: searchAPI.AccessLogPolicy{Writer: access, BodySampleRate: 1},
+			CachePolicy:     searchAPI.CachePolicy{TTL: time.Minute},
+			CacheWarmup:     searchAPI.CacheWarmup{Queries: []string{query}},
+		}
+		eng := searchAPI.NewSearchEngine(cfg, is, vs)
+		eng.WarmCache(context.Background())
+		se := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+
+		Expect(doSearch(se, url.Values{"q": {query}, "limit": {"5"}}).Status).To(Equal(http.StatusOK))
+		Expect(doSearch(se, url.Values{"q": {query}, "limit": {"-1"}}).Status).To(Equal(http.StatusBadRequest))
+
+		mu.Lock()
+		defer mu.Unlock()
+		access.mu.Lock()
+		defer access.mu.Unlock()
+		return appLogs.String(), access.buf.String()
+	}
+
+	It("records the queries in full by default", func() {
+		app, access := run(searchAPI.PrivacyPolicy{})
+		Expect(app).To(ContainSubstring(query))
+		Expect(access).To(ContainSubstring(url.QueryEscape(query)))
+	})
+
+	It("records a stable HMAC of the normalized queries when hashed", func() {
+		app, access := run(searchAPI.PrivacyPolicy{LogQueries: searchAPI.LogQueriesHashed, QueryHashKey: "k"})
+		Expect(app + access).NotTo(ContainSubstring("wrist"))
+
+		// the warmup & the access log hash the raw query, the search log the normalized one.
+		hashes := hmacs(app)
+		Expect(hashes).NotTo(BeEmpty())
+		Expect(strings.Count(access, "q="+url.QueryEscape(hashes[0]))).To(Equal(2))
+		Expect(app).To(ContainSubstring(`"msg":"search","query":"` + hashes[0]))
+	})
+
+	It("leaves the queries out when none", func() {
+		app, access := run(searchAPI.PrivacyPolicy{LogQueries: searchAPI.LogQueriesNone})
+		for _, logs := range []string{app, access} {
+			Expect(logs).NotTo(ContainSubstring("wrist"))
+			Expect(logs).NotTo(ContainSubstring("hmac:"))
+		}
+		Expect(app).NotTo(ContainSubstring(`"query"`))
+		Expect(access).To(ContainSubstring(`"query":"limit=5"`))
+		Expect(access).NotTo(ContainSubstring("response_body"), "the error bodies may echo the queries")
+	})
+
+	It("leaves the queries out for the unknown modes", func() {
+		app, access := run(searchAPI.PrivacyPolicy{LogQueries: "partial"})
+		Expect(app + access).NotTo(ContainSubstring("wrist"))
+	})
+})
+
+// lockedWriter serializes the writes to the buffer.
+type lockedWriter struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// hmacs returns the query hashes in the logs.
+func hmacs(logs string) []string {
+	var out []string
+	for _, f := range strings.FieldsFunc(logs, func(r rune) bool { return r == '"' || r == ' ' }) {
+		if strings.HasPrefix(f, "hmac:") {
+			out = append(out, f)
+		}
+	}
+	return out
+}
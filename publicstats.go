@@ -0,0 +1,145 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PublicStatsPolicy shapes the public aggregates of the searches & the catalog.
+// Zero values are replaced by the defaults.
+type PublicStatsPolicy struct {
+	// Sanitizer leaves out the small buckets & rounds the counts.
+	Sanitizer Sanitizer
+	// TTL is how long the aggregates are served before they're gathered again, & cached by the clients.
+	TTL time.Duration
+	// Top is the number of buckets published by aggregate.
+	Top int
+	// MaxQueries caps the distinct queries counted in a month, the new ones past it aren't counted.
+	MaxQueries int
+}
+
+func (p PublicStatsPolicy) withDefaults() PublicStatsPolicy {
+	p.Sanitizer = p.Sanitizer.withDefaults()
+	if p.TTL <= 0 {
+		p.TTL = time.Hour
+	}
+	if p.Top <= 0 {
+		p.Top = 10
+	}
+	if p.MaxQueries <= 0 {
+		p.MaxQueries = 10_000
+	}
+
+	return p
+}
+
+// PublicStats are the sanitized aggregates of the month, safe to publish.
+// Queries & Searches are missing unless the queries are logged in full, see PrivacyPolicy.
+type PublicStats struct {
+	Period      string                  `json:"period"`
+	GeneratedAt time.Time               `json:"generated_at"`
+	Searches    int                     `json:"searches,omitempty"`
+	Queries     []LabelCount            `json:"queries,omitempty"`
+	Facets      map[string][]LabelCount `json:"facets,omitempty"`
+}
+
+// queryCounts counts the searches of the month by normalized query.
+type queryCounts struct {
+	mu       sync.Mutex
+	period   string
+	searches int
+	queries  map[string]int
+	// last are the aggregates gathered last, served for the TTL of the policy.
+	last *PublicStats
+}
+
+// recordQueries counts a search of the queries in the month, once per distinct query.
+// Nothing is counted unless the privacy policy logs the queries in full.
+func (e *SearchEngine) recordQueries(queries []string) {
+	if e.configuration.PrivacyPolicy.LogQueries != LogQueriesFull {
+		return
+	}
+	period, _ := usagePeriod(UsageWindowMonth, e.clock.Now())
+	seen := make(map[string]bool, len(queries))
+
+	c := e.queryCounts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.period != period {
+		c.period, c.searches, c.queries = period, 0, make(map[string]int)
+	}
+	c.searches++
+	for _, q := range queries {
+		q = e.normalizeQuery(q)
+		if q == "" || seen[q] {
+			continue
+		}
+		seen[q] = true
+		if _, ok := c.queries[q]; ok || len(c.queries) < e.configuration.PublicStatsPolicy.MaxQueries {
+			c.queries[q]++
+		}
+	}
+}
+
+// PublicStats returns the sanitized aggregates of the month, gathered at most once per TTL of the policy.
+// The catalog is bounded by the timeout of the stats policy.
+func (e *SearchEngine) PublicStats(ctx context.Context) (PublicStats, error) {
+	p := e.configuration.PublicStatsPolicy
+	now := e.clock.Now()
+	period, _ := usagePeriod(UsageWindowMonth, now)
+
+	c := e.queryCounts
+	c.mu.Lock()
+	last := c.last
+	c.mu.Unlock()
+	if last != nil && last.Period == period && now.Sub(last.GeneratedAt) < p.TTL {
+		return *last, nil
+	}
+
+	stats := PublicStats{Period: period, GeneratedAt: now}
+	if histogrammer, ok := storeAs[LabelHistogrammer](e.vectorStore); ok {
+		ctx, cancel := e.withTightTimeout(ctx, e.configuration.StatsPolicy.Timeout)
+		defer cancel()
+
+		stats.Facets = make(map[string][]LabelCount, 3)
+		for _, facet := range []string{FacetStyle, FacetSubject, FacetArea} {
+			histogram, err := histogrammer.LabelHistogram(ctx, facet)
+			if err != nil {
+				return PublicStats{}, e.storeError(VectorStoreName, "histogram", err)
+			}
+			stats.Facets[facet] = p.Sanitizer.Buckets(histogram, p.Top)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.period == period {
+		stats.Searches, _ = p.Sanitizer.Count(c.searches)
+		stats.Queries = p.Sanitizer.Buckets(c.queries, p.Top)
+	}
+	c.last = &stats
+
+	return stats, nil
+}
+
+// handlePublicStats serves the public aggregates without auth, cacheable for the TTL of the policy.
+func handlePublicStats(se *SearchEngine) http.Handler {
+	maxAge := strconv.Itoa(int(se.configuration.PublicStatsPolicy.TTL.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := se.PublicStats(r.Context())
+		switch {
+		case err == nil:
+			w.Header().Set("Cache-Control", "public, max-age="+maxAge)
+			writeJSON(w, http.StatusOK, stats)
+		case errors.Is(err, context.DeadlineExceeded):
+			writeError(w, http.StatusGatewayTimeout, "stats_timeout", "gathering the stats timed out")
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "gathering the stats failed")
+		}
+	})
+}
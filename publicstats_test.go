@@ -0,0 +1,110 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// getPublicStats requests the public stats without credentials.
+func getPublicStats(se *httptest.Server) (*http.Response, searchAPI.PublicStats) {
+	GinkgoHelper()
+	resp, err := se.Client().Get(se.URL + "/stats/public")
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var stats searchAPI.PublicStats
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(json.NewDecoder(resp.Body).Decode(&stats)).To(Succeed())
+	return resp, stats
+}
+
+var _ = Describe("Public stats", func() {
+	var clock *inkinspottest.FakeClock
+
+	// 12 blackwork lions & 3 traditional roses.
+	initServer := func(privacy searchAPI.PrivacyPolicy) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for i := range 15 {
+			id := fmt.Sprintf("T%02d", i)
+			v := searchAPI.TattooImagesVector{ID: id, Style: searchAPI.LabelSet{"blackwork": 0.8}, Subject: searchAPI.LabelSet{"lion": 0.9}}
+			if i >= 12 {
+				v = searchAPI.TattooImagesVector{ID: id, Style: searchAPI.LabelSet{"traditional": 0.8}, Subject: searchAPI.LabelSet{"rose": 0.9}}
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC))
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}, PrivacyPolicy: privacy}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	search := func(se *httptest.Server, query string, times int) {
+		GinkgoHelper()
+		for range times {
+			Expect(doQuery(se, query).Status).To(Equal(http.StatusOK))
+		}
+	}
+
+	It("publishes the sanitized aggregates of the month", func() {
+		se := initServer(searchAPI.PrivacyPolicy{})
+		search(se, "Lion", 14)
+		search(se, "rose", 4)
+
+		resp, stats := getPublicStats(se)
+		Expect(resp.Header.Get("Cache-Control")).To(Equal("public, max-age=3600"))
+		Expect(stats.Period).To(Equal("2026-10"))
+		Expect(stats.Searches).To(Equal(20), "18 rounded")
+		Expect(stats.Queries).To(Equal([]searchAPI.LabelCount{{Label: "lion", Count: 10}}), "rose is searched too little")
+		Expect(stats.Facets).To(Equal(map[string][]searchAPI.LabelCount{
+			searchAPI.FacetStyle:   {{Label: "blackwork", Count: 10}},
+			searchAPI.FacetSubject: {{Label: "lion", Count: 10}},
+			searchAPI.FacetArea:    {},
+		}))
+	})
+
+	It("serves the aggregates for the TTL, then the next month's", func() {
+		se := initServer(searchAPI.PrivacyPolicy{})
+		search(se, "lion", 10)
+		_, before := getPublicStats(se)
+
+		search(se, "lion", 20)
+		clock.Advance(59 * time.Minute)
+		_, cached := getPublicStats(se)
+		Expect(cached).To(Equal(before))
+
+		clock.Advance(time.Minute)
+		_, fresh := getPublicStats(se)
+		Expect(fresh.Queries).To(Equal([]searchAPI.LabelCount{{Label: "lion", Count: 30}}))
+
+		clock.Advance(30 * 24 * time.Hour)
+		_, next := getPublicStats(se)
+		Expect(next.Period).To(Equal("2026-11"))
+		Expect(next.Searches).To(BeZero())
+		Expect(next.Queries).To(BeEmpty())
+	})
+
+	It("counts no queries unless they're logged in full", func() {
+		se := initServer(searchAPI.PrivacyPolicy{LogQueries: searchAPI.LogQueriesHashed})
+		search(se, "lion", 12)
+
+		_, stats := getPublicStats(se)
+		Expect(stats.Searches).To(BeZero())
+		Expect(stats.Queries).To(BeEmpty())
+		Expect(stats.Facets[searchAPI.FacetStyle]).To(HaveLen(1))
+	})
+})
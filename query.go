@@ -0,0 +1,244 @@
+package inkinspot
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// QueryPolicy holds the limits applied to the search queries.
+// Zero values are replaced by the defaults.
+type QueryPolicy struct {
+	// MaxQueryLength is the maximum length of a normalized query in bytes.
+	MaxQueryLength int
+	// MaxQueryTokens is the maximum number of whitespace separated tokens.
+	MaxQueryTokens int
+	// TruncateLongQueries clips over-long queries instead of rejecting them.
+	TruncateLongQueries bool
+	// MaxQueryValues is the maximum number of queries in a single search.
+	MaxQueryValues int
+	// KeepDiacritics disables the stripping of diacritics for accented vocabularies.
+	KeepDiacritics bool
+	// DefaultLanguage is the BCP 47 tag used when a search has no language hint.
+	// Labels are analyzed by the rules of this language.
+	DefaultLanguage string
+	// StemExceptions are terms which are never stemmed, guarding against over-stemming.
+	StemExceptions []string
+	// Synonyms map a query word or quoted phrase to the label term it stands for.
+	// Nil is the default synonyms, an empty map has none.
+	Synonyms map[string]string
+	// RequireQuery rejects the searches without a query, the ones with facet filters browse them otherwise.
+	RequireQuery bool
+}
+
+// defaultSynonyms are the synonyms of the shorthands of the tattoo labels.
+var defaultSynonyms = map[string]string{
+	"black and white": "bw",
+}
+
+// synonyms returns the synonyms with normalized keys & values.
+func (p QueryPolicy) synonyms(n Normalizer) map[string]string {
+	out := make(map[string]string, len(p.Synonyms))
+	for k, v := range p.Synonyms {
+		out[n.Normalize(k)] = n.Normalize(v)
+	}
+
+	return out
+}
+
+// analyzer returns the analyzer of the language with the policy's normalization.
+func (p QueryPolicy) analyzer(lang *Language) Analyzer {
+	a := Analyzer{
+		Normalizer:     Normalizer{KeepDiacritics: p.KeepDiacritics},
+		Language:       lang,
+		StemExceptions: make(map[string]bool, len(p.StemExceptions)),
+	}
+	for _, term := range p.StemExceptions {
+		a.StemExceptions[a.Normalizer.Normalize(term)] = true
+	}
+
+	return a
+}
+
+func (p QueryPolicy) withDefaults() QueryPolicy {
+	if p.MaxQueryLength <= 0 {
+		p.MaxQueryLength = 256
+	}
+	if p.MaxQueryTokens <= 0 {
+		p.MaxQueryTokens = 16
+	}
+	if p.MaxQueryValues <= 0 {
+		p.MaxQueryValues = 5
+	}
+	if p.DefaultLanguage == "" {
+		p.DefaultLanguage = "en"
+	}
+	if p.Synonyms == nil {
+		p.Synonyms = maps.Clone(defaultSynonyms)
+	}
+
+	return p
+}
+
+// applyQueryLimits checks a normalized query against the policy limits.
+// Over-long queries are clipped on whole tokens when truncation is on,
+// a first token over the length limit leaves nothing to search: it's still too long.
+func applyQueryLimits(p QueryPolicy, query string) (string, error) {
+	tokens := strings.Fields(query)
+	if len(query) <= p.MaxQueryLength && len(tokens) <= p.MaxQueryTokens {
+		return query, nil
+	}
+	tooLong := fmt.Errorf("%w: got %d bytes in %d tokens, limits are %d bytes and %d tokens",
+		ErrQueryTooLong, len(query), len(tokens), p.MaxQueryLength, p.MaxQueryTokens)
+
+	if !p.TruncateLongQueries {
+		return "", tooLong
+	}
+
+	if len(tokens) > p.MaxQueryTokens {
+		tokens = tokens[:p.MaxQueryTokens]
+	}
+	for len(tokens) > 0 && len(strings.Join(tokens, " ")) > p.MaxQueryLength {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return "", tooLong
+	}
+
+	return strings.Join(tokens, " "), nil
+}
+
+// Normalizer folds queries & labels so both sides of a match agree.
+// It applies NFKC normalization, case folding, optional diacritic
+// stripping and collapses whitespace runs into single spaces.
+type Normalizer struct {
+	KeepDiacritics bool
+}
+
+var (
+	caseFolder       = cases.Fold()
+	diacriticRemover = runes.Remove(runes.In(unicode.Mn))
+	// diacriticStrippers pools the stateful chains which strip the diacritics.
+	diacriticStrippers = sync.Pool{New: func() any { return transform.Chain(norm.NFD, diacriticRemover) }}
+)
+
+// maxNormalizePasses bounds the passes of Normalize to reach its fixed point.
+const maxNormalizePasses = 4
+
+// Normalize returns the folded form of s.
+// It's idempotent, a single pass may leave a form which folds further.
+func (n Normalizer) Normalize(s string) string {
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+
+	out := n.fold(s)
+	for range maxNormalizePasses - 1 {
+		next := n.fold(out)
+		if next == out {
+			break
+		}
+		out = next
+	}
+
+	return out
+}
+
+// fold is a single pass of Normalize.
+func (n Normalizer) fold(s string) string {
+	if isASCII(s) {
+		return foldASCII(s)
+	}
+
+	s = norm.NFKC.String(s)
+	s = caseFolder.String(s)
+	// folding swaps the case of Cherokee, lowering after it is stable.
+	s = strings.ToLower(s)
+	if !n.KeepDiacritics {
+		t := diacriticStrippers.Get().(transform.Transformer)
+		t.Reset()
+		if stripped, _, err := transform.String(t, s); err == nil {
+			s = stripped
+		}
+		diacriticStrippers.Put(t)
+	}
+	s = norm.NFKC.String(s)
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// asciiSpace are the ASCII whitespace bytes strings.Fields splits on.
+var asciiSpace = [256]bool{'\t': true, '\n': true, '\v': true, '\f': true, '\r': true, ' ': true}
+
+// foldASCII is fold of ASCII text, which the unicode forms & diacritics leave as is.
+// Text already folded is returned without a copy.
+func foldASCII(s string) string {
+	folded := true
+	for i := 0; i < len(s) && folded; i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z':
+			folded = false
+		case asciiSpace[c]:
+			folded = c == ' ' && i > 0 && i < len(s)-1 && s[i-1] != ' '
+		}
+	}
+	if folded {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if asciiSpace[c] {
+			if len(b) > 0 && b[len(b)-1] != ' ' {
+				b = append(b, ' ')
+			}
+			continue
+		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	if len(b) > 0 && b[len(b)-1] == ' ' {
+		b = b[:len(b)-1]
+	}
+
+	return string(b)
+}
+
+// normalizeQuery folds the query with the default normalizer.
+func normalizeQuery(s string) string {
+	return Normalizer{}.Normalize(s)
+}
+
+// LabelAnalyzer returns the analyzer the stores must apply to the labels.
+// It follows the default language & normalization of the query policy.
+func (c Configuration) LabelAnalyzer() Analyzer {
+	p := c.withDefaults().QueryPolicy
+	lang, err := lookupLanguage(p.DefaultLanguage)
+	if err != nil {
+		lang = agnosticLanguage
+	}
+
+	return p.analyzer(lang)
+}
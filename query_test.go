@@ -0,0 +1,131 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query limits", func() {
+	ctx := context.Background()
+	limits := searchAPI.QueryPolicy{MaxQueryLength: 10, MaxQueryTokens: 2}
+
+	When("the query is at the limits", func() {
+		It("searches normally", func() {
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: limits})
+			res, err := eng.Search(ctx, "lion chest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).NotTo(BeEmpty())
+		})
+	})
+
+	When("the query is one byte over the length limit", func() {
+		It("returns ErrQueryTooLong", func() {
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: limits})
+			_, err := eng.Search(ctx, "lion chests")
+			Expect(err).To(MatchError(searchAPI.ErrQueryTooLong))
+		})
+	})
+
+	When("the query is one token over the token limit", func() {
+		It("returns ErrQueryTooLong", func() {
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: limits})
+			_, err := eng.Search(ctx, "a b c")
+			Expect(err).To(MatchError(searchAPI.ErrQueryTooLong))
+		})
+	})
+
+	When("the query is too long over HTTP", func() {
+		It("returns a 400 Bad Request stating the limits", func() {
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: limits})
+			se := httptest.NewServer(searchAPI.NewHandler(eng))
+			defer se.Close()
+
+			res := doQuery(se, "lion on chest")
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("query_too_long"))
+			Expect(res.JSON.Error.Message).To(ContainSubstring("10 bytes and 2 tokens"))
+		})
+	})
+
+	When("truncation is enabled", func() {
+		It("returns the same results as the pre-clipped query", func() {
+			truncating := limits
+			truncating.TruncateLongQueries = true
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: truncating})
+
+			clipped, err := eng.Search(ctx, "lion chest realistic bw")
+			Expect(err).NotTo(HaveOccurred())
+
+			expected, err := eng.Search(ctx, "lion chest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clipped).To(Equal(expected))
+		})
+
+		It("clips on whole tokens to the length limit", func() {
+			truncating := limits
+			truncating.TruncateLongQueries = true
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: truncating})
+
+			clipped, err := eng.Search(ctx, "lion chests")
+			Expect(err).NotTo(HaveOccurred())
+
+			expected, err := eng.Search(ctx, "lion")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clipped).To(Equal(expected))
+		})
+
+		It("returns ErrQueryTooLong when the first token is over the length limit", func() {
+			truncating := limits
+			truncating.TruncateLongQueries = true
+			eng := initSeededSearchEngine(searchAPI.Configuration{QueryPolicy: truncating})
+
+			_, err := eng.Search(ctx, "lionsandtigers chest")
+			Expect(err).To(MatchError(searchAPI.ErrQueryTooLong))
+		})
+	})
+})
+
+var _ = Describe("Query normalization", func() {
+	DescribeTable("folds unicode input",
+		func(n searchAPI.Normalizer, in, expected string) {
+			Expect(n.Normalize(in)).To(Equal(expected))
+		},
+		Entry("case folding", searchAPI.Normalizer{}, "LION Straße", "lion strasse"),
+		Entry("diacritics", searchAPI.Normalizer{}, "Lión LÖWE", "lion lowe"),
+		Entry("combining characters", searchAPI.Normalizer{}, "lión", "lion"),
+		Entry("full-width characters", searchAPI.Normalizer{}, "ＬＩＯＮ　ｃｈｅｓｔ", "lion chest"),
+		Entry("mixed scripts", searchAPI.Normalizer{}, "Лев lion אריה", "лев lion אריה"),
+		Entry("internal whitespace", searchAPI.Normalizer{}, " lion \t\n  on   chest ", "lion on chest"),
+		Entry("kept diacritics", searchAPI.Normalizer{KeepDiacritics: true}, "LIÓN", "lión"),
+		Entry("kept combining diacritics composed", searchAPI.Normalizer{KeepDiacritics: true}, "lión", "lión"),
+	)
+
+	When("the query is accented", func() {
+		It("matches the unaccented label", func() {
+			eng := initSeededSearchEngine(searchAPI.Configuration{})
+			res, err := eng.Search(context.Background(), "Lión")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collectionIDs(res)).To(ConsistOf("X", "Y"))
+		})
+	})
+
+	When("the label is accented at ingest", func() {
+		It("matches the unaccented query", func() {
+			ctx := context.Background()
+			is := searchAPI.NewMemoryImageStore()
+			vs := searchAPI.NewMemoryVectorStore()
+			Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"lowe.jpg"}})).To(Succeed())
+			Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"Löwe": 100}})).To(Succeed())
+
+			res, err := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs).Search(ctx, "LOWE")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collectionIDs(res)).To(ConsistOf("L"))
+		})
+	})
+})
@@ -0,0 +1,302 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader carries the API key of the client, its requests are counted against the key's quotas.
+// The requests without a configured key share the default quota, whatever key they send.
+const APIKeyHeader = "X-API-Key"
+
+// Usage kinds, the requests counted separately.
+const (
+	UsageSearch = "search"
+	UsageIngest = "ingest"
+)
+
+// UsageWindowMonth is the calendar month in UTC, the window of the quotas.
+const UsageWindowMonth = "month"
+
+// Quota is the requests of each kind a key may make a month, zero for no limit.
+type Quota struct {
+	// Name identifies the key in the access log, the key itself is never logged.
+	Name string `json:"name,omitempty"`
+	// Namespace scopes the requests of the key in the stores which tell the tenants apart, see Principal.
+	Namespace string `json:"namespace,omitempty"`
+	Search    int64  `json:"search"`
+	Ingest    int64  `json:"ingest"`
+}
+
+// limit returns the quota of the kind.
+func (q Quota) limit(kind string) int64 {
+	if kind == UsageIngest {
+		return q.Ingest
+	}
+
+	return q.Search
+}
+
+// QuotaPolicy caps the requests of the API keys by month.
+// The zero value counts the requests without limiting them.
+type QuotaPolicy struct {
+	// Default is the quota shared by the requests without a configured key, the unknown keys & no key alike.
+	Default Quota
+	// Keys are the quotas of some keys.
+	Keys map[string]Quota
+}
+
+// quota returns the quota of the key.
+func (p QuotaPolicy) quota(key string) Quota {
+	if q, ok := p.Keys[key]; ok {
+		return q
+	}
+
+	return p.Default
+}
+
+// usageKey returns the key the requests of the API key are counted under,
+// the unknown keys are counted in the anonymous bucket, the empty key.
+func (p QuotaPolicy) usageKey(key string) string {
+	if _, ok := p.Keys[key]; ok {
+		return key
+	}
+
+	return ""
+}
+
+// UsageStore counts the requests of the API keys by window & kind.
+// The counters must be atomic, whatever the concurrency.
+type UsageStore interface {
+	// Take counts a request of the key when it's below the limit, a zero limit has none.
+	// It returns whether it was counted & the count, the refused requests are counted apart.
+	Take(ctx context.Context, key, window, kind string, limit int64) (count int64, ok bool, err error)
+	// Usage returns the counters of the key in the window.
+	Usage(ctx context.Context, key, window string) (UsageCounts, error)
+	// Reset zeroes the counters of the key in the window.
+	Reset(ctx context.Context, key, window string) error
+}
+
+// UsageCounts are the requests counted & refused, by kind.
+type UsageCounts struct {
+	Counted map[string]int64 `json:"counted"`
+	Refused map[string]int64 `json:"refused"`
+}
+
+// UsageReport is the usage of a key in a window & its quota.
+type UsageReport struct {
+	// Key names the key by its configured name or a fingerprint, empty for the anonymous bucket.
+	Key    string `json:"key"`
+	Window string `json:"window"`
+	Period string `json:"period"`
+	Quota  Quota  `json:"quota"`
+	UsageCounts
+}
+
+// MemoryUsageStore keeps the usage counters in memory.
+// The counters of the earlier windows are dropped once a later one is counted.
+type MemoryUsageStore struct {
+	mu       sync.Mutex
+	counters map[usageKey]*UsageCounts
+	// latest is the latest window counted.
+	latest string
+}
+
+type usageKey struct {
+	key, window string
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store.
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{counters: make(map[usageKey]*UsageCounts)}
+}
+
+// Take counts a request of the key when it's below the limit.
+func (s *MemoryUsageStore) Take(ctx context.Context, key, window, kind string, limit int64) (int64, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if window > s.latest {
+		for k := range s.counters {
+			if k.window < window {
+				delete(s.counters, k)
+			}
+		}
+		s.latest = window
+	}
+	k := usageKey{key, window}
+	c, ok := s.counters[k]
+	if !ok {
+		c = &UsageCounts{Counted: make(map[string]int64), Refused: make(map[string]int64)}
+		s.counters[k] = c
+	}
+	if limit > 0 && c.Counted[kind] >= limit {
+		c.Refused[kind]++
+		return c.Counted[kind], false, nil
+	}
+	c.Counted[kind]++
+
+	return c.Counted[kind], true, nil
+}
+
+// Usage returns the counters of the key in the window, zero when it made no request.
+func (s *MemoryUsageStore) Usage(ctx context.Context, key, window string) (UsageCounts, error) {
+	if err := ctx.Err(); err != nil {
+		return UsageCounts{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := UsageCounts{Counted: make(map[string]int64), Refused: make(map[string]int64)}
+	if c, ok := s.counters[usageKey{key, window}]; ok {
+		for kind, n := range c.Counted {
+			out.Counted[kind] = n
+		}
+		for kind, n := range c.Refused {
+			out.Refused[kind] = n
+		}
+	}
+
+	return out, nil
+}
+
+// Reset zeroes the counters of the key in the window.
+func (s *MemoryUsageStore) Reset(ctx context.Context, key, window string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, usageKey{key, window})
+
+	return nil
+}
+
+// WithUsageStore sets the store of the usage counters, in memory by default.
+func WithUsageStore(s UsageStore) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.usage = s
+	}
+}
+
+// usagePeriod returns the period of the window at the time, ErrInvalidWindow for an unknown window.
+func usagePeriod(window string, now time.Time) (string, error) {
+	switch window {
+	case "", UsageWindowMonth:
+		return now.UTC().Format("2006-01"), nil
+	default:
+		return "", fmt.Errorf("%w: %q, only %q is supported", ErrInvalidWindow, window, UsageWindowMonth)
+	}
+}
+
+// TakeQuota counts a request of the kind against the quota of the key.
+// The requests without a configured key are counted together against the default quota.
+// It returns ErrQuotaExceeded once the key used up its quota for the month.
+func (e *SearchEngine) TakeQuota(ctx context.Context, key, kind string) error {
+	period, _ := usagePeriod(UsageWindowMonth, e.clock.Now())
+	limit := e.configuration.QuotaPolicy.quota(key).limit(kind)
+
+	count, ok, err := e.usage.Take(ctx, e.configuration.QuotaPolicy.usageKey(key), period, kind, limit)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s quota of %d requests used up for %s", ErrQuotaExceeded, kind, count, period)
+	}
+
+	return nil
+}
+
+// Usage reports the usage of the key in the current period of the window, the anonymous bucket's for an unknown key.
+func (e *SearchEngine) Usage(ctx context.Context, key, window string) (UsageReport, error) {
+	period, err := usagePeriod(window, e.clock.Now())
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	policy := e.configuration.QuotaPolicy
+	counts, err := e.usage.Usage(ctx, policy.usageKey(key), period)
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	return UsageReport{
+		Key:         policy.keyName(policy.usageKey(key)),
+		Window:      UsageWindowMonth,
+		Period:      period,
+		Quota:       policy.quota(key),
+		UsageCounts: counts,
+	}, nil
+}
+
+// ResetUsage zeroes the usage of the key in the current period of the window, the anonymous bucket's for an unknown key.
+func (e *SearchEngine) ResetUsage(ctx context.Context, key, window string) error {
+	period, err := usagePeriod(window, e.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	return e.usage.Reset(ctx, e.configuration.QuotaPolicy.usageKey(key), period)
+}
+
+// withQuota answers 429 Too Many Requests once the API key used up its quota of the kind.
+// The requests without a configured key use up the default quota together.
+// The usage store failing lets the request through.
+func withQuota(se *SearchEngine, kind string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := se.TakeQuota(r.Context(), r.Header.Get(APIKeyHeader), kind)
+		switch {
+		case errors.Is(err, ErrQuotaExceeded):
+			writeError(w, http.StatusTooManyRequests, kind+"_quota_exceeded", err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "counting the usage failed", "kind", kind, "error", err)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleUsage reports the usage of a key on GET & resets it on DELETE.
+func handleUsage(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, window := r.URL.Query().Get("key"), r.URL.Query().Get("window")
+		if key == "" {
+			writeError(w, http.StatusBadRequest, "invalid_key", "key is required")
+			return
+		}
+
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			var report UsageReport
+			if report, err = se.Usage(r.Context(), key, window); err == nil {
+				writeJSON(w, http.StatusOK, report)
+				return
+			}
+		case http.MethodDelete:
+			if err = se.ResetUsage(r.Context(), key, window); err == nil {
+				se.recordAudit(w, r, AuditUsageReset, se.configuration.QuotaPolicy.keyName(key), "", "")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if errors.Is(err, ErrInvalidWindow) {
+			writeError(w, http.StatusBadRequest, "invalid_window", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_error", "usage store failed")
+	})
+}
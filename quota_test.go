@@ -0,0 +1,187 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quotas", func() {
+	var (
+		se    *httptest.Server
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC))
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			QuotaPolicy: searchAPI.QuotaPolicy{
+				Default: searchAPI.Quota{Search: 3, Ingest: 1},
+				Keys: map[string]searchAPI.Quota{
+					"big":     {Search: 20},
+					"partner": {Search: 3, Ingest: 1},
+				},
+			},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	// call sends the request with the API key & decodes the answer into out, when given.
+	call := func(method, path, key string, body string, out any) int {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if key != "" {
+			req.Header.Set(searchAPI.APIKeyHeader, key)
+		}
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		if out != nil {
+			Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+		}
+		return resp.StatusCode
+	}
+
+	usage := func(key string) searchAPI.UsageReport {
+		GinkgoHelper()
+		var report searchAPI.UsageReport
+		Expect(call(http.MethodGet, "/admin/usage?window=month&key="+key, "", "", &report)).To(Equal(http.StatusOK))
+		return report
+	}
+
+	It("cuts the searches off once the key used up its quota", func() {
+		for range 3 {
+			Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusOK))
+		}
+		var res searchAPI.Response
+		Expect(call(http.MethodGet, "/search?q=lion", "partner", "", &res)).To(Equal(http.StatusTooManyRequests))
+		Expect(res.Error.Code).To(Equal("search_quota_exceeded"))
+
+		Expect(call(http.MethodGet, "/search?q=lion", "big", "", nil)).To(Equal(http.StatusOK), "the keys are counted apart")
+
+		report := usage("partner")
+		Expect(report.Key).To(HavePrefix("sha256:"), "the key itself is never reported")
+		Expect(report.Period).To(Equal("2026-03"))
+		Expect(report.Quota).To(Equal(searchAPI.Quota{Search: 3, Ingest: 1}))
+		Expect(report.Counted).To(Equal(map[string]int64{"search": 3}))
+		Expect(report.Refused).To(Equal(map[string]int64{"search": 1}))
+	})
+
+	It("counts the unknown keys & the anonymous requests in a shared bucket", func() {
+		Expect(call(http.MethodGet, "/search?q=lion", "other", "", nil)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodGet, "/search?q=lion", "", "", nil)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodGet, "/search?q=lion", "rotated", "", nil)).To(Equal(http.StatusOK))
+		var res searchAPI.Response
+		Expect(call(http.MethodGet, "/search?q=lion", "", "", &res)).To(Equal(http.StatusTooManyRequests))
+		Expect(res.Error.Code).To(Equal("search_quota_exceeded"))
+		Expect(call(http.MethodGet, "/search?q=lion", "fresh", "", nil)).To(Equal(http.StatusTooManyRequests), "a new key doesn't get a new quota")
+		Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusOK))
+
+		report := usage("other")
+		Expect(report.Key).To(BeEmpty())
+		Expect(report.Counted).To(Equal(map[string]int64{"search": 3}))
+		Expect(report.Refused).To(Equal(map[string]int64{"search": 2}))
+	})
+
+	It("counts the ingest apart from the searches", func() {
+		body := ndjson(searchAPI.ExportRecord{Collection: searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"w.jpg"}}})
+		Expect(call(http.MethodPost, "/admin/import", "partner", body, nil)).To(Equal(http.StatusOK))
+		var res searchAPI.Response
+		Expect(call(http.MethodPost, "/admin/import", "partner", body, &res)).To(Equal(http.StatusTooManyRequests))
+		Expect(res.Error.Code).To(Equal("ingest_quota_exceeded"))
+		Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusOK))
+
+		report := usage("partner")
+		Expect(report.Counted).To(Equal(map[string]int64{"search": 1, "ingest": 1}))
+		Expect(report.Refused).To(Equal(map[string]int64{"ingest": 1}))
+	})
+
+	It("counts atomically under concurrency", func() {
+		var ok, refused atomic.Int32
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				switch call(http.MethodGet, "/search?q=lion", "big", "", nil) {
+				case http.StatusOK:
+					ok.Add(1)
+				case http.StatusTooManyRequests:
+					refused.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(ok.Load()).To(BeEquivalentTo(20))
+		Expect(refused.Load()).To(BeEquivalentTo(30))
+		Expect(usage("big").Counted).To(Equal(map[string]int64{"search": 20}))
+	})
+
+	It("resets the usage on demand & every month", func() {
+		for range 3 {
+			call(http.MethodGet, "/search?q=lion", "partner", "", nil)
+		}
+		Expect(call(http.MethodDelete, "/admin/usage?key=partner", "", "", nil)).To(Equal(http.StatusNoContent))
+		Expect(usage("partner").Counted).To(BeEmpty())
+
+		for range 3 {
+			Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusOK))
+		}
+		Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusTooManyRequests))
+
+		clock.Advance(time.Hour)
+		Expect(call(http.MethodGet, "/search?q=lion", "partner", "", nil)).To(Equal(http.StatusOK))
+		Expect(usage("partner").Period).To(Equal("2026-04"))
+	})
+
+	It("rejects the unknown windows", func() {
+		var res searchAPI.Response
+		Expect(call(http.MethodGet, "/admin/usage?key=partner&window=week", "", "", &res)).To(Equal(http.StatusBadRequest))
+		Expect(res.Error.Code).To(Equal("invalid_window"))
+	})
+
+	It("counts with no limit by default", func() {
+		store := searchAPI.NewMemoryUsageStore()
+		ctx := context.Background()
+		for range 100 {
+			_, ok, err := store.Take(ctx, "k", "2026-03", searchAPI.UsageSearch, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		}
+		counts, err := store.Usage(ctx, "k", "2026-03")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts.Counted[searchAPI.UsageSearch]).To(BeEquivalentTo(100))
+	})
+
+	It("drops the counters of the finished periods", func() {
+		store := searchAPI.NewMemoryUsageStore()
+		ctx := context.Background()
+		_, _, err := store.Take(ctx, "k", "2026-03", searchAPI.UsageSearch, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = store.Take(ctx, "other", "2026-04", searchAPI.UsageSearch, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		counts, err := store.Usage(ctx, "k", "2026-03")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts.Counted).To(BeEmpty())
+	})
+})
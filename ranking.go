@@ -0,0 +1,361 @@
+package inkinspot
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facet names of the label sets of a vector.
+const (
+	FacetStyle   = "style"
+	FacetSubject = "subject"
+	FacetArea    = "area"
+)
+
+// RankingPolicy holds the weights of the label facets in the score.
+// Zero weights are replaced by the default of 1.
+type RankingPolicy struct {
+	StyleWeight   float64 `json:"style_weight"`
+	SubjectWeight float64 `json:"subject_weight"`
+	AreaWeight    float64 `json:"area_weight"`
+	// PopularityBoost multiplies the scores by 1 + PopularityBoost × the CTR of the collections, zero ranks no popularity.
+	// The cached results keep the popularity they were ranked with.
+	PopularityBoost float64 `json:"popularity_boost,omitempty"`
+	// MaxPopularity caps the popularity multiplier, it isn't echoed with the weights.
+	MaxPopularity float64 `json:"-"`
+}
+
+// MaxFacetWeight bounds the per-request facet weight overrides.
+const MaxFacetWeight = 10
+
+// WeightOverrides replace facet weights of the ranking policy for a single search.
+// Nil fields keep the configured weight, zero ignores the facet.
+type WeightOverrides struct {
+	Style   *float64
+	Subject *float64
+	Area    *float64
+}
+
+// apply returns the policy with the overrides, which must be within [0, MaxFacetWeight].
+func (o WeightOverrides) apply(p RankingPolicy) (RankingPolicy, error) {
+	overrides := []struct {
+		facet  string
+		weight *float64
+		target *float64
+	}{
+		{FacetStyle, o.Style, &p.StyleWeight},
+		{FacetSubject, o.Subject, &p.SubjectWeight},
+		{FacetArea, o.Area, &p.AreaWeight},
+	}
+
+	for _, ov := range overrides {
+		if ov.weight == nil {
+			continue
+		}
+		if w := *ov.weight; math.IsNaN(w) || w < 0 || w > MaxFacetWeight {
+			return RankingPolicy{}, fmt.Errorf("%w: %s weight must be within 0 and %d", ErrInvalidWeight, ov.facet, MaxFacetWeight)
+		}
+		*ov.target = *ov.weight
+	}
+
+	return p, nil
+}
+
+func (p RankingPolicy) withDefaults() RankingPolicy {
+	if p.StyleWeight <= 0 {
+		p.StyleWeight = 1
+	}
+	if p.SubjectWeight <= 0 {
+		p.SubjectWeight = 1
+	}
+	if p.AreaWeight <= 0 {
+		p.AreaWeight = 1
+	}
+	if p.MaxPopularity <= 1 {
+		p.MaxPopularity = 1.5
+	}
+
+	return p
+}
+
+// popularity returns the score multiplier of the feedback counters of a collection.
+func (p RankingPolicy) popularity(c FeedbackCounts) float64 {
+	return min(1+p.PopularityBoost*c.CTR(), p.MaxPopularity)
+}
+
+// LabelMatch explains a label which contributed to a score.
+type LabelMatch struct {
+	Facet string `json:"facet"`
+	// Label is the label as stored, Stem is what the query matched.
+	Label     string  `json:"label"`
+	Stem      string  `json:"stem"`
+	Proximity float64 `json:"proximity"`
+	Weight    float64 `json:"weight"`
+	// Distance is the edit distance of a fuzzy match, 0 when exact.
+	Distance     int     `json:"distance,omitempty"`
+	Contribution float64 `json:"contribution"`
+}
+
+// RankedVector is a candidate ID, its score & the labels behind it.
+// Score is normalized into [0, 1] by the engine, RawScore is the ranker's.
+type RankedVector struct {
+	ID       string       `json:"id"`
+	Score    float64      `json:"score"`
+	RawScore float64      `json:"raw_score"`
+	Matches  []LabelMatch `json:"matches,omitempty"`
+	// Freshness is the multiplier of the freshness boost, 0 when not applied.
+	Freshness float64 `json:"freshness,omitempty"`
+	// Boost is the multiplier of the boosted labels, 0 when not applied.
+	Boost float64 `json:"boost,omitempty"`
+	// Popularity is the multiplier of the click-through rate, 0 when not applied.
+	Popularity float64 `json:"popularity,omitempty"`
+}
+
+// Ranker scores candidate vectors against parsed queries.
+// The score is the sum of the weighted proximities of the matched labels.
+type Ranker struct {
+	Policy RankingPolicy
+	// Fuzzy penalizes the matches of corrected query stems.
+	Fuzzy FuzzyPolicy
+	// Freshness boosts the scores of the recently added vectors.
+	Freshness FreshnessPolicy
+	// Boosts are score multipliers by the joined stems of a label.
+	Boosts map[string]float64
+	// Analyzer is applied to the labels, it must match the stores'.
+	Analyzer Analyzer
+	// Clock dates the freshness, the real clock when nil.
+	Clock Clock
+}
+
+// WithRanker replaces the ranker built from the configuration of the engine.
+// The searches override its policy by their weights & its boosts by the settings, a nil clock is the engine's.
+// Its analyzer must match the stores'.
+func WithRanker(r Ranker) SearchEngineOption {
+	return func(e *SearchEngine) {
+		r.Fuzzy = r.Fuzzy.withDefaults()
+		r.Freshness = r.Freshness.withDefaults()
+		e.ranker = &r
+	}
+}
+
+// Rank scores the candidates by their best matching query, boosted by freshness & labels.
+// Ordered by descending score, ties by ID.
+func (r *Ranker) Rank(queries []ParsedQuery, candidates []TattooImagesVector) []RankedVector {
+	return r.rankBy(candidates, func(id string, labels []rankedLabel) RankedVector {
+		best := RankedVector{ID: id}
+		for _, q := range queries {
+			if rv := r.score(q, id, labels); rv.Score > best.Score {
+				best = rv
+			}
+		}
+		return best
+	})
+}
+
+// RankFilters scores the candidates by their labels passing the filters, boosted by freshness & labels.
+// It ranks the searches without a query, ordered by descending score, ties by ID.
+func (r *Ranker) RankFilters(filters FacetFilters, candidates []TattooImagesVector) []RankedVector {
+	stems := make(map[string][][]string, len(filters))
+	for facet, labels := range filters {
+		for _, label := range labels {
+			stems[facet] = append(stems[facet], r.Analyzer.Analyze(label))
+		}
+	}
+
+	return r.rankBy(candidates, func(id string, labels []rankedLabel) RankedVector {
+		rv := RankedVector{ID: id}
+		for _, l := range labels {
+			if !slices.ContainsFunc(stems[l.facet], func(s []string) bool { return slices.Equal(s, l.stems) }) {
+				continue
+			}
+			m := LabelMatch{
+				Facet:        l.facet,
+				Label:        l.label,
+				Stem:         strings.Join(l.stems, " "),
+				Proximity:    l.proximity,
+				Weight:       l.weight,
+				Contribution: l.weight * l.proximity,
+			}
+			rv.Matches = append(rv.Matches, m)
+			rv.Score += m.Contribution
+		}
+		return rv
+	})
+}
+
+// rankBy scores the candidates by the score function over their labels, boosted by freshness & labels.
+func (r *Ranker) rankBy(candidates []TattooImagesVector, score func(id string, labels []rankedLabel) RankedVector) []RankedVector {
+	var now time.Time
+	if r.Clock != nil {
+		now = r.Clock.Now()
+	} else {
+		now = time.Now()
+	}
+
+	out := make([]RankedVector, 0, len(candidates))
+	var labels []rankedLabel
+	for _, v := range candidates {
+		labels = r.analyzeLabels(labels[:0], v)
+		best := score(v.ID, labels)
+		if f := r.Freshness.factor(v.CreatedAt, now); f != 1 && best.Score > 0 {
+			best.Freshness = f
+			best.Score *= f
+		}
+		if b := r.labelBoost(labels); b != 1 && best.Score > 0 {
+			best.Boost = b
+			best.Score *= b
+		}
+		out = append(out, best)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+// rankedLabel is a label of a candidate with its facet weight & stems.
+type rankedLabel struct {
+	facet     string
+	label     string
+	stems     []string
+	proximity float64
+	weight    float64
+}
+
+// analyzeLabels appends the labels of every facet of the vector to dst.
+func (r *Ranker) analyzeLabels(dst []rankedLabel, v TattooImagesVector) []rankedLabel {
+	facets := []struct {
+		name   string
+		labels LabelSet
+		weight float64
+	}{
+		{FacetStyle, v.Style, r.Policy.StyleWeight},
+		{FacetSubject, v.Subject, r.Policy.SubjectWeight},
+		{FacetArea, v.Area, r.Policy.AreaWeight},
+	}
+
+	out := slices.Grow(dst, len(v.Style)+len(v.Subject)+len(v.Area))
+	for _, f := range facets {
+		for _, label := range sortedLabels(f.labels) {
+			out = append(out, rankedLabel{
+				facet:     f.name,
+				label:     label,
+				stems:     r.Analyzer.Analyze(label),
+				proximity: f.labels[label],
+				weight:    f.weight,
+			})
+		}
+	}
+
+	return out
+}
+
+// labelBoost returns the product of the boosts of the labels.
+func (r *Ranker) labelBoost(labels []rankedLabel) float64 {
+	b := 1.0
+	if len(r.Boosts) == 0 {
+		return b
+	}
+
+	seen := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		stem := strings.Join(l.stems, " ")
+		if boost, ok := r.Boosts[stem]; ok && !seen[stem] {
+			seen[stem] = true
+			b *= boost
+		}
+	}
+
+	return b
+}
+
+// score rates a single candidate against a single query.
+// Candidates which fail the query expression score zero.
+func (r *Ranker) score(q ParsedQuery, id string, labels []rankedLabel) RankedVector {
+	rv := RankedVector{ID: id}
+
+	if q.expr != nil {
+		matched := func(stems []string) bool {
+			for _, l := range labels {
+				if matchesLabel(stems, l.stems) {
+					return true
+				}
+			}
+			return false
+		}
+		if !q.expr.eval(matched) {
+			return rv
+		}
+	}
+
+	for _, l := range labels {
+		if !matchesLabel(q.Stems, l.stems) {
+			continue
+		}
+
+		m := LabelMatch{
+			Facet:        l.facet,
+			Label:        l.label,
+			Stem:         strings.Join(l.stems, " "),
+			Proximity:    l.proximity,
+			Weight:       l.weight,
+			Distance:     q.correctionDistance(l.stems),
+			Contribution: l.weight * l.proximity,
+		}
+		m.Contribution *= r.Fuzzy.factor(m.Distance)
+		rv.Matches = append(rv.Matches, m)
+		rv.Score += m.Contribution
+	}
+
+	return rv
+}
+
+// sortedLabels returns the labels of the set in lexical order.
+func sortedLabels(ls LabelSet) []string {
+	out := make([]string, 0, len(ls))
+	for label := range ls {
+		out = append(out, label)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// parseWeightOverrides reads the w_style, w_subject & w_area query parameters.
+// The first invalid one in that order is reported.
+func parseWeightOverrides(params url.Values) (WeightOverrides, error) {
+	var o WeightOverrides
+	for _, p := range []struct {
+		param  string
+		target **float64
+	}{
+		{"w_style", &o.Style},
+		{"w_subject", &o.Subject},
+		{"w_area", &o.Area},
+	} {
+		param, target := p.param, p.target
+		raw := params.Get(param)
+		if raw == "" {
+			continue
+		}
+
+		w, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return WeightOverrides{}, fmt.Errorf("%w: %s must be a number", ErrInvalidWeight, param)
+		}
+		*target = &w
+	}
+
+	return o, nil
+}
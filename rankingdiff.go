@@ -0,0 +1,294 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rankingCurrent names the configured weights in the variants of a diff.
+const rankingCurrent = "current"
+
+// RankingDiffPolicy bounds the diffs of the rankings of two weight sets.
+// Zero values are replaced by the defaults.
+type RankingDiffPolicy struct {
+	// Queries are the benchmark queries the rankings are compared on.
+	Queries []string
+	// TopN is how many hits of a query are compared, the page policy caps it.
+	TopN int
+	// Concurrency is the number of queries searched at once.
+	Concurrency int
+	// QueryTimeout bounds the searches of every query of a diff.
+	QueryTimeout time.Duration
+}
+
+func (p RankingDiffPolicy) withDefaults() RankingDiffPolicy {
+	if p.TopN <= 0 {
+		p.TopN = 10
+	}
+	if p.Concurrency <= 0 {
+		p.Concurrency = 4
+	}
+	if p.QueryTimeout <= 0 {
+		p.QueryTimeout = time.Second
+	}
+
+	return p
+}
+
+// RankDelta is how an entry moved between the top N of the baseline & the candidate.
+// The ranks are 1-based, 0 when the entry isn't within the top N. Delta is positive when it moved up.
+type RankDelta struct {
+	ID        string `json:"id"`
+	Baseline  int    `json:"baseline"`
+	Candidate int    `json:"candidate"`
+	Delta     int    `json:"delta"`
+}
+
+// QueryDiff compares the top N of a query under both weight sets.
+// KendallTau is the share of the pairs ranked by both which swapped, from 0 to 1.
+// Error is why the query failed, the diff goes on without it.
+type QueryDiff struct {
+	Query      string      `json:"query"`
+	Baseline   []string    `json:"baseline"`
+	Candidate  []string    `json:"candidate"`
+	Deltas     []RankDelta `json:"deltas"`
+	KendallTau float64     `json:"kendall_tau"`
+	Entered    []string    `json:"entered"`
+	Left       []string    `json:"left"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// changed reports whether the top N differ.
+func (d QueryDiff) changed() bool {
+	for _, delta := range d.Deltas {
+		if delta.Delta != 0 || delta.Baseline == 0 || delta.Candidate == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RankingDiff compares the rankings of the benchmark queries under two weight sets.
+// MeanKendallTau averages the queries which didn't fail, Changed counts those whose top N differ.
+type RankingDiff struct {
+	TopN           int           `json:"top_n"`
+	Baseline       RankingPolicy `json:"baseline"`
+	Candidate      RankingPolicy `json:"candidate"`
+	Queries        []QueryDiff   `json:"queries"`
+	Changed        int           `json:"changed"`
+	Failed         int           `json:"failed"`
+	MeanKendallTau float64       `json:"mean_kendall_tau"`
+}
+
+// diffRanks compares the top N of the baseline & the candidate, both in rank order.
+func diffRanks(q *QueryDiff) {
+	before := make(map[string]int, len(q.Baseline))
+	for i, id := range q.Baseline {
+		before[id] = i + 1
+	}
+	after := make(map[string]int, len(q.Candidate))
+	for i, id := range q.Candidate {
+		after[id] = i + 1
+	}
+
+	q.Deltas, q.Entered, q.Left = []RankDelta{}, []string{}, []string{}
+	var both []int
+	for _, id := range q.Baseline {
+		d := RankDelta{ID: id, Baseline: before[id], Candidate: after[id]}
+		if d.Candidate == 0 {
+			q.Left = append(q.Left, id)
+		} else {
+			d.Delta = d.Baseline - d.Candidate
+			both = append(both, d.Candidate)
+		}
+		q.Deltas = append(q.Deltas, d)
+	}
+	for _, id := range q.Candidate {
+		if before[id] == 0 {
+			q.Entered = append(q.Entered, id)
+			q.Deltas = append(q.Deltas, RankDelta{ID: id, Candidate: after[id]})
+		}
+	}
+	q.KendallTau = kendallTau(both)
+}
+
+// kendallTau returns the normalized Kendall tau distance of the candidate ranks, listed in baseline order.
+// It's 0 when fewer than 2 entries are ranked by both.
+func kendallTau(ranks []int) float64 {
+	n := len(ranks)
+	if n < 2 {
+		return 0
+	}
+	discordant := 0
+	for i := range ranks {
+		for j := i + 1; j < n; j++ {
+			if ranks[i] > ranks[j] {
+				discordant++
+			}
+		}
+	}
+
+	return float64(discordant) / float64(n*(n-1)/2)
+}
+
+// topIDs returns the IDs of the hits of a search in rank order.
+func topIDs(res *SearchResult) []string {
+	ids := make([]string, 0, len(res.Hits))
+	for _, h := range res.Hits {
+		ids = append(ids, h.Collection.ID)
+	}
+
+	return ids
+}
+
+// DiffRanking searches the benchmark queries with both weight sets & compares their top N.
+// The queries are searched Concurrency at once, each bounded by the timeout of the policy.
+// It returns ErrNoBenchmarkQueries when the policy has none, ErrInvalidWeight when a weight set is invalid.
+func (e *SearchEngine) DiffRanking(ctx context.Context, baseline, candidate WeightOverrides) (RankingDiff, error) {
+	policy := e.configuration.RankingDiffPolicy
+	if len(policy.Queries) == 0 {
+		return RankingDiff{}, ErrNoBenchmarkQueries
+	}
+
+	diff := RankingDiff{TopN: min(policy.TopN, e.configuration.PagePolicy.MaxLimit), Queries: make([]QueryDiff, len(policy.Queries))}
+	var err error
+	if diff.Baseline, err = baseline.apply(e.configuration.RankingPolicy); err != nil {
+		return RankingDiff{}, fmt.Errorf("baseline: %w", err)
+	}
+	if diff.Candidate, err = candidate.apply(e.configuration.RankingPolicy); err != nil {
+		return RankingDiff{}, fmt.Errorf("candidate: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range min(policy.Concurrency, len(policy.Queries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				q := &diff.Queries[i]
+				if err := e.diffQuery(ctx, q, diff.TopN, baseline, candidate); err != nil {
+					q.Error = err.Error()
+				}
+			}
+		}()
+	}
+send:
+	for i, query := range policy.Queries {
+		diff.Queries[i].Query = query
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return RankingDiff{}, err
+	}
+
+	tau := 0.0
+	for _, q := range diff.Queries {
+		if q.Error != "" {
+			diff.Failed++
+			continue
+		}
+		if q.changed() {
+			diff.Changed++
+		}
+		tau += q.KendallTau
+	}
+	if ok := len(diff.Queries) - diff.Failed; ok > 0 {
+		diff.MeanKendallTau = tau / float64(ok)
+	}
+
+	return diff, nil
+}
+
+// diffQuery searches the query of the diff with both weight sets, within the query timeout.
+func (e *SearchEngine) diffQuery(ctx context.Context, q *QueryDiff, topN int, baseline, candidate WeightOverrides) error {
+	ctx, cancel := e.withTightTimeout(ctx, e.configuration.RankingDiffPolicy.QueryTimeout)
+	defer cancel()
+
+	before, err := e.MultiSearch(ctx, []string{q.Query}, SearchOptions{Weights: baseline, Limit: topN})
+	if err != nil {
+		return err
+	}
+	after, err := e.MultiSearch(ctx, []string{q.Query}, SearchOptions{Weights: candidate, Limit: topN})
+	if err != nil {
+		return err
+	}
+	q.Baseline, q.Candidate = topIDs(before), topIDs(after)
+	diffRanks(q)
+
+	return nil
+}
+
+// rankingVariant is a weight set of a diff, the configured weights when it's "current".
+type rankingVariant struct {
+	Weights *rankWeights `json:"weights"`
+}
+
+func (v *rankingVariant) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		if name != rankingCurrent {
+			return fmt.Errorf("unknown ranking variant %q", name)
+		}
+		*v = rankingVariant{}
+		return nil
+	}
+
+	type variant rankingVariant
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*variant)(v))
+}
+
+// overrides returns the weight overrides of the variant.
+func (v rankingVariant) overrides() WeightOverrides {
+	if v.Weights == nil {
+		return WeightOverrides{}
+	}
+
+	return WeightOverrides{Style: v.Weights.Style, Subject: v.Weights.Subject, Area: v.Weights.Area}
+}
+
+// rankingDiffBody is the request of a ranking diff, a missing variant is the current weights.
+type rankingDiffBody struct {
+	Baseline  rankingVariant `json:"baseline"`
+	Candidate rankingVariant `json:"candidate"`
+}
+
+// handleRankingDiff compares the rankings of the benchmark queries under the weight sets of the body.
+func handleRankingDiff(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body rankingDiffBody
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+			return
+		}
+
+		diff, err := se.DiffRanking(r.Context(), body.Baseline.overrides(), body.Candidate.overrides())
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, diff)
+		case errors.Is(err, ErrNoBenchmarkQueries):
+			writeError(w, http.StatusConflict, "no_benchmark_queries", "no benchmark queries are configured")
+		case errors.Is(err, ErrInvalidWeight):
+			writeSearchError(w, err)
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "ranking diff failed")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// diffRanking posts the body to the ranking diff, it decodes the diff of a 200 or the error.
+func diffRanking(se *httptest.Server, token string, body any) (int, searchAPI.RankingDiff, *searchAPI.APIError) {
+	GinkgoHelper()
+	b, err := json.Marshal(body)
+	Expect(err).NotTo(HaveOccurred())
+	req, err := http.NewRequest(http.MethodPost, se.URL+"/admin/ranking/diff", bytes.NewReader(b))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var diff searchAPI.RankingDiff
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&diff)).To(Succeed())
+		return resp.StatusCode, diff, nil
+	}
+	var failed searchAPI.Response
+	Expect(json.NewDecoder(resp.Body).Decode(&failed)).To(Succeed())
+
+	return resp.StatusCode, diff, failed.Error
+}
+
+var _ = Describe("Ranking diffs", func() {
+	// the subject weight ranks S & U first, the style weight T & V.
+	vectors := []searchAPI.TattooImagesVector{
+		{ID: "S", Subject: searchAPI.LabelSet{"lion": 0.9}},
+		{ID: "T", Style: searchAPI.LabelSet{"lion": 0.8}},
+		{ID: "U", Subject: searchAPI.LabelSet{"lion": 0.5}},
+		{ID: "V", Style: searchAPI.LabelSet{"lion": 0.2}},
+	}
+	subject := map[string]any{"weights": map[string]float64{"subject": 2, "style": 0.5}}
+	style := map[string]any{"weights": map[string]float64{"subject": 0.5, "style": 2}}
+
+	initServer := func(policy searchAPI.RankingDiffPolicy) *httptest.Server {
+		GinkgoHelper()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, v := range vectors {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: v.ID})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}, RankingDiffPolicy: policy}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("reports the rank deltas of the top N", func() {
+		se := initServer(searchAPI.RankingDiffPolicy{Queries: []string{"lion", "rose"}, TopN: 3, Concurrency: 2})
+
+		status, diff, _ := diffRanking(se, adminToken, map[string]any{"baseline": subject, "candidate": style})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(diff.TopN).To(Equal(3))
+		Expect(diff.Baseline.SubjectWeight).To(Equal(2.0))
+		Expect(diff.Candidate.StyleWeight).To(Equal(2.0))
+		Expect(diff.Queries).To(HaveLen(2))
+
+		lion := diff.Queries[0]
+		Expect(lion.Query).To(Equal("lion"))
+		Expect(lion.Error).To(BeEmpty())
+		Expect(lion.Baseline).To(Equal([]string{"S", "U", "T"}))
+		Expect(lion.Candidate).To(Equal([]string{"T", "S", "V"}))
+		Expect(lion.Deltas).To(Equal([]searchAPI.RankDelta{
+			{ID: "S", Baseline: 1, Candidate: 2, Delta: -1},
+			{ID: "U", Baseline: 2},
+			{ID: "T", Baseline: 3, Candidate: 1, Delta: 2},
+			{ID: "V", Candidate: 3},
+		}))
+		Expect(lion.Entered).To(Equal([]string{"V"}))
+		Expect(lion.Left).To(Equal([]string{"U"}))
+		Expect(lion.KendallTau).To(Equal(1.0), "S & T swapped")
+
+		rose := diff.Queries[1]
+		Expect(rose.Baseline).To(BeEmpty())
+		Expect(rose.Deltas).To(BeEmpty())
+		Expect(rose.KendallTau).To(BeZero())
+
+		Expect(diff.Changed).To(Equal(1))
+		Expect(diff.Failed).To(BeZero())
+		Expect(diff.MeanKendallTau).To(Equal(0.5))
+	})
+
+	It("compares with the current weights", func() {
+		se := initServer(searchAPI.RankingDiffPolicy{Queries: []string{"lion"}})
+
+		status, diff, _ := diffRanking(se, adminToken, map[string]any{"baseline": "current"})
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(diff.Baseline).To(Equal(diff.Candidate))
+		Expect(diff.Queries[0].Baseline).To(HaveLen(4))
+		Expect(diff.Queries[0].Candidate).To(Equal(diff.Queries[0].Baseline))
+		Expect(diff.Queries[0].Entered).To(BeEmpty())
+		Expect(diff.Changed).To(BeZero())
+
+		status, _, apiErr := diffRanking(se, adminToken, map[string]any{"baseline": "previous"})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("invalid_body"))
+	})
+
+	It("rejects the invalid weights", func() {
+		se := initServer(searchAPI.RankingDiffPolicy{Queries: []string{"lion"}})
+
+		status, _, apiErr := diffRanking(se, adminToken, map[string]any{"candidate": map[string]any{"weights": map[string]float64{"style": -1}}})
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(apiErr.Code).To(Equal("invalid_weight"))
+	})
+
+	It("needs the benchmark queries", func() {
+		se := initServer(searchAPI.RankingDiffPolicy{})
+
+		status, _, apiErr := diffRanking(se, adminToken, map[string]any{"candidate": style})
+		Expect(status).To(Equal(http.StatusConflict))
+		Expect(apiErr.Code).To(Equal("no_benchmark_queries"))
+	})
+
+	It("needs the admin token", func() {
+		se := initServer(searchAPI.RankingDiffPolicy{Queries: []string{"lion"}})
+
+		status, _, _ := diffRanking(se, "wrong", map[string]any{"candidate": style})
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+})
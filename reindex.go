@@ -0,0 +1,168 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reindexer is implemented by the vector stores.
+// Which can rebuild their index from the vectors they store, while they keep serving the old one.
+// progress is called with the vectors indexed so far & the total.
+type Reindexer interface {
+	Reindex(ctx context.Context, progress func(processed, total int)) error
+}
+
+// ReindexStatus reports the progress of the running reindex, or the outcome of the last one.
+type ReindexStatus struct {
+	Running    bool      `json:"running"`
+	Processed  int       `json:"processed"`
+	Total      int       `json:"total"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// reindexJob tracks the reindex of the vector store, one at a time.
+type reindexJob struct {
+	mu     sync.Mutex
+	status ReindexStatus
+}
+
+// Reindex rebuilds the index of the vector store in the background.
+// The searches use the old index until the new one is swapped in, the caches are purged then.
+// It returns ErrReindexRunning when a reindex hasn't ended yet.
+func (e *SearchEngine) Reindex() error {
+	reindexer, ok := storeAs[Reindexer](e.vectorStore)
+	if !ok {
+		return ErrReindexUnsupported
+	}
+
+	job := e.reindexing
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if job.status.Running {
+		return ErrReindexRunning
+	}
+	start := e.clock.Now()
+	job.status = ReindexStatus{Running: true, StartedAt: start}
+
+	go func() {
+		ctx := context.Background()
+		err := reindexer.Reindex(ctx, func(processed, total int) {
+			job.mu.Lock()
+			defer job.mu.Unlock()
+			job.status.Processed, job.status.Total = processed, total
+		})
+		if err == nil {
+			e.cache.purge()
+			e.collections.purge()
+		} else {
+			slog.ErrorContext(ctx, "reindex failed", "error", err)
+		}
+
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		job.status.Running = false
+		job.status.DurationMS = milliseconds(e.clock.Now().Sub(start))
+		if err != nil {
+			job.status.Error = err.Error()
+		}
+	}()
+
+	return nil
+}
+
+// ReindexStatus reports the running reindex, or the last one.
+func (e *SearchEngine) ReindexStatus() ReindexStatus {
+	job := e.reindexing
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	status := job.status
+	if status.Running {
+		status.DurationMS = milliseconds(e.clock.Now().Sub(status.StartedAt))
+	}
+
+	return status
+}
+
+// Reindex analyzes the stored vectors again into a fresh index & swaps it in.
+// The queries are served by the old index meanwhile, the vectors written meanwhile are carried over.
+func (s *MemoryVectorStore) Reindex(ctx context.Context, progress func(processed, total int)) error {
+	s.mu.Lock()
+	if s.written != nil {
+		s.mu.Unlock()
+		return ErrReindexRunning
+	}
+	s.written = make(map[string]bool)
+	vectors := make([]TattooImagesVector, 0, len(s.entries))
+	for _, id := range sortedIDs(s.entries) {
+		vectors = append(vectors, s.entries[id].vector)
+	}
+	s.mu.Unlock()
+
+	fresh := NewMemoryVectorStore(WithLabelAnalyzer(s.analyzer))
+	for i, v := range vectors {
+		if err := ctx.Err(); err != nil {
+			s.mu.Lock()
+			s.written = nil
+			s.mu.Unlock()
+			return err
+		}
+		fresh.insert(fresh.analyze(v))
+		if progress != nil {
+			progress(i+1, len(vectors))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.written {
+		fresh.remove(id)
+		if entry, ok := s.entries[id]; ok {
+			fresh.insert(entry)
+		}
+	}
+	s.entries, s.vocabulary, s.postings = fresh.entries, fresh.vocabulary, fresh.postings
+	s.written = nil
+
+	return nil
+}
+
+// touch records the ID written while the index is rebuilt.
+func (s *MemoryVectorStore) touch(id string) {
+	if s.written != nil {
+		s.written[id] = true
+	}
+}
+
+// handleReindex starts a reindex of the vector store.
+func handleReindex(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := se.Reindex()
+		switch {
+		case err == nil:
+			se.recordAudit(w, r, AuditReindex, "", "", "")
+			writeJSON(w, http.StatusAccepted, se.ReindexStatus())
+		case errors.Is(err, ErrReindexRunning):
+			writeError(w, http.StatusConflict, "reindex_running", err.Error())
+		case errors.Is(err, ErrReindexUnsupported):
+			writeError(w, http.StatusNotImplemented, "reindex_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "reindex failed")
+		}
+	})
+}
+
+// handleReindexStatus reports the progress of the reindex.
+func handleReindexStatus(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.ReindexStatus())
+	})
+}
@@ -0,0 +1,154 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// heldReindexer is a vector store whose reindex runs until it's released.
+type heldReindexer struct {
+	*inkinspottest.FakeVectorStore
+	release chan struct{}
+}
+
+func (s *heldReindexer) Reindex(ctx context.Context, progress func(processed, total int)) error {
+	<-s.release
+	return nil
+}
+
+var _ = Describe("Reindex", func() {
+	// reindexAdmin calls the reindex admin endpoint & decodes its answer into out.
+	reindexAdmin := func(se *httptest.Server, method, path string, out any) int {
+		GinkgoHelper()
+		req, err := http.NewRequest(method, se.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+		return resp.StatusCode
+	}
+
+	It("keeps serving the searches while it rebuilds, then serves the swapped index", func() {
+		const n = 20000
+		ctx := context.Background()
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		subjects := []string{"lion", "tiger", "rose", "skull"}
+		for i := range n {
+			id := fmt.Sprintf("t%05d", i)
+			Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: id, URLs: []string{id + ".jpg"}})).To(Succeed())
+			Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{subjects[i%len(subjects)]: 100}})).To(Succeed())
+		}
+		cfg := searchAPI.Configuration{
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute},
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+
+		Expect(doQuery(se, "lion").Status).To(Equal(http.StatusOK))
+
+		var status searchAPI.ReindexStatus
+		Expect(reindexAdmin(se, http.MethodPost, "/admin/reindex", &status)).To(Equal(http.StatusAccepted))
+		Expect(status.Running).To(BeTrue())
+
+		// the searches & the writes go on during the rebuild.
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				Expect(doQuery(se, "tiger").Status).To(Equal(http.StatusOK))
+			}
+		}()
+		Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"dragon.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "W", Subject: searchAPI.LabelSet{"dragon": 100}})).To(Succeed())
+
+		Eventually(func() bool {
+			reindexAdmin(se, http.MethodGet, "/admin/reindex/status", &status)
+			return status.Running
+		}).WithTimeout(30 * time.Second).Should(BeFalse())
+		close(done)
+		wg.Wait()
+
+		Expect(status.Error).To(BeEmpty())
+		Expect(status.Processed).To(Equal(status.Total))
+		Expect(status.Total).To(BeNumerically(">=", n))
+		Expect(collectionIDs(doQuery(se, "dragon").JSON.ImageCollections)).To(Equal([]string{"W"}))
+		Expect(doSearch(se, url.Values{"q": {"lion"}, "debug_meta": {"true"}}).JSON.Meta.CacheHit).To(BeFalse(), "the cache is purged after the swap")
+	})
+
+	It("carries over the vectors written while it rebuilds", func() {
+		ctx := context.Background()
+		vs := searchAPI.NewMemoryVectorStore()
+		for _, f := range inkinspottest.BigCats {
+			Expect(vs.AddVector(ctx, f.Vector)).To(Succeed())
+		}
+
+		Expect(vs.Reindex(ctx, func(processed, total int) {
+			if processed != 1 {
+				return
+			}
+			Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "W", Subject: searchAPI.LabelSet{"lion": 100}})).To(Succeed())
+			Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "Y", Subject: searchAPI.LabelSet{"tiger": 100}})).To(Succeed())
+			Expect(vs.DeleteVector(ctx, "X")).To(Succeed())
+		})).To(Succeed())
+
+		Expect(vs.GetIDsByQuery(ctx, "lion")).To(Equal([]string{"W"}))
+		Expect(vs.GetIDsByQuery(ctx, "tiger")).To(Equal([]string{"Y", "Z"}))
+	})
+
+	It("turns away a reindex while another runs", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		held := &heldReindexer{FakeVectorStore: vs, release: make(chan struct{})}
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, held)))
+		DeferCleanup(se.Close)
+
+		var status searchAPI.ReindexStatus
+		Expect(reindexAdmin(se, http.MethodPost, "/admin/reindex", &status)).To(Equal(http.StatusAccepted))
+		var res searchAPI.Response
+		Expect(reindexAdmin(se, http.MethodPost, "/admin/reindex", &res)).To(Equal(http.StatusConflict))
+		Expect(res.Error.Code).To(Equal("reindex_running"))
+
+		close(held.release)
+		Eventually(func() bool {
+			reindexAdmin(se, http.MethodGet, "/admin/reindex/status", &status)
+			return status.Running
+		}).Should(BeFalse())
+		Expect(reindexAdmin(se, http.MethodPost, "/admin/reindex", &status)).To(Equal(http.StatusAccepted))
+	})
+
+	It("isn't supported by the vector stores which can't rebuild", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+
+		var res searchAPI.Response
+		Expect(reindexAdmin(se, http.MethodPost, "/admin/reindex", &res)).To(Equal(http.StatusNotImplemented))
+		Expect(res.Error.Code).To(Equal("reindex_unsupported"))
+	})
+})
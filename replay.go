@@ -0,0 +1,357 @@
+package inkinspot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanyPops/inkinspot/httpx"
+)
+
+// ReplayPolicy paces the replay of a query log.
+// Zero values are replaced by the defaults.
+type ReplayPolicy struct {
+	// QPS is the rate the queries are sent at, as fast as the workers go when 0.
+	QPS float64
+	// Workers is the number of queries in flight at once.
+	Workers int
+	// Requests is the number of queries sent, the log is cycled through. The log is sent once when 0.
+	Requests int
+}
+
+func (p ReplayPolicy) withDefaults() ReplayPolicy {
+	if p.Workers <= 0 {
+		p.Workers = 8
+	}
+
+	return p
+}
+
+// ReplayTarget serves the searches of a replay.
+// Search returns the status of the response, an error when there was none.
+type ReplayTarget interface {
+	Search(ctx context.Context, params url.Values) (int, error)
+}
+
+// handlerTarget replays in process, the responses are discarded.
+type handlerTarget struct {
+	handler http.Handler
+}
+
+// HandlerTarget replays the searches against the handler in process, the report measures the allocations.
+func HandlerTarget(h http.Handler) ReplayTarget {
+	return handlerTarget{handler: h}
+}
+
+func (t handlerTarget) Search(ctx context.Context, params url.Values) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/search?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	w := &discardWriter{header: http.Header{}}
+	t.handler.ServeHTTP(w, req)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.status, nil
+}
+
+// discardWriter keeps the status of a response & drops its body.
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// urlTarget replays over HTTP against a running server.
+type urlTarget struct {
+	base   string
+	client *http.Client
+}
+
+// URLTarget replays the searches against the server at the base URL, with a client of httpx.NewClient when nil.
+func URLTarget(base string, client *http.Client) ReplayTarget {
+	if client == nil {
+		client = httpx.NewClient(httpx.ClientPolicy{})
+	}
+
+	return urlTarget{base: strings.TrimSuffix(base, "/"), client: client}
+}
+
+func (t urlTarget) Search(ctx context.Context, params url.Values) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.base+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+// LatencyPercentiles are the latencies of the replayed searches, in milliseconds.
+type LatencyPercentiles struct {
+	MeanMS float64 `json:"mean_ms"`
+	P50MS  float64 `json:"p50_ms"`
+	P90MS  float64 `json:"p90_ms"`
+	P99MS  float64 `json:"p99_ms"`
+	MaxMS  float64 `json:"max_ms"`
+}
+
+// ReplayReport is the outcome of the replay of a query log.
+type ReplayReport struct {
+	Requests int `json:"requests"`
+	// Errors counts the transport failures & the 5xx responses.
+	Errors int `json:"errors"`
+	// Statuses counts the responses by status, the transport failures under 0.
+	Statuses   map[int]int        `json:"statuses"`
+	DurationMS float64            `json:"duration_ms"`
+	QPS        float64            `json:"qps"`
+	Latency    LatencyPercentiles `json:"latency"`
+	// AllocsPerRequest & BytesPerRequest are only measured in process.
+	AllocsPerRequest float64 `json:"allocs_per_request,omitempty"`
+	BytesPerRequest  float64 `json:"bytes_per_request,omitempty"`
+	// Regressions are the metrics worse than the baseline's, when compared to one.
+	Regressions []ReplayRegression `json:"regressions,omitempty"`
+}
+
+// ErrorRate returns the share of the requests which failed.
+func (r ReplayReport) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+// ParseQueryLog reads the searches of a query log, a line each.
+// The JSON lines are access log entries, only the searches among them are kept.
+// Other lines are the text of a query, the blank ones are skipped.
+func ParseQueryLog(r io.Reader) ([]url.Values, error) {
+	var out []url.Values
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxImportLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "{"):
+			var entry AccessLogEntry
+			if err := json.Unmarshal([]byte(text), &entry); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if entry.Path != "/search" || (entry.Method != "" && entry.Method != http.MethodGet) {
+				continue
+			}
+			params, err := url.ParseQuery(entry.Query)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			out = append(out, params)
+		default:
+			out = append(out, url.Values{"q": {text}})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// replayed is the outcome of a replayed search.
+type replayed struct {
+	took   time.Duration
+	status int
+}
+
+// Replay sends the searches of the query log to the target by the policy & reports how it served them.
+// It stops sending when the context is done, the searches sent are reported with the context's error.
+func Replay(ctx context.Context, target ReplayTarget, queries []url.Values, p ReplayPolicy) (ReplayReport, error) {
+	if len(queries) == 0 {
+		return ReplayReport{}, ErrEmptyQueryLog
+	}
+	p = p.withDefaults()
+	requests := p.Requests
+	if requests <= 0 {
+		requests = len(queries)
+	}
+	_, inProcess := target.(handlerTarget)
+
+	var before runtime.MemStats
+	if inProcess {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+	}
+
+	jobs := make(chan url.Values)
+	results := make([][]replayed, p.Workers)
+	var wg sync.WaitGroup
+	for i := range p.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for params := range jobs {
+				start := time.Now()
+				status, err := target.Search(ctx, params)
+				if err != nil {
+					status = 0
+				}
+				results[i] = append(results[i], replayed{took: time.Since(start), status: status})
+			}
+		}()
+	}
+
+	start := time.Now()
+	var tick <-chan time.Time
+	if p.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / p.QPS))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	err := sendQueries(ctx, jobs, queries, requests, tick)
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := replayReport(slices.Concat(results...), elapsed)
+	if inProcess && report.Requests > 0 {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		report.AllocsPerRequest = float64(after.Mallocs-before.Mallocs) / float64(report.Requests)
+		report.BytesPerRequest = float64(after.TotalAlloc-before.TotalAlloc) / float64(report.Requests)
+	}
+
+	return report, err
+}
+
+// sendQueries sends the queries to the workers until the requests are sent, cycling through the log.
+// A query waits for a tick when they're paced.
+func sendQueries(ctx context.Context, jobs chan<- url.Values, queries []url.Values, requests int, tick <-chan time.Time) error {
+	for i := range requests {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case jobs <- queries[i%len(queries)]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// replayReport summarizes the replayed searches.
+func replayReport(results []replayed, elapsed time.Duration) ReplayReport {
+	report := ReplayReport{Requests: len(results), Statuses: map[int]int{}, DurationMS: milliseconds(elapsed)}
+	if len(results) == 0 {
+		return report
+	}
+
+	took := make([]time.Duration, 0, len(results))
+	var total time.Duration
+	for _, r := range results {
+		report.Statuses[r.status]++
+		if r.status == 0 || r.status >= http.StatusInternalServerError {
+			report.Errors++
+		}
+		took = append(took, r.took)
+		total += r.took
+	}
+	slices.Sort(took)
+	report.Latency = LatencyPercentiles{
+		MeanMS: milliseconds(total / time.Duration(len(took))),
+		P50MS:  milliseconds(percentile(took, 0.50)),
+		P90MS:  milliseconds(percentile(took, 0.90)),
+		P99MS:  milliseconds(percentile(took, 0.99)),
+		MaxMS:  milliseconds(took[len(took)-1]),
+	}
+	if elapsed > 0 {
+		report.QPS = float64(len(results)) / elapsed.Seconds()
+	}
+
+	return report
+}
+
+// percentile returns the nearest rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(float64(len(sorted))*p+0.999999) - 1
+
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// ReplayRegression is a metric of a replay worse than the baseline's.
+// Change is the increase over the baseline as a fraction of it.
+type ReplayRegression struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"`
+}
+
+// CompareReplay returns the metrics of the report which grew over the baseline's by more than the threshold, a fraction.
+// The metrics the baseline didn't measure are skipped, any error is a regression over a baseline without.
+func CompareReplay(baseline, current ReplayReport, threshold float64) []ReplayRegression {
+	metrics := []struct {
+		name              string
+		baseline, current float64
+	}{
+		{"latency_p50_ms", baseline.Latency.P50MS, current.Latency.P50MS},
+		{"latency_p90_ms", baseline.Latency.P90MS, current.Latency.P90MS},
+		{"latency_p99_ms", baseline.Latency.P99MS, current.Latency.P99MS},
+		{"allocs_per_request", baseline.AllocsPerRequest, current.AllocsPerRequest},
+		{"bytes_per_request", baseline.BytesPerRequest, current.BytesPerRequest},
+	}
+
+	var out []ReplayRegression
+	for _, m := range metrics {
+		if m.baseline <= 0 || m.current <= m.baseline*(1+threshold) {
+			continue
+		}
+		out = append(out, ReplayRegression{Metric: m.name, Baseline: m.baseline, Current: m.current, Change: m.current/m.baseline - 1})
+	}
+	if b, c := baseline.ErrorRate(), current.ErrorRate(); c > b*(1+threshold) {
+		r := ReplayRegression{Metric: "error_rate", Baseline: b, Current: c}
+		if b > 0 {
+			r.Change = c/b - 1
+		}
+		out = append(out, r)
+	}
+
+	return out
+}
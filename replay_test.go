@@ -0,0 +1,114 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Query log replays", func() {
+	queryLog := strings.Join([]string{
+		"lion",
+		`{"method":"GET","path":"/search","query":"q=tiger&limit=2","status":200}`,
+		`{"method":"GET","path":"/healthz","query":"","status":200}`,
+		"",
+		`{"method":"GET","path":"/search","query":"q=","status":400}`,
+	}, "\n")
+
+	It("parses the searches of the log", func() {
+		queries, err := searchAPI.ParseQueryLog(strings.NewReader(queryLog))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries).To(Equal([]url.Values{
+			{"q": {"lion"}},
+			{"q": {"tiger"}, "limit": {"2"}},
+			{"q": {""}},
+		}))
+
+		_, err = searchAPI.ParseQueryLog(strings.NewReader("lion\n{not json"))
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+	})
+
+	It("replays the log in process", func() {
+		queries, err := searchAPI.ParseQueryLog(strings.NewReader(queryLog))
+		Expect(err).NotTo(HaveOccurred())
+		target := searchAPI.HandlerTarget(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+
+		report, err := searchAPI.Replay(context.Background(), target, queries, searchAPI.ReplayPolicy{Workers: 2, Requests: 9})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Requests).To(Equal(9))
+		Expect(report.Statuses).To(Equal(map[int]int{http.StatusOK: 6, http.StatusBadRequest: 3}))
+		Expect(report.Errors).To(BeZero())
+		Expect(report.Latency.P50MS).To(BeNumerically(">", 0))
+		Expect(report.Latency.P50MS).To(BeNumerically("<=", report.Latency.P90MS))
+		Expect(report.Latency.P90MS).To(BeNumerically("<=", report.Latency.P99MS))
+		Expect(report.Latency.P99MS).To(BeNumerically("<=", report.Latency.MaxMS))
+		Expect(report.QPS).To(BeNumerically(">", 0))
+		Expect(report.AllocsPerRequest).To(BeNumerically(">", 0))
+		Expect(report.BytesPerRequest).To(BeNumerically(">", 0))
+
+		b, err := json.Marshal(report)
+		Expect(err).NotTo(HaveOccurred())
+		var fields map[string]any
+		Expect(json.Unmarshal(b, &fields)).To(Succeed())
+		Expect(fields).To(HaveKey("latency"))
+		Expect(fields["latency"]).To(HaveKey("p99_ms"))
+		Expect(fields["statuses"]).To(HaveKeyWithValue("200", BeEquivalentTo(6)))
+	})
+
+	It("replays against a server at the target rate", func() {
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+		DeferCleanup(se.Close)
+
+		start := time.Now()
+		report, err := searchAPI.Replay(context.Background(), searchAPI.URLTarget(se.URL, se.Client()), []url.Values{{"q": {"lion"}}}, searchAPI.ReplayPolicy{QPS: 100, Requests: 5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(report.Statuses).To(Equal(map[int]int{http.StatusOK: 5}))
+		Expect(report.AllocsPerRequest).To(BeZero(), "the allocations are only measured in process")
+	})
+
+	It("counts the transport failures as errors", func() {
+		se := httptest.NewServer(http.NotFoundHandler())
+		se.Close()
+
+		report, err := searchAPI.Replay(context.Background(), searchAPI.URLTarget(se.URL, nil), []url.Values{{"q": {"lion"}}}, searchAPI.ReplayPolicy{Requests: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Errors).To(Equal(2))
+		Expect(report.Statuses).To(Equal(map[int]int{0: 2}))
+		Expect(report.ErrorRate()).To(Equal(1.0))
+	})
+
+	It("refuses an empty log", func() {
+		_, err := searchAPI.Replay(context.Background(), searchAPI.URLTarget("http://localhost", nil), nil, searchAPI.ReplayPolicy{})
+		Expect(err).To(MatchError(searchAPI.ErrEmptyQueryLog))
+	})
+
+	It("compares the report to a baseline", func() {
+		baseline := searchAPI.ReplayReport{
+			Requests:         100,
+			Latency:          searchAPI.LatencyPercentiles{P50MS: 1, P90MS: 2, P99MS: 4},
+			AllocsPerRequest: 100,
+		}
+		current := baseline
+		current.Latency.P50MS = 1.05
+		current.Latency.P99MS = 5
+		current.Errors = 1
+
+		regressions := searchAPI.CompareReplay(baseline, current, 0.1)
+		Expect(regressions).To(HaveLen(2))
+		Expect(regressions[0].Metric).To(Equal("latency_p99_ms"))
+		Expect(regressions[0].Change).To(BeNumerically("~", 0.25, 1e-9))
+		Expect(regressions[1].Metric).To(Equal("error_rate"))
+
+		Expect(searchAPI.CompareReplay(baseline, baseline, 0.1)).To(BeEmpty())
+	})
+})
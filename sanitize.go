@@ -0,0 +1,63 @@
+package inkinspot
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Sanitizer coarsens the counts of the public aggregates so no small group of searches or tattoos shows through.
+// Zero values are replaced by the defaults.
+type Sanitizer struct {
+	// MinCount is the least count published, the smaller buckets are left out.
+	MinCount int
+	// Granularity is the multiple the published counts are rounded to.
+	Granularity int
+}
+
+func (s Sanitizer) withDefaults() Sanitizer {
+	if s.MinCount <= 0 {
+		s.MinCount = 10
+	}
+	if s.Granularity <= 0 {
+		s.Granularity = 10
+	}
+
+	return s
+}
+
+// Count returns the count rounded to the nearest multiple of the granularity.
+// It returns false for the counts below the minimum, or rounded to 0.
+func (s Sanitizer) Count(n int) (int, bool) {
+	s = s.withDefaults()
+	if n < s.MinCount {
+		return 0, false
+	}
+	rounded := int(math.Round(float64(n)/float64(s.Granularity))) * s.Granularity
+
+	return rounded, rounded > 0
+}
+
+// Buckets returns the sanitized counts of the buckets, the largest first, ties by label, at most limit when positive.
+// The buckets are ranked by their exact counts, a rounding never reorders them.
+func (s Sanitizer) Buckets(counts map[string]int, limit int) []LabelCount {
+	exact := make([]LabelCount, 0, len(counts))
+	for label, n := range counts {
+		exact = append(exact, LabelCount{Label: label, Count: n})
+	}
+	slices.SortFunc(exact, func(a, b LabelCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Label, b.Label))
+	})
+
+	out := make([]LabelCount, 0, len(exact))
+	for _, bucket := range exact {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		if n, ok := s.Count(bucket.Count); ok {
+			out = append(out, LabelCount{Label: bucket.Label, Count: n})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,48 @@
+package inkinspot_test
+
+import (
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sanitizer", func() {
+	s := searchAPI.Sanitizer{MinCount: 5, Granularity: 10}
+
+	DescribeTable("counts",
+		func(n, want int, ok bool) {
+			got, published := s.Count(n)
+			Expect(published).To(Equal(ok))
+			Expect(got).To(Equal(want))
+		},
+		Entry("suppresses the counts below the minimum", 4, 0, false),
+		Entry("suppresses the counts rounded to 0", 5, 10, true),
+		Entry("rounds down", 14, 10, true),
+		Entry("rounds half up", 15, 20, true),
+		Entry("keeps the multiples", 120, 120, true),
+	)
+
+	It("suppresses the small counts rounded to 0", func() {
+		_, ok := searchAPI.Sanitizer{MinCount: 1, Granularity: 10}.Count(4)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("ranks the buckets by their exact counts", func() {
+		buckets := s.Buckets(map[string]int{"lion": 14, "rose": 11, "tiger": 16, "skull": 3, "koi": 40}, 3)
+		Expect(buckets).To(Equal([]searchAPI.LabelCount{
+			{Label: "koi", Count: 40},
+			{Label: "tiger", Count: 20},
+			{Label: "lion", Count: 10},
+		}))
+	})
+
+	It("leaves out the small buckets", func() {
+		buckets := s.Buckets(map[string]int{"lion": 14, "skull": 3, "rose": 4}, 0)
+		Expect(buckets).To(Equal([]searchAPI.LabelCount{{Label: "lion", Count: 10}}))
+	})
+
+	It("defaults to buckets of at least 10, rounded to 10", func() {
+		Expect(searchAPI.Sanitizer{}.Buckets(map[string]int{"lion": 9, "rose": 26}, 0)).To(Equal([]searchAPI.LabelCount{{Label: "rose", Count: 30}}))
+	})
+})
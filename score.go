@@ -0,0 +1,122 @@
+package inkinspot
+
+import (
+	"fmt"
+	"math"
+)
+
+// Score normalizations of ScorePolicy.
+const (
+	// NormalizeMax divides the scores by the best score of the result set.
+	NormalizeMax = "max"
+	// NormalizeSigmoid maps every raw score alone by tanh(raw / SigmoidScale).
+	NormalizeSigmoid = "sigmoid"
+)
+
+// Combinations of the scores of the IDs a vector store matched more than once, see ScorePolicy.
+const (
+	// DuplicatesMax keeps the score of the first, best ranked, match.
+	DuplicatesMax = "max"
+	// DuplicatesSum adds up the scores of every match, the IDs matched by many chunks rank higher.
+	DuplicatesSum = "sum"
+)
+
+// ScorePolicy controls how the raw scores are mapped into [0, 1].
+// Both normalizations are monotonic, they never reorder the results.
+// With NormalizeMax the best result always scores 1, a single result included.
+// With NormalizeSigmoid scores are comparable across queries.
+type ScorePolicy struct {
+	Normalization string
+	// SigmoidScale is the raw score which maps to tanh(1) ≈ 0.76.
+	SigmoidScale float64
+	// Duplicates combines the scores of an ID matched more than once by a query, DuplicatesMax or DuplicatesSum.
+	Duplicates string
+}
+
+func (p ScorePolicy) withDefaults() ScorePolicy {
+	if p.Normalization == "" {
+		p.Normalization = NormalizeMax
+	}
+	if p.SigmoidScale <= 0 {
+		p.SigmoidScale = 100
+	}
+	if p.Duplicates == "" {
+		p.Duplicates = DuplicatesMax
+	}
+
+	return p
+}
+
+// Validate checks the normalization & the duplicates combination, with the defaults applied, are known.
+func (p ScorePolicy) Validate() error {
+	p = p.withDefaults()
+	if p.Normalization != NormalizeMax && p.Normalization != NormalizeSigmoid {
+		return fmt.Errorf("%w: unknown normalization %q", ErrInvalidScorePolicy, p.Normalization)
+	}
+	if p.Duplicates != DuplicatesMax && p.Duplicates != DuplicatesSum {
+		return fmt.Errorf("%w: unknown duplicates combination %q", ErrInvalidScorePolicy, p.Duplicates)
+	}
+
+	return nil
+}
+
+// normalize sets the scores into [0, 1], the raw scores are kept aside.
+func (p ScorePolicy) normalize(ranked []RankedVector) {
+	best := 0.0
+	for _, rv := range ranked {
+		best = max(best, rv.Score)
+	}
+
+	for i := range ranked {
+		raw := ranked[i].Score
+		ranked[i].RawScore = raw
+
+		switch {
+		case raw <= 0:
+			ranked[i].Score = 0
+		case p.Normalization == NormalizeSigmoid:
+			ranked[i].Score = math.Tanh(raw / p.SigmoidScale)
+		default:
+			ranked[i].Score = raw / best
+		}
+	}
+}
+
+// scoreMatches scores the IDs a query matched by their positions, see positionalScore.
+// An ID matched more than once keeps its first position, its scores are combined by the policy.
+// The matches are scored in order with a single lookup, whatever their number.
+func (p ScorePolicy) scoreMatches(matched []string) []RankedVector {
+	scored := make([]RankedVector, 0, len(matched))
+	first := make(map[string]int, len(matched))
+	for i, id := range matched {
+		score := positionalScore(i, len(matched))
+		at, ok := first[id]
+		switch {
+		case !ok:
+			first[id] = len(scored)
+			scored = append(scored, RankedVector{ID: id, Score: score})
+		case p.Duplicates == DuplicatesSum:
+			scored[at].Score += score
+		}
+	}
+
+	return scored
+}
+
+// filterMinScore drops the trailing ranked vectors scoring below min.
+func filterMinScore(ranked []RankedVector, min float64) []RankedVector {
+	for len(ranked) > 0 && ranked[len(ranked)-1].Score < min {
+		ranked = ranked[:len(ranked)-1]
+	}
+
+	return ranked
+}
+
+// validateMinScore reports whether min is a normalized score.
+func validateMinScore(min float64) error {
+	if math.IsNaN(min) || min < 0 || min > 1 {
+		return fmt.Errorf("%w: min_score must be within 0 and 1", ErrInvalidMinScore)
+	}
+
+	return nil
+}
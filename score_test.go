@@ -0,0 +1,96 @@
+package inkinspot_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Score normalization", func() {
+	initServer := func(p searchAPI.ScorePolicy) *httptest.Server {
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{ScorePolicy: p})))
+		DeferCleanup(se.Close)
+
+		return se
+	}
+
+	DescribeTable("scores are within [0, 1] and keep the raw order",
+		func(p searchAPI.ScorePolicy) {
+			se := initServer(p)
+			res := doSearch(se, url.Values{"q": {"lion chest"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+
+			hits := res.JSON.Explain.Hits
+			Expect(hits).To(HaveLen(3))
+			for i, h := range hits {
+				Expect(h.Score).To(And(BeNumerically(">", 0), BeNumerically("<=", 1)))
+				if i > 0 {
+					Expect(h.Score).To(BeNumerically("<=", hits[i-1].Score))
+					Expect(h.RawScore).To(BeNumerically("<=", hits[i-1].RawScore))
+				}
+			}
+			Expect(hits[0].RawScore).To(BeNumerically("==", 200))
+		},
+		Entry("max", searchAPI.ScorePolicy{Normalization: searchAPI.NormalizeMax}),
+		Entry("sigmoid", searchAPI.ScorePolicy{Normalization: searchAPI.NormalizeSigmoid}),
+	)
+
+	It("scores relative to the best result with max", func() {
+		se := initServer(searchAPI.ScorePolicy{})
+		res := doSearch(se, url.Values{"q": {"lion chest"}, "explain": {"true"}})
+		Expect(res.JSON.Explain.Hits[0].Score).To(BeNumerically("==", 1))
+		Expect(res.JSON.Explain.Hits[1].Score).To(BeNumerically("==", 0.5))
+
+		res = doSearch(se, url.Values{"q": {"tiger"}, "explain": {"true"}})
+		Expect(res.JSON.Explain.Hits).To(HaveLen(1))
+		Expect(res.JSON.Explain.Hits[0].Score).To(BeNumerically("==", 1))
+	})
+
+	It("scores a single result by its raw score with sigmoid", func() {
+		se := initServer(searchAPI.ScorePolicy{Normalization: searchAPI.NormalizeSigmoid, SigmoidScale: 100})
+		res := doSearch(se, url.Values{"q": {"tiger"}, "explain": {"true"}})
+		Expect(res.JSON.Explain.Hits).To(HaveLen(1))
+		Expect(res.JSON.Explain.Hits[0].Score).To(BeNumerically("~", math.Tanh(1), 1e-9))
+	})
+
+	DescribeTable("validates the policy",
+		func(p searchAPI.ScorePolicy, valid bool) {
+			if valid {
+				Expect(p.Validate()).To(Succeed())
+			} else {
+				Expect(p.Validate()).To(MatchError(searchAPI.ErrInvalidScorePolicy))
+			}
+		},
+		Entry("the defaults", searchAPI.ScorePolicy{}, true),
+		Entry("sigmoid summing the duplicates", searchAPI.ScorePolicy{Normalization: searchAPI.NormalizeSigmoid, Duplicates: searchAPI.DuplicatesSum}, true),
+		Entry("an unknown normalization", searchAPI.ScorePolicy{Normalization: "softmax"}, false),
+		Entry("an unknown duplicates combination", searchAPI.ScorePolicy{Duplicates: "avg"}, false),
+	)
+
+	When("min_score is set", func() {
+		It("drops the hits scoring below it", func() {
+			se := initServer(searchAPI.ScorePolicy{})
+			res := doSearch(se, url.Values{"q": {"lion chest"}, "min_score": {"0.6"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X"}))
+		})
+
+		DescribeTable("invalid values return a 400 Bad Request",
+			func(value string) {
+				se := initServer(searchAPI.ScorePolicy{})
+				res := doSearch(se, url.Values{"q": {"lion"}, "min_score": {value}})
+				Expect(res.Status).To(Equal(http.StatusBadRequest))
+				Expect(res.JSON.Error.Code).To(Equal("invalid_min_score"))
+			},
+			Entry("above 1", "1.5"),
+			Entry("negative", "-0.1"),
+			Entry("not a number", "abc"),
+		)
+	})
+})
@@ -0,0 +1,667 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SearchHit is a collection matched by a search & its ranking.
+// Vector is the ranked vector, zero when the vector store has no lookups.
+// DistanceKM is how far the collection is from the center of the near filter, zero without one.
+type SearchHit struct {
+	Collection TattooImagesCollection
+	Vector     TattooImagesVector
+	DistanceKM float64
+	RankedVector
+}
+
+// SearchOptions tunes a single search.
+// The zero value searches with the configured defaults.
+type SearchOptions struct {
+	// Lang is the BCP 47 tag selecting the query language rules.
+	Lang string
+	// Weights override the configured facet weights.
+	Weights WeightOverrides
+	// MinScore drops the hits with a lower normalized score.
+	MinScore float64
+	// Offset & Limit select the page of hits, a zero Limit is the default page size, every hit when none is configured.
+	Offset int
+	Limit  int
+	// Cursor resumes after the page it was issued for, instead of an offset.
+	Cursor string
+	// Artist keeps the hits of the artist with the handle.
+	Artist string
+	// Filters keep the hits carrying their labels, a search of them alone browses the catalog.
+	Filters FacetFilters
+	// Near keeps the hits located within RadiusKM of it, when it's set.
+	Near     *Location
+	RadiusKM float64
+	// Consistency is the token of a write the search must reflect, it bypasses the caches.
+	Consistency string
+	// BestEffort returns the hits fetched before the image store timeout instead of failing.
+	BestEffort bool
+	// Timeouts override the store timeouts of the search, when set. The overridden searches bypass the cache.
+	Timeouts *TimeoutPolicy
+	// Experiment ranks the search by the variant of the client's assignment, see AssignExperiment.
+	Experiment ExperimentAssignment
+}
+
+// SearchResult holds the outcome of a search.
+type SearchResult struct {
+	// Queries are the parsed queries which were searched, none when the filters were browsed.
+	Queries []ParsedQuery
+	// Filters are the facet filters the hits passed.
+	Filters FacetFilters
+	// Hits are the page ordered by descending score.
+	// It may be short of the limit when the image store misses collections.
+	Hits []SearchHit
+	// Total is the number of matches the page is taken from.
+	Total int
+	// HasMore reports whether matches are ranked past the page.
+	HasMore bool
+	// NextCursor resumes after the page, empty when there are no more.
+	NextCursor string
+	// Ranking is the policy the hits were ranked by.
+	Ranking RankingPolicy
+	// Experiment is the assignment the search was ranked by.
+	Experiment ExperimentAssignment
+	// Timings are the durations of the search stages.
+	Timings SearchTimings
+	// CacheHit reports whether the result was served from the cache.
+	CacheHit bool
+	// Partial reports whether hits of the page are missing, TimedOut whether the image store timeout dropped them.
+	Partial  bool
+	TimedOut bool
+	// CacheStale reports whether the cached result was past its refresh age, it's refreshed in the background.
+	CacheStale bool
+	// Stale reports whether the result is the last known good one, served while the vector store fails.
+	// StaleAge is how old it is.
+	Stale    bool
+	StaleAge time.Duration
+}
+
+// SearchTimings are the durations of the search stages.
+// The stores are zero when the result came from the cache.
+type SearchTimings struct {
+	VectorStore time.Duration
+	ImageStore  time.Duration
+	Total       time.Duration
+	// VectorStoreBudget & ImageStoreBudget are the timeouts planned for the store calls.
+	VectorStoreBudget time.Duration
+	ImageStoreBudget  time.Duration
+}
+
+// Collections returns the image collections of the hits in rank order.
+func (r *SearchResult) Collections() []TattooImagesCollection {
+	out := make([]TattooImagesCollection, 0, len(r.Hits))
+	for _, h := range r.Hits {
+		out = append(out, h.Collection)
+	}
+
+	return out
+}
+
+// Distances returns the distances of the hits from the center of the near filter, by collection ID.
+func (r *SearchResult) Distances() map[string]float64 {
+	out := make(map[string]float64, len(r.Hits))
+	for _, h := range r.Hits {
+		out[h.Collection.ID] = h.DistanceKM
+	}
+
+	return out
+}
+
+// Rankings returns the scores & matched labels of the hits in rank order.
+func (r *SearchResult) Rankings() []RankedVector {
+	out := make([]RankedVector, 0, len(r.Hits))
+	for _, h := range r.Hits {
+		out = append(out, h.RankedVector)
+	}
+
+	return out
+}
+
+// QueryTexts returns the normalized text of the searched queries.
+func (r *SearchResult) QueryTexts() []string {
+	out := make([]string, 0, len(r.Queries))
+	for _, q := range r.Queries {
+		out = append(out, q.Text)
+	}
+
+	return out
+}
+
+// MultiSearch searches every query and merges the results as an OR search.
+// A collection matched by several queries appears once with its best score.
+// Results may come from the cache and must not be modified.
+func (e *SearchEngine) MultiSearch(ctx context.Context, queries []string, opts SearchOptions) (*SearchResult, error) {
+	start := e.clock.Now()
+	gen := e.cache.generation()
+
+	plan, err := e.planSearch(queries, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeouts != nil {
+		return e.runSearch(withStoreTimeouts(ctx, *opts.Timeouts), plan, start)
+	}
+	if opts.Consistency != "" {
+		return e.consistentSearch(ctx, plan, start)
+	}
+	if cached, ok := e.cache.get(plan.key); ok {
+		if cached.refresh {
+			go e.refresh(plan)
+		}
+		res := *cached.result
+		res.Hits = dropExpired(res.Hits, e.clock.Now())
+		res.CacheHit = true
+		res.CacheStale = cached.stale
+		res.Timings = SearchTimings{Total: e.clock.Now().Sub(start)}
+		return &res, nil
+	}
+
+	res, err := e.runSearch(ctx, plan, start)
+	if err != nil {
+		if last, ok := e.fallback(plan.key, err); ok {
+			slog.WarnContext(ctx, "serving the last known good result", "age", last.StaleAge, "error", err)
+			last.Timings = SearchTimings{Total: e.clock.Now().Sub(start)}
+			return last, nil
+		}
+		return nil, err
+	}
+	e.keep(plan.key, gen, res)
+
+	return res, nil
+}
+
+// refresh searches the plan again in the background & swaps the fresh result into the cache.
+// A failed refresh leaves the stale result to expire.
+func (e *SearchEngine) refresh(plan searchPlan) {
+	ctx := context.Background()
+	gen := e.cache.generation()
+	res, err := e.runSearch(ctx, plan, e.clock.Now())
+	if err != nil {
+		slog.WarnContext(ctx, "cache refresh failed", "queries", len(plan.queries), "error", err)
+		return
+	}
+	e.keep(plan.key, gen, res)
+}
+
+// keep caches the result & keeps it as the last known good one, unless it's partial.
+func (e *SearchEngine) keep(key string, gen uint64, res *SearchResult) {
+	if res.Partial {
+		return
+	}
+	e.cache.put(key, gen, res, e.resultTokens(res))
+	e.lastGood.put(key, res)
+}
+
+// runSearch searches the stores for the plan, bypassing the cache.
+func (e *SearchEngine) runSearch(ctx context.Context, plan searchPlan, start time.Time) (*SearchResult, error) {
+	ctx = withRankingTime(ctx, plan.at)
+
+	// the collections found last time are fetched while the vector store is queried.
+	var prefetch <-chan []TattooImagesCollection
+	if ids := e.speculation.recall(plan.key); len(ids) > 0 {
+		prefetch = e.prefetch(ctx, ids)
+	}
+
+	vectorStart := e.clock.Now()
+	vectorBudget := e.vectorStoreBudget(ctx)
+	parsed, err := e.correctQueries(ctx, plan.queries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pq := range parsed {
+		slog.DebugContext(ctx, "search", e.queryLabels.attr("query", pq.Text), "lang", pq.Lang, e.queryLabels.attr("stems", strings.Join(pq.Stems, " ")))
+	}
+
+	var (
+		ranked    []RankedVector
+		truncated bool
+		vectors   map[string]TattooImagesVector
+	)
+	if len(parsed) == 0 {
+		if ranked, vectors, err = e.browse(ctx, plan.opts.Filters, plan.ranking, plan.settings); err != nil {
+			return nil, err
+		}
+	} else {
+		if ranked, truncated, err = e.matchIDs(ctx, parsed, e.storeWant(plan)); err != nil {
+			return nil, err
+		}
+		if ranked, vectors, err = e.rank(ctx, parsed, ranked, plan.ranking, plan.settings); err != nil {
+			return nil, err
+		}
+		if len(plan.opts.Filters) > 0 {
+			if ranked, err = e.filterLabels(ctx, ranked, plan.opts.Filters); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ranked = e.boostPopularity(ctx, ranked, plan.ranking)
+	e.configuration.ScorePolicy.normalize(ranked)
+	ranked = filterMinScore(ranked, plan.opts.MinScore)
+	if plan.opts.Artist != "" {
+		if ranked, err = e.filterArtist(ctx, ranked, plan.opts.Artist); err != nil {
+			return nil, err
+		}
+	}
+	var distances map[string]float64
+	if plan.opts.Near != nil {
+		if ranked, distances, err = e.filterNear(ctx, ranked, *plan.opts.Near, plan.opts.RadiusKM); err != nil {
+			return nil, err
+		}
+	}
+
+	ranked, hidden, err := e.dropHidden(ctx, ranked)
+	if err != nil {
+		return nil, err
+	}
+	total, err := e.countMatches(ctx, parsed, ranked, plan.opts, truncated, hidden)
+	if err != nil {
+		return nil, err
+	}
+	offset := plan.opts.Offset
+	if plan.cursor != nil {
+		_, lookup := storeAs[VectorLookup](e.vectorStore)
+		offset = plan.cursor.after(ranked, !lookup)
+	}
+	page := paginate(ranked, offset, plan.opts.Limit)
+	vectorTook := e.clock.Now().Sub(vectorStart)
+
+	imageBudget, err := e.imageStoreBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	imageStart := e.clock.Now()
+	hits, partial, timedOut, err := e.fetchHits(ctx, page, len(page) == len(ranked) && !truncated, vectors, prefetch, imageBudget, plan.opts.BestEffort || e.configuration.TimeoutPolicy.SoftTimeout)
+	if err != nil {
+		return nil, err
+	}
+	imageTook := e.clock.Now().Sub(imageStart)
+	for i := range hits {
+		hits[i].DistanceKM = distances[hits[i].Collection.ID]
+	}
+	e.speculation.remember(plan.key, page)
+
+	// the page is counted by its ranked matches, the image store may miss some.
+	res := &SearchResult{
+		Queries:    parsed,
+		Filters:    plan.opts.Filters,
+		Hits:       hits,
+		Total:      total,
+		HasMore:    offset+len(page) < total || truncated,
+		Ranking:    plan.ranking,
+		Experiment: plan.opts.Experiment,
+		Timings: SearchTimings{
+			VectorStore: vectorTook, ImageStore: imageTook, Total: e.clock.Now().Sub(start),
+			VectorStoreBudget: vectorBudget, ImageStoreBudget: imageBudget,
+		},
+		Partial:  partial || timedOut,
+		TimedOut: timedOut,
+	}
+	if res.HasMore && len(page) > 0 {
+		last := page[len(page)-1]
+		res.NextCursor = encodeCursor(e.configuration.CursorPolicy.Secret, searchCursor{Search: plan.fingerprint, RawScore: last.RawScore, ID: last.ID, At: plan.at.UnixNano()})
+	}
+
+	return res, nil
+}
+
+// searchPlan is a validated search & the cache key of its page.
+type searchPlan struct {
+	queries  []ParsedQuery
+	ranking  RankingPolicy
+	opts     SearchOptions
+	search   string
+	cursor   *searchCursor
+	settings *runtimeSettings
+	key      string
+	// fingerprint identifies the ranking of the search in its cursors.
+	fingerprint string
+	// at is the time the search ranks as of, the cursor's for its next pages.
+	at time.Time
+}
+
+// planSearch validates the queries & options of a search and keys its page.
+func (e *SearchEngine) planSearch(queries []string, opts SearchOptions) (searchPlan, error) {
+	filters, err := opts.Filters.normalized()
+	if err != nil {
+		return searchPlan{}, err
+	}
+	opts.Filters = filters
+
+	// the searches of the filters alone browse them.
+	parsed, err := e.prepareQueries(queries, opts)
+	if errors.Is(err, ErrSearchEmptyQuery) && len(filters) > 0 && !e.configuration.QueryPolicy.RequireQuery {
+		err = nil
+	}
+	if err != nil {
+		return searchPlan{}, err
+	}
+
+	base := e.configuration.RankingPolicy
+	if opts.Experiment.ranking != nil {
+		base = *opts.Experiment.ranking
+	}
+	ranking, err := opts.Weights.apply(base)
+	if err != nil {
+		return searchPlan{}, err
+	}
+	if err := validateMinScore(opts.MinScore); err != nil {
+		return searchPlan{}, err
+	}
+	if opts.Near != nil {
+		if err := validateNear(*opts.Near, opts.RadiusKM); err != nil {
+			return searchPlan{}, err
+		}
+	}
+	opts.Offset, opts.Limit, err = e.configuration.PagePolicy.page(opts.Offset, opts.Limit)
+	if err != nil {
+		return searchPlan{}, err
+	}
+	if opts.Cursor != "" && opts.Offset != 0 {
+		return searchPlan{}, fmt.Errorf("%w: offset can't be combined with a cursor", ErrInvalidPage)
+	}
+
+	search := searchKey(parsed, ranking, opts)
+	settings := e.settings.Load()
+	fingerprint := e.rankedFingerprint(search, settings, ranking)
+	at := e.clock.Now()
+	var cursor *searchCursor
+	if opts.Cursor != "" {
+		c, err := decodeCursor(e.configuration.CursorPolicy.Secret, opts.Cursor, fingerprint)
+		if err != nil {
+			return searchPlan{}, err
+		}
+		cursor = &c
+		if c.At != 0 {
+			at = time.Unix(0, c.At)
+		}
+	}
+
+	return searchPlan{
+		queries:     parsed,
+		ranking:     ranking,
+		opts:        opts,
+		search:      search,
+		cursor:      cursor,
+		settings:    settings,
+		key:         searchCacheKey(search, settings, opts),
+		fingerprint: fingerprint,
+		at:          at,
+	}, nil
+}
+
+// prepareQueries normalizes & deduplicates the queries, applies the limits.
+// And parses them by the rules of the requested language.
+func (e *SearchEngine) prepareQueries(queries []string, opts SearchOptions) ([]ParsedQuery, error) {
+	policy := e.configuration.QueryPolicy
+	if len(queries) > policy.MaxQueryValues {
+		return nil, fmt.Errorf("%w: got %d queries, limit is %d", ErrTooManyQueries, len(queries), policy.MaxQueryValues)
+	}
+
+	tag := opts.Lang
+	if tag == "" {
+		tag = policy.DefaultLanguage
+	}
+	lang, err := lookupLanguage(tag)
+	if err != nil {
+		return nil, err
+	}
+	analyzer := policy.analyzer(lang)
+
+	seen := make(map[string]bool, len(queries))
+	out := make([]ParsedQuery, 0, len(queries))
+	for _, raw := range queries {
+		q := analyzer.Normalizer.Normalize(raw)
+		if q == "" {
+			continue
+		}
+
+		q, err := applyQueryLimits(policy, q)
+		if err != nil {
+			return nil, err
+		}
+		if seen[q] {
+			continue
+		}
+		seen[q] = true
+
+		// a query made of stopwords only has nothing to match.
+		pq, err := parseQuery(q, analyzer, policy.synonyms(analyzer.Normalizer), isBooleanQuery(raw))
+		if err != nil {
+			return nil, err
+		}
+		if len(pq.Terms) > 0 {
+			out = append(out, pq)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, ErrSearchEmptyQuery
+	}
+
+	return out, nil
+}
+
+// matchIDs queries the vector store for every query concurrently.
+// The IDs are merged by their best score, ordered by descending score, ties by ID.
+// The repeats of an ID within a query are combined by the score policy.
+// A VectorStorePager is only asked for the first want IDs of every query, when want is set.
+// It reports whether some query was cut short.
+func (e *SearchEngine) matchIDs(ctx context.Context, queries []ParsedQuery, want int) ([]RankedVector, bool, error) {
+	vqCtx, vqCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vqCancel()
+
+	results := make([][]string, len(queries))
+	truncated := make([]bool, len(queries))
+	errs := make([]error, len(queries))
+
+	pager, paged := storeAs[VectorStorePager](e.vectorStore)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := strings.Join(q.Stems, " ")
+			if paged && want > 0 {
+				results[i], truncated[i], errs[i] = e.pageIDs(vqCtx, pager, query, want)
+				return
+			}
+			results[i], errs[i] = e.vectorStore.GetIDsByQuery(vqCtx, query)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, false, e.storeError(VectorStoreName, "query", err)
+	}
+
+	// the stores may match an ID more than once, every query's matches are deduped first.
+	ranked := e.configuration.ScorePolicy.scoreMatches(results[0])
+	if len(results) > 1 {
+		index := make(map[string]int, len(ranked))
+		for i, rv := range ranked {
+			index[rv.ID] = i
+		}
+		for _, matched := range results[1:] {
+			for _, rv := range e.configuration.ScorePolicy.scoreMatches(matched) {
+				at, ok := index[rv.ID]
+				if !ok {
+					index[rv.ID] = len(ranked)
+					ranked = append(ranked, rv)
+					continue
+				}
+				if rv.Score > ranked[at].Score {
+					ranked[at].Score = rv.Score
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	return ranked, slices.Contains(truncated, true), nil
+}
+
+// pageIDs lists the pages of the matches of the query until there are want of them.
+// It reports whether the store has more.
+func (e *SearchEngine) pageIDs(ctx context.Context, pager VectorStorePager, query string, want int) ([]string, bool, error) {
+	var ids []string
+	cursor := ""
+	for {
+		page, next, err := pager.GetIDsByQueryPage(ctx, query, cursor, e.configuration.PagePolicy.StorePageSize)
+		if err != nil {
+			return nil, false, err
+		}
+		ids = append(ids, page...)
+		if next == "" {
+			return ids, false, nil
+		}
+		if len(ids) >= want {
+			return ids, true, nil
+		}
+		cursor = next
+	}
+}
+
+// positionalScore rates a match by its position in the vector store ranking.
+// The first match rates 1, the rest decrease evenly towards 0.
+func positionalScore(position, total int) float64 {
+	return 1 - float64(position)/float64(total)
+}
+
+// rank rescores the matches with the ranker over their stored vectors.
+// Vector stores without lookups keep their own ranking,
+// their matches can't be held to a boolean expression: it returns ErrBooleanUnsupported.
+// Matches without a stored vector or a score are dropped.
+// It returns the ranked vectors by ID alongside.
+func (e *SearchEngine) rank(ctx context.Context, queries []ParsedQuery, matched []RankedVector, ranking RankingPolicy, settings *runtimeSettings) ([]RankedVector, map[string]TattooImagesVector, error) {
+	lookup, ok := storeAs[VectorLookup](e.vectorStore)
+	if !ok {
+		for _, q := range queries {
+			if q.expr != nil {
+				return nil, nil, fmt.Errorf("%w: %q has no vector lookup to evaluate it against", ErrBooleanUnsupported, q.Text)
+			}
+		}
+	}
+	if !ok || len(matched) == 0 {
+		return matched, nil, nil
+	}
+
+	ids := make([]string, 0, len(matched))
+	for _, m := range matched {
+		ids = append(ids, m.ID)
+	}
+
+	vlCtx, vlCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vlCancel()
+
+	vectors, err := lookup.GetVectorsByID(vlCtx, ids)
+	if err != nil {
+		return nil, nil, e.storeError(VectorStoreName, "lookup", err)
+	}
+
+	// the store matches broadly, the ones the ranker can't score are dropped.
+	ranked := e.scoreCandidates(queries, vectors, ranking, settings, e.rankingTime(ctx))
+
+	byID := make(map[string]TattooImagesVector, len(vectors))
+	for _, v := range vectors {
+		byID[v.ID] = v
+	}
+
+	return ranked, byID, nil
+}
+
+// scoreCandidates ranks the candidates by the weights & the boosts of the settings, fresh as of the time.
+// The candidates which don't score are dropped.
+func (e *SearchEngine) scoreCandidates(queries []ParsedQuery, candidates []TattooImagesVector, ranking RankingPolicy, settings *runtimeSettings, at time.Time) []RankedVector {
+	ranker := *e.ranker
+	ranker.Clock = pinnedClock{Clock: ranker.Clock, at: at}
+	ranker.Policy = ranking
+	ranker.Boosts = settings.boosts
+	ranked := ranker.Rank(queries, candidates)
+	for len(ranked) > 0 && ranked[len(ranked)-1].Score <= 0 {
+		ranked = ranked[:len(ranked)-1]
+	}
+
+	return ranked
+}
+
+// fetchHits loads the visible image collections of the ranked IDs within the timeout, the prefetched ones are reconciled.
+// The hits keep the rank order whatever order the image store answered in.
+// The IDs of the failed shards of a sharded store are left out & partial is set.
+// It returns ErrImageStoreEmpty when the IDs are every match of the search & none is found,
+// the pages of a part of the matches are only empty.
+func (e *SearchEngine) fetchHits(ctx context.Context, ranked []RankedVector, every bool, vectors map[string]TattooImagesVector, prefetch <-chan []TattooImagesCollection, timeout time.Duration, bestEffort bool) (hits []SearchHit, partial, timedOut bool, err error) {
+	ids := make([]string, 0, len(ranked))
+	position := make(map[string]int, len(ranked))
+	for i, rv := range ranked {
+		ids = append(ids, rv.ID)
+		position[rv.ID] = i
+	}
+
+	isCtx, isCancel := e.withTightTimeout(ctx, timeout)
+	defer isCancel()
+
+	// the IDs the image store doesn't know are left out of the hits.
+	var imgs []TattooImagesCollection
+	if bestEffort {
+		imgs, partial, timedOut, err = e.fetchChunks(isCtx, ids, prefetch)
+	} else {
+		imgs, partial, err = shardsServed(foundOnly(e.fetchCollections(isCtx, ids, prefetch)))
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %w", ErrImageStoreTimeout, err)
+		}
+		return nil, false, false, e.storeError(ImageStoreName, "get", err)
+	}
+
+	// the chunks dropped by the timeout & the IDs of the failed shards aren't missing.
+	if !timedOut && !partial {
+		e.consistency.recordMissing(ctx, len(ids)-len(imgs))
+	}
+
+	// the vector store matched, but the image store has nothing for it.
+	if every && !partial && len(ids) > 0 && len(imgs) == 0 {
+		return nil, false, false, ErrImageStoreEmpty
+	}
+
+	rankOf := func(c TattooImagesCollection) int {
+		if i, ok := position[c.ID]; ok {
+			return i
+		}
+		return len(ranked)
+	}
+	sort.SliceStable(imgs, func(i, j int) bool { return rankOf(imgs[i]) < rankOf(imgs[j]) })
+
+	hits = make([]SearchHit, 0, len(imgs))
+	now := e.clock.Now()
+	for _, c := range imgs {
+		if c.Hidden || c.expired(now) {
+			continue
+		}
+		hit := SearchHit{Collection: c, Vector: vectors[c.ID], RankedVector: RankedVector{ID: c.ID}}
+		if i, ok := position[c.ID]; ok {
+			hit.RankedVector = ranked[i]
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits, partial, timedOut, nil
+}
@@ -1,14 +1,17 @@
-package main_test
+package inkinspot_test
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"time"
 
 	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -22,7 +25,12 @@ type HTTPResult struct {
 
 func doQuery(se *httptest.Server, query string) HTTPResult {
 	GinkgoHelper()
-	resp, err := http.Get(se.URL + "/search?q=" + url.QueryEscape(query))
+	return doSearch(se, url.Values{"q": {query}})
+}
+
+func doSearch(se *httptest.Server, params url.Values) HTTPResult {
+	GinkgoHelper()
+	resp, err := se.Client().Get(se.URL + "/search?" + params.Encode())
 	Expect(err).NotTo(HaveOccurred())
 	defer resp.Body.Close()
 
@@ -46,77 +54,43 @@ func doRequest(se *httptest.Server, method, query string, body io.Reader) *http.
 	return resp
 }
 
-func initSearchEngineHttpServer(ts searchAPI.ImageStore, vs searchAPI.VectorStore) *httptest.Server {
+// advanceDuring runs the request & advances the clock by d once the image store waits on it.
+// Then the request, the image store timeout & the image store delay are waiting on the clock.
+func advanceDuring[T any](clock *inkinspottest.FakeClock, d time.Duration, request func() T) T {
 	GinkgoHelper()
-	eng := searchAPI.NewSearchEngine(ts, vs)
-	srv := httptest.NewServer(searchAPI.NewHandler(eng))
+	done := make(chan T, 1)
+	go func() {
+		defer GinkgoRecover()
+		done <- request()
+	}()
 
-	return srv
-}
+	Eventually(clock.Waiters).Should(Equal(3))
+	clock.Advance(d)
 
-type fakeTattooImgStore []searchAPI.TattooImagesCollection
-
-func (ts fakeTattooImgStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
-	return ts, nil
-}
-
-func (ts *fakeTattooImgStore) AddCollection(ctx context.Context, c searchAPI.TattooImagesCollection) error {
-	*ts = append(*ts, c)
-	return nil
-}
-
-type fakeVectorStore struct{}
-
-func (vs *fakeVectorStore) GetIDsByQuery(ctx context.Context, q string) ([]string, error) {
-	return []string{"id"}, nil
+	var res T
+	Eventually(done).Should(Receive(&res))
+	return res
 }
 
-func (vs *fakeVectorStore) AddVector(ctx context.Context, v searchAPI.TattooImagesVector) error {
-	return nil
-}
+func initSearchEngineHttpServer(ts searchAPI.ImageStore, vs searchAPI.VectorStore) *httptest.Server {
+	GinkgoHelper()
+	eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, ts, vs)
+	srv := httptest.NewServer(searchAPI.NewHandler(eng))
 
-type testCaseTattoos struct {
-	collection searchAPI.TattooImagesCollection
-	vector     searchAPI.TattooImagesVector
+	return srv
 }
 
-var testCases = []testCaseTattoos{
-	{
-		searchAPI.TattooImagesCollection{
-			ID:   "X",
-			URLs: []string{"lion_realistic_bw_chest.jpg"},
-		},
-		searchAPI.TattooImagesVector{
-			ID:      "X",
-			Style:   searchAPI.LabelSet{"realistic": 100, "bw": 100},
-			Subject: searchAPI.LabelSet{"lion": 100},
-			Area:    searchAPI.LabelSet{"chest": 100},
-		},
-	},
-	{
-		searchAPI.TattooImagesCollection{
-			ID:   "Y",
-			URLs: []string{"lion_neotrad_color_arm.jpg"},
-		},
-		searchAPI.TattooImagesVector{
-			ID:      "Y",
-			Style:   searchAPI.LabelSet{"neotrad": 100, "color": 100},
-			Subject: searchAPI.LabelSet{"lion": 100},
-			Area:    searchAPI.LabelSet{"arm": 100},
-		},
-	},
-	{
-		searchAPI.TattooImagesCollection{
-			ID:   "Z",
-			URLs: []string{"tiger_abstract_bw_chest.jpg"},
-		},
-		searchAPI.TattooImagesVector{
-			ID:      "Z",
-			Style:   searchAPI.LabelSet{"abstract": 100, "bw": 100},
-			Subject: searchAPI.LabelSet{"tiger": 100},
-			Area:    searchAPI.LabelSet{"chest": 100},
-		},
-	},
+// initSeededSearchEngine creates an engine over in-memory stores loaded with the test cases.
+func initSeededSearchEngine(cfg searchAPI.Configuration) *searchAPI.SearchEngine {
+	GinkgoHelper()
+	is := searchAPI.NewMemoryImageStore()
+	vs := searchAPI.NewMemoryVectorStore()
+	for _, tc := range inkinspottest.BigCats {
+		Expect(is.AddCollection(context.Background(), tc.Collection)).To(Succeed())
+		Expect(vs.AddVector(context.Background(), tc.Vector)).To(Succeed())
+	}
+
+	return searchAPI.NewSearchEngine(cfg, is, vs)
 }
 
 var _ = Describe("Search API", func() {
@@ -125,7 +99,7 @@ var _ = Describe("Search API", func() {
 		var se *httptest.Server
 
 		BeforeEach(func() {
-			se = initSearchEngineHttpServer(&fakeTattooImgStore{}, &fakeVectorStore{})
+			se = initSearchEngineHttpServer(inkinspottest.NewFakeStores(inkinspottest.BigCats...))
 		})
 
 		AfterEach(func() {
@@ -144,9 +118,9 @@ var _ = Describe("Search API", func() {
 				})
 			})
 
-			When("Query is is not using GET method", func() {
+			When("Query is is not using GET or POST method", func() {
 				It("returns a 405 Method Not Allowed", func() {
-					resp := doRequest(se, http.MethodPost, "NOTGOT", nil)
+					resp := doRequest(se, http.MethodPut, "NOTGOT", nil)
 					defer resp.Body.Close()
 
 					statusCode := resp.StatusCode
@@ -154,13 +128,20 @@ var _ = Describe("Search API", func() {
 
 					allowHeader := resp.Header.Get("Allow")
 					Expect(allowHeader).To(ContainSubstring(http.MethodGet))
+					Expect(allowHeader).To(ContainSubstring(http.MethodPost))
 				})
 			})
 		})
 
 		Context("Image Store Issues", func() {
 			When("Image store is empty", func() {
-				q := "empty tattoo store"
+				q := "lion"
+
+				BeforeEach(func() {
+					se.Close()
+					_, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+					se = initSearchEngineHttpServer(inkinspottest.NewFakeImageStore(), vs)
+				})
 
 				It("returns a 500 Internal Server Error", func() {
 					res := doQuery(se, q)
@@ -173,8 +154,20 @@ var _ = Describe("Search API", func() {
 			})
 
 			When("Image store is timing out", func() {
+				var clock *inkinspottest.FakeClock
+
+				BeforeEach(func() {
+					se.Close()
+					clock = inkinspottest.NewFakeClock(time.Now())
+					is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+					slow := inkinspottest.NewLatencyStore(is, time.Hour, inkinspottest.WithLatencyClock(clock))
+					eng := searchAPI.NewSearchEngine(searchAPI.Configuration{}, slow, vs, searchAPI.WithClock(clock))
+					se = httptest.NewServer(searchAPI.NewHandler(eng))
+				})
+
 				It("returns a 504 Gateway Timeout", func() {
-					res := doQuery(se, "")
+					timeout := searchAPI.DefaultConfiguration().TimeoutPolicy.ImageStoreTimeout
+					res := advanceDuring(clock, timeout, func() HTTPResult { return doQuery(se, "lion") })
 					Expect(res.Status).To(Equal(http.StatusGatewayTimeout))
 
 					ic := res.JSON.ImageCollections
@@ -184,7 +177,57 @@ var _ = Describe("Search API", func() {
 			})
 		})
 
+		Context("Store Failures", func() {
+			DescribeTable("tells the failing store apart",
+				func(failing string, code string) {
+					is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+					var eng *searchAPI.SearchEngine
+					if failing == searchAPI.VectorStoreName {
+						eng = searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, inkinspottest.NewFaultyStore(vs, inkinspottest.FailEvery(1)))
+					} else {
+						eng = searchAPI.NewSearchEngine(searchAPI.Configuration{}, inkinspottest.NewFaultyStore(is, inkinspottest.FailEvery(1)), vs)
+					}
+					se.Close()
+					se = httptest.NewServer(searchAPI.NewHandler(eng))
+
+					res := doQuery(se, "lion")
+					Expect(res.Status).To(Equal(http.StatusInternalServerError))
+					Expect(res.JSON.Error.Code).To(Equal(code))
+
+					_, err := eng.MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+					var storeErr *searchAPI.StoreError
+					Expect(errors.As(err, &storeErr)).To(BeTrue())
+					Expect(storeErr.Store).To(Equal(failing))
+					Expect(err).To(MatchError(inkinspottest.ErrInjected))
+
+					Expect(eng.StoreErrors()).To(ConsistOf(searchAPI.StoreErrorCount{Store: failing, Op: storeErr.Op, Count: 2}))
+				},
+				Entry("vector store", searchAPI.VectorStoreName, "vector_store_error"),
+				Entry("image store", searchAPI.ImageStoreName, "image_store_error"),
+			)
+
+			It("keeps the context errors of a timing out store", func() {
+				is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+				cfg := searchAPI.Configuration{TimeoutPolicy: searchAPI.TimeoutPolicy{ImageStoreTimeout: 10 * time.Millisecond}}
+				eng := searchAPI.NewSearchEngine(cfg, inkinspottest.NewLatencyStore(is, time.Hour), vs)
+
+				_, err := eng.MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+				var storeErr *searchAPI.StoreError
+				Expect(errors.As(err, &storeErr)).To(BeTrue())
+				Expect(storeErr.Store).To(Equal(searchAPI.ImageStoreName))
+				Expect(storeErr.Op).To(Equal("get"))
+				Expect(err).To(MatchError(searchAPI.ErrImageStoreTimeout))
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+			})
+		})
+
 		Context("Image Store loaded with big cat tattoos", func() {
+			// the big cats come from the embedded sample catalog.
+			BeforeEach(func() {
+				se.Close()
+				se = initSearchEngineHttpServer(initSampleStores())
+			})
+
 			When("query is realistic black & white lion", func() {
 				queryVerbose := "realistic black and white lion on chest"
 				queryTerse := "realistic black white lion chest"
@@ -194,6 +237,7 @@ var _ = Describe("Search API", func() {
 					resultVerbose := doQuery(se, queryVerbose)
 					resultTerse := doQuery(se, queryTerse)
 					respultCaps := doQuery(se, queryCAPS)
+					Expect(collectionIDs(resultVerbose.JSON.ImageCollections)).To(HaveExactElements("X", "Y", "Z"), "the realistic lion on the chest ranks first")
 					for index, verboseCollection := range resultVerbose.JSON.ImageCollections {
 						terseCollection := resultTerse.JSON.ImageCollections[index]
 						Expect(verboseCollection).To(Equal(terseCollection), "Expected verbose and terse query must have the same results")
@@ -0,0 +1,131 @@
+package inkinspot
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxSearchBodyBytes caps the JSON body of a POST search.
+const maxSearchBodyBytes = 64 << 10
+
+// searchFilters narrow a POST search as the filter parameters of a GET.
+type searchFilters struct {
+	Artist   string    `json:"artist"`
+	Near     *Location `json:"near"`
+	RadiusKM *float64  `json:"radius_km"`
+	Style    []string  `json:"style"`
+	Subject  []string  `json:"subject"`
+	Area     []string  `json:"area"`
+}
+
+// searchBody is the JSON body of a POST search, each field stands for the query parameter of a GET.
+type searchBody struct {
+	Query      string         `json:"query"`
+	Queries    []string       `json:"queries"`
+	Lang       string         `json:"lang"`
+	Filters    *searchFilters `json:"filters"`
+	Weights    *rankWeights   `json:"weights"`
+	Limit      *int           `json:"limit"`
+	Offset     *int           `json:"offset"`
+	Cursor     string         `json:"cursor"`
+	MinScore   *float64       `json:"min_score"`
+	BestEffort *bool          `json:"best_effort"`
+	GroupBy    *string        `json:"group_by"`
+	GroupLimit *int           `json:"group_limit"`
+	Explain    bool           `json:"explain"`
+	DebugMeta  bool           `json:"debug_meta"`
+}
+
+// params returns the query parameters of the GET search the body stands for.
+func (b searchBody) params() url.Values {
+	params := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	setFloat := func(key string, v *float64) {
+		if v != nil {
+			params.Set(key, strconv.FormatFloat(*v, 'g', -1, 64))
+		}
+	}
+	setInt := func(key string, v *int) {
+		if v != nil {
+			params.Set(key, strconv.Itoa(*v))
+		}
+	}
+
+	if b.Query != "" {
+		params.Add("q", b.Query)
+	}
+	for _, q := range b.Queries {
+		params.Add("q", q)
+	}
+	set("lang", b.Lang)
+	if f := b.Filters; f != nil {
+		set("artist", f.Artist)
+		if f.Near != nil {
+			params.Set("near", strconv.FormatFloat(f.Near.Lat, 'g', -1, 64)+","+strconv.FormatFloat(f.Near.Lng, 'g', -1, 64))
+		}
+		setFloat("radius_km", f.RadiusKM)
+		for facet, labels := range map[string][]string{FacetStyle: f.Style, FacetSubject: f.Subject, FacetArea: f.Area} {
+			for _, label := range labels {
+				params.Add(facet, label)
+			}
+		}
+	}
+	if w := b.Weights; w != nil {
+		setFloat("w_style", w.Style)
+		setFloat("w_subject", w.Subject)
+		setFloat("w_area", w.Area)
+	}
+	setInt("limit", b.Limit)
+	setInt("offset", b.Offset)
+	set("cursor", b.Cursor)
+	setFloat("min_score", b.MinScore)
+	if b.BestEffort != nil {
+		params.Set("best_effort", strconv.FormatBool(*b.BestEffort))
+	}
+	if b.GroupBy != nil {
+		params.Set("group_by", *b.GroupBy)
+	}
+	setInt("group_limit", b.GroupLimit)
+	if b.Explain {
+		params.Set("explain", "true")
+	}
+	if b.DebugMeta {
+		params.Set("debug_meta", "true")
+	}
+
+	return params
+}
+
+// searchParams returns the query parameters of the search request, read from the JSON body of a POST.
+// It answers the requests it can't read, false when they're answered.
+func searchParams(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if r.Method != http.MethodPost {
+		return r.URL.Query(), true
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "the search body must be application/json")
+		return nil, false
+	}
+	var body searchBody
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSearchBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return nil, false
+	}
+
+	params := body.params()
+	if !checkQueryText(w, params["q"]) {
+		return nil, false
+	}
+
+	return params, true
+}
@@ -0,0 +1,101 @@
+package inkinspot_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// doPostSearch posts the body to /search with the content type.
+func doPostSearch(se *httptest.Server, contentType, body string) HTTPResult {
+	GinkgoHelper()
+	resp, err := se.Client().Post(se.URL+"/search", contentType, strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var res HTTPResult
+	res.Status = resp.StatusCode
+	res.Body, err = io.ReadAll(resp.Body)
+	Expect(err).NotTo(HaveOccurred())
+	_ = json.Unmarshal(res.Body, &res.JSON)
+
+	return res
+}
+
+var _ = Describe("POST searches", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(searchAPI.Configuration{})))
+		DeferCleanup(se.Close)
+	})
+
+	DescribeTable("answer as the GETs of the same search",
+		func(params url.Values, body string) {
+			get := doSearch(se, params)
+			post := doPostSearch(se, "application/json", body)
+
+			Expect(post.Status).To(Equal(get.Status))
+			get.JSON.TookMS, post.JSON.TookMS = 0, 0
+			if get.JSON.Meta != nil {
+				get.JSON.Meta.TotalMS, post.JSON.Meta.TotalMS = 0, 0
+				get.JSON.Meta.VectorStoreMS, post.JSON.Meta.VectorStoreMS = 0, 0
+				get.JSON.Meta.ImageStoreMS, post.JSON.Meta.ImageStoreMS = 0, 0
+			}
+			Expect(post.JSON).To(Equal(get.JSON))
+		},
+		Entry("a query", url.Values{"q": {"lion"}}, `{"query": "lion"}`),
+		Entry("several queries", url.Values{"q": {"lion", "tiger"}}, `{"queries": ["lion", "tiger"]}`),
+		Entry("a page", url.Values{"q": {"bw"}, "limit": {"1"}, "offset": {"1"}}, `{"query": "bw", "limit": 1, "offset": 1}`),
+		Entry("the weights & the explanation",
+			url.Values{"q": {"bw lion"}, "w_style": {"2.5"}, "w_area": {"0"}, "min_score": {"0.1"}, "explain": {"true"}},
+			`{"query": "bw lion", "weights": {"style": 2.5, "area": 0}, "min_score": 0.1, "explain": true}`),
+		Entry("the groups", url.Values{"q": {"bw"}, "group_by": {"subject"}, "group_limit": {"1"}}, `{"query": "bw", "group_by": "subject", "group_limit": 1}`),
+		Entry("a location filter", url.Values{"q": {"lion"}, "near": {"52.5,13.4"}, "radius_km": {"10"}}, `{"query": "lion", "filters": {"near": {"lat": 52.5, "lng": 13.4}, "radius_km": 10}}`),
+		Entry("the debug meta", url.Values{"q": {"lion"}, "debug_meta": {"true"}}, `{"query": "lion", "debug_meta": true}`),
+		Entry("an empty query", url.Values{"q": {""}}, `{"query": ""}`),
+		Entry("an invalid weight", url.Values{"q": {"lion"}, "w_style": {"-1"}}, `{"query": "lion", "weights": {"style": -1}}`),
+	)
+
+	It("turns away the bodies which aren't JSON", func() {
+		res := doPostSearch(se, "text/plain", `{"query": "lion"}`)
+		Expect(res.Status).To(Equal(http.StatusUnsupportedMediaType))
+		Expect(res.JSON.Error.Code).To(Equal("unsupported_media_type"))
+
+		res = doPostSearch(se, "application/json; charset=utf-8", `{"query": "lion"}`)
+		Expect(res.Status).To(Equal(http.StatusOK))
+	})
+
+	It("rejects the malformed bodies", func() {
+		res := doPostSearch(se, "application/json", `{"q": "lion"}`)
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_body"))
+
+		res = doPostSearch(se, "application/json", `{"query": "`+strings.Repeat("lion ", 20000)+`"}`)
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_body"))
+
+		res = doPostSearch(se, "application/json", `{"query": "lion\u0000"}`)
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_query"))
+	})
+
+	It("lists the methods on OPTIONS", func() {
+		req, err := http.NewRequest(http.MethodOptions, se.URL+"/search", nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(resp.Header.Get("Allow")).To(Equal("GET, HEAD, POST, OPTIONS"))
+	})
+})
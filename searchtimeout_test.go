@@ -0,0 +1,127 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// deadlines records the time left to the deadline of the store calls, by store.
+type deadlines struct {
+	mu   sync.Mutex
+	left map[string]time.Duration
+}
+
+func (d *deadlines) record(store string, ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	Expect(ok).To(BeTrue(), "the %s store call has no deadline", store)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.left[store] = time.Until(deadline)
+}
+
+func (d *deadlines) of(store string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.left[store]
+}
+
+type deadlineImageStore struct {
+	*inkinspottest.FakeImageStore
+	deadlines *deadlines
+}
+
+func (s deadlineImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	s.deadlines.record(searchAPI.ImageStoreName, ctx)
+	return s.FakeImageStore.GetTattoosByID(ctx, ids)
+}
+
+type deadlineVectorStore struct {
+	*inkinspottest.FakeVectorStore
+	deadlines *deadlines
+}
+
+func (s deadlineVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	s.deadlines.record(searchAPI.VectorStoreName, ctx)
+	return s.FakeVectorStore.GetIDsByQuery(ctx, query)
+}
+
+// doAdminSearch searches the admin endpoint with the params.
+func doAdminSearch(se *httptest.Server, params url.Values) HTTPResult {
+	GinkgoHelper()
+	var res HTTPResult
+	res.Status = getVector(se, "/admin/search?"+params.Encode(), adminToken, &res.JSON)
+	return res
+}
+
+var _ = Describe("Admin search timeouts", func() {
+	var (
+		recorded *deadlines
+		se       *httptest.Server
+	)
+
+	BeforeEach(func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		recorded = &deadlines{left: map[string]time.Duration{}}
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken, MaxStoreTimeout: 10 * time.Second},
+			CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true},
+		}
+		engine := searchAPI.NewSearchEngine(cfg, deadlineImageStore{is, recorded}, deadlineVectorStore{vs, recorded})
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	It("overrides the store timeouts of the request", func() {
+		res := doAdminSearch(se, url.Values{"q": {"lion"}, "vector_timeout": {"5s"}, "image_timeout": {"3s"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).NotTo(BeEmpty())
+
+		Expect(recorded.of(searchAPI.VectorStoreName)).To(BeNumerically("~", 5*time.Second, time.Second))
+		Expect(recorded.of(searchAPI.ImageStoreName)).To(BeNumerically("~", 3*time.Second, time.Second))
+	})
+
+	It("carries the debug meta & bypasses the cache", func() {
+		Expect(doQuery(se, "lion").Status).To(Equal(http.StatusOK))
+
+		res := doAdminSearch(se, url.Values{"q": {"lion"}, "vector_timeout": {"5s"}})
+		Expect(res.JSON.Meta).NotTo(BeNil())
+		Expect(res.JSON.Meta.CacheHit).To(BeFalse())
+		Expect(recorded.of(searchAPI.ImageStoreName)).To(BeNumerically("<=", 150*time.Millisecond), "the image store timeout isn't overridden")
+	})
+
+	It("caps the overrides", func() {
+		res := doAdminSearch(se, url.Values{"q": {"lion"}, "vector_timeout": {"1m"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_timeout"))
+
+		res = doAdminSearch(se, url.Values{"q": {"lion"}, "image_timeout": {"soon"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_timeout"))
+	})
+
+	It("needs the admin token", func() {
+		resp, err := se.Client().Get(se.URL + "/admin/search?q=lion&vector_timeout=5s")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("ignores the overrides on the regular searches", func() {
+		res := doSearch(se, url.Values{"q": {"lion"}, "vector_timeout": {"5s"}, "image_timeout": {"1m"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Meta).To(BeNil())
+		Expect(recorded.of(searchAPI.VectorStoreName)).To(BeNumerically("<=", 100*time.Millisecond))
+		Expect(recorded.of(searchAPI.ImageStoreName)).To(BeNumerically("<=", 150*time.Millisecond))
+	})
+})
@@ -0,0 +1,177 @@
+package inkinspot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Self check modes.
+const (
+	// SelfCheckCanary pings the stores then searches the canary query.
+	SelfCheckCanary = "canary"
+	// SelfCheckConnectivity only pings the stores.
+	SelfCheckConnectivity = "connectivity"
+	// SelfCheckSkipped leaves the engine ready without a check, for the empty catalogs being bootstrapped.
+	SelfCheckSkipped = "skipped"
+)
+
+// SelfCheckPolicy is the check of the stores the engine must pass to be ready.
+// Zero values are replaced by the defaults.
+type SelfCheckPolicy struct {
+	// Query is the canary searched once the stores answer their pings, only the pings are checked when empty.
+	Query string
+	// MinResults is the number of collections the canary must find.
+	MinResults int
+	// Timeout bounds a check, the pings & the canary.
+	Timeout time.Duration
+	// RetryInterval is the wait between the checks until one passes.
+	RetryInterval time.Duration
+	// Skip leaves the engine ready without a check.
+	Skip bool
+}
+
+func (p SelfCheckPolicy) withDefaults() SelfCheckPolicy {
+	if p.MinResults <= 0 {
+		p.MinResults = 1
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 2 * time.Second
+	}
+	if p.RetryInterval <= 0 {
+		p.RetryInterval = 10 * time.Second
+	}
+
+	return p
+}
+
+// mode returns the self check mode of the policy.
+func (p SelfCheckPolicy) mode() string {
+	switch {
+	case p.Skip:
+		return SelfCheckSkipped
+	case p.Query == "":
+		return SelfCheckConnectivity
+	}
+
+	return SelfCheckCanary
+}
+
+// Pinger is implemented by the stores which can tell they're reachable, as their backend answers.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// SelfCheckStatus is the outcome of the last self check, the engine is ready once one passed.
+type SelfCheckStatus struct {
+	Ready     bool      `json:"ready"`
+	Mode      string    `json:"mode"`
+	Attempts  int       `json:"attempts"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// selfCheck keeps the status of the self checks.
+type selfCheck struct {
+	mu     sync.Mutex
+	status SelfCheckStatus
+}
+
+func newSelfCheck(p SelfCheckPolicy) *selfCheck {
+	status := SelfCheckStatus{Ready: p.Skip, Mode: p.mode()}
+	if !p.Skip {
+		status.Error = "not checked yet"
+	}
+
+	return &selfCheck{status: status}
+}
+
+// SelfCheckStatus returns the outcome of the last self check.
+func (e *SearchEngine) SelfCheckStatus() SelfCheckStatus {
+	e.selfCheck.mu.Lock()
+	defer e.selfCheck.mu.Unlock()
+
+	return e.selfCheck.status
+}
+
+// SelfCheck pings the stores & searches the canary of the policy within its timeout, it records the outcome.
+// It fails with ErrSelfCheckFailed when a store doesn't answer or the canary finds too few collections.
+// Once a check passed the engine stays ready, the later checks return at once.
+func (e *SearchEngine) SelfCheck(ctx context.Context) error {
+	if e.SelfCheckStatus().Ready {
+		return nil
+	}
+
+	err := e.runSelfCheck(ctx, e.configuration.SelfCheckPolicy)
+
+	c := e.selfCheck
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Attempts++
+	c.status.CheckedAt = e.clock.Now()
+	c.status.Ready = err == nil
+	c.status.Error = ""
+	if err != nil {
+		c.status.Error = err.Error()
+	}
+
+	return err
+}
+
+// runSelfCheck pings the stores then searches the canary, bypassing the cache.
+func (e *SearchEngine) runSelfCheck(ctx context.Context, p SelfCheckPolicy) error {
+	ctx, cancel := e.withTightTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	stores := []struct {
+		name  string
+		store any
+	}{{ImageStoreName, e.imageStore}, {VectorStoreName, e.vectorStore}}
+	for _, s := range stores {
+		if pinger, ok := storeAs[Pinger](s.store); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				return fmt.Errorf("%w: pinging the %s store: %w", ErrSelfCheckFailed, s.name, err)
+			}
+		}
+	}
+	if p.Query == "" {
+		return nil
+	}
+
+	// the store timeouts are overridden so a failed canary isn't served from the cache on the retries.
+	timeouts := e.configuration.TimeoutPolicy
+	res, err := e.MultiSearch(ctx, []string{p.Query}, SearchOptions{Limit: p.MinResults, Timeouts: &timeouts})
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: searching %q: %w", ErrSelfCheckFailed, p.Query, err)
+	case res.Stale:
+		return fmt.Errorf("%w: searching %q served the last known good result", ErrSelfCheckFailed, p.Query)
+	case len(res.Hits) < p.MinResults:
+		return fmt.Errorf("%w: searching %q found %d collections, want at least %d", ErrSelfCheckFailed, p.Query, len(res.Hits), p.MinResults)
+	}
+
+	return nil
+}
+
+// SelfCheckJob checks the stores every retry interval of the policy until a check passes.
+func (e *SearchEngine) SelfCheckJob() Job {
+	return Job{
+		Name:     "selfcheck",
+		Interval: e.configuration.SelfCheckPolicy.RetryInterval,
+		Run:      e.SelfCheck,
+	}
+}
+
+// handleReadiness reports the last self check, 503 Service Unavailable until one passed.
+func handleReadiness(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := se.SelfCheckStatus()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	})
+}
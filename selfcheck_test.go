@@ -0,0 +1,125 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// unreachableImageStore fails its pings, as a store at a wrong endpoint does.
+type unreachableImageStore struct {
+	*searchAPI.MemoryImageStore
+}
+
+func (unreachableImageStore) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+// readiness requests /readyz, it decodes the self check status.
+func readiness(se *httptest.Server) (int, searchAPI.SelfCheckStatus) {
+	GinkgoHelper()
+	resp, err := se.Client().Get(se.URL + "/readyz")
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var status searchAPI.SelfCheckStatus
+	Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+	return resp.StatusCode, status
+}
+
+var _ = Describe("Self check", func() {
+	var (
+		is    *searchAPI.MemoryImageStore
+		vs    *searchAPI.MemoryVectorStore
+		clock *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	initServer := func(p searchAPI.SelfCheckPolicy, images searchAPI.ImageStore) (*searchAPI.SearchEngine, *httptest.Server) {
+		GinkgoHelper()
+		cfg := searchAPI.Configuration{SelfCheckPolicy: p, CachePolicy: searchAPI.CachePolicy{TTL: time.Hour}}
+		engine := searchAPI.NewSearchEngine(cfg, images, vs, searchAPI.WithClock(clock))
+		se := httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+		return engine, se
+	}
+
+	It("is ready once the canary finds the collections", func() {
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"lion": 0.9}})).To(Succeed())
+		engine, se := initServer(searchAPI.SelfCheckPolicy{Query: "lion"}, is)
+
+		code, status := readiness(se)
+		Expect(code).To(Equal(http.StatusServiceUnavailable), "nothing was checked yet")
+		Expect(status.Error).To(Equal("not checked yet"))
+
+		Expect(engine.SelfCheck(context.Background())).To(Succeed())
+		code, status = readiness(se)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(searchAPI.SelfCheckStatus{Ready: true, Mode: searchAPI.SelfCheckCanary, Attempts: 1, CheckedAt: clock.Now()}))
+	})
+
+	It("retries the failed checks until one passes", func() {
+		engine, se := initServer(searchAPI.SelfCheckPolicy{Query: "lion", RetryInterval: time.Minute}, is)
+
+		err := engine.SelfCheck(context.Background())
+		Expect(err).To(MatchError(searchAPI.ErrSelfCheckFailed))
+		code, status := readiness(se)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Error).To(ContainSubstring(`searching "lion" found 0 collections, want at least 1`))
+
+		Expect(engine.RegisterJob(engine.SelfCheckJob())).To(Succeed())
+		engine.StartJobs()
+		DeferCleanup(func() { Expect(engine.StopJobs(context.Background())).To(Succeed()) })
+
+		// the failed canary isn't served from the cache.
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "L", Subject: searchAPI.LabelSet{"lion": 0.9}})).To(Succeed())
+		Eventually(clock.Waiters).Should(Equal(1))
+		clock.Advance(time.Minute)
+
+		Eventually(func() int { code, _ := readiness(se); return code }).Should(Equal(http.StatusOK))
+		Expect(engine.SelfCheckStatus().Attempts).To(Equal(2))
+	})
+
+	It("fails on the stores which don't answer their pings", func() {
+		engine, se := initServer(searchAPI.SelfCheckPolicy{}, unreachableImageStore{is})
+
+		Expect(engine.SelfCheck(context.Background())).To(MatchError(ContainSubstring("pinging the image store: connection refused")))
+		code, status := readiness(se)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(status.Mode).To(Equal(searchAPI.SelfCheckConnectivity))
+	})
+
+	It("only pings the stores without a canary", func() {
+		engine, se := initServer(searchAPI.SelfCheckPolicy{}, is)
+
+		Expect(engine.SelfCheck(context.Background())).To(Succeed())
+		code, status := readiness(se)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status.Mode).To(Equal(searchAPI.SelfCheckConnectivity))
+	})
+
+	It("is ready at once when skipped", func() {
+		engine, se := initServer(searchAPI.SelfCheckPolicy{Query: "lion", Skip: true}, unreachableImageStore{is})
+
+		code, status := readiness(se)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(status).To(Equal(searchAPI.SelfCheckStatus{Ready: true, Mode: searchAPI.SelfCheckSkipped}))
+		Expect(engine.SelfCheck(context.Background())).To(Succeed())
+		Expect(engine.SelfCheckStatus().Attempts).To(BeZero())
+	})
+})
@@ -0,0 +1,130 @@
+package inkinspot
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ServerPolicy holds the timeouts & limits of the HTTP server.
+// They guard the connections, before any handler runs.
+// Zero values are replaced by the defaults.
+type ServerPolicy struct {
+	// ReadHeaderTimeout is how long a client has to send the request headers.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long a client has to send the whole request.
+	ReadTimeout time.Duration
+	// WriteTimeout is how long the response may take from the end of the headers.
+	// The handler bounds the writes of its encoded responses by it too, whatever server runs it.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a kept-alive connection waits for the next request.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of the request headers.
+	MaxHeaderBytes int
+	// MaxConnections caps the connections open at once, no limit when zero.
+	MaxConnections int
+}
+
+func (p ServerPolicy) withDefaults() ServerPolicy {
+	if p.ReadHeaderTimeout == 0 {
+		p.ReadHeaderTimeout = 5 * time.Second
+	}
+	if p.ReadTimeout == 0 {
+		p.ReadTimeout = 10 * time.Second
+	}
+	if p.WriteTimeout == 0 {
+		p.WriteTimeout = 15 * time.Second
+	}
+	if p.IdleTimeout == 0 {
+		p.IdleTimeout = 60 * time.Second
+	}
+	if p.MaxHeaderBytes == 0 {
+		p.MaxHeaderBytes = 16 << 10
+	}
+
+	return p
+}
+
+// Validate checks the policy, with the defaults applied, is usable.
+func (p ServerPolicy) Validate() error {
+	p = p.withDefaults()
+	if p.ReadHeaderTimeout < 0 || p.ReadTimeout < 0 || p.WriteTimeout < 0 || p.IdleTimeout < 0 {
+		return fmt.Errorf("%w: timeouts must be positive", ErrInvalidServer)
+	}
+	if p.ReadHeaderTimeout > p.ReadTimeout {
+		return fmt.Errorf("%w: the header read timeout %s exceeds the read timeout %s", ErrInvalidServer, p.ReadHeaderTimeout, p.ReadTimeout)
+	}
+	if p.WriteTimeout < minUpdatesWait+updatesWriteMargin {
+		return fmt.Errorf("%w: the write timeout %s leaves the update polls no wait, it must be %s at least", ErrInvalidServer, p.WriteTimeout, minUpdatesWait+updatesWriteMargin)
+	}
+	if p.MaxHeaderBytes < 0 || p.MaxConnections < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidServer)
+	}
+
+	return nil
+}
+
+// NewServer creates the HTTP server of the handler with the timeouts of the ServerPolicy.
+// The connection limit is applied by the listener, see LimitListener, & HTTPS by ConfigureTLS.
+// The handler finds the client certificate's common name with ClientCommonName.
+func NewServer(cfg Configuration, h http.Handler) *http.Server {
+	p := cfg.withDefaults().ServerPolicy
+
+	return &http.Server{
+		Handler:           withClientName(h),
+		ReadHeaderTimeout: p.ReadHeaderTimeout,
+		ReadTimeout:       p.ReadTimeout,
+		WriteTimeout:      p.WriteTimeout,
+		IdleTimeout:       p.IdleTimeout,
+		MaxHeaderBytes:    p.MaxHeaderBytes,
+	}
+}
+
+// LimitListener accepts at most n connections open at once, Accept waits for one to close.
+func LimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{Listener: l, slots: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+
+	return &limitConn{Conn: c, release: func() { <-l.slots }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn frees its slot once closed.
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,104 @@
+package inkinspot_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP server", func() {
+	// serve runs the server of the configuration on a local listener, limited when asked.
+	serve := func(cfg searchAPI.Configuration) string {
+		GinkgoHelper()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		if n := cfg.ServerPolicy.MaxConnections; n > 0 {
+			ln = searchAPI.LimitListener(ln, n)
+		}
+
+		srv := searchAPI.NewServer(cfg, searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		go func() { _ = srv.Serve(ln) }()
+		DeferCleanup(srv.Close)
+
+		return ln.Addr().String()
+	}
+
+	It("applies safe defaults", func() {
+		srv := searchAPI.NewServer(searchAPI.Configuration{}, http.NotFoundHandler())
+		Expect(srv.ReadHeaderTimeout).To(Equal(5 * time.Second))
+		Expect(srv.ReadTimeout).To(Equal(10 * time.Second))
+		Expect(srv.WriteTimeout).To(Equal(15 * time.Second))
+		Expect(srv.IdleTimeout).To(Equal(time.Minute))
+		Expect(srv.MaxHeaderBytes).To(Equal(16 << 10))
+		Expect(searchAPI.ServerPolicy{}.Validate()).To(Succeed())
+	})
+
+	It("applies the configured timeouts & limits", func() {
+		p := searchAPI.ServerPolicy{
+			ReadHeaderTimeout: time.Second,
+			ReadTimeout:       2 * time.Second,
+			WriteTimeout:      3 * time.Second,
+			IdleTimeout:       4 * time.Second,
+			MaxHeaderBytes:    4096,
+		}
+		srv := searchAPI.NewServer(searchAPI.Configuration{ServerPolicy: p}, http.NotFoundHandler())
+		Expect(srv.ReadHeaderTimeout).To(Equal(p.ReadHeaderTimeout))
+		Expect(srv.ReadTimeout).To(Equal(p.ReadTimeout))
+		Expect(srv.WriteTimeout).To(Equal(p.WriteTimeout))
+		Expect(srv.IdleTimeout).To(Equal(p.IdleTimeout))
+		Expect(srv.MaxHeaderBytes).To(Equal(p.MaxHeaderBytes))
+	})
+
+	DescribeTable("rejects invalid policies",
+		func(p searchAPI.ServerPolicy) {
+			Expect(p.Validate()).To(MatchError(searchAPI.ErrInvalidServer))
+		},
+		Entry("negative timeout", searchAPI.ServerPolicy{WriteTimeout: -time.Second}),
+		Entry("header timeout beyond the read timeout", searchAPI.ServerPolicy{ReadHeaderTimeout: time.Minute, ReadTimeout: time.Second}),
+		Entry("write timeout leaving the update polls no wait", searchAPI.ServerPolicy{WriteTimeout: time.Second}),
+		Entry("negative header size", searchAPI.ServerPolicy{MaxHeaderBytes: -1}),
+		Entry("negative connection limit", searchAPI.ServerPolicy{MaxConnections: -1}),
+	)
+
+	It("disconnects a client stalled in its headers", func() {
+		addr := serve(searchAPI.Configuration{ServerPolicy: searchAPI.ServerPolicy{ReadHeaderTimeout: 100 * time.Millisecond}})
+		conn, err := net.Dial("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		_, err = io.WriteString(conn, "GET /search?q=lion HTTP/1.1\r\nHost: inkinspot\r\n")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		start := time.Now()
+		_, err = io.ReadAll(conn)
+		Expect(err).NotTo(HaveOccurred(), "the server should close the connection")
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("waits for a free connection beyond the limit", func() {
+		addr := serve(searchAPI.Configuration{ServerPolicy: searchAPI.ServerPolicy{MaxConnections: 1}})
+		first, err := net.Dial("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+
+		client := &http.Client{Timeout: 200 * time.Millisecond, Transport: &http.Transport{DisableKeepAlives: true}}
+		_, err = client.Get("http://" + addr + "/search?q=lion")
+		Expect(err).To(HaveOccurred(), "the second connection should wait")
+
+		Expect(first.Close()).To(Succeed())
+		Eventually(func() (int, error) {
+			resp, err := client.Get("http://" + addr + "/search?q=lion")
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+			return resp.StatusCode, nil
+		}).Should(Equal(http.StatusOK))
+	})
+})
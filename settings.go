@@ -0,0 +1,174 @@
+package inkinspot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MaxLabelBoost bounds the multipliers of the boost table.
+const MaxLabelBoost = 10
+
+// BoostTable holds score multipliers by label.
+// A candidate with a label in the table has its score multiplied by the boost.
+type BoostTable map[string]float64
+
+// Settings are the ranking settings which can change at runtime.
+type Settings struct {
+	Boosts BoostTable `json:"boosts"`
+	// Experiments rank the searches of shares of the clients by variants of the ranking policy.
+	Experiments []ExperimentPolicy `json:"experiments,omitempty"`
+}
+
+// runtimeSettings are the settings compiled for the ranker.
+// They are swapped as a whole, a search sees either the old or the new ones.
+type runtimeSettings struct {
+	Settings
+	// boosts are the table boosts by the joined stems of their label.
+	boosts map[string]float64
+	// key identifies the settings in the cache keys.
+	key string
+}
+
+// compileSettings validates the settings and analyzes the boosted labels.
+func compileSettings(s Settings, a Analyzer) (*runtimeSettings, error) {
+	rs := &runtimeSettings{
+		Settings: Settings{Boosts: make(BoostTable, len(s.Boosts)), Experiments: slices.Clone(s.Experiments)},
+		boosts:   make(map[string]float64, len(s.Boosts)),
+	}
+
+	labels := make([]string, 0, len(s.Boosts))
+	for label := range s.Boosts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var key strings.Builder
+	for _, label := range labels {
+		boost := s.Boosts[label]
+		if math.IsNaN(boost) || boost <= 0 || boost > MaxLabelBoost {
+			return nil, fmt.Errorf("%w: %q boost must be above 0 and at most %d", ErrInvalidBoost, label, MaxLabelBoost)
+		}
+
+		stem := strings.Join(a.Analyze(label), " ")
+		if stem == "" {
+			return nil, fmt.Errorf("%w: %q has no terms", ErrInvalidBoost, label)
+		}
+		if _, ok := rs.boosts[stem]; ok {
+			return nil, fmt.Errorf("%w: %q is boosted more than once", ErrInvalidBoost, label)
+		}
+
+		rs.Boosts[label] = boost
+		rs.boosts[stem] = boost
+		fmt.Fprintf(&key, "%q=%g;", stem, boost)
+	}
+	experiments, err := compileExperiments(s.Experiments)
+	if err != nil {
+		return nil, err
+	}
+	rs.key = key.String() + experiments
+
+	return rs, nil
+}
+
+// Settings returns a copy of the current runtime settings.
+func (e *SearchEngine) Settings() Settings {
+	rs := e.settings.Load()
+	boosts := make(BoostTable, len(rs.Boosts))
+	for label, boost := range rs.Boosts {
+		boosts[label] = boost
+	}
+
+	return Settings{Boosts: boosts, Experiments: slices.Clone(rs.Experiments)}
+}
+
+// SetBoosts replaces the boost table.
+// It's persisted first when a settings path is configured, on failure nothing changes.
+func (e *SearchEngine) SetBoosts(boosts BoostTable) error {
+	return e.updateSettings(func(s *Settings) { s.Boosts = boosts })
+}
+
+// updateSettings replaces the settings by the current ones with the update, persisted first.
+func (e *SearchEngine) updateSettings(update func(*Settings)) error {
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
+
+	s := e.Settings()
+	update(&s)
+	rs, err := compileSettings(s, e.labelAnalyzer)
+	if err != nil {
+		return err
+	}
+
+	if path := e.configuration.AdminPolicy.SettingsPath; path != "" {
+		if err := writeSettings(path, rs.Settings); err != nil {
+			return err
+		}
+	}
+	e.settings.Store(rs)
+
+	return nil
+}
+
+// LoadSettings loads the runtime settings from the configured settings path.
+// A missing file keeps the current settings.
+func (e *SearchEngine) LoadSettings() error {
+	path := e.configuration.AdminPolicy.SettingsPath
+	if path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s Settings
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("settings %s: %w", path, err)
+	}
+
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
+
+	rs, err := compileSettings(s, e.labelAnalyzer)
+	if err != nil {
+		return fmt.Errorf("settings %s: %w", path, err)
+	}
+	e.settings.Store(rs)
+
+	return nil
+}
+
+// writeSettings replaces the settings file through a rename so it's never partially written.
+func writeSettings(path string, s Settings) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,287 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRingReplicas is the number of points of every shard on a ring, when none is given.
+const defaultRingReplicas = 128
+
+// HashRing assigns the IDs to shards by consistent hashing.
+// Adding or removing a shard only moves the IDs of its neighbours on the ring.
+// Overrides pin IDs to shards, whatever the ring says.
+type HashRing struct {
+	shards    []string
+	points    []uint64
+	owners    map[uint64]string
+	overrides map[string]string
+}
+
+// NewHashRing places replicas points of every shard on the ring, a default number when it's zero.
+// The overrides map IDs to the shards which own them.
+func NewHashRing(shards []string, replicas int, overrides map[string]string) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultRingReplicas
+	}
+
+	names := slices.Clone(shards)
+	slices.Sort(names)
+	r := &HashRing{
+		shards:    slices.Compact(names),
+		owners:    make(map[uint64]string, len(shards)*replicas),
+		overrides: overrides,
+	}
+	for _, shard := range r.shards {
+		for i := range replicas {
+			p := ringHash(shard + "#" + strconv.Itoa(i))
+			// a colliding point stays with the first shard by name.
+			if _, ok := r.owners[p]; !ok {
+				r.owners[p] = shard
+				r.points = append(r.points, p)
+			}
+		}
+	}
+	slices.Sort(r.points)
+
+	return r
+}
+
+// Shards returns the shards of the ring ordered by name.
+func (r *HashRing) Shards() []string {
+	return slices.Clone(r.shards)
+}
+
+// Owner returns the shard of the ID, empty when the ring has none.
+func (r *HashRing) Owner(id string) string {
+	if shard, ok := r.overrides[id]; ok {
+		return shard
+	}
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	h := ringHash(id)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// ringHash hashes by fnv-1a, mixed so the IDs differing by their last bytes don't land on the same arc.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
+
+// ShardError is returned by a ShardedImageStore alongside the collections of the shards which answered.
+// IDs are the requested IDs of the failed shards, Missing the ones the other shards have no collection for.
+type ShardError struct {
+	Shards  map[string]error
+	IDs     []string
+	Missing []string
+}
+
+func (e *ShardError) Error() string {
+	names := slices.Sorted(maps.Keys(e.Shards))
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %v", name, e.Shards[name]))
+	}
+
+	return fmt.Sprintf("image store shards failed for %s: %s", strings.Join(e.IDs, ", "), strings.Join(failures, "; "))
+}
+
+func (e *ShardError) Unwrap() []error {
+	out := make([]error, 0, len(e.Shards))
+	for _, err := range e.Shards {
+		out = append(out, err)
+	}
+
+	return out
+}
+
+// shardsServed drops the *ShardError of a lookup, the collections of the shards which answered are a partial result.
+func shardsServed(cols []TattooImagesCollection, err error) ([]TattooImagesCollection, bool, error) {
+	var shardErr *ShardError
+	if errors.As(err, &shardErr) {
+		return cols, true, nil
+	}
+
+	return cols, false, err
+}
+
+// ShardedImageStore spreads the collections over image stores by the hash ring of their IDs.
+// The writes & deletes go to the owning shard, when it implements them.
+type ShardedImageStore struct {
+	shards map[string]ImageStore
+	ring   *HashRing
+}
+
+// NewShardedImageStore routes the IDs to the shards by the ring.
+// Every shard of the ring & of its overrides needs a store.
+func NewShardedImageStore(shards map[string]ImageStore, ring *HashRing) (*ShardedImageStore, error) {
+	names := ring.Shards()
+	for _, shard := range ring.overrides {
+		names = append(names, shard)
+	}
+	if len(ring.shards) == 0 {
+		return nil, fmt.Errorf("%w: the ring has no shards", ErrInvalidShards)
+	}
+	for _, name := range names {
+		if shards[name] == nil {
+			return nil, fmt.Errorf("%w: no store for shard %q", ErrInvalidShards, name)
+		}
+	}
+
+	return &ShardedImageStore{shards: shards, ring: ring}, nil
+}
+
+// GetTattoosByID fetches the IDs from their shards concurrently.
+// The collections are merged in the order of the IDs, repeated IDs are returned once.
+// It returns a MissingIDsError for the IDs no shard has, a *ShardError when shards fail.
+func (s *ShardedImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	byShard := make(map[string][]string)
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			shard := s.ring.Owner(id)
+			byShard[shard] = append(byShard[shard], id)
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		found  = make(map[string]TattooImagesCollection, len(seen))
+		failed = make(map[string]error)
+	)
+	for shard, shardIDs := range byShard {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cols, err := foundOnly(s.shards[shard].GetTattoosByID(ctx, shardIDs))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[shard] = err
+				return
+			}
+			for _, c := range cols {
+				found[c.ID] = c
+			}
+		}()
+	}
+	wg.Wait()
+
+	out := make([]TattooImagesCollection, 0, len(found))
+	var missing, unavailable []string
+	reported := make(map[string]bool, len(seen))
+	for _, id := range ids {
+		if reported[id] {
+			continue
+		}
+		reported[id] = true
+
+		if c, ok := found[id]; ok {
+			out = append(out, c)
+			continue
+		}
+		if failed[s.ring.Owner(id)] != nil {
+			unavailable = append(unavailable, id)
+			continue
+		}
+		missing = append(missing, id)
+	}
+
+	if len(failed) > 0 {
+		return out, &ShardError{Shards: failed, IDs: unavailable, Missing: missing}
+	}
+	if len(missing) > 0 {
+		return out, &MissingIDsError{IDs: missing}
+	}
+
+	return out, nil
+}
+
+// HiddenIDs returns the IDs the shards hide or expired at the time, in the order of the IDs.
+// The shards which can't tell hide none.
+func (s *ShardedImageStore) HiddenIDs(ctx context.Context, ids []string, at time.Time) ([]string, error) {
+	byShard := make(map[string][]string)
+	for _, id := range ids {
+		shard := s.ring.Owner(id)
+		byShard[shard] = append(byShard[shard], id)
+	}
+
+	hidden := make(map[string]bool)
+	for shard, shardIDs := range byShard {
+		filter, ok := storeAs[HiddenFilter](s.shards[shard])
+		if !ok {
+			continue
+		}
+		shardHidden, err := filter.HiddenIDs(ctx, shardIDs, at)
+		if err != nil {
+			return nil, &ShardError{Shards: map[string]error{shard: err}, IDs: shardIDs}
+		}
+		for _, id := range shardHidden {
+			hidden[id] = true
+		}
+	}
+
+	var out []string
+	for _, id := range ids {
+		if hidden[id] {
+			out = append(out, id)
+		}
+	}
+
+	return out, nil
+}
+
+// AddCollection writes the collection to its shard.
+func (s *ShardedImageStore) AddCollection(ctx context.Context, c TattooImagesCollection) error {
+	shard := s.ring.Owner(c.ID)
+	w, ok := storeAs[CollectionWriter](s.shards[shard])
+	if !ok {
+		return fmt.Errorf("%w: shard %q can't be written", ErrImportUnsupported, shard)
+	}
+
+	return w.AddCollection(ctx, c)
+}
+
+// DeleteCollection removes the collection from its shard.
+func (s *ShardedImageStore) DeleteCollection(ctx context.Context, id string) error {
+	shard := s.ring.Owner(id)
+	d, ok := storeAs[CollectionDeleter](s.shards[shard])
+	if !ok {
+		return fmt.Errorf("%w: shard %q can't delete", ErrPurgeUnsupported, shard)
+	}
+
+	return d.DeleteCollection(ctx, id)
+}
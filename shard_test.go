@@ -0,0 +1,182 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hash rings", func() {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("tattoo-%04d", i)
+	}
+
+	It("spreads the IDs over every shard, whatever the order of the shards", func() {
+		ring := searchAPI.NewHashRing([]string{"a", "b", "c"}, 0, nil)
+		reordered := searchAPI.NewHashRing([]string{"c", "a", "b"}, 0, nil)
+
+		counts := map[string]int{}
+		for _, id := range ids {
+			Expect(reordered.Owner(id)).To(Equal(ring.Owner(id)))
+			counts[ring.Owner(id)]++
+		}
+		Expect(counts).To(HaveLen(3))
+		for _, n := range counts {
+			Expect(n).To(BeNumerically(">", 200))
+		}
+	})
+
+	It("only moves the IDs taken by an added shard", func() {
+		ring := searchAPI.NewHashRing([]string{"a", "b", "c"}, 0, nil)
+		grown := searchAPI.NewHashRing([]string{"a", "b", "c", "d"}, 0, nil)
+
+		moved := 0
+		for _, id := range ids {
+			if owner := grown.Owner(id); owner != ring.Owner(id) {
+				Expect(owner).To(Equal("d"))
+				moved++
+			}
+		}
+		Expect(moved).To(BeNumerically("~", len(ids)/4, len(ids)/10))
+	})
+
+	It("pins the overridden IDs", func() {
+		ring := searchAPI.NewHashRing([]string{"a", "b"}, 0, map[string]string{"tattoo-0001": "legacy"})
+		Expect(ring.Owner("tattoo-0001")).To(Equal("legacy"))
+	})
+})
+
+var _ = Describe("Sharded image stores", func() {
+	var (
+		shards map[string]*inkinspottest.FakeImageStore
+		ring   *searchAPI.HashRing
+		ids    []string
+	)
+
+	newStore := func(stores map[string]searchAPI.ImageStore) *searchAPI.ShardedImageStore {
+		GinkgoHelper()
+		s, err := searchAPI.NewShardedImageStore(stores, ring)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	BeforeEach(func() {
+		shards = map[string]*inkinspottest.FakeImageStore{
+			"a": inkinspottest.NewFakeImageStore(),
+			"b": inkinspottest.NewFakeImageStore(),
+			"c": inkinspottest.NewFakeImageStore(),
+		}
+		ring = searchAPI.NewHashRing([]string{"a", "b", "c"}, 0, nil)
+
+		s := newStore(map[string]searchAPI.ImageStore{"a": shards["a"], "b": shards["b"], "c": shards["c"]})
+		ids = nil
+		for i := range 30 {
+			id := fmt.Sprintf("tattoo-%02d", i)
+			ids = append(ids, id)
+			Expect(s.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+	})
+
+	It("writes every collection to the shard owning it", func() {
+		for _, id := range ids {
+			for name, shard := range shards {
+				_, err := shard.GetTattoosByID(context.Background(), []string{id})
+				if name == ring.Owner(id) {
+					Expect(err).NotTo(HaveOccurred(), "%s belongs to %s", id, name)
+				} else {
+					Expect(err).To(MatchError(searchAPI.ErrCollectionNotFound), "%s doesn't belong to %s", id, name)
+				}
+			}
+		}
+	})
+
+	It("merges the collections of the shards in the order of the IDs", func() {
+		s := newStore(map[string]searchAPI.ImageStore{"a": shards["a"], "b": shards["b"], "c": shards["c"]})
+		requested := []string{ids[7], ids[2], "unknown", ids[19], ids[2], ids[0]}
+
+		cols, err := s.GetTattoosByID(context.Background(), requested)
+		Expect(err).To(MatchError(searchAPI.ErrCollectionNotFound))
+		var missing *searchAPI.MissingIDsError
+		Expect(err).To(BeAssignableToTypeOf(missing))
+		Expect(collectionIDs(cols)).To(Equal([]string{ids[7], ids[2], ids[19], ids[0]}))
+	})
+
+	It("returns the collections of the other shards when a shard fails", func() {
+		failing := inkinspottest.NewFaultyStore(shards["b"], inkinspottest.FailEvery(1))
+		s := newStore(map[string]searchAPI.ImageStore{"a": shards["a"], "b": failing, "c": shards["c"]})
+
+		cols, err := s.GetTattoosByID(context.Background(), ids)
+		var shardErr *searchAPI.ShardError
+		Expect(err).To(BeAssignableToTypeOf(shardErr))
+		shardErr = err.(*searchAPI.ShardError)
+		Expect(shardErr.Shards).To(HaveKey("b"))
+		Expect(shardErr.Shards).To(HaveLen(1))
+		Expect(err).To(MatchError(inkinspottest.ErrInjected))
+		Expect(err).NotTo(MatchError(searchAPI.ErrCollectionNotFound), "the failed IDs aren't missing")
+
+		var served, failed []string
+		for _, id := range ids {
+			if ring.Owner(id) == "b" {
+				failed = append(failed, id)
+			} else {
+				served = append(served, id)
+			}
+		}
+		Expect(failed).NotTo(BeEmpty())
+		Expect(shardErr.IDs).To(Equal(failed))
+		Expect(collectionIDs(cols)).To(Equal(served))
+	})
+
+	It("serves the hits of the other shards as a partial result when a shard fails", func() {
+		failing := inkinspottest.NewFaultyStore(shards["b"], inkinspottest.FailEvery(1))
+		s := newStore(map[string]searchAPI.ImageStore{"a": shards["a"], "b": failing, "c": shards["c"]})
+		vs := searchAPI.NewMemoryVectorStore()
+		var served []string
+		for _, id := range ids {
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"rose": 100}})).To(Succeed())
+			if ring.Owner(id) != "b" {
+				served = append(served, id)
+			}
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, s, vs)))
+		DeferCleanup(se.Close)
+
+		res := doQuery(se, "rose")
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Partial).To(BeTrue())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(ConsistOf(served))
+	})
+
+	It("merges the hidden IDs of the shards which can tell, in the order of the IDs", func() {
+		memory := map[string]*searchAPI.MemoryImageStore{"a": searchAPI.NewMemoryImageStore(), "c": searchAPI.NewMemoryImageStore()}
+		s := newStore(map[string]searchAPI.ImageStore{"a": memory["a"], "b": shards["b"], "c": memory["c"]})
+		var want []string
+		for _, id := range ids {
+			owner := ring.Owner(id)
+			if owner == "b" {
+				continue
+			}
+			Expect(memory[owner].AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id, Hidden: true})).To(Succeed())
+			want = append(want, id)
+		}
+
+		hidden, err := s.HiddenIDs(context.Background(), append(ids, "unknown"), time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(want).NotTo(BeEmpty())
+		Expect(hidden).To(Equal(want))
+	})
+
+	It("needs a store for every shard of the ring", func() {
+		_, err := searchAPI.NewShardedImageStore(map[string]searchAPI.ImageStore{"a": shards["a"]}, ring)
+		Expect(err).To(MatchError(searchAPI.ErrInvalidShards))
+	})
+})
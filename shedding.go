@@ -0,0 +1,81 @@
+package inkinspot
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// SheddingPolicy caps the requests served at once, the ones beyond are shed.
+// Only the query endpoints count, the admin endpoints are never shed.
+// Zero values are replaced by the defaults.
+type SheddingPolicy struct {
+	// MaxInFlightRequests is the number of requests served at once, negative for no limit.
+	MaxInFlightRequests int
+	// RetryAfter is the delay suggested to the shed requests.
+	RetryAfter time.Duration
+}
+
+func (p SheddingPolicy) withDefaults() SheddingPolicy {
+	if p.MaxInFlightRequests == 0 {
+		p.MaxInFlightRequests = 256
+	}
+	if p.RetryAfter <= 0 {
+		p.RetryAfter = time.Second
+	}
+
+	return p
+}
+
+// LoadStatus reports the requests in flight & the ones shed since the start.
+type LoadStatus struct {
+	InFlight            int64  `json:"in_flight"`
+	Shed                uint64 `json:"shed"`
+	MaxInFlightRequests int    `json:"max_in_flight_requests"`
+}
+
+// loadShedder counts the requests in flight & sheds the ones beyond the limit.
+type loadShedder struct {
+	policy   SheddingPolicy
+	inFlight atomic.Int64
+	shed     atomic.Uint64
+}
+
+// Load reports the requests in flight & shed.
+func (e *SearchEngine) Load() LoadStatus {
+	return LoadStatus{
+		InFlight:            e.shedder.inFlight.Load(),
+		Shed:                e.shedder.shed.Load(),
+		MaxInFlightRequests: e.shedder.policy.MaxInFlightRequests,
+	}
+}
+
+// withShedding answers 503 Service Unavailable beyond the in-flight limit, without waiting.
+// The slot is released however the request ends, panics included.
+func withShedding(s *loadShedder, next http.Handler) http.Handler {
+	if s.policy.MaxInFlightRequests < 0 {
+		return next
+	}
+
+	retryAfter := strconv.Itoa(int(math.Ceil(s.policy.RetryAfter.Seconds())))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer s.inFlight.Add(-1)
+		if s.inFlight.Add(1) > int64(s.policy.MaxInFlightRequests) {
+			s.shed.Add(1)
+			w.Header().Set("Retry-After", retryAfter)
+			writeError(w, http.StatusServiceUnavailable, "overloaded", "too many requests in flight, retry later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleLoad reports the load of the query endpoints.
+func handleLoad(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.Load())
+	})
+}
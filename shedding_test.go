@@ -0,0 +1,101 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// panickingImageStore panics on every lookup.
+type panickingImageStore struct{}
+
+func (panickingImageStore) GetTattoosByID(context.Context, []string) ([]searchAPI.TattooImagesCollection, error) {
+	panic("image store exploded")
+}
+
+var _ = Describe("Load shedding", func() {
+	const limit = 2
+
+	It("sheds the requests beyond the in-flight limit at once", func() {
+		clock := inkinspottest.NewFakeClock(time.Now())
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		slow := inkinspottest.NewLatencyStore(is, time.Hour, inkinspottest.WithLatencyClock(clock))
+		cfg := searchAPI.Configuration{SheddingPolicy: searchAPI.SheddingPolicy{MaxInFlightRequests: limit, RetryAfter: 3 * time.Second}}
+		eng := searchAPI.NewSearchEngine(cfg, slow, vs, searchAPI.WithClock(clock))
+		se := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+
+		held := make(chan HTTPResult, limit)
+		for range limit {
+			go func() {
+				defer GinkgoRecover()
+				held <- doQuery(se, "lion")
+			}()
+		}
+		Eventually(func() int64 { return eng.Load().InFlight }).Should(BeEquivalentTo(limit))
+
+		start := time.Now()
+		resp := doRequest(se, http.MethodGet, "lion", nil)
+		defer resp.Body.Close()
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("3"))
+
+		var body searchAPI.Response
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Error.Code).To(Equal("overloaded"))
+
+		clock.Advance(time.Hour)
+		for range limit {
+			Eventually(held).Should(Receive())
+		}
+		Eventually(func() int64 { return eng.Load().InFlight }).Should(BeZero())
+		Expect(eng.Load().Shed).To(BeEquivalentTo(1))
+	})
+
+	It("releases the slot of a panicking request", func() {
+		_, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		cfg := searchAPI.Configuration{SheddingPolicy: searchAPI.SheddingPolicy{MaxInFlightRequests: 1}}
+		eng := searchAPI.NewSearchEngine(cfg, panickingImageStore{}, vs)
+		se := httptest.NewUnstartedServer(searchAPI.NewHandler(eng))
+		se.Config.ErrorLog = log.New(io.Discard, "", 0)
+		se.Start()
+		DeferCleanup(se.Close)
+
+		for range 3 {
+			_, err := se.Client().Get(se.URL + "/search?q=lion")
+			Expect(err).To(HaveOccurred())
+		}
+		Expect(eng.Load()).To(Equal(searchAPI.LoadStatus{MaxInFlightRequests: 1}))
+	})
+
+	It("reports the load on the admin endpoint", func() {
+		cfg := searchAPI.Configuration{
+			SheddingPolicy: searchAPI.SheddingPolicy{MaxInFlightRequests: limit},
+			AdminPolicy:    searchAPI.AdminPolicy{Token: adminToken},
+		}
+		se := httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/load", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		var status searchAPI.LoadStatus
+		Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+		Expect(status).To(Equal(searchAPI.LoadStatus{MaxInFlightRequests: limit}))
+	})
+})
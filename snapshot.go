@@ -0,0 +1,349 @@
+package inkinspot
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// SnapshotPolicy controls the snapshots of the in-memory stores.
+// The stores are restored from Path on boot & saved to it every Interval.
+type SnapshotPolicy struct {
+	Path     string
+	Interval time.Duration
+}
+
+func (p SnapshotPolicy) withDefaults() SnapshotPolicy {
+	if p.Interval <= 0 {
+		p.Interval = 5 * time.Minute
+	}
+
+	return p
+}
+
+// A snapshot section is the magic, the store kind & the format version.
+// Then every record as its big endian uint32 length & JSON, ended by a zero length.
+const (
+	snapshotMagic   = "INKSNAP"
+	snapshotVersion = 1
+	// maxSnapshotRecordBytes caps the record lengths read, longer ones are corrupt.
+	maxSnapshotRecordBytes = 16 << 20
+)
+
+// Store kinds of the snapshot sections.
+const (
+	snapshotImages  byte = 'I'
+	snapshotVectors byte = 'V'
+)
+
+// snapshotWriter writes the records of a section.
+type snapshotWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newSnapshotWriter(w io.Writer, kind byte) (*snapshotWriter, error) {
+	header := append([]byte(snapshotMagic), kind, 0, 0)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic)+1:], snapshotVersion)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &snapshotWriter{w: w, buf: make([]byte, 4)}, nil
+}
+
+func (sw *snapshotWriter) write(record any) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	binary.BigEndian.PutUint32(sw.buf, uint32(len(b)))
+	if _, err := sw.w.Write(sw.buf); err != nil {
+		return err
+	}
+	_, err = sw.w.Write(b)
+
+	return err
+}
+
+func (sw *snapshotWriter) close() error {
+	binary.BigEndian.PutUint32(sw.buf, 0)
+	_, err := sw.w.Write(sw.buf)
+
+	return err
+}
+
+// snapshotReader reads the records of a section, tracking its offset for the errors.
+// It never reads past the section end, so sections can follow each other.
+// The offsets of a section read through a snapshotFile start where the previous section ended.
+type snapshotReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func newSnapshotReader(r io.Reader, kind byte) (*snapshotReader, error) {
+	sr := &snapshotReader{r: r}
+	if f, ok := r.(*snapshotFile); ok {
+		sr.offset = f.offset
+	}
+
+	header := make([]byte, len(snapshotMagic)+3)
+	if err := sr.readFull(header); err != nil {
+		return nil, sr.corrupt(err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic || header[len(snapshotMagic)] != kind {
+		return nil, sr.corrupt(fmt.Errorf("not a %c snapshot section", kind))
+	}
+	if v := binary.BigEndian.Uint16(header[len(snapshotMagic)+1:]); v != snapshotVersion {
+		return nil, sr.corrupt(fmt.Errorf("unsupported version %d", v))
+	}
+
+	return sr, nil
+}
+
+func (sr *snapshotReader) readFull(b []byte) error {
+	n, err := io.ReadFull(sr.r, b)
+	sr.offset += int64(n)
+
+	return err
+}
+
+// next decodes the next record into v, it returns false at the section end.
+func (sr *snapshotReader) next(v any) (bool, error) {
+	start := sr.offset
+
+	length := make([]byte, 4)
+	if err := sr.readFull(length); err != nil {
+		return false, sr.corrupt(err)
+	}
+	n := binary.BigEndian.Uint32(length)
+	if n == 0 {
+		return false, nil
+	}
+	if n > maxSnapshotRecordBytes {
+		sr.offset = start
+		return false, sr.corrupt(fmt.Errorf("record length %d", n))
+	}
+
+	b := make([]byte, n)
+	if err := sr.readFull(b); err != nil {
+		return false, sr.corrupt(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		sr.offset = start
+		return false, sr.corrupt(err)
+	}
+
+	return true, nil
+}
+
+// snapshotFile counts the bytes read of a file holding several sections.
+type snapshotFile struct {
+	r      io.Reader
+	offset int64
+}
+
+func (f *snapshotFile) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	f.offset += int64(n)
+
+	return n, err
+}
+
+func (sr *snapshotReader) corrupt(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w at offset %d: %w", ErrCorruptSnapshot, sr.offset, err)
+}
+
+// Snapshot writes the collections to w ordered by ID.
+func (s *MemoryImageStore) Snapshot(w io.Writer) error {
+	sw, err := newSnapshotWriter(w, snapshotImages)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range s.ids {
+		if err := sw.write(s.collections[id]); err != nil {
+			return err
+		}
+	}
+
+	return sw.close()
+}
+
+// Restore replaces the collections with a snapshot.
+// The store is left unchanged when the snapshot is corrupt.
+func (s *MemoryImageStore) Restore(r io.Reader) error {
+	sr, err := newSnapshotReader(r, snapshotImages)
+	if err != nil {
+		return err
+	}
+
+	restored := NewMemoryImageStore()
+	for {
+		var c TattooImagesCollection
+		ok, err := sr.next(&c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := restored.AddCollection(context.Background(), c); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections, s.ids = restored.collections, restored.ids
+
+	return nil
+}
+
+// Snapshot writes the vectors to w, their labels are analyzed again on restore.
+func (s *MemoryVectorStore) Snapshot(w io.Writer) error {
+	sw, err := newSnapshotWriter(w, snapshotVectors)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedIDs(s.entries) {
+		if err := sw.write(s.entries[id].vector); err != nil {
+			return err
+		}
+	}
+
+	return sw.close()
+}
+
+// Restore replaces the vectors with a snapshot.
+// The store is left unchanged when the snapshot is corrupt.
+func (s *MemoryVectorStore) Restore(r io.Reader) error {
+	sr, err := newSnapshotReader(r, snapshotVectors)
+	if err != nil {
+		return err
+	}
+
+	restored := NewMemoryVectorStore(WithLabelAnalyzer(s.analyzer))
+	for {
+		var v TattooImagesVector
+		ok, err := sr.next(&v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := restored.AddVector(context.Background(), v); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.entries {
+		s.touch(id)
+	}
+	for id := range restored.entries {
+		s.touch(id)
+	}
+	s.entries, s.vocabulary, s.postings = restored.entries, restored.vocabulary, restored.postings
+
+	return nil
+}
+
+// sortedIDs returns the keys of the map in lexical order.
+func sortedIDs[V any](m map[string]V) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+// SaveSnapshot writes both stores to the file at path, through a rename so it's never partial.
+func SaveSnapshot(path string, is *MemoryImageStore, vs *MemoryVectorStore) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	if err := errors.Join(is.Snapshot(w), vs.Snapshot(w), w.Flush()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshot restores both stores from the file at path, a missing file restores nothing.
+func LoadSnapshot(path string, is *MemoryImageStore, vs *MemoryVectorStore) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := &snapshotFile{r: bufio.NewReader(f)}
+	if err := is.Restore(r); err != nil {
+		return fmt.Errorf("snapshot %s images: %w", path, err)
+	}
+	if err := vs.Restore(r); err != nil {
+		return fmt.Errorf("snapshot %s vectors: %w", path, err)
+	}
+
+	return nil
+}
+
+// RunSnapshots saves the stores every interval until the context ends.
+// A zero interval is the default of the policy.
+func RunSnapshots(ctx context.Context, p SnapshotPolicy, is *MemoryImageStore, vs *MemoryVectorStore) {
+	p = p.withDefaults()
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SaveSnapshot(p.Path, is, vs); err != nil {
+				slog.ErrorContext(ctx, "snapshot failed", "path", p.Path, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store snapshots", func() {
+	var (
+		is *searchAPI.MemoryImageStore
+		vs *searchAPI.MemoryVectorStore
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		for _, tc := range inkinspottest.BigCats {
+			Expect(is.AddCollection(context.Background(), tc.Collection)).To(Succeed())
+			Expect(vs.AddVector(context.Background(), tc.Vector)).To(Succeed())
+		}
+	})
+
+	It("restores the stores after a restart", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "stores.snap")
+		Expect(searchAPI.SaveSnapshot(path, is, vs)).To(Succeed())
+
+		restoredImages := searchAPI.NewMemoryImageStore()
+		restoredVectors := searchAPI.NewMemoryVectorStore()
+		Expect(searchAPI.LoadSnapshot(path, restoredImages, restoredVectors)).To(Succeed())
+
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(searchAPI.Configuration{}, restoredImages, restoredVectors)))
+		DeferCleanup(se.Close)
+
+		res := doSearch(se, url.Values{"q": {"lion chest"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Y", "Z"}))
+
+		vectors, err := restoredVectors.GetVectorsByID(context.Background(), []string{"Z"})
+		Expect(err).NotTo(HaveOccurred())
+		// the version is the one stored before the restart.
+		want := inkinspottest.BigCats[2].Vector
+		want.Version = 1
+		Expect(vectors).To(Equal([]searchAPI.TattooImagesVector{want}))
+	})
+
+	It("restores nothing without a snapshot file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "missing.snap")
+		Expect(searchAPI.LoadSnapshot(path, searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore())).To(Succeed())
+	})
+
+	It("fails on a corrupt record with its offset and keeps the store", func() {
+		var buf bytes.Buffer
+		Expect(is.Snapshot(&buf)).To(Succeed())
+
+		// the first record starts after the 10 bytes header & its 4 bytes length.
+		b := buf.Bytes()
+		b[14] = '!'
+
+		restored := searchAPI.NewMemoryImageStore()
+		Expect(restored.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "kept"})).To(Succeed())
+
+		err := restored.Restore(bytes.NewReader(b))
+		Expect(err).To(MatchError(searchAPI.ErrCorruptSnapshot))
+		Expect(err.Error()).To(ContainSubstring("offset 10"))
+
+		kept, err := restored.GetTattoosByID(context.Background(), []string{"kept"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kept).To(HaveLen(1))
+	})
+
+	It("fails on a corrupt vector with its offset in the file", func() {
+		var images bytes.Buffer
+		Expect(is.Snapshot(&images)).To(Succeed())
+		path := filepath.Join(GinkgoT().TempDir(), "stores.snap")
+		Expect(searchAPI.SaveSnapshot(path, is, vs)).To(Succeed())
+
+		// the first vector starts after the images, the 10 bytes header & its 4 bytes length.
+		b, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		b[images.Len()+14] = '!'
+		Expect(os.WriteFile(path, b, 0o600)).To(Succeed())
+
+		err = searchAPI.LoadSnapshot(path, searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore())
+		Expect(err).To(MatchError(searchAPI.ErrCorruptSnapshot))
+		Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("vectors: corrupt snapshot at offset %d:", images.Len()+10)))
+	})
+
+	It("fails on a truncated snapshot", func() {
+		var buf bytes.Buffer
+		Expect(vs.Snapshot(&buf)).To(Succeed())
+
+		err := searchAPI.NewMemoryVectorStore().Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+		Expect(err).To(MatchError(searchAPI.ErrCorruptSnapshot))
+		Expect(err.Error()).To(ContainSubstring("unexpected EOF"))
+	})
+
+	It("fails on another store's snapshot", func() {
+		var buf bytes.Buffer
+		Expect(is.Snapshot(&buf)).To(Succeed())
+
+		err := searchAPI.NewMemoryVectorStore().Restore(&buf)
+		Expect(err).To(MatchError(searchAPI.ErrCorruptSnapshot))
+		Expect(err.Error()).To(ContainSubstring("offset 10"))
+	})
+
+	It("fails loudly on a corrupt snapshot file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "stores.snap")
+		Expect(os.WriteFile(path, []byte("not a snapshot"), 0o600)).To(Succeed())
+
+		err := searchAPI.LoadSnapshot(path, searchAPI.NewMemoryImageStore(), searchAPI.NewMemoryVectorStore())
+		Expect(err).To(MatchError(searchAPI.ErrCorruptSnapshot))
+		Expect(err.Error()).To(ContainSubstring(path))
+	})
+})
@@ -0,0 +1,67 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// fetchChunks fetches the collections of the IDs in concurrent chunks of the image store chunk size.
+// When the context expires, the collections of the completed chunks are returned & timedOut is set.
+// The chunks the failed shards of a sharded store miss are kept & partial is set.
+// It fails when no chunk completed, or a chunk failed otherwise.
+func (e *SearchEngine) fetchChunks(ctx context.Context, ids []string, prefetch <-chan []TattooImagesCollection) (cols []TattooImagesCollection, partial, timedOut bool, err error) {
+	missing := ids
+	if prefetch != nil && len(ids) > 0 {
+		cols, missing = e.takePrefetched(ctx, ids, prefetch)
+	}
+
+	type chunk struct {
+		cols    []TattooImagesCollection
+		partial bool
+		err     error
+	}
+	size := e.configuration.TimeoutPolicy.ImageStoreChunkSize
+	// the channel holds every chunk, the ones completing after the timeout don't block.
+	results := make(chan chunk, (len(missing)+size-1)/size)
+	for start := 0; start < len(missing); start += size {
+		part := missing[start:min(start+size, len(missing))]
+		go func() {
+			cols, partial, err := shardsServed(foundOnly(e.getCollections(ctx, part)))
+			results <- chunk{cols, partial, err}
+		}()
+	}
+
+	completed := len(cols) > 0
+	for range cap(results) {
+		var c chunk
+		select {
+		case c = <-results:
+		case <-ctx.Done():
+			c.err = ctx.Err()
+		}
+		if errors.Is(c.err, context.DeadlineExceeded) {
+			timedOut = true
+			break
+		}
+		if c.err != nil {
+			return nil, false, false, c.err
+		}
+		cols = append(cols, c.cols...)
+		partial = partial || c.partial
+		completed = true
+	}
+	// the chunks which completed meanwhile are kept.
+	for timedOut && len(results) > 0 {
+		if c := <-results; c.err == nil {
+			cols = append(cols, c.cols...)
+			partial = partial || c.partial
+			completed = true
+		}
+	}
+	if timedOut && !completed {
+		return nil, false, false, fmt.Errorf("%w: no chunk completed", context.DeadlineExceeded)
+	}
+
+	return cols, partial, timedOut, nil
+}
@@ -0,0 +1,111 @@
+package inkinspot_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// hangingImageStore hangs the fetches of the slow IDs until their context is done, while hang is set.
+type hangingImageStore struct {
+	*searchAPI.MemoryImageStore
+	slow map[string]bool
+	hang atomic.Bool
+}
+
+func (s *hangingImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	if s.hang.Load() && slices.ContainsFunc(ids, func(id string) bool { return s.slow[id] }) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.MemoryImageStore.GetTattoosByID(ctx, ids)
+}
+
+var _ = Describe("Soft timeouts", func() {
+	var (
+		is  *hangingImageStore
+		ids []string
+	)
+
+	// initServer seeds 15 lions ranked by ID, the fetch of the second chunk of 10 hangs.
+	initServer := func(timeouts searchAPI.TimeoutPolicy) *httptest.Server {
+		GinkgoHelper()
+		timeouts.ImageStoreTimeout = 50 * time.Millisecond
+		timeouts.ImageStoreChunkSize = 10
+		cfg := searchAPI.Configuration{TimeoutPolicy: timeouts, CachePolicy: searchAPI.CachePolicy{TTL: time.Minute, CacheBodies: true}}
+
+		is = &hangingImageStore{MemoryImageStore: searchAPI.NewMemoryImageStore(), slow: map[string]bool{}}
+		is.hang.Store(true)
+		vs := searchAPI.NewMemoryVectorStore()
+		ids = nil
+		for i := range 15 {
+			id := fmt.Sprintf("T%02d", i)
+			ids = append(ids, id)
+			if i >= 10 {
+				is.slow[id] = true
+			}
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+			Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: id, Subject: searchAPI.LabelSet{"lion": 0.99 - float64(i)*0.01}})).To(Succeed())
+		}
+
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+		return se
+	}
+
+	It("returns the chunks fetched before the image store timeout", func() {
+		se := initServer(searchAPI.TimeoutPolicy{})
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "best_effort": {"true"}})
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Partial).To(BeTrue())
+		Expect(res.JSON.Timeout).To(BeTrue())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ids[:10]))
+	})
+
+	It("fails the searches which aren't best effort", func() {
+		se := initServer(searchAPI.TimeoutPolicy{})
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusGatewayTimeout))
+		Expect(res.JSON.Error.Code).To(Equal("image_store_timeout"))
+	})
+
+	It("makes every search best effort by the policy", func() {
+		se := initServer(searchAPI.TimeoutPolicy{SoftTimeout: true})
+
+		res := doQuery(se, "lion")
+		Expect(res.Status).To(Equal(http.StatusOK))
+		Expect(res.JSON.Partial).To(BeTrue())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ids[:10]))
+	})
+
+	It("doesn't cache the partial results", func() {
+		se := initServer(searchAPI.TimeoutPolicy{SoftTimeout: true})
+		Expect(doQuery(se, "lion").JSON.Partial).To(BeTrue())
+
+		is.hang.Store(false)
+		res := doQuery(se, "lion")
+		Expect(res.JSON.Partial).To(BeFalse())
+		Expect(res.JSON.Timeout).To(BeFalse())
+		Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(ids))
+	})
+
+	It("rejects a malformed best_effort", func() {
+		se := initServer(searchAPI.TimeoutPolicy{})
+
+		res := doSearch(se, url.Values{"q": {"lion"}, "best_effort": {"maybe"}})
+		Expect(res.Status).To(Equal(http.StatusBadRequest))
+		Expect(res.JSON.Error.Code).To(Equal("invalid_best_effort"))
+	})
+})
@@ -0,0 +1,203 @@
+package inkinspot
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+)
+
+// SpeculationPolicy prefetches the collections a repeated search found last time.
+// The image store is asked while the vector query runs, the fresh IDs decide what's kept.
+// Zero values are replaced by the defaults.
+type SpeculationPolicy struct {
+	Enabled bool
+	// HistorySize caps the searches whose collection IDs are remembered.
+	HistorySize int
+}
+
+func (p SpeculationPolicy) withDefaults() SpeculationPolicy {
+	if p.HistorySize <= 0 {
+		p.HistorySize = 1024
+	}
+
+	return p
+}
+
+// SpeculationStats reports the speculative prefetches & the ones which had every collection needed.
+type SpeculationStats struct {
+	Speculated uint64  `json:"speculated"`
+	Hits       uint64  `json:"hits"`
+	HitRate    float64 `json:"hit_rate"`
+}
+
+// speculation is an LRU of the collection IDs of the searches, by their cache key.
+// A nil speculation is valid and remembers nothing.
+type speculation struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	stats   SpeculationStats
+}
+
+type speculationEntry struct {
+	key string
+	ids []string
+}
+
+// newSpeculation creates the history of the policy, nil when it's disabled.
+func newSpeculation(p SpeculationPolicy) *speculation {
+	if !p.Enabled {
+		return nil
+	}
+
+	return &speculation{size: p.HistorySize, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// recall returns the collection IDs the search found last time.
+func (s *speculation) recall(key string) []string {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	s.order.MoveToFront(el)
+
+	return el.Value.(*speculationEntry).ids
+}
+
+// remember keeps the collection IDs the search found, evicting the least recently used beyond the size.
+func (s *speculation) remember(key string, ranked []RankedVector) {
+	if s == nil {
+		return
+	}
+
+	ids := make([]string, 0, len(ranked))
+	for _, rv := range ranked {
+		ids = append(ids, rv.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*speculationEntry).ids = ids
+		s.order.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&speculationEntry{key: key, ids: ids})
+	for s.order.Len() > s.size {
+		back := s.order.Back()
+		s.order.Remove(back)
+		delete(s.entries, back.Value.(*speculationEntry).key)
+	}
+}
+
+// record counts a speculation, a hit when the prefetch had every collection needed.
+func (s *speculation) record(hit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Speculated++
+	if hit {
+		s.stats.Hits++
+	}
+}
+
+// Speculation reports the speculative prefetches of the repeated searches.
+func (e *SearchEngine) Speculation() SpeculationStats {
+	if e.speculation == nil {
+		return SpeculationStats{}
+	}
+
+	e.speculation.mu.Lock()
+	defer e.speculation.mu.Unlock()
+
+	stats := e.speculation.stats
+	if stats.Speculated > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(stats.Speculated)
+	}
+
+	return stats
+}
+
+// prefetch fetches the collections of the IDs in the background, none when it fails.
+func (e *SearchEngine) prefetch(ctx context.Context, ids []string) <-chan []TattooImagesCollection {
+	out := make(chan []TattooImagesCollection, 1)
+	go func() {
+		pfCtx, pfCancel := e.withTightTimeout(ctx, e.imageStoreTimeout(ctx))
+		defer pfCancel()
+
+		cols, err := foundOnly(e.getCollections(pfCtx, ids))
+		if err != nil {
+			cols = nil
+		}
+		out <- cols
+	}()
+
+	return out
+}
+
+// fetchCollections returns the collections of the IDs, the prefetched ones still wanted are kept.
+// Only the IDs the prefetch missed are fetched.
+func (e *SearchEngine) fetchCollections(ctx context.Context, ids []string, prefetch <-chan []TattooImagesCollection) ([]TattooImagesCollection, error) {
+	if prefetch == nil || len(ids) == 0 {
+		return e.getCollections(ctx, ids)
+	}
+
+	kept, missing := e.takePrefetched(ctx, ids, prefetch)
+	if len(missing) == 0 {
+		return kept, nil
+	}
+
+	fetched, err := e.getCollections(ctx, missing)
+	return append(kept, fetched...), err
+}
+
+// takePrefetched waits for the prefetch within the context & keeps the collections of the IDs.
+// It returns the IDs the prefetch missed in their order.
+func (e *SearchEngine) takePrefetched(ctx context.Context, ids []string, prefetch <-chan []TattooImagesCollection) ([]TattooImagesCollection, []string) {
+	var prefetched []TattooImagesCollection
+	select {
+	case prefetched = <-prefetch:
+	case <-ctx.Done():
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	kept := make([]TattooImagesCollection, 0, len(ids))
+	for _, c := range prefetched {
+		if wanted[c.ID] {
+			kept = append(kept, c)
+			delete(wanted, c.ID)
+		}
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if wanted[id] {
+			missing = append(missing, id)
+			delete(wanted, id)
+		}
+	}
+	e.speculation.record(len(missing) == 0)
+
+	return kept, missing
+}
+
+// handleSpeculation reports the speculative prefetches.
+func handleSpeculation(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.Speculation())
+	})
+}
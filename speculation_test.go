@@ -0,0 +1,70 @@
+package inkinspot_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+)
+
+var _ = Describe("Speculative prefetch", func() {
+	const delay = 100 * time.Millisecond
+
+	var (
+		engine   *searchAPI.SearchEngine
+		is       *inkinspottest.FakeImageStore
+		vs       *inkinspottest.FakeVectorStore
+		recorder *recordingImageStore
+	)
+
+	BeforeEach(func() {
+		is, vs = inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		recorder = &recordingImageStore{FakeImageStore: is}
+		cfg := searchAPI.Configuration{
+			TimeoutPolicy:     searchAPI.TimeoutPolicy{ImageStoreTimeout: 10 * delay, VectorStoreTimeout: 10 * delay},
+			SpeculationPolicy: searchAPI.SpeculationPolicy{Enabled: true},
+		}
+		engine = searchAPI.NewSearchEngine(cfg, inkinspottest.NewLatencyStore(recorder, delay), inkinspottest.NewLatencyStore(vs, delay))
+	})
+
+	search := func() *searchAPI.SearchResult {
+		res, err := engine.MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	It("serves a repeated search from the prefetch when its IDs are unchanged", func() {
+		first := search()
+		Expect(first.Timings.ImageStore).To(BeNumerically(">=", delay))
+
+		second := search()
+		Expect(second.Collections()).To(Equal(first.Collections()))
+		Expect(second.Timings.ImageStore).To(BeNumerically("<", delay/2), "the prefetch ran alongside the vector query")
+		Expect(recorder.lookups).To(HaveLen(2))
+		Expect(engine.Speculation()).To(Equal(searchAPI.SpeculationStats{Speculated: 1, Hits: 1, HitRate: 1}))
+	})
+
+	It("discards the prefetched collections no longer matched & fetches the new ones", func() {
+		Expect(collectionIDs(search().Collections())).To(Equal([]string{"X", "Y"}))
+
+		ctx := context.Background()
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "Y", Subject: searchAPI.LabelSet{"tiger": 100}})).To(Succeed())
+		Expect(vs.AddVector(ctx, searchAPI.TattooImagesVector{ID: "W", Subject: searchAPI.LabelSet{"lion": 100}})).To(Succeed())
+		Expect(is.AddCollection(ctx, searchAPI.TattooImagesCollection{ID: "W", URLs: []string{"lion_w.jpg"}})).To(Succeed())
+
+		Expect(collectionIDs(search().Collections())).To(Equal([]string{"W", "X"}))
+		Expect(recorder.last()).To(Equal([]string{"W"}), "only the new ID is fetched")
+		Expect(engine.Speculation()).To(Equal(searchAPI.SpeculationStats{Speculated: 1, HitRate: 0}))
+	})
+
+	It("doesn't speculate when disabled", func() {
+		engine = searchAPI.NewSearchEngine(searchAPI.Configuration{}, recorder, vs)
+		search()
+		search()
+		Expect(engine.Speculation()).To(BeZero())
+	})
+})
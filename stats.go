@@ -0,0 +1,168 @@
+package inkinspot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// StatsPolicy bounds the gathering of the catalog statistics.
+// Zero values are replaced by the defaults.
+type StatsPolicy struct {
+	// Timeout bounds a gathering of the statistics from the stores.
+	Timeout time.Duration
+	// TTL is how long the gathered statistics are served before the stores are asked again.
+	TTL time.Duration
+	// TopLabels is the number of the most frequent labels reported by facet.
+	TopLabels int
+}
+
+func (p StatsPolicy) withDefaults() StatsPolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = 5 * time.Second
+	}
+	if p.TTL <= 0 {
+		p.TTL = time.Minute
+	}
+	if p.TopLabels <= 0 {
+		p.TopLabels = 20
+	}
+
+	return p
+}
+
+// Counter is implemented by the stores which can count their records, the collections or the vectors.
+type Counter interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// LabelHistogrammer is implemented by the vector stores which can count the vectors of every label of a facet.
+// It returns ErrUnknownFacet for the facets other than FacetStyle, FacetSubject & FacetArea.
+type LabelHistogrammer interface {
+	LabelHistogram(ctx context.Context, facet string) (map[string]int, error)
+}
+
+// LabelCount is the number of vectors with a label.
+type LabelCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// FacetStats describes the labels of a facet, the most frequent first, ties by label.
+type FacetStats struct {
+	DistinctLabels int          `json:"distinct_labels"`
+	TopLabels      []LabelCount `json:"top_labels"`
+}
+
+// CatalogStats are the numbers of the catalog.
+// The counts are nil when the store can't count, the facets are missing when the vector store has no histograms.
+// The orphans are those of the last consistency check, nil before one ran. The cache stats are always current.
+type CatalogStats struct {
+	GatheredAt        time.Time             `json:"gathered_at"`
+	Collections       *int                  `json:"collections"`
+	Vectors           *int                  `json:"vectors"`
+	Facets            map[string]FacetStats `json:"facets,omitempty"`
+	OrphanVectors     *int                  `json:"orphan_vectors"`
+	OrphanCollections *int                  `json:"orphan_collections"`
+	Cache             CacheStats            `json:"cache"`
+}
+
+// catalogStats keeps the last gathered statistics for the TTL of the policy.
+type catalogStats struct {
+	mu   sync.Mutex
+	last *CatalogStats
+}
+
+// topLabels returns the histogram as label counts, the most frequent first, at most n.
+func topLabels(histogram map[string]int, n int) []LabelCount {
+	counts := make([]LabelCount, 0, len(histogram))
+	for label, count := range histogram {
+		counts = append(counts, LabelCount{Label: label, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b LabelCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Label, b.Label))
+	})
+
+	return counts[:min(n, len(counts))]
+}
+
+// Stats returns the numbers of the catalog, gathered from the stores at most once per TTL of the policy.
+// The gathering is bounded by the timeout of the policy, a concurrent call waits for it.
+func (e *SearchEngine) Stats(ctx context.Context) (CatalogStats, error) {
+	policy := e.configuration.StatsPolicy
+	cached := e.stats
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.last == nil || e.clock.Now().Sub(cached.last.GatheredAt) >= policy.TTL {
+		stats, err := e.gatherStats(ctx, policy)
+		if err != nil {
+			return CatalogStats{}, err
+		}
+		cached.last = &stats
+	}
+
+	stats := *cached.last
+	if report, ok := e.ConsistencyReport(); ok {
+		stats.OrphanVectors, stats.OrphanCollections = &report.OrphanVectorCount, &report.OrphanCollectionCount
+	}
+	stats.Cache = e.CacheStats()
+
+	return stats, nil
+}
+
+// gatherStats asks the stores for the counts & the histograms of the catalog within the timeout of the policy.
+func (e *SearchEngine) gatherStats(ctx context.Context, policy StatsPolicy) (CatalogStats, error) {
+	ctx, cancel := e.withTightTimeout(ctx, policy.Timeout)
+	defer cancel()
+
+	stats := CatalogStats{GatheredAt: e.clock.Now()}
+	counts := []struct {
+		name  string
+		store any
+		count **int
+	}{{ImageStoreName, e.imageStore, &stats.Collections}, {VectorStoreName, e.vectorStore, &stats.Vectors}}
+	for _, c := range counts {
+		counter, ok := storeAs[Counter](c.store)
+		if !ok {
+			continue
+		}
+		n, err := counter.Count(ctx)
+		if err != nil {
+			return CatalogStats{}, e.storeError(c.name, "count", err)
+		}
+		*c.count = &n
+	}
+
+	if histogrammer, ok := storeAs[LabelHistogrammer](e.vectorStore); ok {
+		stats.Facets = make(map[string]FacetStats, 3)
+		for _, facet := range []string{FacetStyle, FacetSubject, FacetArea} {
+			histogram, err := histogrammer.LabelHistogram(ctx, facet)
+			if err != nil {
+				return CatalogStats{}, e.storeError(VectorStoreName, "histogram", err)
+			}
+			stats.Facets[facet] = FacetStats{DistinctLabels: len(histogram), TopLabels: topLabels(histogram, policy.TopLabels)}
+		}
+	}
+
+	return stats, nil
+}
+
+// handleStats reports the numbers of the catalog.
+func handleStats(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := se.Stats(r.Context())
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, stats)
+		case errors.Is(err, context.DeadlineExceeded):
+			writeError(w, http.StatusGatewayTimeout, "stats_timeout", "gathering the stats timed out")
+		default:
+			writeError(w, http.StatusInternalServerError, "internal_error", "gathering the stats failed")
+		}
+	})
+}
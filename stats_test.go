@@ -0,0 +1,147 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// stalledCounter counts the collections once its context is done, too late.
+type stalledCounter struct {
+	*searchAPI.MemoryImageStore
+}
+
+func (s stalledCounter) Count(ctx context.Context) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+// getStats requests the stats with the token, it decodes the stats of a 200 or the error.
+func getStats(se *httptest.Server, token string) (int, searchAPI.CatalogStats, *searchAPI.APIError) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/stats", nil)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var stats searchAPI.CatalogStats
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&stats)).To(Succeed())
+		return resp.StatusCode, stats, nil
+	}
+	var failed searchAPI.Response
+	Expect(json.NewDecoder(resp.Body).Decode(&failed)).To(Succeed())
+
+	return resp.StatusCode, stats, failed.Error
+}
+
+var _ = Describe("Catalog stats", func() {
+	var (
+		is     *searchAPI.MemoryImageStore
+		vs     *searchAPI.MemoryVectorStore
+		clock  *inkinspottest.FakeClock
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+	)
+
+	// D has no vector, the image store doesn't know X.
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		for _, id := range []string{"A", "B", "C", "D"} {
+			Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: id})).To(Succeed())
+		}
+		for _, v := range []searchAPI.TattooImagesVector{
+			{ID: "A", Style: searchAPI.LabelSet{"blackwork": 0.9}, Subject: searchAPI.LabelSet{"lion": 0.9}, Area: searchAPI.LabelSet{"arm": 0.5}},
+			{ID: "B", Style: searchAPI.LabelSet{"blackwork": 0.4}, Subject: searchAPI.LabelSet{"lion": 0.3, "rose": 0.8}, Area: searchAPI.LabelSet{"arm": 0.7}},
+			{ID: "C", Style: searchAPI.LabelSet{"traditional": 0.8}, Subject: searchAPI.LabelSet{"rose": 0.6}, Area: searchAPI.LabelSet{"leg": 0.9}},
+			{ID: "X", Style: searchAPI.LabelSet{"blackwork": 0.2}, Subject: searchAPI.LabelSet{"skull": 0.9}, Area: searchAPI.LabelSet{"back": 0.4}},
+		} {
+			Expect(vs.AddVector(context.Background(), v)).To(Succeed())
+		}
+
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+		cfg := searchAPI.Configuration{
+			AdminPolicy: searchAPI.AdminPolicy{Token: adminToken},
+			StatsPolicy: searchAPI.StatsPolicy{TTL: time.Minute, TopLabels: 2},
+		}
+		engine = searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	It("counts the catalog", func() {
+		status, stats, _ := getStats(se, adminToken)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(stats.GatheredAt).To(BeTemporally("==", clock.Now()))
+		Expect(stats.Collections).To(HaveValue(Equal(4)))
+		Expect(stats.Vectors).To(HaveValue(Equal(4)))
+		Expect(stats.Facets).To(Equal(map[string]searchAPI.FacetStats{
+			searchAPI.FacetStyle:   {DistinctLabels: 2, TopLabels: []searchAPI.LabelCount{{Label: "blackwork", Count: 3}, {Label: "traditional", Count: 1}}},
+			searchAPI.FacetSubject: {DistinctLabels: 3, TopLabels: []searchAPI.LabelCount{{Label: "lion", Count: 2}, {Label: "rose", Count: 2}}},
+			searchAPI.FacetArea:    {DistinctLabels: 3, TopLabels: []searchAPI.LabelCount{{Label: "arm", Count: 2}, {Label: "back", Count: 1}}},
+		}))
+		Expect(stats.OrphanVectors).To(BeNil(), "nothing was checked yet")
+		Expect(stats.OrphanCollections).To(BeNil())
+	})
+
+	It("reports the orphans of the last consistency check", func() {
+		_, err := engine.CheckConsistency(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, stats, _ := getStats(se, adminToken)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(stats.OrphanVectors).To(HaveValue(Equal(1)))
+		Expect(stats.OrphanCollections).To(HaveValue(Equal(1)))
+	})
+
+	It("serves the stats gathered within the TTL", func() {
+		_, before, _ := getStats(se, adminToken)
+
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "D", Subject: searchAPI.LabelSet{"lion": 0.5}})).To(Succeed())
+		clock.Advance(30 * time.Second)
+		_, cached, _ := getStats(se, adminToken)
+		Expect(cached.GatheredAt).To(BeTemporally("==", before.GatheredAt))
+		Expect(cached.Vectors).To(HaveValue(Equal(4)))
+
+		clock.Advance(30 * time.Second)
+		_, fresh, _ := getStats(se, adminToken)
+		Expect(fresh.GatheredAt).To(BeTemporally("==", clock.Now()))
+		Expect(fresh.Vectors).To(HaveValue(Equal(5)))
+		Expect(fresh.Facets[searchAPI.FacetSubject].TopLabels[0]).To(Equal(searchAPI.LabelCount{Label: "lion", Count: 3}))
+	})
+
+	It("leaves out what the stores can't count", func() {
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, chunkedVectorStore{})
+		stats, err := engine.Stats(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Collections).To(HaveValue(Equal(4)))
+		Expect(stats.Vectors).To(BeNil())
+		Expect(stats.Facets).To(BeNil())
+	})
+
+	It("times out the stalled stores", func() {
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}, StatsPolicy: searchAPI.StatsPolicy{Timeout: 50 * time.Millisecond}}
+		se := httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, stalledCounter{is}, vs)))
+		DeferCleanup(se.Close)
+
+		status, _, apiErr := getStats(se, adminToken)
+		Expect(status).To(Equal(http.StatusGatewayTimeout))
+		Expect(apiErr.Code).To(Equal("stats_timeout"))
+	})
+
+	It("needs the admin token", func() {
+		status, _, _ := getStats(se, "wrong")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+})
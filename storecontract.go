@@ -0,0 +1,303 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// The invariants of the store results, the ones a StoreContractError reports.
+// The nil URLs are normalized by the validating stores, the others fail their calls.
+// The matches of a query may repeat an ID, the vector stores matching many chunks of a tattoo do.
+// The unrequested IDs are left to the engine, which drops them unless its StoreContractPolicy is strict.
+const (
+	InvariantNilURLs       = "nil URLs"
+	InvariantEmptyID       = "empty ID"
+	InvariantDuplicateID   = "duplicate ID"
+	InvariantUnrequestedID = "unrequested ID"
+)
+
+// StoreInvariants are the invariants checked by CheckCollections, CheckIDs & CheckRequested, the validating stores,
+// the engine & the contract tests.
+var StoreInvariants = []string{InvariantNilURLs, InvariantEmptyID, InvariantDuplicateID, InvariantUnrequestedID}
+
+// StoreContractPolicy is how the engine treats the image stores returning collections it didn't request.
+type StoreContractPolicy struct {
+	// Strict fails the lookups returning an unrequested collection with a StoreContractError,
+	// they're dropped with a warning otherwise.
+	Strict bool
+}
+
+// StoreContractError is a store result breaking one of the StoreInvariants.
+type StoreContractError struct {
+	// Store & Op are the call which returned the result, empty when it was checked on its own.
+	Store     string
+	Op        string
+	Invariant string
+	// Index is the position of the offending record in the result, ID its ID.
+	Index int
+	ID    string
+}
+
+// Error describes the violation, the engine's StoreError names the call.
+func (e *StoreContractError) Error() string {
+	return fmt.Sprintf("%s: %s %q at %d", ErrStoreContract, e.Invariant, e.ID, e.Index)
+}
+
+func (e *StoreContractError) Unwrap() error {
+	return ErrStoreContract
+}
+
+// CheckIDs returns a StoreContractError when the IDs of a store result break an invariant.
+func CheckIDs(ids []string) error {
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		if id == "" {
+			return &StoreContractError{Invariant: InvariantEmptyID, Index: i}
+		}
+		if seen[id] {
+			return &StoreContractError{Invariant: InvariantDuplicateID, Index: i, ID: id}
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
+
+// CheckMatches returns a StoreContractError when the IDs a query matched break an invariant.
+// Unlike CheckIDs, it lets them repeat.
+func CheckMatches(ids []string) error {
+	if i := slices.Index(ids, ""); i >= 0 {
+		return &StoreContractError{Invariant: InvariantEmptyID, Index: i}
+	}
+
+	return nil
+}
+
+// CheckRequested returns a StoreContractError when the collections of a lookup hold an ID among none of the IDs.
+func CheckRequested(ids []string, cols []TattooImagesCollection) error {
+	requested := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+	for i, c := range cols {
+		if !requested[c.ID] {
+			return &StoreContractError{Invariant: InvariantUnrequestedID, Index: i, ID: c.ID}
+		}
+	}
+
+	return nil
+}
+
+// CheckCollections returns a StoreContractError when the collections of a store result break an invariant.
+func CheckCollections(cols []TattooImagesCollection) error {
+	if err := CheckIDs(collectionIDsOf(cols)); err != nil {
+		return err
+	}
+	for i, c := range cols {
+		if c.URLs == nil {
+			return &StoreContractError{Invariant: InvariantNilURLs, Index: i, ID: c.ID}
+		}
+	}
+
+	return nil
+}
+
+// CheckVectors returns a StoreContractError when the vectors of a store result break an invariant.
+func CheckVectors(vectors []TattooImagesVector) error {
+	ids := make([]string, 0, len(vectors))
+	for _, v := range vectors {
+		ids = append(ids, v.ID)
+	}
+
+	return CheckIDs(ids)
+}
+
+// WithoutStoreValidation leaves the results of the stores unvalidated, for the stores trusted to keep the invariants.
+func WithoutStoreValidation() SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.trustStores = true
+	}
+}
+
+// contractError names the call of a StoreContractError, the other errors are returned as they are.
+func contractError(store, op string, err error) error {
+	var ce *StoreContractError
+	if errors.As(err, &ce) {
+		ce.Store, ce.Op = store, op
+	}
+
+	return err
+}
+
+// lookupCollections looks up the collections of the IDs in the image store.
+// The collections it returns for IDs it wasn't asked for, as a backend returning its whole table would,
+// are dropped & counted, or fail the lookup with a StoreContractError when the StoreContractPolicy is strict.
+func (e *SearchEngine) lookupCollections(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	cols, err := e.imageStore.GetTattoosByID(ctx, ids)
+	if err != nil && !errors.Is(err, ErrCollectionNotFound) {
+		return cols, err
+	}
+	cerr := CheckRequested(ids, cols)
+	if cerr == nil {
+		return cols, err
+	}
+	if e.configuration.StoreContractPolicy.Strict {
+		return nil, contractError(ImageStoreName, "get", cerr)
+	}
+
+	requested := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+	kept := make([]TattooImagesCollection, 0, len(ids))
+	for _, c := range cols {
+		if requested[c.ID] {
+			kept = append(kept, c)
+		}
+	}
+	dropped := len(cols) - len(kept)
+	e.unrequestedCollections.Add(int64(dropped))
+	slog.WarnContext(ctx, "the image store returned unrequested collections, they're dropped", "requested", len(ids), "returned", len(cols), "dropped", dropped)
+
+	return kept, err
+}
+
+// UnrequestedCollections returns the number of collections the image store returned without being asked for since the start,
+// the ones dropped by the lookups.
+func (e *SearchEngine) UnrequestedCollections() int64 {
+	return e.unrequestedCollections.Load()
+}
+
+// ValidatingImageStore checks the results of an image store against the StoreInvariants.
+// The nil slices are replaced by empty ones, the other violations fail the call with a StoreContractError.
+type ValidatingImageStore struct {
+	store ImageStore
+	name  string
+}
+
+// NewValidatingImageStore validates the results of the store, named in its errors.
+func NewValidatingImageStore(store ImageStore, name string) ValidatingImageStore {
+	return ValidatingImageStore{store: store, name: name}
+}
+
+func (s ValidatingImageStore) unwrap() any { return s.store }
+
+// validate normalizes & checks the collections of a call, its error is kept when they're valid.
+func (s ValidatingImageStore) validate(op string, cols []TattooImagesCollection, err error) ([]TattooImagesCollection, error) {
+	if err != nil && !errors.Is(err, ErrCollectionNotFound) {
+		return cols, err
+	}
+
+	cols = normalizeCollections(cols)
+	if cerr := CheckCollections(cols); cerr != nil {
+		return nil, contractError(s.name, op, cerr)
+	}
+
+	return cols, err
+}
+
+func (s ValidatingImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]TattooImagesCollection, error) {
+	cols, err := s.store.GetTattoosByID(ctx, ids)
+	return s.validate("get", cols, err)
+}
+
+func (s ValidatingImageStore) SampleTattoos(ctx context.Context, n int, at time.Time) ([]TattooImagesCollection, error) {
+	cols, err := wrapped[TattooSampler](s.store).SampleTattoos(ctx, n, at)
+	return s.validate("sample", cols, err)
+}
+
+func (s ValidatingImageStore) ListCollections(ctx context.Context, cursor string, limit int) ([]TattooImagesCollection, string, error) {
+	cols, next, err := wrapped[CollectionLister](s.store).ListCollections(ctx, cursor, limit)
+	cols, err = s.validate("list", cols, err)
+	return cols, next, err
+}
+
+// normalizeCollections replaces the nil result & nil URLs by empty slices, the collections of the store are copied first.
+func normalizeCollections(cols []TattooImagesCollection) []TattooImagesCollection {
+	if cols == nil {
+		return []TattooImagesCollection{}
+	}
+
+	copied := false
+	for i, c := range cols {
+		if c.URLs != nil {
+			continue
+		}
+		if !copied {
+			cols, copied = append([]TattooImagesCollection(nil), cols...), true
+		}
+		cols[i].URLs = []string{}
+	}
+
+	return cols
+}
+
+// ValidatingVectorStore checks the results of a vector store against the StoreInvariants.
+// The nil slices are replaced by empty ones, the other violations fail the call with a StoreContractError.
+type ValidatingVectorStore struct {
+	store VectorStore
+	name  string
+}
+
+// NewValidatingVectorStore validates the results of the store, named in its errors.
+func NewValidatingVectorStore(store VectorStore, name string) ValidatingVectorStore {
+	return ValidatingVectorStore{store: store, name: name}
+}
+
+func (s ValidatingVectorStore) unwrap() any { return s.store }
+
+// validate normalizes & checks the IDs of a call by the check, its error is kept when they're valid.
+func (s ValidatingVectorStore) validate(op string, ids []string, err error, check func([]string) error) ([]string, error) {
+	if err != nil {
+		return ids, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	if cerr := check(ids); cerr != nil {
+		return nil, contractError(s.name, op, cerr)
+	}
+
+	return ids, nil
+}
+
+func (s ValidatingVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	ids, err := s.store.GetIDsByQuery(ctx, query)
+	return s.validate("query", ids, err, CheckMatches)
+}
+
+func (s ValidatingVectorStore) GetIDsByQueryPage(ctx context.Context, query string, cursor string, limit int) ([]string, string, error) {
+	ids, next, err := wrapped[VectorStorePager](s.store).GetIDsByQueryPage(ctx, query, cursor, limit)
+	ids, err = s.validate("page", ids, err, CheckMatches)
+	return ids, next, err
+}
+
+func (s ValidatingVectorStore) GetIDsByLabels(ctx context.Context, facet string, labels []string) ([]string, error) {
+	ids, err := wrapped[LabelIndex](s.store).GetIDsByLabels(ctx, facet, labels)
+	return s.validate("labels", ids, err, CheckIDs)
+}
+
+func (s ValidatingVectorStore) ListVectorIDs(ctx context.Context, cursor string, limit int) ([]string, string, error) {
+	ids, next, err := wrapped[VectorLister](s.store).ListVectorIDs(ctx, cursor, limit)
+	ids, err = s.validate("list", ids, err, CheckIDs)
+	return ids, next, err
+}
+
+func (s ValidatingVectorStore) GetVectorsByID(ctx context.Context, ids []string) ([]TattooImagesVector, error) {
+	vectors, err := wrapped[VectorLookup](s.store).GetVectorsByID(ctx, ids)
+	if err != nil {
+		return vectors, err
+	}
+	if vectors == nil {
+		vectors = []TattooImagesVector{}
+	}
+	if cerr := CheckVectors(vectors); cerr != nil {
+		return nil, contractError(s.name, "lookup", cerr)
+	}
+
+	return vectors, nil
+}
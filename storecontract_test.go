@@ -0,0 +1,199 @@
+package inkinspot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// misbehavingImageStore rewrites the results of the image store.
+type misbehavingImageStore struct {
+	*inkinspottest.FakeImageStore
+	rewrite func([]searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection
+}
+
+func (s misbehavingImageStore) GetTattoosByID(ctx context.Context, ids []string) ([]searchAPI.TattooImagesCollection, error) {
+	cols, err := s.FakeImageStore.GetTattoosByID(ctx, ids)
+	return s.rewrite(cols), err
+}
+
+// misbehavingVectorStore rewrites the matches of the vector store.
+type misbehavingVectorStore struct {
+	*inkinspottest.FakeVectorStore
+	rewrite func([]string) []string
+}
+
+func (s misbehavingVectorStore) GetIDsByQuery(ctx context.Context, query string) ([]string, error) {
+	ids, err := s.FakeVectorStore.GetIDsByQuery(ctx, query)
+	return s.rewrite(ids), err
+}
+
+var _ = Describe("Store contract", func() {
+	keep := func(ids []string) []string { return ids }
+	keepCols := func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection { return cols }
+
+	search := func(rewriteCols func([]searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection, rewriteIDs func([]string) []string, opts ...searchAPI.SearchEngineOption) (*searchAPI.SearchResult, error) {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		engine := searchAPI.NewSearchEngine(searchAPI.Configuration{}, misbehavingImageStore{is, rewriteCols}, misbehavingVectorStore{vs, rewriteIDs}, opts...)
+		return engine.MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+	}
+
+	contractError := func(err error) *searchAPI.StoreContractError {
+		GinkgoHelper()
+		Expect(err).To(MatchError(searchAPI.ErrStoreContract))
+		var ce *searchAPI.StoreContractError
+		Expect(errors.As(err, &ce)).To(BeTrue())
+		return ce
+	}
+
+	It("replaces the nil URLs by empty ones", func() {
+		res, err := search(func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection {
+			for i := range cols {
+				cols[i].URLs = nil
+			}
+			return cols
+		}, keep)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Hits).NotTo(BeEmpty())
+		for _, c := range res.Collections() {
+			Expect(c.URLs).NotTo(BeNil())
+			Expect(c.URLs).To(BeEmpty())
+		}
+	})
+
+	DescribeTable("fails the results breaking an invariant",
+		func(rewriteCols func([]searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection, rewriteIDs func([]string) []string, store, op, invariant string) {
+			_, err := search(rewriteCols, rewriteIDs)
+			ce := contractError(err)
+			Expect(ce.Store).To(Equal(store))
+			Expect(ce.Op).To(Equal(op))
+			Expect(ce.Invariant).To(Equal(invariant))
+
+			var storeErr *searchAPI.StoreError
+			Expect(errors.As(err, &storeErr)).To(BeTrue(), "the engine counts it as a store failure")
+		},
+		Entry("an empty collection ID", func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection {
+			return append(cols, searchAPI.TattooImagesCollection{URLs: []string{}})
+		}, keep, searchAPI.ImageStoreName, "get", searchAPI.InvariantEmptyID),
+		Entry("a collection twice", func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection {
+			return append(cols, cols[0])
+		}, keep, searchAPI.ImageStoreName, "get", searchAPI.InvariantDuplicateID),
+		Entry("an empty matched ID", keepCols, func(ids []string) []string {
+			return append(ids, "")
+		}, searchAPI.VectorStoreName, "query", searchAPI.InvariantEmptyID),
+	)
+
+	It("lets the matches repeat", func() {
+		res, err := search(keepCols, func(ids []string) []string {
+			return append(ids, ids...)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Hits).NotTo(BeEmpty())
+	})
+
+	It("trusts the stores without the validation", func() {
+		res, err := search(func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection {
+			for i := range cols {
+				cols[i].URLs = nil
+			}
+			return cols
+		}, keep, searchAPI.WithoutStoreValidation())
+		Expect(err).NotTo(HaveOccurred())
+		for _, c := range res.Collections() {
+			Expect(c.URLs).To(BeNil())
+		}
+	})
+
+	It("checks the results against every invariant", func() {
+		Expect(searchAPI.StoreInvariants).To(ConsistOf(searchAPI.InvariantNilURLs, searchAPI.InvariantEmptyID, searchAPI.InvariantDuplicateID, searchAPI.InvariantUnrequestedID))
+		Expect(searchAPI.CheckIDs([]string{"A", "B"})).To(Succeed())
+		Expect(contractError(searchAPI.CheckIDs([]string{"A", "", "B"})).Index).To(Equal(1))
+		Expect(contractError(searchAPI.CheckIDs([]string{"A", "B", "A"})).ID).To(Equal("A"))
+		Expect(searchAPI.CheckMatches([]string{"A", "B", "A"})).To(Succeed())
+		Expect(contractError(searchAPI.CheckMatches([]string{"A", ""})).Invariant).To(Equal(searchAPI.InvariantEmptyID))
+		Expect(contractError(searchAPI.CheckCollections([]searchAPI.TattooImagesCollection{{ID: "A"}})).Invariant).To(Equal(searchAPI.InvariantNilURLs))
+		Expect(searchAPI.CheckVectors([]searchAPI.TattooImagesVector{{ID: "A"}, {ID: "B"}})).To(Succeed())
+		Expect(searchAPI.CheckRequested([]string{"A", "B"}, []searchAPI.TattooImagesCollection{{ID: "B"}})).To(Succeed())
+		Expect(contractError(searchAPI.CheckRequested([]string{"A"}, []searchAPI.TattooImagesCollection{{ID: "A"}, {ID: "Z"}})).ID).To(Equal("Z"))
+	})
+
+	Describe("an image store returning its whole table", func() {
+		var (
+			is    *inkinspottest.FakeImageStore
+			vs    *inkinspottest.FakeVectorStore
+			table []searchAPI.TattooImagesCollection
+		)
+
+		BeforeEach(func() {
+			is, vs = inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+			table = nil
+			for i := range 500 {
+				table = append(table, searchAPI.TattooImagesCollection{ID: fmt.Sprintf("row-%03d", i), URLs: []string{strings.Repeat("x", 1000)}})
+			}
+		})
+
+		// overReturning appends the table to every lookup.
+		overReturning := func(cols []searchAPI.TattooImagesCollection) []searchAPI.TattooImagesCollection {
+			return append(cols, table...)
+		}
+
+		initServer := func(cfg searchAPI.Configuration, opts ...searchAPI.SearchEngineOption) (*searchAPI.SearchEngine, *httptest.Server) {
+			GinkgoHelper()
+			engine := searchAPI.NewSearchEngine(cfg, misbehavingImageStore{is, overReturning}, vs, opts...)
+			se := httptest.NewServer(searchAPI.NewHandler(engine))
+			DeferCleanup(se.Close)
+			return engine, se
+		}
+
+		for _, validated := range []bool{true, false} {
+			var opts []searchAPI.SearchEngineOption
+			if !validated {
+				opts = append(opts, searchAPI.WithoutStoreValidation())
+			}
+
+			It(fmt.Sprintf("has its extra collections dropped, validated %t", validated), func() {
+				engine, se := initServer(searchAPI.Configuration{ResponseLimits: searchAPI.ResponseLimits{MaxBodyBytes: 64 << 10}}, opts...)
+
+				res := doQuery(se, "lion")
+				Expect(res.Status).To(Equal(http.StatusOK))
+				baseline, err := searchAPI.NewSearchEngine(searchAPI.Configuration{}, is, vs).MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal(collectionIDs(baseline.Collections())))
+				Expect(len(res.Body)).To(BeNumerically("<", 64<<10))
+				Expect(engine.UnrequestedCollections()).To(BeNumerically(">=", 500))
+
+				resp, err := se.Client().Get(se.URL + "/tattoos/X")
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			})
+
+			It(fmt.Sprintf("fails the lookups in strict mode, validated %t", validated), func() {
+				engine, se := initServer(searchAPI.Configuration{StoreContractPolicy: searchAPI.StoreContractPolicy{Strict: true}}, opts...)
+
+				_, err := engine.MultiSearch(context.Background(), []string{"lion"}, searchAPI.SearchOptions{})
+				ce := contractError(err)
+				Expect(ce.Store).To(Equal(searchAPI.ImageStoreName))
+				Expect(ce.Op).To(Equal("get"))
+				Expect(ce.Invariant).To(Equal(searchAPI.InvariantUnrequestedID))
+				Expect(ce.ID).To(Equal("row-000"))
+				var storeErr *searchAPI.StoreError
+				Expect(errors.As(err, &storeErr)).To(BeTrue(), "the engine counts it as a store failure")
+
+				res := doQuery(se, "lion")
+				Expect(res.Status).To(Equal(http.StatusInternalServerError))
+				Expect(res.JSON.Error.Code).To(Equal("image_store_error"))
+				Expect(engine.UnrequestedCollections()).To(BeZero())
+			})
+		}
+	})
+})
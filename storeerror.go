@@ -0,0 +1,93 @@
+package inkinspot
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// The stores of the StoreErrors.
+const (
+	VectorStoreName = "vector"
+	ImageStoreName  = "image"
+)
+
+// StoreError is the failure of a store call made by the search.
+// It wraps the error of the store, errors.Is & errors.As see through it.
+type StoreError struct {
+	// Store is VectorStoreName or ImageStoreName.
+	Store string
+	// Op is the store call, such as "query" or "get".
+	Op  string
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return e.Store + " store " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// code is the API error code of the store.
+func (e *StoreError) code() string {
+	return e.Store + "_store_error"
+}
+
+// StoreErrorCount is the number of failed calls of a store operation since the start.
+type StoreErrorCount struct {
+	Store string `json:"store"`
+	Op    string `json:"op"`
+	Count uint64 `json:"count"`
+}
+
+// storeErrorCounts counts the failed store calls by store & operation.
+type storeErrorCounts struct {
+	mu     sync.Mutex
+	counts map[[2]string]uint64
+}
+
+// storeError counts the failed call & wraps its error in a StoreError, nil stays nil.
+func (e *SearchEngine) storeError(store, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	c := &e.storeErrors
+	c.mu.Lock()
+	if c.counts == nil {
+		c.counts = make(map[[2]string]uint64)
+	}
+	c.counts[[2]string{store, op}]++
+	c.mu.Unlock()
+
+	return &StoreError{Store: store, Op: op, Err: err}
+}
+
+// StoreErrors reports the failed store calls, ordered by store & operation.
+func (e *SearchEngine) StoreErrors() []StoreErrorCount {
+	c := &e.storeErrors
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]StoreErrorCount, 0, len(c.counts))
+	for k, n := range c.counts {
+		counts = append(counts, StoreErrorCount{Store: k[0], Op: k[1], Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Store != counts[j].Store {
+			return counts[i].Store < counts[j].Store
+		}
+		return counts[i].Op < counts[j].Op
+	})
+
+	return counts
+}
+
+// handleStoreErrors reports the failed store calls.
+func handleStoreErrors(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.StoreErrors())
+	})
+}
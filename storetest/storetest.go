@@ -0,0 +1,780 @@
+// Package storetest checks that store implementations honour the contract the engine relies on.
+//
+// An adapter gets its conformance tests from a single test function:
+//
+//	func TestImageStoreContract(t *testing.T) {
+//		storetest.RunImageStoreTests(t, func() inkinspot.ImageStore { return NewStore() })
+//	}
+//
+// The factory must return an empty store on every call. The stores are seeded
+// through inkinspot.CollectionWriter & inkinspot.VectorWriter, which they must implement.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DanyPops/inkinspot"
+)
+
+// LargeBatch is the number of records of the large batch tests.
+const LargeBatch = 5000
+
+// cancelDeadline bounds how long a store may take to return once its context is canceled.
+const cancelDeadline = 5 * time.Second
+
+// RunImageStoreTests runs the image store contract against fresh stores of the factory.
+func RunImageStoreTests(t *testing.T, factory func() inkinspot.ImageStore) {
+	t.Helper()
+
+	t.Run("EmptyInput", func(t *testing.T) {
+		s := seedImages(t, factory(), 3)
+		for _, ids := range [][]string{nil, {}} {
+			got, err := s.GetTattoosByID(context.Background(), ids)
+			if err != nil {
+				t.Fatalf("GetTattoosByID(%v): %v", ids, err)
+			}
+			if len(got) != 0 {
+				t.Errorf("GetTattoosByID(%v) returned %d collections, want none", ids, len(got))
+			}
+		}
+	})
+
+	t.Run("UnknownIDs", func(t *testing.T) {
+		s := seedImages(t, factory(), 3)
+		got, err := s.GetTattoosByID(context.Background(), []string{"missing", imageID(1), "also-missing", "missing"})
+		var missing *inkinspot.MissingIDsError
+		if !errors.As(err, &missing) || !errors.Is(err, inkinspot.ErrCollectionNotFound) {
+			t.Fatalf("GetTattoosByID of unknown IDs returned %v, want a MissingIDsError", err)
+		}
+		assertIDs(t, collectionIDs(got), []string{imageID(1)})
+		assertIDs(t, missing.IDs, []string{"also-missing", "missing"})
+	})
+
+	t.Run("DuplicateIDs", func(t *testing.T) {
+		s := seedImages(t, factory(), 3)
+		got, err := s.GetTattoosByID(context.Background(), []string{imageID(0), imageID(2), imageID(0), imageID(2)})
+		if err != nil {
+			t.Fatalf("GetTattoosByID: %v", err)
+		}
+		assertIDs(t, collectionIDs(got), []string{imageID(0), imageID(2)})
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		s := factory()
+		want := inkinspot.TattooImagesCollection{ID: "rt", URLs: []string{"https://img/rt-1", "https://img/rt-2"}}
+		if err := imageWriter(t, s).AddCollection(context.Background(), want); err != nil {
+			t.Fatalf("AddCollection: %v", err)
+		}
+
+		got, err := s.GetTattoosByID(context.Background(), []string{"rt"})
+		if err != nil {
+			t.Fatalf("GetTattoosByID: %v", err)
+		}
+		if len(got) != 1 || got[0].ID != want.ID || fmt.Sprint(got[0].URLs) != fmt.Sprint(want.URLs) {
+			t.Errorf("GetTattoosByID returned %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("LargeBatch", func(t *testing.T) {
+		s := seedImages(t, factory(), LargeBatch)
+		got, err := s.GetTattoosByID(context.Background(), imageIDs(LargeBatch))
+		if err != nil {
+			t.Fatalf("GetTattoosByID: %v", err)
+		}
+		assertIDs(t, collectionIDs(got), imageIDs(LargeBatch))
+	})
+
+	// the results keep the invariants the engine validates, see inkinspot.StoreInvariants.
+	t.Run("Invariants", func(t *testing.T) {
+		s := seedImages(t, factory(), 3)
+		ids := append(imageIDs(3), imageID(0), imageID(1))
+		got, err := s.GetTattoosByID(context.Background(), ids)
+		if err != nil {
+			t.Fatalf("GetTattoosByID: %v", err)
+		}
+		if err := inkinspot.CheckCollections(got); err != nil {
+			t.Errorf("GetTattoosByID(%v) breaks the contract: %v", ids, err)
+		}
+		one, err := s.GetTattoosByID(context.Background(), ids[:1])
+		if err != nil {
+			t.Fatalf("GetTattoosByID: %v", err)
+		}
+		if err := inkinspot.CheckRequested(ids[:1], one); err != nil {
+			t.Errorf("GetTattoosByID(%v) breaks the contract: %v", ids[:1], err)
+		}
+		if sampler, ok := s.(inkinspot.TattooSampler); ok {
+			sample, err := sampler.SampleTattoos(context.Background(), 10, time.Now())
+			if err != nil {
+				t.Fatalf("SampleTattoos: %v", err)
+			}
+			if err := inkinspot.CheckCollections(sample); err != nil {
+				t.Errorf("SampleTattoos breaks the contract: %v", err)
+			}
+		}
+	})
+
+	t.Run("CanceledContext", func(t *testing.T) {
+		s := seedImages(t, factory(), 3)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.GetTattoosByID(ctx, imageIDs(3))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetTattoosByID on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("CanceledMidCall", func(t *testing.T) {
+		s := seedImages(t, factory(), LargeBatch)
+		assertCancelMidCall(t, func(ctx context.Context) (int, error) {
+			got, err := s.GetTattoosByID(ctx, imageIDs(LargeBatch))
+			return len(got), err
+		}, LargeBatch)
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		s := seedImages(t, factory(), 10)
+		w := imageWriter(t, s)
+		runConcurrently(t, 8, 50, func(worker, i int) error {
+			if i%5 == 0 {
+				c := inkinspot.TattooImagesCollection{ID: fmt.Sprintf("w%d-%d", worker, i), URLs: []string{"https://img/c"}}
+				return w.AddCollection(context.Background(), c)
+			}
+
+			got, err := s.GetTattoosByID(context.Background(), imageIDs(10))
+			if err == nil && len(got) != 10 {
+				err = fmt.Errorf("read %d of 10 collections", len(got))
+			}
+			return err
+		})
+	})
+
+	t.Run("CollectionIterable", func(t *testing.T) {
+		s := seedImages(t, factory(), 5)
+		iterable, ok := s.(inkinspot.CollectionIterable)
+		if !ok {
+			t.Skip("store does not implement inkinspot.CollectionIterable")
+		}
+
+		it, err := iterable.IterateCollections(context.Background())
+		if err != nil {
+			t.Fatalf("IterateCollections: %v", err)
+		}
+		got, err := inkinspot.CollectAll(context.Background(), it)
+		if err != nil {
+			t.Fatalf("CollectAll: %v", err)
+		}
+		ids := collectionIDs(got)
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("IterateCollections streamed %v, want them ordered by ID", ids)
+		}
+		assertIDs(t, ids, imageIDs(5))
+		if _, err := it.Next(context.Background()); !errors.Is(err, inkinspot.ErrIteratorClosed) {
+			t.Errorf("Next on a closed iterator returned %v, want ErrIteratorClosed", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		it, err = iterable.IterateCollections(context.Background())
+		if err != nil {
+			t.Fatalf("IterateCollections: %v", err)
+		}
+		defer it.Close()
+		if _, err := it.Next(ctx); err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		cancel()
+		if _, err := it.Next(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Next on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("CollectionSwapper", func(t *testing.T) {
+		s := seedImages(t, factory(), 1)
+		swapper, ok := s.(inkinspot.CollectionSwapper)
+		if !ok {
+			t.Skip("store does not implement inkinspot.CollectionSwapper")
+		}
+		id := imageID(0)
+		version := func() uint64 {
+			t.Helper()
+			got, err := s.GetTattoosByID(context.Background(), []string{id})
+			if err != nil || len(got) != 1 {
+				t.Fatalf("GetTattoosByID: %v", err)
+			}
+			return got[0].Version
+		}
+
+		v := version()
+		if v == 0 {
+			t.Fatalf("stored collection has no version")
+		}
+		if err := swapper.SwapCollection(context.Background(), inkinspot.TattooImagesCollection{ID: id}, v); err != nil {
+			t.Fatalf("SwapCollection at the stored version: %v", err)
+		}
+		if got := version(); got <= v {
+			t.Errorf("SwapCollection left the version at %d, want it past %d", got, v)
+		}
+		if err := swapper.SwapCollection(context.Background(), inkinspot.TattooImagesCollection{ID: id}, v); !errors.Is(err, inkinspot.ErrVersionConflict) {
+			t.Errorf("SwapCollection at a stale version returned %v, want ErrVersionConflict", err)
+		}
+		if err := swapper.DeleteCollectionAt(context.Background(), id, v); !errors.Is(err, inkinspot.ErrVersionConflict) {
+			t.Errorf("DeleteCollectionAt a stale version returned %v, want ErrVersionConflict", err)
+		}
+		if err := swapper.DeleteCollectionAt(context.Background(), id, version()); err != nil {
+			t.Fatalf("DeleteCollectionAt the stored version: %v", err)
+		}
+		if _, err := s.GetTattoosByID(context.Background(), []string{id}); !errors.Is(err, inkinspot.ErrCollectionNotFound) {
+			t.Errorf("GetTattoosByID of a deleted collection returned %v, want ErrCollectionNotFound", err)
+		}
+	})
+
+	t.Run("VersionWaiter", func(t *testing.T) {
+		s := seedImages(t, factory(), 5)
+		waiter, ok := s.(inkinspot.VersionWaiter)
+		if !ok {
+			t.Skip("store does not implement inkinspot.VersionWaiter")
+		}
+
+		waitForWrites(t, waiter)
+		got, err := s.GetTattoosByID(context.Background(), imageIDs(5))
+		if err != nil {
+			t.Fatalf("GetTattoosByID after WaitForVersion: %v", err)
+		}
+		assertIDs(t, collectionIDs(got), imageIDs(5))
+	})
+
+	t.Run("Pinger", func(t *testing.T) {
+		pinger, ok := factory().(inkinspot.Pinger)
+		if !ok {
+			t.Skip("store does not implement inkinspot.Pinger")
+		}
+
+		if err := pinger.Ping(context.Background()); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := pinger.Ping(canceled); !errors.Is(err, context.Canceled) {
+			t.Errorf("Ping on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("Counter", func(t *testing.T) {
+		s := seedImages(t, factory(), 5)
+		counter, ok := s.(inkinspot.Counter)
+		if !ok {
+			t.Skip("store does not implement inkinspot.Counter")
+		}
+
+		if n, err := counter.Count(context.Background()); err != nil || n != 5 {
+			t.Errorf("Count returned %d, %v, want 5", n, err)
+		}
+	})
+}
+
+// RunVectorStoreTests runs the vector store contract against fresh stores of the factory.
+// GetVectorsByID is covered when the store implements inkinspot.VectorLookup.
+func RunVectorStoreTests(t *testing.T, factory func() inkinspot.VectorStore) {
+	t.Helper()
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		got, err := s.GetIDsByQuery(context.Background(), "")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("GetIDsByQuery(%q) returned %v, want none", "", got)
+		}
+	})
+
+	t.Run("UnknownTerms", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		got, err := s.GetIDsByQuery(context.Background(), "xylophone")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("GetIDsByQuery(%q) returned %v, want none", "xylophone", got)
+		}
+	})
+
+	t.Run("Matches", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		got, err := s.GetIDsByQuery(context.Background(), "lion")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		assertIDs(t, got, vectorIDs(3))
+	})
+
+	// the results keep the invariants the engine validates, see inkinspot.StoreInvariants.
+	t.Run("Invariants", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		for _, query := range []string{"lion", "lion lion", "unknown"} {
+			got, err := s.GetIDsByQuery(context.Background(), query)
+			if err != nil {
+				t.Fatalf("GetIDsByQuery(%q): %v", query, err)
+			}
+			if err := inkinspot.CheckMatches(got); err != nil {
+				t.Errorf("GetIDsByQuery(%q) breaks the contract: %v", query, err)
+			}
+		}
+		if lookup, ok := s.(inkinspot.VectorLookup); ok {
+			ids := append(vectorIDs(3), vectorID(0))
+			got, err := lookup.GetVectorsByID(context.Background(), ids)
+			if err != nil {
+				t.Fatalf("GetVectorsByID: %v", err)
+			}
+			if err := inkinspot.CheckVectors(got); err != nil {
+				t.Errorf("GetVectorsByID(%v) breaks the contract: %v", ids, err)
+			}
+		}
+	})
+
+	t.Run("DuplicateWrites", func(t *testing.T) {
+		s := factory()
+		w := vectorWriter(t, s)
+		for range 3 {
+			if err := w.AddVector(context.Background(), lionVector("dup")); err != nil {
+				t.Fatalf("AddVector: %v", err)
+			}
+		}
+
+		got, err := s.GetIDsByQuery(context.Background(), "lion")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		assertIDs(t, got, []string{"dup"})
+	})
+
+	t.Run("LargeBatch", func(t *testing.T) {
+		s := seedVectors(t, factory(), LargeBatch)
+		got, err := s.GetIDsByQuery(context.Background(), "lion")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		assertIDs(t, got, vectorIDs(LargeBatch))
+	})
+
+	t.Run("CanceledContext", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.GetIDsByQuery(ctx, "lion")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GetIDsByQuery on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("CanceledMidCall", func(t *testing.T) {
+		s := seedVectors(t, factory(), LargeBatch)
+		assertCancelMidCall(t, func(ctx context.Context) (int, error) {
+			got, err := s.GetIDsByQuery(ctx, "lion")
+			return len(got), err
+		}, LargeBatch)
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		s := seedVectors(t, factory(), 10)
+		w := vectorWriter(t, s)
+		runConcurrently(t, 8, 50, func(worker, i int) error {
+			if i%5 == 0 {
+				return w.AddVector(context.Background(), lionVector(fmt.Sprintf("w%d-%d", worker, i)))
+			}
+
+			got, err := s.GetIDsByQuery(context.Background(), "lion")
+			if err == nil && len(got) < 10 {
+				err = fmt.Errorf("matched %d of at least 10 vectors", len(got))
+			}
+			return err
+		})
+	})
+
+	t.Run("VectorLookup", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		lookup, ok := s.(inkinspot.VectorLookup)
+		if !ok {
+			t.Skip("store does not implement inkinspot.VectorLookup")
+		}
+
+		for _, ids := range [][]string{nil, {}} {
+			got, err := lookup.GetVectorsByID(context.Background(), ids)
+			if err != nil {
+				t.Fatalf("GetVectorsByID(%v): %v", ids, err)
+			}
+			if len(got) != 0 {
+				t.Errorf("GetVectorsByID(%v) returned %d vectors, want none", ids, len(got))
+			}
+		}
+
+		got, err := lookup.GetVectorsByID(context.Background(), []string{vectorID(0), "missing", vectorID(0), vectorID(2)})
+		if err != nil {
+			t.Fatalf("GetVectorsByID: %v", err)
+		}
+		ids := make([]string, 0, len(got))
+		for _, v := range got {
+			ids = append(ids, v.ID)
+			if v.Subject["lion"] != 0.9 {
+				t.Errorf("GetVectorsByID(%s) returned subject %v, want lion 0.9", v.ID, v.Subject)
+			}
+		}
+		assertIDs(t, ids, []string{vectorID(0), vectorID(2)})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := lookup.GetVectorsByID(ctx, vectorIDs(3)); !errors.Is(err, context.Canceled) {
+			t.Errorf("GetVectorsByID on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("VectorStorePager", func(t *testing.T) {
+		s := seedVectors(t, factory(), 5)
+		pager, ok := s.(inkinspot.VectorStorePager)
+		if !ok {
+			t.Skip("store does not implement inkinspot.VectorStorePager")
+		}
+
+		want, err := s.GetIDsByQuery(context.Background(), "lion")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery: %v", err)
+		}
+		var got []string
+		cursor := ""
+		for pages := 1; ; pages++ {
+			ids, next, err := pager.GetIDsByQueryPage(context.Background(), "lion", cursor, 2)
+			if err != nil {
+				t.Fatalf("GetIDsByQueryPage(%q): %v", cursor, err)
+			}
+			if len(ids) > 2 {
+				t.Errorf("GetIDsByQueryPage(%q) returned %d IDs, want at most 2", cursor, len(ids))
+			}
+			got = append(got, ids...)
+			if next == "" {
+				break
+			}
+			if pages > len(want) {
+				t.Fatalf("GetIDsByQueryPage kept returning cursors after %d pages", pages)
+			}
+			cursor = next
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("the pages listed %v, want the IDs of GetIDsByQuery %v", got, want)
+		}
+	})
+
+	t.Run("VectorLister", func(t *testing.T) {
+		s := seedVectors(t, factory(), 5)
+		lister, ok := s.(inkinspot.VectorLister)
+		if !ok {
+			t.Skip("store does not implement inkinspot.VectorLister")
+		}
+
+		var got []string
+		cursor := ""
+		for pages := 1; ; pages++ {
+			ids, next, err := lister.ListVectorIDs(context.Background(), cursor, 2)
+			if err != nil {
+				t.Fatalf("ListVectorIDs(%q): %v", cursor, err)
+			}
+			if len(ids) > 2 {
+				t.Errorf("ListVectorIDs(%q) returned %d IDs, want at most 2", cursor, len(ids))
+			}
+			got = append(got, ids...)
+			if next == "" {
+				break
+			}
+			if pages > 5 {
+				t.Fatalf("ListVectorIDs kept returning cursors after %d pages", pages)
+			}
+			cursor = next
+		}
+		if !sort.StringsAreSorted(got) {
+			t.Errorf("ListVectorIDs listed %v, want them ordered by ID", got)
+		}
+		assertIDs(t, got, vectorIDs(5))
+	})
+
+	t.Run("VersionWaiter", func(t *testing.T) {
+		s := seedVectors(t, factory(), 5)
+		waiter, ok := s.(inkinspot.VersionWaiter)
+		if !ok {
+			t.Skip("store does not implement inkinspot.VersionWaiter")
+		}
+
+		waitForWrites(t, waiter)
+		got, err := s.GetIDsByQuery(context.Background(), "lion")
+		if err != nil {
+			t.Fatalf("GetIDsByQuery after WaitForVersion: %v", err)
+		}
+		assertIDs(t, got, vectorIDs(5))
+	})
+
+	t.Run("Pinger", func(t *testing.T) {
+		pinger, ok := factory().(inkinspot.Pinger)
+		if !ok {
+			t.Skip("store does not implement inkinspot.Pinger")
+		}
+
+		if err := pinger.Ping(context.Background()); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := pinger.Ping(canceled); !errors.Is(err, context.Canceled) {
+			t.Errorf("Ping on a canceled context returned %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("Counter", func(t *testing.T) {
+		s := seedVectors(t, factory(), 5)
+		counter, ok := s.(inkinspot.Counter)
+		if !ok {
+			t.Skip("store does not implement inkinspot.Counter")
+		}
+
+		if n, err := counter.Count(context.Background()); err != nil || n != 5 {
+			t.Errorf("Count returned %d, %v, want 5", n, err)
+		}
+	})
+
+	t.Run("LabelHistogrammer", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		histogrammer, ok := s.(inkinspot.LabelHistogrammer)
+		if !ok {
+			t.Skip("store does not implement inkinspot.LabelHistogrammer")
+		}
+
+		want := map[string]map[string]int{
+			inkinspot.FacetStyle:   {"blackwork": 3},
+			inkinspot.FacetSubject: {"lion": 3},
+			inkinspot.FacetArea:    {"arm": 3},
+		}
+		for facet, labels := range want {
+			got, err := histogrammer.LabelHistogram(context.Background(), facet)
+			if err != nil {
+				t.Fatalf("LabelHistogram(%q): %v", facet, err)
+			}
+			if !maps.Equal(got, labels) {
+				t.Errorf("LabelHistogram(%q) returned %v, want %v", facet, got, labels)
+			}
+		}
+		if _, err := histogrammer.LabelHistogram(context.Background(), "color"); !errors.Is(err, inkinspot.ErrUnknownFacet) {
+			t.Errorf("LabelHistogram of an unknown facet returned %v, want ErrUnknownFacet", err)
+		}
+	})
+
+	t.Run("LabelIndex", func(t *testing.T) {
+		s := seedVectors(t, factory(), 3)
+		index, ok := s.(inkinspot.LabelIndex)
+		if !ok {
+			t.Skip("store does not implement inkinspot.LabelIndex")
+		}
+
+		ids, err := index.GetIDsByLabels(context.Background(), inkinspot.FacetArea, []string{"arm", "chest"})
+		if err != nil {
+			t.Fatalf("GetIDsByLabels: %v", err)
+		}
+		assertIDs(t, ids, []string{vectorID(0), vectorID(1), vectorID(2)})
+		if err := inkinspot.CheckIDs(ids); err != nil {
+			t.Errorf("GetIDsByLabels broke the invariants: %v", err)
+		}
+		if ids, err := index.GetIDsByLabels(context.Background(), inkinspot.FacetStyle, []string{"arm"}); err != nil || len(ids) != 0 {
+			t.Errorf("GetIDsByLabels of the labels of another facet returned %v, %v, want none", ids, err)
+		}
+		if _, err := index.GetIDsByLabels(context.Background(), "color", []string{"red"}); !errors.Is(err, inkinspot.ErrUnknownFacet) {
+			t.Errorf("GetIDsByLabels of an unknown facet returned %v, want ErrUnknownFacet", err)
+		}
+	})
+}
+
+// waitForWrites waits for the store to reflect the writes done so far, a done context must stop the wait.
+func waitForWrites(t *testing.T, waiter inkinspot.VersionWaiter) {
+	t.Helper()
+
+	token := inkinspot.ConsistencyToken{Version: time.Now().UnixNano()}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := waiter.WaitForVersion(ctx, token); err != nil {
+		t.Fatalf("WaitForVersion of the seeded writes: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waiter.WaitForVersion(canceled, inkinspot.ConsistencyToken{Version: token.Version + int64(time.Hour)}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForVersion on a canceled context returned %v, want context.Canceled", err)
+	}
+}
+
+func imageID(i int) string  { return fmt.Sprintf("img-%05d", i) }
+func vectorID(i int) string { return fmt.Sprintf("vec-%05d", i) }
+
+func imageIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = imageID(i)
+	}
+	return ids
+}
+
+func vectorIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = vectorID(i)
+	}
+	return ids
+}
+
+func lionVector(id string) inkinspot.TattooImagesVector {
+	return inkinspot.TattooImagesVector{
+		ID:      id,
+		Style:   inkinspot.LabelSet{"blackwork": 0.5},
+		Subject: inkinspot.LabelSet{"lion": 0.9},
+		Area:    inkinspot.LabelSet{"arm": 0.3},
+	}
+}
+
+func imageWriter(t *testing.T, s inkinspot.ImageStore) inkinspot.CollectionWriter {
+	t.Helper()
+
+	w, ok := s.(inkinspot.CollectionWriter)
+	if !ok {
+		t.Fatalf("%T does not implement inkinspot.CollectionWriter, the contract can't seed it", s)
+	}
+	return w
+}
+
+func vectorWriter(t *testing.T, s inkinspot.VectorStore) inkinspot.VectorWriter {
+	t.Helper()
+
+	w, ok := s.(inkinspot.VectorWriter)
+	if !ok {
+		t.Fatalf("%T does not implement inkinspot.VectorWriter, the contract can't seed it", s)
+	}
+	return w
+}
+
+// seedImages adds n collections with the IDs of imageIDs.
+func seedImages(t *testing.T, s inkinspot.ImageStore, n int) inkinspot.ImageStore {
+	t.Helper()
+
+	w := imageWriter(t, s)
+	for i := range n {
+		c := inkinspot.TattooImagesCollection{ID: imageID(i), URLs: []string{fmt.Sprintf("https://img/%d", i)}}
+		if err := w.AddCollection(context.Background(), c); err != nil {
+			t.Fatalf("AddCollection(%s): %v", c.ID, err)
+		}
+	}
+	return s
+}
+
+// seedVectors adds n lion vectors with the IDs of vectorIDs.
+func seedVectors(t *testing.T, s inkinspot.VectorStore, n int) inkinspot.VectorStore {
+	t.Helper()
+
+	w := vectorWriter(t, s)
+	for i := range n {
+		if err := w.AddVector(context.Background(), lionVector(vectorID(i))); err != nil {
+			t.Fatalf("AddVector(%s): %v", vectorID(i), err)
+		}
+	}
+	return s
+}
+
+func collectionIDs(cs []inkinspot.TattooImagesCollection) []string {
+	ids := make([]string, 0, len(cs))
+	for _, c := range cs {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+// assertIDs compares the IDs as sets, reporting repeated IDs.
+func assertIDs(t *testing.T, got, want []string) {
+	t.Helper()
+
+	seen := make(map[string]bool, len(got))
+	for _, id := range got {
+		if seen[id] {
+			t.Errorf("ID %s returned more than once", id)
+		}
+		seen[id] = true
+	}
+
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		if len(got) > 10 || len(want) > 10 {
+			t.Errorf("returned %d IDs, want %d", len(got), len(want))
+			return
+		}
+		t.Errorf("returned IDs %v, want %v", got, want)
+	}
+}
+
+// assertCancelMidCall cancels the context while call runs.
+// The call must return promptly, with either the complete result or context.Canceled.
+func assertCancelMidCall(t *testing.T, call func(ctx context.Context) (int, error), want int) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type outcome struct {
+		n   int
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		n, err := call(ctx)
+		done <- outcome{n, err}
+	}()
+	cancel()
+
+	select {
+	case o := <-done:
+		switch {
+		case o.err == nil && o.n != want:
+			t.Errorf("returned %d results after the cancel without an error, want %d or context.Canceled", o.n, want)
+		case o.err != nil && !errors.Is(o.err, context.Canceled):
+			t.Errorf("returned %v after the cancel, want context.Canceled", o.err)
+		}
+	case <-time.After(cancelDeadline):
+		t.Errorf("didn't return within %s of the cancel", cancelDeadline)
+	}
+}
+
+// runConcurrently runs op from the workers at once, failing on the first error.
+func runConcurrently(t *testing.T, workers, ops int, op func(worker, i int) error) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ops {
+				if err := op(w, i); err != nil {
+					errs <- fmt.Errorf("worker %d, op %d: %w", w, i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
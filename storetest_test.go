@@ -0,0 +1,25 @@
+package inkinspot_test
+
+import (
+	"testing"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+	"github.com/DanyPops/inkinspot/storetest"
+)
+
+func TestMemoryImageStoreContract(t *testing.T) {
+	storetest.RunImageStoreTests(t, func() searchAPI.ImageStore { return searchAPI.NewMemoryImageStore() })
+}
+
+func TestMemoryVectorStoreContract(t *testing.T) {
+	storetest.RunVectorStoreTests(t, func() searchAPI.VectorStore { return searchAPI.NewMemoryVectorStore() })
+}
+
+func TestFakeImageStoreContract(t *testing.T) {
+	storetest.RunImageStoreTests(t, func() searchAPI.ImageStore { return inkinspottest.NewFakeImageStore() })
+}
+
+func TestFakeVectorStoreContract(t *testing.T) {
+	storetest.RunVectorStoreTests(t, func() searchAPI.VectorStore { return inkinspottest.NewFakeVectorStore() })
+}
@@ -0,0 +1,154 @@
+// Package timeoutx derives contexts whose deadlines never outlive their parent's.
+// The deadlines may be spread by a jitter & floored by a minimum, on the real clock or another.
+package timeoutx
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrBelowMinimum is the cause of the contexts which would have had less than their minimum left.
+var ErrBelowMinimum = errors.New("timeout below the minimum")
+
+// Clock tells the time & runs the timers of the deadlines.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// Timer is a single event of a Clock, as time.Timer is of the real clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// RealClock is the Clock of the time package.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// Option configures a timeout.
+type Option func(*options)
+
+type options struct {
+	clock   Clock
+	minimum time.Duration
+	jitter  float64
+}
+
+// WithClock sets the clock of the deadline, the real one by default.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithMinimum never derives a context with less than d left.
+// The context is returned already expired instead, its cause is ErrBelowMinimum.
+func WithMinimum(d time.Duration) Option {
+	return func(o *options) {
+		o.minimum = d
+	}
+}
+
+// WithJitter shortens the duration by a random fraction of it, up to the fraction.
+// It spreads the expiry of the contexts derived at once, the minimum still holds.
+func WithJitter(fraction float64) Option {
+	return func(o *options) {
+		o.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithTightTimeout returns a child context that expires at the earlier of (now + d) and the parent's deadline.
+// A parent expiring no later than the child is only wrapped to be cancelled, a duration of zero or less expires at once.
+func WithTightTimeout(parent context.Context, duration time.Duration, opts ...Option) (context.Context, context.CancelFunc) {
+	o := options{clock: RealClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	now := o.clock.Now()
+	if o.jitter > 0 && duration > o.minimum {
+		duration -= time.Duration(rand.Float64() * o.jitter * float64(duration-o.minimum))
+	}
+	deadline := now.Add(duration)
+	parentDeadline, bounded := parent.Deadline()
+	if bounded && !deadline.Before(parentDeadline) {
+		deadline = parentDeadline
+	}
+
+	switch left := deadline.Sub(now); {
+	case o.minimum > 0 && left < o.minimum:
+		return expired(parent, deadline, ErrBelowMinimum)
+	case left <= 0:
+		return expired(parent, deadline, context.DeadlineExceeded)
+	case bounded && deadline.Equal(parentDeadline):
+		// the parent may expire by a clock, its children report it.
+		inner, cancel := context.WithCancelCause(parent)
+		return &deadlineCtx{Context: inner, deadline: deadline}, func() { cancel(context.Canceled) }
+	}
+
+	if _, ok := o.clock.(RealClock); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+
+	return withClockDeadline(o.clock, parent, deadline, deadline.Sub(now))
+}
+
+// deadlineCtx is a context which expires by the timer of a clock.
+// It's cancelled with the cause of its expiry, which its Err reports as context.DeadlineExceeded.
+type deadlineCtx struct {
+	context.Context
+	deadline time.Time
+}
+
+// expired returns a child context expired at once, for the cause.
+func expired(parent context.Context, deadline time.Time, cause error) (context.Context, context.CancelFunc) {
+	inner, cancel := context.WithCancelCause(parent)
+	cancel(cause)
+
+	return &deadlineCtx{Context: inner, deadline: deadline}, func() {}
+}
+
+// withClockDeadline returns a child context which expires when the clock reaches the deadline, in duration.
+func withClockDeadline(c Clock, parent context.Context, deadline time.Time, duration time.Duration) (context.Context, context.CancelFunc) {
+	inner, cancel := context.WithCancelCause(parent)
+	ctx := &deadlineCtx{Context: inner, deadline: deadline}
+
+	timer := c.NewTimer(duration)
+	go func() {
+		select {
+		case <-timer.C():
+			cancel(context.DeadlineExceeded)
+		case <-inner.Done():
+			timer.Stop()
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Err() error {
+	err := c.Context.Err()
+	if cause := context.Cause(c.Context); err != nil && (errors.Is(cause, context.DeadlineExceeded) || errors.Is(cause, ErrBelowMinimum)) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
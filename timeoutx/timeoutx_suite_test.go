@@ -0,0 +1,13 @@
+package timeoutx_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTimeoutx(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Timeoutx Suite")
+}
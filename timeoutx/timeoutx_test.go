@@ -0,0 +1,163 @@
+package timeoutx_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/DanyPops/inkinspot/inkinspottest"
+	"github.com/DanyPops/inkinspot/timeoutx"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithTightTimeout", func() {
+	var (
+		clock *inkinspottest.FakeClock
+		now   time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock = inkinspottest.NewFakeClock(now)
+	})
+
+	// tight derives a context on the fake clock, cancelled at the end of the spec.
+	tight := func(parent context.Context, d time.Duration, opts ...timeoutx.Option) context.Context {
+		GinkgoHelper()
+		ctx, cancel := timeoutx.WithTightTimeout(parent, d, append(opts, timeoutx.WithClock(clock))...)
+		DeferCleanup(cancel)
+		return ctx
+	}
+
+	deadlineOf := func(ctx context.Context) time.Time {
+		GinkgoHelper()
+		deadline, ok := ctx.Deadline()
+		Expect(ok).To(BeTrue())
+		return deadline
+	}
+
+	It("expires after the duration without a parent deadline", func() {
+		ctx := tight(context.Background(), 100*time.Millisecond)
+		Expect(deadlineOf(ctx)).To(Equal(now.Add(100 * time.Millisecond)))
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+
+		clock.Advance(99 * time.Millisecond)
+		Consistently(ctx.Done()).WithTimeout(10 * time.Millisecond).ShouldNot(BeClosed())
+		clock.Advance(time.Millisecond)
+		Eventually(ctx.Done()).Should(BeClosed())
+		Expect(ctx.Err()).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("keeps the earlier deadline of the parent", func() {
+		parent := tight(context.Background(), 50*time.Millisecond)
+		ctx := tight(parent, 100*time.Millisecond)
+		Expect(deadlineOf(ctx)).To(Equal(now.Add(50 * time.Millisecond)))
+
+		clock.Advance(50 * time.Millisecond)
+		Eventually(ctx.Done()).Should(BeClosed())
+		Expect(ctx.Err()).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("reuses the parent deadline when both are equal", func() {
+		parent := tight(context.Background(), 100*time.Millisecond)
+		waiters := clock.Waiters()
+
+		ctx := tight(parent, 100*time.Millisecond)
+		Expect(deadlineOf(ctx)).To(Equal(deadlineOf(parent)))
+		Expect(clock.Waiters()).To(Equal(waiters), "the child needs no timer of its own")
+
+		clock.Advance(100 * time.Millisecond)
+		Eventually(ctx.Done()).Should(BeClosed())
+	})
+
+	It("sets its own deadline just before the parent's", func() {
+		parent := tight(context.Background(), 100*time.Millisecond)
+		ctx := tight(parent, 100*time.Millisecond-time.Nanosecond)
+		Expect(deadlineOf(ctx)).To(BeTemporally("<", deadlineOf(parent)))
+
+		clock.Advance(100*time.Millisecond - time.Nanosecond)
+		Eventually(ctx.Done()).Should(BeClosed())
+		Expect(parent.Err()).NotTo(HaveOccurred())
+	})
+
+	It("expires at once under a parent already past its deadline", func() {
+		parent, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
+		DeferCleanup(cancel)
+
+		ctx := tight(parent, 100*time.Millisecond)
+		Expect(ctx.Done()).To(BeClosed())
+		Expect(ctx.Err()).To(MatchError(context.DeadlineExceeded))
+	})
+
+	DescribeTable("expires at once without a duration",
+		func(d time.Duration) {
+			ctx := tight(context.Background(), d)
+			Expect(ctx.Done()).To(BeClosed())
+			Expect(ctx.Err()).To(MatchError(context.DeadlineExceeded))
+			Expect(context.Cause(ctx)).To(MatchError(context.DeadlineExceeded))
+		},
+		Entry("zero", time.Duration(0)),
+		Entry("negative", -time.Second),
+	)
+
+	It("is cancelled with its parent", func() {
+		parent, cancel := context.WithCancel(context.Background())
+		ctx := tight(parent, time.Second)
+		cancel()
+		Eventually(ctx.Done()).Should(BeClosed())
+		Expect(ctx.Err()).To(MatchError(context.Canceled))
+		Eventually(clock.Waiters).Should(BeZero(), "the timer is stopped")
+	})
+
+	Context("with a minimum", func() {
+		It("expires at once below the minimum", func() {
+			ctx := tight(context.Background(), 10*time.Millisecond, timeoutx.WithMinimum(20*time.Millisecond))
+			Expect(ctx.Done()).To(BeClosed())
+			Expect(ctx.Err()).To(MatchError(context.DeadlineExceeded))
+			Expect(context.Cause(ctx)).To(MatchError(timeoutx.ErrBelowMinimum))
+		})
+
+		It("counts the time the parent leaves", func() {
+			parent := tight(context.Background(), 15*time.Millisecond)
+			ctx := tight(parent, time.Second, timeoutx.WithMinimum(20*time.Millisecond))
+			Expect(context.Cause(ctx)).To(MatchError(timeoutx.ErrBelowMinimum))
+			Expect(parent.Err()).NotTo(HaveOccurred(), "the parent is left as is")
+		})
+
+		It("derives the contexts left with the minimum exactly", func() {
+			ctx := tight(context.Background(), 20*time.Millisecond, timeoutx.WithMinimum(20*time.Millisecond))
+			Expect(ctx.Err()).NotTo(HaveOccurred())
+			Expect(deadlineOf(ctx)).To(Equal(now.Add(20 * time.Millisecond)))
+		})
+	})
+
+	Context("with a jitter", func() {
+		It("spreads the deadlines below the duration", func() {
+			seen := map[time.Time]bool{}
+			for range 50 {
+				deadline := deadlineOf(tight(context.Background(), time.Second, timeoutx.WithJitter(0.2)))
+				Expect(deadline).To(BeTemporally(">=", now.Add(800*time.Millisecond)))
+				Expect(deadline).To(BeTemporally("<=", now.Add(time.Second)))
+				seen[deadline] = true
+			}
+			Expect(len(seen)).To(BeNumerically(">", 1))
+		})
+
+		It("keeps the minimum", func() {
+			for range 50 {
+				ctx := tight(context.Background(), 100*time.Millisecond, timeoutx.WithJitter(5), timeoutx.WithMinimum(60*time.Millisecond))
+				Expect(ctx.Err()).NotTo(HaveOccurred())
+				Expect(deadlineOf(ctx)).To(BeTemporally(">=", now.Add(60*time.Millisecond)))
+			}
+		})
+	})
+
+	It("uses the context package on the real clock", func() {
+		ctx, cancel := timeoutx.WithTightTimeout(context.Background(), time.Hour)
+		defer cancel()
+		Expect(deadlineOf(ctx)).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+		cancel()
+		Expect(ctx.Err()).To(MatchError(context.Canceled))
+	})
+})
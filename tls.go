@@ -0,0 +1,137 @@
+package inkinspot
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// TLSPolicy serves HTTPS when the certificate & key files are set.
+// With a client CA the client certificates are verified against it,
+// RequireClientCert turns away the clients without one (mutual TLS).
+type TLSPolicy struct {
+	CertFile          string
+	KeyFile           string
+	ClientCAFile      string
+	RequireClientCert bool
+}
+
+// Enabled reports whether the policy serves HTTPS.
+func (p TLSPolicy) Enabled() bool {
+	return p.CertFile != "" || p.KeyFile != ""
+}
+
+// Validate checks the policy sets the files it needs.
+func (p TLSPolicy) Validate() error {
+	if (p.CertFile == "") != (p.KeyFile == "") {
+		return fmt.Errorf("%w: the certificate & key files go together", ErrInvalidTLS)
+	}
+	if p.ClientCAFile != "" && !p.Enabled() {
+		return fmt.Errorf("%w: a client CA needs a certificate & key", ErrInvalidTLS)
+	}
+	if p.RequireClientCert && p.ClientCAFile == "" {
+		return fmt.Errorf("%w: requiring client certificates needs a client CA", ErrInvalidTLS)
+	}
+
+	return nil
+}
+
+// CertReloader serves the certificate of its files, Reload picks up rotated files.
+// The connections already established keep the certificate they started with.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertReloader loads the certificate & key files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the files again, the current certificate stays when they are invalid.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTLS, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// ConfigureTLS sets up the server to serve the policy's HTTPS, with ServeTLS(l, "", "").
+// It returns the reloader of the server certificate.
+func ConfigureTLS(srv *http.Server, p TLSPolicy) (*CertReloader, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	certs, err := NewCertReloader(p.CertFile, p.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if p.ClientCAFile != "" {
+		pem, err := os.ReadFile(p.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTLS, err)
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificate in %s", ErrInvalidTLS, p.ClientCAFile)
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if p.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	srv.TLSConfig = cfg
+
+	return certs, nil
+}
+
+type clientNameKey struct{}
+
+// ClientCommonName returns the common name of the verified client certificate of the request.
+func ClientCommonName(ctx context.Context) (string, bool) {
+	cn, ok := ctx.Value(clientNameKey{}).(string)
+	return cn, ok
+}
+
+// withClientName puts the common name of the verified client certificate in the request context.
+func withClientName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+			r = r.WithContext(context.WithValue(r.Context(), clientNameKey{}, cn))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,199 @@
+package inkinspot_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// testCert is a certificate & its key, the CAs sign the others.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issueCert creates a certificate of the common name signed by the CA, self-signed when nil.
+func issueCert(cn string, ca *testCert) testCert {
+	GinkgoHelper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return testCert{cert: cert, key: key, der: der}
+}
+
+// writePEM writes the certificate & key as <name>.crt & <name>.key in the directory.
+func (c testCert) writePEM(dir, name string) (string, string) {
+	GinkgoHelper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+
+	return certFile, keyFile
+}
+
+func (c testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		dir      string
+		ca       testCert
+		roots    *x509.CertPool
+		certFile string
+		keyFile  string
+		caFile   string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		ca = issueCert("inkinspot test CA", nil)
+		roots = x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		caFile, _ = ca.writePEM(dir, "ca")
+		certFile, keyFile = issueCert("server", &ca).writePEM(dir, "server")
+	})
+
+	// serveTLS serves a handler answering the client's common name over the policy's HTTPS.
+	serveTLS := func(p searchAPI.TLSPolicy) (string, *searchAPI.CertReloader) {
+		GinkgoHelper()
+		srv := searchAPI.NewServer(searchAPI.Configuration{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cn, _ := searchAPI.ClientCommonName(r.Context())
+			_, _ = io.WriteString(w, cn)
+		}))
+		certs, err := searchAPI.ConfigureTLS(srv, p)
+		Expect(err).NotTo(HaveOccurred())
+		srv.ErrorLog = log.New(io.Discard, "", 0)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() { _ = srv.ServeTLS(ln, "", "") }()
+		DeferCleanup(srv.Close)
+
+		return "https://" + ln.Addr().String(), certs
+	}
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	get := func(c *http.Client, url string) (string, error) {
+		resp, err := c.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	It("serves HTTPS with the certificate", func() {
+		url, _ := serveTLS(searchAPI.TLSPolicy{CertFile: certFile, KeyFile: keyFile})
+		Expect(get(client(), url)).To(BeEmpty())
+
+		_, err := get(&http.Client{}, url)
+		Expect(err).To(HaveOccurred(), "the client doesn't trust the test CA")
+	})
+
+	It("exposes the common name of a verified client certificate", func() {
+		url, _ := serveTLS(searchAPI.TLSPolicy{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, RequireClientCert: true})
+		alice := issueCert("alice", &ca)
+		Expect(get(client(alice.tlsCertificate()), url)).To(Equal("alice"))
+	})
+
+	It("turns away the clients without a certificate of the CA", func() {
+		url, _ := serveTLS(searchAPI.TLSPolicy{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, RequireClientCert: true})
+		_, err := get(client(), url)
+		Expect(err).To(HaveOccurred())
+
+		rogueCA := issueCert("rogue CA", nil)
+		mallory := issueCert("mallory", &rogueCA)
+		_, err = get(client(mallory.tlsCertificate()), url)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("serves the rotated certificate once reloaded, keeping the open connections", func() {
+		url, certs := serveTLS(searchAPI.TLSPolicy{CertFile: certFile, KeyFile: keyFile})
+		kept := client()
+		resp, err := kept.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("server"))
+		resp.Body.Close()
+
+		issueCert("rotated", &ca).writePEM(dir, "server")
+		Expect(certs.Reload()).To(Succeed())
+
+		resp, err = kept.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("server"), "the connection is reused")
+		resp.Body.Close()
+
+		resp, err = client().Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("rotated"))
+		resp.Body.Close()
+	})
+
+	It("keeps the certificate when the rotated files are invalid", func() {
+		url, certs := serveTLS(searchAPI.TLSPolicy{CertFile: certFile, KeyFile: keyFile})
+		Expect(os.WriteFile(certFile, []byte("not a certificate"), 0o600)).To(Succeed())
+		Expect(certs.Reload()).To(MatchError(searchAPI.ErrInvalidTLS))
+
+		Expect(get(client(), url)).To(BeEmpty())
+	})
+
+	DescribeTable("rejects incomplete policies",
+		func(p searchAPI.TLSPolicy) {
+			Expect(p.Validate()).To(MatchError(searchAPI.ErrInvalidTLS))
+		},
+		Entry("certificate without a key", searchAPI.TLSPolicy{CertFile: "server.crt"}),
+		Entry("client CA without a certificate", searchAPI.TLSPolicy{ClientCAFile: "ca.crt"}),
+		Entry("client certificates required without a CA", searchAPI.TLSPolicy{CertFile: "server.crt", KeyFile: "server.key", RequireClientCert: true}),
+	)
+})
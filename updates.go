@@ -0,0 +1,149 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// UpdatesSinceHeader carries the creation time of the newest match of an updates response.
+// It's the since of the next poll.
+const UpdatesSinceHeader = "X-Updates-Since"
+
+// updatesWriteMargin is kept off the write timeout of the server, for the response to make it.
+const updatesWriteMargin = time.Second
+
+// minUpdatesWait is the least a poll may wait, the server policy must leave it within the write timeout.
+const minUpdatesWait = time.Second
+
+// UpdatesPolicy controls the long polls of the new matches of a query.
+// Zero values are replaced by the defaults.
+type UpdatesPolicy struct {
+	// PollInterval is how often a waiting poll searches again.
+	PollInterval time.Duration
+	// MaxWait caps how long a poll waits, the write timeout of the server caps it as well.
+	MaxWait time.Duration
+}
+
+func (p UpdatesPolicy) withDefaults() UpdatesPolicy {
+	if p.PollInterval <= 0 {
+		p.PollInterval = 2 * time.Second
+	}
+	if p.MaxWait <= 0 {
+		p.MaxWait = 30 * time.Second
+	}
+
+	return p
+}
+
+// maxUpdatesWait returns how long a poll may wait, within the policy & the write timeout of the server.
+func (c Configuration) maxUpdatesWait() time.Duration {
+	return max(min(c.UpdatesPolicy.MaxWait, c.ServerPolicy.WriteTimeout-updatesWriteMargin), 0)
+}
+
+// newHits returns the hits whose vector was created after since.
+func newHits(hits []SearchHit, since time.Time) []SearchHit {
+	var out []SearchHit
+	for _, h := range hits {
+		if h.Vector.CreatedAt.After(since) {
+			out = append(out, h)
+		}
+	}
+
+	return out
+}
+
+// SearchUpdates returns the matches of the query created after since, among the top of the page policy.
+// It searches every poll interval until there are some or the wait is over, it returns none then.
+// The hits are new by the CreatedAt of their vector, the vector store needs to return the vectors.
+// The polls bypass the result cache.
+func (e *SearchEngine) SearchUpdates(ctx context.Context, query string, since time.Time, wait time.Duration) ([]SearchHit, error) {
+	// the polls search the stores, the cached page of the query wouldn't show its new matches.
+	timeouts := e.configuration.TimeoutPolicy
+	opts := SearchOptions{Limit: e.configuration.PagePolicy.MaxLimit, Timeouts: &timeouts}
+	search := func() ([]SearchHit, error) {
+		sCtx, sCancel := e.withTightTimeout(ctx, e.configuration.TimeoutPolicy.SearchTimeout)
+		defer sCancel()
+
+		res, err := e.MultiSearch(sCtx, []string{query}, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return newHits(res.Hits, since), nil
+	}
+
+	hits, err := search()
+	if err != nil || len(hits) > 0 {
+		return hits, err
+	}
+
+	deadline := e.clock.NewTimer(wait)
+	defer deadline.Stop()
+	poll := e.clock.NewTimer(e.configuration.UpdatesPolicy.PollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C():
+			return nil, nil
+		case <-poll.C():
+		}
+
+		if hits, err = search(); err != nil || len(hits) > 0 {
+			return hits, err
+		}
+		poll.Reset(e.configuration.UpdatesPolicy.PollInterval)
+	}
+}
+
+// handleSearchUpdates long polls the matches of the query created after since.
+// It answers them as soon as there are some, 204 No Content when the wait is over.
+func handleSearchUpdates(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		since, err := time.Parse(time.RFC3339, params.Get("since"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_since", "since must be an RFC 3339 time")
+			return
+		}
+		maxWait := se.configuration.maxUpdatesWait()
+		wait := maxWait
+		if raw := params.Get("wait"); raw != "" {
+			if wait, err = time.ParseDuration(raw); err != nil || wait < 0 {
+				writeError(w, http.StatusBadRequest, "invalid_wait", fmt.Sprintf("wait must be a duration up to %s", maxWait))
+				return
+			}
+			wait = min(wait, maxWait)
+		}
+
+		hits, err := se.SearchUpdates(r.Context(), params.Get("q"), since, wait)
+		switch {
+		case errors.Is(err, context.Canceled):
+			// the client left, nobody reads the answer.
+			return
+		case err != nil:
+			writeSearchError(w, err)
+			return
+		case len(hits) == 0:
+			w.Header().Set(UpdatesSinceHeader, since.Format(time.RFC3339Nano))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		newest := since
+		cols := make([]TattooImagesCollection, 0, len(hits))
+		for _, h := range hits {
+			cols = append(cols, h.Collection)
+			if h.Vector.CreatedAt.After(newest) {
+				newest = h.Vector.CreatedAt
+			}
+		}
+		w.Header().Set(UpdatesSinceHeader, newest.Format(time.RFC3339Nano))
+		writeJSON(w, http.StatusOK, Response{ImageCollections: cols, Total: len(cols), Artists: se.Artists(r.Context(), cols)})
+	})
+}
@@ -0,0 +1,158 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Search updates", func() {
+	var (
+		se    *httptest.Server
+		is    *searchAPI.MemoryImageStore
+		vs    *searchAPI.MemoryVectorStore
+		clock *inkinspottest.FakeClock
+		start time.Time
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		clock = inkinspottest.NewFakeClock(start)
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "OLD", URLs: []string{"old.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "OLD", Subject: searchAPI.LabelSet{"lion": 90}, CreatedAt: start.Add(-time.Hour)})).To(Succeed())
+
+		cfg := searchAPI.Configuration{
+			AdminPolicy:   searchAPI.AdminPolicy{Token: adminToken},
+			CachePolicy:   searchAPI.CachePolicy{TTL: time.Hour},
+			UpdatesPolicy: searchAPI.UpdatesPolicy{PollInterval: 2 * time.Second},
+		}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))))
+		DeferCleanup(se.Close)
+	})
+
+	// pollResult is the answer of a long poll.
+	type pollResult struct {
+		status int
+		since  string
+		body   searchAPI.Response
+		err    error
+	}
+
+	// poll long polls the updates of the query in the background.
+	poll := func(ctx context.Context, params url.Values) <-chan pollResult {
+		out := make(chan pollResult, 1)
+		go func() {
+			defer GinkgoRecover()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, se.URL+"/search/updates?"+params.Encode(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			resp, err := se.Client().Do(req)
+			if err != nil {
+				out <- pollResult{err: err}
+				return
+			}
+			defer resp.Body.Close()
+
+			res := pollResult{status: resp.StatusCode, since: resp.Header.Get(searchAPI.UpdatesSinceHeader)}
+			if resp.StatusCode != http.StatusNoContent {
+				Expect(json.NewDecoder(resp.Body).Decode(&res.body)).To(Succeed())
+			}
+			out <- res
+		}()
+		return out
+	}
+
+	params := func(wait string) url.Values {
+		return url.Values{"q": {"lion"}, "since": {start.Format(time.RFC3339)}, "wait": {wait}}
+	}
+
+	It("answers at once when there are new matches already", func() {
+		res := <-poll(context.Background(), url.Values{"q": {"lion"}, "since": {start.Add(-2 * time.Hour).Format(time.RFC3339)}})
+		Expect(res.status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.body.ImageCollections)).To(Equal([]string{"OLD"}))
+		Expect(res.since).To(Equal(start.Add(-time.Hour).Format(time.RFC3339Nano)))
+	})
+
+	It("unblocks with the matches ingested during the wait", func() {
+		answer := poll(context.Background(), params("30s"))
+		Eventually(clock.Waiters).Should(Equal(2), "the deadline & the poll timers")
+
+		created := start.Add(time.Second)
+		status, _ := doImport(se, nil, ndjson(searchAPI.ExportRecord{
+			Collection: searchAPI.TattooImagesCollection{ID: "NEW", URLs: []string{"new.jpg"}},
+			Vector:     &searchAPI.TattooImagesVector{ID: "NEW", Subject: searchAPI.LabelSet{"lion": 80}, CreatedAt: created},
+		}))
+		Expect(status).To(Equal(http.StatusOK))
+		Consistently(answer, 50*time.Millisecond).ShouldNot(Receive(), "the next poll is due in 2s")
+
+		clock.Advance(2 * time.Second)
+		var res pollResult
+		Eventually(answer).Should(Receive(&res))
+		Expect(res.status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.body.ImageCollections)).To(Equal([]string{"NEW"}))
+		Expect(res.since).To(Equal(created.Format(time.RFC3339Nano)))
+	})
+
+	It("finds the matches written to the stores by another replica during the wait", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		answer := poll(ctx, params("30s"))
+		Eventually(clock.Waiters).Should(Equal(2))
+
+		// the write skips this engine, the cached page of the query stays as it was.
+		created := start.Add(time.Second)
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "NEW", URLs: []string{"new.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{ID: "NEW", Subject: searchAPI.LabelSet{"lion": 80}, CreatedAt: created})).To(Succeed())
+
+		clock.Advance(2 * time.Second)
+		var res pollResult
+		Eventually(answer).Should(Receive(&res))
+		Expect(res.status).To(Equal(http.StatusOK))
+		Expect(collectionIDs(res.body.ImageCollections)).To(Equal([]string{"NEW"}))
+	})
+
+	It("answers 204 No Content once the wait is over", func() {
+		answer := poll(context.Background(), params("1500ms"))
+		Eventually(clock.Waiters).Should(Equal(2))
+		clock.Advance(time.Second)
+		Consistently(answer, 50*time.Millisecond).ShouldNot(Receive())
+
+		clock.Advance(500 * time.Millisecond)
+		var res pollResult
+		Eventually(answer).Should(Receive(&res))
+		Expect(res.status).To(Equal(http.StatusNoContent))
+		Expect(res.since).To(Equal(start.Format(time.RFC3339Nano)))
+	})
+
+	It("stops polling when the client leaves", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		answer := poll(ctx, params("30s"))
+		Eventually(clock.Waiters).Should(Equal(2))
+
+		cancel()
+		Eventually(answer).Should(Receive())
+		Eventually(clock.Waiters).Should(BeZero())
+	})
+
+	DescribeTable("rejects invalid polls",
+		func(p url.Values, code string) {
+			res := <-poll(context.Background(), p)
+			Expect(res.status).To(Equal(http.StatusBadRequest))
+			Expect(res.body.Error.Code).To(Equal(code))
+		},
+		Entry("missing since", url.Values{"q": {"lion"}}, "invalid_since"),
+		Entry("malformed since", url.Values{"q": {"lion"}, "since": {"yesterday"}}, "invalid_since"),
+		Entry("malformed wait", url.Values{"q": {"lion"}, "since": {"2026-01-01T00:00:00Z"}, "wait": {"forever"}}, "invalid_wait"),
+		Entry("empty query", url.Values{"since": {"2026-01-01T00:00:00Z"}, "wait": {"0s"}}, "empty_query"),
+	)
+})
@@ -0,0 +1,95 @@
+package inkinspot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AnalyzedLabel is a label of a vector reduced to the stems the queries are matched against.
+type AnalyzedLabel struct {
+	Facet     string   `json:"facet"`
+	Label     string   `json:"label"`
+	Stems     []string `json:"stems"`
+	Proximity float64  `json:"proximity"`
+}
+
+// VectorInspection is a stored vector & the labels the engine derives from it.
+type VectorInspection struct {
+	Vector TattooImagesVector `json:"vector"`
+	Labels []AnalyzedLabel    `json:"labels"`
+}
+
+// Vector returns the stored vector of the ID.
+// It returns ErrLookupUnsupported when the vector store can't look up & ErrVectorNotFound when it has none.
+func (e *SearchEngine) Vector(ctx context.Context, id string) (TattooImagesVector, error) {
+	lookup, ok := storeAs[VectorLookup](e.vectorStore)
+	if !ok {
+		return TattooImagesVector{}, ErrLookupUnsupported
+	}
+
+	vlCtx, vlCancel := e.withTightTimeout(ctx, e.vectorStoreTimeout(ctx))
+	defer vlCancel()
+
+	vectors, err := lookup.GetVectorsByID(vlCtx, []string{id})
+	if err != nil {
+		return TattooImagesVector{}, e.storeError(VectorStoreName, "lookup", err)
+	}
+	for _, v := range vectors {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+
+	return TattooImagesVector{}, fmt.Errorf("%w: %s", ErrVectorNotFound, id)
+}
+
+// InspectVector returns the stored vector of the ID with its labels as the ranker analyzes them.
+func (e *SearchEngine) InspectVector(ctx context.Context, id string) (VectorInspection, error) {
+	v, err := e.Vector(ctx, id)
+	if err != nil {
+		return VectorInspection{}, err
+	}
+
+	ranked := e.ranker.analyzeLabels(nil, v)
+	labels := make([]AnalyzedLabel, 0, len(ranked))
+	for _, l := range ranked {
+		labels = append(labels, AnalyzedLabel{Facet: l.facet, Label: l.label, Stems: l.stems, Proximity: l.proximity})
+	}
+
+	return VectorInspection{Vector: v, Labels: labels}, nil
+}
+
+// handleVector serves the vector of the ID in the path, with its analyzed labels when inspect is set.
+func handleVector(se *SearchEngine, inspect bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body any
+			v    TattooImagesVector
+			err  error
+		)
+		if inspect {
+			var in VectorInspection
+			in, err = se.InspectVector(r.Context(), r.PathValue("id"))
+			body, v = in, in.Vector
+		} else {
+			v, err = se.Vector(r.Context(), r.PathValue("id"))
+			body = v
+		}
+
+		switch {
+		case err == nil:
+			if etag := vectorETag(v); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+			writeJSON(w, http.StatusOK, body)
+		case errors.Is(err, ErrVectorNotFound):
+			writeError(w, http.StatusNotFound, "vector_not_found", err.Error())
+		case errors.Is(err, ErrLookupUnsupported):
+			writeError(w, http.StatusNotImplemented, "lookup_unsupported", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "vector_store_error", "vector store lookup failed")
+		}
+	})
+}
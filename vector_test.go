@@ -0,0 +1,90 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// getVector requests the path with the token & decodes the response into out.
+func getVector(se *httptest.Server, path, token string, out any) int {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodGet, se.URL+path, nil)
+	Expect(err).NotTo(HaveOccurred())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	Expect(json.NewDecoder(resp.Body).Decode(out)).To(Succeed())
+	return resp.StatusCode
+}
+
+var _ = Describe("Vector inspection", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		vs := searchAPI.NewMemoryVectorStore()
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "L", URLs: []string{"l.jpg"}})).To(Succeed())
+		Expect(vs.AddVector(context.Background(), searchAPI.TattooImagesVector{
+			ID:      "L",
+			Style:   searchAPI.LabelSet{"Old Schools": 0.9},
+			Subject: searchAPI.LabelSet{"Lions": 1},
+		})).To(Succeed())
+
+		cfg := searchAPI.Configuration{AdminPolicy: searchAPI.AdminPolicy{Token: adminToken}}
+		se = httptest.NewServer(searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, vs)))
+		DeferCleanup(se.Close)
+	})
+
+	It("serves the stored vector of the ID", func() {
+		var v searchAPI.TattooImagesVector
+		Expect(getVector(se, "/tattoos/L/vector", "", &v)).To(Equal(http.StatusOK))
+		Expect(v.ID).To(Equal("L"))
+		Expect(v.Style).To(Equal(searchAPI.LabelSet{"Old Schools": 0.9}))
+	})
+
+	It("adds the analyzed labels on the admin endpoint", func() {
+		analyzer := searchAPI.DefaultConfiguration().LabelAnalyzer()
+
+		var in searchAPI.VectorInspection
+		Expect(getVector(se, "/admin/tattoos/L/vector", adminToken, &in)).To(Equal(http.StatusOK))
+		Expect(in.Vector.ID).To(Equal("L"))
+		Expect(in.Labels).To(Equal([]searchAPI.AnalyzedLabel{
+			{Facet: searchAPI.FacetStyle, Label: "Old Schools", Stems: analyzer.Analyze("Old Schools"), Proximity: 0.9},
+			{Facet: searchAPI.FacetSubject, Label: "Lions", Stems: analyzer.Analyze("Lions"), Proximity: 1},
+		}))
+		Expect(in.Labels[1].Stems).To(Equal([]string{"lion"}))
+
+		var res HTTPResult
+		Expect(getVector(se, "/admin/tattoos/L/vector", "wrong", &res.JSON)).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("answers 404 Not Found for an unknown ID", func() {
+		for _, path := range []string{"/tattoos/nope/vector", "/admin/tattoos/nope/vector"} {
+			var res HTTPResult
+			Expect(getVector(se, path, adminToken, &res.JSON)).To(Equal(http.StatusNotFound))
+			Expect(res.JSON.Error.Code).To(Equal("vector_not_found"))
+		}
+	})
+
+	It("answers 501 Not Implemented when the vector store can't look up", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		se := initSearchEngineHttpServer(is, inkinspottest.NewFaultyStore(vs))
+		DeferCleanup(se.Close)
+
+		var res HTTPResult
+		Expect(getVector(se, "/tattoos/X/vector", "", &res.JSON)).To(Equal(http.StatusNotImplemented))
+		Expect(res.JSON.Error.Code).To(Equal("lookup_unsupported"))
+	})
+})
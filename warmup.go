@@ -0,0 +1,86 @@
+package inkinspot
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CacheWarmup lists the popular queries searched at startup to fill the result cache.
+// Zero values are replaced by the defaults.
+type CacheWarmup struct {
+	Queries []string
+	// Concurrency is the number of queries searched at once.
+	Concurrency int
+	// Timeout bounds the whole warmup, the queries left are skipped.
+	Timeout time.Duration
+}
+
+func (w CacheWarmup) withDefaults() CacheWarmup {
+	if w.Concurrency <= 0 {
+		w.Concurrency = 4
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = 30 * time.Second
+	}
+
+	return w
+}
+
+// WarmCache searches the warmup queries to fill the result cache, once the stores are loaded.
+// It runs apart from the requests' contexts, so start it in its own goroutine not to delay serving.
+// The outcome of every query is logged, it returns the number of queries cached.
+func (e *SearchEngine) WarmCache(ctx context.Context) int {
+	w := e.configuration.CacheWarmup
+	if len(w.Queries) == 0 {
+		return 0
+	}
+	if e.cache == nil {
+		slog.WarnContext(ctx, "cache warmup skipped, the cache is disabled", "queries", len(w.Queries))
+		return 0
+	}
+
+	ctx, cancel := e.withTightTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		warmed int
+		wg     sync.WaitGroup
+	)
+	queries := make(chan string)
+	for range min(w.Concurrency, len(w.Queries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queries {
+				start := e.clock.Now()
+				res, err := e.MultiSearch(ctx, []string{q}, SearchOptions{})
+				if err != nil {
+					slog.WarnContext(ctx, "cache warmup query failed", e.queryLabels.attr("query", q), "error", err)
+					continue
+				}
+				slog.InfoContext(ctx, "cache warmup query", e.queryLabels.attr("query", q), "hits", len(res.Hits), "took_ms", milliseconds(e.clock.Now().Sub(start)))
+
+				mu.Lock()
+				warmed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, q := range w.Queries {
+		select {
+		case queries <- q:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(queries)
+	wg.Wait()
+
+	slog.InfoContext(ctx, "cache warmup done", "warmed", warmed, "queries", len(w.Queries))
+	return warmed
+}
@@ -0,0 +1,63 @@
+package inkinspot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache warmup", func() {
+	cachePolicy := searchAPI.CachePolicy{TTL: time.Minute}
+
+	It("fills the cache with the popular queries, the requests hit it", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		counting := inkinspottest.NewFaultyStore(is)
+		cfg := searchAPI.Configuration{
+			CachePolicy: cachePolicy,
+			CacheWarmup: searchAPI.CacheWarmup{Queries: []string{"lion", "tiger", "the"}, Concurrency: 2},
+		}
+		eng := searchAPI.NewSearchEngine(cfg, counting, vs)
+
+		Expect(eng.WarmCache(context.Background())).To(Equal(2), "a stopwords only query fails")
+		Expect(counting.Calls()).To(Equal(2))
+
+		se := httptest.NewServer(searchAPI.NewHandler(eng))
+		DeferCleanup(se.Close)
+		for _, q := range []string{"lion", "tiger"} {
+			res := doSearch(se, url.Values{"q": {q}, "debug_meta": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.Meta.CacheHit).To(BeTrue())
+		}
+		Expect(counting.Calls()).To(Equal(2))
+	})
+
+	It("gives up on the queries left once timed out", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		slow := inkinspottest.NewLatencyStore(is, time.Hour)
+		cfg := searchAPI.Configuration{
+			CachePolicy: cachePolicy,
+			CacheWarmup: searchAPI.CacheWarmup{Queries: []string{"lion", "tiger"}, Concurrency: 1, Timeout: 20 * time.Millisecond},
+		}
+
+		start := time.Now()
+		Expect(searchAPI.NewSearchEngine(cfg, slow, vs).WarmCache(context.Background())).To(BeZero())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("skips the warmup without a cache", func() {
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		counting := inkinspottest.NewFaultyStore(is)
+		cfg := searchAPI.Configuration{CacheWarmup: searchAPI.CacheWarmup{Queries: []string{"lion"}}}
+
+		Expect(searchAPI.NewSearchEngine(cfg, counting, vs).WarmCache(context.Background())).To(BeZero())
+		Expect(counting.Calls()).To(BeZero())
+	})
+})
@@ -0,0 +1,491 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the partner webhooks, see SignWebhook.
+const (
+	WebhookPartnerHeader   = "X-Webhook-Partner"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Fields of our records the payloads of the partners are mapped to, see WebhookMapping.
+const (
+	WebhookFieldID        = "id"
+	WebhookFieldURLs      = "urls"
+	WebhookFieldArtistID  = "artist_id"
+	WebhookFieldExpiresAt = "expires_at"
+	WebhookFieldStyle     = "style"
+	WebhookFieldSubject   = "subject"
+	WebhookFieldArea      = "area"
+	WebhookFieldCreatedAt = "created_at"
+)
+
+// webhookFields are the fields a mapping may set, the vector fields last.
+var webhookFields = []string{
+	WebhookFieldID, WebhookFieldURLs, WebhookFieldArtistID, WebhookFieldExpiresAt,
+	WebhookFieldStyle, WebhookFieldSubject, WebhookFieldArea, WebhookFieldCreatedAt,
+}
+
+// WebhookPolicy lets the partner studios push their tattoos to the engine, signed with their secrets.
+// Zero values are replaced by the defaults.
+type WebhookPolicy struct {
+	// Partners are the partners allowed to push, by the name of their partner header.
+	Partners map[string]WebhookPartner
+	// ReplayWindow is how far the timestamp of a delivery may be from now, the deliveries out of it are refused.
+	// A delivery is accepted once within it.
+	ReplayWindow time.Duration
+	// MaxBodyBytes caps the size of a delivery.
+	MaxBodyBytes int64
+}
+
+func (p WebhookPolicy) withDefaults() WebhookPolicy {
+	if p.ReplayWindow <= 0 {
+		p.ReplayWindow = 5 * time.Minute
+	}
+	if p.MaxBodyBytes <= 0 {
+		p.MaxBodyBytes = 10 << 20
+	}
+
+	return p
+}
+
+// Validate checks every partner has a secret & a mapping of the IDs & URLs to known fields.
+func (p WebhookPolicy) Validate() error {
+	for name, partner := range p.Partners {
+		if name == "" || partner.Secret == "" {
+			return fmt.Errorf("%w: partner %q without a name or a secret", ErrInvalidWebhook, name)
+		}
+		if partner.Mode != "" && partner.Mode != ImportSkip && partner.Mode != ImportOverwrite {
+			return fmt.Errorf("%w: partner %q with an unknown mode %q", ErrInvalidWebhook, name, partner.Mode)
+		}
+		for field := range partner.Mapping.Fields {
+			if !slices.Contains(webhookFields, field) {
+				return fmt.Errorf("%w: partner %q maps the unknown field %q", ErrInvalidWebhook, name, field)
+			}
+		}
+		for _, field := range []string{WebhookFieldID, WebhookFieldURLs} {
+			if partner.Mapping.Fields[field] == "" {
+				return fmt.Errorf("%w: partner %q doesn't map the %s", ErrInvalidWebhook, name, field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WebhookPartner is a partner pushing its tattoos.
+type WebhookPartner struct {
+	// Secret signs the deliveries of the partner.
+	Secret string
+	// Mapping translates the payloads of the partner into our records.
+	Mapping WebhookMapping
+	// Mode is the import mode of the deliveries, ImportOverwrite when empty as a CMS pushes its edits too.
+	Mode string
+}
+
+// WebhookMapping translates the payload of a partner into our collections & vectors.
+// The paths are the keys of the nested objects separated by dots, a key ending in [] maps over its array,
+// as "images[].src" for the sources of the images.
+type WebhookMapping struct {
+	// Items is the path of the array of tattoos in the payload, the payload is the array when empty.
+	Items string
+	// Fields are the paths of the partner's fields in a tattoo, by the field of our records, see WebhookFieldID.
+	// The IDs & URLs must be mapped, the vector is only written when one of its fields is.
+	Fields map[string]string
+}
+
+// UnmappedField is a field of our records the payload of a partner couldn't be mapped to.
+type UnmappedField struct {
+	// Item is the position of the tattoo in the payload from 1, 0 for the payload itself.
+	Item   int    `json:"item,omitempty"`
+	Field  string `json:"field"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// MappingError lists the first unmapped fields of a payload & matches ErrUnmappedFields.
+type MappingError struct {
+	Fields []UnmappedField
+}
+
+func (e *MappingError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = fmt.Sprintf("%s (%s %s)", f.Field, f.Path, f.Reason)
+		if f.Item > 0 {
+			fields[i] = fmt.Sprintf("item %d %s", f.Item, fields[i])
+		}
+	}
+
+	return fmt.Sprintf("%s: %s", ErrUnmappedFields, strings.Join(fields, ", "))
+}
+
+func (e *MappingError) Unwrap() error {
+	return ErrUnmappedFields
+}
+
+// SignWebhook returns the signature header of a delivery: the hex HMAC-SHA256 of the timestamp in Unix seconds,
+// a dot & the body, keyed by the secret of the partner.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	return "sha256=" + hex.EncodeToString(webhookMAC(secret, strconv.FormatInt(timestamp.Unix(), 10), body))
+}
+
+func webhookMAC(secret, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+
+	return m.Sum(nil)
+}
+
+// webhookDeliveries remembers the signatures of the deliveries accepted within the replay window.
+type webhookDeliveries struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// accept records the delivery, it returns false when it was already accepted.
+// The deliveries whose timestamp left the window are forgotten, they're refused as stale anyway.
+func (d *webhookDeliveries) accept(signature string, timestamp, now time.Time, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for s, t := range d.seen {
+		if now.Sub(t) > window {
+			delete(d.seen, s)
+		}
+	}
+	if _, ok := d.seen[signature]; ok {
+		return false
+	}
+	d.seen[signature] = timestamp
+
+	return true
+}
+
+// forget lets the delivery be accepted again, once it couldn't be ingested for a while.
+func (d *webhookDeliveries) forget(signature string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, signature)
+}
+
+// verifyWebhook checks the delivery is signed by a known partner, within the replay window & not replayed.
+// It returns the partner & its name, or an error matching ErrInvalidSignature or ErrWebhookReplayed.
+func (e *SearchEngine) verifyWebhook(h http.Header, body []byte) (string, WebhookPartner, error) {
+	p := e.configuration.WebhookPolicy
+	name := h.Get(WebhookPartnerHeader)
+	partner, ok := p.Partners[name]
+	if !ok || name == "" {
+		return "", WebhookPartner{}, fmt.Errorf("%w: unknown partner %q", ErrInvalidSignature, name)
+	}
+	raw := h.Get(WebhookTimestampHeader)
+	unix, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return "", WebhookPartner{}, fmt.Errorf("%w: timestamp %q isn't in Unix seconds", ErrInvalidSignature, raw)
+	}
+	signature, ok := strings.CutPrefix(h.Get(WebhookSignatureHeader), "sha256=")
+	mac, err := hex.DecodeString(signature)
+	if !ok || err != nil || !hmac.Equal(mac, webhookMAC(partner.Secret, raw, body)) {
+		return "", WebhookPartner{}, fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+
+	now, timestamp := e.clock.Now(), time.Unix(unix, 0)
+	if age := now.Sub(timestamp); age > p.ReplayWindow || age < -p.ReplayWindow {
+		return "", WebhookPartner{}, fmt.Errorf("%w: timestamp %s is out of the %s window", ErrWebhookReplayed, timestamp.UTC().Format(time.RFC3339), p.ReplayWindow)
+	}
+	if !e.webhooks.accept(hex.EncodeToString(mac), timestamp, now, p.ReplayWindow) {
+		return "", WebhookPartner{}, fmt.Errorf("%w: delivery already accepted", ErrWebhookReplayed)
+	}
+
+	return name, partner, nil
+}
+
+// mapWebhook translates the payload into the records of an import, in the order of its tattoos.
+// It fails with a MappingError listing the first unmapped fields.
+func (e *SearchEngine) mapWebhook(m WebhookMapping, payload []byte) ([]ExportRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+	}
+
+	items, ok := doc.([]any)
+	if m.Items != "" {
+		v, _ := lookupPath(doc, m.Items)
+		items, ok = v.([]any)
+	}
+	if !ok {
+		return nil, &MappingError{Fields: []UnmappedField{{Field: "items", Path: m.Items, Reason: "isn't an array"}}}
+	}
+
+	var (
+		records  = make([]ExportRecord, 0, len(items))
+		unmapped []UnmappedField
+		vector   = m.Fields[WebhookFieldStyle] != "" || m.Fields[WebhookFieldSubject] != "" || m.Fields[WebhookFieldArea] != "" || m.Fields[WebhookFieldCreatedAt] != ""
+	)
+	for i, item := range items {
+		rec := ExportRecord{}
+		v := TattooImagesVector{CreatedAt: e.clock.Now()}
+		for _, field := range webhookFields {
+			path := m.Fields[field]
+			if path == "" {
+				continue
+			}
+			if err := mapField(&rec.Collection, &v, field, item, path); err != nil && len(unmapped) < maxImportFailures {
+				unmapped = append(unmapped, UnmappedField{Item: i + 1, Field: field, Path: path, Reason: err.Error()})
+			}
+		}
+		if vector {
+			v.ID = rec.Collection.ID
+			rec.Vector = &v
+		}
+		records = append(records, rec)
+	}
+	if len(unmapped) > 0 {
+		return nil, &MappingError{Fields: unmapped}
+	}
+
+	return records, nil
+}
+
+// mapField sets the field of the record from the value at the path of the item.
+// Only the IDs & URLs must be present, the other fields are left empty without a value.
+func mapField(c *TattooImagesCollection, v *TattooImagesVector, field string, item any, path string) error {
+	value, ok := lookupPath(item, path)
+	if !ok {
+		if field == WebhookFieldID || field == WebhookFieldURLs {
+			return errors.New("is missing")
+		}
+		return nil
+	}
+
+	var err error
+	switch field {
+	case WebhookFieldID:
+		c.ID, err = mapString(value)
+	case WebhookFieldArtistID:
+		c.ArtistID, err = mapString(value)
+	case WebhookFieldURLs:
+		c.URLs, err = mapStrings(value)
+	case WebhookFieldExpiresAt:
+		var t time.Time
+		t, err = mapTime(value)
+		c.ExpiresAt = &t
+	case WebhookFieldCreatedAt:
+		v.CreatedAt, err = mapTime(value)
+	case WebhookFieldStyle:
+		v.Style, err = mapLabels(value)
+	case WebhookFieldSubject:
+		v.Subject, err = mapLabels(value)
+	case WebhookFieldArea:
+		v.Area, err = mapLabels(value)
+	}
+
+	return err
+}
+
+// lookupPath returns the value at the path of the JSON document, false when a key is missing or null.
+// The values of a key ending in [] are the values at the rest of the path of every element of its array.
+func lookupPath(doc any, path string) (any, bool) {
+	if path == "" {
+		return doc, doc != nil
+	}
+	key, rest, _ := strings.Cut(path, ".")
+	key, each := strings.CutSuffix(key, "[]")
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	value, ok := obj[key]
+	if !ok || value == nil {
+		return nil, false
+	}
+	if !each {
+		return lookupPath(value, rest)
+	}
+
+	elems, ok := value.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make([]any, 0, len(elems))
+	for _, elem := range elems {
+		v, ok := lookupPath(elem, rest)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, v)
+	}
+
+	return out, true
+}
+
+// mapString accepts a string or a number, as the IDs of the CMSes are either.
+func mapString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case json.Number:
+		return v.String(), nil
+	}
+
+	return "", fmt.Errorf("isn't a non-empty string")
+}
+
+// mapStrings accepts a string or an array of them.
+func mapStrings(value any) ([]string, error) {
+	elems, ok := value.([]any)
+	if !ok {
+		elems = []any{value}
+	}
+	out := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		s, err := mapString(elem)
+		if err != nil {
+			return nil, fmt.Errorf("isn't a string or an array of strings")
+		}
+		out = append(out, s)
+	}
+
+	return out, nil
+}
+
+// mapTime accepts an RFC 3339 string or Unix seconds.
+func mapTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+	case json.Number:
+		if unix, err := v.Int64(); err == nil {
+			return time.Unix(unix, 0).UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("isn't an RFC 3339 time or Unix seconds")
+}
+
+// mapLabels accepts an object of the proximities by label, or labels as a string or an array of them, at proximity 1.
+func mapLabels(value any) (LabelSet, error) {
+	if obj, ok := value.(map[string]any); ok {
+		ls := make(LabelSet, len(obj))
+		for label, raw := range obj {
+			n, ok := raw.(json.Number)
+			proximity, err := n.Float64()
+			if !ok || err != nil {
+				return nil, fmt.Errorf("label %q has no numeric proximity", label)
+			}
+			ls[label] = proximity
+		}
+		return ls, nil
+	}
+
+	labels, err := mapStrings(value)
+	if err != nil {
+		return nil, fmt.Errorf("isn't an object of proximities, a string or an array of strings")
+	}
+	ls := make(LabelSet, len(labels))
+	for _, label := range labels {
+		ls[label] = 1
+	}
+
+	return ls, nil
+}
+
+// IngestWebhook verifies the delivery of a partner, maps its payload & imports the records.
+// It fails with ErrInvalidSignature or ErrWebhookReplayed before reading the payload, then with a MappingError.
+// A delivery turned away by a full ingestion queue may be retried as is.
+func (e *SearchEngine) IngestWebhook(ctx context.Context, h http.Header, body []byte) (string, ImportSummary, error) {
+	name, partner, err := e.verifyWebhook(h, body)
+	if err != nil {
+		return "", ImportSummary{}, err
+	}
+	records, err := e.mapWebhook(partner.Mapping, body)
+	if err != nil {
+		return name, ImportSummary{}, err
+	}
+
+	var ndjson bytes.Buffer
+	enc := json.NewEncoder(&ndjson)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return name, ImportSummary{}, err
+		}
+	}
+	mode := partner.Mode
+	if mode == "" {
+		mode = ImportOverwrite
+	}
+
+	summary, err := e.Import(ContextWithPrincipal(ctx, Principal{Partner: name}), &ndjson, ImportOptions{Mode: mode})
+	if errors.Is(err, ErrIngestBusy) {
+		e.webhooks.forget(strings.ToLower(strings.TrimPrefix(h.Get(WebhookSignatureHeader), "sha256=")))
+	}
+
+	return name, summary, err
+}
+
+// handleWebhook ingests the deliveries of the partners, they're authenticated by their signatures.
+func handleWebhook(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, se.configuration.WebhookPolicy.MaxBodyBytes))
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeError(w, http.StatusRequestEntityTooLarge, "webhook_too_large", fmt.Sprintf("the delivery exceeds %d bytes", tooLarge.Limit))
+			return
+		case err != nil:
+			writeError(w, http.StatusBadRequest, "invalid_webhook", "reading the delivery failed")
+			return
+		}
+
+		partner, summary, err := se.IngestWebhook(r.Context(), r.Header, body)
+		var mapping *MappingError
+		switch {
+		case errors.Is(err, ErrInvalidSignature):
+			writeError(w, http.StatusUnauthorized, "invalid_signature", "the delivery isn't signed by a known partner")
+		case errors.Is(err, ErrWebhookReplayed):
+			writeError(w, http.StatusUnauthorized, "webhook_replayed", err.Error())
+		case errors.Is(err, ErrInvalidWebhook):
+			writeError(w, http.StatusBadRequest, "invalid_webhook", err.Error())
+		case errors.As(err, &mapping):
+			message := mapping.Error()
+			if lw, ok := unwrapWriter[*localizedWriter](w); ok {
+				message = lw.localize("unmapped_fields", message)
+			}
+			writeJSON(w, http.StatusUnprocessableEntity, Response{Error: &APIError{Code: "unmapped_fields", Message: message, Fields: mapping.Fields}})
+		case err != nil:
+			writeImportError(w, se, err)
+		default:
+			r = r.WithContext(ContextWithPrincipal(r.Context(), Principal{Partner: partner}))
+			se.recordAudit(w, r, AuditWebhook, partner, "", fmt.Sprintf("imported %d, skipped %d, failed %d", summary.Imported, summary.Skipped, summary.Failed))
+			se.setConsistencyToken(w)
+			writeJSON(w, http.StatusOK, summary)
+		}
+	})
+}
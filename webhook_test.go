@@ -0,0 +1,190 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const studioSecret = "studio-secret"
+
+// studioPayload is the shape of the deliveries of the studio's CMS.
+const studioPayload = `{"data": {"tattoos": [
+	{"uid": 101, "images": [{"src": "a.jpg"}, {"src": "b.jpg"}], "artist": {"handle": "mira"}, "styles": ["blackwork"], "tags": {"lion": 0.9}},
+	{"uid": "102", "images": [{"src": "c.jpg"}], "styles": "traditional", "tags": {"rose": 0.8}}
+]}}`
+
+// deliver posts the body as the studio, signed with the secret at the timestamp.
+func deliver(se *httptest.Server, body, signed string, secret string, at time.Time) (int, searchAPI.Response, searchAPI.ImportSummary) {
+	GinkgoHelper()
+	req, err := http.NewRequest(http.MethodPost, se.URL+"/ingest/webhook", strings.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set(searchAPI.WebhookPartnerHeader, "studio")
+	req.Header.Set(searchAPI.WebhookTimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	req.Header.Set(searchAPI.WebhookSignatureHeader, searchAPI.SignWebhook(secret, at, []byte(signed)))
+	resp, err := se.Client().Do(req)
+	Expect(err).NotTo(HaveOccurred())
+	defer resp.Body.Close()
+
+	var (
+		errBody searchAPI.Response
+		summary searchAPI.ImportSummary
+	)
+	if resp.StatusCode == http.StatusOK {
+		Expect(json.NewDecoder(resp.Body).Decode(&summary)).To(Succeed())
+	} else {
+		Expect(json.NewDecoder(resp.Body).Decode(&errBody)).To(Succeed())
+	}
+
+	return resp.StatusCode, errBody, summary
+}
+
+var _ = Describe("Partner webhooks", func() {
+	var (
+		is     *searchAPI.MemoryImageStore
+		vs     *searchAPI.MemoryVectorStore
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+		clock  *inkinspottest.FakeClock
+	)
+
+	BeforeEach(func() {
+		is = searchAPI.NewMemoryImageStore()
+		vs = searchAPI.NewMemoryVectorStore()
+		clock = inkinspottest.NewFakeClock(time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC))
+		cfg := searchAPI.Configuration{WebhookPolicy: searchAPI.WebhookPolicy{
+			Partners: map[string]searchAPI.WebhookPartner{"studio": {
+				Secret: studioSecret,
+				Mapping: searchAPI.WebhookMapping{
+					Items: "data.tattoos",
+					Fields: map[string]string{
+						searchAPI.WebhookFieldID:       "uid",
+						searchAPI.WebhookFieldURLs:     "images[].src",
+						searchAPI.WebhookFieldArtistID: "artist.handle",
+						searchAPI.WebhookFieldStyle:    "styles",
+						searchAPI.WebhookFieldSubject:  "tags",
+					},
+				},
+			}},
+		}}
+		Expect(cfg.WebhookPolicy.Validate()).To(Succeed())
+		engine = searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	stored := func(ids ...string) []searchAPI.TattooImagesCollection {
+		GinkgoHelper()
+		cols, _ := is.GetTattoosByID(context.Background(), ids)
+		return cols
+	}
+
+	It("imports the mapped tattoos of a signed delivery", func() {
+		code, _, summary := deliver(se, studioPayload, studioPayload, studioSecret, clock.Now())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(summary).To(Equal(searchAPI.ImportSummary{Imported: 2}))
+
+		Expect(stored("101", "102")).To(ConsistOf(
+			searchAPI.TattooImagesCollection{ID: "101", URLs: []string{"a.jpg", "b.jpg"}, ArtistID: "mira", Version: 1},
+			searchAPI.TattooImagesCollection{ID: "102", URLs: []string{"c.jpg"}, Version: 1},
+		))
+		vectors, err := vs.GetVectorsByID(context.Background(), []string{"101", "102"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vectors).To(ConsistOf(
+			searchAPI.TattooImagesVector{ID: "101", Style: searchAPI.LabelSet{"blackwork": 1}, Subject: searchAPI.LabelSet{"lion": 0.9}, CreatedAt: clock.Now(), Version: 1},
+			searchAPI.TattooImagesVector{ID: "102", Style: searchAPI.LabelSet{"traditional": 1}, Subject: searchAPI.LabelSet{"rose": 0.8}, CreatedAt: clock.Now(), Version: 1},
+		))
+		Expect(doQuery(se, "lion").JSON.ImageCollections).To(HaveLen(1))
+
+		log, err := engine.AuditLog(context.Background(), searchAPI.AuditQuery{Action: searchAPI.AuditWebhook})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log.Entries).To(HaveLen(1))
+		Expect(log.Entries[0].Actor).To(Equal("studio"))
+	})
+
+	It("refuses a tampered body", func() {
+		tampered := strings.Replace(studioPayload, "a.jpg", "evil.jpg", 1)
+		code, resp, _ := deliver(se, tampered, studioPayload, studioSecret, clock.Now())
+		Expect(code).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Error.Code).To(Equal("invalid_signature"))
+		Expect(stored("101")).To(BeEmpty())
+	})
+
+	It("refuses the deliveries signed with another secret", func() {
+		code, resp, _ := deliver(se, studioPayload, studioPayload, "guessed", clock.Now())
+		Expect(code).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Error.Code).To(Equal("invalid_signature"))
+	})
+
+	It("refuses the timestamps out of the replay window", func() {
+		for _, at := range []time.Time{clock.Now().Add(-6 * time.Minute), clock.Now().Add(6 * time.Minute)} {
+			code, resp, _ := deliver(se, studioPayload, studioPayload, studioSecret, at)
+			Expect(code).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Error.Code).To(Equal("webhook_replayed"))
+		}
+		Expect(stored("101")).To(BeEmpty())
+	})
+
+	It("accepts a delivery once within the replay window", func() {
+		at := clock.Now()
+		code, _, _ := deliver(se, studioPayload, studioPayload, studioSecret, at)
+		Expect(code).To(Equal(http.StatusOK))
+
+		clock.Advance(time.Minute)
+		code, resp, _ := deliver(se, studioPayload, studioPayload, studioSecret, at)
+		Expect(code).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Error.Code).To(Equal("webhook_replayed"))
+		Expect(resp.Error.Message).To(ContainSubstring("already accepted"))
+
+		code, _, _ = deliver(se, studioPayload, studioPayload, studioSecret, clock.Now())
+		Expect(code).To(Equal(http.StatusOK), "a new delivery of the same payload")
+	})
+
+	It("identifies the fields the payload couldn't be mapped to", func() {
+		payload := `{"data": {"tattoos": [
+			{"uid": "201", "images": [{"src": "a.jpg"}]},
+			{"images": "b.jpg", "tags": {"lion": "high"}},
+			{"uid": "203", "images": [{"url": "c.jpg"}], "styles": [{"name": "koi"}]}
+		]}}`
+		code, resp, _ := deliver(se, payload, payload, studioSecret, clock.Now())
+		Expect(code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(resp.Error.Code).To(Equal("unmapped_fields"))
+		Expect(resp.Error.Fields).To(Equal([]searchAPI.UnmappedField{
+			{Item: 2, Field: "id", Path: "uid", Reason: "is missing"},
+			{Item: 2, Field: "urls", Path: "images[].src", Reason: "is missing"},
+			{Item: 2, Field: "subject", Path: "tags", Reason: `label "lion" has no numeric proximity`},
+			{Item: 3, Field: "urls", Path: "images[].src", Reason: "is missing"},
+			{Item: 3, Field: "style", Path: "styles", Reason: "isn't an object of proximities, a string or an array of strings"},
+		}))
+		Expect(resp.Error.Message).To(ContainSubstring("item 2 id (uid is missing)"))
+		Expect(stored("201")).To(BeEmpty(), "nothing is imported of a payload which doesn't map")
+	})
+
+	It("reports a payload without the array of tattoos", func() {
+		payload := `{"data": {"tattoo": {}}}`
+		code, resp, _ := deliver(se, payload, payload, studioSecret, clock.Now())
+		Expect(code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(resp.Error.Fields).To(Equal([]searchAPI.UnmappedField{{Field: "items", Path: "data.tattoos", Reason: "isn't an array"}}))
+	})
+
+	It("validates the mappings of the partners", func() {
+		p := searchAPI.WebhookPolicy{Partners: map[string]searchAPI.WebhookPartner{"studio": {
+			Secret:  studioSecret,
+			Mapping: searchAPI.WebhookMapping{Fields: map[string]string{searchAPI.WebhookFieldID: "uid"}},
+		}}}
+		Expect(p.Validate()).To(MatchError(ContainSubstring("doesn't map the urls")))
+
+		p.Partners["studio"].Mapping.Fields["colour"] = "ink"
+		Expect(p.Validate()).To(MatchError(searchAPI.ErrInvalidWebhook))
+	})
+})
@@ -0,0 +1,74 @@
+package inkinspot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Facet weight overrides", func() {
+	var se *httptest.Server
+
+	BeforeEach(func() {
+		cfg := searchAPI.Configuration{CachePolicy: searchAPI.CachePolicy{TTL: time.Minute}}
+		se = httptest.NewServer(searchAPI.NewHandler(initSeededSearchEngine(cfg)))
+		DeferCleanup(se.Close)
+	})
+
+	When("a facet weight is overridden", func() {
+		It("reorders the results by the overridden weight", func() {
+			res := doSearch(se, url.Values{"q": {"realistic tiger"}, "w_style": {"2"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Z"}))
+
+			res = doSearch(se, url.Values{"q": {"realistic tiger"}, "w_subject": {"2"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"Z", "X"}))
+		})
+
+		It("echoes the effective weights in the explanation", func() {
+			res := doSearch(se, url.Values{"q": {"tiger"}, "w_area": {"0.5"}, "explain": {"true"}})
+			Expect(res.Status).To(Equal(http.StatusOK))
+			Expect(res.JSON.Explain.Weights).To(Equal(searchAPI.RankingPolicy{
+				StyleWeight: 1, SubjectWeight: 1, AreaWeight: 0.5,
+			}))
+		})
+
+		It("doesn't serve the results cached under other weights", func() {
+			res := doSearch(se, url.Values{"q": {"realistic tiger"}, "w_style": {"2"}})
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Z"}))
+
+			res = doSearch(se, url.Values{"q": {"realistic tiger"}, "w_subject": {"2"}})
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"Z", "X"}))
+
+			res = doSearch(se, url.Values{"q": {"realistic tiger"}, "w_style": {"2"}})
+			Expect(collectionIDs(res.JSON.ImageCollections)).To(Equal([]string{"X", "Z"}))
+		})
+	})
+
+	DescribeTable("invalid weights return a 400 Bad Request",
+		func(param, value string) {
+			res := doSearch(se, url.Values{"q": {"tiger"}, param: {value}})
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Code).To(Equal("invalid_weight"))
+		},
+		Entry("above the bound", "w_style", "11"),
+		Entry("negative", "w_subject", "-1"),
+		Entry("not a number", "w_area", "abc"),
+		Entry("NaN", "w_style", "NaN"),
+	)
+
+	It("reports the first invalid weight in parameter order", func() {
+		for range 20 {
+			res := doSearch(se, url.Values{"q": {"tiger"}, "w_area": {"abc"}, "w_subject": {"abc"}, "w_style": {"abc"}})
+			Expect(res.Status).To(Equal(http.StatusBadRequest))
+			Expect(res.JSON.Error.Message).To(ContainSubstring("w_style must be a number"))
+		}
+	})
+})
@@ -0,0 +1,51 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// deadlineWriter carries the write deadline of the response, the WriteTimeout of the server policy from when the request came.
+// The deadline is set on the connection, it's by the wall clock whatever the engine clock.
+type deadlineWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	deadline time.Time
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the response.
+func (w *deadlineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withWriteDeadline bounds the writes of the encoded responses by the write timeout of the server policy.
+// A slow client can't hold the handler & its buffer past it.
+func withWriteDeadline(se *SearchEngine, h http.Handler) http.Handler {
+	budget := se.configuration.ServerPolicy.WriteTimeout
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&deadlineWriter{ResponseWriter: w, ctx: r.Context(), deadline: time.Now().Add(budget)}, r)
+	})
+}
+
+// writeWithDeadline writes the encoded body within the write deadline of the response, when it has one.
+// The body is only written once fully encoded, an aborted write never cuts the encoding short.
+// The client sees the connection close short of the Content-Length, the server lifts the deadline after the request.
+func writeWithDeadline(w http.ResponseWriter, buf *bytes.Buffer) {
+	dw, ok := unwrapWriter[*deadlineWriter](w)
+	if ok {
+		// the writers which can't take deadlines, as the recorders of the tests, write without.
+		if err := http.NewResponseController(w).SetWriteDeadline(dw.deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.WarnContext(dw.ctx, "setting the write deadline failed", "error", err)
+		}
+	}
+
+	// the clients which went away fail the writes too, they aren't logged.
+	if _, err := w.Write(buf.Bytes()); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		slog.ErrorContext(dw.ctx, "writing the response timed out", "error", err, "bytes", buf.Len(), "deadline", dw.deadline)
+	}
+}
@@ -0,0 +1,73 @@
+package inkinspot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Write deadlines", func() {
+	var (
+		se       *httptest.Server
+		returned chan struct{}
+		mu       sync.Mutex
+		logs     bytes.Buffer
+	)
+
+	// the collection encodes to ~16MB, more than the socket buffers hold.
+	BeforeEach(func() {
+		is := searchAPI.NewMemoryImageStore()
+		urls := make([]string, 160_000)
+		for i := range urls {
+			urls[i] = fmt.Sprintf("https://cdn.example.com/tattoos/huge/%06d/%s.jpg", i, strings.Repeat("x", 48))
+		}
+		Expect(is.AddCollection(context.Background(), searchAPI.TattooImagesCollection{ID: "huge", URLs: urls})).To(Succeed())
+
+		cfg := searchAPI.Configuration{ServerPolicy: searchAPI.ServerPolicy{WriteTimeout: 200 * time.Millisecond}}
+		h := searchAPI.NewHandler(searchAPI.NewSearchEngine(cfg, is, searchAPI.NewMemoryVectorStore()))
+		returned = make(chan struct{}, 1)
+		se = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+			returned <- struct{}{}
+		}))
+		DeferCleanup(se.Close)
+
+		mu.Lock()
+		logs.Reset()
+		mu.Unlock()
+		prev := slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(lockedWriter{&mu, &logs}, nil)))
+		DeferCleanup(func() { slog.SetDefault(prev) })
+	})
+
+	It("aborts the write to a client which doesn't read", func() {
+		conn, err := net.Dial("tcp", se.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		_, err = fmt.Fprintf(conn, "GET /tattoos/huge HTTP/1.1\r\nHost: %s\r\n\r\n", se.Listener.Addr())
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(returned).WithTimeout(3*time.Second).Should(Receive(), "the handler is stuck writing")
+		Eventually(func() string {
+			mu.Lock()
+			defer mu.Unlock()
+			return logs.String()
+		}).Should(ContainSubstring("writing the response timed out"))
+
+		body, _ := io.ReadAll(conn)
+		Expect(len(body)).To(BeNumerically("<", 16<<20), "the response was cut short")
+	})
+})
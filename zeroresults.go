@@ -0,0 +1,276 @@
+package inkinspot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DanyPops/inkinspot/httpx"
+)
+
+// zeroResultBuckets is the number of buckets the window of the zero result ratio slides by.
+const zeroResultBuckets = 10
+
+// Alert states, an incident fires once & resolves once.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertZeroResults is the name of the alert of the zero result ratio.
+const AlertZeroResults = "zero_results"
+
+// ZeroResultPolicy is when the engine alerts on the searches finding nothing, as a wiped vector store index makes them.
+// Zero values are replaced by the defaults.
+type ZeroResultPolicy struct {
+	// Window is the sliding window the ratio of the searches without results is measured over.
+	Window time.Duration
+	// Threshold is the ratio an incident starts at, once it's held for the For duration.
+	Threshold float64
+	// ResolveThreshold is the ratio the incident resolves below, under the threshold so a ratio around it doesn't flap.
+	ResolveThreshold float64
+	// For is how long the ratio must stay at the threshold before the alert fires.
+	For time.Duration
+	// MinSearches is the least searches in the window for the ratio to count, the few searches of a quiet night don't alert.
+	MinSearches int
+	// HookTimeout bounds a call of the alert hook.
+	HookTimeout time.Duration
+}
+
+func (p ZeroResultPolicy) withDefaults() ZeroResultPolicy {
+	if p.Window <= 0 {
+		p.Window = 5 * time.Minute
+	}
+	if p.Threshold <= 0 {
+		p.Threshold = 0.5
+	}
+	if p.ResolveThreshold <= 0 || p.ResolveThreshold > p.Threshold {
+		p.ResolveThreshold = p.Threshold / 2
+	}
+	if p.For <= 0 {
+		p.For = 2 * time.Minute
+	}
+	if p.MinSearches <= 0 {
+		p.MinSearches = 20
+	}
+	if p.HookTimeout <= 0 {
+		p.HookTimeout = 5 * time.Second
+	}
+
+	return p
+}
+
+// Alert is a change of state of an incident.
+type Alert struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Ratio & Searches are the measure of the window which changed the state.
+	Ratio    float64   `json:"ratio"`
+	Searches int       `json:"searches"`
+	Since    time.Time `json:"since"`
+	Time     time.Time `json:"time"`
+}
+
+// AlertHook is told about the incidents, once when they fire & once when they resolve.
+type AlertHook interface {
+	Alert(ctx context.Context, a Alert) error
+}
+
+// WithAlertHook sets the hook of the incidents, a LogAlertHook of the default logger by default.
+func WithAlertHook(h AlertHook) SearchEngineOption {
+	return func(e *SearchEngine) {
+		e.alertHook = h
+	}
+}
+
+// LogAlertHook logs the alerts, firing at the warning level & resolved at the info level.
+type LogAlertHook struct {
+	// Logger is the default logger when nil.
+	Logger *slog.Logger
+}
+
+func (h LogAlertHook) Alert(ctx context.Context, a Alert) error {
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	if a.State == AlertFiring {
+		level = slog.LevelWarn
+	}
+	logger.Log(ctx, level, "alert "+a.State, "alert", a.Name, "ratio", a.Ratio, "searches", a.Searches, "since", a.Since)
+
+	return nil
+}
+
+// WebhookAlertHook posts the alerts as JSON to its URL.
+type WebhookAlertHook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlertHook posts the alerts to the URL, with a client of httpx.NewClient when nil.
+func NewWebhookAlertHook(url string, client *http.Client) WebhookAlertHook {
+	if client == nil {
+		client = httpx.NewClient(httpx.ClientPolicy{})
+	}
+
+	return WebhookAlertHook{url: url, client: client}
+}
+
+// Alert posts the alert, the responses other than 2xx fail it.
+func (h WebhookAlertHook) Alert(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", MediaTypeJSON)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("alert webhook answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// ZeroResultStatus is the gauge of the searches without results over the window.
+type ZeroResultStatus struct {
+	Ratio       float64 `json:"ratio"`
+	Searches    int     `json:"searches"`
+	ZeroResults int     `json:"zero_results"`
+	// Alerting reports whether an incident is open, since Since.
+	Alerting bool       `json:"alerting"`
+	Since    *time.Time `json:"since,omitempty"`
+}
+
+// zeroResultBucket counts the searches of a slice of the window.
+type zeroResultBucket struct {
+	start    time.Time
+	searches int
+	zero     int
+}
+
+// zeroResults slides the window of the searches & keeps the state of the incident.
+type zeroResults struct {
+	mu      sync.Mutex
+	buckets []zeroResultBucket
+	// above is when the ratio reached the threshold, zero while it's under.
+	above time.Time
+	// firing is when the open incident fired, zero without one.
+	firing time.Time
+}
+
+// measure returns the searches & the searches without results of the window, the older buckets are dropped.
+func (z *zeroResults) measure(now time.Time, window time.Duration) (int, int) {
+	keep := z.buckets[:0]
+	searches, zero := 0, 0
+	for _, b := range z.buckets {
+		if now.Sub(b.start) >= window {
+			continue
+		}
+		keep = append(keep, b)
+		searches += b.searches
+		zero += b.zero
+	}
+	z.buckets = keep
+
+	return searches, zero
+}
+
+// recordSearch counts a search in the window, without results when empty, & alerts on the state changes of the incident.
+func (e *SearchEngine) recordSearch(empty bool) {
+	p := e.configuration.ZeroResultPolicy
+	now := e.clock.Now()
+	width := p.Window / zeroResultBuckets
+
+	z := e.zeroResults
+	z.mu.Lock()
+	start := now.Truncate(width)
+	if n := len(z.buckets); n == 0 || !z.buckets[n-1].start.Equal(start) {
+		z.buckets = append(z.buckets, zeroResultBucket{start: start})
+	}
+	last := &z.buckets[len(z.buckets)-1]
+	last.searches++
+	if empty {
+		last.zero++
+	}
+
+	searches, zero := z.measure(now, p.Window)
+	if searches < p.MinSearches {
+		z.mu.Unlock()
+		return
+	}
+	ratio := float64(zero) / float64(searches)
+
+	alert := Alert{Name: AlertZeroResults, Ratio: ratio, Searches: searches, Time: now}
+	switch {
+	case ratio >= p.Threshold && z.above.IsZero():
+		z.above = now
+	case ratio < p.Threshold:
+		z.above = time.Time{}
+	}
+	switch {
+	case z.firing.IsZero() && !z.above.IsZero() && now.Sub(z.above) >= p.For:
+		z.firing = now
+		alert.State, alert.Since = AlertFiring, z.above
+	case !z.firing.IsZero() && ratio < p.ResolveThreshold:
+		alert.State, alert.Since = AlertResolved, z.firing
+		z.firing = time.Time{}
+	}
+	z.mu.Unlock()
+
+	if alert.State != "" {
+		go e.alert(alert)
+	}
+}
+
+// alert calls the hook off the search path, its failures are logged.
+func (e *SearchEngine) alert(a Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.configuration.ZeroResultPolicy.HookTimeout)
+	defer cancel()
+
+	if err := e.alertHook.Alert(ctx, a); err != nil {
+		slog.Error("the alert hook failed", "alert", a.Name, "state", a.State, "error", err)
+	}
+}
+
+// ZeroResults returns the ratio of the searches without results over the window & the open incident.
+func (e *SearchEngine) ZeroResults() ZeroResultStatus {
+	z := e.zeroResults
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	searches, zero := z.measure(e.clock.Now(), e.configuration.ZeroResultPolicy.Window)
+	status := ZeroResultStatus{Searches: searches, ZeroResults: zero, Alerting: !z.firing.IsZero()}
+	if status.Alerting {
+		since := z.firing
+		status.Since = &since
+	}
+	if searches > 0 {
+		status.Ratio = float64(zero) / float64(searches)
+	}
+
+	return status
+}
+
+// handleZeroResults reports the gauge of the searches without results.
+func handleZeroResults(se *SearchEngine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, se.ZeroResults())
+	})
+}
@@ -0,0 +1,163 @@
+package inkinspot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	searchAPI "github.com/DanyPops/inkinspot"
+	"github.com/DanyPops/inkinspot/inkinspottest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// alertRecorder sends the alerts it's told about on its channel.
+type alertRecorder chan searchAPI.Alert
+
+func (r alertRecorder) Alert(_ context.Context, a searchAPI.Alert) error {
+	r <- a
+	return nil
+}
+
+var _ = Describe("Zero result alerting", func() {
+	var (
+		clock  *inkinspottest.FakeClock
+		alerts alertRecorder
+		engine *searchAPI.SearchEngine
+		se     *httptest.Server
+		start  time.Time
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)
+		clock = inkinspottest.NewFakeClock(start)
+		alerts = make(alertRecorder, 10)
+		cfg := searchAPI.Configuration{
+			AdminPolicy:      searchAPI.AdminPolicy{Token: adminToken},
+			ZeroResultPolicy: searchAPI.ZeroResultPolicy{MinSearches: 10},
+		}
+		is, vs := inkinspottest.NewFakeStores(inkinspottest.BigCats...)
+		engine = searchAPI.NewSearchEngine(cfg, is, vs, searchAPI.WithClock(clock), searchAPI.WithAlertHook(alerts))
+		se = httptest.NewServer(searchAPI.NewHandler(engine))
+		DeferCleanup(se.Close)
+	})
+
+	search := func(query string, times int) {
+		GinkgoHelper()
+		for range times {
+			Expect(doQuery(se, query).Status).To(Equal(http.StatusOK))
+		}
+	}
+	hits := func(times int) { GinkgoHelper(); search("lion", times) }
+	misses := func(times int) { GinkgoHelper(); search("unicorn", times) }
+
+	It("fires once when the ratio holds at the threshold, & resolves once under the resolve threshold", func() {
+		hits(10)
+		misses(10)
+		clock.Advance(time.Minute)
+		misses(10)
+		Consistently(alerts, "50ms").ShouldNot(Receive(), "the ratio hasn't held for 2m yet")
+
+		clock.Advance(time.Minute)
+		misses(1)
+		var a searchAPI.Alert
+		Eventually(alerts).Should(Receive(&a))
+		Expect(a.Name).To(Equal(searchAPI.AlertZeroResults))
+		Expect(a.State).To(Equal(searchAPI.AlertFiring))
+		Expect(a.Since).To(Equal(start))
+		Expect(a.Searches).To(Equal(31))
+
+		misses(10)
+		Consistently(alerts, "50ms").ShouldNot(Receive(), "the incident is open")
+		firing := start.Add(2 * time.Minute)
+		Expect(engine.ZeroResults()).To(Equal(searchAPI.ZeroResultStatus{
+			Ratio: 31.0 / 41, Searches: 41, ZeroResults: 31, Alerting: true, Since: &firing,
+		}))
+
+		By("staying between the thresholds")
+		clock.Advance(time.Minute)
+		hits(50)
+		Expect(engine.ZeroResults().Ratio).To(BeNumerically("~", 31.0/91, 0.001))
+		Consistently(alerts, "50ms").ShouldNot(Receive(), "the ratio is above the resolve threshold")
+
+		By("recovering")
+		clock.Advance(4 * time.Minute)
+		hits(30)
+		Eventually(alerts).Should(Receive(&a))
+		Expect(a.State).To(Equal(searchAPI.AlertResolved))
+		Expect(a.Since).To(Equal(firing))
+		Expect(a.Ratio).To(BeNumerically("<", 0.25))
+		Consistently(alerts, "50ms").ShouldNot(Receive())
+		Expect(engine.ZeroResults().Alerting).To(BeFalse())
+
+		By("firing again on the next incident")
+		clock.Advance(10 * time.Minute)
+		misses(10)
+		clock.Advance(2 * time.Minute)
+		misses(1)
+		Eventually(alerts).Should(Receive(&a))
+		Expect(a.State).To(Equal(searchAPI.AlertFiring))
+		Expect(a.Since).To(Equal(start.Add(17 * time.Minute)))
+	})
+
+	It("doesn't fire on a dip shorter than the For duration", func() {
+		hits(10)
+		misses(20)
+		clock.Advance(time.Minute)
+		hits(30)
+		clock.Advance(2 * time.Minute)
+		hits(1)
+		Consistently(alerts, "50ms").ShouldNot(Receive())
+	})
+
+	It("doesn't alert below the least searches", func() {
+		misses(9)
+		clock.Advance(3 * time.Minute)
+		Consistently(alerts, "50ms").ShouldNot(Receive())
+		Expect(engine.ZeroResults()).To(Equal(searchAPI.ZeroResultStatus{Ratio: 1, Searches: 9, ZeroResults: 9}))
+	})
+
+	It("reports the gauge to the admins", func() {
+		hits(3)
+		misses(1)
+
+		req, err := http.NewRequest(http.MethodGet, se.URL+"/admin/zero-results", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		resp, err := se.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		var status map[string]any
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+		Expect(status).To(Equal(map[string]any{"ratio": 0.25, "searches": 4.0, "zero_results": 1.0, "alerting": false}))
+	})
+})
+
+var _ = Describe("Webhook alert hook", func() {
+	It("posts the alert as JSON", func() {
+		received := make(chan searchAPI.Alert, 1)
+		status := http.StatusNoContent
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var a searchAPI.Alert
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(json.NewDecoder(r.Body).Decode(&a)).To(Succeed())
+			received <- a
+			w.WriteHeader(status)
+		}))
+		DeferCleanup(srv.Close)
+
+		hook := searchAPI.NewWebhookAlertHook(srv.URL, srv.Client())
+		at := time.Date(2026, 10, 5, 12, 0, 0, 0, time.UTC)
+		alert := searchAPI.Alert{Name: searchAPI.AlertZeroResults, State: searchAPI.AlertFiring, Ratio: 0.75, Searches: 40, Since: at, Time: at.Add(2 * time.Minute)}
+		Expect(hook.Alert(context.Background(), alert)).To(Succeed())
+		Expect(<-received).To(Equal(alert))
+
+		status = http.StatusBadGateway
+		Expect(hook.Alert(context.Background(), alert)).To(MatchError(ContainSubstring("502")))
+	})
+})